@@ -17,24 +17,289 @@ limitations under the License.
 package local
 
 import (
+	"context"
 	"time"
 
 	"github.com/pkg/errors"
+	crdsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	crds "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 
 	"github.com/crossplane/crossplane-runtime/pkg/logging"
 	"github.com/crossplane/crossplane/apis/apiextensions"
 
+	"github.com/crossplane/agent/pkg/approval"
+	"github.com/crossplane/agent/pkg/backpressure"
+	"github.com/crossplane/agent/pkg/controllers/claim"
+	"github.com/crossplane/agent/pkg/controllers/namespace"
 	"github.com/crossplane/agent/pkg/controllers/xrd"
+	"github.com/crossplane/agent/pkg/digest"
+	"github.com/crossplane/agent/pkg/emergency"
+	"github.com/crossplane/agent/pkg/encryption"
+	"github.com/crossplane/agent/pkg/fleet"
+	"github.com/crossplane/agent/pkg/history"
+	"github.com/crossplane/agent/pkg/kubeconfig"
+	"github.com/crossplane/agent/pkg/maintenance"
+	"github.com/crossplane/agent/pkg/migration"
+	"github.com/crossplane/agent/pkg/notify"
+	"github.com/crossplane/agent/pkg/override"
+	"github.com/crossplane/agent/pkg/rbac"
+	"github.com/crossplane/agent/pkg/resource"
+	"github.com/crossplane/agent/pkg/schedule"
+	"github.com/crossplane/agent/pkg/secretcache"
+	"github.com/crossplane/agent/pkg/shard"
+	"github.com/crossplane/agent/pkg/snapshot"
+	"github.com/crossplane/agent/pkg/startup"
 )
 
 // Agent configures & starts the manager that will watch the local cluster.
 type Agent struct {
 	ClusterConfig *rest.Config
 	DefaultConfig *rest.Config
+
+	// RemoteNamespace is the namespace in the remote cluster that all claims
+	// are created in, e.g. when the remote cluster is the same cluster as the
+	// local one or when the cluster is registered with its own namespace.
+	// Claims are created in the same namespace as the local ones if it's
+	// empty.
+	RemoteNamespace string
+
+	// RemoteClaimLabels and RemoteClaimAnnotations are added to all claims
+	// created in the remote cluster so that the policies of the central
+	// cluster can use them for scheduling, quota and billing.
+	RemoteClaimLabels      map[string]string
+	RemoteClaimAnnotations map[string]string
+
+	// ClusterName is the name that identifies this cluster in the remote
+	// cluster, as given to agent init. The claims created in the remote
+	// cluster are labelled with it so that agent deregister finds them.
+	ClusterName string
+
+	// AttributeRequesters makes the agent annotate the claims created in the
+	// remote cluster with who requested their local claims, so that the
+	// central audit can attribute them to tools rather than the agent.
+	AttributeRequesters bool
+
+	// NamespaceCleanup makes the agent hold the deleted namespaces until the
+	// remote counterparts of their claims are deleted, which are deleted all
+	// at once rather than one claim at a time.
+	NamespaceCleanup bool
+
+	// SecretConflictPolicy determines what happens when the local connection
+	// secret of a claim exists but isn't owned by the claim.
+	SecretConflictPolicy claim.SecretConflictPolicy
+
+	// WithoutConnectionSecrets makes the agent never copy the connection
+	// secrets of the remote claims to the local cluster.
+	WithoutConnectionSecrets bool
+
+	// SecretNamespaces are the namespaces other than their own that the claims
+	// may have their connection secrets written to.
+	SecretNamespaces []string
+
+	// SecretLabels are the labels of the claims that are copied to their
+	// connection secrets. Entries that end with a slash match all the keys
+	// with that prefix.
+	SecretLabels []string
+
+	// SecretWorkers, if positive, is the number of workers that propagate the
+	// connection secrets of the claims in the background.
+	SecretWorkers int
+
+	// SecretRetries, if true, lets the connection secrets that fail to
+	// propagate during the sync of their claims be retried separately by
+	// connection secret workers, with a backoff that starts at
+	// SecretRetryBackoff and goes up to SecretRetryMaxBackoff, so that the
+	// claims keep being synced on time.
+	SecretRetries         bool
+	SecretRetryBackoff    time.Duration
+	SecretRetryMaxBackoff time.Duration
+
+	// SecretCacheTTL is how long the Secrets read from the remote cluster are
+	// cached. They're not cached if it's 0.
+	SecretCacheTTL time.Duration
+
+	// DeletionGracePeriod is how long the remote claims are kept after their
+	// local claims are deleted.
+	DeletionGracePeriod time.Duration
+
+	// DetectStaleRemotes makes the agent stop syncing the claims whose remote
+	// counterparts are older than the ones they were last synced to, e.g.
+	// because the remote cluster was restored from a backup.
+	DetectStaleRemotes bool
+
+	// ProvisioningSLAs are how long the claims may take to become ready, by
+	// kind.
+	ProvisioningSLAs claim.ProvisioningSLAs
+
+	// StatusConfigMaps makes the agent project the status fields of the
+	// claims that ask for it into ConfigMaps.
+	StatusConfigMaps bool
+
+	// ResolveCompositionSelectors makes the agent pick the composition of the
+	// claims with a selector from the Compositions in the local cluster.
+	ResolveCompositionSelectors bool
+
+	// DefaultCompositions makes the agent set the composition of the claims
+	// that neither reference nor select one to the default Composition of
+	// their CompositeResourceDefinition.
+	DefaultCompositions bool
+
+	// ClaimTemplatesNamespace, if given, is the namespace of the ConfigMaps
+	// that the local claims can be expanded from.
+	ClaimTemplatesNamespace string
+
+	// EmergencyStop halts all writes to the remote cluster. They're also
+	// halted while EmergencyStopConfigMap, if given, is annotated with
+	// emergency.AnnotationKeyEmergencyStop.
+	EmergencyStop          bool
+	EmergencyStopConfigMap types.NamespacedName
+
+	// Maintenance keeps the remote claims from being deleted while the local
+	// cluster is under maintenance. They're also kept while
+	// MaintenanceConfigMap, if given, is annotated with
+	// maintenance.AnnotationKeyMaintenance.
+	Maintenance          bool
+	MaintenanceConfigMap types.NamespacedName
+
+	// ObserveTeardown makes the agent report how far the deletion of the
+	// composed resources of remote claims has progressed.
+	ObserveTeardown bool
+
+	// LogDigestInterval, if given, is how often a digest of the syncs of
+	// every claim kind is logged at info level.
+	LogDigestInterval time.Duration
+
+	// SyncHistorySize, if positive, is how many of the last syncs of every
+	// claim are kept in memory to be served at /debug/sync-history of the
+	// metrics endpoint and dumped to stderr on SIGUSR1.
+	SyncHistorySize int
+
+	// RemoteSnapshots keeps a summary of the last observed state of every
+	// remote claim in memory to be served at /debug/remote-claims of the
+	// metrics endpoint.
+	RemoteSnapshots bool
+
+	// ApprovalKinds are the kinds of claims that are held in the local cluster
+	// until they're approved with a ClaimApproval, which is created either
+	// directly or at /approve of ApprovalAddress.
+	ApprovalKinds []string
+
+	// ApprovalAddress is the address that /approve is served at, with the
+	// TLS certificate and key in ApprovalTLSCertFile and ApprovalTLSKeyFile if
+	// they're given.
+	ApprovalAddress     string
+	ApprovalTLSCertFile string
+	ApprovalTLSKeyFile  string
+
+	// RequeueJitter is the share of the requeue intervals that is randomly
+	// added to or subtracted from them so that the claims that are synced
+	// together don't keep being requeued together.
+	RequeueJitter float64
+
+	// PrioritizeChanges makes the claims that are new or changed be synced
+	// before the routine resyncs of the claims that are doing fine. The
+	// resyncs are added to the queue of their controller once it holds fewer
+	// than ResyncBacklog claims.
+	PrioritizeChanges bool
+	ResyncBacklog     int
+
+	// Shard, if given, is the part of the claims that the agent syncs when
+	// the claims are split between several agent deployments. The shard is
+	// registered in the ShardRegistry ConfigMap, which refuses the shards
+	// that overlap the ones that were registered before them.
+	Shard         *shard.Shard
+	ShardRegistry types.NamespacedName
+
+	// SlowReconcileThreshold, if given, is how long the sync of a claim may
+	// take before it's logged along with how long each of its phases took.
+	SlowReconcileThreshold time.Duration
+
+	// SecretEncrypter, if given, encrypts the values of the connection
+	// secrets before they're written to the local cluster.
+	SecretEncrypter encryption.Encrypter
+
+	// Notifier, if given, is notified about the significant transitions of
+	// the claims, e.g. when they become ready.
+	Notifier notify.Notifier
+
+	// CRDConversion decides how the conversion webhooks of the claim CRDs are
+	// rendered in the local cluster.
+	CRDConversion resource.CRDConversion
+
+	// StructuralSchemas renders the claim CRDs with structural schemas whose
+	// unknown fields are pruned.
+	StructuralSchemas bool
+
+	// CRDDeletionPolicy decides what happens to the claims of the claim CRDs
+	// of the deleted CompositeResourceDefinitions. With the Cascade policy,
+	// they're deleted once CRDDeletionGracePeriod passes.
+	CRDDeletionPolicy      xrd.CRDDeletionPolicy
+	CRDDeletionGracePeriod time.Duration
+
+	// MigrateClaims enables the migration of the claims stored at old
+	// versions of their CRDs, whose fields are mapped with
+	// ClaimMigrationRules.
+	MigrateClaims       bool
+	ClaimMigrationRules []migration.Rule
+
+	// CRDOverrides merges the CRDOverrides in the local cluster over the claim
+	// CRDs synced from the remote cluster.
+	CRDOverrides bool
+
+	// SkipCRDManagement disables the sync of the CompositeResourceDefinitions
+	// and the claim CRDs, which are managed outside of the agent in that case.
+	// Only the claims of ClaimKinds are synced.
+	SkipCRDManagement bool
+	ClaimKinds        []schema.GroupVersionKind
+
+	// FleetReport, if given, is the SyncStatus in the remote cluster that a
+	// summary of the syncs of this agent is periodically written to.
+	FleetReport types.NamespacedName
+
+	// FleetReportNamespaces breaks the claim counts of the fleet report down
+	// by namespace, which are exposed as metrics as well.
+	FleetReportNamespaces bool
+
+	// PreservedAnnotations are the annotations of the local claims that are
+	// not copied to the remote claims.
+	PreservedAnnotations resource.PreservedAnnotations
+
+	// MetadataStrategy, if given, determines how the labels and annotations
+	// of the existing remote claims are equalized with the ones of the local
+	// claims.
+	MetadataStrategy resource.MetadataStrategy
+
+	// RemoteServerSideApply applies the remote claims with server-side apply
+	// so that the fields removed from the local claims are removed from them
+	// and the fields other managers own are reported rather than overwritten.
+	// It overrides MetadataStrategy.
+	RemoteServerSideApply bool
+
+	// RemoteIdentity is the identity that ClusterConfig is configured with in
+	// the remote cluster. It's included in the fleet report.
+	RemoteIdentity kubeconfig.Identity
+
+	// ClusterConfigWatcher, if given, is run with the manager to stop the agent
+	// once ClusterConfig is no longer valid, e.g. when it's rotated.
+	ClusterConfigWatcher manager.Runnable
+
+	// SyncCompleteFile, if given, is written once the initial sync is
+	// complete. The agent isn't ready until then if InitialSyncReadiness is
+	// true.
+	SyncCompleteFile     string
+	InitialSyncReadiness bool
+
+	// InitialSyncTimeout is how long the initial sync is waited for at
+	// most. The agent is ready once it passes, even if InitialSyncReadiness
+	// is true, but the signal file isn't written.
+	InitialSyncTimeout time.Duration
 }
 
 // Run adds all controllers and starts the manager that will watch the local cluster.
@@ -46,7 +311,8 @@ func (a *Agent) Run(log logging.Logger, period time.Duration) error {
 		return errors.Wrap(err, "cannot create cluster remote client")
 	}
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{SyncPeriod: &period, MetricsBindAddress: "127.0.0.1:8080"})
+	localConfig := ctrl.GetConfigOrDie()
+	mgr, err := ctrl.NewManager(localConfig, ctrl.Options{SyncPeriod: &period, MetricsBindAddress: "127.0.0.1:8080", HealthProbeBindAddress: ":8090"})
 	if err != nil {
 		return errors.Wrap(err, "cannot start local cluster manager")
 	}
@@ -55,13 +321,379 @@ func (a *Agent) Run(log logging.Logger, period time.Duration) error {
 		return errors.Wrap(err, "Cannot add CustomResourceDefinition API to scheme")
 	}
 
+	if err := crdsv1.AddToScheme(mgr.GetScheme()); err != nil {
+		return errors.Wrap(err, "Cannot add CustomResourceDefinition v1 API to scheme")
+	}
+
+	// The claim CRDs are written with whichever CustomResourceDefinition API
+	// the local cluster serves so that the agent works across mixed fleets.
+	dc, err := discovery.NewDiscoveryClientForConfig(localConfig)
+	if err != nil {
+		return errors.Wrap(err, "cannot create local discovery client")
+	}
+	crdVersion, err := resource.DiscoverCRDVersion(dc)
+	if err != nil {
+		return errors.Wrap(err, "cannot discover the CustomResourceDefinition version of the local cluster")
+	}
+	log.Debug("Discovered local CustomResourceDefinition version", "version", crdVersion)
+
 	if err := apiextensions.AddToScheme(mgr.GetScheme()); err != nil {
 		return errors.Wrap(err, "Cannot add Crossplane apiextensions API to scheme")
 	}
-	// TODO(muvaf): Need to pass in the default config.
-	if err := xrd.Setup(mgr, clusterRemoteClient, log); err != nil {
-		return errors.Wrap(err, "cannot setup CompositeResourceDefinition reconciler")
+	so := []emergency.SwitchOption{emergency.WithEngaged(a.EmergencyStop), emergency.WithLogger(log)}
+	if a.EmergencyStopConfigMap.Name != "" {
+		so = append(so, emergency.WithConfigMap(mgr.GetClient(), a.EmergencyStopConfigMap))
+	}
+	stop := emergency.NewSwitch(so...)
+	mo := []maintenance.ModeOption{maintenance.WithEnabled(a.Maintenance), maintenance.WithLogger(log)}
+	if a.MaintenanceConfigMap.Name != "" {
+		mo = append(mo, maintenance.WithConfigMap(mgr.GetClient(), a.MaintenanceConfigMap))
+	}
+	frozen := maintenance.NewMode(mo...)
+	gate := a.initialSyncGate(log)
+	sched := schedule.NewCalendar(schedule.WithJitter(a.RequeueJitter))
+	if err := mgr.AddMetricsExtraHandler("/debug/sync-schedule", sched); err != nil {
+		return errors.Wrap(err, "cannot serve sync schedule")
+	}
+	opts := []xrd.ReconcilerOption{
+		xrd.WithCRDVersion(crdVersion),
+		xrd.WithSyncGate(gate),
+		xrd.WithScheduler(sched),
+		xrd.WithClaimOptions(
+			claim.WithBackoffTracker(backpressure.NewTracker(backpressure.WithLogger(log))),
+			claim.WithEmergencyStop(stop),
+			claim.WithMaintenance(frozen),
+			claim.WithScheduler(sched),
+		),
+	}
+	nso := []namespace.ReconcilerOption{
+		namespace.WithEmergencyStop(stop),
+		namespace.WithMaintenance(frozen),
+		namespace.WithDeletionGracePeriod(a.DeletionGracePeriod),
+	}
+	ro := []claim.DeletionRecovererOption{
+		claim.WithRecoveryEmergencyStop(stop),
+		claim.WithRecoveryMaintenance(frozen),
+		claim.WithRecoveryLogger(log),
+	}
+	if a.SecretConflictPolicy != "" {
+		opts = append(opts, xrd.WithClaimOptions(claim.WithConnectionSecretOptions(claim.WithSecretConflictPolicy(a.SecretConflictPolicy))))
+	}
+	if a.WithoutConnectionSecrets {
+		opts = append(opts, xrd.WithClaimOptions(claim.WithoutConnectionSecrets()))
+	}
+	if a.SecretEncrypter != nil {
+		opts = append(opts, xrd.WithClaimOptions(claim.WithConnectionSecretOptions(claim.WithSecretEncrypter(a.SecretEncrypter))))
+	}
+	if len(a.SecretNamespaces) > 0 {
+		opts = append(opts, xrd.WithClaimOptions(claim.WithConnectionSecretOptions(claim.WithSecretNamespaces(a.SecretNamespaces...))))
+	}
+	if len(a.SecretLabels) > 0 {
+		opts = append(opts, xrd.WithClaimOptions(claim.WithConnectionSecretOptions(claim.WithSecretLabels(a.SecretLabels...))))
+	}
+	if a.SecretCacheTTL > 0 && !a.WithoutConnectionSecrets {
+		w, err := secretcache.NewAPIWatcher(a.ClusterConfig)
+		if err != nil {
+			return errors.Wrap(err, "cannot create remote secret watcher")
+		}
+		c := secretcache.New(clusterRemoteClient, a.SecretCacheTTL, secretcache.WithWatcher(w), secretcache.WithLogger(log))
+		if err := mgr.Add(c); err != nil {
+			return errors.Wrap(err, "cannot add remote secret cache")
+		}
+		clusterRemoteClient = c
+	}
+	if (a.SecretWorkers > 0 || a.SecretRetries) && !a.WithoutConnectionSecrets {
+		wo := []claim.SecretWorkersOption{claim.WithSecretWorkersLogger(log)}
+		if a.SecretWorkers > 0 {
+			wo = append(wo, claim.WithSecretWorkerCount(a.SecretWorkers))
+		}
+		if a.SecretRetryBackoff > 0 {
+			wo = append(wo, claim.WithSecretRetryBackoff(a.SecretRetryBackoff, a.SecretRetryMaxBackoff))
+		}
+		w := claim.NewSecretWorkers(mgr.GetClient(), clusterRemoteClient, wo...)
+		if err := mgr.Add(w); err != nil {
+			return errors.Wrap(err, "cannot add connection secret workers")
+		}
+		if a.SecretWorkers > 0 {
+			opts = append(opts, xrd.WithClaimOptions(claim.WithSecretWorkers(w)))
+		} else {
+			opts = append(opts, xrd.WithClaimOptions(claim.WithSecretRetries(w)))
+		}
+	}
+	if a.PrioritizeChanges {
+		q := claim.NewResyncQueue(claim.WithResyncBacklog(a.ResyncBacklog))
+		if err := mgr.Add(q); err != nil {
+			return errors.Wrap(err, "cannot add resync queue")
+		}
+		opts = append(opts, xrd.WithResyncQueue(q))
+	}
+	if a.Shard != nil {
+		if err := a.registerShard(mgr, log); err != nil {
+			return err
+		}
+		opts = append(opts, xrd.WithShard(a.Shard))
+		nso = append(nso, namespace.WithShard(a.Shard))
+	}
+	if a.DeletionGracePeriod > 0 {
+		opts = append(opts, xrd.WithClaimOptions(claim.WithDeletionGracePeriod(a.DeletionGracePeriod)))
+	}
+	if a.DetectStaleRemotes {
+		opts = append(opts, xrd.WithClaimOptions(claim.WithStaleRemoteDetection()))
+	}
+	if a.StatusConfigMaps {
+		opts = append(opts, xrd.WithClaimOptions(claim.WithStatusProjection(a.SecretNamespaces...)))
+	}
+	if a.ProvisioningSLAs.Default > 0 || len(a.ProvisioningSLAs.Kinds) > 0 {
+		opts = append(opts, xrd.WithClaimOptions(claim.WithProvisioningSLAs(a.ProvisioningSLAs)))
+	}
+	if a.ObserveTeardown {
+		opts = append(opts, xrd.WithClaimOptions(claim.WithTeardownObserver(claim.NewAPITeardownObserver(clusterRemoteClient))))
+	}
+	if a.LogDigestInterval > 0 {
+		d := digest.NewLogger(log, digest.WithInterval(a.LogDigestInterval))
+		if err := mgr.Add(d); err != nil {
+			return errors.Wrap(err, "cannot add digest logger")
+		}
+		opts = append(opts, xrd.WithClaimOptions(claim.WithDigest(d)))
+	}
+	if a.SyncHistorySize > 0 {
+		h := history.NewBuffer(history.WithSize(a.SyncHistorySize))
+		if err := mgr.Add(h); err != nil {
+			return errors.Wrap(err, "cannot add sync history")
+		}
+		if err := mgr.AddMetricsExtraHandler("/debug/sync-history", h); err != nil {
+			return errors.Wrap(err, "cannot serve sync history")
+		}
+		opts = append(opts, xrd.WithClaimOptions(claim.WithHistory(h)))
+	}
+	if a.RemoteSnapshots {
+		s := snapshot.NewStore()
+		if err := mgr.AddMetricsExtraHandler("/debug/remote-claims", s); err != nil {
+			return errors.Wrap(err, "cannot serve remote claim snapshots")
+		}
+		opts = append(opts, xrd.WithClaimOptions(claim.WithRemoteSnapshots(s)))
+	}
+	if len(a.ApprovalKinds) > 0 {
+		// The cache of the manager isn't started yet.
+		kube, err := client.New(mgr.GetConfig(), client.Options{Scheme: mgr.GetScheme()})
+		if err != nil {
+			return errors.Wrap(err, "cannot create claim approval client")
+		}
+		if err := approval.Ensure(context.Background(), crdVersion.Client(kube)); err != nil {
+			return errors.Wrap(err, "cannot ensure the claim approvals")
+		}
+		var so []approval.ServerOption
+		if a.ApprovalTLSCertFile != "" {
+			so = append(so, approval.WithTLS(a.ApprovalTLSCertFile, a.ApprovalTLSKeyFile))
+		}
+		if err := mgr.Add(approval.NewServer(a.ApprovalAddress, approval.NewHandler(mgr.GetClient(), a.ApprovalKinds...), so...)); err != nil {
+			return errors.Wrap(err, "cannot serve claim approvals")
+		}
+		opts = append(opts, xrd.WithClaimOptions(claim.WithApprovalKinds(a.ApprovalKinds...)))
+	}
+	if a.Notifier != nil {
+		// Notifiers like webhooks send the notifications in the background.
+		if r, ok := a.Notifier.(manager.Runnable); ok {
+			if err := mgr.Add(r); err != nil {
+				return errors.Wrap(err, "cannot add notifier")
+			}
+		}
+		opts = append(opts, xrd.WithClaimOptions(claim.WithNotifier(a.Notifier)))
+	}
+	if a.SlowReconcileThreshold > 0 {
+		opts = append(opts, xrd.WithClaimOptions(claim.WithSlowReconcileThreshold(a.SlowReconcileThreshold)))
+	}
+	co := []claim.DefaultConfiguratorOption{
+		claim.WithStampedLabels(a.RemoteClaimLabels),
+		claim.WithStampedAnnotations(a.RemoteClaimAnnotations),
+		claim.WithPreservedAnnotations(a.PreservedAnnotations),
+		claim.WithClusterLabel(a.ClusterName),
+	}
+	opts = append(opts, xrd.WithClaimOptions(claim.WithClusterName(a.ClusterName)))
+	ro = append(ro, claim.WithRecoveryClusterName(a.ClusterName))
+	if a.AttributeRequesters {
+		co = append(co, claim.WithRequesterAttribution())
+	}
+	if a.RemoteNamespace != "" {
+		m := claim.NewNamespaceKeyMapper(a.RemoteNamespace)
+		co = append(co, claim.WithConfiguratorKeyMapper(m))
+		nso = append(nso, namespace.WithRemoteKeyMapper(m))
+		ro = append(ro, claim.WithRecoveryKeyMapper(m))
+		opts = append(opts,
+			xrd.WithClaimOptions(claim.WithRemoteKeyMapper(m)),
+			// The remote claims are of the same types as the local ones, so we
+			// shouldn't treat them as local claims.
+			xrd.WithClaimPredicates(resource.NewNamespaceExclusionFilter(a.RemoteNamespace)),
+		)
+	}
+	opts = append(opts, xrd.WithClaimOptions(claim.WithConfigurator(claim.NewDefaultConfigurator(co...))))
+	if a.MetadataStrategy != "" {
+		e, err := resource.NewMetadataEqualizer(a.MetadataStrategy)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, xrd.WithClaimOptions(claim.WithMetadataEqualizer(a.PreservedAnnotations.Keep(e))))
+	}
+	if a.RemoteServerSideApply {
+		opts = append(opts, xrd.WithClaimOptions(claim.WithServerSideApply("crossplane-agent")))
+	}
+
+	if a.ResolveCompositionSelectors {
+		opts = append(opts, xrd.WithCompositionSelectorResolution())
+	}
+	if a.DefaultCompositions {
+		opts = append(opts, xrd.WithDefaultCompositions())
+	}
+	if a.ClaimTemplatesNamespace != "" {
+		opts = append(opts, xrd.WithClaimTemplates(a.ClaimTemplatesNamespace))
+	}
+	opts = append(opts, xrd.WithCRDConversion(a.CRDConversion))
+	if a.StructuralSchemas {
+		opts = append(opts, xrd.WithStructuralSchemas())
+	}
+	if a.CRDDeletionPolicy != "" {
+		opts = append(opts, xrd.WithCRDDeletionPolicy(a.CRDDeletionPolicy, a.CRDDeletionGracePeriod))
+	}
+	if a.MigrateClaims {
+		m := migration.New(crdVersion.Client(mgr.GetClient()), mgr.GetAPIReader(), migration.WithRules(a.ClaimMigrationRules...), migration.WithLogger(log))
+		opts = append(opts, xrd.WithClaimMigrator(m))
+	}
+	if a.CRDOverrides {
+		// The cache of the manager isn't started yet.
+		kube, err := client.New(mgr.GetConfig(), client.Options{Scheme: mgr.GetScheme()})
+		if err != nil {
+			return errors.Wrap(err, "cannot create CRD override client")
+		}
+		if err := override.Ensure(context.Background(), crdVersion.Client(kube)); err != nil {
+			return errors.Wrap(err, "cannot ensure the CRD overrides")
+		}
+		opts = append(opts, xrd.WithCRDOverrider(xrd.NewAPICRDOverrider(mgr.GetClient())))
+	}
+
+	if a.SkipCRDManagement {
+		if err := xrd.SetupClaims(mgr, clusterRemoteClient, log, a.ClaimKinds, opts...); err != nil {
+			return errors.Wrap(err, "cannot setup claim reconcilers")
+		}
+	} else {
+		// TODO(muvaf): Need to pass in the default config.
+		if err := xrd.Setup(mgr, clusterRemoteClient, log, opts...); err != nil {
+			return errors.Wrap(err, "cannot setup CompositeResourceDefinition reconciler")
+		}
+	}
+
+	// The deletions that were interrupted by the last stop of the agent are
+	// completed right away rather than whenever the claim reconcilers get to them.
+	if err := mgr.Add(claim.NewDeletionRecoverer(mgr.GetClient(), clusterRemoteClient, ro...)); err != nil {
+		return errors.Wrap(err, "cannot add deletion recoverer")
+	}
+
+	if a.NamespaceCleanup {
+		if err := namespace.Setup(mgr, clusterRemoteClient, log, nso...); err != nil {
+			return errors.Wrap(err, "cannot setup namespace cleanup reconciler")
+		}
+	}
+	reqs, err := rbac.For(rbac.ModeLocal, a.RBACOptions()...)
+	if err != nil {
+		return errors.Wrap(err, "cannot derive RBAC requirements")
+	}
+	if err := mgr.AddReadyzCheck("rbac", rbac.SelfCheck(context.Background(), log, mgr.GetClient(), clusterRemoteClient, reqs)); err != nil {
+		return errors.Wrap(err, "cannot add RBAC readiness check")
+	}
+
+	if a.FleetReport.Name != "" {
+		fo := []fleet.ReporterOption{fleet.WithLogger(log), fleet.WithIdentity(a.RemoteIdentity)}
+		if a.FleetReportNamespaces {
+			fo = append(fo, fleet.WithNamespaceBreakdown())
+		}
+		if err := mgr.Add(fleet.NewReporter(mgr.GetClient(), clusterRemoteClient, a.FleetReport, fo...)); err != nil {
+			return errors.Wrap(err, "cannot add fleet reporter")
+		}
+	}
+
+	if err := a.addInitialSyncGate(mgr, gate); err != nil {
+		return err
+	}
+
+	if a.ClusterConfigWatcher != nil {
+		if err := mgr.Add(a.ClusterConfigWatcher); err != nil {
+			return errors.Wrap(err, "cannot add cluster config watcher")
+		}
 	}
 
 	return errors.Wrap(mgr.Start(ctrl.SetupSignalHandler()), "cannot start controller manager")
 }
+
+// RBACOptions returns the options that decide the permissions the agent needs
+// with this configuration. The claim types are not known until their
+// definitions are synced, so they're not included.
+func (a *Agent) RBACOptions() []rbac.Option {
+	opts := []rbac.Option{rbac.WithSecretNamespaces(a.SecretNamespaces...), rbac.WithRemoteNamespace(a.RemoteNamespace)}
+	if a.NamespaceCleanup {
+		opts = append(opts, rbac.WithNamespaceCleanup())
+	}
+	if a.SecretCacheTTL > 0 {
+		opts = append(opts, rbac.WithSecretCache())
+	}
+	if a.MigrateClaims {
+		opts = append(opts, rbac.WithClaimMigration())
+	}
+	if a.WithoutConnectionSecrets {
+		opts = append(opts, rbac.WithoutSecrets())
+	}
+	if a.ShardRegistry.Name != "" {
+		opts = append(opts, rbac.WithShardRegistry(a.ShardRegistry.Namespace))
+	}
+	if a.StatusConfigMaps {
+		opts = append(opts, rbac.WithStatusConfigMaps())
+	}
+	if len(a.ApprovalKinds) > 0 {
+		opts = append(opts, rbac.WithClaimApprovals())
+	}
+	if a.FleetReport.Name != "" {
+		opts = append(opts, rbac.WithFleetReport(a.FleetReport.Namespace))
+	}
+	if a.CRDOverrides {
+		opts = append(opts, rbac.WithCRDOverrides())
+	}
+	return opts
+}
+
+// registerShard registers the shard of the agent before any claim is synced,
+// and keeps it registered while the agent runs.
+func (a *Agent) registerShard(mgr manager.Manager, log logging.Logger) error {
+	// The cache of the manager isn't started yet.
+	kube, err := client.New(mgr.GetConfig(), client.Options{Scheme: mgr.GetScheme()})
+	if err != nil {
+		return errors.Wrap(err, "cannot create shard registry client")
+	}
+	r := shard.NewRegistry(kube, a.ShardRegistry, a.Shard, shard.WithLogger(log))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := r.Register(ctx); err != nil {
+		return errors.Wrap(err, "cannot register shard")
+	}
+	return errors.Wrap(mgr.Add(r), "cannot add shard registry")
+}
+
+// initialSyncGate returns the Gate that tracks the initial sync. It's always
+// tracked so that its progress is logged and served.
+func (a *Agent) initialSyncGate(log logging.Logger) *startup.Gate {
+	opts := []startup.GateOption{startup.WithSignalFile(a.SyncCompleteFile), startup.WithLogger(log)}
+	if a.InitialSyncTimeout > 0 {
+		opts = append(opts, startup.WithTimeout(a.InitialSyncTimeout))
+	}
+	return startup.NewGate(opts...)
+}
+
+func (a *Agent) addInitialSyncGate(mgr manager.Manager, g *startup.Gate) error {
+	if err := mgr.Add(g); err != nil {
+		return errors.Wrap(err, "cannot add initial sync gate")
+	}
+	if err := mgr.AddMetricsExtraHandler("/debug/initial-sync", g); err != nil {
+		return errors.Wrap(err, "cannot serve initial sync progress")
+	}
+	if a.InitialSyncReadiness {
+		return errors.Wrap(mgr.AddReadyzCheck("initial-sync", g.Check), "cannot add initial sync readiness check")
+	}
+	return nil
+}
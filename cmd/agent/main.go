@@ -17,19 +17,53 @@ limitations under the License.
 package main
 
 import (
+	"context"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
+	"text/tabwriter"
 	"time"
 
+	"github.com/pkg/errors"
 	"gopkg.in/alecthomas/kingpin.v2"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/yaml"
 
 	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	capiextensions "github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
 
 	"github.com/crossplane/agent/cmd/agent/local"
 	"github.com/crossplane/agent/cmd/agent/remote"
+	"github.com/crossplane/agent/pkg/backup"
+	"github.com/crossplane/agent/pkg/bootstrap"
+	"github.com/crossplane/agent/pkg/controllers/apiextensions"
+	"github.com/crossplane/agent/pkg/controllers/claim"
+	"github.com/crossplane/agent/pkg/controllers/xrd"
+	"github.com/crossplane/agent/pkg/dedup"
+	"github.com/crossplane/agent/pkg/emergency"
+	"github.com/crossplane/agent/pkg/encryption"
+	"github.com/crossplane/agent/pkg/kubeconfig"
+	"github.com/crossplane/agent/pkg/loadtest"
+	"github.com/crossplane/agent/pkg/maintenance"
+	"github.com/crossplane/agent/pkg/migration"
+	"github.com/crossplane/agent/pkg/netpol"
+	"github.com/crossplane/agent/pkg/notify"
+	"github.com/crossplane/agent/pkg/rbac"
+	"github.com/crossplane/agent/pkg/resource"
+	"github.com/crossplane/agent/pkg/shard"
+	"github.com/crossplane/agent/pkg/transform"
+	"github.com/crossplane/agent/pkg/version"
 )
 
 func main() {
@@ -37,20 +71,217 @@ func main() {
 		app   = kingpin.New(filepath.Base(os.Args[0]), "A syncer between any cluster and Crossplane instance.").DefaultEnvars()
 		debug = app.Flag("debug", "Run with debug logging.").Short('d').Bool()
 	)
+	logDedupWindow := app.Flag("log-dedup-window", "How long the identical error logs of the same object are suppressed for after one of them is logged. The next one after that is logged with the number of the suppressed ones. Disabled if 0.").Default("5m").Duration()
+	csa := app.Flag("cluster-kubeconfig", "File path of the kubeconfig of ServiceAccount to be used to get cluster-scoped resources like CRDs.").Envar("CLUSTER_KUBECONFIG").String()
+	dsa := app.Flag("default-kubeconfig", "File path of the  kubeconfig of ServiceAccount to be used for all namespaces that do not have override annotations.").Envar("DEFAULT_KUBECONFIG").String()
+	remoteSecret := app.Flag("remote-kubeconfig-secret", "The namespace/name[#key] of the Secret in the local cluster that holds the kubeconfig of the remote cluster. It takes precedence over --cluster-kubeconfig and the agent stops when it's rotated so that it's restarted with the new credentials. The key defaults to "+kubeconfig.DefaultKey+".").String()
+	remoteContext := app.Flag("remote-kubeconfig-context", "The context to use from the kubeconfig in --remote-kubeconfig-secret. Defaults to its current context.").String()
+	remoteTokenFile := app.Flag("remote-token-file", "File path of a token, e.g. a projected ServiceAccount token, to authenticate to the remote cluster with instead of the credentials of a kubeconfig. It's read again periodically so that rotated tokens are used. Requires --remote-server.").String()
+	remoteServer := app.Flag("remote-server", "The address of the API server of the remote cluster to use with --remote-token-file.").String()
+	remoteCAFile := app.Flag("remote-ca-file", "File path of the CA bundle of the API server of the remote cluster to use with --remote-token-file. Defaults to the system roots.").String()
+	remoteTokenExchangeURL := app.Flag("remote-token-exchange-url", "The OAuth 2.0 token exchange endpoint of a workload identity federation to exchange --remote-token-file for the token the remote cluster accepts. The token is sent as is if not given.").String()
+	remoteTokenAudience := app.Flag("remote-token-audience", "The audience of the token requested from --remote-token-exchange-url.").String()
+	mode := app.Flag("mode", "The mode of operation to decide whether you would like to run the controllers that watch the local cluster or the remote cluster.").Enum("local", "remote")
+	remoteUserAgent := app.Flag("remote-user-agent", "The User-Agent of the requests to the remote cluster, e.g. to match them in the FlowSchemas of the remote cluster.").Default(version.UserAgent()).String()
+	remoteIdentity := app.Flag("remote-identity", "The user to impersonate in the remote cluster so that API Priority and Fairness rules can be applied per agent. Requires the impersonate permission in the remote cluster.").String()
+	remoteIdentityGroups := app.Flag("remote-identity-group", "A group to impersonate along with --remote-identity. Can be repeated.").Strings()
+	remoteTunnel := app.Flag("remote-tunnel", "The http or https URL of an HTTP CONNECT tunnel endpoint, e.g. a konnectivity server or a tunnel broker, that the connections to the API server of the remote cluster are made through when it isn't directly reachable.").String()
+	remoteTunnelCAFile := app.Flag("remote-tunnel-ca-file", "File path of the CA bundle of --remote-tunnel. Defaults to the system roots.").String()
+	remoteTunnelCertFile := app.Flag("remote-tunnel-cert-file", "File path of the client certificate to authenticate to --remote-tunnel with.").String()
+	remoteTunnelKeyFile := app.Flag("remote-tunnel-key-file", "File path of the key of --remote-tunnel-cert-file.").String()
+	remoteHeaders := app.Flag("remote-header", "A key=value HTTP header to send with the requests to the remote cluster, e.g. X-Cluster-ID=eu-1 to attribute them to this cluster in audit logs. Can be repeated.").StringMap()
+	remoteMaxIdleConns := app.Flag("remote-max-idle-conns", "How many idle connections to the API server of the remote cluster are kept open for reuse by the clients of the agent, which share them.").Default("25").Int()
+	remoteMaxConns := app.Flag("remote-max-conns", "How many connections to the API server of the remote cluster may be open at most. There's no limit if it's 0.").Default("0").Int()
+	remoteIdleConnTimeout := app.Flag("remote-idle-conn-timeout", "How long an idle connection to the API server of the remote cluster is kept open.").Default("90s").Duration()
+	inCluster := app.Flag("remote-in-cluster", "Use the cluster the agent runs in as the remote cluster, mostly for testing and single-cluster setups. Only valid in local mode.").Bool()
 	// TODO(muvaf): Add flag for ctrl runtime sync duration.
 	s := app.Command("sync", "Start syncing to Crossplane.").Default()
-	csa := s.Flag("cluster-kubeconfig", "File path of the kubeconfig of ServiceAccount to be used to get cluster-scoped resources like CRDs.").Envar("CLUSTER_KUBECONFIG").String()
-	dsa := s.Flag("default-kubeconfig", "File path of the  kubeconfig of ServiceAccount to be used for all namespaces that do not have override annotations.").Envar("DEFAULT_KUBECONFIG").String()
-	mode := s.Flag("mode", "The mode of operation to decide whether you would like to run the controllers that watch the local cluster or the remote cluster.").Enum("local", "remote")
+	remoteNamespace := s.Flag("remote-namespace", "The namespace in the remote cluster that all claims are created in. Claims are created in the namespaces of the local claims if not given, or in crossplane-agent-remote with --remote-in-cluster.").String()
+	emergencyStop := s.Flag("emergency-stop", "Halt all writes to the remote cluster while still propagating the status of existing claims.").Bool()
+	maintenanceMode := s.Flag("maintenance", "Don't create, update or delete remote claims while the local cluster is under maintenance, e.g. while node pools are rebuilt, so that claims that are deleted only to be recreated don't deprovision their infrastructure. The deleted claims are let go and the status of the remote claims keeps being synced. Only valid in local mode.").Bool()
+	maintenanceConfigMap := s.Flag("maintenance-configmap", "The namespace/name of the ConfigMap that keeps remote claims from being created, updated or deleted while it's annotated with "+maintenance.AnnotationKeyMaintenance+": \"true\". Only valid in local mode.").String()
+	emergencyStopConfigMap := s.Flag("emergency-stop-configmap", "The namespace/name of the ConfigMap that halts all writes to the remote cluster while it's annotated with "+emergency.AnnotationKeyEmergencyStop+": \"true\".").String()
+	syncCompleteFile := s.Flag("sync-complete-file", "A file to write once the initial sync is complete, i.e. the definitions, CRDs and compositions in remote mode or the claim CRDs in local mode that existed at startup are available in the local cluster, e.g. for bootstrap pipelines to wait for.").String()
+	waitForInitialSync := s.Flag("wait-for-initial-sync", "Report the agent as not ready until the initial sync is complete.").Bool()
+	initialSyncTimeout := s.Flag("initial-sync-timeout", "How long to wait for the initial sync to be complete at most. The agent is reported as ready once it passes, but the sync complete file isn't written.").Default("10m").Duration()
+	syncEnvironmentConfigs := s.Flag("sync-environment-configs", "Sync the EnvironmentConfigs of the remote cluster to the local cluster, read-only, so that claim authors can look up the environment data. Requires a remote Crossplane version that has the EnvironmentConfig type. Only valid in remote mode.").Bool()
+	syncClusterTypes := s.Flag("sync-cluster-type", "A cluster-scoped type of the remote cluster in resource.version.group format whose objects are synced to the local cluster, read-only, e.g. "+apiextensions.EnvironmentConfigType+". Can be repeated. Only valid in remote mode.").Strings()
+	maxDeletionsPerSync := s.Flag("max-deletions-per-sync", "The maximum number of synced objects that are deleted from the local cluster every 30 seconds across all synced types once they're gone from the remote cluster. Unlimited if 0. Only valid in remote mode.").Default("10").Int()
+	maxDeletionPercentage := s.Flag("max-deletion-percentage", "The share of the synced objects of a type, in percent, that may be gone from the remote cluster at once before none of them are deleted from the local cluster until the local CRD is annotated with "+resource.AnnotationKeyAllowMassRemoval+": \"true\". Unlimited if 0. Only valid in remote mode.").Default("50").Int()
+	remoteClusterName := s.Flag("remote-cluster-name", "The name of the remote cluster that the synced objects are annotated with in the local cluster. Defaults to the address of its API server. Only valid in remote mode.").String()
+	transformationRulesFile := s.Flag("transformation-rules-file", "File path of a YAML file of rules that transform the objects synced from the remote cluster with JSON patches before they're applied to this cluster, e.g. to replace the region defaults of Compositions. The rules are validated at startup. Only valid in remote mode.").ExistingFile()
+	syncStoreConfigs := s.Flag("sync-store-configs", "Sync the secret StoreConfigs of the remote cluster to the local cluster. Requires a remote Crossplane version that has the StoreConfig type. Only valid in remote mode.").Bool()
+	compositionRolloutRate := s.Flag("composition-rollout-rate", "The maximum number of Compositions that are updated in the local cluster per minute, so that a batch of Compositions updated at once in the remote cluster is rolled out gradually. The updates that wait for their turn are counted in the crossplane_agent_queued_updates metric. New Compositions are created right away. Unlimited if 0. Only valid in remote mode.").Int()
+	syncedBundle := s.Flag("synced-bundle", "The name of a SyncedBundle that owns the objects synced from the remote cluster in the local cluster, created if it doesn't exist, so that deleting it deletes all of them. The CRDs aren't owned by it. Only valid in remote mode.").String()
+	remoteClaimLabels := s.Flag("remote-claim-label", "A key=value label to add to all claims created in the remote cluster, e.g. to identify the team, environment or priority of this cluster. Can be repeated.").StringMap()
+	syncClusterName := s.Flag("cluster-name", "The name that identifies this cluster in the remote cluster, as given to agent init. All claims created in the remote cluster are labelled with "+resource.LabelKeyCluster+" set to it, so that agent deregister finds them wherever they are. Only valid in local mode.").String()
+	remoteClaimAnnotations := s.Flag("remote-claim-annotation", "A key=value annotation to add to all claims created in the remote cluster. Can be repeated.").StringMap()
+	attributeRequesters := s.Flag("attribute-requesters", "Annotate the claims created in the remote cluster with "+resource.AnnotationKeyRequestedBy+" set to who requested their local claims, i.e. the field manager that set the spec of the local claim first. Only valid in local mode.").Bool()
+	preservedAnnotations := s.Flag("preserved-annotation", "An annotation key, or a key prefix ending with a slash, that belongs to the cluster it's set in and isn't overridden by or propagated to the other cluster, e.g. the ones GitOps tools manage. Can be repeated. Defaults to the annotations of kubectl, Argo CD, Flux and Helm.").Default(resource.DefaultPreservedAnnotations...).Strings()
+	conflictStrategy := s.Flag("conflict-strategy", "What is done when both a synced object in the local cluster and its remote counterpart changed since the last sync, e.g. after the local cluster is restored from a backup. RemoteWins overwrites the local object, LocalWins keeps it and Manual keeps it and marks it with the agent.crossplane.io/sync-conflict annotation. Only valid in remote mode.").Default(string(apiextensions.ConflictStrategyRemoteWins)).Enum(string(apiextensions.ConflictStrategyRemoteWins), string(apiextensions.ConflictStrategyLocalWins), string(apiextensions.ConflictStrategyManual))
+	metadataStrategy := s.Flag("metadata-strategy", "How the labels and annotations of an object written to a cluster are equalized with the ones of its counterpart in the other cluster when it already exists there. StrictMirror removes the ones only it has, PreserveLocal keeps the values it has and Merge overrides the ones with the same keys and keeps the rest. Defaults to Merge. The preserved annotations are kept in all cases.").Enum(string(resource.MetadataStrategyStrictMirror), string(resource.MetadataStrategyPreserveLocal), string(resource.MetadataStrategyMerge))
+	remoteSSA := s.Flag("remote-server-side-apply", "Apply the claims in the remote cluster with server-side apply, so that the fields removed from the local claims are removed from the remote ones and the fields that other field managers own are reported in the "+string(resource.TypeFieldConflict)+" condition of the local claims rather than overwritten. Overrides --metadata-strategy. Only valid in local mode.").Bool()
+	withoutSecrets := s.Flag("without-connection-secrets", "Never copy the connection secrets of the remote claims to this cluster. The claims are marked with the location of their connection secrets in the remote cluster instead. Only valid in local mode.").Bool()
+	secretConflictPolicy := s.Flag("secret-conflict-policy", "What to do when the local connection secret of a claim exists but isn't owned by the claim. Fail leaves it untouched, Adopt makes the claim its owner and Overwrite writes to it without changing its owners.").Default(string(claim.SecretConflictPolicyFail)).Enum(string(claim.SecretConflictPolicyFail), string(claim.SecretConflictPolicyAdopt), string(claim.SecretConflictPolicyOverwrite))
+	secretWorkers := s.Flag("connection-secret-workers", "Propagate the connection secrets of claims with this many workers in the background instead of during the sync of the claims, so that slow or failing secret reads don't delay the status of the claims. The outcome is reported in the "+string(resource.TypeConnectionSecretSynced)+" condition of the claims. Disabled if 0. Only valid in local mode.").Int()
+	secretRetries := s.Flag("connection-secret-retries", "Retry the connection secrets that fail to be copied while their claims are synced separately, with their own backoff, instead of failing the sync of the claims, so that the status and spec of the claims stay fresh. The outcome is reported in the "+string(resource.TypeConnectionSecretSynced)+" condition of the claims. Implied by --connection-secret-workers. Only valid in local mode.").Bool()
+	secretRetryBackoff := s.Flag("connection-secret-retry-backoff", "How long to wait before a connection secret that failed to be copied is retried for the first time. The wait doubles with every failure. The default rate limiter of the controllers is used if not given.").Duration()
+	secretRetryMaxBackoff := s.Flag("connection-secret-retry-max-backoff", "The longest wait before a connection secret that failed to be copied is retried. Only used with --connection-secret-retry-backoff.").Default("5m").Duration()
+	secretCacheTTL := s.Flag("connection-secret-cache-ttl", "Cache the secrets read from the remote cluster for this long, e.g. 1m, so that the connection secrets that many claims share aren't read again with every sync. The cached secrets are also read again as soon as they change if the agent can watch them. The reads are counted in the crossplane_agent_remote_secret_reads_total metric by their source. Disabled if not given. Only valid in local mode.").Duration()
+	secretEncryptionKeyFile := s.Flag("connection-secret-encryption-key-file", "File path of a base64 encoded 32 byte key to encrypt the values of the connection secrets with before they're written to this cluster, for clusters whose etcd encryption isn't trusted. The secrets have to be decrypted by a companion decryptor before applications can use them. Only valid in local mode.").ExistingFile()
+	secretNamespaces := s.Flag("connection-secret-namespace", "A namespace that the claims may have their connection secrets written to with the "+resource.AnnotationKeyConnectionSecretNamespace+" annotation instead of their own namespace, e.g. a shared secrets namespace. Can be repeated. Only valid in local mode.").Strings()
+	secretLabels := s.Flag("connection-secret-label", "A label of the claims to copy to their connection secrets, e.g. app.kubernetes.io/name, so that applications and policy engines can select the secrets by it. Labels that end with a slash match all the keys with that prefix, e.g. team.example.org/. Can be repeated. Only valid in local mode.").Strings()
+	namespaceCleanup := s.Flag("namespace-cleanup", "Hold deleted namespaces with a finalizer until the remote counterparts of their claims are deleted, which are deleted in a batch instead of one claim at a time. Only valid in local mode.").Bool()
+	deletionGracePeriod := s.Flag("deletion-grace-period", "How long to wait after a local claim is deleted before deleting the remote claim, e.g. 5m. The deletion can be cancelled in the meantime by annotating the local claim with "+resource.AnnotationKeyCancelDeletion+": \"true\".").Duration()
+	detectStaleRemotes := s.Flag("detect-stale-remotes", "Record which generation of a claim was last written to which remote claim and stop syncing the claims whose remote claims turn out to be older, e.g. because the remote cluster was restored from a backup, rather than overwriting either of them. Such claims get the "+string(resource.ReasonResyncRequired)+" reason in their "+string(resource.TypeAgentSync)+" condition. Only valid in local mode.").Bool()
+	provisioningSLAs := s.Flag("provisioning-sla", "How long the claims may take to become ready after they're created, in [Kind,...=]duration format, e.g. Database,Bucket=15m. The claims that take longer get an "+string(resource.TypeSLAExceeded)+" condition and an event, and are counted in the crossplane_agent_claim_sla_exceeded_total metric. The one without kinds applies to all other kinds. Can be repeated. Only valid in local mode.").Strings()
+	statusConfigMaps := s.Flag("status-configmaps", "Project the status fields of the claims listed in their "+resource.AnnotationKeyStatusConfigMap+" annotation, e.g. endpoint,port,version, into a ConfigMap next to their connection secrets for the applications that cannot read claims. Only valid in local mode.").Bool()
+	remoteSnapshots := s.Flag("remote-claim-snapshots", "Keep a summary of the last observed state of every remote claim in memory, so that the mismatches between the local and the remote claims can be narrowed down without access to the remote cluster. They're listed with their resource version and the SHA-256 sum of their YAML as JSON at /debug/remote-claims of the metrics endpoint, which takes kind, namespace and name query parameters. Only valid in local mode.").Bool()
+	approvalKinds := s.Flag("approval-required-kind", "A kind of claims that are held in the local cluster with a PendingApproval condition until their current generation is approved with a cluster scoped ClaimApproval, which is created either with kubectl or with a POST request to /approve of --approval-address that takes apiVersion, kind, namespace and name query parameters and the bearer token of the approver. Can be repeated. Only valid in local mode.").Strings()
+	approvalAddress := s.Flag("approval-address", "The address that /approve is served at if --approval-required-kind is given. Only valid in local mode.").Default(":8443").String()
+	approvalTLSCert := s.Flag("approval-tls-cert-file", "The TLS certificate file that /approve is served with, so that the bearer tokens of the approvers aren't sent in plain text. Only valid in local mode.").String()
+	approvalTLSKey := s.Flag("approval-tls-key-file", "The TLS key file of --approval-tls-cert-file. Only valid in local mode.").String()
+	syncHistorySize := s.Flag("sync-history-size", "Keep this many of the last syncs of every claim in memory, with their action, outcome and error, to debug intermittent failures after the fact. They're served as JSON at /debug/sync-history of the metrics endpoint, which takes kind, namespace and name query parameters, and dumped to stderr when the agent receives SIGUSR1, except on Windows. Disabled if 0. Only valid in local mode.").Int()
+	logDigestInterval := s.Flag("log-digest-interval", "Log a summary of the synced, created, updated and deleted claims and the errors per kind at info level at this interval, e.g. 10m. Disabled if not given. Only valid in local mode.").Duration()
+	notificationWebhooks := s.Flag("notification-webhook", "A webhook in [Kind,...=]URL format that JSON notifications are posted to when claims are created in the remote cluster, become ready, start failing and are deleted, e.g. Database,Bucket=https://hooks.example.org/agent. It's notified about all kinds if none are given. Can be repeated. Only valid in local mode.").Strings()
+	slackWebhooks := s.Flag("notification-slack-webhook", "Like --notification-webhook, but the notifications are posted as Slack messages, e.g. to a Slack incoming webhook. Can be repeated. Only valid in local mode.").Strings()
+	requeueJitter := s.Flag("requeue-jitter", "The share of the requeue intervals of the synced objects that is randomly added to or subtracted from them, so that the objects that are synced together don't keep being requeued together. The upcoming syncs are served as JSON at /debug/sync-schedule of the metrics endpoint, which takes controller, namespace, name and limit query parameters.").Default("0.1").Float64()
+	prioritizeChanges := s.Flag("prioritize-changed-claims", "Sync the claims that are new or changed before the routine resyncs of the claims that are doing fine, so that new claims don't wait behind a resync storm. Only valid in local mode.").Bool()
+	resyncBacklog := s.Flag("resync-backlog", "How many claims the queue of a claim controller may hold for a routine resync to be added to it with --prioritize-changed-claims.").Default("5").Int()
+	shardName := s.Flag("shard-name", "The name of the shard of the claims that this agent syncs when they're split between several agent deployments, e.g. the name of the deployment. Required with --shard-count, --shard-selector or --shard-kind. Only valid in local mode.").String()
+	shardCount := s.Flag("shard-count", "How many shards the claims are split into by the hash of their namespace and name.").Int()
+	shardIndex := s.Flag("shard-index", "The index of the shard of this agent among --shard-count shards, starting with 0.").Int()
+	shardSelector := s.Flag("shard-selector", "The label selector of the claims of the shard of this agent, e.g. tier=gold.").String()
+	shardKinds := s.Flag("shard-kind", "A claim kind of the shard of this agent in kind.group format, e.g. PostgreSQLInstance.database.example.org. Can be repeated.").Strings()
+	shardRegistry := s.Flag("shard-registry", "The namespace/name of the ConfigMap in this cluster that the shards of the agent deployments are registered in. A shard that overlaps one that was registered before it is refused.").Default("crossplane-system/agent-shards").String()
+	slowReconcileThreshold := s.Flag("slow-reconcile-threshold", "How long the sync of a claim may take before it's logged at info level along with how long each of its phases took. Defaults to 30s. Only valid in local mode.").Duration()
+	observeTeardown := s.Flag("observe-teardown", "Report how many of the composed resources of a remote claim that is being deleted are left in the Ready condition of the local claim. Requires read access to the composite and composed resources in the remote cluster. Only valid in local mode.").Bool()
+	crdConversion := s.Flag("crd-conversion", "How the claim CRDs whose versions are converted by a webhook in the remote cluster are rendered in this cluster, where the webhook isn't reachable. None renders them with only their storage version and without conversion, Webhook rewires the conversion to the service given with --crd-conversion-service, e.g. a conversion service deployed alongside the agent. Only valid in local mode.").Default(string(resource.ConversionStrategyNone)).Enum(string(resource.ConversionStrategyNone), string(resource.ConversionStrategyWebhook))
+	crdConversionService := s.Flag("crd-conversion-service", "The namespace/name of the local conversion service that the claim CRDs are rewired to with --crd-conversion Webhook.").String()
+	crdConversionPath := s.Flag("crd-conversion-path", "The URL path of the local conversion service, if any.").String()
+	crdConversionPort := s.Flag("crd-conversion-port", "The port of the local conversion service. Defaults to 443.").Int32()
+	crdConversionCAFile := s.Flag("crd-conversion-ca-file", "File path of the CA bundle that the certificate of the local conversion service is signed by.").ExistingFile()
+	structuralSchemas := s.Flag("crd-structural-schemas", "Render the claim CRDs with structural schemas whose unknown fields are pruned, for clusters that admit only CRDs with structural schemas. The fields that the schemas of the remote cluster preserve are kept. Only valid in local mode.").Bool()
+	migrateClaims := s.Flag("migrate-claims", "Migrate the local claims that are stored at old versions of their type to its storage version, e.g. once the type is bumped in the remote cluster, so that the old versions can be dropped from the claim CRDs. The old versions are served until then. Only valid in local mode.").Bool()
+	claimMigrationRulesFile := s.Flag("claim-migration-rules-file", "File path of a YAML file of rules that map the fields of the claims stored at an old version to the ones of the storage version while they're migrated. Implies --migrate-claims. The rules are validated at startup. Only valid in local mode.").ExistingFile()
+	crdOverrides := s.Flag("crd-overrides", "Merge the CRDOverrides in the local cluster, which are named after claim CRDs and hold partial CRDs, over the CRDs synced from the remote cluster, e.g. to add short names or categories. Only valid in local mode.").Bool()
+	fleetReportNamespaces := s.Flag("fleet-report-namespaces", "Break the claim counts of the fleet report down by namespace, with how many claims of every kind are ready and failed to sync, for chargeback per tenant. They're exposed as the crossplane_agent_claims metric as well. Requires --fleet-report. Only valid in local mode.").Bool()
+	fleetReport := s.Flag("fleet-report", "The namespace/name of a SyncStatus in the remote cluster that a summary of the syncs of this agent is periodically written to, for fleet dashboards. Only valid in local mode.").String()
+	crdDeletionPolicy := s.Flag("crd-deletion-policy", "What happens to the claims of a claim CRD when its CompositeResourceDefinition is deleted, e.g. because the remote cluster withdrew it. Block keeps the CRD until the claims are deleted by their owners, Cascade deletes the claims once --crd-deletion-grace-period passes and then the CRD, and Orphan leaves the CRD and the claims in place, unsynced and without the finalizer of the agent. Only valid in local mode.").Default(string(xrd.CRDDeletionPolicyBlock)).Enum(string(xrd.CRDDeletionPolicyCascade), string(xrd.CRDDeletionPolicyBlock), string(xrd.CRDDeletionPolicyOrphan))
+	crdDeletionGracePeriod := s.Flag("crd-deletion-grace-period", "How long after the deletion of a CompositeResourceDefinition its claims are deleted with the Cascade deletion policy. Only valid in local mode.").Default("0s").Duration()
+	skipCRDManagement := s.Flag("skip-crd-management", "Don't sync the CompositeResourceDefinitions and the claim CRDs, e.g. because the CRDs are managed by a GitOps tool, and sync only the claims of the kinds given with --claim-kind and their connection secrets. The CRDs have to exist before the agent starts. Only valid in local mode.").Bool()
+	claimKinds := s.Flag("claim-kind", "A kind whose claims are synced with --skip-crd-management, in Kind.version.group format, e.g. PostgreSQLInstance.v1alpha1.database.example.org. Can be repeated.").Strings()
+	claimTemplatesNamespace := s.Flag("claim-templates-namespace", "The namespace of the ConfigMaps in the local cluster that claims can name in their "+resource.AnnotationKeyClaimTemplate+" annotation to have their spec filled in from the "+resource.ClaimTemplateKey+" key of the ConfigMap. Only valid in local mode.").String()
+	resolveSelectors := s.Flag("resolve-composition-selectors", "Resolve the composition selectors of claims to composition references using the Compositions in the local cluster before forwarding them.").Bool()
+	defaultCompositions := s.Flag("default-compositions", "Set the composition reference of the claims that neither reference nor select a Composition to the default Composition of their CompositeResourceDefinition before forwarding them, so that new claims pick up the changes of the default in the remote cluster. The default is recorded in the "+resource.AnnotationKeyDefaultComposition+" annotation of the claim CRDs. Only valid in local mode.").Bool()
 
-	kingpin.MustParse(app.Parse(os.Args[1:]))
+	c := app.Command("check", "Check whether the agent has the permissions it needs in both clusters for the given mode and exit.")
+	cRBACOptions := rbacFlags(c)
+
+	rb := app.Command("rbac", "Print the ClusterRoles and Roles that grant the permissions the agent needs in this cluster and the remote cluster for the given mode.")
+	rbName := rb.Flag("name", "The name of the ClusterRoles and Roles.").Default("crossplane-agent").String()
+	rbRBACOptions := rbacFlags(rb)
+
+	i := app.Command("init", "Register this cluster with the remote cluster and print the Secret that holds the kubeconfig the agent should use.")
+	adminKubeconfig := i.Flag("remote-admin-kubeconfig", "File path of the kubeconfig of an admin of the remote cluster.").Required().String()
+	clusterName := i.Flag("cluster-name", "The name that identifies this cluster in the remote cluster.").Required().String()
+	initNamespace := i.Flag("namespace", "The namespace in the remote cluster that the claims of this cluster are created in. Defaults to crossplane-agent-<cluster-name>.").String()
+	kubeconfigSecret := i.Flag("kubeconfig-secret", "The namespace/name of the Secret in this cluster that the kubeconfig is written to.").Default(bootstrap.DefaultKubeconfigSecret.String()).String()
+
+	d := app.Command("deregister", "Release the claims of a cluster whose agent is uninstalled by removing the finalizers and annotations of the agent from them in the remote cluster.")
+	deregisterKubeconfig := d.Flag("remote-admin-kubeconfig", "File path of the kubeconfig of an admin of the remote cluster.").Required().String()
+	deregisterCluster := d.Flag("cluster-name", "The name that identifies the cluster in the remote cluster.").Required().String()
+	deregisterNamespace := d.Flag("namespace", "The namespace in the remote cluster that the claims of the cluster are created in. Defaults to crossplane-agent-<cluster-name>.").String()
+	deleteClaims := d.Flag("delete-claims", "Delete the claims of the cluster in the remote cluster once they're released.").Bool()
+
+	im := app.Command("import", "Create a local claim for an existing claim in the remote cluster so that the agent takes it over, e.g. to migrate workloads from the central cluster to this cluster.")
+	imKind := im.Arg("kind", "The kind of the claim in Kind.version.group format, e.g. PostgreSQLInstance.v1alpha1.database.example.org.").Required().String()
+	imClaim := im.Arg("claim", "The namespace/name of the claim in the remote cluster.").Required().String()
+	imRemoteNamespace := im.Flag("remote-namespace", "The --remote-namespace of the agent, if any. The remote claim has to be named <namespace>.<name> of the local claim in that case.").String()
+	imNamespace := im.Flag("namespace", "The namespace of the local claim. Required with --remote-namespace, defaults to the namespace of the remote claim otherwise.").String()
+
+	ex := app.Command("export", "Write the definitions, compositions and claims in this cluster, along with the remote counterparts of the claims, to a gzipped tarball of YAML files, e.g. for disaster recovery or to move the agent to a replacement cluster.")
+	exOutput := ex.Flag("output", "File path of the tarball to write.").Short('o').Required().String()
+	exRemoteNamespace := ex.Flag("remote-namespace", "The --remote-namespace of the agent, if any, to record the remote counterparts of the claims with.").String()
+
+	np := app.Command("netpol", "Print a NetworkPolicy that allows the agent to send traffic only to the API servers of this cluster and the remote cluster, for clusters that deny egress by default. The host names of the servers are resolved when it's generated, so it has to be generated again when their addresses change.")
+	npName := np.Flag("name", "The name of the NetworkPolicy.").Default(netpol.DefaultName).String()
+	npNamespace := np.Flag("namespace", "The namespace the agent runs in.").Default("crossplane-system").String()
+	npPodLabels := np.Flag("pod-label", "A key=value label of the pods of the agent. Can be repeated.").Default("app=crossplane-agent").StringMap()
+	npEndpoints := np.Flag("endpoint", "The address of another server the agent has to reach, e.g. a notification webhook or the token exchange endpoint. Can be repeated.").Strings()
+	npDNS := np.Flag("allow-dns", "Allow the agent to reach DNS servers, which it needs when the addresses of the servers are host names.").Default("true").Bool()
+
+	lt := app.Command("loadtest", "Create synthetic claims in this cluster and measure how long it takes for the running agent to sync them.")
+	ltAPIVersion := lt.Flag("claim-api-version", "The apiVersion of the claims to create, e.g. example.org/v1alpha1.").Required().String()
+	ltKind := lt.Flag("claim-kind", "The kind of the claims to create.").Required().String()
+	ltSpecFile := lt.Flag("spec-file", "File path of a YAML file that holds the spec of the claims to create.").ExistingFile()
+	ltNamespace := lt.Flag("namespace", "The namespace to create the claims in.").Default("default").String()
+	ltCount := lt.Flag("count", "The number of claims to create.").Default("100").Int()
+	ltConcurrency := lt.Flag("concurrency", "The number of claims to create at the same time. Must be at least 1.").Default("10").Int()
+	ltTimeout := lt.Flag("timeout", "How long to wait for all claims to be synced.").Default("10m").Duration()
+	ltPollInterval := lt.Flag("poll-interval", "How often to check whether the claims are synced. It's the resolution of the measured latencies.").Default("500ms").Duration()
+	ltCleanup := lt.Flag("cleanup", "Delete the created claims once the test is done.").Default("true").Bool()
+
+	cmd := kingpin.MustParse(app.Parse(os.Args[1:]))
 	zl := zap.New(zap.UseDevMode(*debug))
+	if *logDedupWindow > 0 {
+		// The sync ID differs on every sync, so it doesn't make the errors of
+		// an object different.
+		zl = dedup.New(zl, dedup.NewFilter(dedup.WithWindow(*logDedupWindow), dedup.WithIgnoredKeys("sync-id")))
+	}
 	if *debug {
 		// The controller-runtime runs with a no-op logger by default. It is
 		// *very* verbose even at info level, so we only provide it a real
 		// logger when we're running in debug mode.
 		ctrl.SetLogger(zl)
 	}
+	log := logging.NewLogrLogger(zl.WithName("crossplane-agent"))
+	if cmd == i.FullCommand() {
+		nn, err := parseNamespacedName(*kubeconfigSecret)
+		if err != nil {
+			kingpin.FatalUsage("--kubeconfig-secret %s", err)
+		}
+		kingpin.FatalIfError(register(*adminKubeconfig, *clusterName, *initNamespace, nn), "cannot register cluster")
+		return
+	}
+	if cmd == d.FullCommand() {
+		kingpin.FatalIfError(deregister(*deregisterKubeconfig, *deregisterCluster, *deregisterNamespace, *deleteClaims), "cannot deregister cluster")
+		return
+	}
+	if cmd == ex.FullCommand() {
+		kingpin.FatalIfError(export(*exOutput, backup.WithExportRemoteNamespace(*exRemoteNamespace)), "cannot export")
+		return
+	}
+	if cmd == rb.FullCommand() {
+		kingpin.FatalIfError(printRoles(*rbName, rbac.Mode(*mode), rbRBACOptions(rbac.Mode(*mode))...), "cannot print RBAC roles")
+		return
+	}
+	if cmd == lt.FullCommand() {
+		gv, err := schema.ParseGroupVersion(*ltAPIVersion)
+		if err != nil {
+			kingpin.FatalUsage("--claim-api-version %s", err)
+		}
+		if *ltConcurrency < 1 {
+			kingpin.FatalUsage("--concurrency must be at least 1")
+		}
+		opts := []loadtest.Option{
+			loadtest.WithNamespace(*ltNamespace),
+			loadtest.WithCount(*ltCount),
+			loadtest.WithConcurrency(*ltConcurrency),
+			loadtest.WithTimeout(*ltTimeout),
+			loadtest.WithPollInterval(*ltPollInterval),
+			loadtest.WithLogger(log),
+		}
+		if *ltSpecFile != "" {
+			spec := map[string]interface{}{}
+			raw, err := ioutil.ReadFile(*ltSpecFile)
+			kingpin.FatalIfError(err, "cannot read spec file")
+			kingpin.FatalIfError(yaml.Unmarshal(raw, &spec), "cannot parse spec file")
+			opts = append(opts, loadtest.WithSpec(spec))
+		}
+		kingpin.FatalIfError(loadTest(gv.WithKind(*ltKind), *ltCleanup, opts...), "load test failed")
+		return
+	}
 	defaultConfig, err := clientcmd.BuildConfigFromFlags("", *dsa)
 	if err != nil {
 		kingpin.FatalUsage("could not parse default kubeconfig %s", *dsa)
@@ -59,18 +290,572 @@ func main() {
 	if err != nil {
 		kingpin.FatalUsage("could not parse cluster kubeconfig %s", *csa)
 	}
+	if *inCluster {
+		if *mode == "remote" {
+			kingpin.FatalUsage("--remote-in-cluster cannot be used in remote mode")
+		}
+		clusterConfig = ctrl.GetConfigOrDie()
+	}
+	var watcher manager.Runnable
+	if *remoteSecret != "" {
+		if *inCluster {
+			kingpin.FatalUsage("--remote-kubeconfig-secret cannot be used with --remote-in-cluster")
+		}
+		ref, err := kubeconfig.ParseSecretRef(*remoteSecret)
+		if err != nil {
+			kingpin.FatalUsage("%s", err)
+		}
+		kube, err := client.New(ctrl.GetConfigOrDie(), client.Options{})
+		kingpin.FatalIfError(err, "cannot create local client")
+		cfg, raw, err := kubeconfig.FromSecret(context.Background(), kube, ref, *remoteContext)
+		kingpin.FatalIfError(err, "cannot load remote kubeconfig from secret %s", *remoteSecret)
+		clusterConfig = cfg
+		watcher = kubeconfig.NewRotationWatcher(kube, ref, raw, kubeconfig.WithLogger(log))
+	}
+	if *remoteTokenFile != "" {
+		if *inCluster || *remoteSecret != "" {
+			kingpin.FatalUsage("--remote-token-file cannot be used with --remote-in-cluster or --remote-kubeconfig-secret")
+		}
+		if *remoteServer == "" {
+			kingpin.FatalUsage("--remote-token-file requires --remote-server")
+		}
+		w := kubeconfig.WorkloadIdentity{
+			Server:      *remoteServer,
+			CAFile:      *remoteCAFile,
+			TokenFile:   *remoteTokenFile,
+			ExchangeURL: *remoteTokenExchangeURL,
+			Audience:    *remoteTokenAudience,
+		}
+		clusterConfig = w.Config()
+	}
+	if *remoteIdentity == "" && len(*remoteIdentityGroups) > 0 {
+		kingpin.FatalUsage("--remote-identity-group cannot be used without --remote-identity")
+	}
+	if *requeueJitter < 0 || *requeueJitter >= 1 {
+		kingpin.FatalUsage("--requeue-jitter must be at least 0 and less than 1")
+	}
+	if *resyncBacklog < 1 {
+		kingpin.FatalUsage("--resync-backlog must be at least 1")
+	}
+	if *remoteTunnel != "" {
+		t := kubeconfig.Tunnel{URL: *remoteTunnel, CAFile: *remoteTunnelCAFile, CertFile: *remoteTunnelCertFile, KeyFile: *remoteTunnelKeyFile}
+		clusterConfig, err = t.Configure(clusterConfig)
+		if err != nil {
+			kingpin.FatalUsage("%s", err)
+		}
+	}
+	id := kubeconfig.Identity{UserAgent: *remoteUserAgent, User: *remoteIdentity, Groups: *remoteIdentityGroups, Headers: *remoteHeaders}
+	clusterConfig = id.Configure(clusterConfig)
+	pool := kubeconfig.Pool{MaxIdleConnsPerHost: *remoteMaxIdleConns, MaxConnsPerHost: *remoteMaxConns, IdleConnTimeout: *remoteIdleConnTimeout}
+	clusterConfig, err = pool.Configure(clusterConfig)
+	kingpin.FatalIfError(err, "cannot configure remote connection pool")
+	if cmd == c.FullCommand() {
+		kingpin.FatalIfError(check(rbac.Mode(*mode), clusterConfig, cRBACOptions(rbac.Mode(*mode))...), "permission check failed")
+		return
+	}
+	if cmd == np.FullCommand() {
+		opts := []netpol.GeneratorOption{netpol.WithName(*npName), netpol.WithNamespace(*npNamespace), netpol.WithPodLabels(*npPodLabels), netpol.WithDNS(*npDNS)}
+		// The agent connects to the tunnel rather than the remote cluster if
+		// there is one.
+		remote := clusterConfig.Host
+		if *remoteTunnel != "" {
+			remote = *remoteTunnel
+		}
+		kingpin.FatalIfError(networkPolicy(append([]string{remote}, *npEndpoints...), opts...), "cannot generate network policy")
+		return
+	}
+	if cmd == im.FullCommand() {
+		gvk, _ := schema.ParseKindArg(*imKind)
+		if gvk == nil {
+			kingpin.FatalUsage("kind %s is not in Kind.version.group format", *imKind)
+		}
+		nn, err := parseNamespacedName(*imClaim)
+		if err != nil {
+			kingpin.FatalUsage("claim %s", err)
+		}
+		kingpin.FatalIfError(importClaim(clusterConfig, *gvk, nn, bootstrap.WithImportRemoteNamespace(*imRemoteNamespace), bootstrap.WithImportNamespace(*imNamespace)), "cannot import claim")
+		return
+	}
 	duration, _ := time.ParseDuration("1h")
 	switch *mode {
 	case "local":
 		agent := &local.Agent{
-			ClusterConfig: clusterConfig,
-			DefaultConfig: defaultConfig,
+			ClusterConfig:               clusterConfig,
+			DefaultConfig:               defaultConfig,
+			RemoteClaimLabels:           *remoteClaimLabels,
+			RemoteClaimAnnotations:      *remoteClaimAnnotations,
+			ClusterName:                 *syncClusterName,
+			AttributeRequesters:         *attributeRequesters,
+			PreservedAnnotations:        *preservedAnnotations,
+			MetadataStrategy:            resource.MetadataStrategy(*metadataStrategy),
+			RemoteServerSideApply:       *remoteSSA,
+			SecretConflictPolicy:        claim.SecretConflictPolicy(*secretConflictPolicy),
+			WithoutConnectionSecrets:    *withoutSecrets,
+			SecretNamespaces:            *secretNamespaces,
+			SecretLabels:                *secretLabels,
+			SecretWorkers:               *secretWorkers,
+			SecretRetries:               *secretRetries,
+			SecretRetryBackoff:          *secretRetryBackoff,
+			SecretRetryMaxBackoff:       *secretRetryMaxBackoff,
+			SecretCacheTTL:              *secretCacheTTL,
+			DeletionGracePeriod:         *deletionGracePeriod,
+			NamespaceCleanup:            *namespaceCleanup,
+			DetectStaleRemotes:          *detectStaleRemotes,
+			StatusConfigMaps:            *statusConfigMaps,
+			ObserveTeardown:             *observeTeardown,
+			LogDigestInterval:           *logDigestInterval,
+			SyncHistorySize:             *syncHistorySize,
+			RemoteSnapshots:             *remoteSnapshots,
+			ApprovalKinds:               *approvalKinds,
+			ApprovalAddress:             *approvalAddress,
+			ApprovalTLSCertFile:         *approvalTLSCert,
+			ApprovalTLSKeyFile:          *approvalTLSKey,
+			SlowReconcileThreshold:      *slowReconcileThreshold,
+			RequeueJitter:               *requeueJitter,
+			PrioritizeChanges:           *prioritizeChanges,
+			ResyncBacklog:               *resyncBacklog,
+			ResolveCompositionSelectors: *resolveSelectors,
+			DefaultCompositions:         *defaultCompositions,
+			ClaimTemplatesNamespace:     *claimTemplatesNamespace,
+			EmergencyStop:               *emergencyStop,
+			Maintenance:                 *maintenanceMode,
+			ClusterConfigWatcher:        watcher,
+			RemoteIdentity:              id,
+			SyncCompleteFile:            *syncCompleteFile,
+			InitialSyncReadiness:        *waitForInitialSync,
+			InitialSyncTimeout:          *initialSyncTimeout,
+		}
+		if *shardCount > 0 || *shardSelector != "" || len(*shardKinds) > 0 {
+			if *shardName == "" {
+				kingpin.FatalUsage("--shard-name is required to shard the claims")
+			}
+			sh := shard.Shard{Name: *shardName, Index: *shardIndex, Count: *shardCount, Selector: *shardSelector}
+			for _, k := range *shardKinds {
+				sh.Kinds = append(sh.Kinds, schema.ParseGroupKind(k))
+			}
+			owned, err := shard.New(sh)
+			if err != nil {
+				kingpin.FatalUsage("--shard-index or --shard-selector %s", err)
+			}
+			nn, err := parseNamespacedName(*shardRegistry)
+			if err != nil {
+				kingpin.FatalUsage("--shard-registry %s", err)
+			}
+			agent.Shard = owned
+			agent.ShardRegistry = nn
+		}
+		if *emergencyStopConfigMap != "" {
+			nn, err := parseNamespacedName(*emergencyStopConfigMap)
+			if err != nil {
+				kingpin.FatalUsage("--emergency-stop-configmap %s", err)
+			}
+			agent.EmergencyStopConfigMap = nn
+		}
+		if *maintenanceConfigMap != "" {
+			nn, err := parseNamespacedName(*maintenanceConfigMap)
+			if err != nil {
+				kingpin.FatalUsage("--maintenance-configmap %s", err)
+			}
+			agent.MaintenanceConfigMap = nn
+		}
+		if len(*notificationWebhooks)+len(*slackWebhooks) > 0 {
+			var ns notify.Notifiers
+			for f, hooks := range map[notify.Format][]string{notify.FormatJSON: *notificationWebhooks, notify.FormatSlack: *slackWebhooks} {
+				for _, h := range hooks {
+					url, kinds, err := notify.ParseWebhook(h)
+					if err != nil {
+						kingpin.FatalUsage("--notification-webhook %s", err)
+					}
+					ns = append(ns, notify.NewWebhook(url, notify.WithFormat(f), notify.WithKinds(kinds...), notify.WithLogger(log)))
+				}
+			}
+			agent.Notifier = ns
+		}
+		slas, err := claim.ParseProvisioningSLAs(*provisioningSLAs...)
+		if err != nil {
+			kingpin.FatalUsage("--provisioning-sla %s", err)
+		}
+		agent.ProvisioningSLAs = slas
+		if *secretEncryptionKeyFile != "" {
+			key, err := encryption.ReadKeyFile(*secretEncryptionKeyFile)
+			kingpin.FatalIfError(err, "cannot read --connection-secret-encryption-key-file")
+			e, err := encryption.NewEnvelope(key)
+			kingpin.FatalIfError(err, "cannot use --connection-secret-encryption-key-file")
+			agent.SecretEncrypter = e
+		}
+		agent.CRDConversion = resource.CRDConversion{Strategy: resource.ConversionStrategy(*crdConversion), Path: *crdConversionPath, Port: *crdConversionPort}
+		if agent.CRDConversion.Strategy == resource.ConversionStrategyWebhook {
+			nn, err := parseNamespacedName(*crdConversionService)
+			if err != nil {
+				kingpin.FatalUsage("--crd-conversion-service %s", err)
+			}
+			agent.CRDConversion.Service = nn
+		}
+		if *crdConversionCAFile != "" {
+			ca, err := ioutil.ReadFile(*crdConversionCAFile)
+			kingpin.FatalIfError(err, "cannot read --crd-conversion-ca-file")
+			agent.CRDConversion.CABundle = ca
 		}
-		kingpin.FatalIfError(agent.Run(logging.NewLogrLogger(zl.WithName("crossplane-agent")), duration), "cannot run agent in local mode")
+		agent.StructuralSchemas = *structuralSchemas
+		agent.CRDDeletionPolicy = xrd.CRDDeletionPolicy(*crdDeletionPolicy)
+		agent.CRDDeletionGracePeriod = *crdDeletionGracePeriod
+		agent.MigrateClaims = *migrateClaims || *claimMigrationRulesFile != ""
+		if *claimMigrationRulesFile != "" {
+			rules, err := migration.Load(*claimMigrationRulesFile)
+			kingpin.FatalIfError(err, "cannot load --claim-migration-rules-file")
+			agent.ClaimMigrationRules = rules
+		}
+		agent.CRDOverrides = *crdOverrides
+		if *fleetReport != "" {
+			nn, err := parseNamespacedName(*fleetReport)
+			if err != nil {
+				kingpin.FatalUsage("--fleet-report %s", err)
+			}
+			agent.FleetReport = nn
+		}
+		if *fleetReportNamespaces && *fleetReport == "" {
+			kingpin.FatalUsage("--fleet-report-namespaces requires --fleet-report")
+		}
+		agent.FleetReportNamespaces = *fleetReportNamespaces
+		if *skipCRDManagement && len(*claimKinds) == 0 {
+			kingpin.FatalUsage("--skip-crd-management requires at least one --claim-kind")
+		}
+		if !*skipCRDManagement && len(*claimKinds) > 0 {
+			kingpin.FatalUsage("--claim-kind cannot be used without --skip-crd-management")
+		}
+		for _, k := range *claimKinds {
+			gvk, _ := schema.ParseKindArg(k)
+			if gvk == nil {
+				kingpin.FatalUsage("--claim-kind %s is not in Kind.version.group format", k)
+			}
+			agent.ClaimKinds = append(agent.ClaimKinds, *gvk)
+		}
+		agent.SkipCRDManagement = *skipCRDManagement
+		agent.RemoteNamespace = *remoteNamespace
+		if *inCluster && agent.RemoteNamespace == "" {
+			agent.RemoteNamespace = "crossplane-agent-remote"
+		}
+		kingpin.FatalIfError(agent.Run(log, duration), "cannot run agent in local mode")
 	case "remote":
+		// The definitions, compositions and CRDs are cluster wide, so every
+		// shard needs all of them and they're synced by a single agent.
+		if *shardName != "" || *shardCount > 0 || *shardSelector != "" || len(*shardKinds) > 0 {
+			kingpin.FatalUsage("--shard-name, --shard-count, --shard-selector and --shard-kind cannot be used in remote mode")
+		}
 		agent := &remote.Agent{
-			ClusterConfig: clusterConfig,
+			ClusterConfig:          clusterConfig,
+			ClusterConfigWatcher:   watcher,
+			SyncStoreConfigs:       *syncStoreConfigs,
+			ClusterTypes:           *syncClusterTypes,
+			MaxDeletionsPerSync:    *maxDeletionsPerSync,
+			MaxDeletionPercentage:  *maxDeletionPercentage,
+			ClusterName:            *remoteClusterName,
+			PreservedAnnotations:   *preservedAnnotations,
+			MetadataStrategy:       resource.MetadataStrategy(*metadataStrategy),
+			SyncCompleteFile:       *syncCompleteFile,
+			InitialSyncReadiness:   *waitForInitialSync,
+			InitialSyncTimeout:     *initialSyncTimeout,
+			SyncedBundle:           *syncedBundle,
+			RequeueJitter:          *requeueJitter,
+			CompositionRolloutRate: *compositionRolloutRate,
+			ConflictStrategy:       apiextensions.ConflictStrategy(*conflictStrategy),
+		}
+		if *syncEnvironmentConfigs {
+			agent.ClusterTypes = append(agent.ClusterTypes, apiextensions.EnvironmentConfigType)
 		}
-		kingpin.FatalIfError(agent.Run(logging.NewLogrLogger(zl.WithName("crossplane-agent")), duration), "cannot run agent in remote mode")
+		if *transformationRulesFile != "" {
+			t, err := transform.Load(*transformationRulesFile)
+			kingpin.FatalIfError(err, "cannot load transformation rules")
+			agent.Transformer = t
+		}
+		kingpin.FatalIfError(agent.Run(log, duration), "cannot run agent in remote mode")
+	}
+}
+
+func parseNamespacedName(s string) (types.NamespacedName, error) {
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return types.NamespacedName{}, errors.New("must be in namespace/name format")
+	}
+	return types.NamespacedName{Namespace: parts[0], Name: parts[1]}, nil
+}
+
+// register registers this cluster with the remote cluster and prints the
+// Secret that should be created in this cluster for the agent to use.
+func register(adminKubeconfig, cluster, namespace string, secret types.NamespacedName) error {
+	cfg, err := clientcmd.BuildConfigFromFlags("", adminKubeconfig)
+	if err != nil {
+		return errors.Wrap(err, "cannot parse remote admin kubeconfig")
+	}
+	kube, err := client.New(cfg, client.Options{})
+	if err != nil {
+		return errors.Wrap(err, "cannot create remote client")
+	}
+	r := bootstrap.NewRegistrar(kube, cfg.Host, bootstrap.WithNamespace(namespace), bootstrap.WithKubeconfigSecret(secret))
+	reg, err := r.Register(context.Background(), cluster)
+	if err != nil {
+		return err
+	}
+	out, err := yaml.Marshal(reg.KubeconfigSecret)
+	if err != nil {
+		return errors.Wrap(err, "cannot marshal kubeconfig secret")
+	}
+	fmt.Print(string(out))
+	fmt.Fprintf(os.Stderr, "Create the Secret above in this cluster and start the agent in local mode with:\n  --remote-kubeconfig-secret %s --remote-namespace %s --cluster-name %s\n",
+		secret, reg.Namespace, cluster)
+	return nil
+}
+
+// deregister releases the claims of the given cluster in the remote cluster
+// and prints how many of them are released and deleted.
+func deregister(adminKubeconfig, cluster, namespace string, deleteClaims bool) error {
+	cfg, err := clientcmd.BuildConfigFromFlags("", adminKubeconfig)
+	if err != nil {
+		return errors.Wrap(err, "cannot parse remote admin kubeconfig")
+	}
+	s := runtime.NewScheme()
+	if err := scheme.AddToScheme(s); err != nil {
+		return errors.Wrap(err, "cannot add client-go scheme")
+	}
+	if err := capiextensions.SchemeBuilder.AddToScheme(s); err != nil {
+		return errors.Wrap(err, "cannot add crossplane apiextensions scheme")
+	}
+	kube, err := client.New(cfg, client.Options{Scheme: s})
+	if err != nil {
+		return errors.Wrap(err, "cannot create remote client")
+	}
+	opts := []bootstrap.DeregistrarOption{bootstrap.WithDeregistrationNamespace(namespace)}
+	if deleteClaims {
+		opts = append(opts, bootstrap.WithClaimsDeleted())
+	}
+	res, err := bootstrap.NewDeregistrar(kube, opts...).Deregister(context.Background(), cluster)
+	if res != nil {
+		fmt.Printf("Released %d and deleted %d claims of cluster %s\n", res.Released, res.Deleted, cluster)
+	}
+	return err
+}
+
+// importClaim creates the local counterpart of the given claim in the remote
+// cluster and prints its key.
+func importClaim(remoteConfig *rest.Config, gvk schema.GroupVersionKind, remote types.NamespacedName, opts ...bootstrap.ImporterOption) error {
+	localClient, err := client.New(ctrl.GetConfigOrDie(), client.Options{})
+	if err != nil {
+		return errors.Wrap(err, "cannot create local client")
+	}
+	remoteClient, err := client.New(remoteConfig, client.Options{})
+	if err != nil {
+		return errors.Wrap(err, "cannot create remote client")
+	}
+	lc, err := bootstrap.NewImporter(localClient, remoteClient, opts...).Import(context.Background(), gvk, remote)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Imported remote claim %s as %s %s/%s\n", remote, gvk.Kind, lc.GetNamespace(), lc.GetName())
+	return nil
+}
+
+// export writes the bundle of the objects in this cluster to the given file
+// and prints what's exported.
+func export(output string, opts ...backup.ExporterOption) error {
+	kube, err := client.New(ctrl.GetConfigOrDie(), client.Options{})
+	if err != nil {
+		return errors.Wrap(err, "cannot create local client")
+	}
+	f, err := os.Create(filepath.Clean(output))
+	if err != nil {
+		return errors.Wrap(err, "cannot create output file")
+	}
+	res, err := backup.NewExporter(kube, opts...).Export(context.Background(), f)
+	if cerr := f.Close(); err == nil && cerr != nil {
+		err = errors.Wrap(cerr, "cannot close output file")
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Exported %d objects and %d claim mappings to %s\n", res.Objects, len(res.Mappings), output)
+	return nil
+}
+
+// networkPolicy prints the NetworkPolicy that allows the agent to reach the
+// API server of this cluster and the given servers.
+func networkPolicy(servers []string, opts ...netpol.GeneratorOption) error {
+	kube, err := client.New(ctrl.GetConfigOrDie(), client.Options{})
+	if err != nil {
+		return errors.Wrap(err, "cannot create local client")
+	}
+	endpoints, err := netpol.KubernetesEndpoints(context.Background(), kube)
+	if err != nil {
+		return err
+	}
+	for _, s := range servers {
+		e, err := netpol.ServerEndpoint(context.Background(), s, netpol.DefaultResolver)
+		if err != nil {
+			return err
+		}
+		endpoints = append(endpoints, e)
+	}
+	out, err := yaml.Marshal(netpol.NewGenerator(opts...).Generate(endpoints...))
+	if err != nil {
+		return errors.Wrap(err, "cannot marshal network policy")
+	}
+	fmt.Print(string(out))
+	return nil
+}
+
+// loadTest creates claims of the given kind in this cluster, waits for the
+// running agent to sync them and prints the measured latencies.
+func loadTest(gvk schema.GroupVersionKind, cleanup bool, opts ...loadtest.Option) error {
+	kube, err := client.New(ctrl.GetConfigOrDie(), client.Options{})
+	if err != nil {
+		return errors.Wrap(err, "cannot create local client")
+	}
+	r := loadtest.NewRunner(kube, gvk, opts...)
+	res, err := r.Run(context.Background())
+	if cleanup && res.Run != "" {
+		if cerr := r.Cleanup(context.Background(), res.Run); cerr != nil {
+			fmt.Fprintf(os.Stderr, "cannot clean up claims of run %s: %s\n", res.Run, cerr)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "RUN\t%s\n", res.Run)
+	fmt.Fprintf(w, "SYNCED\t%d/%d\n", res.Synced(), res.Count)
+	fmt.Fprintf(w, "ELAPSED\t%s\n", res.Elapsed)
+	fmt.Fprintf(w, "THROUGHPUT\t%.2f claims/s\n", res.Throughput())
+	for _, p := range []float64{50, 90, 99, 100} {
+		fmt.Fprintf(w, "P%g\t%s\n", p, res.Percentile(p))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return res.Err()
+}
+
+// rbacFlags adds the flags that decide the permissions the agent needs to the
+// supplied command and returns a function that returns the options they make
+// for the given mode. They're the same as the ones of the sync command.
+func rbacFlags(cmd *kingpin.CmdClause) func(mode rbac.Mode) []rbac.Option {
+	kinds := cmd.Flag("kind", "A claim type in resource.group format that the agent syncs, e.g. postgresqlinstances.database.example.org. The claim types are not known until their definitions are synced, so the permissions for them are only included if given. Can be repeated. Only valid in local mode.").Strings()
+	remoteNamespace := cmd.Flag("remote-namespace", "The --remote-namespace of the agent, if any.").String()
+	withoutSecrets := cmd.Flag("without-connection-secrets", "Whether the agent runs with --without-connection-secrets.").Bool()
+	secretNamespaces := cmd.Flag("connection-secret-namespace", "A --connection-secret-namespace of the agent. Can be repeated.").Strings()
+	namespaceCleanup := cmd.Flag("namespace-cleanup", "Whether the agent runs with --namespace-cleanup.").Bool()
+	secretCacheTTL := cmd.Flag("connection-secret-cache-ttl", "The --connection-secret-cache-ttl of the agent, if any.").Duration()
+	migrateClaims := cmd.Flag("migrate-claims", "Whether the agent runs with --migrate-claims or --claim-migration-rules-file.").Bool()
+	syncStoreConfigs := cmd.Flag("sync-store-configs", "Whether the agent runs with --sync-store-configs.").Bool()
+	syncClusterTypes := cmd.Flag("sync-cluster-type", "A --sync-cluster-type of the agent. Can be repeated.").Strings()
+	syncedBundle := cmd.Flag("synced-bundle", "The --synced-bundle of the agent, if any.").String()
+	shardRegistry := cmd.Flag("shard-registry", "The --shard-registry of the agent, if its claims are sharded.").String()
+	statusConfigMaps := cmd.Flag("status-configmaps", "Whether the agent runs with --status-configmaps.").Bool()
+	approvalKinds := cmd.Flag("approval-required-kind", "An --approval-required-kind of the agent. Can be repeated.").Strings()
+	return func(mode rbac.Mode) []rbac.Option {
+		if mode == rbac.ModeRemote {
+			a := &remote.Agent{SyncStoreConfigs: *syncStoreConfigs, ClusterTypes: *syncClusterTypes, SyncedBundle: *syncedBundle}
+			return a.RBACOptions()
+		}
+		a := &local.Agent{
+			RemoteNamespace:          *remoteNamespace,
+			WithoutConnectionSecrets: *withoutSecrets,
+			SecretNamespaces:         *secretNamespaces,
+			NamespaceCleanup:         *namespaceCleanup,
+			SecretCacheTTL:           *secretCacheTTL,
+			MigrateClaims:            *migrateClaims,
+			StatusConfigMaps:         *statusConfigMaps,
+			ApprovalKinds:            *approvalKinds,
+		}
+		if *shardRegistry != "" {
+			nn, err := parseNamespacedName(*shardRegistry)
+			if err != nil {
+				kingpin.FatalUsage("--shard-registry %s", err)
+			}
+			a.ShardRegistry = nn
+		}
+		opts := a.RBACOptions()
+		for _, k := range *kinds {
+			opts = append(opts, rbac.WithKinds(schema.ParseGroupResource(k)))
+		}
+		return opts
+	}
+}
+
+// printRoles prints the roles that grant the permissions the agent needs in
+// both clusters in the given mode.
+func printRoles(name string, mode rbac.Mode, opts ...rbac.Option) error {
+	if mode == "" {
+		return errors.New("--mode has to be given")
+	}
+	reqs, err := rbac.For(mode, opts...)
+	if err != nil {
+		return err
+	}
+	for _, cl := range []struct {
+		cluster resource.Cluster
+		reqs    []rbac.Requirement
+	}{
+		{cluster: resource.ClusterLocal, reqs: reqs.Local},
+		{cluster: resource.ClusterRemote, reqs: reqs.Remote},
+	} {
+		for _, o := range rbac.Roles(name, cl.reqs) {
+			out, err := yaml.Marshal(o)
+			if err != nil {
+				return errors.Wrap(err, "cannot marshal role")
+			}
+			fmt.Printf("---\n# The permissions in the %s cluster.\n%s", strings.ToLower(string(cl.cluster)), out)
+		}
+	}
+	return nil
+}
+
+// check runs the RBAC self-check of the given mode against both clusters and
+// prints a report.
+func check(mode rbac.Mode, remoteConfig *rest.Config, opts ...rbac.Option) error {
+	if mode == "" {
+		return errors.New("--mode has to be given")
+	}
+	reqs, err := rbac.For(mode, opts...)
+	if err != nil {
+		return err
+	}
+	localClient, err := client.New(ctrl.GetConfigOrDie(), client.Options{})
+	if err != nil {
+		return errors.Wrap(err, "cannot create local client")
+	}
+	remoteClient, err := client.New(remoteConfig, client.Options{})
+	if err != nil {
+		return errors.Wrap(err, "cannot create remote client")
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CLUSTER\tPERMISSION\tALLOWED")
+	var missing []string
+	for _, cl := range []struct {
+		kube    client.Client
+		cluster resource.Cluster
+		reqs    []rbac.Requirement
+	}{
+		{kube: localClient, cluster: resource.ClusterLocal, reqs: reqs.Local},
+		{kube: remoteClient, cluster: resource.ClusterRemote, reqs: reqs.Remote},
+	} {
+		r, err := rbac.Check(context.Background(), cl.kube, cl.cluster, cl.reqs)
+		if err != nil {
+			return err
+		}
+		for _, a := range r.Allowed {
+			fmt.Fprintf(w, "%s\t%s\t%t\n", cl.cluster, a, true)
+		}
+		for _, m := range r.Missing {
+			fmt.Fprintf(w, "%s\t%s\t%t\n", cl.cluster, m, false)
+		}
+		if err := r.Err(); err != nil {
+			missing = append(missing, err.Error())
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return errors.New(strings.Join(missing, "; "))
 	}
+	return nil
 }
@@ -17,37 +17,151 @@ limitations under the License.
 package remote
 
 import (
+	"context"
 	"time"
 
 	"github.com/pkg/errors"
+	crdsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	crds "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	"github.com/crossplane/crossplane-runtime/pkg/logging"
 	capiextensions "github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
 
+	"github.com/crossplane/agent/pkg/bundle"
 	"github.com/crossplane/agent/pkg/controllers/apiextensions"
 	"github.com/crossplane/agent/pkg/controllers/crd"
+	"github.com/crossplane/agent/pkg/rbac"
+	"github.com/crossplane/agent/pkg/resource"
+	"github.com/crossplane/agent/pkg/rollout"
+	"github.com/crossplane/agent/pkg/schedule"
+	"github.com/crossplane/agent/pkg/startup"
+	"github.com/crossplane/agent/pkg/transform"
 )
 
 // Agent configures & starts the manager that is watching the remote cluster.
 type Agent struct {
 	ClusterConfig *rest.Config
+
+	// ClusterConfigWatcher, if given, is run with the manager to stop the agent
+	// once ClusterConfig is no longer valid, e.g. when it's rotated.
+	ClusterConfigWatcher manager.Runnable
+
+	// SyncStoreConfigs makes the agent sync the StoreConfigs of the remote
+	// cluster. The remote cluster has to have the StoreConfig CRD.
+	SyncStoreConfigs bool
+
+	// ClusterTypes are the cluster-scoped types of the remote cluster whose
+	// objects are synced to the local cluster, in resource.version.group
+	// format, e.g. apiextensions.EnvironmentConfigType.
+	ClusterTypes []string
+
+	// MaxDeletionsPerSync and MaxDeletionPercentage limit how many of the
+	// synced objects of all types are deleted from the local cluster per
+	// removal delay and the share of the objects of a type, in percent, that
+	// may be gone from the remote cluster at once before their deletions are
+	// halted.
+	MaxDeletionsPerSync   int
+	MaxDeletionPercentage int
+
+	// ClusterName is the name of the remote cluster that the synced objects
+	// are annotated with in the local cluster. Defaults to the address of its
+	// API server.
+	ClusterName string
+
+	// PreservedAnnotations are the annotations of the synced objects in the
+	// local cluster that are not overridden by the remote ones.
+	PreservedAnnotations resource.PreservedAnnotations
+
+	// MetadataStrategy, if given, determines how the labels and annotations
+	// of the synced objects in the local cluster are equalized with the ones
+	// of the remote objects.
+	MetadataStrategy resource.MetadataStrategy
+
+	// SyncCompleteFile, if given, is written once the initial sync is
+	// complete. The agent isn't ready until then if InitialSyncReadiness is
+	// true.
+	SyncCompleteFile     string
+	InitialSyncReadiness bool
+
+	// InitialSyncTimeout is how long the initial sync is waited for at
+	// most. The agent is ready once it passes, even if InitialSyncReadiness
+	// is true, but the signal file isn't written.
+	InitialSyncTimeout time.Duration
+
+	// Transformer, if given, transforms the synced objects before they're
+	// applied to the local cluster. Its rules may only transform the synced
+	// types.
+	Transformer *transform.Transformer
+
+	// RequeueJitter is the share of the requeue intervals that is randomly
+	// added to or subtracted from them so that the objects that are synced
+	// together don't keep being requeued together.
+	RequeueJitter float64
+
+	// SyncedBundle, if given, is the name of the SyncedBundle that owns the
+	// synced objects in the local cluster. It's created if it doesn't exist.
+	SyncedBundle string
+
+	// CompositionRolloutRate, if given, is how many Compositions may be
+	// updated in the local cluster per minute.
+	CompositionRolloutRate int
+
+	// ConflictStrategy is what is done when both a synced object in the local
+	// cluster and its remote counterpart changed since the last sync.
+	ConflictStrategy apiextensions.ConflictStrategy
+}
+
+// RBACOptions returns the options that decide the permissions the agent needs
+// with this configuration.
+func (a *Agent) RBACOptions() []rbac.Option {
+	var grs []schema.GroupResource
+	if a.SyncStoreConfigs {
+		grs = append(grs, schema.ParseGroupResource(apiextensions.StoreConfigCRDName))
+	}
+	for _, s := range a.ClusterTypes {
+		if gvr, _ := schema.ParseResourceArg(s); gvr != nil {
+			grs = append(grs, gvr.GroupResource())
+		}
+	}
+	opts := []rbac.Option{rbac.WithKinds(grs...)}
+	if a.SyncedBundle != "" {
+		opts = append(opts, rbac.WithSyncedBundle())
+	}
+	return opts
 }
 
 // Run adds all controllers and starts the manager that watches the remote cluster.
 func (a *Agent) Run(log logging.Logger, period time.Duration) error {
 	log.Debug("Starting", "sync-period", period.String())
 
-	localClient, err := client.New(ctrl.GetConfigOrDie(), client.Options{})
+	localConfig := ctrl.GetConfigOrDie()
+	dc, err := discovery.NewDiscoveryClientForConfig(localConfig)
+	if err != nil {
+		return errors.Wrap(err, "cannot create local discovery client")
+	}
+	// The CRDs are synced to and checked in the local cluster with whichever
+	// CustomResourceDefinition API it serves so that the agent works across
+	// mixed fleets.
+	crdVersion, err := resource.DiscoverCRDVersion(dc)
+	if err != nil {
+		return errors.Wrap(err, "cannot discover the CustomResourceDefinition version of the local cluster")
+	}
+	log.Debug("Discovered local CustomResourceDefinition version", "version", crdVersion)
+	kube, err := client.New(localConfig, client.Options{})
 	if err != nil {
 		return errors.Wrap(err, "cannot create local client")
 	}
+	localClient := crdVersion.Client(kube)
 
-	mgr, err := ctrl.NewManager(a.ClusterConfig, ctrl.Options{SyncPeriod: &period, MetricsBindAddress: "127.0.0.1:8081"})
+	mgr, err := ctrl.NewManager(a.ClusterConfig, ctrl.Options{SyncPeriod: &period, MetricsBindAddress: "127.0.0.1:8081", HealthProbeBindAddress: ":8091"})
 	if err != nil {
 		return errors.Wrap(err, "cannot start remote cluster manager")
 	}
@@ -56,19 +170,155 @@ func (a *Agent) Run(log logging.Logger, period time.Duration) error {
 		return errors.Wrap(err, "Cannot add CustomResourceDefinition API to scheme")
 	}
 
+	if err := crdsv1.AddToScheme(mgr.GetScheme()); err != nil {
+		return errors.Wrap(err, "Cannot add CustomResourceDefinition v1 API to scheme")
+	}
+
 	if err := capiextensions.SchemeBuilder.AddToScheme(mgr.GetScheme()); err != nil {
 		return errors.Wrap(err, "Cannot add Crossplane apiextensions API to scheme")
 	}
 
-	for _, setup := range []func(mgr manager.Manager, localClient client.Client, logger logging.Logger) error{
-		crd.Setup,
+	clusterName := a.ClusterName
+	if clusterName == "" {
+		clusterName = a.ClusterConfig.Host
+	}
+	var crdNames []string
+	syncs := []func(mgr ctrl.Manager, localClient client.Client, log logging.Logger, opts ...apiextensions.SetupOption) error{
 		apiextensions.SetupXRDSync,
 		apiextensions.SetupCompositionSync,
-	} {
-		if err := setup(mgr, localClient, log); err != nil {
+	}
+	if a.SyncStoreConfigs {
+		crdNames = append(crdNames, apiextensions.StoreConfigCRDName)
+		syncs = append(syncs, apiextensions.SetupStoreConfigSync)
+	}
+	for _, s := range a.ClusterTypes {
+		t, err := apiextensions.ParseClusterType(s, mgr.GetRESTMapper())
+		if err != nil {
+			return errors.Wrap(err, "cannot setup cluster type sync")
+		}
+		crdNames = append(crdNames, t.CRDName)
+		syncs = append(syncs, apiextensions.SetupClusterTypeSync(t))
+	}
+	reqs, err := rbac.For(rbac.ModeRemote, a.RBACOptions()...)
+	if err != nil {
+		return errors.Wrap(err, "cannot derive RBAC requirements")
+	}
+	if err := crd.SetupFor(mgr, localClient, log, crdNames...); err != nil {
+		return errors.Wrap(err, "cannot setup the controller")
+	}
+
+	// The synced objects are requeued as soon as their CRDs are established in
+	// the local cluster, which is watched through a cache of its own since the
+	// manager is configured with the remote cluster.
+	localCache, err := cache.New(localConfig, cache.Options{Scheme: mgr.GetScheme()})
+	if err != nil {
+		return errors.Wrap(err, "cannot create local cluster cache")
+	}
+	if err := mgr.Add(localCache); err != nil {
+		return errors.Wrap(err, "cannot add local cluster cache")
+	}
+	crdInformer, err := localCache.GetInformer(context.Background(), crdVersion.Object())
+	if err != nil {
+		return errors.Wrap(err, "cannot get local CustomResourceDefinition informer")
+	}
+	gate := a.initialSyncGate(log)
+	sched := schedule.NewCalendar(schedule.WithJitter(a.RequeueJitter))
+	if err := mgr.AddMetricsExtraHandler("/debug/sync-schedule", sched); err != nil {
+		return errors.Wrap(err, "cannot serve sync schedule")
+	}
+	so := []apiextensions.SetupOption{
+		apiextensions.WithInitialSyncGate(gate),
+		apiextensions.WithSyncScheduler(sched),
+		apiextensions.WithLocalCRDSource(&source.Informer{Informer: crdInformer}),
+		apiextensions.WithPreservedLocalAnnotations(a.PreservedAnnotations),
+		apiextensions.WithDeletionLimits(a.MaxDeletionsPerSync, a.MaxDeletionPercentage),
+		apiextensions.WithSourceClusterName(clusterName),
+	}
+	if a.Transformer != nil {
+		if err := validateTransformer(a.Transformer, append([]string{apiextensions.XRDCRDName, apiextensions.CompositionCRDName}, crdNames...)); err != nil {
+			return err
+		}
+		so = append(so, apiextensions.WithTransformer(a.Transformer))
+	}
+	if a.MetadataStrategy != "" {
+		e, err := resource.NewMetadataEqualizer(a.MetadataStrategy)
+		if err != nil {
+			return err
+		}
+		so = append(so, apiextensions.WithLocalMetadataEqualizer(e))
+	}
+	if a.SyncedBundle != "" {
+		if _, err := bundle.Ensure(context.Background(), localClient, a.SyncedBundle); err != nil {
+			return errors.Wrap(err, "cannot ensure the synced bundle")
+		}
+		so = append(so, apiextensions.WithLocalOwner(bundle.Owner(localClient, a.SyncedBundle)))
+	}
+	if a.CompositionRolloutRate > 0 {
+		so = append(so, apiextensions.WithCompositionRollout(rollout.NewWindow(a.CompositionRolloutRate)))
+	}
+	if a.ConflictStrategy != "" {
+		so = append(so, apiextensions.WithSyncConflictStrategy(a.ConflictStrategy))
+	}
+	for _, setup := range syncs {
+		if err := setup(mgr, localClient, log, so...); err != nil {
 			return errors.Wrap(err, "cannot setup the controller")
 		}
 	}
 
+	if err := mgr.AddReadyzCheck("rbac", rbac.SelfCheck(context.Background(), log, localClient, mgr.GetClient(), reqs)); err != nil {
+		return errors.Wrap(err, "cannot add RBAC readiness check")
+	}
+
+	if err := a.addInitialSyncGate(mgr, gate); err != nil {
+		return err
+	}
+
+	if a.ClusterConfigWatcher != nil {
+		if err := mgr.Add(a.ClusterConfigWatcher); err != nil {
+			return errors.Wrap(err, "cannot add cluster config watcher")
+		}
+	}
+
 	return errors.Wrap(mgr.Start(ctrl.SetupSignalHandler()), "cannot start controller manager")
 }
+
+// validateTransformer returns an error if the supplied Transformer has rules
+// for types that aren't synced, which are most likely typos.
+func validateTransformer(t *transform.Transformer, synced []string) error {
+	for _, r := range t.Resources() {
+		found := false
+		for _, s := range synced {
+			if r == s {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.Errorf("cannot transform %s, it's not a synced type", r)
+		}
+	}
+	return nil
+}
+
+// initialSyncGate returns the Gate that tracks the initial sync. It's always
+// tracked so that its progress is logged and served.
+func (a *Agent) initialSyncGate(log logging.Logger) *startup.Gate {
+	opts := []startup.GateOption{startup.WithSignalFile(a.SyncCompleteFile), startup.WithLogger(log)}
+	if a.InitialSyncTimeout > 0 {
+		opts = append(opts, startup.WithTimeout(a.InitialSyncTimeout))
+	}
+	return startup.NewGate(opts...)
+}
+
+func (a *Agent) addInitialSyncGate(mgr manager.Manager, g *startup.Gate) error {
+	if err := mgr.Add(g); err != nil {
+		return errors.Wrap(err, "cannot add initial sync gate")
+	}
+	if err := mgr.AddMetricsExtraHandler("/debug/initial-sync", g); err != nil {
+		return errors.Wrap(err, "cannot serve initial sync progress")
+	}
+	if a.InitialSyncReadiness {
+		return errors.Wrap(mgr.AddReadyzCheck("initial-sync", g.Check), "cannot add initial sync readiness check")
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package approval contains the approval gate of the claims, which holds the
+// claims of the configured kinds in the local cluster until someone approves
+// them, so that they go through a change management process before they're
+// forwarded to the remote cluster. The approvals are cluster scoped
+// ClaimApprovals rather than anything on the claims, so that the people who
+// may write the claims cannot approve them unless they're also granted access
+// to ClaimApprovals.
+package approval
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	runtimeresource "github.com/crossplane/crossplane-runtime/pkg/resource"
+
+	"github.com/crossplane/agent/pkg/resource"
+)
+
+const (
+	errEnsureCRD       = "cannot ensure ClaimApproval CustomResourceDefinition"
+	errGetApproval     = "cannot get ClaimApproval"
+	errApplyApproval   = "cannot apply ClaimApproval"
+	errConvertApproval = "cannot convert ClaimApproval"
+	defaultEstablished = 1 * time.Minute
+)
+
+// CRDName is the name of the CustomResourceDefinition of ClaimApprovals.
+const CRDName = "claimapprovals.agent.crossplane.io"
+
+// GroupVersionKind of ClaimApprovals.
+var GroupVersionKind = schema.GroupVersionKind{Group: "agent.crossplane.io", Version: "v1alpha1", Kind: "ClaimApproval"}
+
+// Resource is the plural resource name of ClaimApprovals.
+const Resource = "claimapprovals"
+
+// A ClaimReference refers to the claim that a ClaimApproval approves. The UID
+// makes sure that a claim that is deleted and created again with the same
+// name isn't approved by the ClaimApproval of the deleted one.
+type ClaimReference struct {
+	APIVersion string    `json:"apiVersion"`
+	Kind       string    `json:"kind"`
+	Namespace  string    `json:"namespace"`
+	Name       string    `json:"name"`
+	UID        types.UID `json:"uid"`
+}
+
+// A ClaimApprovalSpec records who approved which generation of a claim.
+type ClaimApprovalSpec struct {
+	Claim      ClaimReference `json:"claim"`
+	Generation int64          `json:"generation"`
+	Approver   string         `json:"approver"`
+}
+
+// CRD returns the CustomResourceDefinition of ClaimApprovals. They're cluster
+// scoped so that the namespaced roles of the claim authors don't grant access
+// to them.
+func CRD() *v1beta1.CustomResourceDefinition {
+	preserve := false
+	str := v1beta1.JSONSchemaProps{Type: "string", MinLength: int64Ptr(1)}
+	return &v1beta1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: CRDName},
+		Spec: v1beta1.CustomResourceDefinitionSpec{
+			Group: GroupVersionKind.Group,
+			Names: v1beta1.CustomResourceDefinitionNames{
+				Kind:     GroupVersionKind.Kind,
+				ListKind: GroupVersionKind.Kind + "List",
+				Plural:   Resource,
+				Singular: "claimapproval",
+			},
+			Scope:                 v1beta1.ClusterScoped,
+			PreserveUnknownFields: &preserve,
+			Versions: []v1beta1.CustomResourceDefinitionVersion{{
+				Name:    GroupVersionKind.Version,
+				Served:  true,
+				Storage: true,
+			}},
+			AdditionalPrinterColumns: []v1beta1.CustomResourceColumnDefinition{
+				{Name: "Kind", Type: "string", JSONPath: ".spec.claim.kind"},
+				{Name: "Namespace", Type: "string", JSONPath: ".spec.claim.namespace"},
+				{Name: "Claim", Type: "string", JSONPath: ".spec.claim.name"},
+				{Name: "Generation", Type: "integer", JSONPath: ".spec.generation"},
+				{Name: "Approver", Type: "string", JSONPath: ".spec.approver"},
+			},
+			Validation: &v1beta1.CustomResourceValidation{
+				OpenAPIV3Schema: &v1beta1.JSONSchemaProps{
+					Type:     "object",
+					Required: []string{"spec"},
+					Properties: map[string]v1beta1.JSONSchemaProps{
+						"spec": {
+							Type:     "object",
+							Required: []string{"claim", "generation", "approver"},
+							Properties: map[string]v1beta1.JSONSchemaProps{
+								"claim": {
+									Type:     "object",
+									Required: []string{"apiVersion", "kind", "namespace", "name", "uid"},
+									Properties: map[string]v1beta1.JSONSchemaProps{
+										"apiVersion": str,
+										"kind":       str,
+										"namespace":  str,
+										"name":       str,
+										"uid":        str,
+									},
+								},
+								"generation": {Type: "integer", Format: "int64", Minimum: float64Ptr(1)},
+								"approver":   str,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func int64Ptr(i int64) *int64 { return &i }
+
+func float64Ptr(f float64) *float64 { return &f }
+
+// Ensure creates the CustomResourceDefinition of ClaimApprovals if it doesn't
+// exist and waits for it to be established. The supplied client should be one
+// of the CustomResourceDefinition version the cluster serves, see
+// resource.CRDVersion.
+func Ensure(ctx context.Context, kube client.Client) error {
+	return resource.LocalError(resource.EnsureCRD(ctx, kube, CRD(), defaultEstablished), errEnsureCRD)
+}
+
+// Name returns the name of the ClaimApproval of the claim with the supplied
+// kind and key, which is <kind>.<group>.<namespace>.<name> in lower case.
+// Names that are too long are truncated and suffixed with a hash of the full
+// name.
+func Name(gk schema.GroupKind, key types.NamespacedName) string {
+	n := strings.ToLower(strings.Join([]string{gk.Kind, gk.Group, key.Namespace, key.Name}, "."))
+	if len(n) <= validation.DNS1123SubdomainMaxLength {
+		return n
+	}
+	sum := sha256.Sum256([]byte(n))
+	return strings.TrimRight(n[:validation.DNS1123SubdomainMaxLength-9], "-.") + "-" + hex.EncodeToString(sum[:])[:8]
+}
+
+// Approved returns whether the supplied local claim is approved to be
+// forwarded to the remote cluster at its current generation, i.e. whether its
+// ClaimApproval refers to it and was made at its current generation or later.
+// Claims without a ClaimApproval, or whose ClaimApproval has no generation or
+// approver, are not approved.
+func Approved(ctx context.Context, kube client.Reader, claim runtimeresource.Object) (bool, error) {
+	gvk := claim.GetObjectKind().GroupVersionKind()
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(GroupVersionKind)
+	err := kube.Get(ctx, types.NamespacedName{Name: Name(gvk.GroupKind(), types.NamespacedName{Namespace: claim.GetNamespace(), Name: claim.GetName()})}, u)
+	if kerrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, resource.LocalError(err, errGetApproval)
+	}
+	a := &struct {
+		Spec ClaimApprovalSpec `json:"spec"`
+	}{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.UnstructuredContent(), a); err != nil {
+		return false, errors.Wrap(err, errConvertApproval)
+	}
+	s := a.Spec
+	gv, err := schema.ParseGroupVersion(s.Claim.APIVersion)
+	if err != nil || gv.Group != gvk.Group || s.Claim.Kind != gvk.Kind {
+		return false, nil
+	}
+	if s.Claim.Namespace != claim.GetNamespace() || s.Claim.Name != claim.GetName() || s.Claim.UID != claim.GetUID() {
+		return false, nil
+	}
+	return s.Approver != "" && s.Generation > 0 && s.Generation >= claim.GetGeneration(), nil
+}
+
+// Approve approves the supplied local claim at its current generation on
+// behalf of the supplied approver by creating or updating its ClaimApproval.
+func Approve(ctx context.Context, kube client.Client, claim runtimeresource.Object, approver string) error {
+	gvk := claim.GetObjectKind().GroupVersionKind()
+	s := ClaimApprovalSpec{
+		Claim: ClaimReference{
+			APIVersion: gvk.GroupVersion().String(),
+			Kind:       gvk.Kind,
+			Namespace:  claim.GetNamespace(),
+			Name:       claim.GetName(),
+			UID:        claim.GetUID(),
+		},
+		Generation: claim.GetGeneration(),
+		Approver:   approver,
+	}
+	spec, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&s)
+	if err != nil {
+		return errors.Wrap(err, errConvertApproval)
+	}
+	u := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	u.SetGroupVersionKind(GroupVersionKind)
+	u.SetName(Name(gvk.GroupKind(), types.NamespacedName{Namespace: claim.GetNamespace(), Name: claim.GetName()}))
+	return resource.LocalError(runtimeresource.NewAPIPatchingApplicator(kube).Apply(ctx, u), errApplyApproval)
+}
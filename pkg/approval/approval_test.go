@@ -0,0 +1,300 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package approval
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+)
+
+var gvk = schema.GroupVersionKind{Group: "database.example.org", Version: "v1alpha1", Kind: "Database"}
+
+func claim(generation int64) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(gvk)
+	u.SetNamespace("cool")
+	u.SetName("db")
+	u.SetUID("cool-uid")
+	u.SetGeneration(generation)
+	return u
+}
+
+func spec(uid string, generation int64, approver string) map[string]interface{} {
+	s := map[string]interface{}{
+		"claim": map[string]interface{}{
+			"apiVersion": "database.example.org/v1alpha1",
+			"kind":       "Database",
+			"namespace":  "cool",
+			"name":       "db",
+			"uid":        uid,
+		},
+		"approver": approver,
+	}
+	if generation > 0 {
+		s["generation"] = generation
+	}
+	return s
+}
+
+func TestName(t *testing.T) {
+	gk := schema.GroupKind{Group: "database.example.org", Kind: "Database"}
+
+	cases := map[string]struct {
+		reason string
+		key    types.NamespacedName
+		want   string
+	}{
+		"Short": {
+			reason: "The name should be the lower case kind, group, namespace and name of the claim",
+			key:    types.NamespacedName{Namespace: "cool", Name: "db"},
+			want:   "database.database.example.org.cool.db",
+		},
+		"Long": {
+			reason: "A name that is too long should be truncated and suffixed with a hash",
+			key:    types.NamespacedName{Namespace: "cool", Name: strings.Repeat("a", 253)},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := Name(gk, tc.key)
+			if len(got) > validation.DNS1123SubdomainMaxLength {
+				t.Errorf("\nReason: %s\nName(...): %d characters is longer than %d", tc.reason, len(got), validation.DNS1123SubdomainMaxLength)
+			}
+			if tc.want == "" {
+				return
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\nReason: %s\nName(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestApproved(t *testing.T) {
+	notFound := kerrors.NewNotFound(schema.GroupResource{Group: GroupVersionKind.Group, Resource: Resource}, "db")
+	approvalOf := func(s map[string]interface{}) test.MockGetFn {
+		return func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+			obj.(*unstructured.Unstructured).Object["spec"] = s
+			return nil
+		}
+	}
+
+	cases := map[string]struct {
+		reason string
+		kube   client.Reader
+		claim  *unstructured.Unstructured
+		want   bool
+	}{
+		"NoApproval": {
+			reason: "A claim without a ClaimApproval should not be approved",
+			kube:   &test.MockClient{MockGet: test.NewMockGetFn(notFound)},
+			claim:  claim(1),
+			want:   false,
+		},
+		"NoGeneration": {
+			reason: "A claim whose ClaimApproval has no generation should not be approved",
+			kube:   &test.MockClient{MockGet: approvalOf(spec("cool-uid", 0, "cool-approver"))},
+			claim:  claim(1),
+			want:   false,
+		},
+		"NoApprover": {
+			reason: "A claim whose ClaimApproval has no approver should not be approved",
+			kube:   &test.MockClient{MockGet: approvalOf(spec("cool-uid", 1, ""))},
+			claim:  claim(1),
+			want:   false,
+		},
+		"AnotherClaim": {
+			reason: "A claim whose ClaimApproval is of a deleted claim with the same name should not be approved",
+			kube:   &test.MockClient{MockGet: approvalOf(spec("old-uid", 1, "cool-approver"))},
+			claim:  claim(1),
+			want:   false,
+		},
+		"ApprovedAtEarlierGeneration": {
+			reason: "A claim that changed after it was approved should not be approved",
+			kube:   &test.MockClient{MockGet: approvalOf(spec("cool-uid", 2, "cool-approver"))},
+			claim:  claim(3),
+			want:   false,
+		},
+		"ApprovedAtCurrentGeneration": {
+			reason: "A claim approved at its current generation should be approved",
+			kube:   &test.MockClient{MockGet: approvalOf(spec("cool-uid", 2, "cool-approver"))},
+			claim:  claim(2),
+			want:   true,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := Approved(context.Background(), tc.kube, tc.claim)
+			if err != nil {
+				t.Fatalf("\nReason: %s\nApproved(...): %s", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\nReason: %s\nApproved(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	notFound := kerrors.NewNotFound(schema.GroupResource{Group: "database.example.org", Resource: "databases"}, "db")
+	url := "/approve?apiVersion=database.example.org/v1alpha1&kind=Database&namespace=cool&name=db"
+
+	// review authenticates the supplied token as cool-approver, who may
+	// use the supplied verbs on ClaimApprovals.
+	all := []string{"create", "get", "patch"}
+	review := func(token string, verbs ...string) test.MockCreateFn {
+		return func(_ context.Context, obj runtime.Object, _ ...client.CreateOption) error {
+			switch o := obj.(type) {
+			case *authenticationv1.TokenReview:
+				o.Status.Authenticated = o.Spec.Token == token
+				o.Status.User.Username = "cool-approver"
+			case *authorizationv1.SubjectAccessReview:
+				for _, v := range verbs {
+					if v == o.Spec.ResourceAttributes.Verb {
+						o.Status.Allowed = o.Spec.User == "cool-approver"
+					}
+				}
+			}
+			return nil
+		}
+	}
+
+	cases := map[string]struct {
+		reason string
+		kube   client.Client
+		method string
+		url    string
+		token  string
+		want   int
+	}{
+		"WrongMethod": {
+			reason: "Claims should only be approved with POST requests",
+			method: http.MethodGet,
+			url:    url,
+			token:  "cool-token",
+			want:   http.StatusMethodNotAllowed,
+		},
+		"NoToken": {
+			reason: "Claims should not be approved without a bearer token",
+			method: http.MethodPost,
+			url:    url,
+			want:   http.StatusUnauthorized,
+		},
+		"InvalidToken": {
+			reason: "Claims should not be approved with a bearer token that doesn't authenticate",
+			kube:   &test.MockClient{MockCreate: review("cool-token", all...)},
+			method: http.MethodPost,
+			url:    url,
+			token:  "bad-token",
+			want:   http.StatusUnauthorized,
+		},
+		"KindNotApprovable": {
+			reason: "Claims of the kinds that don't need approval should not be approved",
+			kube:   &test.MockClient{MockCreate: review("cool-token", all...)},
+			method: http.MethodPost,
+			url:    "/approve?apiVersion=database.example.org/v1alpha1&kind=Bucket&namespace=cool&name=db",
+			token:  "cool-token",
+			want:   http.StatusBadRequest,
+		},
+		"Forbidden": {
+			reason: "Claims should not be approved by users who may not create ClaimApprovals",
+			kube:   &test.MockClient{MockCreate: review("cool-token")},
+			method: http.MethodPost,
+			url:    url,
+			token:  "cool-token",
+			want:   http.StatusForbidden,
+		},
+		"PatchForbidden": {
+			reason: "Claims should not be approved by users who may create but not patch ClaimApprovals, since existing ones are patched",
+			kube:   &test.MockClient{MockCreate: review("cool-token", "create", "get")},
+			method: http.MethodPost,
+			url:    url,
+			token:  "cool-token",
+			want:   http.StatusForbidden,
+		},
+		"NotFound": {
+			reason: "Approving a claim that doesn't exist should fail",
+			kube: &test.MockClient{
+				MockCreate: review("cool-token", all...),
+				MockGet:    test.NewMockGetFn(notFound),
+			},
+			method: http.MethodPost,
+			url:    url,
+			token:  "cool-token",
+			want:   http.StatusNotFound,
+		},
+		"Approved": {
+			reason: "The claim should be approved at its current generation by the authenticated user",
+			kube: &test.MockClient{
+				MockCreate: func(ctx context.Context, obj runtime.Object, opts ...client.CreateOption) error {
+					u, ok := obj.(*unstructured.Unstructured)
+					if !ok {
+						return review("cool-token", all...)(ctx, obj, opts...)
+					}
+					if diff := cmp.Diff(spec("cool-uid", 2, "cool-approver"), u.Object["spec"]); diff != "" {
+						t.Errorf("\nReason: %s\nCreate(...): -want, +got:\n%s", "The ClaimApproval should record the current generation and the authenticated user", diff)
+					}
+					if diff := cmp.Diff(Name(gvk.GroupKind(), types.NamespacedName{Namespace: "cool", Name: "db"}), u.GetName()); diff != "" {
+						t.Errorf("\nReason: %s\nCreate(...): -want, +got:\n%s", "The ClaimApproval should be named after the claim", diff)
+					}
+					return nil
+				},
+				MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+					u := obj.(*unstructured.Unstructured)
+					if u.GroupVersionKind() == GroupVersionKind {
+						return kerrors.NewNotFound(schema.GroupResource{Group: GroupVersionKind.Group, Resource: Resource}, "")
+					}
+					claim(2).DeepCopyInto(u)
+					return nil
+				},
+			},
+			method: http.MethodPost,
+			url:    url,
+			token:  "cool-token",
+			want:   http.StatusOK,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.url, nil)
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			w := httptest.NewRecorder()
+			NewHandler(tc.kube, "Database").ServeHTTP(w, req)
+			if diff := cmp.Diff(tc.want, w.Code); diff != "" {
+				t.Errorf("\nReason: %s\nh.ServeHTTP(...): -want status, +got status:\n%s\n%s", tc.reason, diff, w.Body.String())
+			}
+		})
+	}
+}
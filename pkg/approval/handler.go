@@ -0,0 +1,200 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package approval
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	errReviewToken  = "cannot review bearer token"
+	errReviewAccess = "cannot review access to ClaimApprovals"
+	errGetClaim     = "cannot get claim"
+
+	shutdownTimeout = 10 * time.Second
+)
+
+// NewHandler returns a new *Handler that approves the claims of the supplied
+// kinds with the supplied client.
+func NewHandler(kube client.Client, kinds ...string) *Handler {
+	h := &Handler{kube: kube, kinds: map[string]bool{}}
+	for _, k := range kinds {
+		h.kinds[k] = true
+	}
+	return h
+}
+
+// A Handler approves claims over HTTP. The callers are authenticated with
+// their Kubernetes bearer token and may only approve claims if they may
+// create ClaimApprovals, so the endpoint grants nothing that the callers
+// couldn't do with kubectl. It saves them from looking up the UID and the
+// generation of the claim, and records the caller as the approver.
+type Handler struct {
+	kube  client.Client
+	kinds map[string]bool
+}
+
+// ServeHTTP approves the claim that the apiVersion, kind, namespace and name
+// query parameters of a POST request identify at its current generation, on
+// behalf of the user that the bearer token of the request belongs to.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "claims are approved with POST requests", http.StatusMethodNotAllowed)
+		return
+	}
+	token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if token == "" || token == req.Header.Get("Authorization") {
+		http.Error(w, "a bearer token is required", http.StatusUnauthorized)
+		return
+	}
+	tr := &authenticationv1.TokenReview{Spec: authenticationv1.TokenReviewSpec{Token: token}}
+	if err := h.kube.Create(req.Context(), tr); err != nil {
+		http.Error(w, errors.Wrap(err, errReviewToken).Error(), http.StatusInternalServerError)
+		return
+	}
+	if !tr.Status.Authenticated {
+		http.Error(w, "the bearer token is not valid", http.StatusUnauthorized)
+		return
+	}
+	q := req.URL.Query()
+	for _, p := range []string{"apiVersion", "kind", "namespace", "name"} {
+		if q.Get(p) == "" {
+			http.Error(w, fmt.Sprintf("%s query parameter is required", p), http.StatusBadRequest)
+			return
+		}
+	}
+	if !h.kinds[q.Get("kind")] {
+		http.Error(w, fmt.Sprintf("claims of kind %s don't need approval", q.Get("kind")), http.StatusBadRequest)
+		return
+	}
+	gv, err := schema.ParseGroupVersion(q.Get("apiVersion"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	user := tr.Status.User
+	extra := map[string]authorizationv1.ExtraValue{}
+	for k, v := range user.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+	// The ClaimApproval is applied, i.e. read and then created or patched, so
+	// the user has to be allowed all of them.
+	for _, verb := range []string{"create", "get", "patch"} {
+		sar := &authorizationv1.SubjectAccessReview{Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   user.Username,
+			Groups: user.Groups,
+			UID:    user.UID,
+			Extra:  extra,
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Verb:     verb,
+				Group:    GroupVersionKind.Group,
+				Resource: Resource,
+			},
+		}}
+		if err := h.kube.Create(req.Context(), sar); err != nil {
+			http.Error(w, errors.Wrap(err, errReviewAccess).Error(), http.StatusInternalServerError)
+			return
+		}
+		if !sar.Status.Allowed {
+			http.Error(w, fmt.Sprintf("%s may not %s ClaimApprovals", user.Username, verb), http.StatusForbidden)
+			return
+		}
+	}
+	key := types.NamespacedName{Namespace: q.Get("namespace"), Name: q.Get("name")}
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(gv.WithKind(q.Get("kind")))
+	err = h.kube.Get(req.Context(), key, u)
+	switch {
+	case kerrors.IsNotFound(err):
+		http.Error(w, errors.Wrap(err, errGetClaim).Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, errors.Wrap(err, errGetClaim).Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := Approve(req.Context(), h.kube, u, user.Username); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(w, "%s %s approved at generation %d by %s\n", q.Get("kind"), key, u.GetGeneration(), user.Username)
+}
+
+// A ServerOption configures a Server.
+type ServerOption func(*Server)
+
+// WithTLS serves the approvals over TLS with the supplied certificate and key
+// files, so that the bearer tokens of the callers aren't sent in plain text.
+func WithTLS(certFile, keyFile string) ServerOption {
+	return func(s *Server) {
+		s.certFile = certFile
+		s.keyFile = keyFile
+	}
+}
+
+// NewServer returns a new *Server that serves the supplied handler at /approve
+// of the supplied address.
+func NewServer(address string, h http.Handler, opts ...ServerOption) *Server {
+	mux := http.NewServeMux()
+	mux.Handle("/approve", h)
+	s := &Server{srv: &http.Server{Addr: address, Handler: mux}}
+	for _, f := range opts {
+		f(s)
+	}
+	return s
+}
+
+// A Server serves claim approvals on their own address rather than the
+// metrics endpoint, which is often open to everyone in the cluster.
+type Server struct {
+	srv      *http.Server
+	certFile string
+	keyFile  string
+}
+
+// Start serves the approvals until the supplied channel is closed.
+func (s *Server) Start(stop <-chan struct{}) error {
+	errs := make(chan error, 1)
+	go func() {
+		if s.certFile != "" {
+			errs <- s.srv.ListenAndServeTLS(s.certFile, s.keyFile)
+			return
+		}
+		errs <- s.srv.ListenAndServe()
+	}()
+	select {
+	case err := <-errs:
+		return errors.Wrap(err, "cannot serve claim approvals")
+	case <-stop:
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		return s.srv.Shutdown(ctx)
+	}
+}
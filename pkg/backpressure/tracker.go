@@ -0,0 +1,180 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package backpressure helps the agent to back off from a saturated remote
+// cluster as a whole instead of every reconciler retrying on its own.
+package backpressure
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+
+	"github.com/crossplane/agent/pkg/metrics"
+)
+
+const (
+	defaultThreshold = 5
+	defaultWindow    = 1 * time.Minute
+	defaultFactor    = 4
+)
+
+// TrackerOption is used to configure *Tracker.
+type TrackerOption func(*Tracker)
+
+// WithThreshold specifies how many throttled requests within the window are
+// needed to start backing off.
+func WithThreshold(n int) TrackerOption {
+	return func(t *Tracker) {
+		t.threshold = n
+	}
+}
+
+// WithWindow specifies the duration in which the throttled requests are
+// counted.
+func WithWindow(d time.Duration) TrackerOption {
+	return func(t *Tracker) {
+		t.window = d
+	}
+}
+
+// WithFactor specifies the factor that the requeue intervals are multiplied
+// with while backing off.
+func WithFactor(f int) TrackerOption {
+	return func(t *Tracker) {
+		t.factor = f
+	}
+}
+
+// WithClock specifies the function that the Tracker should use to get the
+// current time.
+func WithClock(now func() time.Time) TrackerOption {
+	return func(t *Tracker) {
+		t.now = now
+	}
+}
+
+// WithLogger specifies how the Tracker should log messages.
+func WithLogger(l logging.Logger) TrackerOption {
+	return func(t *Tracker) {
+		t.log = l
+	}
+}
+
+// NewTracker returns a new *Tracker.
+func NewTracker(opts ...TrackerOption) *Tracker {
+	t := &Tracker{
+		threshold: defaultThreshold,
+		window:    defaultWindow,
+		factor:    defaultFactor,
+		now:       time.Now,
+		after:     func(d time.Duration, f func()) { time.AfterFunc(d, f) },
+		log:       logging.NewNopLogger(),
+	}
+	for _, f := range opts {
+		f(t)
+	}
+	return t
+}
+
+// Tracker keeps track of the requests that are rejected by the remote cluster
+// with 429 Too Many Requests. Once there are sustained rejections, it tells
+// its users to back off by scaling their requeue intervals. It's safe to share
+// a single Tracker between reconcilers.
+type Tracker struct {
+	threshold int
+	window    time.Duration
+	factor    int
+	now       func() time.Time
+	after     func(d time.Duration, f func())
+	log       logging.Logger
+
+	mu      sync.Mutex
+	hits    []time.Time
+	active  bool
+	recheck bool
+}
+
+// Observe records the supplied error if it indicates that the remote cluster
+// is saturated. It's a no-op for any other error.
+func (t *Tracker) Observe(err error) {
+	// The API errors are usually wrapped by the time they reach here and
+	// this version of apimachinery doesn't unwrap them.
+	if !kerrors.IsTooManyRequests(errors.Cause(err)) {
+		return
+	}
+	metrics.RemoteThrottledRequests.Inc()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.hits = append(t.hits, t.now())
+	t.update()
+}
+
+// Active returns whether the remote cluster is considered to be saturated.
+func (t *Tracker) Active() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.update()
+	return t.active
+}
+
+// Scale returns the supplied requeue interval multiplied by the backoff factor
+// if the remote cluster is considered to be saturated.
+func (t *Tracker) Scale(d time.Duration) time.Duration {
+	if !t.Active() {
+		return d
+	}
+	return d * time.Duration(t.factor)
+}
+
+// update drops the hits that are out of the window and recalculates whether
+// the backoff is active. While it's active, it's recalculated again once the
+// oldest hit is out of the window so that the recovery is recorded even if
+// nothing asks whether it's active anymore. The caller must hold the lock.
+func (t *Tracker) update() {
+	cutoff := t.now().Add(-t.window)
+	i := 0
+	for i < len(t.hits) && !t.hits[i].After(cutoff) {
+		i++
+	}
+	t.hits = t.hits[i:]
+
+	active := len(t.hits) >= t.threshold
+	if active && !t.recheck {
+		t.recheck = true
+		t.after(t.hits[0].Sub(cutoff), func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.recheck = false
+			t.update()
+		})
+	}
+	if active == t.active {
+		return
+	}
+	t.active = active
+	if active {
+		metrics.RemoteBackoffActive.Set(1)
+		t.log.Info("Remote cluster is saturated, backing off", "throttled-requests", len(t.hits), "window", t.window.String(), "factor", t.factor)
+		return
+	}
+	metrics.RemoteBackoffActive.Set(0)
+	t.log.Info("Remote cluster is no longer saturated, stopped backing off")
+}
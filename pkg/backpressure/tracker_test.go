@@ -0,0 +1,142 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backpressure
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/crossplane/agent/pkg/metrics"
+)
+
+var (
+	errBoom      = errors.New("boom")
+	errThrottled = errors.Wrap(kerrors.NewTooManyRequests("slow down", 1), "cannot patch object")
+)
+
+func TestTracker(t *testing.T) {
+	start := time.Now()
+	type args struct {
+		observe []error
+		elapsed time.Duration
+	}
+	type want struct {
+		active bool
+		scaled time.Duration
+	}
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"NoErrors": {
+			reason: "Backoff should not be active if nothing is observed",
+			want: want{
+				scaled: time.Second,
+			},
+		},
+		"OtherErrors": {
+			reason: "Errors other than 429 should not count towards the threshold",
+			args: args{
+				observe: []error{errBoom, errBoom, errBoom},
+			},
+			want: want{
+				scaled: time.Second,
+			},
+		},
+		"BelowThreshold": {
+			reason: "Backoff should not be active if throttled requests are below the threshold",
+			args: args{
+				observe: []error{errThrottled, errThrottled},
+			},
+			want: want{
+				scaled: time.Second,
+			},
+		},
+		"Saturated": {
+			reason: "Backoff should be active if throttled requests reach the threshold within the window",
+			args: args{
+				observe: []error{errThrottled, errBoom, errThrottled, errThrottled},
+			},
+			want: want{
+				active: true,
+				scaled: 2 * time.Second,
+			},
+		},
+		"Recovered": {
+			reason: "Backoff should not be active once the throttled requests are out of the window",
+			args: args{
+				observe: []error{errThrottled, errThrottled, errThrottled},
+				elapsed: 2 * time.Minute,
+			},
+			want: want{
+				scaled: time.Second,
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			now := start
+			tr := NewTracker(WithThreshold(3), WithFactor(2), WithClock(func() time.Time { return now }))
+			for _, err := range tc.args.observe {
+				tr.Observe(err)
+			}
+			now = now.Add(tc.args.elapsed)
+
+			if diff := cmp.Diff(tc.want.active, tr.Active()); diff != "" {
+				t.Errorf("\nReason: %s\ntr.Active(): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.scaled, tr.Scale(time.Second)); diff != "" {
+				t.Errorf("\nReason: %s\ntr.Scale(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestTrackerGauge(t *testing.T) {
+	now := time.Now()
+	var recheck func()
+	tr := NewTracker(WithThreshold(2), WithClock(func() time.Time { return now }))
+	tr.after = func(d time.Duration, f func()) {
+		if diff := cmp.Diff(time.Minute, d); diff != "" {
+			t.Errorf("\nThe backoff should be recalculated once the oldest throttled request is out of the window: -want, +got:\n%s", diff)
+		}
+		recheck = f
+	}
+
+	tr.Observe(errThrottled)
+	tr.Observe(errThrottled)
+	if diff := cmp.Diff(float64(1), testutil.ToFloat64(metrics.RemoteBackoffActive)); diff != "" {
+		t.Errorf("\nThe gauge should be set once the backoff is active: -want, +got:\n%s", diff)
+	}
+
+	// Nothing asks whether the backoff is active after the throttled requests
+	// are out of the window.
+	now = now.Add(time.Minute)
+	if recheck == nil {
+		t.Fatal("\nA recalculation should be scheduled while the backoff is active")
+	}
+	recheck()
+	if diff := cmp.Diff(float64(0), testutil.ToFloat64(metrics.RemoteBackoffActive)); diff != "" {
+		t.Errorf("\nThe gauge should be reset once the backoff is no longer active: -want, +got:\n%s", diff)
+	}
+}
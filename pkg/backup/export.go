@@ -0,0 +1,198 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package backup exports the state the agent manages in a cluster, e.g. for
+// disaster recovery or to move the agent to a replacement cluster.
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"io"
+	"path"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
+
+	"github.com/crossplane/agent/pkg/controllers/claim"
+	"github.com/crossplane/agent/pkg/resource"
+)
+
+// MappingsFile is the name of the file in the bundle that lists the remote
+// counterparts of the exported claims.
+const MappingsFile = "mappings.yaml"
+
+const (
+	errFmtList      = "cannot list objects of kind %s"
+	errFmtMarshal   = "cannot marshal %s"
+	errFmtWrite     = "cannot write %s to bundle"
+	errConvertXRD   = "cannot convert composite resource definition"
+	errCloseArchive = "cannot close bundle"
+)
+
+// ExporterOption is used to configure *Exporter.
+type ExporterOption func(*Exporter)
+
+// WithExportRemoteNamespace specifies the namespace in the remote cluster that
+// the agent creates all claims in, i.e. its --remote-namespace, so that the
+// remote counterparts of the claims are recorded correctly.
+func WithExportRemoteNamespace(ns string) ExporterOption {
+	return func(e *Exporter) {
+		if ns != "" {
+			e.mapper = claim.NewNamespaceKeyMapper(ns)
+		}
+	}
+}
+
+// NewExporter returns a new *Exporter that reads the objects with the
+// supplied client of the local cluster.
+func NewExporter(kube client.Reader, opts ...ExporterOption) *Exporter {
+	e := &Exporter{kube: kube, mapper: claim.NewIdentityKeyMapper()}
+	for _, f := range opts {
+		f(e)
+	}
+	return e
+}
+
+// Exporter writes the CompositeResourceDefinitions, Compositions and claims
+// in the local cluster to a gzipped tarball of YAML files, one per object,
+// along with the keys of the remote counterparts of the claims. The objects
+// are written without their cluster-specific metadata so that they can be
+// applied to another cluster as they are.
+type Exporter struct {
+	kube   client.Reader
+	mapper claim.KeyMapper
+}
+
+// A Mapping is the key of a local claim and the key of its remote
+// counterpart.
+type Mapping struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Local      string `json:"local"`
+	Remote     string `json:"remote"`
+}
+
+// An Export is the result of an export.
+type Export struct {
+	// Objects is the number of exported objects.
+	Objects int
+
+	// Mappings are the keys of the exported claims and of their remote
+	// counterparts.
+	Mappings []Mapping
+}
+
+// Export writes the bundle to the supplied writer.
+func (e *Exporter) Export(ctx context.Context, w io.Writer) (*Export, error) {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	result := &Export{}
+	now := time.Now()
+
+	xrds, err := e.list(ctx, v1alpha1.CompositeResourceDefinitionGroupVersionKind)
+	if err != nil {
+		return result, err
+	}
+	comps, err := e.list(ctx, v1alpha1.CompositionGroupVersionKind)
+	if err != nil {
+		return result, err
+	}
+	objs := append(xrds, comps...)
+	for i := range xrds {
+		xrd := &v1alpha1.CompositeResourceDefinition{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(xrds[i].UnstructuredContent(), xrd); err != nil {
+			return result, errors.Wrap(err, errConvertXRD)
+		}
+		if !xrd.OffersClaim() {
+			continue
+		}
+		gvk := xrd.GetClaimGroupVersionKind()
+		claims, err := e.list(ctx, gvk)
+		if err != nil {
+			return result, err
+		}
+		for _, c := range claims {
+			result.Mappings = append(result.Mappings, Mapping{
+				APIVersion: c.GetAPIVersion(),
+				Kind:       c.GetKind(),
+				Local:      types.NamespacedName{Namespace: c.GetNamespace(), Name: c.GetName()}.String(),
+				Remote:     claim.RemoteKeyOf(e.mapper, &c).String(),
+			})
+		}
+		objs = append(objs, claims...)
+	}
+
+	for i := range objs {
+		o := resource.SanitizedDeepCopyObject(&objs[i])
+		data, err := yaml.Marshal(o)
+		if err != nil {
+			return result, errors.Wrapf(err, errFmtMarshal, fileName(&objs[i]))
+		}
+		if err := writeFile(tw, fileName(&objs[i]), data, now); err != nil {
+			return result, err
+		}
+		result.Objects++
+	}
+	data, err := yaml.Marshal(result.Mappings)
+	if err != nil {
+		return result, errors.Wrapf(err, errFmtMarshal, MappingsFile)
+	}
+	if err := writeFile(tw, MappingsFile, data, now); err != nil {
+		return result, err
+	}
+	if err := tw.Close(); err != nil {
+		return result, errors.Wrap(err, errCloseArchive)
+	}
+	return result, errors.Wrap(gz.Close(), errCloseArchive)
+}
+
+func (e *Exporter) list(ctx context.Context, gvk schema.GroupVersionKind) ([]unstructured.Unstructured, error) {
+	l := &unstructured.UnstructuredList{}
+	l.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+	if err := e.kube.List(ctx, l); err != nil {
+		return nil, errors.Wrapf(err, errFmtList, gvk.Kind)
+	}
+	for i := range l.Items {
+		l.Items[i].SetGroupVersionKind(gvk)
+	}
+	return l.Items, nil
+}
+
+// fileName returns the path of the supplied object in the bundle, which is
+// <group>/<kind>/[<namespace>/]<name>.yaml.
+func fileName(o *unstructured.Unstructured) string {
+	gvk := o.GroupVersionKind()
+	return path.Join(gvk.Group, gvk.Kind, o.GetNamespace(), o.GetName()+".yaml")
+}
+
+func writeFile(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	h := &tar.Header{Name: name, Mode: 0600, Size: int64(len(data)), ModTime: modTime}
+	if err := tw.WriteHeader(h); err != nil {
+		return errors.Wrapf(err, errFmtWrite, name)
+	}
+	_, err := tw.Write(data)
+	return errors.Wrapf(err, errFmtWrite, name)
+}
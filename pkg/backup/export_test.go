@@ -0,0 +1,148 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	crds "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
+)
+
+var errBoom = errors.New("boom")
+
+func TestExport(t *testing.T) {
+	xrd := &v1alpha1.CompositeResourceDefinition{
+		Spec: v1alpha1.CompositeResourceDefinitionSpec{
+			ClaimNames: &crds.CustomResourceDefinitionNames{Kind: "Database"},
+			CRDSpecTemplate: v1alpha1.CRDSpecTemplate{
+				Group:   "example.org",
+				Version: "v1alpha1",
+			},
+		},
+	}
+	xrd.SetName("databases.example.org")
+	list := func(_ context.Context, obj runtime.Object, _ ...client.ListOption) error {
+		l := obj.(*unstructured.UnstructuredList)
+		switch l.GetKind() {
+		case v1alpha1.CompositeResourceDefinitionKind + "List":
+			content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(xrd)
+			if err != nil {
+				return err
+			}
+			l.Items = []unstructured.Unstructured{{Object: content}}
+		case "DatabaseList":
+			u := unstructured.Unstructured{}
+			u.SetNamespace("app-ns")
+			u.SetName("db")
+			u.SetUID("some-uid")
+			u.SetResourceVersion("42")
+			l.Items = []unstructured.Unstructured{u}
+		}
+		return nil
+	}
+	type want struct {
+		export *Export
+		files  []string
+		err    error
+	}
+	cases := map[string]struct {
+		reason string
+		kube   client.Reader
+		opts   []ExporterOption
+		want   want
+	}{
+		"ListFailed": {
+			reason: "Errors while listing objects should be returned",
+			kube:   &test.MockClient{MockList: test.NewMockListFn(errBoom)},
+			want: want{
+				export: &Export{},
+				err:    errors.Wrapf(errBoom, errFmtList, v1alpha1.CompositeResourceDefinitionKind),
+			},
+		},
+		"Exported": {
+			reason: "The definitions, compositions and claims should be written along with the remote keys of the claims",
+			kube:   &test.MockClient{MockList: list},
+			opts:   []ExporterOption{WithExportRemoteNamespace("remote-ns")},
+			want: want{
+				export: &Export{
+					Objects: 2,
+					Mappings: []Mapping{{
+						APIVersion: "example.org/v1alpha1",
+						Kind:       "Database",
+						Local:      "app-ns/db",
+						Remote:     "remote-ns/app-ns.db",
+					}},
+				},
+				files: []string{
+					"apiextensions.crossplane.io/CompositeResourceDefinition/databases.example.org.yaml",
+					"example.org/Database/app-ns/db.yaml",
+					MappingsFile,
+				},
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			got, err := NewExporter(tc.kube, tc.opts...).Export(context.Background(), buf)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\nExport(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.export, got); diff != "" {
+				t.Errorf("\nReason: %s\nExport(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tc.want.files, files(t, buf)); diff != "" {
+				t.Errorf("\nReason: %s\nExport(...): -want files, +got files:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func files(t *testing.T, r io.Reader) []string {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	var names []string
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return names
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, h.Name)
+	}
+}
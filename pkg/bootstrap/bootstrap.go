@@ -0,0 +1,202 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package bootstrap registers a cluster with the remote cluster so that an
+// agent running in it can sync with the remote cluster.
+package bootstrap
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	runtimeresource "github.com/crossplane/crossplane-runtime/pkg/resource"
+
+	"github.com/crossplane/agent/pkg/kubeconfig"
+	"github.com/crossplane/agent/pkg/rbac"
+	"github.com/crossplane/agent/pkg/resource"
+)
+
+// LabelKeyCluster is the key of the label that holds the name of the cluster
+// that an object is created for during registration.
+const LabelKeyCluster = resource.LabelKeyCluster
+
+// DefaultKubeconfigSecret is the Secret in the local cluster that the
+// kubeconfig of the registered ServiceAccount is written to by default.
+var DefaultKubeconfigSecret = types.NamespacedName{Namespace: "crossplane-system", Name: "crossplane-agent-remote-kubeconfig"}
+
+const (
+	serviceAccountName = "crossplane-agent"
+	tokenSecretName    = "crossplane-agent-token"
+
+	defaultPollInterval = 1 * time.Second
+	defaultTimeout      = 1 * time.Minute
+
+	errApply    = "cannot apply registration object"
+	errGetToken = "cannot get service account token"
+)
+
+// RegistrarOption is used to configure *Registrar.
+type RegistrarOption func(*Registrar)
+
+// WithNamespace specifies the namespace in the remote cluster that the claims
+// of the cluster are created in. Defaults to crossplane-agent-<cluster>.
+func WithNamespace(ns string) RegistrarOption {
+	return func(r *Registrar) {
+		r.namespace = ns
+	}
+}
+
+// WithKubeconfigSecret specifies the Secret in the local cluster that the
+// kubeconfig should be written to.
+func WithKubeconfigSecret(nn types.NamespacedName) RegistrarOption {
+	return func(r *Registrar) {
+		r.secret = nn
+	}
+}
+
+// WithTokenTimeout specifies how often and for how long the Registrar should
+// wait for the token of the ServiceAccount to be issued.
+func WithTokenTimeout(interval, timeout time.Duration) RegistrarOption {
+	return func(r *Registrar) {
+		r.interval = interval
+		r.timeout = timeout
+	}
+}
+
+// NewRegistrar returns a new *Registrar that registers clusters using the
+// supplied client of an admin of the remote cluster. The API server of the
+// remote cluster is reachable at the supplied address.
+func NewRegistrar(kube client.Client, server string, opts ...RegistrarOption) *Registrar {
+	r := &Registrar{
+		kube:     kube,
+		apply:    runtimeresource.NewAPIPatchingApplicator(kube),
+		server:   server,
+		secret:   DefaultKubeconfigSecret,
+		interval: defaultPollInterval,
+		timeout:  defaultTimeout,
+	}
+	for _, f := range opts {
+		f(r)
+	}
+	return r
+}
+
+// Registrar creates the objects that an agent needs in the remote cluster.
+type Registrar struct {
+	kube      client.Client
+	apply     runtimeresource.Applicator
+	server    string
+	namespace string
+	secret    types.NamespacedName
+	interval  time.Duration
+	timeout   time.Duration
+}
+
+// A Registration is the result of registering a cluster.
+type Registration struct {
+	// Namespace in the remote cluster that the claims of the cluster should
+	// be created in.
+	Namespace string
+
+	// KubeconfigSecret holds the kubeconfig of the ServiceAccount that the
+	// agent should use. It's meant to be created in the local cluster.
+	KubeconfigSecret *corev1.Secret
+}
+
+// Register creates a namespace, a ServiceAccount and its permissions in the
+// remote cluster for the supplied cluster. All of them are labelled with the
+// name of the cluster. The ServiceAccount can read the definitions and
+// compositions across the cluster but it can write only in its namespace.
+func (r *Registrar) Register(ctx context.Context, cluster string) (*Registration, error) {
+	ns := r.namespace
+	if ns == "" {
+		ns = "crossplane-agent-" + cluster
+	}
+	labels := map[string]string{LabelKeyCluster: cluster}
+	clusterScoped := func(name string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: name, Labels: labels}
+	}
+	namespaced := func(name string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Namespace: ns, Name: name, Labels: labels}
+	}
+	subjects := []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Namespace: ns, Name: serviceAccountName}}
+	clusterRole := "crossplane-agent:" + cluster
+
+	for _, o := range []runtimeresource.Object{
+		&corev1.Namespace{ObjectMeta: clusterScoped(ns)},
+		&corev1.ServiceAccount{ObjectMeta: namespaced(serviceAccountName)},
+		&corev1.Secret{
+			ObjectMeta: func() metav1.ObjectMeta {
+				m := namespaced(tokenSecretName)
+				m.Annotations = map[string]string{corev1.ServiceAccountNameKey: serviceAccountName}
+				return m
+			}(),
+			Type: corev1.SecretTypeServiceAccountToken,
+		},
+		&rbacv1.ClusterRole{ObjectMeta: clusterScoped(clusterRole), Rules: rbac.PolicyRules(rbac.RemoteMode().Remote)},
+		&rbacv1.ClusterRoleBinding{
+			ObjectMeta: clusterScoped(clusterRole),
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: clusterRole},
+			Subjects:   subjects,
+		},
+		// The claim types are not known until they're published, so the
+		// ServiceAccount can write all types in its namespace.
+		&rbacv1.Role{
+			ObjectMeta: namespaced(serviceAccountName),
+			Rules:      []rbacv1.PolicyRule{{APIGroups: []string{rbacv1.APIGroupAll}, Resources: []string{rbacv1.ResourceAll}, Verbs: []string{rbacv1.VerbAll}}},
+		},
+		&rbacv1.RoleBinding{
+			ObjectMeta: namespaced(serviceAccountName),
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: serviceAccountName},
+			Subjects:   subjects,
+		},
+	} {
+		if err := r.apply.Apply(ctx, o); err != nil {
+			return nil, errors.Wrap(err, errApply)
+		}
+	}
+
+	token := &corev1.Secret{}
+	err := wait.PollImmediate(r.interval, r.timeout, func() (bool, error) {
+		if err := r.kube.Get(ctx, types.NamespacedName{Namespace: ns, Name: tokenSecretName}, token); err != nil {
+			return false, err
+		}
+		return len(token.Data[corev1.ServiceAccountTokenKey]) > 0, nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, errGetToken)
+	}
+	raw, err := kubeconfig.ForToken(cluster, r.server, token.Data[corev1.ServiceAccountRootCAKey], token.Data[corev1.ServiceAccountTokenKey])
+	if err != nil {
+		return nil, err
+	}
+	return &Registration{
+		Namespace: ns,
+		KubeconfigSecret: &corev1.Secret{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+			ObjectMeta: metav1.ObjectMeta{Namespace: r.secret.Namespace, Name: r.secret.Name, Labels: labels},
+			Data:       map[string][]byte{kubeconfig.DefaultKey: raw},
+		},
+	}, nil
+}
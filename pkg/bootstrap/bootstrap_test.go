@@ -0,0 +1,128 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/crossplane/agent/pkg/kubeconfig"
+)
+
+var errBoom = errors.New("boom")
+
+func TestRegister(t *testing.T) {
+	notFound := kerrors.NewNotFound(schema.GroupResource{}, "")
+	issued := func(_ context.Context, key client.ObjectKey, obj runtime.Object) error {
+		if s, ok := obj.(*corev1.Secret); ok && key.Name == tokenSecretName {
+			s.Data = map[string][]byte{
+				corev1.ServiceAccountTokenKey:  []byte("secret-token"),
+				corev1.ServiceAccountRootCAKey: []byte("ca"),
+			}
+			return nil
+		}
+		return notFound
+	}
+	raw, _ := kubeconfig.ForToken("cool", "https://central.example.org", []byte("ca"), []byte("secret-token"))
+
+	type args struct {
+		kube client.Client
+		opts []RegistrarOption
+	}
+	type want struct {
+		namespace string
+		secret    *corev1.Secret
+		err       error
+	}
+	cases := map[string]struct {
+		reason string
+		args
+		want
+	}{
+		"ApplyFailed": {
+			reason: "Errors while creating the registration objects should be returned",
+			args: args{
+				kube: &test.MockClient{MockGet: test.NewMockGetFn(notFound), MockCreate: test.NewMockCreateFn(errBoom)},
+			},
+			want: want{err: errors.Wrap(errors.Wrap(errBoom, "cannot create object"), errApply)},
+		},
+		"TokenNotIssued": {
+			reason: "An error should be returned if the token isn't issued in time",
+			args: args{
+				kube: &test.MockClient{MockGet: test.NewMockGetFn(nil), MockPatch: test.NewMockPatchFn(nil)},
+				opts: []RegistrarOption{WithTokenTimeout(time.Millisecond, 5*time.Millisecond)},
+			},
+			want: want{err: errors.Wrap(errors.New("timed out waiting for the condition"), errGetToken)},
+		},
+		"Success": {
+			reason: "The kubeconfig of the ServiceAccount should be returned in the Secret",
+			args: args{
+				kube: &test.MockClient{
+					MockGet: issued,
+					MockCreate: test.NewMockCreateFn(nil, func(obj runtime.Object) error {
+						if rb, ok := obj.(*rbacv1.RoleBinding); ok && rb.Subjects[0].Namespace != "cool-ns" {
+							return errors.New("the role binding should be in the namespace of the cluster")
+						}
+						return nil
+					}),
+					MockPatch: test.NewMockPatchFn(nil),
+				},
+				opts: []RegistrarOption{WithNamespace("cool-ns")},
+			},
+			want: want{
+				namespace: "cool-ns",
+				secret: func() *corev1.Secret {
+					s := &corev1.Secret{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"}, Data: map[string][]byte{kubeconfig.DefaultKey: raw}}
+					s.SetNamespace(DefaultKubeconfigSecret.Namespace)
+					s.SetName(DefaultKubeconfigSecret.Name)
+					s.SetLabels(map[string]string{LabelKeyCluster: "cool"})
+					return s
+				}(),
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := NewRegistrar(tc.args.kube, "https://central.example.org", tc.args.opts...).Register(context.Background(), "cool")
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\nRegister(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if got == nil {
+				got = &Registration{}
+			}
+			if diff := cmp.Diff(tc.want.namespace, got.Namespace); diff != "" {
+				t.Errorf("\nReason: %s\nRegister(...): -want namespace, +got namespace:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.secret, got.KubeconfigSecret); diff != "" {
+				t.Errorf("\nReason: %s\nRegister(...): -want secret, +got secret:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/pkg/meta"
+	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
+)
+
+// agentPrefix is the prefix of the finalizers and annotations that the agent
+// adds to the objects it writes.
+const agentPrefix = "agent.crossplane.io/"
+
+const (
+	errListXRDs      = "cannot list composite resource definitions"
+	errFmtListClaims = "cannot list claims of kind %s"
+	errFmtRelease    = "cannot release claim %s"
+	errFmtDelete     = "cannot delete claim %s"
+)
+
+// DeregistrarOption is used to configure *Deregistrar.
+type DeregistrarOption func(*Deregistrar)
+
+// WithDeregistrationNamespace specifies the namespace in the remote cluster
+// that the claims of the cluster are created in. Defaults to
+// crossplane-agent-<cluster>, like WithNamespace.
+func WithDeregistrationNamespace(ns string) DeregistrarOption {
+	return func(d *Deregistrar) {
+		d.namespace = ns
+	}
+}
+
+// WithClaimsDeleted specifies that the Deregistrar should delete the claims of
+// the cluster once they're released.
+func WithClaimsDeleted() DeregistrarOption {
+	return func(d *Deregistrar) {
+		d.delete = true
+	}
+}
+
+// NewDeregistrar returns a new *Deregistrar that deregisters clusters using
+// the supplied client of an admin of the remote cluster.
+func NewDeregistrar(kube client.Client, opts ...DeregistrarOption) *Deregistrar {
+	d := &Deregistrar{kube: kube}
+	for _, f := range opts {
+		f(d)
+	}
+	return d
+}
+
+// Deregistrar releases the claims of a cluster in the remote cluster once its
+// agent is uninstalled.
+type Deregistrar struct {
+	kube      client.Client
+	namespace string
+	delete    bool
+}
+
+// A Deregistration is the result of deregistering a cluster.
+type Deregistration struct {
+	// Released is the number of claims whose agent finalizers and annotations
+	// are removed.
+	Released int
+
+	// Deleted is the number of claims whose deletion is requested.
+	Deleted int
+}
+
+// Deregister removes the finalizers and annotations of the agent from the
+// claims of the supplied cluster in the remote cluster, and deletes them if
+// configured to. The claims of the cluster are the ones in its namespace and
+// the ones labelled with its name.
+func (d *Deregistrar) Deregister(ctx context.Context, cluster string) (*Deregistration, error) {
+	ns := d.namespace
+	if ns == "" {
+		ns = "crossplane-agent-" + cluster
+	}
+	xrds := &v1alpha1.CompositeResourceDefinitionList{}
+	if err := d.kube.List(ctx, xrds); err != nil {
+		return nil, errors.Wrap(err, errListXRDs)
+	}
+	result := &Deregistration{}
+	for _, xrd := range xrds.Items {
+		if !xrd.OffersClaim() {
+			continue
+		}
+		gvk := xrd.GetClaimGroupVersionKind()
+		claims := map[types.NamespacedName]*unstructured.Unstructured{}
+		for _, o := range []client.ListOption{client.InNamespace(ns), client.MatchingLabels{LabelKeyCluster: cluster}} {
+			l := &unstructured.UnstructuredList{}
+			l.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+			if err := d.kube.List(ctx, l, o); err != nil {
+				return result, errors.Wrapf(err, errFmtListClaims, gvk.Kind)
+			}
+			for i := range l.Items {
+				claims[types.NamespacedName{Namespace: l.Items[i].GetNamespace(), Name: l.Items[i].GetName()}] = &l.Items[i]
+			}
+		}
+		for nn, c := range claims {
+			if release(c) {
+				if err := d.kube.Update(ctx, c); client.IgnoreNotFound(err) != nil {
+					return result, errors.Wrapf(err, errFmtRelease, nn)
+				}
+				result.Released++
+			}
+			if !d.delete || meta.WasDeleted(c) {
+				continue
+			}
+			if err := d.kube.Delete(ctx, c); client.IgnoreNotFound(err) != nil {
+				return result, errors.Wrapf(err, errFmtDelete, nn)
+			}
+			result.Deleted++
+		}
+	}
+	return result, nil
+}
+
+// release removes the finalizers and annotations of the agent from the
+// supplied object and returns whether there were any.
+func release(o *unstructured.Unstructured) bool {
+	changed := false
+	var finalizers []string
+	for _, f := range o.GetFinalizers() {
+		if strings.HasPrefix(f, agentPrefix) {
+			changed = true
+			continue
+		}
+		finalizers = append(finalizers, f)
+	}
+	o.SetFinalizers(finalizers)
+	var keys []string
+	for k := range o.GetAnnotations() {
+		if strings.HasPrefix(k, agentPrefix) {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) > 0 {
+		meta.RemoveAnnotations(o, keys...)
+		changed = true
+	}
+	return changed
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	crds "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
+)
+
+func TestDeregister(t *testing.T) {
+	xrd := v1alpha1.CompositeResourceDefinition{
+		Spec: v1alpha1.CompositeResourceDefinitionSpec{
+			ClaimNames: &crds.CustomResourceDefinitionNames{Kind: "Database"},
+			CRDSpecTemplate: v1alpha1.CRDSpecTemplate{
+				Group:   "example.org",
+				Version: "v1alpha1",
+			},
+		},
+	}
+	list := func(_ context.Context, obj runtime.Object, _ ...client.ListOption) error {
+		switch l := obj.(type) {
+		case *v1alpha1.CompositeResourceDefinitionList:
+			l.Items = []v1alpha1.CompositeResourceDefinition{xrd}
+		case *unstructured.UnstructuredList:
+			u := unstructured.Unstructured{}
+			u.SetGroupVersionKind(xrd.GetClaimGroupVersionKind())
+			u.SetNamespace("crossplane-agent-cool")
+			u.SetName("db")
+			u.SetFinalizers([]string{"agent.crossplane.io/sync", "example.org/other"})
+			u.SetAnnotations(map[string]string{"agent.crossplane.io/sync-id": "abc", "example.org/other": "keep"})
+			l.Items = []unstructured.Unstructured{u}
+		}
+		return nil
+	}
+
+	type want struct {
+		d   *Deregistration
+		err error
+	}
+	cases := map[string]struct {
+		reason string
+		kube   client.Client
+		opts   []DeregistrarOption
+		want   want
+	}{
+		"ListXRDsFailed": {
+			reason: "Errors while listing the definitions should be returned",
+			kube:   &test.MockClient{MockList: test.NewMockListFn(errBoom)},
+			want:   want{err: errors.Wrap(errBoom, errListXRDs)},
+		},
+		"Released": {
+			reason: "Only the finalizers and annotations of the agent should be removed from the claims of the cluster",
+			kube: &test.MockClient{
+				MockList: list,
+				MockUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+					u := obj.(*unstructured.Unstructured)
+					if diff := cmp.Diff([]string{"example.org/other"}, u.GetFinalizers()); diff != "" {
+						t.Errorf("\nReason: %s\nUpdate(...): -want finalizers, +got:\n%s", "Only the finalizers of the agent should be removed", diff)
+					}
+					if diff := cmp.Diff(map[string]string{"example.org/other": "keep"}, u.GetAnnotations()); diff != "" {
+						t.Errorf("\nReason: %s\nUpdate(...): -want annotations, +got:\n%s", "Only the annotations of the agent should be removed", diff)
+					}
+					return nil
+				},
+			},
+			want: want{d: &Deregistration{Released: 1}},
+		},
+		"Deleted": {
+			reason: "The claims of the cluster should be deleted once they're released if configured to",
+			kube: &test.MockClient{
+				MockList:   list,
+				MockUpdate: test.NewMockUpdateFn(nil),
+				MockDelete: test.NewMockDeleteFn(nil),
+			},
+			opts: []DeregistrarOption{WithClaimsDeleted()},
+			want: want{d: &Deregistration{Released: 1, Deleted: 1}},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := NewDeregistrar(tc.kube, tc.opts...).Deregister(context.Background(), "cool")
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\nDeregister(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.d, got); diff != "" {
+				t.Errorf("\nReason: %s\nDeregister(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/pkg/meta"
+
+	"github.com/crossplane/agent/pkg/controllers/claim"
+)
+
+const (
+	errFmtGetRemoteClaim    = "cannot get remote claim %s"
+	errFmtCreateLocalClaim  = "cannot create local claim %s"
+	errFmtClaimDeleted      = "remote claim %s is being deleted"
+	errFmtClaimNamespace    = "remote claim %s is not in the remote namespace %s"
+	errFmtClaimName         = "the name of remote claim %s doesn't start with \"%s.\", the namespace of the local claim and a dot"
+	errFmtSecretName        = "the name of the connection secret of remote claim %s doesn't start with \"%s.\", the namespace of the local claim and a dot"
+	errNoImportNamespace    = "the namespace of the local claim has to be given when the claims are created in a single remote namespace"
+	annotationLastAppliedKC = "kubectl.kubernetes.io/last-applied-configuration"
+)
+
+// ImporterOption is used to configure *Importer.
+type ImporterOption func(*Importer)
+
+// WithImportRemoteNamespace specifies the namespace in the remote cluster that
+// the agent creates all claims in, i.e. its --remote-namespace. The remote
+// claims are named <local-namespace>.<local-name> in that case.
+func WithImportRemoteNamespace(ns string) ImporterOption {
+	return func(i *Importer) {
+		i.remoteNamespace = ns
+	}
+}
+
+// WithImportNamespace specifies the namespace of the local claims. It's
+// required with WithImportRemoteNamespace and the namespace of the remote
+// claim is used otherwise.
+func WithImportNamespace(ns string) ImporterOption {
+	return func(i *Importer) {
+		i.namespace = ns
+	}
+}
+
+// NewImporter returns a new *Importer that reads the remote claims with the
+// remote client and creates their local counterparts with the local one.
+func NewImporter(local, remote client.Client, opts ...ImporterOption) *Importer {
+	i := &Importer{local: local, remote: remote}
+	for _, f := range opts {
+		f(i)
+	}
+	return i
+}
+
+// Importer creates local claims for the claims that already exist in the
+// remote cluster, e.g. to migrate workloads that were provisioned in the
+// central cluster to an application cluster. The local claim has the key that
+// the agent maps to the remote claim, so the agent takes the remote claim
+// over once the local claim is synced.
+type Importer struct {
+	local           client.Client
+	remote          client.Client
+	remoteNamespace string
+	namespace       string
+}
+
+// Import creates the local counterpart of the remote claim of the supplied
+// kind with the supplied key and returns it. The local claim gets the spec,
+// labels and annotations of the remote claim, except the ones of the agent.
+func (i *Importer) Import(ctx context.Context, gvk schema.GroupVersionKind, remote types.NamespacedName) (*unstructured.Unstructured, error) {
+	rc := &unstructured.Unstructured{}
+	rc.SetGroupVersionKind(gvk)
+	if err := i.remote.Get(ctx, remote, rc); err != nil {
+		return nil, errors.Wrapf(err, errFmtGetRemoteClaim, remote)
+	}
+	if meta.WasDeleted(rc) {
+		return nil, errors.Errorf(errFmtClaimDeleted, remote)
+	}
+	local, err := i.localKey(remote)
+	if err != nil {
+		return nil, err
+	}
+	lc := &unstructured.Unstructured{}
+	lc.SetGroupVersionKind(gvk)
+	lc.SetNamespace(local.Namespace)
+	lc.SetName(local.Name)
+	lc.SetLabels(withoutAgentKeys(rc.GetLabels()))
+	lc.SetAnnotations(withoutAgentKeys(rc.GetAnnotations(), annotationLastAppliedKC))
+	if spec, ok := rc.Object["spec"]; ok {
+		lc.Object["spec"] = spec
+	}
+	// The connection secret of the remote claim is named the way the agent
+	// maps the name of the local one, so it needs to be mapped back.
+	name, found, err := unstructured.NestedString(lc.Object, "spec", "writeConnectionSecretToRef", "name")
+	if err != nil {
+		return nil, err
+	}
+	if found && i.remoteNamespace != "" {
+		ln, ok := claim.LocalNameOf(local.Namespace, name)
+		if !ok {
+			return nil, errors.Errorf(errFmtSecretName, remote, local.Namespace)
+		}
+		if err := unstructured.SetNestedField(lc.Object, ln, "spec", "writeConnectionSecretToRef", "name"); err != nil {
+			return nil, err
+		}
+	}
+	if err := i.local.Create(ctx, lc); err != nil {
+		return nil, errors.Wrapf(err, errFmtCreateLocalClaim, local)
+	}
+	return lc, nil
+}
+
+// localKey returns the key of the local claim that the agent maps to the
+// supplied key of a remote claim.
+func (i *Importer) localKey(remote types.NamespacedName) (types.NamespacedName, error) {
+	if i.remoteNamespace == "" {
+		return remote, nil
+	}
+	if remote.Namespace != i.remoteNamespace {
+		return types.NamespacedName{}, errors.Errorf(errFmtClaimNamespace, remote, i.remoteNamespace)
+	}
+	if i.namespace == "" {
+		return types.NamespacedName{}, errors.New(errNoImportNamespace)
+	}
+	name, ok := claim.LocalNameOf(i.namespace, remote.Name)
+	if !ok {
+		return types.NamespacedName{}, errors.Errorf(errFmtClaimName, remote, i.namespace)
+	}
+	return types.NamespacedName{Namespace: i.namespace, Name: name}, nil
+}
+
+// withoutAgentKeys returns the supplied labels or annotations without the ones
+// of the agent and the supplied keys.
+func withoutAgentKeys(in map[string]string, keys ...string) map[string]string {
+	skip := map[string]bool{}
+	for _, k := range keys {
+		skip[k] = true
+	}
+	out := map[string]string{}
+	for k, v := range in {
+		if strings.HasPrefix(k, agentPrefix) || skip[k] {
+			continue
+		}
+		out[k] = v
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+)
+
+func TestImport(t *testing.T) {
+	gvk := schema.GroupVersionKind{Group: "example.org", Version: "v1alpha1", Kind: "Database"}
+	now := metav1.Now()
+	remoteClaim := func(name string, deleted bool) test.MockGetFn {
+		return test.NewMockGetFn(nil, func(obj runtime.Object) error {
+			u := obj.(*unstructured.Unstructured)
+			u.SetNamespace("remote-ns")
+			u.SetName(name)
+			u.SetLabels(map[string]string{LabelKeyCluster: "cool", "team": "a"})
+			u.SetAnnotations(map[string]string{"agent.crossplane.io/sync-id": "abc", annotationLastAppliedKC: "{}"})
+			if deleted {
+				u.SetDeletionTimestamp(&now)
+			}
+			u.Object["spec"] = map[string]interface{}{
+				"parameters":                 map[string]interface{}{"size": int64(20)},
+				"writeConnectionSecretToRef": map[string]interface{}{"name": "app-ns.db-conn"},
+			}
+			return nil
+		})
+	}
+	type args struct {
+		remote client.Client
+		opts   []ImporterOption
+		key    types.NamespacedName
+	}
+	type want struct {
+		local *unstructured.Unstructured
+		err   error
+	}
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"GetFailed": {
+			reason: "Errors while getting the remote claim should be returned",
+			args: args{
+				remote: &test.MockClient{MockGet: test.NewMockGetFn(errBoom)},
+				key:    types.NamespacedName{Namespace: "remote-ns", Name: "db"},
+			},
+			want: want{err: errors.Wrapf(errBoom, errFmtGetRemoteClaim, types.NamespacedName{Namespace: "remote-ns", Name: "db"})},
+		},
+		"Deleted": {
+			reason: "Remote claims that are being deleted shouldn't be imported",
+			args: args{
+				remote: &test.MockClient{MockGet: remoteClaim("db", true)},
+				key:    types.NamespacedName{Namespace: "remote-ns", Name: "db"},
+			},
+			want: want{err: errors.Errorf(errFmtClaimDeleted, types.NamespacedName{Namespace: "remote-ns", Name: "db"})},
+		},
+		"NameMismatch": {
+			reason: "Remote claims that aren't named the way the agent maps the local ones shouldn't be imported",
+			args: args{
+				remote: &test.MockClient{MockGet: remoteClaim("db", false)},
+				opts:   []ImporterOption{WithImportRemoteNamespace("remote-ns"), WithImportNamespace("app-ns")},
+				key:    types.NamespacedName{Namespace: "remote-ns", Name: "db"},
+			},
+			want: want{err: errors.Errorf(errFmtClaimName, types.NamespacedName{Namespace: "remote-ns", Name: "db"}, "app-ns")},
+		},
+		"RemoteNamespace": {
+			reason: "The names of the claim and its connection secret should be mapped back into the local namespace",
+			args: args{
+				remote: &test.MockClient{MockGet: remoteClaim("app-ns.db", false)},
+				opts:   []ImporterOption{WithImportRemoteNamespace("remote-ns"), WithImportNamespace("app-ns")},
+				key:    types.NamespacedName{Namespace: "remote-ns", Name: "app-ns.db"},
+			},
+			want: want{local: &unstructured.Unstructured{Object: map[string]interface{}{
+				"apiVersion": "example.org/v1alpha1",
+				"kind":       "Database",
+				"metadata": map[string]interface{}{
+					"namespace": "app-ns",
+					"name":      "db",
+					"labels":    map[string]interface{}{"team": "a"},
+				},
+				"spec": map[string]interface{}{
+					"parameters":                 map[string]interface{}{"size": int64(20)},
+					"writeConnectionSecretToRef": map[string]interface{}{"name": "db-conn"},
+				},
+			}}},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			local := &test.MockClient{MockCreate: test.NewMockCreateFn(nil)}
+			got, err := NewImporter(local, tc.args.remote, tc.args.opts...).Import(context.Background(), gvk, tc.args.key)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\nImport(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.local, got); diff != "" {
+				t.Errorf("\nReason: %s\nImport(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
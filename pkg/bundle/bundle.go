@@ -0,0 +1,130 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package bundle manages the SyncedBundle that the objects synced from the
+// remote cluster can be owned by in the local cluster. The owners of the
+// remote objects, e.g. the Configuration packages of Compositions, don't exist
+// in the local cluster, so the bundle takes their place and deleting it
+// deletes all synced objects at once.
+package bundle
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/agent/pkg/resource"
+)
+
+const (
+	errEnsureCRD       = "cannot ensure SyncedBundle CustomResourceDefinition"
+	errGetBundle       = "cannot get SyncedBundle"
+	errCreateBundle    = "cannot create SyncedBundle"
+	defaultEstablished = 1 * time.Minute
+)
+
+// CRDName is the name of the CustomResourceDefinition of SyncedBundles.
+const CRDName = "syncedbundles.agent.crossplane.io"
+
+// GroupVersionKind of SyncedBundles.
+var GroupVersionKind = schema.GroupVersionKind{Group: "agent.crossplane.io", Version: "v1alpha1", Kind: "SyncedBundle"}
+
+// CRD returns the CustomResourceDefinition of SyncedBundles. They're cluster
+// scoped so that they can own the cluster scoped synced objects, and have no
+// fields of their own.
+func CRD() *v1beta1.CustomResourceDefinition {
+	preserve := false
+	return &v1beta1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: CRDName},
+		Spec: v1beta1.CustomResourceDefinitionSpec{
+			Group: GroupVersionKind.Group,
+			Names: v1beta1.CustomResourceDefinitionNames{
+				Kind:     GroupVersionKind.Kind,
+				ListKind: GroupVersionKind.Kind + "List",
+				Plural:   "syncedbundles",
+				Singular: "syncedbundle",
+			},
+			Scope:                 v1beta1.ClusterScoped,
+			PreserveUnknownFields: &preserve,
+			Versions: []v1beta1.CustomResourceDefinitionVersion{{
+				Name:    GroupVersionKind.Version,
+				Served:  true,
+				Storage: true,
+			}},
+			Validation: &v1beta1.CustomResourceValidation{
+				OpenAPIV3Schema: &v1beta1.JSONSchemaProps{Type: "object"},
+			},
+		},
+	}
+}
+
+// Ensure creates the SyncedBundle with the supplied name, and its
+// CustomResourceDefinition, if they don't exist and returns the owner
+// reference that the synced objects should have to be owned by it. The
+// reference is only valid until the bundle is recreated, see Owner.
+func Ensure(ctx context.Context, kube client.Client, name string) (metav1.OwnerReference, error) {
+	if err := resource.EnsureCRD(ctx, kube, CRD(), defaultEstablished); err != nil {
+		return metav1.OwnerReference{}, resource.LocalError(err, errEnsureCRD)
+	}
+	return owner(ctx, kube, name)
+}
+
+// Owner returns a function that returns the owner reference of the
+// SyncedBundle with the supplied name, creating it if it doesn't exist, e.g.
+// because it was deleted to delete the synced objects. It reads the bundle
+// every time it's called so that the UID of the reference is the one of the
+// current bundle.
+func Owner(kube client.Client, name string) func(ctx context.Context) (metav1.OwnerReference, error) {
+	return func(ctx context.Context) (metav1.OwnerReference, error) {
+		return owner(ctx, kube, name)
+	}
+}
+
+func owner(ctx context.Context, kube client.Client, name string) (metav1.OwnerReference, error) {
+	b := &unstructured.Unstructured{}
+	b.SetGroupVersionKind(GroupVersionKind)
+	err := kube.Get(ctx, types.NamespacedName{Name: name}, b)
+	if kerrors.IsNotFound(err) {
+		b.SetName(name)
+		if err := kube.Create(ctx, b); err != nil {
+			return metav1.OwnerReference{}, resource.LocalError(err, errCreateBundle)
+		}
+		return OwnerReference(b), nil
+	}
+	if err != nil {
+		return metav1.OwnerReference{}, resource.LocalError(err, errGetBundle)
+	}
+	return OwnerReference(b), nil
+}
+
+// OwnerReference returns the owner reference of the supplied SyncedBundle.
+// It's not a controller reference since the synced objects are controlled by
+// the agent, and it doesn't block the deletion of the bundle.
+func OwnerReference(b metav1.Object) metav1.OwnerReference {
+	return metav1.OwnerReference{
+		APIVersion: GroupVersionKind.GroupVersion().String(),
+		Kind:       GroupVersionKind.Kind,
+		Name:       b.GetName(),
+		UID:        b.GetUID(),
+	}
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/crossplane/agent/pkg/resource"
+)
+
+func TestEnsure(t *testing.T) {
+	errBoom := errors.New("boom")
+	// getCRD returns an established CRD and calls fn for the bundle.
+	getCRD := func(fn func(obj runtime.Object) error) test.MockGetFn {
+		return func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+			if crd, ok := obj.(*v1beta1.CustomResourceDefinition); ok {
+				crd.Status.Conditions = []v1beta1.CustomResourceDefinitionCondition{{Type: v1beta1.Established, Status: v1beta1.ConditionTrue}}
+				return nil
+			}
+			return fn(obj)
+		}
+	}
+	type want struct {
+		ref metav1.OwnerReference
+		err error
+	}
+	cases := map[string]struct {
+		reason string
+		kube   client.Client
+		want   want
+	}{
+		"ApplyCRDFailed": {
+			reason: "An error should be returned if the CRD of SyncedBundles cannot be applied",
+			kube:   &test.MockClient{MockGet: test.NewMockGetFn(errBoom)},
+			want:   want{err: resource.LocalError(errors.Wrap(errors.Wrap(errBoom, "cannot get custom resource definition"), "cannot apply custom resource definition"), errEnsureCRD)},
+		},
+		"Existing": {
+			reason: "The owner reference of the existing SyncedBundle should be returned",
+			kube: &test.MockClient{
+				MockGet: getCRD(func(obj runtime.Object) error {
+					obj.(metav1.Object).SetName("platform")
+					obj.(metav1.Object).SetUID("bundle-uid")
+					return nil
+				}),
+				MockUpdate: test.NewMockUpdateFn(nil),
+			},
+			want: want{ref: metav1.OwnerReference{APIVersion: "agent.crossplane.io/v1alpha1", Kind: "SyncedBundle", Name: "platform", UID: "bundle-uid"}},
+		},
+		"Created": {
+			reason: "The SyncedBundle should be created if it doesn't exist",
+			kube: &test.MockClient{
+				MockGet: getCRD(func(obj runtime.Object) error {
+					return kerrors.NewNotFound(schema.GroupResource{}, "")
+				}),
+				MockUpdate: test.NewMockUpdateFn(nil),
+				MockCreate: func(_ context.Context, obj runtime.Object, _ ...client.CreateOption) error {
+					obj.(metav1.Object).SetUID("bundle-uid")
+					return nil
+				},
+			},
+			want: want{ref: metav1.OwnerReference{APIVersion: "agent.crossplane.io/v1alpha1", Kind: "SyncedBundle", Name: "platform", UID: "bundle-uid"}},
+		},
+		"CreateFailed": {
+			reason: "An error should be returned if the SyncedBundle cannot be created",
+			kube: &test.MockClient{
+				MockGet: getCRD(func(obj runtime.Object) error {
+					return kerrors.NewNotFound(schema.GroupResource{}, "")
+				}),
+				MockUpdate: test.NewMockUpdateFn(nil),
+				MockCreate: test.NewMockCreateFn(errBoom),
+			},
+			want: want{err: resource.LocalError(errBoom, errCreateBundle)},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			ref, err := Ensure(context.Background(), tc.kube, "platform")
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\nEnsure(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.ref, ref); diff != "" {
+				t.Errorf("\nReason: %s\nEnsure(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestOwner(t *testing.T) {
+	uid := "old-uid"
+	kube := &test.MockClient{
+		MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+			obj.(metav1.Object).SetName("platform")
+			obj.(metav1.Object).SetUID(types.UID(uid))
+			return nil
+		},
+	}
+	owner := Owner(kube, "platform")
+	for _, want := range []string{"old-uid", "new-uid"} {
+		uid = want
+		ref, err := owner(context.Background())
+		if err != nil {
+			t.Fatalf("\nReason: %s\nOwner(...): %s", "The owner reference should be returned", err)
+		}
+		if diff := cmp.Diff(types.UID(want), ref.UID); diff != "" {
+			t.Errorf("\nReason: %s\nOwner(...): -want, +got:\n%s", "The owner reference should have the UID of the current SyncedBundle", diff)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package claims is a client for the application developers to create and
+// use the claims of the kinds that the agent publishes in their cluster from
+// Go code. The claim kinds are only known at runtime, so the claims are
+// unstructured.
+package claims
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
+	"github.com/crossplane/crossplane-runtime/pkg/meta"
+	"github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/claim"
+
+	claimctrl "github.com/crossplane/agent/pkg/controllers/claim"
+	"github.com/crossplane/agent/pkg/encryption"
+	"github.com/crossplane/agent/pkg/resource"
+)
+
+const (
+	defaultPollInterval = 5 * time.Second
+
+	errCreateClaim        = "cannot create claim"
+	errGetClaim           = "cannot get claim"
+	errSetParameters      = "cannot set parameters of claim"
+	errSetComposition     = "cannot set composition selector of claim"
+	errWaitReady          = "claim did not become ready"
+	errNoSecretRef        = "claim has no writeConnectionSecretToRef"
+	errGetSecret          = "cannot get connection secret"
+	errNoSecretYet        = "connection secret of claim is not synced yet"
+	errEncrypted          = "connection secret is encrypted, a Decrypter is needed to read it"
+	errDecryptSecret      = "cannot decrypt connection secret"
+	fieldCompositionLabel = "spec.compositionSelector.matchLabels"
+)
+
+// A Decrypter decrypts the connection secrets that the agent encrypted with
+// --connection-secret-encryption-key-file, e.g. *encryption.Envelope.
+type Decrypter interface {
+	Decrypt(s *corev1.Secret) error
+}
+
+// Option is used to configure *Client.
+type Option func(*Client)
+
+// WithPollInterval specifies how often the Client should check whether a
+// claim is ready while waiting for it.
+func WithPollInterval(d time.Duration) Option {
+	return func(c *Client) {
+		c.interval = d
+	}
+}
+
+// WithDecrypter specifies how the Client should decrypt the connection
+// secrets of the claims if they're encrypted.
+func WithDecrypter(d Decrypter) Option {
+	return func(c *Client) {
+		c.decrypter = d
+	}
+}
+
+// New returns a new *Client for the claims of the supplied kind, e.g.
+// PostgreSQLInstance.v1alpha1.database.example.org. The supplied client has to
+// be able to read the claims and their connection secrets.
+func New(kube client.Client, gvk schema.GroupVersionKind, opts ...Option) *Client {
+	c := &Client{kube: kube, gvk: gvk, interval: defaultPollInterval}
+	for _, f := range opts {
+		f(c)
+	}
+	return c
+}
+
+// Client creates and reads the claims of a single kind.
+type Client struct {
+	kube      client.Client
+	gvk       schema.GroupVersionKind
+	interval  time.Duration
+	decrypter Decrypter
+}
+
+// ClaimOption is used to configure the claims that are created.
+type ClaimOption func(c *claim.Unstructured) error
+
+// WithParameters specifies the parameters of the claim, i.e. the fields of
+// its spec.parameters.
+func WithParameters(p map[string]interface{}) ClaimOption {
+	return func(c *claim.Unstructured) error {
+		return errors.Wrap(fieldpath.Pave(c.UnstructuredContent()).SetValue("spec.parameters", p), errSetParameters)
+	}
+}
+
+// WithConnectionSecret specifies the name of the connection secret that the
+// claim writes its connection details to in its namespace.
+func WithConnectionSecret(name string) ClaimOption {
+	return func(c *claim.Unstructured) error {
+		c.SetWriteConnectionSecretToReference(&v1alpha1.LocalSecretReference{Name: name})
+		return nil
+	}
+}
+
+// WithCompositionLabels specifies the labels of the Composition that the
+// claim should be composed with.
+func WithCompositionLabels(l map[string]string) ClaimOption {
+	return func(c *claim.Unstructured) error {
+		return errors.Wrap(fieldpath.Pave(c.UnstructuredContent()).SetValue(fieldCompositionLabel, l), errSetComposition)
+	}
+}
+
+// WithLabels specifies the labels of the claim.
+func WithLabels(l map[string]string) ClaimOption {
+	return func(c *claim.Unstructured) error {
+		meta.AddLabels(c, l)
+		return nil
+	}
+}
+
+// Create creates a claim with the supplied namespace and name, configured with
+// the supplied options, and returns it as it's created.
+func (c *Client) Create(ctx context.Context, namespace, name string, opts ...ClaimOption) (*claim.Unstructured, error) {
+	cl := claim.New(claim.WithGroupVersionKind(c.gvk))
+	cl.SetNamespace(namespace)
+	cl.SetName(name)
+	for _, f := range opts {
+		if err := f(cl); err != nil {
+			return nil, err
+		}
+	}
+	return cl, errors.Wrap(c.kube.Create(ctx, cl), errCreateClaim)
+}
+
+// Get returns the claim with the supplied namespace and name.
+func (c *Client) Get(ctx context.Context, namespace, name string) (*claim.Unstructured, error) {
+	cl := claim.New(claim.WithGroupVersionKind(c.gvk))
+	return cl, errors.Wrap(c.kube.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, cl), errGetClaim)
+}
+
+// WaitForReady waits until the claim with the supplied namespace and name is
+// ready, or the supplied context is done, and returns it. The error says why
+// the claim isn't ready if the agent reported it.
+func (c *Client) WaitForReady(ctx context.Context, namespace, name string) (*claim.Unstructured, error) {
+	var cl *claim.Unstructured
+	err := wait.PollImmediateUntil(c.interval, func() (bool, error) {
+		var err error
+		cl, err = c.Get(ctx, namespace, name)
+		if kerrors.IsNotFound(errors.Cause(err)) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return cl.GetCondition(v1alpha1.TypeReady).Status == corev1.ConditionTrue, nil
+	}, ctx.Done())
+	if err != wait.ErrWaitTimeout {
+		return cl, err
+	}
+	if cl != nil {
+		if s := cl.GetCondition(resource.TypeAgentSync); s.Status == corev1.ConditionFalse && s.Message != "" {
+			return cl, errors.Wrap(errors.New(s.Message), errWaitReady)
+		}
+	}
+	return cl, errors.New(errWaitReady)
+}
+
+// ConnectionDetails returns the connection details of the supplied claim that
+// the agent wrote to its connection secret in this cluster. An error is
+// returned if they aren't there yet, which is the case until the claim is
+// ready, or never will be because the agent doesn't sync connection secrets.
+func (c *Client) ConnectionDetails(ctx context.Context, cl *claim.Unstructured) (map[string][]byte, error) {
+	ref := cl.GetWriteConnectionSecretToReference()
+	if ref == nil {
+		return nil, errors.New(errNoSecretRef)
+	}
+	if s := cl.GetCondition(resource.TypeConnectionSecretSynced); s.Status == corev1.ConditionFalse && s.Message != "" {
+		return nil, errors.New(s.Message)
+	}
+	ns, _ := claimctrl.ConnectionSecretNamespace(cl)
+	s := &corev1.Secret{}
+	err := c.kube.Get(ctx, types.NamespacedName{Namespace: ns, Name: ref.Name}, s)
+	if kerrors.IsNotFound(err) {
+		return nil, errors.New(errNoSecretYet)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, errGetSecret)
+	}
+	if _, ok := s.GetAnnotations()[encryption.AnnotationKeyKeyID]; ok {
+		if c.decrypter == nil {
+			return nil, errors.New(errEncrypted)
+		}
+		if err := c.decrypter.Decrypt(s); err != nil {
+			return nil, errors.Wrap(err, errDecryptSecret)
+		}
+	}
+	return s.Data, nil
+}
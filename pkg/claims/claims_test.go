@@ -0,0 +1,223 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package claims
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/meta"
+	"github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/claim"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/crossplane/agent/pkg/encryption"
+	"github.com/crossplane/agent/pkg/resource"
+)
+
+var (
+	errBoom = errors.New("boom")
+	gvk     = schema.GroupVersionKind{Group: "database.example.org", Version: "v1alpha1", Kind: "PostgreSQLInstance"}
+)
+
+func TestCreate(t *testing.T) {
+	want := claim.New(claim.WithGroupVersionKind(gvk))
+	want.SetNamespace("app-ns")
+	want.SetName("db")
+	want.SetLabels(map[string]string{"team": "cool"})
+	want.Object["spec"] = map[string]interface{}{
+		"parameters":                 map[string]interface{}{"storageGB": float64(20)},
+		"compositionSelector":        map[string]interface{}{"matchLabels": map[string]interface{}{"provider": "aws"}},
+		"writeConnectionSecretToRef": map[string]interface{}{"name": "db-conn"},
+	}
+
+	kube := &test.MockClient{MockCreate: func(_ context.Context, obj runtime.Object, _ ...client.CreateOption) error {
+		if diff := cmp.Diff(want.UnstructuredContent(), obj.(*claim.Unstructured).UnstructuredContent()); diff != "" {
+			t.Errorf("\nReason: %s\n-want, +got:\n%s", "The claim should be created with the supplied options", diff)
+		}
+		return nil
+	}}
+	_, err := New(kube, gvk).Create(context.Background(), "app-ns", "db",
+		WithParameters(map[string]interface{}{"storageGB": int64(20)}),
+		WithCompositionLabels(map[string]string{"provider": "aws"}),
+		WithConnectionSecret("db-conn"),
+		WithLabels(map[string]string{"team": "cool"}),
+	)
+	if diff := cmp.Diff(nil, err, test.EquateErrors()); diff != "" {
+		t.Errorf("\nReason: %s\nCreate(...): -want error, +got error:\n%s", "The claim should be created", diff)
+	}
+}
+
+func TestWaitForReady(t *testing.T) {
+	withConditions := func(c ...v1alpha1.Condition) test.MockGetFn {
+		return func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+			obj.(*claim.Unstructured).SetConditions(c...)
+			return nil
+		}
+	}
+	cases := map[string]struct {
+		reason  string
+		get     test.MockGetFn
+		timeout time.Duration
+		want    error
+	}{
+		"Ready": {
+			reason: "No error should be returned once the claim is ready",
+			get:    withConditions(v1alpha1.Available()),
+		},
+		"GetFailed": {
+			reason: "An error should be returned if the claim cannot be read",
+			get:    test.NewMockGetFn(errBoom),
+			want:   errors.Wrap(errBoom, errGetClaim),
+		},
+		"NotYetCreated": {
+			reason:  "A claim that doesn't exist yet should be waited for",
+			get:     test.NewMockGetFn(kerrors.NewNotFound(schema.GroupResource{}, "")),
+			timeout: 10 * time.Millisecond,
+			want:    errors.New(errWaitReady),
+		},
+		"SyncFailed": {
+			reason:  "The reason the agent reported should be returned if the claim doesn't become ready",
+			get:     withConditions(v1alpha1.Creating(), resource.AgentSyncError(errBoom)),
+			timeout: 10 * time.Millisecond,
+			want:    errors.Wrap(errors.New(errBoom.Error()), errWaitReady),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tc.timeout)
+				defer cancel()
+			}
+			c := New(&test.MockClient{MockGet: tc.get}, gvk, WithPollInterval(time.Millisecond))
+			_, err := c.WaitForReady(ctx, "app-ns", "db")
+			if diff := cmp.Diff(tc.want, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\nWaitForReady(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestConnectionDetails(t *testing.T) {
+	kek := make([]byte, encryption.KeySize)
+	env, _ := encryption.NewEnvelope(kek)
+	data := map[string][]byte{"password": []byte("pass")}
+
+	withSecret := func(c *claim.Unstructured) *claim.Unstructured {
+		c.SetWriteConnectionSecretToReference(&v1alpha1.LocalSecretReference{Name: "db-conn"})
+		return c
+	}
+	local := func() *claim.Unstructured {
+		c := claim.New(claim.WithGroupVersionKind(gvk))
+		c.SetNamespace("app-ns")
+		c.SetName("db")
+		return c
+	}
+	secret := func(encrypted bool) test.MockGetFn {
+		return func(_ context.Context, key client.ObjectKey, obj runtime.Object) error {
+			if diff := cmp.Diff(types.NamespacedName{Namespace: "secrets-ns", Name: "db-conn"}, key); diff != "" {
+				t.Errorf("\n-want key, +got key:\n%s", diff)
+			}
+			s := obj.(*corev1.Secret)
+			s.Data = map[string][]byte{"password": []byte("pass")}
+			if encrypted {
+				return env.Encrypt(context.Background(), s)
+			}
+			return nil
+		}
+	}
+	inSecretsNamespace := func(c *claim.Unstructured) *claim.Unstructured {
+		meta.AddAnnotations(c, map[string]string{resource.AnnotationKeyConnectionSecretNamespace: "secrets-ns"})
+		return c
+	}
+
+	type want struct {
+		data map[string][]byte
+		err  error
+	}
+	cases := map[string]struct {
+		reason string
+		claim  *claim.Unstructured
+		get    test.MockGetFn
+		opts   []Option
+		want   want
+	}{
+		"NoSecretRef": {
+			reason: "An error should be returned if the claim doesn't write its connection details to a secret",
+			claim:  local(),
+			want:   want{err: errors.New(errNoSecretRef)},
+		},
+		"SecretsDisabled": {
+			reason: "The location of the connection secret in the remote cluster should be returned if it's not synced",
+			claim: func() *claim.Unstructured {
+				c := withSecret(local())
+				c.SetConditions(resource.ConnectionSecretNotSynced(types.NamespacedName{Namespace: "remote-ns", Name: "db-conn"}))
+				return c
+			}(),
+			want: want{err: errors.New(resource.ConnectionSecretNotSynced(types.NamespacedName{Namespace: "remote-ns", Name: "db-conn"}).Message)},
+		},
+		"NotYetSynced": {
+			reason: "An error should be returned if the connection secret isn't synced yet",
+			claim:  withSecret(local()),
+			get:    test.NewMockGetFn(kerrors.NewNotFound(schema.GroupResource{}, "")),
+			want:   want{err: errors.New(errNoSecretYet)},
+		},
+		"Plain": {
+			reason: "The connection details should be read from the namespace the claim writes them to",
+			claim:  inSecretsNamespace(withSecret(local())),
+			get:    secret(false),
+			want:   want{data: data},
+		},
+		"EncryptedWithoutDecrypter": {
+			reason: "An error should be returned if the connection secret is encrypted and there is no Decrypter",
+			claim:  inSecretsNamespace(withSecret(local())),
+			get:    secret(true),
+			want:   want{err: errors.New(errEncrypted)},
+		},
+		"Decrypted": {
+			reason: "The connection details should be decrypted with the Decrypter",
+			claim:  inSecretsNamespace(withSecret(local())),
+			get:    secret(true),
+			opts:   []Option{WithDecrypter(env)},
+			want:   want{data: data},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := New(&test.MockClient{MockGet: tc.get}, gvk, tc.opts...)
+			got, err := c.ConnectionDetails(context.Background(), tc.claim)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\nConnectionDetails(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.data, got); diff != "" {
+				t.Errorf("\nReason: %s\nConnectionDetails(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apiextensions
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	runtimeresource "github.com/crossplane/crossplane-runtime/pkg/resource"
+
+	"github.com/crossplane/agent/pkg/resource"
+)
+
+const errHashLocal = "cannot hash local object"
+
+// A ConflictStrategy determines what the Reconciler does when both the local
+// object and its remote counterpart changed since the last sync, e.g. because
+// the local cluster was restored from a backup that is newer than the remote
+// cluster.
+type ConflictStrategy string
+
+// Conflict strategies.
+const (
+	// ConflictStrategyRemoteWins overwrites the local object with the remote
+	// one, as if it didn't change.
+	ConflictStrategyRemoteWins ConflictStrategy = "RemoteWins"
+
+	// ConflictStrategyLocalWins keeps the local object as it is until it's
+	// synced again, see resource.AnnotationKeySyncedLocalHash.
+	ConflictStrategyLocalWins ConflictStrategy = "LocalWins"
+
+	// ConflictStrategyManual keeps the local object as it is and marks it with
+	// resource.AnnotationKeySyncConflict until someone decides which side is
+	// right.
+	ConflictStrategyManual ConflictStrategy = "Manual"
+)
+
+// LocalHash returns a hash of the content of the supplied local object, i.e.
+// everything but its type, metadata and status, so that any change made to it
+// in the local cluster changes the hash. The generation isn't used since it
+// doesn't change with every edit of every type, and it starts over when the
+// object is restored from a backup.
+func LocalHash(o runtime.Object) (string, error) {
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(o)
+	if err != nil {
+		return "", err
+	}
+	content := make(map[string]interface{}, len(u))
+	for k, v := range u {
+		switch k {
+		case "apiVersion", "kind", "metadata", "status":
+			continue
+		}
+		content[k] = v
+	}
+	b, err := json.Marshal(content)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// SyncConflict returns whether both the supplied local object and the remote
+// one changed since the local object was last synced, and why. The local
+// object changed if its LocalHash isn't the one it was last synced with, and
+// the remote one if its resource version isn't the one it was last synced
+// from. The local objects that weren't synced with a strategy other than
+// ConflictStrategyRemoteWins don't have a recorded hash, so they never
+// conflict.
+func SyncConflict(local, remote runtimeresource.Object) (bool, string, error) {
+	a := local.GetAnnotations()
+	synced, ok := a[resource.AnnotationKeySyncedLocalHash]
+	if !ok || a[resource.AnnotationKeySourceResourceVersion] == remote.GetResourceVersion() {
+		return false, "", nil
+	}
+	h, err := LocalHash(local)
+	if err != nil || h == synced {
+		return false, "", errors.Wrap(err, errHashLocal)
+	}
+	return true, fmt.Sprintf("local object changed since it was last synced from resource version %s, and the remote object is at resource version %s since then", a[resource.AnnotationKeySourceResourceVersion], remote.GetResourceVersion()), nil
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apiextensions
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	runtimeresource "github.com/crossplane/crossplane-runtime/pkg/resource"
+
+	"github.com/crossplane/agent/pkg/resource"
+)
+
+func TestSyncConflict(t *testing.T) {
+	object := func(spec string, a map[string]string) *unstructured.Unstructured {
+		u := &unstructured.Unstructured{Object: map[string]interface{}{"spec": map[string]interface{}{"field": spec}}}
+		u.SetAnnotations(a)
+		return u
+	}
+	synced, err := LocalHash(object("synced", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote := &unstructured.Unstructured{}
+	remote.SetResourceVersion("2")
+
+	cases := map[string]struct {
+		reason string
+		local  runtimeresource.Object
+		want   bool
+	}{
+		"NotRecorded": {
+			reason: "A local object without a recorded hash should never conflict",
+			local:  object("changed", map[string]string{resource.AnnotationKeySourceResourceVersion: "1"}),
+		},
+		"LocalUnchanged": {
+			reason: "A local object whose content didn't change since it was synced should not conflict",
+			local: object("synced", map[string]string{
+				resource.AnnotationKeySourceResourceVersion: "1",
+				resource.AnnotationKeySyncedLocalHash:       synced,
+			}),
+		},
+		"MetadataChanged": {
+			reason: "A local object whose metadata changed since it was synced should not conflict",
+			local: object("synced", map[string]string{
+				resource.AnnotationKeySourceResourceVersion: "1",
+				resource.AnnotationKeySyncedLocalHash:       synced,
+				"example.org/new":                           "annotation",
+			}),
+		},
+		"RemoteUnchanged": {
+			reason: "A local object that changed should not conflict if the remote object didn't",
+			local: object("changed", map[string]string{
+				resource.AnnotationKeySourceResourceVersion: "2",
+				resource.AnnotationKeySyncedLocalHash:       synced,
+			}),
+		},
+		"BothChanged": {
+			reason: "A local object that changed along with the remote object should conflict",
+			local: object("changed", map[string]string{
+				resource.AnnotationKeySourceResourceVersion: "1",
+				resource.AnnotationKeySyncedLocalHash:       synced,
+			}),
+			want: true,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, why, err := SyncConflict(tc.local, remote)
+			if err != nil {
+				t.Fatalf("\nReason: %s\nSyncConflict(...): %s", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\nReason: %s\nSyncConflict(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if got == (why == "") {
+				t.Errorf("\nReason: %s\nSyncConflict(...): the reason should be given only for conflicts, got %q", tc.reason, why)
+			}
+		})
+	}
+}
@@ -23,18 +23,26 @@ import (
 
 	"github.com/pkg/errors"
 	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	"github.com/crossplane/crossplane-runtime/pkg/event"
 	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane-runtime/pkg/meta"
 	runtimeresource "github.com/crossplane/crossplane-runtime/pkg/resource"
-	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1/ccrd"
 
+	"github.com/crossplane/agent/pkg/metrics"
 	"github.com/crossplane/agent/pkg/resource"
+	"github.com/crossplane/agent/pkg/rollout"
+	"github.com/crossplane/agent/pkg/sanitize"
+	"github.com/crossplane/agent/pkg/schedule"
+	"github.com/crossplane/agent/pkg/startup"
 )
 
 const (
@@ -43,15 +51,41 @@ const (
 	shortWait = 30 * time.Second
 	tinyWait  = 3 * time.Second
 
-	localPrefix          = "local cluster: "
-	remotePrefix         = "remote cluster: "
+	defaultRemovalDelay = 30 * time.Second
+	defaultMaxDeletions = 10
+	defaultMaxShare     = 50
+
 	errGetCRD            = "cannot get custom resource definition"
 	errFmtGetInstance    = "cannot get %s instance"
 	errFmtListInstance   = "cannot list %s instances"
 	errFmtDeleteInstance = "cannot delete %s instance"
 	errFmtApplyInstance  = "cannot apply %s instance"
+	errFmtMarkInstance   = "cannot mark %s instance for removal"
+	errFmtUnmarkInstance = "cannot unmark %s instance for removal"
+	errFmtTransform      = "cannot transform %s instance"
+	errFmtSanitize       = "cannot sanitize %s instance"
+	errFmtRecordSync     = "cannot record the sync of %s instance"
+	errFmtGetOwner       = "cannot get the owner of %s instance"
+	errFmtHashInstance   = "cannot hash %s instance"
 )
 
+// A Transformer transforms the objects of the supplied type, in
+// resource.group format, that are synced from the remote cluster before
+// they're applied to the local cluster. It writes the transformed object to
+// out, which is an empty object of the same type, and returns false if the
+// object isn't transformed.
+type Transformer interface {
+	Transform(typ string, in runtimeresource.Object, out runtime.Object) (bool, error)
+}
+
+// TransformFn is used to construct a Transformer with a bare function.
+type TransformFn func(typ string, in runtimeresource.Object, out runtime.Object) (bool, error)
+
+// Transform calls the supplied function.
+func (fn TransformFn) Transform(typ string, in runtimeresource.Object, out runtime.Object) (bool, error) {
+	return fn(typ, in, out)
+}
+
 // ReconcilerOption is used to configure the Reconciler.
 type ReconcilerOption func(*Reconciler)
 
@@ -72,7 +106,8 @@ func WithNewInstanceFn(f func() runtimeresource.Object) ReconcilerOption {
 }
 
 // WithGetItemsFn specifies the function that will be used to retrieve an array
-// of objects from the object list.
+// of objects from the object list. The returned objects are only read, so they
+// can point to the items of the list instead of being copies of them.
 func WithGetItemsFn(f func(l runtime.Object) []runtimeresource.Object) ReconcilerOption {
 	return func(r *Reconciler) {
 		r.getItems = f
@@ -87,6 +122,154 @@ func WithCRDName(name string) ReconcilerOption {
 	}
 }
 
+// WithCRDWatched specifies that the Reconciler is triggered when the CRD
+// becomes established in the local cluster, so it doesn't need to requeue
+// until then.
+func WithCRDWatched() ReconcilerOption {
+	return func(r *Reconciler) {
+		r.crdWatched = true
+	}
+}
+
+// WithPreservedAnnotations specifies the annotations of the local objects that
+// shouldn't be overridden by the ones of the remote objects.
+func WithPreservedAnnotations(p resource.PreservedAnnotations) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.preserved = p
+	}
+}
+
+// WithMetadataEqualizer specifies how the Reconciler should equalize the
+// labels and annotations of the local objects with the ones of the remote
+// objects. The local objects are patched with what the remote ones have, and
+// keep the labels and annotations only they have, by default.
+func WithMetadataEqualizer(e resource.MetadataEqualizer) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.equalizer = e
+	}
+}
+
+// WithRemovalDelay specifies how long a local object has to be gone from the
+// remote cluster before the Reconciler deletes it. The objects are marked with
+// resource.AnnotationKeyPendingRemoval in the meantime, so that a remote list
+// that is empty by mistake doesn't wipe out the local objects.
+func WithRemovalDelay(d time.Duration) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.removalDelay = d
+	}
+}
+
+// WithDeletionPacer specifies the Pacer that the deletions of the local
+// objects that are gone from the remote cluster have to wait for. The
+// Reconcilers of all types should share it so that its limit holds across
+// them rather than per reconcile. There is no limit if p is nil.
+func WithDeletionPacer(p Pacer) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.deletions = p
+	}
+}
+
+// WithMaxDeletionPercentage specifies the share of the local objects of the
+// type, in percent, that may be gone from the remote cluster at once before
+// the Reconciler stops deleting them altogether. Deletions resume once the
+// share drops or the local CRD is annotated with
+// resource.AnnotationKeyAllowMassRemoval. There is no limit if p isn't
+// positive.
+func WithMaxDeletionPercentage(p int) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.maxShare = p
+	}
+}
+
+// WithSourceCluster specifies the name of the remote cluster that the local
+// objects are annotated with as the cluster they're synced from.
+func WithSourceCluster(name string) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.cluster = name
+	}
+}
+
+// WithSyncGate specifies the Gate that the Reconciler should record the
+// objects it syncs to, so that it can tell when the initial sync is complete.
+func WithSyncGate(g *startup.Gate) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.gate = g
+	}
+}
+
+// WithSanitizers specifies the Registry whose Sanitizers the Reconciler should
+// run on the objects right before they're applied to the local cluster.
+// Defaults to sanitize.Default.
+func WithSanitizers(s *sanitize.Registry) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.sanitizers = s
+	}
+}
+
+// WithObjectTransformer specifies how the Reconciler should transform the
+// remote objects before they're applied to the local cluster.
+func WithObjectTransformer(t Transformer) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.transformer = t
+	}
+}
+
+// An OwnerFn returns the owner reference that the local objects should have.
+type OwnerFn func(ctx context.Context) (metav1.OwnerReference, error)
+
+// WithOwner specifies the owner that the Reconciler should add to the local
+// objects. It's resolved on every reconcile so that the local objects refer to
+// the current owner if it's recreated. The owners of the remote objects are
+// never synced.
+func WithOwner(fn OwnerFn) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.owner = fn
+	}
+}
+
+// WithScheduler specifies the Scheduler that decides when the Reconciler
+// syncs the objects next. It's meant to be shared by all reconcilers.
+func WithScheduler(s schedule.Scheduler) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.scheduler = s
+	}
+}
+
+// A Pacer paces the updates or deletions of the objects that exist in the
+// local cluster, e.g. *rollout.Window.
+type Pacer interface {
+	// Admit returns how long the update of the object with the supplied name
+	// has to wait, or zero if it may be made now.
+	Admit(name string) time.Duration
+
+	// Forget drops the update of the object with the supplied name if it
+	// waits.
+	Forget(name string)
+
+	// Queued returns the number of updates that wait.
+	Queued() int
+}
+
+// WithUpdatePacer specifies the Pacer that the updates of the local objects
+// whose remote counterparts changed have to wait for. The objects that don't
+// exist in the local cluster yet are created right away.
+func WithUpdatePacer(p Pacer) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.pacer = p
+	}
+}
+
+// WithConflictStrategy specifies what the Reconciler should do when both a
+// local object and its remote counterpart changed since the last sync. The
+// generation of the local objects is recorded after every sync for that,
+// which costs another write when they change, unless the strategy is
+// ConflictStrategyRemoteWins, which is the default.
+func WithConflictStrategy(s ConflictStrategy) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.conflicts = s
+	}
+}
+
 // WithLogger specifies how the Reconciler should log messages.
 func WithLogger(log logging.Logger) ReconcilerOption {
 	return func(r *Reconciler) {
@@ -104,15 +287,32 @@ func WithRecorder(er event.Recorder) ReconcilerOption {
 // NewReconciler returns a new *Reconciler object.
 func NewReconciler(mgr manager.Manager, localClient runtimeresource.ClientApplicator, opts ...ReconcilerOption) *Reconciler {
 	r := &Reconciler{
-		mgr:    mgr,
-		log:    logging.NewNopLogger(),
-		remote: mgr.GetClient(),
-		local:  localClient,
+		mgr:          mgr,
+		log:          logging.NewNopLogger(),
+		remote:       mgr.GetClient(),
+		local:        localClient,
+		removalDelay: defaultRemovalDelay,
+		deletions:    rollout.NewWindow(defaultMaxDeletions, rollout.WithInterval(defaultRemovalDelay)),
+		maxShare:     defaultMaxShare,
+		scheduler:    schedule.NewNopScheduler(),
+		sanitizers:   sanitize.Default,
+		conflicts:    ConflictStrategyRemoteWins,
 	}
 
 	for _, f := range opts {
 		f(r)
 	}
+	// The preserved annotations are kept whatever the strategy, so the
+	// equalizer is wrapped once all options are applied.
+	if r.equalizer != nil {
+		r.local.Applicator = resource.NewEqualizingApplicator(r.local.Client, r.preserved.Keep(r.equalizer))
+	}
+	if r.newObject != nil {
+		r.objects = resource.NewObjectPool(func() runtime.Object { return r.newObject() })
+	}
+	if r.newObjectList != nil {
+		r.lists = resource.NewObjectPool(r.newObjectList)
+	}
 
 	return r
 }
@@ -121,42 +321,274 @@ func NewReconciler(mgr manager.Manager, localClient runtimeresource.ClientApplic
 // remote cluster to local cluster. It works only with cluster-scoped resources and
 // always overrides the changes made to those Custom Resources in the local cluster.
 type Reconciler struct {
+	resource.ManagerContext
+
 	remote client.Client
 	local  runtimeresource.ClientApplicator
 	mgr    manager.Manager
 
 	crdName       types.NamespacedName
+	crdWatched    bool
+	preserved     resource.PreservedAnnotations
+	equalizer     resource.MetadataEqualizer
 	newObjectList func() runtime.Object
 	getItems      func(l runtime.Object) []runtimeresource.Object
 	newObject     func() runtimeresource.Object
+	removalDelay  time.Duration
+	deletions     Pacer
+	maxShare      int
+	cluster       string
+	gate          *startup.Gate
+	transformer   Transformer
+	sanitizers    *sanitize.Registry
+	owner         OwnerFn
+	scheduler     schedule.Scheduler
+	pacer         Pacer
+	conflicts     ConflictStrategy
+
+	// The objects and lists are reused across reconciles so that syncing a
+	// large number of objects doesn't allocate them over and over again.
+	objects *resource.ObjectPool
+	lists   *resource.ObjectPool
 
 	log    logging.Logger
 	record event.Recorder
 }
 
+// pace returns how long the update of the local counterpart of the supplied
+// remote object has to wait. The objects that don't exist in the local cluster
+// and the ones that were last synced from the same version of the remote
+// object aren't paced.
+func (r *Reconciler) pace(ctx context.Context, remote runtimeresource.Object) (time.Duration, error) {
+	defer func() { metrics.QueuedUpdates.WithLabelValues(r.crdName.Name).Set(float64(r.pacer.Queued())) }()
+	current := r.newObject()
+	err := r.local.Get(ctx, types.NamespacedName{Name: remote.GetName()}, current)
+	if kerrors.IsNotFound(err) {
+		r.pacer.Forget(remote.GetName())
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if current.GetAnnotations()[resource.AnnotationKeySourceResourceVersion] == remote.GetResourceVersion() {
+		r.pacer.Forget(remote.GetName())
+		return 0, nil
+	}
+	return r.pacer.Admit(remote.GetName()), nil
+}
+
+// conflicted returns whether the local counterpart of the supplied remote
+// object changed along with it since the last sync, in which case the local
+// object is kept as it is, and marked if the strategy is
+// ConflictStrategyManual.
+func (r *Reconciler) conflicted(ctx context.Context, log logging.Logger, remote runtimeresource.Object) (bool, error) {
+	current := r.newObject()
+	err := r.local.Get(ctx, types.NamespacedName{Name: remote.GetName()}, current)
+	if kerrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, resource.LocalError(err, fmt.Sprintf(errFmtGetInstance, r.crdName.Name))
+	}
+	conflict, why, err := SyncConflict(current, remote)
+	if err != nil {
+		return false, err
+	}
+	if !conflict {
+		return false, nil
+	}
+	log.Info("Both the local and the remote object changed since the last sync, keeping the local object", "strategy", r.conflicts, "reason", why)
+	if r.conflicts != ConflictStrategyManual || current.GetAnnotations()[resource.AnnotationKeySyncConflict] == why {
+		return true, nil
+	}
+	meta.AddAnnotations(current, map[string]string{resource.AnnotationKeySyncConflict: why})
+	return true, resource.LocalError(r.local.Update(ctx, current), fmt.Sprintf(errFmtMarkInstance, r.crdName.Name))
+}
+
+// recordSync records the hash of the content of the supplied local object
+// right after it's synced, and clears its conflict if it had one. Metadata
+// changes don't change the hash.
+func (r *Reconciler) recordSync(ctx context.Context, local runtimeresource.Object) error {
+	h, err := LocalHash(local)
+	if err != nil {
+		return errors.Wrap(err, errHashLocal)
+	}
+	a := local.GetAnnotations()
+	_, conflict := a[resource.AnnotationKeySyncConflict]
+	if a[resource.AnnotationKeySyncedLocalHash] == h && !conflict {
+		return nil
+	}
+	meta.AddAnnotations(local, map[string]string{resource.AnnotationKeySyncedLocalHash: h})
+	meta.RemoveAnnotations(local, resource.AnnotationKeySyncConflict)
+	return r.local.Update(ctx, local)
+}
+
+// changed records the hash of the supplied desired local object on it and
+// returns whether it's different from the current one, which is returned as
+// well if it exists. The current object is different if what the agent wrote
+// last time, or its content, e.g. its spec, doesn't match the desired one.
+func (r *Reconciler) changed(ctx context.Context, desired runtimeresource.Object) (runtimeresource.Object, bool, error) {
+	h, err := resource.Hash(desired)
+	if err != nil {
+		return nil, false, errors.Wrapf(err, errFmtHashInstance, r.crdName.Name)
+	}
+	meta.AddAnnotations(desired, map[string]string{resource.AnnotationKeySpecHash: h})
+	current := r.newObject()
+	err = r.local.Get(ctx, types.NamespacedName{Name: desired.GetName()}, current)
+	if kerrors.IsNotFound(err) {
+		return nil, true, nil
+	}
+	if err != nil {
+		return nil, false, resource.LocalError(err, fmt.Sprintf(errFmtGetInstance, r.crdName.Name))
+	}
+	if current.GetAnnotations()[resource.AnnotationKeySpecHash] != h {
+		return current, true, nil
+	}
+	hc, err := LocalHash(current)
+	if err != nil {
+		return nil, false, errors.Wrapf(err, errFmtHashInstance, r.crdName.Name)
+	}
+	hd, err := LocalHash(desired)
+	if err != nil {
+		return nil, false, errors.Wrapf(err, errFmtHashInstance, r.crdName.Name)
+	}
+	return current, hc != hd, nil
+}
+
+// sanitize runs the Sanitizers of the type of the supplied object on it. Typed
+// objects don't carry their type, so it's looked up in the scheme.
+func (r *Reconciler) sanitize(ctx context.Context, obj runtime.Object) error {
+	if len(r.sanitizers.Types()) == 0 {
+		return nil
+	}
+	gvk, err := apiutil.GVKForObject(obj, r.mgr.GetScheme())
+	if err != nil {
+		return err
+	}
+	return r.sanitizers.Sanitize(ctx, gvk, obj)
+}
+
 // Reconcile syncs the cluster-scoped instance of the type in remote->local direction.
-func (r *Reconciler) Reconcile(req reconcile.Request) (reconcile.Result, error) { // nolint:gocyclo
-	log := r.log.WithValues("request", req)
+func (r *Reconciler) Reconcile(req reconcile.Request) (reconcile.Result, error) {
+	return r.ReconcileContext(r.Context(), req)
+}
+
+// ReconcileContext is Reconcile with the supplied context, which the context
+// of the reconcile is derived from. The reconcile is cancelled once the
+// supplied context is.
+func (r *Reconciler) ReconcileContext(ctx context.Context, req reconcile.Request) (result reconcile.Result, err error) {
+	defer func() {
+		result = r.scheduler.Schedule(schedule.Key{Controller: r.crdName.Name, Name: req.Name}, result, err)
+	}()
+	result, err = r.reconcile(ctx, req)
+	if err != nil {
+		metrics.SyncErrors.WithLabelValues(string(resource.ClassifyError(err))).Inc()
+	}
+	return result, err
+}
+
+func (r *Reconciler) reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) { // nolint:gocyclo
+	id := resource.NewSyncID()
+	log := r.log.WithValues("request", req, "sync-id", id)
 	log.Debug("Reconciling")
 
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	ctx, cancel := context.WithTimeout(resource.WithSyncID(ctx, id), timeout)
 	defer cancel()
 
 	localCRD := &v1beta1.CustomResourceDefinition{}
 	if err := r.local.Get(ctx, r.crdName, localCRD); err != nil {
-		return reconcile.Result{RequeueAfter: shortWait}, errors.Wrap(err, localPrefix+errGetCRD)
+		return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(err, errGetCRD)
 	}
-	if !ccrd.IsEstablished(localCRD.Status) {
+	if err := resource.Established(localCRD); errors.Is(err, resource.ErrCRDNotEstablished) {
+		// The local objects cannot be written until it is, so the wait is
+		// counted like a sync error of its own kind.
+		log.Debug("CRD is not established yet", "crd", localCRD.GetName())
+		metrics.SyncErrors.WithLabelValues(string(resource.ClassifyError(err))).Inc()
+		if r.crdWatched {
+			return reconcile.Result{}, nil
+		}
 		return reconcile.Result{RequeueAfter: tinyWait}, nil
 	}
 
-	remoteObject := r.newObject()
+	remoteObject, _ := r.objects.Get().(runtimeresource.Object)
+	defer r.objects.Put(remoteObject)
 	if err := r.remote.Get(ctx, req.NamespacedName, remoteObject); err != nil {
-		return reconcile.Result{RequeueAfter: shortWait}, errors.Wrap(err, remotePrefix+fmt.Sprintf(errFmtGetInstance, r.crdName.Name))
+		if r.pacer != nil && kerrors.IsNotFound(err) {
+			r.pacer.Forget(req.Name)
+		}
+		return reconcile.Result{RequeueAfter: shortWait}, resource.RemoteError(err, fmt.Sprintf(errFmtGetInstance, r.crdName.Name))
+	}
+	if r.pacer != nil {
+		wait, err := r.pace(ctx, remoteObject)
+		if err != nil {
+			return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(err, fmt.Sprintf(errFmtGetInstance, r.crdName.Name))
+		}
+		if wait > 0 {
+			log.Debug("Update waits for its turn in the rollout window", "requeue-after", time.Now().Add(wait))
+			return reconcile.Result{RequeueAfter: wait}, nil
+		}
 	}
-	localObject := resource.SanitizedDeepCopyObject(remoteObject)
-	if err := r.local.Apply(ctx, localObject); err != nil {
-		return reconcile.Result{RequeueAfter: shortWait}, errors.Wrap(err, localPrefix+fmt.Sprintf(errFmtApplyInstance, r.crdName.Name))
+	// The local object is kept as it is if it conflicts with the remote one,
+	// but the removals are still handled.
+	conflicted := false
+	if r.conflicts != ConflictStrategyRemoteWins {
+		var err error
+		if conflicted, err = r.conflicted(ctx, log, remoteObject); err != nil {
+			return reconcile.Result{RequeueAfter: shortWait}, err
+		}
+	}
+	if !conflicted {
+		localObject := resource.SanitizedDeepCopyObject(remoteObject)
+		if r.transformer != nil {
+			out := r.newObject()
+			ok, err := r.transformer.Transform(r.crdName.Name, localObject, out)
+			if err != nil {
+				return reconcile.Result{RequeueAfter: longWait}, errors.Wrapf(err, errFmtTransform, r.crdName.Name)
+			}
+			if ok {
+				localObject = out
+			}
+		}
+		if err := r.sanitize(ctx, localObject); err != nil {
+			return reconcile.Result{RequeueAfter: longWait}, errors.Wrapf(err, errFmtSanitize, r.crdName.Name)
+		}
+		// The local objects are patched, so the preserved annotations of the local
+		// objects are kept as long as the remote ones aren't sent.
+		r.preserved.Strip(localObject)
+		resource.SetSyncID(ctx, localObject)
+		resource.SetProvenance(localObject, r.cluster, remoteObject.GetResourceVersion(), time.Now())
+		var ao []runtimeresource.ApplyOption
+		if r.owner != nil {
+			ref, err := r.owner(ctx)
+			if err != nil {
+				return reconcile.Result{RequeueAfter: shortWait}, errors.Wrapf(err, errFmtGetOwner, r.crdName.Name)
+			}
+			// The owner is added alongside the ones the local object has, so
+			// that the owners added in the local cluster aren't dropped.
+			meta.AddOwnerReference(localObject, ref)
+			ao = append(ao, resource.KeepOwnerReferences())
+		}
+		// The local object is only written if it changed since the last sync,
+		// so that it's not written on every sync just to record the time.
+		current, changed, err := r.changed(ctx, localObject)
+		if err != nil {
+			return reconcile.Result{RequeueAfter: shortWait}, err
+		}
+		if changed {
+			if err := r.local.Apply(ctx, localObject, ao...); err != nil {
+				return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(err, fmt.Sprintf(errFmtApplyInstance, r.crdName.Name))
+			}
+		} else {
+			localObject = current
+		}
+		if r.conflicts != ConflictStrategyRemoteWins {
+			if err := r.recordSync(ctx, localObject); err != nil {
+				return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(err, fmt.Sprintf(errFmtRecordSync, r.crdName.Name))
+			}
+		}
+	}
+	if r.gate != nil {
+		r.gate.Synced(r.crdName.Name, req.Name)
 	}
 	// TODO(muvaf): We need to call status update to bring the status subresource
 	// of the resources.
@@ -166,27 +598,82 @@ func (r *Reconciler) Reconcile(req reconcile.Request) (reconcile.Result, error)
 	// being up at that time. Since reconciliation is called only for the existing
 	// resources, we need to delete the resources in the local that do not have
 	// a corresponding resource in the remote cluster.
-	removalList := map[string]bool{}
-	ll := r.newObjectList()
+	ll := r.lists.Get()
+	defer r.lists.Put(ll)
 	if err := r.local.List(ctx, ll); err != nil {
-		return reconcile.Result{RequeueAfter: shortWait}, errors.Wrap(err, localPrefix+fmt.Sprintf(errFmtListInstance, r.crdName.Name))
+		return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(err, fmt.Sprintf(errFmtListInstance, r.crdName.Name))
 	}
-	for _, obj := range r.getItems(ll) {
-		removalList[obj.GetName()] = true
+	removalList := map[string]runtimeresource.Object{}
+	items := r.getItems(ll)
+	for _, obj := range items {
+		removalList[obj.GetName()] = obj
 	}
-	rl := r.newObjectList()
+	rl := r.lists.Get()
+	defer r.lists.Put(rl)
 	if err := r.remote.List(ctx, rl); err != nil {
-		return reconcile.Result{RequeueAfter: shortWait}, errors.Wrap(err, remotePrefix+fmt.Sprintf(errFmtListInstance, r.crdName.Name))
+		return reconcile.Result{RequeueAfter: shortWait}, resource.RemoteError(err, fmt.Sprintf(errFmtListInstance, r.crdName.Name))
 	}
 	for _, obj := range r.getItems(rl) {
+		lo, ok := removalList[obj.GetName()]
+		if !ok {
+			continue
+		}
 		delete(removalList, obj.GetName())
+		// The object is back in the remote cluster, so it's not removed.
+		if _, marked := lo.GetAnnotations()[resource.AnnotationKeyPendingRemoval]; marked {
+			meta.RemoveAnnotations(lo, resource.AnnotationKeyPendingRemoval)
+			if r.deletions != nil {
+				r.deletions.Forget(r.crdName.Name + "/" + lo.GetName())
+			}
+			if err := r.local.Update(ctx, lo); err != nil {
+				return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(err, fmt.Sprintf(errFmtUnmarkInstance, r.crdName.Name))
+			}
+		}
+	}
+
+	// The objects that are gone from the remote cluster are first marked for
+	// removal and deleted only if they're still gone once the removal delay
+	// passes, and only so many at a time, so that a remote list that is empty
+	// by mistake doesn't wipe out the local cluster.
+	// Too many objects gone at once is more likely to be a misconfiguration of
+	// the remote cluster than intended, so the breaker halts all deletions of
+	// the type until it's overridden. Removing a single object never trips it.
+	halted := r.maxShare > 0 && len(removalList) > 1 && len(removalList)*100 > r.maxShare*len(items) &&
+		localCRD.GetAnnotations()[resource.AnnotationKeyAllowMassRemoval] != "true"
+	if halted {
+		log.Info("Too many synced objects are gone from the remote cluster, not deleting them", "crd", r.crdName.Name, "gone", len(removalList), "total", len(items), "override-annotation", resource.AnnotationKeyAllowMassRemoval)
+		metrics.DeletionBreakerOpen.WithLabelValues(r.crdName.Name).Set(1)
+	} else {
+		metrics.DeletionBreakerOpen.WithLabelValues(r.crdName.Name).Set(0)
 	}
-	for remove := range removalList {
-		obj := r.newObject()
-		obj.SetName(remove)
-		if err := r.local.Delete(ctx, obj); runtimeresource.IgnoreNotFound(err) != nil {
-			return reconcile.Result{RequeueAfter: shortWait}, errors.Wrap(err, localPrefix+fmt.Sprintf(errFmtDeleteInstance, r.crdName.Name))
+	pending, deleted := 0, 0
+	for _, lo := range removalList {
+		marked, err := time.Parse(time.RFC3339, lo.GetAnnotations()[resource.AnnotationKeyPendingRemoval])
+		if err != nil {
+			meta.AddAnnotations(lo, map[string]string{resource.AnnotationKeyPendingRemoval: time.Now().UTC().Format(time.RFC3339)})
+			if err := r.local.Update(ctx, lo); err != nil {
+				return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(err, fmt.Sprintf(errFmtMarkInstance, r.crdName.Name))
+			}
+			pending++
+			continue
+		}
+		if halted || time.Since(marked) < r.removalDelay {
+			pending++
+			continue
 		}
+		if r.deletions != nil && r.deletions.Admit(r.crdName.Name+"/"+lo.GetName()) > 0 {
+			pending++
+			continue
+		}
+		if err := r.local.Delete(ctx, lo); runtimeresource.IgnoreNotFound(err) != nil {
+			return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(err, fmt.Sprintf(errFmtDeleteInstance, r.crdName.Name))
+		}
+		deleted++
+	}
+	metrics.PendingRemovals.WithLabelValues(r.crdName.Name).Set(float64(pending))
+	if pending > 0 {
+		log.Debug("Synced objects are pending removal", "pending", pending, "deleted", deleted)
+		return reconcile.Result{RequeueAfter: r.removalDelay}, nil
 	}
 	return reconcile.Result{RequeueAfter: longWait}, nil
 }
@@ -20,20 +20,27 @@ import (
 	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/pkg/errors"
 	apiextensions "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
+	"github.com/crossplane/crossplane-runtime/pkg/meta"
 	runtimeresource "github.com/crossplane/crossplane-runtime/pkg/resource"
 	"github.com/crossplane/crossplane-runtime/pkg/resource/fake"
 	"github.com/crossplane/crossplane-runtime/pkg/test"
 	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
+
+	"github.com/crossplane/agent/pkg/resource"
+	"github.com/crossplane/agent/pkg/rollout"
+	"github.com/crossplane/agent/pkg/sanitize"
 )
 
 var (
@@ -43,14 +50,16 @@ var (
 	gi = func(l runtime.Object) []runtimeresource.Object {
 		list, _ := l.(*v1alpha1.CompositionList)
 		result := make([]runtimeresource.Object, len(list.Items))
-		for i, val := range list.Items {
-			obj, _ := val.DeepCopyObject().(runtimeresource.Object)
-			result[i] = obj
+		for i := range list.Items {
+			result[i] = &list.Items[i]
 		}
 		return result
 	}
 	ni = func() runtimeresource.Object { return &v1alpha1.Composition{} }
 
+	// markedLongAgo is set on the local objects whose removal delay passed.
+	markedLongAgo = map[string]string{resource.AnnotationKeyPendingRemoval: time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)}
+
 	established = apiextensions.CustomResourceDefinition{
 		Status: apiextensions.CustomResourceDefinitionStatus{
 			Conditions: []apiextensions.CustomResourceDefinitionCondition{
@@ -63,10 +72,24 @@ var (
 	}
 )
 
+type mockPacer struct {
+	wait time.Duration
+}
+
+func (p *mockPacer) Admit(_ string) time.Duration { return p.wait }
+func (p *mockPacer) Forget(_ string)              {}
+func (p *mockPacer) Queued() int                  { return 0 }
+
 func Test_Reconcile(t *testing.T) {
+	// The deletions of the Compositions of another reconcile used up the
+	// limit that all Reconcilers share.
+	exhausted := rollout.NewWindow(1)
+	exhausted.Admit(CompositionCRDName + "/other")
+
 	type args struct {
 		m     manager.Manager
 		local runtimeresource.ClientApplicator
+		opts  []ReconcilerOption
 	}
 	type want struct {
 		result reconcile.Result
@@ -87,7 +110,7 @@ func Test_Reconcile(t *testing.T) {
 				},
 			},
 			want: want{
-				err:    errors.Wrap(errBoom, localPrefix+errGetCRD),
+				err:    resource.LocalError(errBoom, errGetCRD),
 				result: reconcile.Result{RequeueAfter: shortWait},
 			},
 		},
@@ -103,6 +126,19 @@ func Test_Reconcile(t *testing.T) {
 				result: reconcile.Result{RequeueAfter: tinyWait},
 			},
 		},
+		"NotEstablishedYetWatched": {
+			reason: "No requeue should be requested if the Reconciler is triggered when the CRD in local becomes established",
+			args: args{
+				m: &fake.Manager{},
+				local: runtimeresource.ClientApplicator{
+					Client: &test.MockClient{MockGet: test.NewMockGetFn(nil)},
+				},
+				opts: []ReconcilerOption{WithCRDWatched()},
+			},
+			want: want{
+				result: reconcile.Result{},
+			},
+		},
 		"RemoteGetFailed": {
 			reason: "An error should be returned if the instance in remote cluster cannot be retrieved",
 			args: args{
@@ -122,7 +158,7 @@ func Test_Reconcile(t *testing.T) {
 				},
 			},
 			want: want{
-				err:    errors.Wrap(errBoom, remotePrefix+fmt.Sprintf(errFmtGetInstance, compositionCRDName)),
+				err:    resource.RemoteError(errBoom, fmt.Sprintf(errFmtGetInstance, CompositionCRDName)),
 				result: reconcile.Result{RequeueAfter: shortWait},
 			},
 		},
@@ -149,7 +185,385 @@ func Test_Reconcile(t *testing.T) {
 				},
 			},
 			want: want{
-				err:    errors.Wrap(errBoom, localPrefix+fmt.Sprintf(errFmtApplyInstance, compositionCRDName)),
+				err:    resource.LocalError(errBoom, fmt.Sprintf(errFmtApplyInstance, CompositionCRDName)),
+				result: reconcile.Result{RequeueAfter: shortWait},
+			},
+		},
+		"PreservedAnnotationsStripped": {
+			reason: "The preserved annotations of the remote object should not be sent to the local cluster",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							meta.AddAnnotations(obj.(metav1.Object), map[string]string{
+								"argocd.argoproj.io/instance": "central",
+								"example.org/owner":           "platform",
+							})
+							return nil
+						},
+					},
+				},
+				local: runtimeresource.ClientApplicator{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							if o, ok := obj.(*apiextensions.CustomResourceDefinition); ok {
+								established.DeepCopyInto(o)
+							}
+							return nil
+						},
+					},
+					Applicator: runtimeresource.ApplyFn(func(_ context.Context, obj runtime.Object, _ ...runtimeresource.ApplyOption) error {
+						a := obj.(metav1.Object).GetAnnotations()
+						if _, ok := a["argocd.argoproj.io/instance"]; ok || a["example.org/owner"] != "platform" {
+							t.Errorf("Apply(...): only the preserved annotations should be stripped, got %v", a)
+						}
+						return errBoom
+					}),
+				},
+				opts: []ReconcilerOption{WithPreservedAnnotations(resource.DefaultPreservedAnnotations)},
+			},
+			want: want{
+				err:    resource.LocalError(errBoom, fmt.Sprintf(errFmtApplyInstance, CompositionCRDName)),
+				result: reconcile.Result{RequeueAfter: shortWait},
+			},
+		},
+		"TransformFailed": {
+			reason: "An error should be returned if the remote object cannot be transformed",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{MockGet: test.NewMockGetFn(nil)},
+				},
+				local: runtimeresource.ClientApplicator{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							if o, ok := obj.(*apiextensions.CustomResourceDefinition); ok {
+								established.DeepCopyInto(o)
+							}
+							return nil
+						},
+					},
+				},
+				opts: []ReconcilerOption{WithObjectTransformer(TransformFn(func(_ string, _ runtimeresource.Object, _ runtime.Object) (bool, error) {
+					return false, errBoom
+				}))},
+			},
+			want: want{
+				err:    errors.Wrapf(errBoom, errFmtTransform, CompositionCRDName),
+				result: reconcile.Result{RequeueAfter: longWait},
+			},
+		},
+		"Transformed": {
+			reason: "The transformed object should be applied to the local cluster",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{MockGet: test.NewMockGetFn(nil)},
+				},
+				local: runtimeresource.ClientApplicator{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							if o, ok := obj.(*apiextensions.CustomResourceDefinition); ok {
+								established.DeepCopyInto(o)
+							}
+							return nil
+						},
+					},
+					Applicator: runtimeresource.ApplyFn(func(_ context.Context, obj runtime.Object, _ ...runtimeresource.ApplyOption) error {
+						if l := obj.(metav1.Object).GetLabels()["region"]; l != "eu-west-1" {
+							t.Errorf("Apply(...): the transformed object should be applied, got region label %q", l)
+						}
+						return errBoom
+					}),
+				},
+				opts: []ReconcilerOption{WithObjectTransformer(TransformFn(func(typ string, in runtimeresource.Object, out runtime.Object) (bool, error) {
+					in.DeepCopyObject().(*v1alpha1.Composition).DeepCopyInto(out.(*v1alpha1.Composition))
+					out.(metav1.Object).SetLabels(map[string]string{"region": "eu-west-1"})
+					return typ == CompositionCRDName, nil
+				}))},
+			},
+			want: want{
+				err:    resource.LocalError(errBoom, fmt.Sprintf(errFmtApplyInstance, CompositionCRDName)),
+				result: reconcile.Result{RequeueAfter: shortWait},
+			},
+		},
+		"Sanitized": {
+			reason: "The object should be sanitized by the sanitizers of its type before it's applied to the local cluster",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{MockGet: test.NewMockGetFn(nil)},
+					Scheme: func() *runtime.Scheme {
+						s := runtime.NewScheme()
+						_ = v1alpha1.SchemeBuilder.AddToScheme(s)
+						return s
+					}(),
+				},
+				local: runtimeresource.ClientApplicator{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							if o, ok := obj.(*apiextensions.CustomResourceDefinition); ok {
+								established.DeepCopyInto(o)
+							}
+							return nil
+						},
+					},
+					Applicator: runtimeresource.ApplyFn(func(_ context.Context, obj runtime.Object, _ ...runtimeresource.ApplyOption) error {
+						if l := obj.(metav1.Object).GetLabels()["sanitized"]; l != "true" {
+							t.Errorf("Apply(...): the sanitized object should be applied, got sanitized label %q", l)
+						}
+						return errBoom
+					}),
+				},
+				opts: []ReconcilerOption{WithSanitizers(func() *sanitize.Registry {
+					r := sanitize.NewRegistry()
+					r.Register(v1alpha1.CompositionGroupVersionKind, sanitize.SanitizerFn(func(_ context.Context, obj *unstructured.Unstructured) error {
+						obj.SetLabels(map[string]string{"sanitized": "true"})
+						return nil
+					}))
+					return r
+				}())},
+			},
+			want: want{
+				err:    resource.LocalError(errBoom, fmt.Sprintf(errFmtApplyInstance, CompositionCRDName)),
+				result: reconcile.Result{RequeueAfter: shortWait},
+			},
+		},
+		"ProvenanceAnnotated": {
+			reason: "The local objects should be annotated with where they're synced from",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							obj.(metav1.Object).SetResourceVersion("42")
+							return nil
+						},
+					},
+				},
+				local: runtimeresource.ClientApplicator{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							if o, ok := obj.(*apiextensions.CustomResourceDefinition); ok {
+								established.DeepCopyInto(o)
+							}
+							return nil
+						},
+					},
+					Applicator: runtimeresource.ApplyFn(func(_ context.Context, obj runtime.Object, _ ...runtimeresource.ApplyOption) error {
+						a := obj.(metav1.Object).GetAnnotations()
+						if a[resource.AnnotationKeySyncedFromCluster] != "central" || a[resource.AnnotationKeySourceResourceVersion] != "42" || a[resource.AnnotationKeyLastSyncedTime] == "" {
+							t.Errorf("Apply(...): the provenance of the object should be annotated, got %v", a)
+						}
+						return errBoom
+					}),
+				},
+				opts: []ReconcilerOption{WithSourceCluster("central")},
+			},
+			want: want{
+				err:    resource.LocalError(errBoom, fmt.Sprintf(errFmtApplyInstance, CompositionCRDName)),
+				result: reconcile.Result{RequeueAfter: shortWait},
+			},
+		},
+		"OwnersReplaced": {
+			reason: "The owners of the remote object should be replaced with the local owner",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							obj.(metav1.Object).SetOwnerReferences([]metav1.OwnerReference{{Kind: "Configuration", Name: "platform", UID: "remote-uid"}})
+							return nil
+						},
+					},
+				},
+				local: runtimeresource.ClientApplicator{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							if o, ok := obj.(*apiextensions.CustomResourceDefinition); ok {
+								established.DeepCopyInto(o)
+							}
+							return nil
+						},
+					},
+					Applicator: runtimeresource.ApplyFn(func(_ context.Context, obj runtime.Object, ao ...runtimeresource.ApplyOption) error {
+						want := []metav1.OwnerReference{{Kind: "SyncedBundle", Name: "platform", UID: "bundle-uid"}}
+						if diff := cmp.Diff(want, obj.(metav1.Object).GetOwnerReferences()); diff != "" {
+							t.Errorf("Apply(...): -want owners, +got owners:\n%s", diff)
+						}
+						if len(ao) != 1 {
+							t.Errorf("Apply(...): the owners of the local object should be kept, got %d apply options", len(ao))
+						}
+						return errBoom
+					}),
+				},
+				opts: []ReconcilerOption{WithOwner(func(_ context.Context) (metav1.OwnerReference, error) {
+					return metav1.OwnerReference{Kind: "SyncedBundle", Name: "platform", UID: "bundle-uid"}, nil
+				})},
+			},
+			want: want{
+				err:    resource.LocalError(errBoom, fmt.Sprintf(errFmtApplyInstance, CompositionCRDName)),
+				result: reconcile.Result{RequeueAfter: shortWait},
+			},
+		},
+		"UpdatePaced": {
+			reason: "The update of a local object whose remote counterpart changed should wait for the Pacer",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+						obj.(metav1.Object).SetResourceVersion("2")
+						return nil
+					}},
+				},
+				local: runtimeresource.ClientApplicator{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							if o, ok := obj.(*apiextensions.CustomResourceDefinition); ok {
+								established.DeepCopyInto(o)
+								return nil
+							}
+							meta.AddAnnotations(obj.(metav1.Object), map[string]string{resource.AnnotationKeySourceResourceVersion: "1"})
+							return nil
+						},
+					},
+					Applicator: runtimeresource.ApplyFn(func(_ context.Context, _ runtime.Object, _ ...runtimeresource.ApplyOption) error {
+						t.Errorf("Apply(...): the update should wait for its turn")
+						return nil
+					}),
+				},
+				opts: []ReconcilerOption{WithUpdatePacer(&mockPacer{wait: 20 * time.Second})},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: 20 * time.Second},
+			},
+		},
+		"UnchangedNotPaced": {
+			reason: "A local object that was synced from the same version of its remote counterpart should not wait for the Pacer",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+						obj.(metav1.Object).SetResourceVersion("1")
+						return nil
+					}},
+				},
+				local: runtimeresource.ClientApplicator{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							if o, ok := obj.(*apiextensions.CustomResourceDefinition); ok {
+								established.DeepCopyInto(o)
+								return nil
+							}
+							meta.AddAnnotations(obj.(metav1.Object), map[string]string{resource.AnnotationKeySourceResourceVersion: "1"})
+							return nil
+						},
+					},
+					Applicator: runtimeresource.ApplyFn(func(_ context.Context, _ runtime.Object, _ ...runtimeresource.ApplyOption) error {
+						return errBoom
+					}),
+				},
+				opts: []ReconcilerOption{WithUpdatePacer(&mockPacer{wait: 20 * time.Second})},
+			},
+			want: want{
+				err:    resource.LocalError(errBoom, fmt.Sprintf(errFmtApplyInstance, CompositionCRDName)),
+				result: reconcile.Result{RequeueAfter: shortWait},
+			},
+		},
+		"UnchangedNotWritten": {
+			reason: "A local object that is the same as what was written last time should not be written again",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet:  test.NewMockGetFn(nil),
+						MockList: test.NewMockListFn(nil),
+					},
+				},
+				local: runtimeresource.ClientApplicator{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							if o, ok := obj.(*apiextensions.CustomResourceDefinition); ok {
+								established.DeepCopyInto(o)
+								return nil
+							}
+							h, _ := resource.Hash(&v1alpha1.Composition{})
+							meta.AddAnnotations(obj.(metav1.Object), map[string]string{resource.AnnotationKeySpecHash: h})
+							return nil
+						},
+						MockList: test.NewMockListFn(nil),
+					},
+					Applicator: runtimeresource.ApplyFn(func(_ context.Context, _ runtime.Object, _ ...runtimeresource.ApplyOption) error {
+						t.Errorf("Apply(...): an unchanged local object should not be written")
+						return nil
+					}),
+				},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: longWait},
+			},
+		},
+		"ConflictMarked": {
+			reason: "A local object that changed along with its remote counterpart should be kept and marked with the Manual strategy",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							obj.(metav1.Object).SetResourceVersion("2")
+							return nil
+						},
+						MockList: test.NewMockListFn(nil),
+					},
+				},
+				local: runtimeresource.ClientApplicator{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							if o, ok := obj.(*apiextensions.CustomResourceDefinition); ok {
+								established.DeepCopyInto(o)
+								return nil
+							}
+							meta.AddAnnotations(obj.(metav1.Object), map[string]string{
+								resource.AnnotationKeySourceResourceVersion: "1",
+								resource.AnnotationKeySyncedLocalHash:       "outdated",
+							})
+							return nil
+						},
+						MockUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+							if _, ok := obj.(metav1.Object).GetAnnotations()[resource.AnnotationKeySyncConflict]; !ok {
+								t.Errorf("Update(...): the local object should be marked with the conflict")
+							}
+							return nil
+						},
+						MockList: test.NewMockListFn(nil),
+					},
+					Applicator: runtimeresource.ApplyFn(func(_ context.Context, _ runtime.Object, _ ...runtimeresource.ApplyOption) error {
+						t.Errorf("Apply(...): the conflicting local object should be kept")
+						return nil
+					}),
+				},
+				opts: []ReconcilerOption{WithConflictStrategy(ConflictStrategyManual)},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: longWait},
+			},
+		},
+		"SyncRecordFailed": {
+			reason: "An error should be returned if the hash of the synced local object cannot be recorded",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{MockGet: test.NewMockGetFn(nil)},
+				},
+				local: runtimeresource.ClientApplicator{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							if o, ok := obj.(*apiextensions.CustomResourceDefinition); ok {
+								established.DeepCopyInto(o)
+							}
+							return nil
+						},
+						MockUpdate: test.NewMockUpdateFn(errBoom),
+					},
+					Applicator: runtimeresource.ApplyFn(func(_ context.Context, obj runtime.Object, _ ...runtimeresource.ApplyOption) error {
+						obj.(metav1.Object).SetGeneration(1)
+						return nil
+					}),
+				},
+				opts: []ReconcilerOption{WithConflictStrategy(ConflictStrategyLocalWins)},
+			},
+			want: want{
+				err:    resource.LocalError(errBoom, fmt.Sprintf(errFmtRecordSync, CompositionCRDName)),
 				result: reconcile.Result{RequeueAfter: shortWait},
 			},
 		},
@@ -178,7 +592,7 @@ func Test_Reconcile(t *testing.T) {
 				},
 			},
 			want: want{
-				err:    errors.Wrap(errBoom, localPrefix+fmt.Sprintf(errFmtListInstance, compositionCRDName)),
+				err:    resource.LocalError(errBoom, fmt.Sprintf(errFmtListInstance, CompositionCRDName)),
 				result: reconcile.Result{RequeueAfter: shortWait},
 			},
 		},
@@ -208,7 +622,7 @@ func Test_Reconcile(t *testing.T) {
 				},
 			},
 			want: want{
-				err:    errors.Wrap(errBoom, remotePrefix+fmt.Sprintf(errFmtListInstance, compositionCRDName)),
+				err:    resource.RemoteError(errBoom, fmt.Sprintf(errFmtListInstance, CompositionCRDName)),
 				result: reconcile.Result{RequeueAfter: shortWait},
 			},
 		},
@@ -231,7 +645,7 @@ func Test_Reconcile(t *testing.T) {
 						},
 						MockUpdate: test.NewMockUpdateFn(nil),
 						MockList: func(_ context.Context, list runtime.Object, _ ...client.ListOption) error {
-							l := &v1alpha1.CompositionList{Items: []v1alpha1.Composition{{}}}
+							l := &v1alpha1.CompositionList{Items: []v1alpha1.Composition{{ObjectMeta: metav1.ObjectMeta{Annotations: markedLongAgo}}}}
 							l.DeepCopyInto(list.(*v1alpha1.CompositionList))
 							return nil
 						},
@@ -243,7 +657,7 @@ func Test_Reconcile(t *testing.T) {
 				},
 			},
 			want: want{
-				err:    errors.Wrap(errBoom, localPrefix+fmt.Sprintf(errFmtDeleteInstance, compositionCRDName)),
+				err:    resource.LocalError(errBoom, fmt.Sprintf(errFmtDeleteInstance, CompositionCRDName)),
 				result: reconcile.Result{RequeueAfter: shortWait},
 			},
 		},
@@ -284,7 +698,8 @@ func Test_Reconcile(t *testing.T) {
 								},
 								{
 									ObjectMeta: metav1.ObjectMeta{
-										Name: "two",
+										Name:        "two",
+										Annotations: markedLongAgo,
 									},
 								},
 							}}
@@ -308,14 +723,260 @@ func Test_Reconcile(t *testing.T) {
 				result: reconcile.Result{RequeueAfter: longWait},
 			},
 		},
+		"MarkedForRemoval": {
+			reason: "Local objects that are gone from the remote cluster should be marked for removal rather than deleted right away",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet:  test.NewMockGetFn(nil),
+						MockList: test.NewMockListFn(nil),
+					},
+				},
+				local: runtimeresource.ClientApplicator{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							if o, ok := obj.(*apiextensions.CustomResourceDefinition); ok {
+								established.DeepCopyInto(o)
+							}
+							return nil
+						},
+						MockList: func(_ context.Context, list runtime.Object, _ ...client.ListOption) error {
+							l := &v1alpha1.CompositionList{Items: []v1alpha1.Composition{{ObjectMeta: metav1.ObjectMeta{Name: "one"}}}}
+							l.DeepCopyInto(list.(*v1alpha1.CompositionList))
+							return nil
+						},
+						MockUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+							if _, ok := obj.(metav1.Object).GetAnnotations()[resource.AnnotationKeyPendingRemoval]; !ok {
+								t.Errorf("\nReason: %s\nUpdate(...): the object is not marked", "Local objects that are gone from the remote cluster should be marked for removal")
+							}
+							return nil
+						},
+					},
+					Applicator: runtimeresource.ApplyFn(func(_ context.Context, _ runtime.Object, _ ...runtimeresource.ApplyOption) error {
+						return nil
+					}),
+				},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: defaultRemovalDelay},
+			},
+		},
+		"UnmarkedForRemoval": {
+			reason: "Local objects that are back in the remote cluster should no longer be marked for removal",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: test.NewMockGetFn(nil),
+						MockList: func(_ context.Context, list runtime.Object, _ ...client.ListOption) error {
+							l := &v1alpha1.CompositionList{Items: []v1alpha1.Composition{{ObjectMeta: metav1.ObjectMeta{Name: "one"}}}}
+							l.DeepCopyInto(list.(*v1alpha1.CompositionList))
+							return nil
+						},
+					},
+				},
+				local: runtimeresource.ClientApplicator{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							if o, ok := obj.(*apiextensions.CustomResourceDefinition); ok {
+								established.DeepCopyInto(o)
+							}
+							return nil
+						},
+						MockList: func(_ context.Context, list runtime.Object, _ ...client.ListOption) error {
+							l := &v1alpha1.CompositionList{Items: []v1alpha1.Composition{{ObjectMeta: metav1.ObjectMeta{Name: "one", Annotations: markedLongAgo}}}}
+							l.DeepCopyInto(list.(*v1alpha1.CompositionList))
+							return nil
+						},
+						MockUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+							if _, ok := obj.(metav1.Object).GetAnnotations()[resource.AnnotationKeyPendingRemoval]; ok {
+								t.Errorf("\nReason: %s\nUpdate(...): the object is still marked", "Local objects that are back in the remote cluster should no longer be marked for removal")
+							}
+							return nil
+						},
+					},
+					Applicator: runtimeresource.ApplyFn(func(_ context.Context, _ runtime.Object, _ ...runtimeresource.ApplyOption) error {
+						return nil
+					}),
+				},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: longWait},
+			},
+		},
+		"MaxDeletions": {
+			reason: "No more local objects than the deletion pacer admits should be deleted",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet:  test.NewMockGetFn(nil),
+						MockList: test.NewMockListFn(nil),
+					},
+				},
+				local: runtimeresource.ClientApplicator{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							if o, ok := obj.(*apiextensions.CustomResourceDefinition); ok {
+								established.DeepCopyInto(o)
+							}
+							return nil
+						},
+						MockList: func(_ context.Context, list runtime.Object, _ ...client.ListOption) error {
+							l := &v1alpha1.CompositionList{Items: []v1alpha1.Composition{
+								{ObjectMeta: metav1.ObjectMeta{Name: "one", Annotations: markedLongAgo}},
+								{ObjectMeta: metav1.ObjectMeta{Name: "two", Annotations: markedLongAgo}},
+							}}
+							l.DeepCopyInto(list.(*v1alpha1.CompositionList))
+							return nil
+						},
+						MockDelete: func() test.MockDeleteFn {
+							deleted := 0
+							return func(_ context.Context, _ runtime.Object, _ ...client.DeleteOption) error {
+								if deleted++; deleted > 1 {
+									t.Errorf("\nReason: %s\nDelete(...): called %d times", "No more local objects than the deletion pacer admits should be deleted", deleted)
+								}
+								return nil
+							}
+						}(),
+					},
+					Applicator: runtimeresource.ApplyFn(func(_ context.Context, _ runtime.Object, _ ...runtimeresource.ApplyOption) error {
+						return nil
+					}),
+				},
+				opts: []ReconcilerOption{WithDeletionPacer(rollout.NewWindow(1)), WithMaxDeletionPercentage(0)},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: defaultRemovalDelay},
+			},
+		},
+		"MaxDeletionsShared": {
+			reason: "No local objects should be deleted once the deletions of other reconciles used up the shared limit",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet:  test.NewMockGetFn(nil),
+						MockList: test.NewMockListFn(nil),
+					},
+				},
+				local: runtimeresource.ClientApplicator{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							if o, ok := obj.(*apiextensions.CustomResourceDefinition); ok {
+								established.DeepCopyInto(o)
+							}
+							return nil
+						},
+						MockList: func(_ context.Context, list runtime.Object, _ ...client.ListOption) error {
+							l := &v1alpha1.CompositionList{Items: []v1alpha1.Composition{
+								{ObjectMeta: metav1.ObjectMeta{Name: "one", Annotations: markedLongAgo}},
+								{ObjectMeta: metav1.ObjectMeta{Name: "two", Annotations: markedLongAgo}},
+							}}
+							l.DeepCopyInto(list.(*v1alpha1.CompositionList))
+							return nil
+						},
+						MockDelete: func() test.MockDeleteFn {
+							deleted := 0
+							return func(_ context.Context, _ runtime.Object, _ ...client.DeleteOption) error {
+								if deleted++; deleted > 0 {
+									t.Errorf("\nReason: %s\nDelete(...): called %d times", "No local objects should be deleted once the deletions of other reconciles used up the shared limit", deleted)
+								}
+								return nil
+							}
+						}(),
+					},
+					Applicator: runtimeresource.ApplyFn(func(_ context.Context, _ runtime.Object, _ ...runtimeresource.ApplyOption) error {
+						return nil
+					}),
+				},
+				opts: []ReconcilerOption{WithDeletionPacer(exhausted), WithMaxDeletionPercentage(0)},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: defaultRemovalDelay},
+			},
+		},
+		"DeletionBreakerOpen": {
+			reason: "No local objects should be deleted while too many of them are gone from the remote cluster",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet:  test.NewMockGetFn(nil),
+						MockList: test.NewMockListFn(nil),
+					},
+				},
+				local: runtimeresource.ClientApplicator{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							if o, ok := obj.(*apiextensions.CustomResourceDefinition); ok {
+								established.DeepCopyInto(o)
+							}
+							return nil
+						},
+						MockList: func(_ context.Context, list runtime.Object, _ ...client.ListOption) error {
+							l := &v1alpha1.CompositionList{Items: []v1alpha1.Composition{
+								{ObjectMeta: metav1.ObjectMeta{Name: "one", Annotations: markedLongAgo}},
+								{ObjectMeta: metav1.ObjectMeta{Name: "two", Annotations: markedLongAgo}},
+							}}
+							l.DeepCopyInto(list.(*v1alpha1.CompositionList))
+							return nil
+						},
+						MockDelete: func(_ context.Context, _ runtime.Object, _ ...client.DeleteOption) error {
+							t.Errorf("\nReason: %s\nDelete(...): should not be called", "No local objects should be deleted while the deletion breaker is open")
+							return nil
+						},
+					},
+					Applicator: runtimeresource.ApplyFn(func(_ context.Context, _ runtime.Object, _ ...runtimeresource.ApplyOption) error {
+						return nil
+					}),
+				},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: defaultRemovalDelay},
+			},
+		},
+		"DeletionBreakerOverridden": {
+			reason: "Local objects should be deleted if the deletion breaker is overridden",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet:  test.NewMockGetFn(nil),
+						MockList: test.NewMockListFn(nil),
+					},
+				},
+				local: runtimeresource.ClientApplicator{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							if o, ok := obj.(*apiextensions.CustomResourceDefinition); ok {
+								established.DeepCopyInto(o)
+								o.SetAnnotations(map[string]string{resource.AnnotationKeyAllowMassRemoval: "true"})
+							}
+							return nil
+						},
+						MockList: func(_ context.Context, list runtime.Object, _ ...client.ListOption) error {
+							l := &v1alpha1.CompositionList{Items: []v1alpha1.Composition{
+								{ObjectMeta: metav1.ObjectMeta{Name: "one", Annotations: markedLongAgo}},
+								{ObjectMeta: metav1.ObjectMeta{Name: "two", Annotations: markedLongAgo}},
+							}}
+							l.DeepCopyInto(list.(*v1alpha1.CompositionList))
+							return nil
+						},
+						MockDelete: test.NewMockDeleteFn(nil),
+					},
+					Applicator: runtimeresource.ApplyFn(func(_ context.Context, _ runtime.Object, _ ...runtimeresource.ApplyOption) error {
+						return nil
+					}),
+				},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: longWait},
+			},
+		},
 	}
 	for name, tc := range cases {
 		t.Run(name, func(t *testing.T) {
-			r := NewReconciler(tc.args.m, tc.args.local,
+			r := NewReconciler(tc.args.m, tc.args.local, append([]ReconcilerOption{
 				WithGetItemsFn(gi),
 				WithNewInstanceFn(ni),
 				WithNewObjectListFn(nl),
-				WithCRDName(compositionCRDName))
+				WithCRDName(CompositionCRDName)}, tc.args.opts...)...)
 			got, err := r.Reconcile(reconcile.Request{})
 
 			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
@@ -328,3 +989,47 @@ func Test_Reconcile(t *testing.T) {
 		})
 	}
 }
+
+func BenchmarkReconcile(b *testing.B) {
+	l := &v1alpha1.CompositionList{Items: make([]v1alpha1.Composition, 500)}
+	for i := range l.Items {
+		l.Items[i].SetName(fmt.Sprintf("composition-%d", i))
+	}
+	list := func(_ context.Context, obj runtime.Object, _ ...client.ListOption) error {
+		l.DeepCopyInto(obj.(*v1alpha1.CompositionList))
+		return nil
+	}
+	m := &fake.Manager{
+		Client: &test.MockClient{
+			MockGet:  test.NewMockGetFn(nil),
+			MockList: list,
+		},
+	}
+	local := runtimeresource.ClientApplicator{
+		Client: &test.MockClient{
+			MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+				if o, ok := obj.(*apiextensions.CustomResourceDefinition); ok {
+					established.DeepCopyInto(o)
+				}
+				return nil
+			},
+			MockList: list,
+		},
+		Applicator: runtimeresource.ApplyFn(func(_ context.Context, _ runtime.Object, _ ...runtimeresource.ApplyOption) error {
+			return nil
+		}),
+	}
+	r := NewReconciler(m, local,
+		WithGetItemsFn(gi),
+		WithNewInstanceFn(ni),
+		WithNewObjectListFn(nl),
+		WithCRDName(CompositionCRDName))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := r.Reconcile(reconcile.Request{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
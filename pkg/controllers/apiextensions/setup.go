@@ -17,35 +17,279 @@ limitations under the License.
 package apiextensions
 
 import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	kcontroller "sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	"github.com/crossplane/crossplane-runtime/pkg/logging"
 	runtimeresource "github.com/crossplane/crossplane-runtime/pkg/resource"
 	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
+
+	"github.com/crossplane/agent/pkg/resource"
+	"github.com/crossplane/agent/pkg/rollout"
+	"github.com/crossplane/agent/pkg/schedule"
+	"github.com/crossplane/agent/pkg/startup"
 )
 
 const (
 	maxConcurrency = 5
 
-	xrdCRDName         = "compositeresourcedefinitions.apiextensions.crossplane.io"
-	compositionCRDName = "compositions.apiextensions.crossplane.io"
+	// XRDCRDName and CompositionCRDName are the names of the CRDs of the
+	// types that are always synced.
+	XRDCRDName         = "compositeresourcedefinitions.apiextensions.crossplane.io"
+	CompositionCRDName = "compositions.apiextensions.crossplane.io"
+
+	// StoreConfigCRDName is the name of the CRD of StoreConfigs, which has to
+	// be synced to the local cluster before the StoreConfigs themselves.
+	StoreConfigCRDName = "storeconfigs.secrets.crossplane.io"
+
+	// EnvironmentConfigType is the type of the EnvironmentConfigs of newer
+	// Crossplane versions in resource.version.group format, see
+	// ParseClusterType.
+	EnvironmentConfigType = "environmentconfigs.v1alpha1.apiextensions.crossplane.io"
+
+	errFmtInvalidClusterType    = "invalid type %q, must be in resource.version.group format"
+	errFmtMapClusterType        = "cannot find type %q in the remote cluster"
+	errFmtNamespacedClusterType = "type %q is namespaced, only cluster-scoped types can be synced"
 )
 
+// StoreConfigGroupVersionKind is the type of the secret store configurations
+// used by newer Crossplane versions to publish connection details to external
+// secret stores. This version of Crossplane doesn't ship its Go types, so
+// StoreConfigs are synced as unstructured objects.
+var StoreConfigGroupVersionKind = schema.GroupVersionKind{Group: "secrets.crossplane.io", Version: "v1alpha1", Kind: "StoreConfig"}
+
+// SetupOption is used to configure the controllers added by the Setup
+// functions.
+type SetupOption func(*setupOptions)
+
+// WithLocalCRDSource specifies the source of the events of the
+// CustomResourceDefinitions in the local cluster. The synced objects are
+// requeued as soon as their CRD becomes established in the local cluster
+// instead of being retried blindly until it is.
+func WithLocalCRDSource(src source.Source) SetupOption {
+	return func(o *setupOptions) {
+		o.localCRDs = src
+	}
+}
+
+// WithPreservedLocalAnnotations specifies the annotations of the objects in
+// the local cluster that shouldn't be overridden by the ones in the remote
+// cluster, e.g. the ones GitOps tools manage.
+func WithPreservedLocalAnnotations(p resource.PreservedAnnotations) SetupOption {
+	return func(o *setupOptions) {
+		o.preserved = p
+	}
+}
+
+// WithLocalMetadataEqualizer specifies how the labels and annotations of the
+// objects in the local cluster should be equalized with the ones in the remote
+// cluster, see resource.MetadataStrategy.
+func WithLocalMetadataEqualizer(e resource.MetadataEqualizer) SetupOption {
+	return func(o *setupOptions) {
+		o.equalizer = e
+	}
+}
+
+// WithDeletionLimits specifies how many local objects may be deleted per
+// removal delay across all the synced types and the share of the local objects
+// of a type, in percent, that may be gone from the remote cluster at once
+// before their deletions are halted. The controllers set up with the returned
+// option share the deletion limit. See WithDeletionPacer and
+// WithMaxDeletionPercentage.
+func WithDeletionLimits(limit, percentage int) SetupOption {
+	var p Pacer
+	if limit > 0 {
+		p = rollout.NewWindow(limit, rollout.WithInterval(defaultRemovalDelay))
+	}
+	return func(o *setupOptions) {
+		o.limits = []ReconcilerOption{WithDeletionPacer(p), WithMaxDeletionPercentage(percentage)}
+	}
+}
+
+// WithSourceClusterName specifies the name of the remote cluster that the
+// synced objects are annotated with in the local cluster.
+func WithSourceClusterName(name string) SetupOption {
+	return func(o *setupOptions) {
+		o.cluster = name
+	}
+}
+
+// WithInitialSyncGate specifies the Gate that tracks the initial sync of the
+// agent. The objects that exist in the remote cluster when it starts have to
+// be synced for the initial sync to be complete.
+func WithInitialSyncGate(g *startup.Gate) SetupOption {
+	return func(o *setupOptions) {
+		o.gate = g
+	}
+}
+
+// WithTransformer specifies how the objects synced from the remote cluster
+// are transformed before they're applied to the local cluster.
+func WithTransformer(t Transformer) SetupOption {
+	return func(o *setupOptions) {
+		o.transformer = t
+	}
+}
+
+// WithLocalOwner specifies the object that owns the synced objects in the
+// local cluster, e.g. a SyncedBundle, so that deleting it deletes all of them.
+func WithLocalOwner(fn OwnerFn) SetupOption {
+	return func(o *setupOptions) {
+		o.owner = fn
+	}
+}
+
+// WithSyncScheduler specifies the Scheduler that decides when the synced
+// objects are synced next.
+func WithSyncScheduler(s schedule.Scheduler) SetupOption {
+	return func(o *setupOptions) {
+		o.scheduler = s
+	}
+}
+
+// WithCompositionRollout specifies the Pacer that the updates of the
+// Compositions in the local cluster have to wait for, so that a batch of
+// Compositions updated at once in the remote cluster is rolled out gradually.
+// The other synced types aren't paced.
+func WithCompositionRollout(p Pacer) SetupOption {
+	return func(o *setupOptions) {
+		o.compositionPacer = p
+	}
+}
+
+// WithSyncConflictStrategy specifies what the Reconcilers do when both a
+// local object and its remote counterpart changed since the last sync.
+func WithSyncConflictStrategy(s ConflictStrategy) SetupOption {
+	return func(o *setupOptions) {
+		o.conflicts = s
+	}
+}
+
+type setupOptions struct {
+	localCRDs source.Source
+	preserved resource.PreservedAnnotations
+	equalizer resource.MetadataEqualizer
+	limits    []ReconcilerOption
+	cluster   string
+	gate      *startup.Gate
+
+	transformer Transformer
+	owner       OwnerFn
+	scheduler   schedule.Scheduler
+
+	compositionPacer Pacer
+	conflicts        ConflictStrategy
+}
+
+func newSetupOptions(opts []SetupOption) *setupOptions {
+	o := &setupOptions{}
+	for _, f := range opts {
+		f(o)
+	}
+	return o
+}
+
+func (o *setupOptions) reconcilerOptions() []ReconcilerOption {
+	var ro []ReconcilerOption
+	if o.localCRDs != nil {
+		ro = append(ro, WithCRDWatched())
+	}
+	if len(o.preserved) > 0 {
+		ro = append(ro, WithPreservedAnnotations(o.preserved))
+	}
+	if o.equalizer != nil {
+		ro = append(ro, WithMetadataEqualizer(o.equalizer))
+	}
+	if o.cluster != "" {
+		ro = append(ro, WithSourceCluster(o.cluster))
+	}
+	if o.gate != nil {
+		ro = append(ro, WithSyncGate(o.gate))
+	}
+	if o.transformer != nil {
+		ro = append(ro, WithObjectTransformer(o.transformer))
+	}
+	if o.owner != nil {
+		ro = append(ro, WithOwner(o.owner))
+	}
+	if o.scheduler != nil {
+		ro = append(ro, WithScheduler(o.scheduler))
+	}
+	if o.conflicts != "" {
+		ro = append(ro, WithConflictStrategy(o.conflicts))
+	}
+	return append(ro, o.limits...)
+}
+
+// expect adds the objects of the type with the given CRD name in the remote
+// cluster to the initial sync.
+func (o *setupOptions) expect(remote client.Reader, crdName string, nl func() runtime.Object, gi func(l runtime.Object) []runtimeresource.Object) {
+	if o.gate == nil {
+		return
+	}
+	o.gate.Expect(crdName, func(ctx context.Context) ([]string, error) {
+		l := nl()
+		if err := remote.List(ctx, l); err != nil {
+			return nil, err
+		}
+		items := gi(l)
+		names := make([]string, len(items))
+		for i, obj := range items {
+			names[i] = obj.GetName()
+		}
+		return names, nil
+	})
+}
+
+// watch adds a watch for the local CRD with the given name that enqueues all
+// the objects of its type in the remote cluster once it becomes established.
+func (o *setupOptions) watch(b *builder.Builder, remote client.Reader, crdName string, nl func() runtime.Object, gi func(l runtime.Object) []runtimeresource.Object) *builder.Builder {
+	if o.localCRDs == nil {
+		return b
+	}
+	mapper := handler.ToRequestsFunc(func(a handler.MapObject) []reconcile.Request {
+		if a.Meta.GetName() != crdName {
+			return nil
+		}
+		l := nl()
+		if err := remote.List(context.Background(), l); err != nil {
+			return nil
+		}
+		items := gi(l)
+		result := make([]reconcile.Request, len(items))
+		for i, obj := range items {
+			result[i] = reconcile.Request{NamespacedName: types.NamespacedName{Name: obj.GetName()}}
+		}
+		return result
+	})
+	return b.Watches(o.localCRDs, &handler.EnqueueRequestsFromMapFunc{ToRequests: mapper}, builder.WithPredicates(resource.NewEstablishedFilter()))
+}
+
 // SetupXRDSync adds a controller that syncs CompositeResourceDefinitions from
 // remote cluster to local cluster.
-func SetupXRDSync(mgr ctrl.Manager, localClient client.Client, log logging.Logger) error {
+func SetupXRDSync(mgr ctrl.Manager, localClient client.Client, log logging.Logger, opts ...SetupOption) error {
 	name := "CompositeResourceDefinitions"
 
 	nl := func() runtime.Object { return &v1alpha1.CompositeResourceDefinitionList{} }
 	gi := func(l runtime.Object) []runtimeresource.Object {
 		list, _ := l.(*v1alpha1.CompositeResourceDefinitionList)
 		result := make([]runtimeresource.Object, len(list.Items))
-		for i, val := range list.Items {
-			obj, _ := val.DeepCopyObject().(runtimeresource.Object)
-			result[i] = obj
+		for i := range list.Items {
+			result[i] = &list.Items[i]
 		}
 		return result
 	}
@@ -55,33 +299,137 @@ func SetupXRDSync(mgr ctrl.Manager, localClient client.Client, log logging.Logge
 		Applicator: runtimeresource.NewAPIPatchingApplicator(localClient),
 	}
 
+	so := newSetupOptions(opts)
 	r := NewReconciler(mgr,
 		ca,
-		WithLogger(log.WithValues("controller", name)),
-		WithCRDName(xrdCRDName),
-		WithNewInstanceFn(ni),
-		WithNewObjectListFn(nl),
-		WithGetItemsFn(gi))
+		append([]ReconcilerOption{
+			WithLogger(log.WithValues("controller", name)),
+			WithCRDName(XRDCRDName),
+			WithNewInstanceFn(ni),
+			WithNewObjectListFn(nl),
+			WithGetItemsFn(gi),
+		}, so.reconcilerOptions()...)...)
 
-	return ctrl.NewControllerManagedBy(mgr).
+	b := ctrl.NewControllerManagedBy(mgr).
 		Named(name).
 		For(&v1alpha1.CompositeResourceDefinition{}).
-		WithOptions(kcontroller.Options{MaxConcurrentReconciles: maxConcurrency}).
-		Complete(r)
+		WithOptions(kcontroller.Options{MaxConcurrentReconciles: maxConcurrency})
+	so.expect(mgr.GetClient(), XRDCRDName, nl, gi)
+	return so.watch(b, mgr.GetClient(), XRDCRDName, nl, gi).Complete(r)
+}
+
+// SetupStoreConfigSync adds a controller that syncs StoreConfigs from remote
+// cluster to local cluster. Like all synced types, the local copies are
+// overridden with the remote ones and deleted once they're gone from the remote
+// cluster, i.e. they're read-only in the local cluster.
+func SetupStoreConfigSync(mgr ctrl.Manager, localClient client.Client, log logging.Logger, opts ...SetupOption) error {
+	return SetupClusterTypeSync(ClusterType{GroupVersionKind: StoreConfigGroupVersionKind, CRDName: StoreConfigCRDName})(mgr, localClient, log, opts...)
+}
+
+// A ClusterType is a cluster-scoped type of the remote cluster whose objects
+// are synced to the local cluster as unstructured objects, e.g. the
+// EnvironmentConfigs that claim authors reference.
+type ClusterType struct {
+	schema.GroupVersionKind
+
+	// CRDName is the name of the CRD of the type, which has to be synced to
+	// the local cluster before the objects themselves.
+	CRDName string
+}
+
+// ParseClusterType parses a type in resource.version.group format, e.g.
+// environmentconfigs.v1alpha1.apiextensions.crossplane.io, and looks up its
+// kind with the supplied RESTMapper of the remote cluster.
+func ParseClusterType(s string, m meta.RESTMapper) (ClusterType, error) {
+	gvr, _ := schema.ParseResourceArg(s)
+	if gvr == nil {
+		return ClusterType{}, errors.Errorf(errFmtInvalidClusterType, s)
+	}
+	gvk, err := m.KindFor(*gvr)
+	if err != nil {
+		return ClusterType{}, errors.Wrapf(err, errFmtMapClusterType, s)
+	}
+	mapping, err := m.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return ClusterType{}, errors.Wrapf(err, errFmtMapClusterType, s)
+	}
+	if mapping.Scope.Name() != meta.RESTScopeNameRoot {
+		return ClusterType{}, errors.Errorf(errFmtNamespacedClusterType, s)
+	}
+	return ClusterType{GroupVersionKind: gvk, CRDName: gvr.GroupResource().String()}, nil
+}
+
+// ClusterTypeControllerName returns the name of the controller that syncs the
+// objects of the supplied type. It's derived from the whole type so that it
+// doesn't collide with the names of the other controllers of the agent, e.g.
+// when a type of another group has the kind of a type that is always synced.
+func ClusterTypeControllerName(gvk schema.GroupVersionKind) string {
+	return strings.TrimSuffix("clustertype/"+strings.ToLower(gvk.Kind)+"."+gvk.Version+"."+gvk.Group, ".")
+}
+
+// SetupClusterTypeSync returns a function that adds a controller that syncs
+// the objects of the supplied type from remote cluster to local cluster. Like
+// all synced types, the local copies are overridden with the remote ones and
+// deleted once they're gone from the remote cluster, i.e. they're read-only
+// in the local cluster.
+func SetupClusterTypeSync(t ClusterType) func(mgr ctrl.Manager, localClient client.Client, log logging.Logger, opts ...SetupOption) error {
+	return func(mgr ctrl.Manager, localClient client.Client, log logging.Logger, opts ...SetupOption) error {
+		name := ClusterTypeControllerName(t.GroupVersionKind)
+
+		nl := func() runtime.Object {
+			l := &unstructured.UnstructuredList{}
+			l.SetGroupVersionKind(t.GroupVersion().WithKind(t.Kind + "List"))
+			return l
+		}
+		gi := func(l runtime.Object) []runtimeresource.Object {
+			list, _ := l.(*unstructured.UnstructuredList)
+			result := make([]runtimeresource.Object, len(list.Items))
+			for i := range list.Items {
+				result[i] = &list.Items[i]
+			}
+			return result
+		}
+		ni := func() runtimeresource.Object {
+			u := &unstructured.Unstructured{}
+			u.SetGroupVersionKind(t.GroupVersionKind)
+			return u
+		}
+		ca := runtimeresource.ClientApplicator{
+			Client:     localClient,
+			Applicator: runtimeresource.NewAPIPatchingApplicator(localClient),
+		}
+
+		so := newSetupOptions(opts)
+		r := NewReconciler(mgr,
+			ca,
+			append([]ReconcilerOption{
+				WithLogger(log.WithValues("controller", name)),
+				WithCRDName(t.CRDName),
+				WithNewInstanceFn(ni),
+				WithNewObjectListFn(nl),
+				WithGetItemsFn(gi),
+			}, so.reconcilerOptions()...)...)
+
+		b := ctrl.NewControllerManagedBy(mgr).
+			Named(name).
+			For(ni()).
+			WithOptions(kcontroller.Options{MaxConcurrentReconciles: maxConcurrency})
+		so.expect(mgr.GetClient(), t.CRDName, nl, gi)
+		return so.watch(b, mgr.GetClient(), t.CRDName, nl, gi).Complete(r)
+	}
 }
 
 // SetupCompositionSync adds a controller that syncs Compositions from
 // remote cluster to local cluster.
-func SetupCompositionSync(mgr ctrl.Manager, localClient client.Client, log logging.Logger) error {
+func SetupCompositionSync(mgr ctrl.Manager, localClient client.Client, log logging.Logger, opts ...SetupOption) error {
 	name := "Compositions"
 
 	nl := func() runtime.Object { return &v1alpha1.CompositionList{} }
 	gi := func(l runtime.Object) []runtimeresource.Object {
 		list, _ := l.(*v1alpha1.CompositionList)
 		result := make([]runtimeresource.Object, len(list.Items))
-		for i, val := range list.Items {
-			obj, _ := val.DeepCopyObject().(runtimeresource.Object)
-			result[i] = obj
+		for i := range list.Items {
+			result[i] = &list.Items[i]
 		}
 		return result
 	}
@@ -91,17 +439,25 @@ func SetupCompositionSync(mgr ctrl.Manager, localClient client.Client, log loggi
 		Applicator: runtimeresource.NewAPIPatchingApplicator(localClient),
 	}
 
+	so := newSetupOptions(opts)
+	ro := so.reconcilerOptions()
+	if so.compositionPacer != nil {
+		ro = append(ro, WithUpdatePacer(so.compositionPacer))
+	}
 	r := NewReconciler(mgr,
 		ca,
-		WithLogger(log.WithValues("controller", name)),
-		WithCRDName(compositionCRDName),
-		WithNewInstanceFn(ni),
-		WithNewObjectListFn(nl),
-		WithGetItemsFn(gi))
+		append([]ReconcilerOption{
+			WithLogger(log.WithValues("controller", name)),
+			WithCRDName(CompositionCRDName),
+			WithNewInstanceFn(ni),
+			WithNewObjectListFn(nl),
+			WithGetItemsFn(gi),
+		}, ro...)...)
 
-	return ctrl.NewControllerManagedBy(mgr).
+	b := ctrl.NewControllerManagedBy(mgr).
 		Named(name).
 		For(&v1alpha1.Composition{}).
-		WithOptions(kcontroller.Options{MaxConcurrentReconciles: maxConcurrency}).
-		Complete(r)
+		WithOptions(kcontroller.Options{MaxConcurrentReconciles: maxConcurrency})
+	so.expect(mgr.GetClient(), CompositionCRDName, nl, gi)
+	return so.watch(b, mgr.GetClient(), CompositionCRDName, nl, gi).Complete(r)
 }
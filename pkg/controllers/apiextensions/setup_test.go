@@ -0,0 +1,104 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apiextensions
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+)
+
+func TestParseClusterType(t *testing.T) {
+	env := schema.GroupVersionKind{Group: "apiextensions.crossplane.io", Version: "v1alpha1", Kind: "EnvironmentConfig"}
+	db := schema.GroupVersionKind{Group: "example.org", Version: "v1alpha1", Kind: "Database"}
+	m := meta.NewDefaultRESTMapper(nil)
+	m.Add(env, meta.RESTScopeRoot)
+	m.Add(db, meta.RESTScopeNamespace)
+
+	type want struct {
+		t   ClusterType
+		err error
+	}
+	cases := map[string]struct {
+		reason string
+		s      string
+		want   want
+	}{
+		"Parsed": {
+			reason: "The kind and the CRD name of the type should be found",
+			s:      EnvironmentConfigType,
+			want:   want{t: ClusterType{GroupVersionKind: env, CRDName: "environmentconfigs.apiextensions.crossplane.io"}},
+		},
+		"Invalid": {
+			reason: "Types without a version and group should be rejected",
+			s:      "environmentconfigs",
+			want:   want{err: errors.Errorf(errFmtInvalidClusterType, "environmentconfigs")},
+		},
+		"Namespaced": {
+			reason: "Namespaced types should be rejected",
+			s:      "databases.v1alpha1.example.org",
+			want:   want{err: errors.Errorf(errFmtNamespacedClusterType, "databases.v1alpha1.example.org")},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseClusterType(tc.s, m)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\nParseClusterType(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.t, got); diff != "" {
+				t.Errorf("\nReason: %s\nParseClusterType(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestClusterTypeControllerName(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		gvk    schema.GroupVersionKind
+		want   string
+	}{
+		"Grouped": {
+			reason: "The name should be made of the kind, version and group of the type.",
+			gvk:    schema.GroupVersionKind{Group: "apiextensions.crossplane.io", Version: "v1alpha1", Kind: "EnvironmentConfig"},
+			want:   "clustertype/environmentconfig.v1alpha1.apiextensions.crossplane.io",
+		},
+		"SameKind": {
+			reason: "The name of a type that has the kind of a type that is always synced should not collide with its controller.",
+			gvk:    schema.GroupVersionKind{Group: "example.org", Version: "v1", Kind: "Composition"},
+			want:   "clustertype/composition.v1.example.org",
+		},
+		"Core": {
+			reason: "The name of a type of the core group should not end with a dot.",
+			gvk:    schema.GroupVersionKind{Version: "v1", Kind: "PersistentVolume"},
+			want:   "clustertype/persistentvolume.v1",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, ClusterTypeControllerName(tc.gvk)); diff != "" {
+				t.Errorf("\n%s\nClusterTypeControllerName(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -17,22 +17,35 @@ limitations under the License.
 package claim
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
 
 	"github.com/pkg/errors"
 	v1 "k8s.io/api/core/v1"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kunstructured "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
-
 	"k8s.io/apimachinery/pkg/util/json"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
 
 	"github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
 	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
 	"github.com/crossplane/crossplane-runtime/pkg/meta"
 	runtimeresource "github.com/crossplane/crossplane-runtime/pkg/resource"
 	"github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/claim"
+	"github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/composite"
+	xv1alpha1 "github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
 
+	"github.com/crossplane/agent/pkg/encryption"
+	"github.com/crossplane/agent/pkg/openapi"
 	"github.com/crossplane/agent/pkg/resource"
 )
 
@@ -44,6 +57,14 @@ func (p PropagateFn) Propagate(ctx context.Context, local, remote *claim.Unstruc
 	return p(ctx, local, remote)
 }
 
+// ConfigureFn is used to construct a Configurator with a bare function.
+type ConfigureFn func(ctx context.Context, local, remote *claim.Unstructured) error
+
+// Configure calls the supplied function.
+func (c ConfigureFn) Configure(ctx context.Context, local, remote *claim.Unstructured) error {
+	return c(ctx, local, remote)
+}
+
 // NewPropagatorChain returns a new PropagatorChain.
 func NewPropagatorChain(p ...Propagator) PropagatorChain {
 	return PropagatorChain(p)
@@ -62,27 +83,351 @@ func (pp PropagatorChain) Propagate(ctx context.Context, local, remote *claim.Un
 	return nil
 }
 
+// KeyMapper maps the key of an object in the local cluster to the key of its
+// counterpart in the remote cluster.
+type KeyMapper interface {
+	RemoteKey(local types.NamespacedName) types.NamespacedName
+}
+
+// KeyMapperFn is used to provide a single function instead of a full object to
+// satisfy KeyMapper interface.
+type KeyMapperFn func(local types.NamespacedName) types.NamespacedName
+
+// RemoteKey calls KeyMapperFn it belongs to.
+func (fn KeyMapperFn) RemoteKey(local types.NamespacedName) types.NamespacedName {
+	return fn(local)
+}
+
+// NewIdentityKeyMapper returns a KeyMapper that maps local objects to remote
+// objects with the same namespace and name.
+func NewIdentityKeyMapper() KeyMapperFn {
+	return func(local types.NamespacedName) types.NamespacedName { return local }
+}
+
+// NewNamespaceKeyMapper returns a KeyMapper that maps all local objects into
+// the given remote namespace. The local namespace is prepended to the name so
+// objects with the same name in different local namespaces don't collide. They
+// are joined with a dot, which namespaces can't contain, so that no two local
+// keys map to the same remote one. It is used when the remote cluster is the
+// same cluster as the local one.
+func NewNamespaceKeyMapper(namespace string) KeyMapperFn {
+	return func(local types.NamespacedName) types.NamespacedName {
+		return types.NamespacedName{Namespace: namespace, Name: local.Namespace + "." + local.Name}
+	}
+}
+
+// LocalNameOf returns the name of the object in the supplied local namespace
+// that a KeyMapper returned by NewNamespaceKeyMapper maps to the supplied
+// remote name, or false if it maps none of them to it.
+func LocalNameOf(namespace, remote string) (string, bool) {
+	if !strings.HasPrefix(remote, namespace+".") {
+		return "", false
+	}
+	return strings.TrimPrefix(remote, namespace+"."), true
+}
+
+// DefaultConfiguratorOption is used to configure *DefaultConfigurator.
+type DefaultConfiguratorOption func(*DefaultConfigurator)
+
+// WithConfiguratorKeyMapper specifies how the DefaultConfigurator should map
+// the identity of the local claim and its connection secret to the remote ones.
+func WithConfiguratorKeyMapper(m KeyMapper) DefaultConfiguratorOption {
+	return func(dc *DefaultConfigurator) {
+		dc.mapper = m
+	}
+}
+
+// WithStampedLabels specifies the labels that the DefaultConfigurator should
+// add to all remote claims, e.g. to identify the team, environment or priority
+// of this cluster to the policies of the central cluster. They take precedence
+// over the labels of the local claim with the same keys.
+func WithStampedLabels(l map[string]string) DefaultConfiguratorOption {
+	return func(dc *DefaultConfigurator) {
+		dc.labels = l
+	}
+}
+
+// WithClusterLabel specifies the name of this cluster in the remote cluster,
+// which the DefaultConfigurator should label all remote claims with, see
+// resource.LabelKeyCluster.
+func WithClusterLabel(cluster string) DefaultConfiguratorOption {
+	return func(dc *DefaultConfigurator) {
+		dc.cluster = cluster
+	}
+}
+
+// WithStampedAnnotations specifies the annotations that the DefaultConfigurator
+// should add to all remote claims. They take precedence over the annotations
+// of the local claim with the same keys.
+func WithStampedAnnotations(a map[string]string) DefaultConfiguratorOption {
+	return func(dc *DefaultConfigurator) {
+		dc.annotations = a
+	}
+}
+
+// WithPreservedAnnotations specifies the annotations of the local claim that
+// the DefaultConfigurator shouldn't copy to the remote claim, e.g. the ones
+// GitOps tools manage. The remote claim keeps its own values for them.
+func WithPreservedAnnotations(p resource.PreservedAnnotations) DefaultConfiguratorOption {
+	return func(dc *DefaultConfigurator) {
+		dc.preserved = p
+	}
+}
+
+// WithRequesterAttribution makes the DefaultConfigurator annotate the remote
+// claims with the requester of their local claims, see Requester.
+func WithRequesterAttribution() DefaultConfiguratorOption {
+	return func(dc *DefaultConfigurator) {
+		dc.attribute = true
+	}
+}
+
 // NewDefaultConfigurator returns a new DefaultConfigurator.
-func NewDefaultConfigurator() *DefaultConfigurator {
-	return &DefaultConfigurator{}
+func NewDefaultConfigurator(opts ...DefaultConfiguratorOption) *DefaultConfigurator {
+	dc := &DefaultConfigurator{mapper: NewIdentityKeyMapper()}
+	for _, f := range opts {
+		f(dc)
+	}
+	return dc
 }
 
 // DefaultConfigurator configures ObjectMeta and Spec of the remote instance with
 // the information from the local instance.
-type DefaultConfigurator struct{}
+type DefaultConfigurator struct {
+	mapper      KeyMapper
+	labels      map[string]string
+	annotations map[string]string
+	preserved   resource.PreservedAnnotations
+	cluster     string
+	attribute   bool
+}
 
 // Configure copies spec and user-defined metadata from local object to the remote one.
 func (sp *DefaultConfigurator) Configure(_ context.Context, local, remote *claim.Unstructured) error {
-	remote.SetName(local.GetName())
-	remote.SetNamespace(local.GetNamespace())
+	nn := RemoteKeyOf(sp.mapper, local)
+	existing := remote.GetWriteConnectionSecretToReference()
+	existingPublished := publishedSecretName(remote)
+	existingExternalName := meta.GetExternalName(remote)
+	remote.SetName(nn.Name)
+	remote.SetNamespace(nn.Namespace)
 	remote.SetAnnotations(local.GetAnnotations())
 	remote.SetLabels(local.GetLabels())
+	sp.preserved.Strip(remote)
+	meta.AddAnnotations(remote, sp.annotations)
+	meta.AddLabels(remote, sp.labels)
+	SetRemoteOwner(remote, types.NamespacedName{Namespace: local.GetNamespace(), Name: local.GetName()}, sp.cluster)
+	// The requester is only ever recorded by the agent, so the one that the
+	// author of the local claim may have set isn't copied.
+	meta.RemoveAnnotations(remote, resource.AnnotationKeyRequestedBy)
+	if u := Requester(local); sp.attribute && u != "" {
+		meta.AddAnnotations(remote, map[string]string{resource.AnnotationKeyRequestedBy: u})
+	}
+	if err := configureExternalName(local, remote, existingExternalName); err != nil {
+		return err
+	}
 	spec, err := fieldpath.Pave(local.GetUnstructured().UnstructuredContent()).GetValue("spec")
 	if err != nil {
+		return runtimeresource.Ignore(fieldpath.IsNotFound, err)
+	}
+	if err := fieldpath.Pave(remote.GetUnstructured().UnstructuredContent()).SetValue("spec", spec); err != nil {
 		return err
 	}
-	err = fieldpath.Pave(remote.GetUnstructured().UnstructuredContent()).SetValue("spec", spec)
-	return err
+	// The connection secret of the remote claim is written to the namespace of
+	// the remote claim, so its name needs to be mapped as well.
+	// The remote claim of a transferred claim keeps its connection secret,
+	// which is named after the claim it was transferred from.
+	if ref := local.GetWriteConnectionSecretToReference(); ref != nil {
+		snn := sp.mapper.RemoteKey(types.NamespacedName{Namespace: local.GetNamespace(), Name: ref.Name})
+		if _, ok := local.GetAnnotations()[resource.AnnotationKeyRemoteClaim]; ok && existing != nil {
+			snn.Name = existing.Name
+		}
+		remote.SetWriteConnectionSecretToReference(&v1alpha1.LocalSecretReference{Name: snn.Name})
+	}
+	if err := configurePublishConnectionDetailsTo(sp.mapper, local, remote, existingPublished); err != nil {
+		return err
+	}
+	return configureCompositionRevision(local, remote)
+}
+
+// Requester returns who requested the supplied local claim, which is the field
+// manager that set the spec of the claim first according to its managed
+// fields, e.g. kubectl-client-side-apply or argocd-controller, since the
+// managed fields don't record the users themselves. The annotations of the
+// claim aren't consulted since its author controls them. An empty string is
+// returned if it's not known.
+func Requester(local metav1.Object) string {
+	var first *metav1.ManagedFieldsEntry
+	mf := local.GetManagedFields()
+	for i := range mf {
+		e := &mf[i]
+		if e.Manager == "" || e.FieldsV1 == nil || !bytes.Contains(e.FieldsV1.Raw, []byte(`"f:spec"`)) {
+			continue
+		}
+		if first == nil || (e.Time != nil && (first.Time == nil || e.Time.Before(first.Time))) {
+			first = e
+		}
+	}
+	if first == nil {
+		return ""
+	}
+	return first.Manager
+}
+
+// configureExternalName sets the external name of the remote claim given the
+// one the existing remote claim had. The external name of the local claim is
+// copied to a remote claim that doesn't have one yet. The external name of the
+// remote claim is kept when the local claim doesn't have one, whatever the
+// metadata strategy and the preserved annotations are, and copied back to the
+// local claim by the LateInitializer. It's never changed, since that would
+// point the claim at other cloud resources, so a local claim with another one
+// fails to sync until it's reverted.
+func configureExternalName(local, remote *claim.Unstructured, existing string) error {
+	desired := meta.GetExternalName(local)
+	if existing == "" {
+		if desired != "" {
+			meta.SetExternalName(remote, desired)
+		}
+		return nil
+	}
+	if desired != "" && desired != existing {
+		return errors.Errorf(errFmtChangeExternalName, existing, desired)
+	}
+	meta.SetExternalName(remote, existing)
+	return nil
+}
+
+// configureCompositionRevision sets the composition update policy and the
+// pinned composition revision of the remote claim from the annotations of the
+// local claim. The remote claim is left as the spec of the local claim has it
+// if the annotations aren't there; see UnpinCompositionRevision for when
+// they're removed.
+func configureCompositionRevision(local, remote *claim.Unstructured) error {
+	a := local.GetAnnotations()
+	p := fieldpath.Pave(remote.GetUnstructured().UnstructuredContent())
+	if policy, ok := a[resource.AnnotationKeyCompositionUpdatePolicy]; ok {
+		if policy != resource.CompositionUpdatePolicyAutomatic && policy != resource.CompositionUpdatePolicyManual {
+			return errors.Errorf(errFmtUpdatePolicy, policy)
+		}
+		if err := p.SetValue("spec.compositionUpdatePolicy", policy); err != nil {
+			return err
+		}
+	}
+	if rev, ok := a[resource.AnnotationKeyCompositionRevision]; ok && rev != "" {
+		if err := p.SetValue("spec.compositionRevisionRef", map[string]interface{}{"name": rev}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compositionRevisionFields are the fields of the spec of a remote claim that
+// are set from the annotations of its local claim, by annotation.
+var compositionRevisionFields = map[string]string{
+	resource.AnnotationKeyCompositionUpdatePolicy: "compositionUpdatePolicy",
+	resource.AnnotationKeyCompositionRevision:     "compositionRevisionRef",
+}
+
+// UnpinCompositionRevision returns a JSON merge patch that removes the
+// composition update policy and the composition revision reference that the
+// supplied current remote claim got from the annotations of its local claim
+// once they're removed from the local claim, along with the copies of the
+// annotations. A merge patch of the desired remote claim doesn't remove them
+// since it only has the keys that are set. The fields that the spec of the
+// local claim sets are kept. It returns nil if there's nothing to remove.
+func UnpinCompositionRevision(local *claim.Unstructured, current metav1.Object) client.Patch {
+	la, ca := local.GetAnnotations(), current.GetAnnotations()
+	spec, _, _ := kunstructured.NestedMap(local.UnstructuredContent(), "spec")
+	annotations := map[string]interface{}{}
+	fields := map[string]interface{}{}
+	for k, f := range compositionRevisionFields {
+		if _, ok := ca[k]; !ok {
+			continue
+		}
+		if _, ok := la[k]; ok {
+			continue
+		}
+		annotations[k] = nil
+		if _, ok := spec[f]; !ok {
+			fields[f] = nil
+		}
+	}
+	if len(annotations) == 0 {
+		return nil
+	}
+	patch := map[string]interface{}{"metadata": map[string]interface{}{"annotations": annotations}}
+	if len(fields) > 0 {
+		patch["spec"] = fields
+	}
+	// The patch consists of strings and nulls, so it's always marshalled.
+	data, _ := json.Marshal(patch)
+	return client.RawPatch(types.MergePatchType, data)
+}
+
+// An IgnoredFieldsFn returns the field paths of the claims that should be left
+// untouched on the remote instances once they exist.
+type IgnoredFieldsFn func(ctx context.Context) ([]string, error)
+
+// NewXRDIgnoredFields returns an IgnoredFieldsFn that reads the field paths
+// from the ignore-fields annotation of the CompositeResourceDefinition with
+// the supplied name every time it's called, so that changes to the annotation
+// take effect on the next sync of every claim.
+func NewXRDIgnoredFields(kube client.Reader, name string) IgnoredFieldsFn {
+	return func(ctx context.Context) ([]string, error) {
+		xrd := &xv1alpha1.CompositeResourceDefinition{}
+		if err := kube.Get(ctx, types.NamespacedName{Name: name}, xrd); err != nil {
+			return nil, resource.LocalError(err, errGetXRD)
+		}
+		return resource.GetIgnoredFields(xrd), nil
+	}
+}
+
+// PreserveFields sets the fields of the desired remote claim at the supplied
+// paths to their values in the observed one, or removes them if the observed
+// one doesn't have them, so that they're left untouched when the desired claim
+// is applied.
+func PreserveFields(observed, desired *claim.Unstructured, paths ...string) error {
+	op := fieldpath.Pave(observed.UnstructuredContent())
+	dp := fieldpath.Pave(desired.UnstructuredContent())
+	for _, path := range paths {
+		v, err := op.GetValue(path)
+		if fieldpath.IsNotFound(err) {
+			if err := deleteField(dp, path); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := dp.SetValue(path, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func deleteField(p *fieldpath.Paved, path string) error {
+	s, err := fieldpath.Parse(path)
+	if err != nil {
+		return err
+	}
+	if len(s) == 0 || s[len(s)-1].Type != fieldpath.SegmentField {
+		return errors.Errorf(errFmtNotField, path)
+	}
+	parent := p.UnstructuredContent()
+	if len(s) > 1 {
+		v, err := p.GetValue(s[:len(s)-1].String())
+		if err != nil {
+			return runtimeresource.Ignore(fieldpath.IsNotFound, err)
+		}
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		parent = m
+	}
+	delete(parent, s[len(s)-1].Field)
+	return nil
 }
 
 // NewLateInitializer returns a new LateInitializer.
@@ -112,8 +457,14 @@ func (li *LateInitializer) Propagate(ctx context.Context, local, remote *claim.U
 	if local.GetWriteConnectionSecretToReference() == nil && remote.GetWriteConnectionSecretToReference() != nil {
 		local.SetWriteConnectionSecretToReference(remote.GetWriteConnectionSecretToReference())
 	}
+	// The external name of the remote claim may have been set in the remote
+	// cluster, e.g. for an imported claim, and it names the cloud resources
+	// of the local claim as much as of the remote one.
+	if meta.GetExternalName(local) == "" && meta.GetExternalName(remote) != "" {
+		meta.SetExternalName(local, meta.GetExternalName(remote))
+	}
 	// TODO(muvaf): We need to late-init the unknown user-defined fields as well.
-	return errors.Wrap(li.localClient.Update(ctx, local), localPrefix+errUpdateClaim)
+	return resource.LocalError(li.localClient.Update(ctx, local), errUpdateClaim)
 }
 
 // NewStatusPropagator returns a new StatusPropagator.
@@ -143,9 +494,286 @@ func (sp *StatusPropagator) Propagate(ctx context.Context, local, remote *claim.
 	return nil
 }
 
+// NewCompositionSelectorResolver returns a new *CompositionSelectorResolver
+// that resolves selectors to the Compositions of the given composite type.
+func NewCompositionSelectorResolver(kube client.Client, compositeType schema.GroupVersionKind) *CompositionSelectorResolver {
+	return &CompositionSelectorResolver{localClient: kube, compositeType: compositeType}
+}
+
+// CompositionSelectorResolver resolves the composition selector of the local
+// claim to a composition reference using the Compositions synced to the local
+// cluster, so that the selection is deterministic and visible to users.
+type CompositionSelectorResolver struct {
+	localClient   client.Client
+	compositeType schema.GroupVersionKind
+}
+
+// Default sets the composition reference of the local claim to the first
+// Composition, in alphabetical order, that matches its selector and is
+// compatible with its composite type. The claim is left as is if there is no
+// such Composition, in which case the remote cluster will do the selection.
+func (csr *CompositionSelectorResolver) Default(ctx context.Context, local *claim.Unstructured) error {
+	if local.GetCompositionReference() != nil || local.GetCompositionSelector() == nil {
+		return nil
+	}
+	sel, err := metav1.LabelSelectorAsSelector(local.GetCompositionSelector())
+	if err != nil {
+		return err
+	}
+	l := &xv1alpha1.CompositionList{}
+	if err := csr.localClient.List(ctx, l, client.MatchingLabelsSelector{Selector: sel}); err != nil {
+		return resource.LocalError(err, errListCompositions)
+	}
+	apiVersion, kind := csr.compositeType.ToAPIVersionAndKind()
+	var names []string
+	for _, c := range l.Items {
+		if c.Spec.From.APIVersion == apiVersion && c.Spec.From.Kind == kind {
+			names = append(names, c.GetName())
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+	local.SetCompositionReference(&v1.ObjectReference{Name: names[0]})
+	return nil
+}
+
+// NewDefaultCompositionSetter returns a new *DefaultCompositionSetter that
+// reads the default Composition of the claims of the given kind from the
+// supplied Index.
+func NewDefaultCompositionSetter(i *openapi.Index, gk schema.GroupKind) *DefaultCompositionSetter {
+	return &DefaultCompositionSetter{index: i, kind: gk}
+}
+
+// DefaultCompositionSetter sets the composition reference of the local claims
+// that neither reference nor select a Composition to the default Composition
+// of their kind, so that the claims created after the default is changed in
+// the remote cluster pick up the new default. The default is recorded in the
+// resource.AnnotationKeyDefaultComposition annotation of the claim CRD, which
+// is indexed with every sync of its CompositeResourceDefinition.
+type DefaultCompositionSetter struct {
+	index *openapi.Index
+	kind  schema.GroupKind
+}
+
+// Default sets the composition reference of the local claim to the default
+// Composition. The claim is left as is if there is no default, in which case
+// the remote cluster will do the selection.
+func (dcs *DefaultCompositionSetter) Default(_ context.Context, local *claim.Unstructured) error {
+	if local.GetCompositionReference() != nil || local.GetCompositionSelector() != nil {
+		return nil
+	}
+	if name, ok := dcs.index.DefaultComposition(dcs.kind); ok {
+		local.SetCompositionReference(&v1.ObjectReference{Name: name})
+	}
+	return nil
+}
+
+// NewClaimTemplateExpander returns a new *ClaimTemplateExpander that reads the
+// claim templates from the ConfigMaps in the given namespace.
+func NewClaimTemplateExpander(kube client.Reader, namespace string) *ClaimTemplateExpander {
+	return &ClaimTemplateExpander{localClient: kube, namespace: namespace}
+}
+
+// ClaimTemplateExpander fills in the spec of the local claims that reference a
+// claim template with the resource.AnnotationKeyClaimTemplate annotation, so
+// that app teams can create golden-path claims with only the fields that are
+// specific to them. A claim template is a ConfigMap whose
+// resource.ClaimTemplateKey holds a partial claim spec in YAML.
+type ClaimTemplateExpander struct {
+	localClient client.Reader
+	namespace   string
+}
+
+// Default fills in the fields of the spec of the local claim that aren't set
+// with the values in its template. The fields that are set in the claim win.
+func (e *ClaimTemplateExpander) Default(ctx context.Context, local *claim.Unstructured) error {
+	name := local.GetAnnotations()[resource.AnnotationKeyClaimTemplate]
+	if name == "" {
+		return nil
+	}
+	cm := &v1.ConfigMap{}
+	if err := e.localClient.Get(ctx, types.NamespacedName{Namespace: e.namespace, Name: name}, cm); err != nil {
+		return resource.LocalError(err, fmt.Sprintf(errFmtGetClaimTemplate, name))
+	}
+	// The YAML is decoded with the Kubernetes JSON decoder so that integers
+	// stay integers in the unstructured claim.
+	spec := map[string]interface{}{}
+	j, err := yaml.YAMLToJSON([]byte(cm.Data[resource.ClaimTemplateKey]))
+	if err == nil {
+		err = json.Unmarshal(j, &spec)
+	}
+	if err != nil {
+		return errors.Wrapf(err, errFmtParseClaimTemplate, name)
+	}
+	current, _ := local.Object["spec"].(map[string]interface{})
+	if current == nil {
+		current = map[string]interface{}{}
+	}
+	local.Object["spec"] = fillIn(current, spec)
+	return nil
+}
+
+// fillIn sets the keys of dst that are missing with the values in src, going
+// into the objects that both have.
+func fillIn(dst, src map[string]interface{}) map[string]interface{} {
+	for k, sv := range src {
+		dv, ok := dst[k]
+		if !ok {
+			dst[k] = sv
+			continue
+		}
+		dm, dok := dv.(map[string]interface{})
+		sm, sok := sv.(map[string]interface{})
+		if dok && sok {
+			dst[k] = fillIn(dm, sm)
+		}
+	}
+	return dst
+}
+
+// ConnectionSecretPropagatorOption is used to configure
+// *ConnectionSecretPropagator.
+type ConnectionSecretPropagatorOption func(*ConnectionSecretPropagator)
+
+// WithExpectedKeys specifies the keys that the connection secret is expected
+// to have. The claim is marked with a PartialConnectionDetails condition if
+// any of them is missing in the remote secret.
+func WithExpectedKeys(keys ...string) ConnectionSecretPropagatorOption {
+	return func(csp *ConnectionSecretPropagator) {
+		csp.expectedKeys = keys
+	}
+}
+
+// WithSecretApplyOptions specifies the ApplyOptions that should be used when
+// the connection secret is applied in the local cluster.
+func WithSecretApplyOptions(opts ...runtimeresource.ApplyOption) ConnectionSecretPropagatorOption {
+	return func(csp *ConnectionSecretPropagator) {
+		csp.applyOpts = append(csp.applyOpts, opts...)
+	}
+}
+
+// WithSecretEncrypter specifies how the ConnectionSecretPropagator should
+// encrypt the values of the connection secrets before they're written to the
+// local cluster. They're written as they are if it's not given.
+func WithSecretEncrypter(e encryption.Encrypter) ConnectionSecretPropagatorOption {
+	return func(csp *ConnectionSecretPropagator) {
+		csp.encrypter = e
+	}
+}
+
+// A SecretConflictPolicy determines what the ConnectionSecretPropagator does
+// when the local connection secret already exists but isn't owned by the claim.
+type SecretConflictPolicy string
+
+// Secret conflict policies.
+const (
+	// SecretConflictPolicyFail leaves the existing secret untouched and fails
+	// the sync of the claim.
+	SecretConflictPolicyFail SecretConflictPolicy = "Fail"
+
+	// SecretConflictPolicyAdopt writes the connection details to the existing
+	// secret and makes the claim its owner, so it's garbage collected with
+	// the claim.
+	SecretConflictPolicyAdopt SecretConflictPolicy = "Adopt"
+
+	// SecretConflictPolicyOverwrite writes the connection details to the
+	// existing secret without changing its owners.
+	SecretConflictPolicyOverwrite SecretConflictPolicy = "Overwrite"
+)
+
+// WithSecretConflictPolicy specifies what the ConnectionSecretPropagator should
+// do when the local connection secret exists but isn't owned by the claim.
+func WithSecretConflictPolicy(p SecretConflictPolicy) ConnectionSecretPropagatorOption {
+	return func(csp *ConnectionSecretPropagator) {
+		csp.conflictPolicy = p
+	}
+}
+
+// WithSecretNamespaces specifies the namespaces other than their own that the
+// claims may have their connection secrets written to with the
+// resource.AnnotationKeyConnectionSecretNamespace annotation.
+func WithSecretNamespaces(namespaces ...string) ConnectionSecretPropagatorOption {
+	return func(csp *ConnectionSecretPropagator) {
+		for _, ns := range namespaces {
+			csp.secretNamespaces[ns] = true
+		}
+	}
+}
+
+// WithSecretLabels specifies the labels of the claims that the
+// ConnectionSecretPropagator should copy to their connection secrets, so that
+// applications and policy engines can select the secrets by them. Entries that
+// end with a slash match all the keys with that prefix.
+func WithSecretLabels(keys ...string) ConnectionSecretPropagatorOption {
+	return func(csp *ConnectionSecretPropagator) {
+		csp.labels = append(csp.labels, keys...)
+	}
+}
+
+// ConnectionSecretNamespace returns the namespace that the connection secret
+// of the supplied local claim is written to, and whether it's a namespace
+// other than the namespace of the claim.
+func ConnectionSecretNamespace(local metav1.Object) (string, bool) {
+	ns := local.GetAnnotations()[resource.AnnotationKeyConnectionSecretNamespace]
+	if ns == "" || ns == local.GetNamespace() {
+		return local.GetNamespace(), false
+	}
+	return ns, true
+}
+
+// DeleteForeignConnectionSecret deletes the connection secret of the supplied
+// local claim if it's in another namespace and owned by the claim, since it
+// isn't garbage collected with the claim.
+func DeleteForeignConnectionSecret(ctx context.Context, kube client.Client, local *claim.Unstructured) error {
+	ns, foreign := ConnectionSecretNamespace(local)
+	ref := local.GetWriteConnectionSecretToReference()
+	if !foreign || ref == nil {
+		return nil
+	}
+	s := &v1.Secret{}
+	err := kube.Get(ctx, types.NamespacedName{Namespace: ns, Name: ref.Name}, s)
+	if kerrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return resource.LocalError(err, errGetSecret)
+	}
+	if s.GetLabels()[resource.LabelKeyOwnerUID] != string(local.GetUID()) {
+		return nil
+	}
+	return resource.LocalError(runtimeresource.IgnoreNotFound(kube.Delete(ctx, s)), errDeleteSecret)
+}
+
+// NewConnectionSecretLocator returns a new ConnectionSecretLocator.
+func NewConnectionSecretLocator() ConnectionSecretLocator {
+	return ConnectionSecretLocator{}
+}
+
+// ConnectionSecretLocator is used instead of the ConnectionSecretPropagator
+// when connection secrets must not leave the remote cluster. It tells the users
+// of the local claim where its connection secret is in the remote cluster.
+type ConnectionSecretLocator struct{}
+
+// Propagate marks the local claim with the location of the connection secret
+// of the remote claim.
+func (ConnectionSecretLocator) Propagate(_ context.Context, local, remote *claim.Unstructured) error {
+	ref := remote.GetWriteConnectionSecretToReference()
+	if ref == nil {
+		return nil
+	}
+	local.SetConditions(resource.ConnectionSecretNotSynced(types.NamespacedName{Namespace: remote.GetNamespace(), Name: ref.Name}))
+	return nil
+}
+
 // NewConnectionSecretPropagator returns a new *ConnectionSecretPropagator.
-func NewConnectionSecretPropagator(local, remote runtimeresource.ClientApplicator) *ConnectionSecretPropagator {
-	return &ConnectionSecretPropagator{localClient: local, remoteClient: remote}
+func NewConnectionSecretPropagator(local, remote runtimeresource.ClientApplicator, opts ...ConnectionSecretPropagatorOption) *ConnectionSecretPropagator {
+	csp := &ConnectionSecretPropagator{localClient: local, remoteClient: remote, conflictPolicy: SecretConflictPolicyFail, secretNamespaces: map[string]bool{}}
+	for _, f := range opts {
+		f(csp)
+	}
+	return csp
 }
 
 // ConnectionSecretPropagator fetches the connection secret from the remote cluster
@@ -153,13 +781,29 @@ func NewConnectionSecretPropagator(local, remote runtimeresource.ClientApplicato
 type ConnectionSecretPropagator struct {
 	localClient  runtimeresource.ClientApplicator
 	remoteClient runtimeresource.ClientApplicator
+
+	expectedKeys     []string
+	applyOpts        []runtimeresource.ApplyOption
+	conflictPolicy   SecretConflictPolicy
+	secretNamespaces map[string]bool
+	encrypter        encryption.Encrypter
+	labels           []string
 }
 
-// Propagate propagates the connection secret from remote cluster to local cluster.
+// Propagate propagates the connection secret from remote cluster to local
+// cluster, and the one published with a secret store if the claim publishes
+// its connection details with one.
 func (csp *ConnectionSecretPropagator) Propagate(ctx context.Context, local, remote *claim.Unstructured) error {
+	if err := csp.propagatePublished(ctx, local, remote); err != nil {
+		return err
+	}
 	if local.GetWriteConnectionSecretToReference() == nil || remote.GetWriteConnectionSecretToReference() == nil {
 		return nil
 	}
+	ns, foreign := ConnectionSecretNamespace(local)
+	if foreign && !csp.secretNamespaces[ns] {
+		return errors.Errorf(errFmtSecretNamespace, ns)
+	}
 	// Update the connection secret.
 	rs := &v1.Secret{}
 	rnn := types.NamespacedName{
@@ -168,18 +812,252 @@ func (csp *ConnectionSecretPropagator) Propagate(ctx context.Context, local, rem
 	}
 	err := csp.remoteClient.Get(ctx, rnn, rs)
 	if runtimeresource.IgnoreNotFound(err) != nil {
-		return errors.Wrap(err, remotePrefix+errGetSecret)
+		return resource.RemoteError(err, errGetSecret)
 	}
 	if kerrors.IsNotFound(err) {
 		// TODO(muvaf): Set condition to say waiting for secret.
 		return nil
 	}
-	ls := resource.SanitizedDeepCopyObject(rs)
+	ls, _ := resource.SanitizedDeepCopyObject(rs).(*v1.Secret)
+	if err := renderConnectionKeys(local, ls); err != nil {
+		return err
+	}
 	ls.SetName(local.GetWriteConnectionSecretToReference().Name)
-	ls.SetNamespace(local.GetNamespace())
-	meta.AddOwnerReference(ls, meta.AsController(meta.ReferenceTo(local, local.GroupVersionKind())))
-	if err := csp.localClient.Apply(ctx, ls); err != nil {
-		return errors.Wrap(err, localPrefix+errApplySecret)
+	ls.SetNamespace(ns)
+	meta.AddLabels(ls, csp.claimLabels(local))
+	meta.AddLabels(ls, map[string]string{resource.LabelKeyOwnerUID: string(local.GetUID())})
+	// Owner references cannot cross namespaces, so the secrets in other
+	// namespaces are owned only by labels and deleted by the Reconciler.
+	if foreign {
+		meta.AddLabels(ls, map[string]string{
+			resource.LabelKeyOwnerNamespace: local.GetNamespace(),
+			resource.LabelKeyOwnerName:      resource.LabelValue(local.GetName()),
+		})
+	} else {
+		meta.AddOwnerReference(ls, meta.AsController(meta.ReferenceTo(local, local.GroupVersionKind())))
+	}
+	resource.SetSyncID(ctx, ls)
+	removed := map[string]interface{}{}
+	ao := append([]runtimeresource.ApplyOption{resolveSecretConflict(csp.conflictPolicy, local.GetUID()), csp.recordRemovedLabels(removed)}, csp.applyOpts...)
+	if csp.encrypter != nil {
+		meta.AddAnnotations(ls, map[string]string{resource.AnnotationKeySourceResourceVersion: rs.GetResourceVersion()})
+		if err := csp.encrypter.Encrypt(ctx, ls); err != nil {
+			return errors.Wrap(err, errEncryptSecret)
+		}
+		ao = append(ao, encryption.KeepUnchanged())
 	}
+	if err := csp.localClient.Apply(ctx, ls, ao...); err != nil {
+		return resource.LocalError(err, errApplySecret)
+	}
+	if err := csp.removeLabels(ctx, ls, removed); err != nil {
+		return resource.LocalError(err, errUnlabelSecret)
+	}
+	csp.checkKeys(local, rs)
 	return nil
 }
+
+// claimLabels returns the labels of the supplied local claim that are copied to
+// its connection secrets.
+func (csp *ConnectionSecretPropagator) claimLabels(local *claim.Unstructured) map[string]string {
+	labels := map[string]string{}
+	for k, v := range local.GetLabels() {
+		if csp.copiesLabel(k) {
+			labels[k] = v
+		}
+	}
+	return labels
+}
+
+// copiesLabel returns whether the label with the supplied key is copied from
+// the claims to their connection secrets.
+func (csp *ConnectionSecretPropagator) copiesLabel(k string) bool {
+	for _, key := range csp.labels {
+		if k == key || (strings.HasSuffix(key, "/") && strings.HasPrefix(k, key)) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordRemovedLabels returns an ApplyOption that records the labels copied
+// from the claim that the current secret has but the desired one doesn't in
+// the supplied map, since a merge patch of the desired secret doesn't remove
+// them.
+func (csp *ConnectionSecretPropagator) recordRemovedLabels(removed map[string]interface{}) runtimeresource.ApplyOption {
+	return func(_ context.Context, current, desired runtime.Object) error {
+		c, ok := current.(metav1.Object)
+		if !ok {
+			return errors.New(errAccessMetadata)
+		}
+		d, ok := desired.(metav1.Object)
+		if !ok {
+			return errors.New(errAccessMetadata)
+		}
+		for k := range c.GetLabels() {
+			if _, ok := d.GetLabels()[k]; !ok && csp.copiesLabel(k) {
+				removed[k] = nil
+			}
+		}
+		return nil
+	}
+}
+
+// removeLabels removes the supplied labels, recorded with recordRemovedLabels,
+// from the supplied secret.
+func (csp *ConnectionSecretPropagator) removeLabels(ctx context.Context, s *v1.Secret, removed map[string]interface{}) error {
+	if len(removed) == 0 {
+		return nil
+	}
+	// The patch consists of nulls, so it's always marshalled.
+	data, _ := json.Marshal(map[string]interface{}{"metadata": map[string]interface{}{"labels": removed}})
+	return csp.localClient.Patch(ctx, s, client.RawPatch(types.MergePatchType, data))
+}
+
+// resolveSecretConflict returns an ApplyOption that applies the supplied policy
+// if the existing secret is owned neither by the owner label nor by the
+// controller reference of the claim with the supplied UID.
+func resolveSecretConflict(p SecretConflictPolicy, owner types.UID) runtimeresource.ApplyOption {
+	return func(_ context.Context, current, desired runtime.Object) error {
+		c, ok := current.(metav1.Object)
+		if !ok {
+			return errors.New(errAccessMetadata)
+		}
+		if c.GetLabels()[resource.LabelKeyOwnerUID] == string(owner) {
+			return nil
+		}
+		if ref := metav1.GetControllerOf(c); ref != nil && ref.UID == owner {
+			return nil
+		}
+		switch p {
+		case SecretConflictPolicyAdopt:
+			return nil
+		case SecretConflictPolicyOverwrite:
+			d, ok := desired.(metav1.Object)
+			if !ok {
+				return errors.New(errAccessMetadata)
+			}
+			d.SetOwnerReferences(nil)
+			meta.RemoveLabels(d, resource.LabelKeyOwnerUID)
+			return nil
+		}
+		return resource.ErrNotOwned
+	}
+}
+
+// renderConnectionKeys adds the keys defined with the
+// AnnotationKeyPrefixConnectionKey annotations of the local claim to the
+// supplied secret, e.g. to compose a DSN from the host, port, user and password
+// so that applications don't need glue code to build it themselves.
+func renderConnectionKeys(local *claim.Unstructured, s *v1.Secret) error {
+	values := make(map[string]string, len(s.Data))
+	for k, v := range s.Data {
+		values[k] = string(v)
+	}
+	for k, v := range local.GetAnnotations() {
+		if !strings.HasPrefix(k, resource.AnnotationKeyPrefixConnectionKey) {
+			continue
+		}
+		key := strings.TrimPrefix(k, resource.AnnotationKeyPrefixConnectionKey)
+		t, err := template.New(key).Option("missingkey=error").Parse(v)
+		if err != nil {
+			return errors.Wrapf(err, errFmtParseKeyTemplate, key)
+		}
+		b := &bytes.Buffer{}
+		if err := t.Execute(b, values); err != nil {
+			return errors.Wrapf(err, errFmtRenderKeyTemplate, key)
+		}
+		if s.Data == nil {
+			s.Data = map[string][]byte{}
+		}
+		s.Data[key] = b.Bytes()
+	}
+	return nil
+}
+
+// checkKeys marks the local claim if the supplied secret lacks any of the
+// expected keys. We still copy whatever exists since some of the details may
+// be published later, but applications shouldn't silently get an incomplete
+// secret.
+func (csp *ConnectionSecretPropagator) checkKeys(local *claim.Unstructured, s *v1.Secret) {
+	var missing []string
+	for _, k := range csp.expectedKeys {
+		if _, ok := s.Data[k]; !ok {
+			missing = append(missing, k)
+		}
+	}
+	switch {
+	case len(missing) > 0:
+		local.SetConditions(resource.PartialConnectionDetails(missing))
+	case local.GetCondition(resource.TypePartialConnectionDetails).Status == v1.ConditionTrue:
+		local.SetConditions(resource.CompleteConnectionDetails())
+	}
+}
+
+// Teardown is how far the deletion of the composed resources of a remote claim
+// has progressed.
+type Teardown struct {
+	// Total is the number of composed resources of the composite resource of
+	// the claim. It's zero if it's not known.
+	Total int
+
+	// Remaining is the number of composed resources that still exist.
+	Remaining int
+}
+
+// TeardownObserverFn is used to construct a TeardownObserver with a bare
+// function.
+type TeardownObserverFn func(ctx context.Context, remote *claim.Unstructured) (Teardown, error)
+
+// Observe calls the supplied function.
+func (fn TeardownObserverFn) Observe(ctx context.Context, remote *claim.Unstructured) (Teardown, error) {
+	return fn(ctx, remote)
+}
+
+// NewNopTeardownObserver returns a TeardownObserver that doesn't know the
+// progress of any teardown.
+func NewNopTeardownObserver() TeardownObserverFn {
+	return func(_ context.Context, _ *claim.Unstructured) (Teardown, error) {
+		return Teardown{}, nil
+	}
+}
+
+// NewAPITeardownObserver returns a new *APITeardownObserver.
+func NewAPITeardownObserver(remote client.Reader) *APITeardownObserver {
+	return &APITeardownObserver{remote: remote}
+}
+
+// APITeardownObserver counts the composed resources of the composite resource
+// of a remote claim that still exist in the remote cluster. It needs to be
+// able to read the composite and composed resources.
+type APITeardownObserver struct {
+	remote client.Reader
+}
+
+// Observe returns the progress of the teardown of the composed resources of the
+// supplied remote claim.
+func (o *APITeardownObserver) Observe(ctx context.Context, remote *claim.Unstructured) (Teardown, error) {
+	ref := remote.GetResourceReference()
+	if ref == nil {
+		return Teardown{}, nil
+	}
+	cp := composite.New(composite.WithGroupVersionKind(schema.FromAPIVersionAndKind(ref.APIVersion, ref.Kind)))
+	if err := o.remote.Get(ctx, types.NamespacedName{Name: ref.Name}, cp.GetUnstructured()); err != nil {
+		return Teardown{}, resource.RemoteError(runtimeresource.IgnoreNotFound(err), errGetComposite)
+	}
+	refs := cp.GetResourceReferences()
+	t := Teardown{Total: len(refs)}
+	for _, ref := range refs {
+		u := &kunstructured.Unstructured{}
+		u.SetAPIVersion(ref.APIVersion)
+		u.SetKind(ref.Kind)
+		err := o.remote.Get(ctx, types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}, u)
+		if kerrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return Teardown{}, resource.RemoteError(err, errGetComposed)
+		}
+		t.Remaining++
+	}
+	return t, nil
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package claim
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/crossplane/crossplane-runtime/pkg/meta"
+
+	"github.com/crossplane/agent/pkg/resource"
+)
+
+// The stale remote claims are detected by comparing the generation of the
+// local claim that the remote claim was last written with to the one the
+// local claim recorded. Both are counted by the local cluster, so neither the
+// clocks nor the resource versions of the two clusters are compared.
+
+// StampSync marks the supplied remote claim as written with the current
+// generation of the supplied local claim.
+func StampSync(local, remote metav1.Object) {
+	meta.AddAnnotations(remote, map[string]string{resource.AnnotationKeySyncedGeneration: strconv.FormatInt(local.GetGeneration(), 10)})
+	// The record of the local claim is copied along with its other
+	// annotations, but only the stamp belongs to the remote claim.
+	meta.RemoveAnnotations(remote, resource.AnnotationKeyRemoteUID, resource.AnnotationKeyLastSyncedTime)
+}
+
+// RecordSync records on the supplied local claim that its current generation
+// was written to the supplied remote claim, along with the supplied time. The
+// record is only changed when the generation or the remote claim does, so the
+// time is when the current generation was first written rather than when the
+// claim was last synced, and the local claim isn't updated on every sync. It
+// returns whether the record was changed.
+func RecordSync(local, remote metav1.Object, now time.Time) bool {
+	a := local.GetAnnotations()
+	gen := strconv.FormatInt(local.GetGeneration(), 10)
+	if a[resource.AnnotationKeySyncedGeneration] == gen && a[resource.AnnotationKeyRemoteUID] == string(remote.GetUID()) {
+		return false
+	}
+	meta.AddAnnotations(local, map[string]string{
+		resource.AnnotationKeySyncedGeneration: gen,
+		resource.AnnotationKeyRemoteUID:        string(remote.GetUID()),
+		resource.AnnotationKeyLastSyncedTime:   now.UTC().Format(time.RFC3339),
+	})
+	return true
+}
+
+// SyncLost returns why the remote counterpart of the supplied local claim is
+// missing if the local claim was written to one before, e.g. because the
+// remote cluster was restored from a backup that was taken before it was
+// created. Claims that have no record, e.g. because they were never synced,
+// are never lost.
+func SyncLost(local metav1.Object) (string, bool) {
+	a := local.GetAnnotations()
+	if _, ok := a[resource.AnnotationKeySyncedGeneration]; !ok {
+		return "", false
+	}
+	return fmt.Sprintf("The remote claim that was last synced at %s doesn't exist", a[resource.AnnotationKeyLastSyncedTime]), true
+}
+
+// SyncDiverged returns why the supplied remote claim is older than the one the
+// supplied local claim was last written to, e.g. because the remote cluster
+// was restored from a backup. Claims that have no record, e.g. because they
+// were never synced, never diverge.
+func SyncDiverged(local, remote metav1.Object) (string, bool) {
+	a := local.GetAnnotations()
+	recorded, ok := a[resource.AnnotationKeySyncedGeneration]
+	if !ok {
+		return "", false
+	}
+	at := a[resource.AnnotationKeyLastSyncedTime]
+	if uid := a[resource.AnnotationKeyRemoteUID]; uid != "" && uid != string(remote.GetUID()) {
+		return fmt.Sprintf("The remote claim was replaced since it was last synced at %s", at), true
+	}
+	stamp, ok := remote.GetAnnotations()[resource.AnnotationKeySyncedGeneration]
+	if !ok {
+		return fmt.Sprintf("The remote claim has no record of the sync at %s", at), true
+	}
+	s, serr := strconv.ParseInt(stamp, 10, 64)
+	r, rerr := strconv.ParseInt(recorded, 10, 64)
+	if serr != nil || rerr != nil || s >= r {
+		return "", false
+	}
+	return fmt.Sprintf("The remote claim was last written with generation %d of the claim but generation %d was synced at %s", s, r, at), true
+}
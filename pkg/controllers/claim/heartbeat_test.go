@@ -0,0 +1,213 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package claim
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/claim"
+
+	"github.com/crossplane/agent/pkg/resource"
+)
+
+func TestRecordSync(t *testing.T) {
+	at := time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+	type want struct {
+		changed     bool
+		annotations map[string]string
+	}
+	cases := map[string]struct {
+		reason      string
+		annotations map[string]string
+		want        want
+	}{
+		"FirstSync": {
+			reason: "The sync should be recorded if the claim has no record",
+			want: want{
+				changed: true,
+				annotations: map[string]string{
+					resource.AnnotationKeySyncedGeneration: "3",
+					resource.AnnotationKeyRemoteUID:        "cool-uid",
+					resource.AnnotationKeyLastSyncedTime:   at.Format(time.RFC3339),
+				},
+			},
+		},
+		"UpToDate": {
+			reason: "The claim shouldn't be changed if it has recorded the same generation and remote claim",
+			annotations: map[string]string{
+				resource.AnnotationKeySyncedGeneration: "3",
+				resource.AnnotationKeyRemoteUID:        "cool-uid",
+				resource.AnnotationKeyLastSyncedTime:   "2020-09-01T12:00:00Z",
+			},
+			want: want{
+				annotations: map[string]string{
+					resource.AnnotationKeySyncedGeneration: "3",
+					resource.AnnotationKeyRemoteUID:        "cool-uid",
+					resource.AnnotationKeyLastSyncedTime:   "2020-09-01T12:00:00Z",
+				},
+			},
+		},
+		"NewGeneration": {
+			reason: "The sync should be recorded if a newer generation is synced",
+			annotations: map[string]string{
+				resource.AnnotationKeySyncedGeneration: "2",
+				resource.AnnotationKeyRemoteUID:        "cool-uid",
+				resource.AnnotationKeyLastSyncedTime:   "2020-09-01T12:00:00Z",
+			},
+			want: want{
+				changed: true,
+				annotations: map[string]string{
+					resource.AnnotationKeySyncedGeneration: "3",
+					resource.AnnotationKeyRemoteUID:        "cool-uid",
+					resource.AnnotationKeyLastSyncedTime:   at.Format(time.RFC3339),
+				},
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			local := claim.New()
+			local.SetGeneration(3)
+			local.SetAnnotations(tc.annotations)
+			remote := claim.New()
+			remote.SetUID(types.UID("cool-uid"))
+			changed := RecordSync(local, remote, at)
+			if diff := cmp.Diff(tc.want.changed, changed); diff != "" {
+				t.Errorf("\nReason: %s\nRecordSync(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.annotations, local.GetAnnotations()); diff != "" {
+				t.Errorf("\nReason: %s\nRecordSync(...): -want annotations, +got annotations:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestSyncLost(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		local  map[string]string
+		want   string
+		lost   bool
+	}{
+		"NoRecord": {
+			reason: "A claim that has no record should never be lost",
+		},
+		"Record": {
+			reason: "A claim that was synced before should be lost",
+			local: map[string]string{
+				resource.AnnotationKeySyncedGeneration: "3",
+				resource.AnnotationKeyLastSyncedTime:   "2020-09-01T12:00:00Z",
+			},
+			want: "The remote claim that was last synced at 2020-09-01T12:00:00Z doesn't exist",
+			lost: true,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			local := claim.New()
+			local.SetAnnotations(tc.local)
+			why, lost := SyncLost(local)
+			if diff := cmp.Diff(tc.lost, lost); diff != "" {
+				t.Errorf("\nReason: %s\nSyncLost(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want, why); diff != "" {
+				t.Errorf("\nReason: %s\nSyncLost(...): -want reason, +got reason:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestSyncDiverged(t *testing.T) {
+	record := map[string]string{
+		resource.AnnotationKeySyncedGeneration: "3",
+		resource.AnnotationKeyRemoteUID:        "cool-uid",
+		resource.AnnotationKeyLastSyncedTime:   "2020-09-01T12:00:00Z",
+	}
+	type args struct {
+		local     map[string]string
+		remote    map[string]string
+		remoteUID types.UID
+	}
+	type want struct {
+		why      string
+		diverged bool
+	}
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"NoRecord": {
+			reason: "A claim that has no record should never diverge",
+			args:   args{remoteUID: "other-uid"},
+		},
+		"InSync": {
+			reason: "A remote claim that was written with the recorded generation shouldn't diverge",
+			args: args{
+				local:     record,
+				remote:    map[string]string{resource.AnnotationKeySyncedGeneration: "3"},
+				remoteUID: "cool-uid",
+			},
+		},
+		"Replaced": {
+			reason: "A remote claim with another UID than the recorded one should diverge",
+			args: args{
+				local:     record,
+				remote:    map[string]string{resource.AnnotationKeySyncedGeneration: "3"},
+				remoteUID: "other-uid",
+			},
+			want: want{why: "The remote claim was replaced since it was last synced at 2020-09-01T12:00:00Z", diverged: true},
+		},
+		"NoStamp": {
+			reason: "A remote claim that was never stamped should diverge",
+			args: args{
+				local:     record,
+				remoteUID: "cool-uid",
+			},
+			want: want{why: "The remote claim has no record of the sync at 2020-09-01T12:00:00Z", diverged: true},
+		},
+		"OlderStamp": {
+			reason: "A remote claim that was written with an older generation than the recorded one should diverge",
+			args: args{
+				local:     record,
+				remote:    map[string]string{resource.AnnotationKeySyncedGeneration: "2"},
+				remoteUID: "cool-uid",
+			},
+			want: want{why: "The remote claim was last written with generation 2 of the claim but generation 3 was synced at 2020-09-01T12:00:00Z", diverged: true},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			local := claim.New()
+			local.SetAnnotations(tc.args.local)
+			remote := claim.New()
+			remote.SetUID(tc.args.remoteUID)
+			remote.SetAnnotations(tc.args.remote)
+			why, diverged := SyncDiverged(local, remote)
+			if diff := cmp.Diff(tc.want.diverged, diverged); diff != "" {
+				t.Errorf("\nReason: %s\nSyncDiverged(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.why, why); diff != "" {
+				t.Errorf("\nReason: %s\nSyncDiverged(...): -want reason, +got reason:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
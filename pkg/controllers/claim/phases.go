@@ -0,0 +1,121 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package claim
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/claim"
+
+	"github.com/crossplane/agent/pkg/metrics"
+)
+
+// A phase is a part of a reconcile whose duration is measured.
+type phase string
+
+// The measured phases of a reconcile.
+const (
+	phaseLocalGet  phase = "LocalGet"
+	phaseRemoteGet phase = "RemoteGet"
+	phaseApply     phase = "Apply"
+	phaseStatus    phase = "Status"
+	phaseSecret    phase = "Secret"
+)
+
+var phases = []phase{phaseLocalGet, phaseRemoteGet, phaseApply, phaseStatus, phaseSecret}
+
+type phaseTimesKey struct{}
+
+// phaseTimes is how long each phase of a reconcile took. A phase may run
+// more than once, e.g. the status of a claim is updated after every failure.
+type phaseTimes struct {
+	mu sync.Mutex
+	d  map[phase]time.Duration
+}
+
+// withPhaseTimes returns a context that the durations of the phases are
+// recorded to with observePhase.
+func withPhaseTimes(ctx context.Context) (context.Context, *phaseTimes) {
+	t := &phaseTimes{d: map[phase]time.Duration{}}
+	return context.WithValue(ctx, phaseTimesKey{}, t), t
+}
+
+// observePhase records the time since the supplied start as the supplied
+// phase of the reconcile of the supplied context, if there's any.
+func observePhase(ctx context.Context, p phase, start time.Time) {
+	t, ok := ctx.Value(phaseTimesKey{}).(*phaseTimes)
+	if !ok {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.d[p] += time.Since(start)
+}
+
+// report observes the durations of the phases in the metrics and logs them
+// if the whole reconcile took longer than the supplied threshold.
+func (t *phaseTimes) report(log logging.Logger, kind string, total, threshold time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	kv := []interface{}{"kind", kind, "duration", total.String(), "timeout", timeout.String()}
+	for _, p := range phases {
+		d, ok := t.d[p]
+		if !ok {
+			continue
+		}
+		metrics.ReconcilePhaseSeconds.WithLabelValues(kind, string(p)).Observe(d.Seconds())
+		kv = append(kv, string(p), d.String())
+	}
+	if threshold > 0 && total > threshold {
+		log.Info("Slow reconcile", kv...)
+	}
+}
+
+// statusTimingClient records the time the status updates of the local claims
+// take as the Status phase, since they're made at the end of every path of a
+// reconcile.
+type statusTimingClient struct {
+	client.Client
+}
+
+func (c *statusTimingClient) Status() client.StatusWriter {
+	return &statusTimingWriter{StatusWriter: c.Client.Status()}
+}
+
+type statusTimingWriter struct {
+	client.StatusWriter
+}
+
+func (w *statusTimingWriter) Update(ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	defer observePhase(ctx, phaseStatus, time.Now())
+	return w.StatusWriter.Update(ctx, obj, opts...)
+}
+
+// timedPropagator returns a Propagator that records the time the supplied one
+// takes as the supplied phase.
+func timedPropagator(p phase, pr Propagator) PropagateFn {
+	return func(ctx context.Context, local, remote *claim.Unstructured) error {
+		defer observePhase(ctx, p, time.Now())
+		return pr.Propagate(ctx, local, remote)
+	}
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package claim
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/claim"
+)
+
+type infoRecorder struct {
+	logging.Logger
+	msgs []string
+}
+
+func (l *infoRecorder) Info(msg string, _ ...interface{}) {
+	l.msgs = append(l.msgs, msg)
+}
+
+func TestPhaseTimes(t *testing.T) {
+	cases := map[string]struct {
+		reason    string
+		total     time.Duration
+		threshold time.Duration
+		want      []string
+	}{
+		"Fast": {
+			reason:    "Reconciles that are faster than the threshold shouldn't be logged",
+			total:     time.Second,
+			threshold: 30 * time.Second,
+		},
+		"Slow": {
+			reason:    "Reconciles that are slower than the threshold should be logged",
+			total:     time.Minute,
+			threshold: 30 * time.Second,
+			want:      []string{"Slow reconcile"},
+		},
+		"NoThreshold": {
+			reason: "Reconciles shouldn't be logged if there's no threshold",
+			total:  time.Minute,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx, times := withPhaseTimes(context.Background())
+			p := timedPropagator(phaseSecret, PropagateFn(func(_ context.Context, _, _ *claim.Unstructured) error { return nil }))
+			if err := p.Propagate(ctx, nil, nil); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := times.d[phaseSecret]; !ok {
+				t.Errorf("\nReason: %s\ntimedPropagator(...): the phase should be recorded", tc.reason)
+			}
+			log := &infoRecorder{Logger: logging.NewNopLogger()}
+			times.report(log, "Database", tc.total, tc.threshold)
+			if diff := cmp.Diff(tc.want, log.msgs); diff != "" {
+				t.Errorf("\nReason: %s\nreport(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
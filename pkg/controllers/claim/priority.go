@@ -0,0 +1,234 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package claim
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	defaultResyncBacklog = 5
+
+	// resyncPoll is how often a resync that waits for the queue of its
+	// controller to drain checks it again.
+	resyncPoll = 100 * time.Millisecond
+)
+
+// ResyncQueueOption is used to configure *ResyncQueue.
+type ResyncQueueOption func(*ResyncQueue)
+
+// WithResyncBacklog specifies how many claims the queue of a claim controller
+// may hold for the ResyncQueue to add a resync to it. The lower it is, the
+// sooner the new and changed claims are synced during a resync storm.
+func WithResyncBacklog(n int) ResyncQueueOption {
+	return func(q *ResyncQueue) {
+		q.backlog = n
+	}
+}
+
+// NewResyncQueue returns a new *ResyncQueue.
+func NewResyncQueue(opts ...ResyncQueueOption) *ResyncQueue {
+	q := &ResyncQueue{
+		backlog: defaultResyncBacklog,
+		targets: map[schema.GroupVersionKind]*resyncTarget{},
+	}
+	for _, f := range opts {
+		f(q)
+	}
+	return q
+}
+
+// A ResyncQueue is a manager.Runnable that gives the claims that are new or
+// changed priority over the routine resyncs of the claims that are doing
+// fine. The claim controllers watch their claims with its Handler, which adds
+// the claims that changed to the queue of the controller right away, and
+// their reconcilers hand it their routine resyncs, see WithResyncQueue. It
+// holds the resyncs of every claim type in a low priority queue of its own
+// and adds them to the queue of their controller only once the controller has
+// caught up with the claims that are waiting in it, so that a brand-new claim
+// never waits behind thousands of resyncs.
+type ResyncQueue struct {
+	backlog int
+
+	mu      sync.Mutex
+	stop    <-chan struct{}
+	targets map[schema.GroupVersionKind]*resyncTarget
+}
+
+type resyncTarget struct {
+	resyncs workqueue.DelayingInterface
+
+	mu    sync.Mutex
+	queue workqueue.RateLimitingInterface
+}
+
+// setQueue records the queue of the controller of the target. The queue is
+// replaced when the controller is restarted.
+func (t *resyncTarget) setQueue(q workqueue.RateLimitingInterface) {
+	t.mu.Lock()
+	t.queue = q
+	t.mu.Unlock()
+}
+
+// getQueue returns the queue of the controller of the target, or nil if the
+// controller was stopped, e.g. to be restarted, and its new queue isn't known
+// yet. The new queue is recorded with the first event of the restarted
+// controller, i.e. as soon as its informer lists the claims.
+func (t *resyncTarget) getQueue() workqueue.RateLimitingInterface {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.queue != nil && t.queue.ShuttingDown() {
+		t.queue = nil
+	}
+	return t.queue
+}
+
+// target returns the target of the supplied claim type, creating it if it
+// doesn't exist yet.
+func (q *ResyncQueue) target(gvk schema.GroupVersionKind) *resyncTarget {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if t, ok := q.targets[gvk]; ok {
+		return t
+	}
+	t := &resyncTarget{resyncs: workqueue.NewNamedDelayingQueue("resyncs-" + gvk.Kind)}
+	q.targets[gvk] = t
+	// The targets are recorded until the ResyncQueue is started so that
+	// they're fed once it is.
+	if q.stop != nil {
+		go q.feed(q.stop, t)
+	}
+	return t
+}
+
+// Handler returns the event handler that the controller of the supplied claim
+// type should watch its claims with. The claims that are created, deleted or
+// changed are added to the queue of the controller right away. The periodic
+// resyncs of the informer, i.e. the updates that don't change the claim, are
+// held in the low priority queue instead.
+func (q *ResyncQueue) Handler(gvk schema.GroupVersionKind) handler.EventHandler {
+	return &resyncHandler{target: q.target(gvk)}
+}
+
+// Defer schedules a routine resync of the claim of the supplied type with the
+// supplied request after the supplied duration. The resync is added to the
+// queue of the controller of the claim once it's due and the controller has
+// caught up. A resync that's already scheduled earlier is kept.
+func (q *ResyncQueue) Defer(gvk schema.GroupVersionKind, req reconcile.Request, after time.Duration) {
+	q.target(gvk).resyncs.AddAfter(req, after)
+}
+
+// Remove forgets the supplied claim type and stops feeding its resyncs, e.g.
+// once its controller is stopped because the claims are no longer synced or
+// are synced at another version. The type gets a new target if it's synced
+// again.
+func (q *ResyncQueue) Remove(gvk schema.GroupVersionKind) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if t, ok := q.targets[gvk]; ok {
+		t.resyncs.ShutDown()
+		delete(q.targets, gvk)
+	}
+}
+
+// Start feeds the resyncs to the controllers until the supplied channel is
+// closed.
+func (q *ResyncQueue) Start(stop <-chan struct{}) error {
+	q.mu.Lock()
+	q.stop = stop
+	for _, t := range q.targets {
+		go q.feed(stop, t)
+	}
+	q.mu.Unlock()
+	<-stop
+	q.mu.Lock()
+	for _, t := range q.targets {
+		t.resyncs.ShutDown()
+	}
+	q.mu.Unlock()
+	return nil
+}
+
+// feed adds the resyncs of the supplied target that are due to the queue of
+// its controller, one at a time and only while the queue holds fewer claims
+// than the backlog. It returns once the target is removed.
+func (q *ResyncQueue) feed(stop <-chan struct{}, t *resyncTarget) {
+	for {
+		item, shutdown := t.resyncs.Get()
+		if shutdown {
+			return
+		}
+		for {
+			if cq := t.getQueue(); cq != nil && cq.Len() < q.backlog {
+				cq.Add(item)
+				break
+			}
+			if t.resyncs.ShuttingDown() {
+				t.resyncs.Done(item)
+				return
+			}
+			select {
+			case <-stop:
+				t.resyncs.Done(item)
+				return
+			case <-time.After(resyncPoll):
+			}
+		}
+		t.resyncs.Done(item)
+	}
+}
+
+// resyncHandler enqueues the claims like handler.EnqueueRequestForObject,
+// except for the periodic resyncs of the informer, and records the queue of
+// the controller that it's called with.
+type resyncHandler struct {
+	handler.EnqueueRequestForObject
+
+	target *resyncTarget
+}
+
+func (h *resyncHandler) Create(e event.CreateEvent, q workqueue.RateLimitingInterface) {
+	h.target.setQueue(q)
+	h.EnqueueRequestForObject.Create(e, q)
+}
+
+func (h *resyncHandler) Update(e event.UpdateEvent, q workqueue.RateLimitingInterface) {
+	h.target.setQueue(q)
+	if e.MetaOld != nil && e.MetaNew != nil && e.MetaOld.GetResourceVersion() == e.MetaNew.GetResourceVersion() {
+		h.target.resyncs.Add(reconcile.Request{NamespacedName: types.NamespacedName{Namespace: e.MetaNew.GetNamespace(), Name: e.MetaNew.GetName()}})
+		return
+	}
+	h.EnqueueRequestForObject.Update(e, q)
+}
+
+func (h *resyncHandler) Delete(e event.DeleteEvent, q workqueue.RateLimitingInterface) {
+	h.target.setQueue(q)
+	h.EnqueueRequestForObject.Delete(e, q)
+}
+
+func (h *resyncHandler) Generic(e event.GenericEvent, q workqueue.RateLimitingInterface) {
+	h.target.setQueue(q)
+	h.EnqueueRequestForObject.Generic(e, q)
+}
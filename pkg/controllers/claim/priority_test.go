@@ -0,0 +1,172 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package claim
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/claim"
+)
+
+func TestResyncHandler(t *testing.T) {
+	cm := func(rv string) *claim.Unstructured {
+		c := claim.New(claim.WithGroupVersionKind(gvk))
+		c.SetNamespace("default")
+		c.SetName("db")
+		c.SetResourceVersion(rv)
+		return c
+	}
+	type want struct {
+		queued  int
+		resyncs int
+	}
+	cases := map[string]struct {
+		reason string
+		send   func(h *resyncHandler, q workqueue.RateLimitingInterface)
+		want   want
+	}{
+		"Created": {
+			reason: "New claims should be added to the queue of the controller right away",
+			send: func(h *resyncHandler, q workqueue.RateLimitingInterface) {
+				h.Create(event.CreateEvent{Meta: cm("1"), Object: cm("1")}, q)
+			},
+			want: want{queued: 1},
+		},
+		"Changed": {
+			reason: "Changed claims should be added to the queue of the controller right away",
+			send: func(h *resyncHandler, q workqueue.RateLimitingInterface) {
+				h.Update(event.UpdateEvent{MetaOld: cm("1"), ObjectOld: cm("1"), MetaNew: cm("2"), ObjectNew: cm("2")}, q)
+			},
+			want: want{queued: 1},
+		},
+		"Resynced": {
+			reason: "The periodic resyncs of the informer should be held in the low priority queue",
+			send: func(h *resyncHandler, q workqueue.RateLimitingInterface) {
+				h.Update(event.UpdateEvent{MetaOld: cm("1"), ObjectOld: cm("1"), MetaNew: cm("1"), ObjectNew: cm("1")}, q)
+			},
+			want: want{resyncs: 1},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			h, _ := NewResyncQueue().Handler(gvk).(*resyncHandler)
+			q := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+			defer q.ShutDown()
+			tc.send(h, q)
+			got := want{queued: q.Len(), resyncs: h.target.resyncs.Len()}
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(want{})); diff != "" {
+				t.Errorf("\nReason: %s\nh.Create/Update(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestResyncQueueFeed(t *testing.T) {
+	changed := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "changed"}}
+	resynced := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "resynced"}}
+
+	rq := NewResyncQueue(WithResyncBacklog(1))
+	q := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer q.ShutDown()
+	rq.target(gvk).setQueue(q)
+	q.Add(changed)
+	rq.Defer(gvk, resynced, 0)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() { _ = rq.Start(stop) }()
+
+	// The resync is held back while the controller has a claim to catch up
+	// with.
+	time.Sleep(3 * resyncPoll)
+	if diff := cmp.Diff(1, q.Len()); diff != "" {
+		t.Errorf("\nReason: %s\nq.Len(): -want, +got:\n%s", "Resyncs should wait while the queue of the controller is at its backlog", diff)
+	}
+
+	got := []interface{}{}
+	for i := 0; i < 2; i++ {
+		item, _ := q.Get()
+		got = append(got, item)
+		q.Done(item)
+	}
+	if diff := cmp.Diff([]interface{}{changed, resynced}, got); diff != "" {
+		t.Errorf("\nReason: %s\nq.Get(): -want, +got:\n%s", "Changed claims should be synced before the resyncs", diff)
+	}
+}
+
+func TestResyncQueueRestart(t *testing.T) {
+	resynced := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "resynced"}}
+
+	rq := NewResyncQueue()
+	old := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	rq.target(gvk).setQueue(old)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() { _ = rq.Start(stop) }()
+
+	// The controller is restarted, so its queue is shut down and the resync
+	// should wait for the queue of the new one.
+	old.ShutDown()
+	rq.Defer(gvk, resynced, 0)
+	time.Sleep(3 * resyncPoll)
+
+	q := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer q.ShutDown()
+	rq.Handler(gvk).(*resyncHandler).Generic(event.GenericEvent{Meta: claim.New(), Object: claim.New()}, q)
+	q.Done(get(t, q))
+	if diff := cmp.Diff(resynced, get(t, q)); diff != "" {
+		t.Errorf("\nReason: %s\nq.Get(): -want, +got:\n%s", "A resync should be fed to the queue of the restarted controller", diff)
+	}
+}
+
+func TestResyncQueueRemove(t *testing.T) {
+	rq := NewResyncQueue()
+	removed := rq.target(gvk)
+	rq.Remove(gvk)
+	if !removed.resyncs.ShuttingDown() {
+		t.Errorf("\nReason: %s\nRemove(...): the resyncs of the removed target should be shut down", "The feed of a removed claim type should stop")
+	}
+	if rq.target(gvk) == removed {
+		t.Errorf("\nReason: %s\nRemove(...): the removed target should not be reused", "A claim type that's synced again should get a new target")
+	}
+}
+
+// get returns the next item of the supplied queue, failing the test if none
+// arrives in time.
+func get(t *testing.T, q workqueue.Interface) interface{} {
+	t.Helper()
+	got := make(chan interface{}, 1)
+	go func() {
+		item, _ := q.Get()
+		got <- item
+	}()
+	select {
+	case item := <-got:
+		return item
+	case <-time.After(10 * resyncPoll):
+		t.Fatal("q.Get(): no item was added to the queue in time")
+		return nil
+	}
+}
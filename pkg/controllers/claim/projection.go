@@ -0,0 +1,200 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package claim
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
+	"github.com/crossplane/crossplane-runtime/pkg/meta"
+	runtimeresource "github.com/crossplane/crossplane-runtime/pkg/resource"
+	"github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/claim"
+
+	"github.com/crossplane/agent/pkg/resource"
+)
+
+const (
+	errGetStatusConfigMap    = "cannot get status configmap"
+	errCreateStatusConfigMap = "cannot create status configmap"
+	errUpdateStatusConfigMap = "cannot update status configmap"
+	errDeleteStatusConfigMap = "cannot delete status configmap"
+	errFmtProjectStatusField = "cannot project status field %s"
+	errFmtStatusFieldKey     = "status field %s cannot be a configmap key: %s"
+)
+
+// A StatusProjectorOption configures a StatusProjector.
+type StatusProjectorOption func(*StatusProjector)
+
+// WithProjectionNamespaces specifies the namespaces other than their own that
+// the claims may have their ConfigMaps written to with the
+// resource.AnnotationKeyConnectionSecretNamespace annotation, like their
+// connection secrets.
+func WithProjectionNamespaces(namespaces ...string) StatusProjectorOption {
+	return func(sp *StatusProjector) {
+		for _, ns := range namespaces {
+			sp.namespaces[ns] = true
+		}
+	}
+}
+
+// NewStatusProjector returns a new *StatusProjector.
+func NewStatusProjector(kube client.Client, opts ...StatusProjectorOption) *StatusProjector {
+	sp := &StatusProjector{client: kube, namespaces: map[string]bool{}}
+	for _, f := range opts {
+		f(sp)
+	}
+	return sp
+}
+
+// A StatusProjector projects the status fields of the remote claims listed in
+// the resource.AnnotationKeyStatusConfigMap annotation of their local claims
+// into a ConfigMap next to their connection secrets, for the applications that
+// can mount a ConfigMap but cannot read the claims.
+type StatusProjector struct {
+	client     client.Client
+	namespaces map[string]bool
+}
+
+// Propagate writes the projected status fields of the remote claim into the
+// ConfigMap of the local claim. The ConfigMap has the name of the connection
+// secret of the local claim, or of the claim itself if it has none, and is in
+// the namespace of the connection secret. Each field is a key of the
+// ConfigMap; strings are written as they are and everything else as JSON. The
+// fields the remote claim doesn't have yet are left out. The ConfigMap is
+// deleted once the local claim no longer has the annotation.
+func (sp *StatusProjector) Propagate(ctx context.Context, local, remote *claim.Unstructured) error {
+	fields := StatusFields(local)
+	if len(fields) == 0 {
+		return DeleteStatusConfigMap(ctx, sp.client, local)
+	}
+	ns, foreign := ConnectionSecretNamespace(local)
+	if foreign && !sp.namespaces[ns] {
+		return errors.Errorf(errFmtSecretNamespace, ns)
+	}
+	p := fieldpath.Pave(remote.GetUnstructured().UnstructuredContent())
+	data := make(map[string]string, len(fields))
+	for _, f := range fields {
+		if errs := validation.IsConfigMapKey(f); len(errs) > 0 {
+			return errors.Errorf(errFmtStatusFieldKey, f, strings.Join(errs, ", "))
+		}
+		v, err := p.GetValue("status." + f)
+		if fieldpath.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, errFmtProjectStatusField, f)
+		}
+		if s, ok := v.(string); ok {
+			data[f] = s
+			continue
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return errors.Wrapf(err, errFmtProjectStatusField, f)
+		}
+		data[f] = string(b)
+	}
+	cm := &v1.ConfigMap{}
+	err := sp.client.Get(ctx, types.NamespacedName{Namespace: ns, Name: StatusConfigMapName(local)}, cm)
+	if runtimeresource.IgnoreNotFound(err) != nil {
+		return resource.LocalError(err, errGetStatusConfigMap)
+	}
+	// The ConfigMap is replaced rather than patched so that the fields that
+	// are no longer projected are dropped from it.
+	if kerrors.IsNotFound(err) {
+		cm.SetNamespace(ns)
+		cm.SetName(StatusConfigMapName(local))
+	} else if cm.GetLabels()[resource.LabelKeyOwnerUID] != string(local.GetUID()) {
+		return resource.LocalError(resource.ErrNotOwned, errUpdateStatusConfigMap)
+	}
+	if cm.GetResourceVersion() != "" && equalData(cm.Data, data) {
+		return nil
+	}
+	cm.Data = data
+	meta.AddLabels(cm, map[string]string{resource.LabelKeyOwnerUID: string(local.GetUID())})
+	// ConfigMaps in other namespaces cannot be owned by the local claim, so
+	// they're deleted with it by DeleteStatusConfigMap instead.
+	if !foreign {
+		meta.AddOwnerReference(cm, meta.AsController(meta.ReferenceTo(local, local.GroupVersionKind())))
+	}
+	resource.SetSyncID(ctx, cm)
+	if cm.GetResourceVersion() == "" {
+		return resource.LocalError(sp.client.Create(ctx, cm), errCreateStatusConfigMap)
+	}
+	return resource.LocalError(sp.client.Update(ctx, cm), errUpdateStatusConfigMap)
+}
+
+func equalData(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// DeleteStatusConfigMap deletes the ConfigMap that the status fields of the
+// supplied local claim are projected into, if the claim owns it.
+func DeleteStatusConfigMap(ctx context.Context, kube client.Client, local *claim.Unstructured) error {
+	ns, _ := ConnectionSecretNamespace(local)
+	cm := &v1.ConfigMap{}
+	err := kube.Get(ctx, types.NamespacedName{Namespace: ns, Name: StatusConfigMapName(local)}, cm)
+	if kerrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return resource.LocalError(err, errGetStatusConfigMap)
+	}
+	if cm.GetLabels()[resource.LabelKeyOwnerUID] != string(local.GetUID()) {
+		return nil
+	}
+	return resource.LocalError(runtimeresource.IgnoreNotFound(kube.Delete(ctx, cm)), errDeleteStatusConfigMap)
+}
+
+// StatusFields returns the status fields of the supplied local claim that are
+// projected into its ConfigMap.
+func StatusFields(local metav1.Object) []string {
+	var fields []string
+	for _, f := range strings.Split(local.GetAnnotations()[resource.AnnotationKeyStatusConfigMap], ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// StatusConfigMapName returns the name of the ConfigMap that the status fields
+// of the supplied local claim are projected into.
+func StatusConfigMapName(local *claim.Unstructured) string {
+	if ref := local.GetWriteConnectionSecretToReference(); ref != nil && ref.Name != "" {
+		return ref.Name
+	}
+	return local.GetName()
+}
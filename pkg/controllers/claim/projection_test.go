@@ -0,0 +1,223 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package claim
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/meta"
+	"github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/claim"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/crossplane/agent/pkg/resource"
+)
+
+func TestStatusProjector(t *testing.T) {
+	errBoom := errors.New("boom")
+	local := func(fields string) *claim.Unstructured {
+		c := claim.New(claim.WithGroupVersionKind(gvk))
+		c.SetNamespace("cool-ns")
+		c.SetName("cool-claim")
+		c.SetUID(types.UID("cool-uid"))
+		c.SetWriteConnectionSecretToReference(&v1alpha1.LocalSecretReference{Name: "cool-secret"})
+		if fields != "" {
+			meta.AddAnnotations(c, map[string]string{resource.AnnotationKeyStatusConfigMap: fields})
+		}
+		return c
+	}
+	remote := claim.New()
+	remote.Object["status"] = map[string]interface{}{
+		"endpoint": "db.example.org",
+		"port":     int64(5432),
+		"tls":      map[string]interface{}{"enabled": true},
+	}
+	projected := func(data map[string]string) *corev1.ConfigMap {
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "cool-ns", Name: "cool-secret"},
+			Data:       data,
+		}
+		l := local("")
+		meta.AddLabels(cm, map[string]string{resource.LabelKeyOwnerUID: "cool-uid"})
+		meta.AddOwnerReference(cm, meta.AsController(meta.ReferenceTo(l, l.GroupVersionKind())))
+		return cm
+	}
+
+	type want struct {
+		err     error
+		created *corev1.ConfigMap
+		updated *corev1.ConfigMap
+		deleted *corev1.ConfigMap
+	}
+	cases := map[string]struct {
+		reason   string
+		local    *claim.Unstructured
+		opts     []StatusProjectorOption
+		existing *corev1.ConfigMap
+		get      error
+		want     want
+	}{
+		"NotAnnotated": {
+			reason: "Nothing should be projected for the claims without the annotation",
+			local:  local(""),
+			get:    kerrors.NewNotFound(schema.GroupResource{}, "cool-secret"),
+		},
+		"AnnotationRemoved": {
+			reason: "The ConfigMap should be deleted once the claim no longer has the annotation",
+			local:  local(""),
+			existing: func() *corev1.ConfigMap {
+				cm := projected(map[string]string{"endpoint": "db.example.org"})
+				cm.SetResourceVersion("1")
+				return cm
+			}(),
+			want: want{deleted: func() *corev1.ConfigMap {
+				cm := projected(map[string]string{"endpoint": "db.example.org"})
+				cm.SetResourceVersion("1")
+				return cm
+			}()},
+		},
+		"Unchanged": {
+			reason: "The ConfigMap should not be written if the projected fields didn't change",
+			local:  local("endpoint"),
+			existing: func() *corev1.ConfigMap {
+				cm := projected(map[string]string{"endpoint": "db.example.org"})
+				cm.SetResourceVersion("1")
+				return cm
+			}(),
+		},
+		"ForeignNamespace": {
+			reason: "The ConfigMap should be created next to a connection secret in another namespace, without an owner reference",
+			local: func() *claim.Unstructured {
+				c := local("endpoint")
+				meta.AddAnnotations(c, map[string]string{resource.AnnotationKeyConnectionSecretNamespace: "secrets"})
+				return c
+			}(),
+			opts: []StatusProjectorOption{WithProjectionNamespaces("secrets")},
+			get:  kerrors.NewNotFound(schema.GroupResource{}, "cool-secret"),
+			want: want{created: func() *corev1.ConfigMap {
+				cm := projected(map[string]string{"endpoint": "db.example.org"})
+				cm.SetNamespace("secrets")
+				cm.SetOwnerReferences(nil)
+				return cm
+			}()},
+		},
+		"ForeignNamespaceNotAllowed": {
+			reason: "The ConfigMap should not be written to a namespace that connection secrets may not be written to",
+			local: func() *claim.Unstructured {
+				c := local("endpoint")
+				meta.AddAnnotations(c, map[string]string{resource.AnnotationKeyConnectionSecretNamespace: "secrets"})
+				return c
+			}(),
+			want: want{err: errors.Errorf(errFmtSecretNamespace, "secrets")},
+		},
+		"Created": {
+			reason: "The ConfigMap should be created with the status fields the remote claim has, the scalars as they are and the rest as JSON",
+			local:  local("endpoint, port,tls,version"),
+			get:    kerrors.NewNotFound(schema.GroupResource{}, "cool-secret"),
+			want: want{created: projected(map[string]string{
+				"endpoint": "db.example.org",
+				"port":     "5432",
+				"tls":      `{"enabled":true}`,
+			})},
+		},
+		"Updated": {
+			reason: "The ConfigMap should be replaced so that the fields that are no longer projected are dropped",
+			local:  local("endpoint"),
+			existing: func() *corev1.ConfigMap {
+				cm := projected(map[string]string{"endpoint": "old.example.org", "port": "5432"})
+				cm.SetResourceVersion("1")
+				return cm
+			}(),
+			want: want{updated: func() *corev1.ConfigMap {
+				cm := projected(map[string]string{"endpoint": "db.example.org"})
+				cm.SetResourceVersion("1")
+				return cm
+			}()},
+		},
+		"NotOwned": {
+			reason: "A ConfigMap that isn't controlled by the claim shouldn't be overwritten",
+			local:  local("endpoint"),
+			existing: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "cool-ns", Name: "cool-secret", ResourceVersion: "1"},
+			},
+			want: want{err: resource.LocalError(resource.ErrNotOwned, errUpdateStatusConfigMap)},
+		},
+		"InvalidKey": {
+			reason: "A status field that cannot be a key of a ConfigMap should be an error",
+			local:  local("endpoints[0]"),
+			want:   want{err: errors.Errorf(errFmtStatusFieldKey, "endpoints[0]", strings.Join(validation.IsConfigMapKey("endpoints[0]"), ", "))},
+		},
+		"GetError": {
+			reason: "Errors getting the ConfigMap should be returned",
+			local:  local("endpoint"),
+			get:    errBoom,
+			want:   want{err: resource.LocalError(errBoom, errGetStatusConfigMap)},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var created, updated, deleted *corev1.ConfigMap
+			kube := &test.MockClient{
+				MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+					if tc.get != nil {
+						return tc.get
+					}
+					tc.existing.DeepCopyInto(obj.(*corev1.ConfigMap))
+					return nil
+				},
+				MockCreate: func(_ context.Context, obj runtime.Object, _ ...client.CreateOption) error {
+					created = obj.(*corev1.ConfigMap)
+					return nil
+				},
+				MockUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+					updated = obj.(*corev1.ConfigMap)
+					return nil
+				},
+				MockDelete: func(_ context.Context, obj runtime.Object, _ ...client.DeleteOption) error {
+					deleted = obj.(*corev1.ConfigMap)
+					return nil
+				},
+			}
+			err := NewStatusProjector(kube, tc.opts...).Propagate(context.Background(), tc.local, remote)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\nPropagate(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.created, created); diff != "" {
+				t.Errorf("\nReason: %s\nPropagate(...): -want created, +got created:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.updated, updated); diff != "" {
+				t.Errorf("\nReason: %s\nPropagate(...): -want updated, +got updated:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.deleted, deleted); diff != "" {
+				t.Errorf("\nReason: %s\nPropagate(...): -want deleted, +got deleted:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package claim
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
+	"github.com/crossplane/crossplane-runtime/pkg/meta"
+	runtimeresource "github.com/crossplane/crossplane-runtime/pkg/resource"
+	"github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/claim"
+
+	"github.com/crossplane/agent/pkg/encryption"
+	"github.com/crossplane/agent/pkg/resource"
+)
+
+const (
+	fieldPublishConnectionDetailsTo = "spec.publishConnectionDetailsTo"
+
+	errGetPublishTo         = "cannot get publishConnectionDetailsTo of claim"
+	errSetPublishTo         = "cannot set publishConnectionDetailsTo of claim"
+	errGetPublishedSecret   = "cannot get published connection secret"
+	errApplyPublishedSecret = "cannot apply published connection secret"
+)
+
+// PublishConnectionDetailsTo is where a claim publishes its connection
+// details through a secret store instead of writeConnectionSecretToRef.
+type PublishConnectionDetailsTo struct {
+	// Name of the connection secret in the store.
+	Name string `json:"name"`
+
+	// ConfigRef is the StoreConfig of the store. The store named default is
+	// used if it's not given.
+	ConfigRef *StoreConfigReference `json:"configRef,omitempty"`
+
+	// Metadata of the connection secret.
+	Metadata *ConnectionSecretMetadata `json:"metadata,omitempty"`
+}
+
+// StoreConfigReference refers to a StoreConfig.
+type StoreConfigReference struct {
+	Name string `json:"name"`
+}
+
+// ConnectionSecretMetadata is the metadata of a published connection secret.
+type ConnectionSecretMetadata struct {
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Type        *v1.SecretType    `json:"type,omitempty"`
+}
+
+// GetPublishConnectionDetailsTo returns where the supplied claim publishes its
+// connection details, or nil if it doesn't publish them through a secret
+// store.
+func GetPublishConnectionDetailsTo(c *claim.Unstructured) (*PublishConnectionDetailsTo, error) {
+	p := &PublishConnectionDetailsTo{}
+	err := fieldpath.Pave(c.GetUnstructured().UnstructuredContent()).GetValueInto(fieldPublishConnectionDetailsTo, p)
+	if fieldpath.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, errGetPublishTo)
+	}
+	if p.Name == "" {
+		return nil, nil
+	}
+	return p, nil
+}
+
+// configurePublishConnectionDetailsTo maps the name of the connection secret
+// that the remote claim publishes its connection details as the same way the
+// name of its writeConnectionSecretToRef is mapped, since the Kubernetes
+// secret stores write them to the namespace of the remote claim. The remote
+// claim of a transferred claim keeps the name it has.
+func configurePublishConnectionDetailsTo(m KeyMapper, local, remote *claim.Unstructured, existing string) error {
+	p, err := GetPublishConnectionDetailsTo(local)
+	if err != nil || p == nil {
+		return err
+	}
+	name := m.RemoteKey(types.NamespacedName{Namespace: local.GetNamespace(), Name: p.Name}).Name
+	if _, ok := local.GetAnnotations()[resource.AnnotationKeyRemoteClaim]; ok && existing != "" {
+		name = existing
+	}
+	return errors.Wrap(fieldpath.Pave(remote.GetUnstructured().UnstructuredContent()).SetString(fieldPublishConnectionDetailsTo+".name", name), errSetPublishTo)
+}
+
+// publishedSecretName returns the name of the connection secret that the
+// supplied claim publishes its connection details as, if any.
+func publishedSecretName(c *claim.Unstructured) string {
+	name, _ := fieldpath.Pave(c.GetUnstructured().UnstructuredContent()).GetString(fieldPublishConnectionDetailsTo + ".name")
+	return name
+}
+
+// propagatePublished mirrors the connection secret that the remote claim
+// published with a Kubernetes secret store in the remote cluster as the
+// connection secret that the local claim would have published with the same
+// store in the local cluster, i.e. with the name and metadata of its
+// publishConnectionDetailsTo in its own namespace. Nothing is mirrored for the
+// other secret stores, e.g. Vault, since both clusters can read those.
+func (csp *ConnectionSecretPropagator) propagatePublished(ctx context.Context, local, remote *claim.Unstructured) error {
+	p, err := GetPublishConnectionDetailsTo(local)
+	if err != nil || p == nil {
+		return err
+	}
+	rname := publishedSecretName(remote)
+	if rname == "" {
+		return nil
+	}
+	rs := &v1.Secret{}
+	err = csp.remoteClient.Get(ctx, types.NamespacedName{Namespace: remote.GetNamespace(), Name: rname}, rs)
+	if kerrors.IsNotFound(err) {
+		// Either the details aren't published yet or the store isn't a
+		// Kubernetes one in the remote cluster.
+		return nil
+	}
+	if err != nil {
+		return resource.RemoteError(err, errGetPublishedSecret)
+	}
+	ls, _ := resource.SanitizedDeepCopyObject(rs).(*v1.Secret)
+	ls.SetName(p.Name)
+	ls.SetNamespace(local.GetNamespace())
+	meta.AddLabels(ls, csp.claimLabels(local))
+	if md := p.Metadata; md != nil {
+		meta.AddLabels(ls, md.Labels)
+		meta.AddAnnotations(ls, md.Annotations)
+		if md.Type != nil {
+			ls.Type = *md.Type
+		}
+	}
+	meta.AddLabels(ls, map[string]string{resource.LabelKeyOwnerUID: string(local.GetUID())})
+	meta.AddOwnerReference(ls, meta.AsController(meta.ReferenceTo(local, local.GroupVersionKind())))
+	resource.SetSyncID(ctx, ls)
+	removed := map[string]interface{}{}
+	ao := append([]runtimeresource.ApplyOption{resolveSecretConflict(csp.conflictPolicy, local.GetUID()), csp.recordRemovedLabels(removed)}, csp.applyOpts...)
+	if csp.encrypter != nil {
+		if err := csp.encrypter.Encrypt(ctx, ls); err != nil {
+			return errors.Wrap(err, errEncryptSecret)
+		}
+		ao = append(ao, encryption.KeepUnchanged())
+	}
+	if err := csp.localClient.Apply(ctx, ls, ao...); err != nil {
+		return resource.LocalError(err, errApplyPublishedSecret)
+	}
+	return resource.LocalError(csp.removeLabels(ctx, ls, removed), errUnlabelSecret)
+}
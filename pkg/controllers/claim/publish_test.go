@@ -0,0 +1,175 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package claim
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/pkg/meta"
+	runtimeresource "github.com/crossplane/crossplane-runtime/pkg/resource"
+	"github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/claim"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/crossplane/agent/pkg/resource"
+)
+
+func publishing(namespace, name string, publishTo map[string]interface{}) *claim.Unstructured {
+	c := claim.New(claim.WithGroupVersionKind(gvk))
+	c.SetNamespace(namespace)
+	c.SetName(name)
+	c.SetUID(types.UID("cool-uid"))
+	if publishTo != nil {
+		c.Object["spec"] = map[string]interface{}{"publishConnectionDetailsTo": publishTo}
+	}
+	return c
+}
+
+func TestConfigurePublishConnectionDetailsTo(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		local  *claim.Unstructured
+		remote *claim.Unstructured
+		want   string
+	}{
+		"NotPublished": {
+			reason: "Nothing should be published if the local claim doesn't publish its connection details",
+			local:  publishing("cool-ns", "cool-claim", nil),
+			remote: &claim.Unstructured{},
+		},
+		"Mapped": {
+			reason: "The name of the published connection secret should be mapped like the name of the claim",
+			local:  publishing("cool-ns", "cool-claim", map[string]interface{}{"name": "cool-details"}),
+			remote: &claim.Unstructured{},
+			want:   "cool-ns.cool-details",
+		},
+		"Transferred": {
+			reason: "The remote claim of a transferred claim should keep the name of its published connection secret",
+			local: func() *claim.Unstructured {
+				c := publishing("new-ns", "cool-claim", map[string]interface{}{"name": "cool-details"})
+				meta.AddAnnotations(c, map[string]string{resource.AnnotationKeyRemoteClaim: "remote-ns/cool-ns.cool-claim"})
+				return c
+			}(),
+			remote: publishing("remote-ns", "cool-ns.cool-claim", map[string]interface{}{"name": "cool-ns.cool-details"}),
+			want:   "cool-ns.cool-details",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := NewDefaultConfigurator(WithConfiguratorKeyMapper(NewNamespaceKeyMapper("remote-ns")))
+			if err := c.Configure(context.Background(), tc.local, tc.remote); err != nil {
+				t.Fatalf("\nReason: %s\nc.Configure(...): %s", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.want, publishedSecretName(tc.remote)); diff != "" {
+				t.Errorf("\nReason: %s\nc.Configure(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestPropagatePublished(t *testing.T) {
+	secretType := corev1.SecretType("connection.crossplane.io/v1alpha1")
+	publishTo := map[string]interface{}{
+		"name": "cool-details",
+		"metadata": map[string]interface{}{
+			"labels": map[string]interface{}{"team": "cool"},
+			"type":   string(secretType),
+		},
+	}
+	remote := publishing("remote-ns", "cool-ns.cool-claim", map[string]interface{}{"name": "cool-ns.cool-details"})
+
+	type args struct {
+		local        *claim.Unstructured
+		remoteClient runtimeresource.ClientApplicator
+		localClient  runtimeresource.ClientApplicator
+	}
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   error
+	}{
+		"NotPublished": {
+			reason: "Nothing should be mirrored if the local claim doesn't publish its connection details",
+			args: args{
+				local: publishing("cool-ns", "cool-claim", nil),
+			},
+		},
+		"NotInRemote": {
+			reason: "Nothing should be mirrored if the remote cluster has no published connection secret",
+			args: args{
+				local:        publishing("cool-ns", "cool-claim", publishTo),
+				remoteClient: runtimeresource.ClientApplicator{Client: &test.MockClient{MockGet: test.NewMockGetFn(kerrors.NewNotFound(schema.GroupResource{}, ""))}},
+			},
+		},
+		"GetFailed": {
+			reason: "An error should be returned if the published connection secret cannot be read",
+			args: args{
+				local:        publishing("cool-ns", "cool-claim", publishTo),
+				remoteClient: runtimeresource.ClientApplicator{Client: &test.MockClient{MockGet: test.NewMockGetFn(errBoom)}},
+			},
+			want: resource.RemoteError(errBoom, errGetPublishedSecret),
+		},
+		"Mirrored": {
+			reason: "The published connection secret should be mirrored with the name and metadata the local claim publishes it with",
+			args: args{
+				local: publishing("cool-ns", "cool-claim", publishTo),
+				remoteClient: runtimeresource.ClientApplicator{Client: &test.MockClient{MockGet: func(_ context.Context, key client.ObjectKey, obj runtime.Object) error {
+					if diff := cmp.Diff(types.NamespacedName{Namespace: "remote-ns", Name: "cool-ns.cool-details"}, key); diff != "" {
+						t.Errorf("\nReason: %s\n-want, +got:\n%s", "The published connection secret should be read from the namespace of the remote claim", diff)
+					}
+					obj.(*corev1.Secret).Data = map[string][]byte{"password": []byte("pass")}
+					return nil
+				}}},
+				localClient: runtimeresource.ClientApplicator{Applicator: runtimeresource.ApplyFn(func(_ context.Context, obj runtime.Object, _ ...runtimeresource.ApplyOption) error {
+					want := &corev1.Secret{
+						ObjectMeta: metav1.ObjectMeta{
+							Namespace: "cool-ns",
+							Name:      "cool-details",
+							Labels:    map[string]string{"team": "cool", resource.LabelKeyOwnerUID: "cool-uid"},
+						},
+						Type: secretType,
+						Data: map[string][]byte{"password": []byte("pass")},
+					}
+					l := publishing("cool-ns", "cool-claim", nil)
+					meta.AddOwnerReference(want, meta.AsController(meta.ReferenceTo(l, gvk)))
+					if diff := cmp.Diff(want, obj); diff != "" {
+						t.Errorf("\nReason: %s\n-want, +got:\n%s", "The published connection secret should be mirrored into the namespace of the local claim", diff)
+					}
+					return nil
+				})},
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			p := NewConnectionSecretPropagator(tc.args.localClient, tc.args.remoteClient)
+			err := p.Propagate(context.Background(), tc.args.local, &claim.Unstructured{Unstructured: *remote.DeepCopy()})
+			if diff := cmp.Diff(tc.want, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\np.Propagate(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -18,24 +18,44 @@ package claim
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kunstructured "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
+	"github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
 	"github.com/crossplane/crossplane-runtime/pkg/event"
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
 	"github.com/crossplane/crossplane-runtime/pkg/logging"
 	"github.com/crossplane/crossplane-runtime/pkg/meta"
 	runtimeresource "github.com/crossplane/crossplane-runtime/pkg/resource"
 	"github.com/crossplane/crossplane-runtime/pkg/resource/unstructured"
 	"github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/claim"
 
+	"github.com/crossplane/agent/pkg/approval"
+	"github.com/crossplane/agent/pkg/backpressure"
+	"github.com/crossplane/agent/pkg/digest"
+	"github.com/crossplane/agent/pkg/emergency"
+	"github.com/crossplane/agent/pkg/history"
+	"github.com/crossplane/agent/pkg/maintenance"
+	"github.com/crossplane/agent/pkg/metrics"
+	"github.com/crossplane/agent/pkg/notify"
 	"github.com/crossplane/agent/pkg/resource"
+	"github.com/crossplane/agent/pkg/sanitize"
+	"github.com/crossplane/agent/pkg/schedule"
+	"github.com/crossplane/agent/pkg/shard"
+	"github.com/crossplane/agent/pkg/snapshot"
 )
 
 const (
@@ -43,12 +63,10 @@ const (
 	longWait  = 1 * time.Minute
 	shortWait = 30 * time.Second
 	tinyWait  = 5 * time.Second
+	idleWait  = 5 * time.Minute
 
 	finalizer = "agent.crossplane.io/sync"
 
-	localPrefix  = "local cluster: "
-	remotePrefix = "remote cluster: "
-
 	errGetRequirement    = "cannot get claim"
 	errDeleteClaim       = "cannot delete claim"
 	errApplyClaim        = "cannot apply claim"
@@ -60,17 +78,58 @@ const (
 	errAddFinalizer      = "cannot add finalizer"
 	errGetSecret         = "cannot get secret"
 	errApplySecret       = "cannot apply secret"
+	errUnlabelSecret     = "cannot remove claim labels from secret"
+	errDeleteSecret      = "cannot delete secret"
+	errEncryptSecret     = "cannot encrypt secret"
+	errDefault           = "cannot run defaulter"
+	errListCompositions  = "cannot list compositions"
+	errEmergencyStop     = "cannot check emergency stop"
+	errMaintenance       = "cannot check maintenance mode"
+	errIgnoreFields      = "cannot preserve ignored fields"
+	errGetXRD            = "cannot get composite resource definition"
+	errGetComposite      = "cannot get composite resource"
+	errGetComposed       = "cannot get composed resource"
+	errListXRDs          = "cannot list composite resource definitions"
+	errPreCreateHook     = "cannot run pre-create hook"
+	errPostStatusHook    = "cannot run post-status hook"
+	errSanitize          = "cannot sanitize remote claim"
+	errAccessMetadata    = "cannot access object metadata"
+
+	errFmtNotField           = "path %s doesn't point to an object field"
+	errFmtListClaims         = "cannot list claims of kind %s"
+	errFmtGetClaimTemplate   = "cannot get claim template %s"
+	errFmtParseClaimTemplate = "cannot parse claim template %s"
+	errFmtParseKeyTemplate   = "cannot parse template of connection secret key %s"
+	errFmtRenderKeyTemplate  = "cannot render template of connection secret key %s"
+	errFmtSecretNamespace    = "connection secrets cannot be written to namespace %s"
+	errFmtUpdatePolicy       = "unknown composition update policy %s"
+	errFmtChangeExternalName = "cannot change the external name of the remote claim from %q to %q, it names the cloud resources the claim is composed of"
 )
 
+// Finalizer is the finalizer that the Reconciler adds to the local claims so
+// that their remote counterparts are deleted before they're gone.
+const Finalizer = finalizer
+
 // Event reasons.
 const (
-	reasonCannotGetFromRemote   event.Reason = "CannotGetFromRemote"
-	reasonCannotAddFinalizer    event.Reason = "CannotAddFinalizer"
-	reasonCannotRemoveFinalizer event.Reason = "CannotRemoveFinalizer"
-	reasonCannotConfigure       event.Reason = "CannotConfigure"
-	reasonCannotApply           event.Reason = "CannotApply"
-	reasonCannotPropagate       event.Reason = "CannotPropagate"
-	reasonCannotDelete          event.Reason = "CannotDelete"
+	reasonCannotGetFromRemote    event.Reason = "CannotGetFromRemote"
+	reasonCannotAddFinalizer     event.Reason = "CannotAddFinalizer"
+	reasonCannotRemoveFinalizer  event.Reason = "CannotRemoveFinalizer"
+	reasonCannotDefault          event.Reason = "CannotDefault"
+	reasonCannotConfigure        event.Reason = "CannotConfigure"
+	reasonCannotApply            event.Reason = "CannotApply"
+	reasonCannotPropagate        event.Reason = "CannotPropagate"
+	reasonCannotDelete           event.Reason = "CannotDelete"
+	reasonCannotCheckStop        event.Reason = "CannotCheckEmergencyStop"
+	reasonCannotCheckMaintenance event.Reason = "CannotCheckMaintenanceMode"
+	reasonDeletionCancelled      event.Reason = "DeletionCancelled"
+	reasonCannotRunHook          event.Reason = "CannotRunHook"
+	reasonRemoteConflict         event.Reason = "RemoteClaimConflict"
+	reasonCannotTransfer         event.Reason = "CannotTransferOwnership"
+	reasonTransferred            event.Reason = "TransferredOwnership"
+	reasonResyncRequired         event.Reason = "ResyncRequired"
+	reasonAdmissionDenied        event.Reason = "RemoteAdmissionDenied"
+	reasonSLAExceeded            event.Reason = "SLAExceeded"
 )
 
 // WithLogger specifies how the Reconciler should log messages.
@@ -102,15 +161,344 @@ func WithPropagator(p Propagator) ReconcilerOption {
 	}
 }
 
+// WithConfigurator specifies how the Reconciler should configure the remote
+// instance before it's applied.
+func WithConfigurator(c Configurator) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.Configurator = c
+	}
+}
+
+// WithRemoteKeyMapper specifies how the Reconciler should find the remote
+// counterpart of a local claim. The Configurator should map the claim the same
+// way, see WithConfiguratorKeyMapper.
+func WithRemoteKeyMapper(m KeyMapper) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.mapper = m
+	}
+}
+
+// WithBackoffTracker specifies the Tracker that the Reconciler should report
+// throttled remote requests to and consult for its requeue intervals. It's
+// meant to be shared by all claim reconcilers talking to the same remote.
+func WithBackoffTracker(t *backpressure.Tracker) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.backoff = t
+	}
+}
+
+// WithScheduler specifies the Scheduler that decides when the Reconciler
+// syncs the claims next. It's meant to be shared by all reconcilers.
+func WithScheduler(s schedule.Scheduler) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.scheduler = s
+	}
+}
+
+// WithConnectionSecretOptions specifies the options that the Reconciler should
+// configure its default ConnectionSecretPropagator with. It has no effect if
+// the Propagator is overridden with WithPropagator.
+func WithConnectionSecretOptions(opts ...ConnectionSecretPropagatorOption) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.secretOpts = append(r.secretOpts, opts...)
+	}
+}
+
+// WithoutConnectionSecrets specifies that the Reconciler should never copy the
+// connection secrets of the remote claims to the local cluster. The local
+// claims are marked with the location of their connection secrets in the
+// remote cluster instead. It has no effect if the Propagator is overridden
+// with WithPropagator.
+func WithoutConnectionSecrets() ReconcilerOption {
+	return func(r *Reconciler) {
+		r.withoutSecrets = true
+	}
+}
+
+// WithSecretWorkers specifies the SecretWorkers that the Reconciler should
+// queue the connection secrets of its claims to instead of propagating them
+// inline, so that slow or failing secret reads don't hold up the sync of the
+// claims. It has no effect if the Propagator is overridden with
+// WithPropagator or connection secrets are disabled with
+// WithoutConnectionSecrets.
+func WithSecretWorkers(w *SecretWorkers) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.secretWorkers = w
+	}
+}
+
+// WithSecretRetries specifies the SecretWorkers that the Reconciler should hand
+// the connection secrets of its claims that fail to propagate inline to, so
+// that they're retried with their own backoff while the claims keep being
+// synced on time. It has no effect if the Propagator is overridden with
+// WithPropagator, connection secrets are disabled with
+// WithoutConnectionSecrets or the secrets are propagated by SecretWorkers
+// altogether with WithSecretWorkers.
+func WithSecretRetries(w *SecretWorkers) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.secretRetries = w
+	}
+}
+
+// WithResyncQueue specifies the ResyncQueue that the Reconciler should hand
+// the routine resyncs of its claims to, i.e. the ones of the claims that
+// synced fine and are only checked again after a while, so that they wait
+// behind the claims that are new or changed. The controller of the Reconciler
+// has to watch the claims with the Handler of the ResyncQueue.
+func WithResyncQueue(q *ResyncQueue) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.resyncs = q
+	}
+}
+
+// WithApplyOptions specifies the ApplyOptions that the Reconciler should use
+// for all its applies, i.e. the claim in the remote cluster and, unless the
+// Propagator is overridden with WithPropagator, the connection secret in the
+// local cluster.
+func WithApplyOptions(opts ...runtimeresource.ApplyOption) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.applyOpts = append(r.applyOpts, opts...)
+	}
+}
+
+// WithMetadataEqualizer specifies how the Reconciler should equalize the
+// labels and annotations of the remote claims with the ones of the local
+// claims. The remote claims are patched with what the local ones have, and
+// keep the labels and annotations only they have, by default. The equalizer
+// should keep the annotations the DefaultConfigurator preserves, see
+// resource.PreservedAnnotations.Keep.
+func WithMetadataEqualizer(e resource.MetadataEqualizer) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.remote.Applicator = resource.NewEqualizingApplicator(r.remote.Client, e)
+		r.dryRun = resource.NewEqualizingApplicator(resource.NewDryRunClient(r.remote.Client), e)
+	}
+}
+
+// WithServerSideApply specifies that the Reconciler should apply the remote
+// claims with server-side apply as the supplied field manager rather than
+// patching them. The fields removed from the local claims are then removed
+// from the remote ones, and the fields that other managers own are reported
+// with a FieldConflict condition rather than overwritten. It overrides
+// WithMetadataEqualizer.
+func WithServerSideApply(manager string) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.remote.Applicator = resource.NewServerSideApplicator(r.remote.Client, manager)
+		r.dryRun = resource.NewServerSideApplicator(resource.NewDryRunClient(r.remote.Client), manager)
+	}
+}
+
+// WithIgnoredFields specifies the field paths of the claim that the Reconciler
+// should leave untouched on the remote instance once it exists, e.g. because
+// they're mutated by the policies of the remote cluster.
+func WithIgnoredFields(paths ...string) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.ignoredFields = func(_ context.Context) ([]string, error) { return paths, nil }
+	}
+}
+
+// WithIgnoredFieldsFn specifies how the Reconciler should get the field paths
+// of the claim that it should leave untouched on the remote instance once it
+// exists. It's called on every sync.
+func WithIgnoredFieldsFn(fn IgnoredFieldsFn) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.ignoredFields = fn
+	}
+}
+
+// WithDefaulters specifies the Defaulters that the Reconciler should run on
+// the local claim before it's forwarded to the remote cluster.
+func WithDefaulters(d ...Defaulter) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.defaulters = append(r.defaulters, d...)
+	}
+}
+
+// WithDeletionGracePeriod specifies how long the Reconciler should wait after a
+// local claim is deleted before it deletes the remote one, so that accidental
+// deletions can be cancelled before the infrastructure is torn down. The
+// deletion is cancelled by annotating the local claim with
+// resource.AnnotationKeyCancelDeletion while the grace period is running.
+func WithDeletionGracePeriod(d time.Duration) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.deletionGrace = d
+	}
+}
+
+// WithTeardownObserver specifies how the Reconciler should observe the progress
+// of the teardown of the composed resources of a remote claim that is being
+// deleted, which is reported in the Ready condition of the local claim.
+func WithTeardownObserver(o TeardownObserver) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.teardown = o
+	}
+}
+
+// WithEmergencyStop specifies the Switch that the Reconciler should consult
+// before writing to the remote cluster. It's meant to be shared by all claim
+// reconcilers talking to the same remote.
+func WithEmergencyStop(s *emergency.Switch) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.emergency = s
+	}
+}
+
+// WithMaintenance specifies the Mode that the Reconciler should consult before
+// deleting remote claims. It's meant to be shared by all claim reconcilers.
+func WithMaintenance(m *maintenance.Mode) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.frozen = m
+	}
+}
+
+// WithShard specifies the shard of the claims that the Reconciler should sync.
+// The claims of other shards are left to the agents that sync them.
+func WithShard(s *shard.Shard) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.shard = s
+	}
+}
+
+// WithDigest specifies the Recorder that the Reconciler should record the
+// outcome of its syncs to, e.g. a digest.Logger.
+func WithDigest(d digest.Recorder) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.digest = d
+	}
+}
+
+// WithNotifier specifies the Notifier that the Reconciler should notify about
+// the significant transitions of claims, i.e. when they're created in the
+// remote cluster, become ready, start failing and are deleted.
+func WithNotifier(n notify.Notifier) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.notifier = n
+	}
+}
+
+// WithPreRemoteCreateHooks specifies the Hooks that the Reconciler should run
+// right before a claim is created in the remote cluster, with the remote
+// instance in its final form. They may mutate the remote instance, and an
+// error blocks the creation, e.g. when a policy check fails.
+func WithPreRemoteCreateHooks(h ...Hook) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.preCreate = append(r.preCreate, h...)
+	}
+}
+
+// WithSanitizers specifies the Registry whose Sanitizers the Reconciler should
+// run on the remote claims right before they're applied. Defaults to
+// sanitize.Default.
+func WithSanitizers(s *sanitize.Registry) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.sanitizers = s
+	}
+}
+
+// WithPostStatusPropagationHooks specifies the Hooks that the Reconciler
+// should run once the status of the remote instance is propagated to the
+// local claim and persisted, e.g. to send notifications. Their errors are
+// reported in events but don't fail the sync.
+func WithPostStatusPropagationHooks(h ...Hook) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.postStatus = append(r.postStatus, h...)
+	}
+}
+
+// WithSlowReconcileThreshold specifies how long a reconcile may take before
+// it's logged along with how long each of its phases took. It's never logged
+// if the threshold is zero.
+func WithSlowReconcileThreshold(d time.Duration) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.slowThreshold = d
+	}
+}
+
+// WithHistory specifies the Recorder that the Reconciler should record every
+// sync of the claims to, e.g. a history.Buffer.
+func WithHistory(h history.Recorder) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.history = h
+	}
+}
+
+// WithRemoteSnapshots specifies the Recorder that the Reconciler should record
+// the remote claims it observes to, e.g. a snapshot.Store, keyed by their
+// local claims.
+func WithRemoteSnapshots(s snapshot.Recorder) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.snapshots = s
+	}
+}
+
+// WithStaleRemoteDetection specifies that the Reconciler should record which
+// generation of the local claim it last wrote to which remote claim, and stop
+// syncing a claim whose remote counterpart turns out to be older than that or
+// missing, e.g. because the remote cluster was restored from a backup, rather
+// than overwriting or recreating it. The record is persisted along with the
+// late initialized fields, so it has no effect if the Propagator is overridden
+// with WithPropagator.
+func WithStaleRemoteDetection() ReconcilerOption {
+	return func(r *Reconciler) {
+		r.detectStale = true
+	}
+}
+
+// WithStatusProjection specifies that the Reconciler should project the status
+// fields of the remote claims into ConfigMaps for the local claims that ask for
+// it with the resource.AnnotationKeyStatusConfigMap annotation. The ConfigMaps
+// are written next to the connection secrets, which may be in the supplied
+// namespaces other than the ones of the claims. It has no effect if the
+// Propagator is overridden with WithPropagator.
+func WithStatusProjection(secretNamespaces ...string) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.projectStatus = true
+		r.projectedNS = secretNamespaces
+	}
+}
+
+// WithProvisioningSLAs specifies how long the claims may take to become ready
+// after they're created, by kind. The claims that take longer are marked with
+// an SLAExceeded condition, an event and the
+// crossplane_agent_claim_sla_exceeded_total metric.
+func WithProvisioningSLAs(s ProvisioningSLAs) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.sla = s.For(r.kind)
+	}
+}
+
+// WithClusterName specifies the name of this cluster in the remote cluster.
+// The Reconciler doesn't sync the remote claims that are labelled with another
+// cluster, see CheckRemoteOwner.
+func WithClusterName(cluster string) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.cluster = cluster
+	}
+}
+
+// WithApprovalKinds specifies the kinds of claims that the Reconciler should
+// hold in the local cluster with a PendingApproval condition until they're
+// approved, see approval.Approved.
+func WithApprovalKinds(kinds ...string) ReconcilerOption {
+	return func(r *Reconciler) {
+		for _, k := range kinds {
+			if k == r.kind {
+				r.approval = true
+			}
+		}
+	}
+}
+
 // ReconcilerOption is used to configure *Reconciler.
 type ReconcilerOption func(*Reconciler)
 
 // NewReconciler returns a new *Reconciler.
 func NewReconciler(mgr manager.Manager, remoteClient client.Client, gvk schema.GroupVersionKind, opts ...ReconcilerOption) *Reconciler {
-	ni := func() *claim.Unstructured { return claim.New(claim.WithGroupVersionKind(gvk)) }
+	// Claim instances are reused across reconciles since each one fetches both
+	// the local and the remote instance.
+	ni := resource.NewObjectPool(func() runtime.Object { return claim.New(claim.WithGroupVersionKind(gvk)) })
 	lc := unstructured.NewClient(mgr.GetClient())
 	lca := runtimeresource.ClientApplicator{
-		Client:     lc,
+		Client:     &statusTimingClient{Client: lc},
 		Applicator: runtimeresource.NewAPIPatchingApplicator(lc),
 	}
 	rc := unstructured.NewClient(remoteClient)
@@ -120,31 +508,97 @@ func NewReconciler(mgr manager.Manager, remoteClient client.Client, gvk schema.G
 	}
 	r := &Reconciler{
 		mgr:          mgr,
+		gvk:          gvk,
+		kind:         gvk.Kind,
 		local:        lca,
 		remote:       rca,
-		newInstance:  ni,
+		dryRun:       runtimeresource.NewAPIPatchingApplicator(resource.NewDryRunClient(rc)),
+		instances:    ni,
+		mapper:       NewIdentityKeyMapper(),
+		backoff:      backpressure.NewTracker(),
+		scheduler:    schedule.NewNopScheduler(),
+		emergency:    emergency.NewSwitch(),
+		frozen:       maintenance.NewMode(),
 		log:          logging.NewNopLogger(),
 		finalizer:    runtimeresource.NewAPIFinalizer(lc, finalizer),
+		teardown:     NewNopTeardownObserver(),
 		Configurator: NewDefaultConfigurator(),
-		Propagator: NewPropagatorChain(
-			NewLateInitializer(lc),
-			NewStatusPropagator(),
-			NewConnectionSecretPropagator(lca, rca),
-		),
-		record: event.NewNopRecorder(),
+		record:       event.NewNopRecorder(),
+		digest:       digest.NewNopRecorder(),
+		history:      history.NewNopRecorder(),
+		snapshots:    snapshot.NewNopRecorder(),
+		notifier:     notify.NewNopNotifier(),
+		sanitizers:   sanitize.Default,
+
+		ignoredFields: func(_ context.Context) ([]string, error) { return nil, nil },
+		slowThreshold: timeout / 4,
 	}
 
 	for _, f := range opts {
 		f(r)
 	}
+
+	// The default Propagator is built after the options are applied since its
+	// components can be configured via options as well.
+	if r.Propagator == nil {
+		var sp Propagator = NewConnectionSecretPropagator(lca, rca, append([]ConnectionSecretPropagatorOption{WithSecretApplyOptions(r.applyOpts...)}, r.secretOpts...)...)
+		switch {
+		case r.withoutSecrets:
+			sp = NewConnectionSecretLocator()
+		case r.secretWorkers != nil:
+			r.secretWorkers.Register(gvk, sp, r.mapper, r.cluster)
+			sp = r.secretWorkers.Enqueuer(gvk)
+		case r.secretRetries != nil:
+			r.secretRetries.Register(gvk, sp, r.mapper, r.cluster)
+			sp = r.secretRetries.Retrier(gvk)
+		}
+		pc := NewPropagatorChain(
+			NewLateInitializer(lc),
+			NewStatusPropagator(),
+			timedPropagator(phaseSecret, sp),
+		)
+		// The status is projected after the connection secret is propagated
+		// so that an error projecting it doesn't hold the secret back.
+		if r.projectStatus {
+			pc = append(pc, NewStatusProjector(lc, WithProjectionNamespaces(r.projectedNS...)))
+		}
+		r.Propagator = pc
+	}
 	return r
 }
 
+// Defaulter fills in the fields of the local claim before it's forwarded to
+// the remote cluster.
+type Defaulter interface {
+	Default(ctx context.Context, local *claim.Unstructured) error
+}
+
+// A Hook is run by the Reconciler at a point of the lifecycle of a claim with
+// its local and remote instances, so that integrators can inject their own
+// mutations, policy checks or notifications.
+type Hook interface {
+	Run(ctx context.Context, local, remote *claim.Unstructured) error
+}
+
+// HookFn is used to construct a Hook with a bare function.
+type HookFn func(ctx context.Context, local, remote *claim.Unstructured) error
+
+// Run calls the supplied function.
+func (fn HookFn) Run(ctx context.Context, local, remote *claim.Unstructured) error {
+	return fn(ctx, local, remote)
+}
+
 // Configurator configures the supplied remote instance.
 type Configurator interface {
 	Configure(ctx context.Context, local, remote *claim.Unstructured) error
 }
 
+// TeardownObserver observes how far the deletion of the composed resources of
+// a remote claim has progressed.
+type TeardownObserver interface {
+	Observe(ctx context.Context, remote *claim.Unstructured) (Teardown, error)
+}
+
 // Propagator is used to propagate values from remote to the local object.
 type Propagator interface {
 	Propagate(ctx context.Context, local, remote *claim.Unstructured) error
@@ -153,82 +607,327 @@ type Propagator interface {
 // Reconciler syncs the given claim instance from local cluster to remote
 // cluster and fetches its connection secret to local cluster if it's available.
 type Reconciler struct {
+	resource.ManagerContext
+
 	mgr    ctrl.Manager
+	gvk    schema.GroupVersionKind
+	kind   string
 	local  runtimeresource.ClientApplicator
 	remote runtimeresource.ClientApplicator
 
-	newInstance func() *claim.Unstructured
+	// dryRun applies the remote claims like remote does, but only dry-runs
+	// the writes.
+	dryRun runtimeresource.Applicator
 
-	finalizer runtimeresource.Finalizer
+	instances *resource.ObjectPool
+	mapper    KeyMapper
+	backoff   *backpressure.Tracker
+	scheduler schedule.Scheduler
+	resyncs   *ResyncQueue
+	emergency *emergency.Switch
+	frozen    *maintenance.Mode
+
+	finalizer      runtimeresource.Finalizer
+	secretOpts     []ConnectionSecretPropagatorOption
+	withoutSecrets bool
+	secretWorkers  *SecretWorkers
+	secretRetries  *SecretWorkers
+	applyOpts      []runtimeresource.ApplyOption
+	defaulters     []Defaulter
+	ignoredFields  IgnoredFieldsFn
+	deletionGrace  time.Duration
+	teardown       TeardownObserver
+	preCreate      []Hook
+	sanitizers     *sanitize.Registry
+	postStatus     []Hook
+	slowThreshold  time.Duration
+	detectStale    bool
+	projectStatus  bool
+	projectedNS    []string
+	sla            time.Duration
+	approval       bool
+	cluster        string
+	shard          *shard.Shard
 	Configurator
 	Propagator
 
-	log    logging.Logger
-	record event.Recorder
+	log       logging.Logger
+	record    event.Recorder
+	digest    digest.Recorder
+	history   history.Recorder
+	snapshots snapshot.Recorder
+	notifier  notify.Notifier
 }
 
 // Reconcile watches the given type and does necessary sync operations.
-func (r *Reconciler) Reconcile(req reconcile.Request) (reconcile.Result, error) { // nolint:gocyclo
-	log := r.log.WithValues("request", req)
+func (r *Reconciler) Reconcile(req reconcile.Request) (reconcile.Result, error) {
+	return r.ReconcileContext(r.Context(), req)
+}
+
+// ReconcileContext is Reconcile with the supplied context, which the context
+// of the reconcile is derived from. The reconcile is cancelled once the
+// supplied context is.
+func (r *Reconciler) ReconcileContext(ctx context.Context, req reconcile.Request) (result reconcile.Result, err error) {
+	defer func() { result = r.requeue(req, result, err) }()
+	return r.reconcile(ctx, req)
+}
+
+// requeue returns the result that the reconcile of the claim with the supplied
+// request should return instead of the supplied result and error, and records
+// when the claim is synced next.
+func (r *Reconciler) requeue(req reconcile.Request, result reconcile.Result, err error) reconcile.Result {
+	// The claims that synced fine are checked again only after a while, and
+	// the claims that are still being provisioned or that failed sooner.
+	routine := err == nil && result.RequeueAfter >= longWait
+	// All claims are slowed down together while the remote cluster is
+	// saturated since retrying each one on its own would make it worse.
+	result.RequeueAfter = r.backoff.Scale(result.RequeueAfter)
+	result = r.scheduler.Schedule(schedule.Key{Controller: r.kind, Namespace: req.Namespace, Name: req.Name}, result, err)
+	if routine && r.resyncs != nil {
+		r.resyncs.Defer(r.gvk, req, result.RequeueAfter)
+		return reconcile.Result{}
+	}
+	return result
+}
+
+func (r *Reconciler) reconcile(ctx context.Context, req reconcile.Request) (result reconcile.Result, err error) { // nolint:gocyclo
+	id := resource.NewSyncID()
+	log := r.log.WithValues("request", req, "sync-id", id)
 	log.Debug("Reconciling")
 
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	ctx, cancel := context.WithTimeout(resource.WithSyncID(ctx, id), timeout)
 	defer cancel()
 
+	// How much of the timeout each phase takes is measured so that the
+	// timeouts can be tuned.
+	ctx, times := withPhaseTimes(ctx)
+	start := time.Now()
+	defer func() { times.report(log, r.kind, time.Since(start), r.slowThreshold) }()
+
 	// The reconciliation is triggered for the local claim instance, so, if it
 	// cannot be fetched for any reason, then that's a problem.
-	localClaim := r.newInstance()
-	if err := r.local.Get(ctx, req.NamespacedName, localClaim); err != nil {
+	localClaim, _ := r.instances.Get().(*claim.Unstructured)
+	defer r.instances.Put(localClaim)
+	t := time.Now()
+	err = r.local.Get(ctx, req.NamespacedName, localClaim)
+	observePhase(ctx, phaseLocalGet, t)
+	if err != nil {
 		if kerrors.IsNotFound(err) {
+			r.snapshots.Forget(snapshot.Key{Kind: r.kind, Namespace: req.Namespace, Name: req.Name})
 			return reconcile.Result{Requeue: false}, nil
 		}
-		return reconcile.Result{RequeueAfter: shortWait}, errors.Wrap(err, localPrefix+errGetRequirement)
+		return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(err, errGetRequirement)
+	}
+
+	// The claims whose labels moved them to another shard are still requeued
+	// by their last sync, which is the only one that reaches them here.
+	if r.shard != nil && !r.shard.Owns(localClaim, localClaim.GetObjectKind().GroupVersionKind().GroupKind()) {
+		log.Debug("Claim belongs to another shard")
+		return reconcile.Result{}, nil
+	}
+
+	// An exceeded SLA is reported only once the condition that says so is
+	// persisted, so that it's not reported again if the status update fails.
+	exceeded := localClaim.GetCondition(resource.TypeSLAExceeded).Status == corev1.ConditionTrue
+	defer func() {
+		if err == nil && !exceeded && localClaim.GetCondition(resource.TypeSLAExceeded).Status == corev1.ConditionTrue {
+			metrics.ClaimSLAExceeded.WithLabelValues(localClaim.GetKind()).Inc()
+			r.record.Event(localClaim, event.Warning(reasonSLAExceeded, errors.New(localClaim.GetCondition(resource.TypeSLAExceeded).Message)))
+		}
+	}()
+
+	// Every sync is remembered with the condition it leaves the local claim
+	// with.
+	action := history.ActionSync
+	defer func() { r.remember(localClaim, id, action, start) }()
+
+	remoteKey := RemoteKeyOf(r.mapper, localClaim)
+
+	// The ownership of the remote instance can be handed over to a new local
+	// instance in another namespace or with another name.
+	if !meta.WasDeleted(localClaim) {
+		to, ok, terr := TransferTarget(localClaim)
+		if terr != nil {
+			r.record.Event(localClaim, event.Warning(reasonCannotTransfer, terr))
+			r.fail(localClaim, terr)
+			return reconcile.Result{RequeueAfter: longWait}, resource.LocalError(r.local.Status().Update(ctx, localClaim), errStatusUpdateClaim)
+		}
+		if ok {
+			action = history.ActionTransfer
+			return r.transfer(ctx, log, localClaim, to, remoteKey)
+		}
 	}
 
 	// We fetch the remote claim instance that corresponds to this one and ignore
 	// the NotFound error since this pass could be the first one where the remote
 	// instance will be created.
-	remoteClaim := r.newInstance()
-	err := r.remote.Get(ctx, req.NamespacedName, remoteClaim)
+	remoteClaim, _ := r.instances.Get().(*claim.Unstructured)
+	defer r.instances.Put(remoteClaim)
+	t = time.Now()
+	err = r.remote.Get(ctx, remoteKey, remoteClaim)
+	observePhase(ctx, phaseRemoteGet, t)
+	if err == nil {
+		r.snapshots.Observe(snapshot.Key{Kind: localClaim.GetKind(), Namespace: localClaim.GetNamespace(), Name: localClaim.GetName()}, remoteClaim.GetUnstructured())
+	}
 	if runtimeresource.IgnoreNotFound(err) != nil {
+		r.backoff.Observe(err)
 		log.Debug("Cannot get resource from remote", "error", err, "requeue-after", time.Now().Add(shortWait))
 		r.record.Event(localClaim, event.Warning(reasonCannotGetFromRemote, err))
-		localClaim.SetConditions(resource.AgentSyncError(errors.Wrap(err, remotePrefix+errGetRequirement)))
-		return reconcile.Result{RequeueAfter: shortWait}, errors.Wrap(r.local.Status().Update(ctx, localClaim), errStatusUpdateClaim)
+		r.fail(localClaim, resource.RemoteError(err, errGetRequirement))
+		return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(r.local.Status().Update(ctx, localClaim), errStatusUpdateClaim)
+	}
+
+	// A remote instance that another local instance syncs isn't this one's to
+	// write or delete, e.g. because both are mapped to it by mistake and the
+	// other one created it first, and neither is one that doesn't exist while the local
+	// instance points at it. A deleted local instance whose remote instance is
+	// gone is let go as usual.
+	if err == nil || !meta.WasDeleted(localClaim) {
+		if oerr := CheckRemoteOwner(localClaim, remoteClaim, err == nil, r.cluster); oerr != nil {
+			log.Info("Remote claim is not synced by this claim", "remote", remoteKey, "reason", oerr.Error())
+			r.record.Event(localClaim, event.Warning(reasonRemoteConflict, oerr))
+			if meta.WasDeleted(localClaim) {
+				return reconcile.Result{}, resource.LocalError(r.finalizer.RemoveFinalizer(ctx, localClaim), errRemoveFinalizer)
+			}
+			localClaim.SetConditions(resource.AgentSyncNotOwned(oerr.Error()))
+			return reconcile.Result{RequeueAfter: longWait}, resource.LocalError(r.local.Status().Update(ctx, localClaim), errStatusUpdateClaim)
+		}
+	}
+
+	halted, herr := r.emergency.Engaged(ctx)
+	if herr != nil {
+		log.Debug("Cannot check emergency stop", "error", herr, "requeue-after", time.Now().Add(shortWait))
+		r.record.Event(localClaim, event.Warning(reasonCannotCheckStop, herr))
+		r.fail(localClaim, resource.LocalError(herr, errEmergencyStop))
+		return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(r.local.Status().Update(ctx, localClaim), errStatusUpdateClaim)
+	}
+
+	frozen, ferr := r.frozen.Enabled(ctx)
+	if ferr != nil {
+		log.Debug("Cannot check maintenance mode", "error", ferr, "requeue-after", time.Now().Add(shortWait))
+		r.record.Event(localClaim, event.Warning(reasonCannotCheckMaintenance, ferr))
+		r.fail(localClaim, resource.LocalError(ferr, errMaintenance))
+		return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(r.local.Status().Update(ctx, localClaim), errStatusUpdateClaim)
 	}
 
 	// If local claim instance is deleted, we need to clean up the remote instance
 	// before allowing it to disappear from api-server.
 	if meta.WasDeleted(localClaim) {
+		action = history.ActionDelete
 
 		// If the remote instance is already gone, then there is nothing else we
 		// need to clean up. The connection secret we created will be deleted by
 		// api-server once local instance is gone since we added our owner ref
 		// to it.
 		if kerrors.IsNotFound(err) {
+			// Connection secrets in other namespaces cannot be owned by the
+			// local instance, so they're not garbage collected with it.
+			err := DeleteForeignConnectionSecret(ctx, r.local, localClaim)
+			if err == nil && r.projectStatus {
+				err = DeleteStatusConfigMap(ctx, r.local, localClaim)
+			}
+			if err != nil {
+				log.Debug("Cannot delete connection secret", "error", err, "requeue-after", time.Now().Add(shortWait))
+				r.record.Event(localClaim, event.Warning(reasonCannotDelete, err))
+				r.fail(localClaim, err)
+				return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(r.local.Status().Update(ctx, localClaim), errStatusUpdateClaim)
+			}
 			if err := r.finalizer.RemoveFinalizer(ctx, localClaim); err != nil {
 				log.Debug("Cannot remove finalizer", "error", err, "requeue-after", time.Now().Add(shortWait))
 				r.record.Event(localClaim, event.Warning(reasonCannotRemoveFinalizer, err))
-				localClaim.SetConditions(resource.AgentSyncError(errors.Wrap(err, localPrefix+errRemoveFinalizer)))
-				return reconcile.Result{RequeueAfter: shortWait}, errors.Wrap(r.local.Status().Update(ctx, localClaim), errStatusUpdateClaim)
+				r.fail(localClaim, resource.LocalError(err, errRemoveFinalizer))
+				return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(r.local.Status().Update(ctx, localClaim), errStatusUpdateClaim)
 			}
 			return reconcile.Result{}, nil
 		}
 
+		// The remote instance is kept, and so is the local one, until the
+		// emergency stop is disengaged.
+		if halted {
+			localClaim.SetConditions(resource.AgentSyncHalted())
+			return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(r.local.Status().Update(ctx, localClaim), errStatusUpdateClaim)
+		}
+
+		// The remote instance is kept until the deletion grace period passes.
+		// Since it's counted from the deletion timestamp, it survives restarts.
+		if r.deletionGrace > 0 {
+			if remaining := DeletionRemaining(localClaim, r.deletionGrace); remaining > 0 {
+				deadline := localClaim.GetDeletionTimestamp().Add(r.deletionGrace)
+				if !DeletionCancelled(localClaim) {
+					localClaim.SetConditions(resource.AgentSyncDeletionPending(deadline, remaining))
+					return reconcile.Result{RequeueAfter: minDuration(remaining, shortWait)}, resource.LocalError(r.local.Status().Update(ctx, localClaim), errStatusUpdateClaim)
+				}
+				return r.release(ctx, log, localClaim)
+			}
+		}
+
+		// The remote instance isn't deleted while the local cluster is under
+		// maintenance, so that the claims that are deleted only to be
+		// recreated don't deprovision their infrastructure. The local
+		// instance is let go, and its remote instance is taken over if it's
+		// recreated.
+		if frozen {
+			return r.release(ctx, log, localClaim)
+		}
+
+		// The deletion is recorded on the local instance before it's requested
+		// so that it's completed first thing on the next start if the agent
+		// stops before the local instance is let go.
+		if _, ok := localClaim.GetAnnotations()[resource.AnnotationKeyDeletionRequested]; !ok {
+			meta.AddAnnotations(localClaim, map[string]string{resource.AnnotationKeyDeletionRequested: time.Now().UTC().Format(time.RFC3339)})
+			if err := r.local.Update(ctx, localClaim); err != nil {
+				log.Debug("Cannot record deletion", "error", err, "requeue-after", time.Now().Add(shortWait))
+				r.fail(localClaim, resource.LocalError(err, errUpdateClaim))
+				return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(r.local.Status().Update(ctx, localClaim), errStatusUpdateClaim)
+			}
+		}
+
 		// Start the deletion of remote instance and if it's already gone, that's
 		// not an error since that's what we'd like to achieve.
 		if err := r.remote.Delete(ctx, remoteClaim); runtimeresource.IgnoreNotFound(err) != nil {
+			r.backoff.Observe(err)
 			log.Debug("Cannot delete local object", "error", err, "requeue-after", time.Now().Add(shortWait))
 			r.record.Event(localClaim, event.Warning(reasonCannotDelete, err))
-			localClaim.SetConditions(resource.AgentSyncError(errors.Wrap(err, remotePrefix+errDeleteClaim)))
-			return reconcile.Result{RequeueAfter: shortWait}, errors.Wrap(r.local.Status().Update(ctx, localClaim), errStatusUpdateClaim)
+			r.fail(localClaim, resource.RemoteError(err, errDeleteClaim))
+			return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(r.local.Status().Update(ctx, localClaim), errStatusUpdateClaim)
+		}
+		if !meta.WasDeleted(remoteClaim) {
+			r.digest.Record(localClaim.GetKind(), digest.Deleted)
+			r.notify(localClaim, notify.Deleted, "")
 		}
 
 		// We have requested the deletion of the remote instance but that doesn't
 		// meant it's gone. So, we'll requeue and remove the finalizer only if we
 		// confirm that remote instance no longer exists.
 		localClaim.SetConditions(resource.AgentSyncSuccess().WithMessage("Deletion is successfully requested"))
-		return reconcile.Result{RequeueAfter: tinyWait}, errors.Wrap(r.local.Status().Update(ctx, localClaim), errStatusUpdateClaim)
+
+		// The remote instance may take a while to go away if it's waiting for
+		// its composed resources to be deleted, so we tell how far it's got.
+		if meta.WasDeleted(remoteClaim) {
+			t, err := r.teardown.Observe(ctx, remoteClaim)
+			if err != nil {
+				log.Debug("Cannot observe teardown", "error", err)
+			}
+			localClaim.SetConditions(resource.RemoteDeleting(remoteClaim.GetDeletionTimestamp().Time, t.Total, t.Remaining))
+		}
+		return reconcile.Result{RequeueAfter: tinyWait}, resource.LocalError(r.local.Status().Update(ctx, localClaim), errStatusUpdateClaim)
+	}
+
+	// A remote instance that is older than the one the local instance was last
+	// synced to isn't overwritten, and doesn't overwrite the local instance,
+	// until someone decides which of them is right. Neither is a missing one
+	// recreated if the local instance was synced to one before.
+	if r.detectStale {
+		why, ok := SyncLost(localClaim)
+		if err == nil {
+			why, ok = SyncDiverged(localClaim, remoteClaim)
+		}
+		if ok {
+			log.Info("Remote claim diverged from the one the claim was last synced to", "remote", remoteKey, "reason", why)
+			r.record.Event(localClaim, event.Warning(reasonResyncRequired, errors.New(why)))
+			localClaim.SetConditions(resource.AgentSyncResyncRequired(why))
+			return reconcile.Result{RequeueAfter: longWait}, resource.LocalError(r.local.Status().Update(ctx, localClaim), errStatusUpdateClaim)
+		}
 	}
 
 	// At this point, we will begin the operations that will need some cleanup in
@@ -238,8 +937,64 @@ func (r *Reconciler) Reconcile(req reconcile.Request) (reconcile.Result, error)
 	if err := r.finalizer.AddFinalizer(ctx, localClaim); err != nil {
 		log.Debug("Cannot add finalizer", "error", err, "requeue-after", time.Now().Add(shortWait))
 		r.record.Event(localClaim, event.Warning(reasonCannotAddFinalizer, err))
-		localClaim.SetConditions(resource.AgentSyncError(errors.Wrap(err, localPrefix+errAddFinalizer)))
-		return reconcile.Result{RequeueAfter: shortWait}, errors.Wrap(r.local.Status().Update(ctx, localClaim), errStatusUpdateClaim)
+		r.fail(localClaim, resource.LocalError(err, errAddFinalizer))
+		return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(r.local.Status().Update(ctx, localClaim), errStatusUpdateClaim)
+	}
+
+	// Nothing is written to the remote cluster while the emergency stop is
+	// engaged. The remote instance, if there is one, is still propagated to
+	// the local one so that users keep seeing its status.
+	if halted {
+		if kerrors.IsNotFound(err) {
+			localClaim.SetConditions(resource.AgentSyncHalted())
+			return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(r.local.Status().Update(ctx, localClaim), errStatusUpdateClaim)
+		}
+		return r.propagate(ctx, log, localClaim, remoteClaim, resource.AgentSyncHalted(), shortWait)
+	}
+
+	// The remote instance isn't created or updated while the local cluster
+	// is under maintenance, since the local instance may be a half restored
+	// one. Its status keeps being propagated.
+	if frozen {
+		if kerrors.IsNotFound(err) {
+			localClaim.SetConditions(resource.AgentSyncFrozen())
+			return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(r.local.Status().Update(ctx, localClaim), errStatusUpdateClaim)
+		}
+		return r.propagate(ctx, log, localClaim, remoteClaim, resource.AgentSyncFrozen(), shortWait)
+	}
+
+	// Some fields of the local claim can be filled in by the agent before it's
+	// forwarded. The LateInitializer persists them in the local cluster once
+	// the remote instance is applied.
+	for _, d := range r.defaulters {
+		if err := d.Default(ctx, localClaim); err != nil {
+			log.Debug("Cannot run defaulter", "error", err, "requeue-after", time.Now().Add(shortWait))
+			r.record.Event(localClaim, event.Warning(reasonCannotDefault, err))
+			r.fail(localClaim, errors.Wrap(err, errDefault))
+			return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(r.local.Status().Update(ctx, localClaim), errStatusUpdateClaim)
+		}
+	}
+
+	// The ignored fields are owned by the remote cluster once the remote
+	// instance exists, so we keep what it has in them.
+	var observed *claim.Unstructured
+	var ignored []string
+	if err == nil {
+		paths, err := r.ignoredFields(ctx)
+		if err != nil {
+			log.Debug("Cannot get ignored fields", "error", err, "requeue-after", time.Now().Add(shortWait))
+			r.record.Event(localClaim, event.Warning(reasonCannotConfigure, err))
+			r.fail(localClaim, errors.Wrap(err, errIgnoreFields))
+			return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(r.local.Status().Update(ctx, localClaim), errStatusUpdateClaim)
+		}
+		if len(paths) > 0 {
+			ignored = paths
+			observed = &claim.Unstructured{Unstructured: *remoteClaim.DeepCopy()}
+		}
+	}
+	var current *kunstructured.Unstructured
+	if err == nil {
+		current = remoteClaim.GetUnstructured().DeepCopy()
 	}
 
 	// At this point, we are getting remote instance ready for Apply operation
@@ -247,27 +1002,387 @@ func (r *Reconciler) Reconcile(req reconcile.Request) (reconcile.Result, error)
 	if err := r.Configure(ctx, localClaim, remoteClaim); err != nil {
 		log.Debug("Cannot run configurator", "error", err, "requeue-after", time.Now().Add(shortWait))
 		r.record.Event(localClaim, event.Warning(reasonCannotConfigure, err))
-		localClaim.SetConditions(resource.AgentSyncError(errors.Wrap(err, errPush)))
-		return reconcile.Result{RequeueAfter: shortWait}, errors.Wrap(r.local.Status().Update(ctx, localClaim), errStatusUpdateClaim)
+		r.fail(localClaim, errors.Wrap(err, errPush))
+		return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(r.local.Status().Update(ctx, localClaim), errStatusUpdateClaim)
+	}
+	if err := r.sanitizers.Sanitize(ctx, r.gvk, remoteClaim); err != nil {
+		log.Debug("Cannot sanitize remote claim", "error", err, "requeue-after", time.Now().Add(shortWait))
+		r.record.Event(localClaim, event.Warning(reasonCannotConfigure, err))
+		r.fail(localClaim, errors.Wrap(err, errSanitize))
+		return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(r.local.Status().Update(ctx, localClaim), errStatusUpdateClaim)
+	}
+	if observed != nil {
+		if err := PreserveFields(observed, remoteClaim, ignored...); err != nil {
+			log.Debug("Cannot preserve ignored fields", "error", err, "requeue-after", time.Now().Add(shortWait))
+			r.record.Event(localClaim, event.Warning(reasonCannotConfigure, err))
+			r.fail(localClaim, errors.Wrap(err, errIgnoreFields))
+			return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(r.local.Status().Update(ctx, localClaim), errStatusUpdateClaim)
+		}
+	}
+
+	// A claim that is dry-run is only validated by the remote cluster, e.g.
+	// against its admission policies, and nothing is written to it.
+	if localClaim.GetAnnotations()[resource.AnnotationKeyDryRun] == "true" {
+		return r.dryRunClaim(ctx, log, localClaim, remoteClaim)
+	}
+	// The verdict of the last dry-run doesn't apply to a claim that's synced.
+	removeCondition(localClaim, resource.TypeDryRun)
+
+	// The claims of the kinds that need approval aren't forwarded until their
+	// current generation is approved, e.g. by a change management process.
+	approved := true
+	if r.approval {
+		approved, err = approval.Approved(ctx, r.local, localClaim)
+		if err != nil {
+			log.Debug("Cannot check whether claim is approved", "error", err, "requeue-after", time.Now().Add(shortWait))
+			r.fail(localClaim, err)
+			return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(r.local.Status().Update(ctx, localClaim), errStatusUpdateClaim)
+		}
+	}
+	if !approved {
+		log.Debug("Claim is pending approval", "requeue-after", time.Now().Add(longWait))
+		localClaim.SetConditions(resource.PendingApproval())
+		return reconcile.Result{RequeueAfter: longWait}, resource.LocalError(r.local.Status().Update(ctx, localClaim), errStatusUpdateClaim)
+	}
+	if r.detectStale {
+		StampSync(localClaim, remoteClaim)
 	}
 
 	// We create/update the final form of the instance in the remote cluster.
-	if err := r.remote.Apply(ctx, remoteClaim); err != nil {
+	rv := remoteClaim.GetResourceVersion()
+	if rv == "" {
+		for _, h := range r.preCreate {
+			if err := h.Run(ctx, localClaim, remoteClaim); err != nil {
+				log.Debug("Cannot run pre-create hook", "error", err, "requeue-after", time.Now().Add(shortWait))
+				r.record.Event(localClaim, event.Warning(reasonCannotRunHook, err))
+				r.fail(localClaim, errors.Wrap(err, errPreCreateHook))
+				return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(r.local.Status().Update(ctx, localClaim), errStatusUpdateClaim)
+			}
+		}
+	}
+	// The remote instance is only written if it'd change, so that it's not
+	// written on every sync just to stamp the sync ID.
+	err = nil
+	if current == nil || !resource.Unchanged(current, remoteClaim.GetUnstructured()) {
+		resource.SetSyncID(ctx, remoteClaim)
+		t = time.Now()
+		// The remote instance is checked again as it's written, in case
+		// another local instance created it since it was read.
+		err = r.remote.Apply(ctx, remoteClaim, append([]runtimeresource.ApplyOption{RemoteOwnedBy(localClaim, r.cluster)}, r.applyOpts...)...)
+		observePhase(ctx, phaseApply, t)
+	}
+	// The fields that are pinned by the annotations of the local claim are
+	// removed explicitly once the annotations are, since applying the
+	// remote claim doesn't remove them.
+	if err == nil && current != nil {
+		if p := UnpinCompositionRevision(localClaim, current); p != nil {
+			err = r.remote.Patch(ctx, remoteClaim, p)
+		}
+	}
+	if err != nil {
+		r.backoff.Observe(err)
 		log.Debug("Cannot call Apply", "error", err, "requeue-after", time.Now().Add(shortWait))
-		r.record.Event(localClaim, event.Warning(reasonCannotApply, err))
-		localClaim.SetConditions(resource.AgentSyncError(errors.Wrap(err, errApplyClaim)))
-		return reconcile.Result{RequeueAfter: shortWait}, errors.Wrap(r.local.Status().Update(ctx, localClaim), errStatusUpdateClaim)
+		r.fail(localClaim, resource.RemoteError(err, errApplyClaim))
+		// The fields that other managers own in the remote cluster are listed
+		// so that it's clear what needs to be changed there.
+		if fc := resource.FieldConflicts(err); len(fc) > 0 {
+			localClaim.SetConditions(resource.ConflictingFields(fc))
+		}
+		// The denials of the admission webhooks are reported as they are
+		// since they usually tell what's wrong with the claim itself.
+		if d := resource.AdmissionDenied(err); d != nil {
+			c := resource.RemoteAdmissionDenied(*d)
+			localClaim.SetConditions(c)
+			r.record.Event(localClaim, event.Warning(reasonAdmissionDenied, errors.New(c.Message)))
+		} else {
+			r.record.Event(localClaim, event.Warning(reasonCannotApply, err))
+		}
+		return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(r.local.Status().Update(ctx, localClaim), errStatusUpdateClaim)
+	}
+	if localClaim.GetCondition(resource.TypeFieldConflict).Status == corev1.ConditionTrue {
+		localClaim.SetConditions(resource.NoFieldConflicts())
+	}
+	if localClaim.GetCondition(resource.TypeRemoteAdmissionDenied).Status == corev1.ConditionTrue {
+		localClaim.SetConditions(resource.RemoteAdmitted())
+	}
+	if r.detectStale {
+		RecordSync(localClaim, remoteClaim, time.Now())
+	}
+	switch {
+	case rv == "":
+		action = history.ActionCreate
+		r.digest.Record(localClaim.GetKind(), digest.Created)
+		r.notify(localClaim, notify.Created, "")
+	case rv != remoteClaim.GetResourceVersion():
+		action = history.ActionUpdate
+		r.digest.Record(localClaim.GetKind(), digest.Updated)
 	}
 
 	// At this point, we have the remote instance in the remote cluster and the
 	// variable "remote" is updated. So, we will propagate new information from
 	// "remote" to "local"
+	return r.propagate(ctx, log, localClaim, remoteClaim, resource.AgentSyncSuccess(), SyncWait(remoteClaim, time.Now()))
+}
+
+// dryRunClaim applies the supplied remote claim like a sync would, but with a
+// server-side dry-run, and reports whether the remote cluster accepts it in
+// the DryRun condition of the supplied local claim. Nothing else is synced.
+func (r *Reconciler) dryRunClaim(ctx context.Context, log logging.Logger, localClaim, remoteClaim *claim.Unstructured) (reconcile.Result, error) {
+	if err := r.dryRun.Apply(ctx, remoteClaim, append([]runtimeresource.ApplyOption{RemoteOwnedBy(localClaim, r.cluster)}, r.applyOpts...)...); err != nil {
+		log.Debug("Remote cluster rejected the dry-run of the claim", "error", err)
+		msg := err.Error()
+		if d := resource.AdmissionDenied(err); d != nil {
+			msg = resource.RemoteAdmissionDenied(*d).Message
+		}
+		localClaim.SetConditions(resource.DryRunRejected(msg))
+		return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(r.local.Status().Update(ctx, localClaim), errStatusUpdateClaim)
+	}
+	log.Debug("Remote cluster accepted the dry-run of the claim")
+	localClaim.SetConditions(resource.DryRunAccepted())
+	return reconcile.Result{RequeueAfter: longWait}, resource.LocalError(r.local.Status().Update(ctx, localClaim), errStatusUpdateClaim)
+}
+
+// transfer replaces the supplied local claim with a new one with the supplied
+// key that is synced to the same remote claim. The local claim is deleted once
+// its finalizer is removed so that the remote claim is left alone.
+func (r *Reconciler) transfer(ctx context.Context, log logging.Logger, localClaim *claim.Unstructured, to, remote types.NamespacedName) (reconcile.Result, error) {
+	// The remote instance records the new local instance as its owner before
+	// the new one is created, so it's written only if the remote cluster isn't
+	// halted.
+	halted, err := r.emergency.Engaged(ctx)
+	if err != nil {
+		log.Debug("Cannot check emergency stop", "error", err, "requeue-after", time.Now().Add(shortWait))
+		r.record.Event(localClaim, event.Warning(reasonCannotCheckStop, err))
+		r.fail(localClaim, resource.LocalError(err, errEmergencyStop))
+		return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(r.local.Status().Update(ctx, localClaim), errStatusUpdateClaim)
+	}
+	if halted {
+		localClaim.SetConditions(resource.AgentSyncHalted())
+		return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(r.local.Status().Update(ctx, localClaim), errStatusUpdateClaim)
+	}
+	remoteClaim := claim.New(claim.WithGroupVersionKind(localClaim.GetObjectKind().GroupVersionKind()))
+	err = resource.RemoteError(r.remote.Get(ctx, remote, remoteClaim), errGetRequirement)
+	if err == nil {
+		err = HandOver(ctx, r.remote, localClaim, remoteClaim, to, r.cluster)
+	}
+	if err == nil {
+		err = Transfer(ctx, r.local, localClaim, to, remote)
+	}
+	if err == nil {
+		// Connection secrets in other namespaces cannot be owned by the local
+		// instance, so they're not garbage collected with it.
+		err = DeleteForeignConnectionSecret(ctx, r.local, localClaim)
+	}
+	if err == nil && r.projectStatus {
+		err = DeleteStatusConfigMap(ctx, r.local, localClaim)
+	}
+	if err != nil {
+		log.Debug("Cannot transfer ownership", "error", err, "requeue-after", time.Now().Add(shortWait))
+		r.record.Event(localClaim, event.Warning(reasonCannotTransfer, err))
+		r.fail(localClaim, err)
+		return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(r.local.Status().Update(ctx, localClaim), errStatusUpdateClaim)
+	}
+	if err := r.finalizer.RemoveFinalizer(ctx, localClaim); err != nil {
+		log.Debug("Cannot remove finalizer", "error", err, "requeue-after", time.Now().Add(shortWait))
+		r.record.Event(localClaim, event.Warning(reasonCannotRemoveFinalizer, err))
+		r.fail(localClaim, resource.LocalError(err, errRemoveFinalizer))
+		return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(r.local.Status().Update(ctx, localClaim), errStatusUpdateClaim)
+	}
+	if err := r.local.Delete(ctx, localClaim); runtimeresource.IgnoreNotFound(err) != nil {
+		return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(err, errDeleteClaim)
+	}
+	log.Info("Transferred ownership of remote claim", "remote", remote, "to", to)
+	r.record.Event(localClaim, event.Normal(reasonTransferred, fmt.Sprintf("Ownership of remote claim %s is transferred to %s", remote, to)))
+	return reconcile.Result{}, nil
+}
+
+// fail marks the local claim with the supplied sync error and counts it by
+// its reason.
+func (r *Reconciler) fail(localClaim *claim.Unstructured, err error) {
+	c := resource.AgentSyncError(err)
+	metrics.SyncErrors.WithLabelValues(string(c.Reason)).Inc()
+	r.digest.Record(localClaim.GetKind(), digest.Failed)
+	// Only the first of consecutive failures is notified about.
+	if localClaim.GetCondition(resource.TypeAgentSync).Status != corev1.ConditionFalse {
+		r.notify(localClaim, notify.Failed, err.Error())
+	}
+	localClaim.SetConditions(c)
+	r.checkSLA(localClaim)
+}
+
+// checkSLA marks the supplied local claim if it exceeded its provisioning SLA
+// and returns how long is left until it does, or zero if it won't. The
+// exceeded SLA is reported by reconcile once the mark is persisted.
+func (r *Reconciler) checkSLA(localClaim *claim.Unstructured) time.Duration {
+	_, remaining := CheckSLA(localClaim, r.sla, time.Now())
+	return remaining
+}
+
+// remember records the sync of the supplied local claim with the outcome and
+// the error in its AgentSynced condition.
+func (r *Reconciler) remember(localClaim *claim.Unstructured, id string, a history.Action, start time.Time) {
+	c := localClaim.GetCondition(resource.TypeAgentSync)
+	e := history.Entry{
+		Time:     start,
+		SyncID:   id,
+		Action:   a,
+		Outcome:  string(c.Reason),
+		Duration: time.Since(start),
+	}
+	if c.Status == corev1.ConditionFalse {
+		e.Error = c.Message
+	}
+	r.history.Record(history.Key{Kind: localClaim.GetKind(), Namespace: localClaim.GetNamespace(), Name: localClaim.GetName()}, e)
+}
+
+func (r *Reconciler) notify(localClaim *claim.Unstructured, t notify.Transition, msg string) {
+	r.notifier.Notify(notify.Notification{
+		Kind:       localClaim.GetKind(),
+		Namespace:  localClaim.GetNamespace(),
+		Name:       localClaim.GetName(),
+		Transition: t,
+		Message:    msg,
+		Time:       time.Now().UTC(),
+	})
+}
+
+// propagate runs the Propagator and marks the local claim with the supplied
+// condition if it succeeds.
+func (r *Reconciler) propagate(ctx context.Context, log logging.Logger, localClaim, remoteClaim *claim.Unstructured, c v1alpha1.Condition, requeueAfter time.Duration) (reconcile.Result, error) {
+	wasReady := isReady(localClaim)
 	if err := r.Propagate(ctx, localClaim, remoteClaim); err != nil {
+		r.backoff.Observe(err)
 		log.Debug("Cannot run propagator", "error", err, "requeue-after", time.Now().Add(shortWait))
 		r.record.Event(localClaim, event.Warning(reasonCannotPropagate, err))
-		localClaim.SetConditions(resource.AgentSyncError(errors.Wrap(err, errPull)))
-		return reconcile.Result{RequeueAfter: shortWait}, errors.Wrap(r.local.Status().Update(ctx, localClaim), errStatusUpdateClaim)
+		r.fail(localClaim, errors.Wrap(err, errPull))
+		return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(r.local.Status().Update(ctx, localClaim), errStatusUpdateClaim)
+	}
+	localClaim.SetConditions(c)
+	// The claim is synced again when its SLA runs out so that it's marked on
+	// time.
+	if remaining := r.checkSLA(localClaim); remaining > 0 {
+		requeueAfter = minDuration(requeueAfter, remaining)
+	}
+	if err := r.local.Status().Update(ctx, localClaim); err != nil {
+		return reconcile.Result{RequeueAfter: requeueAfter}, resource.LocalError(err, errStatusUpdateClaim)
+	}
+	if c.Status == corev1.ConditionTrue {
+		r.digest.Record(localClaim.GetKind(), digest.Synced)
+	}
+	for _, h := range r.postStatus {
+		if err := h.Run(ctx, localClaim, remoteClaim); err != nil {
+			log.Debug("Cannot run post-status hook", "error", err)
+			r.record.Event(localClaim, event.Warning(reasonCannotRunHook, errors.Wrap(err, errPostStatusHook)))
+		}
+	}
+
+	// The latency is observed only once the Ready condition is persisted so
+	// that it's not observed again if the update fails.
+	if !wasReady && isReady(localClaim) {
+		latency := time.Since(localClaim.GetCreationTimestamp().Time)
+		metrics.ClaimReadySeconds.WithLabelValues(localClaim.GetKind()).Observe(latency.Seconds())
+		log.Debug("Claim became ready", "kind", localClaim.GetKind(), "latency", latency.String())
+		r.notify(localClaim, notify.Ready, "")
+	}
+	return reconcile.Result{RequeueAfter: requeueAfter}, nil
+}
+
+func isReady(c *claim.Unstructured) bool {
+	return c.GetCondition(v1alpha1.TypeReady).Status == corev1.ConditionTrue
+}
+
+// removeCondition removes the condition of the supplied type from the supplied
+// claim, if it has one.
+func removeCondition(c *claim.Unstructured, ct v1alpha1.ConditionType) {
+	s := v1alpha1.ConditionedStatus{}
+	p := fieldpath.Pave(c.Object)
+	if err := p.GetValueInto("status", &s); err != nil {
+		return
+	}
+	kept := make([]v1alpha1.Condition, 0, len(s.Conditions))
+	for _, cond := range s.Conditions {
+		if cond.Type != ct {
+			kept = append(kept, cond)
+		}
+	}
+	if len(kept) == len(s.Conditions) {
+		return
+	}
+	_ = p.SetValue("status.conditions", kept)
+}
+
+// release lets the deleted local claim go and leaves its remote counterpart in
+// place to be taken over when the local claim is recreated.
+func (r *Reconciler) release(ctx context.Context, log logging.Logger, localClaim *claim.Unstructured) (reconcile.Result, error) {
+	if err := r.finalizer.RemoveFinalizer(ctx, localClaim); err != nil {
+		log.Debug("Cannot remove finalizer", "error", err, "requeue-after", time.Now().Add(shortWait))
+		r.record.Event(localClaim, event.Warning(reasonCannotRemoveFinalizer, err))
+		r.fail(localClaim, resource.LocalError(err, errRemoveFinalizer))
+		return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(r.local.Status().Update(ctx, localClaim), errStatusUpdateClaim)
+	}
+	r.record.Event(localClaim, event.Normal(reasonDeletionCancelled, "Deletion is cancelled, the remote claim is kept"))
+	return reconcile.Result{}, nil
+}
+
+// DeletionRemaining returns how long is left of the deletion grace period of
+// the supplied deleted local claim before its remote counterpart may be
+// deleted. It's zero once the grace period passes or if the claim isn't
+// deleted.
+func DeletionRemaining(local metav1.Object, grace time.Duration) time.Duration {
+	if grace <= 0 || local.GetDeletionTimestamp() == nil {
+		return 0
+	}
+	if remaining := time.Until(local.GetDeletionTimestamp().Add(grace)); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// DeletionCancelled returns whether the deletion of the remote counterpart of
+// the supplied local claim is cancelled.
+func DeletionCancelled(local metav1.Object) bool {
+	return local.GetAnnotations()[resource.AnnotationKeyCancelDeletion] == "true"
+}
+
+// SyncWait returns how long to wait before syncing a claim again whose remote
+// counterpart was synced without errors. Ready claims have nothing in
+// progress, so they're synced rarely. The ones that are being provisioned are
+// synced often right after their Ready or Synced condition changes and less
+// often the longer they take, up to longWait, so that slow provisioning
+// doesn't hammer the remote cluster. The ones that the remote cluster fails to
+// sync are synced the same way but at least every shortWait, so that a fix is
+// picked up quickly.
+func SyncWait(remote *claim.Unstructured, now time.Time) time.Duration {
+	ready := remote.GetCondition(v1alpha1.TypeReady)
+	synced := remote.GetCondition(v1alpha1.TypeSynced)
+	failing := synced.Status == corev1.ConditionFalse
+	if ready.Status == corev1.ConditionTrue && !failing {
+		return idleWait
+	}
+	max := longWait
+	if failing {
+		max = shortWait
+	}
+	changed := ready.LastTransitionTime.Time
+	if synced.LastTransitionTime.After(changed) {
+		changed = synced.LastTransitionTime.Time
+	}
+	if changed.IsZero() {
+		changed = remote.GetCreationTimestamp().Time
+	}
+	if changed.IsZero() {
+		return max
+	}
+	wait := now.Sub(changed) / 4
+	if wait < tinyWait {
+		return tinyWait
+	}
+	return minDuration(wait, max)
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
 	}
-	localClaim.SetConditions(resource.AgentSyncSuccess())
-	return reconcile.Result{RequeueAfter: longWait}, errors.Wrap(r.local.Status().Update(ctx, localClaim), localPrefix+errStatusUpdateClaim)
+	return b
 }
@@ -19,9 +19,11 @@ package claim
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -31,18 +33,29 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/event"
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
 	runtimeresource "github.com/crossplane/crossplane-runtime/pkg/resource"
 	"github.com/crossplane/crossplane-runtime/pkg/resource/fake"
 	"github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/claim"
 	"github.com/crossplane/crossplane-runtime/pkg/test"
 
+	"github.com/crossplane/agent/pkg/approval"
+	"github.com/crossplane/agent/pkg/emergency"
+	"github.com/crossplane/agent/pkg/maintenance"
+	"github.com/crossplane/agent/pkg/metrics"
+	"github.com/crossplane/agent/pkg/notify"
 	"github.com/crossplane/agent/pkg/resource"
+	"github.com/crossplane/agent/pkg/sanitize"
 )
 
 var (
 	errBoom = errors.New("boom")
 	now     = metav1.Now()
 	gvk     = schema.GroupVersionKind{}
+
+	deletionRequested = map[string]string{resource.AnnotationKeyDeletionRequested: now.UTC().Format(time.RFC3339)}
 )
 
 func TestReconcile(t *testing.T) {
@@ -69,7 +82,7 @@ func TestReconcile(t *testing.T) {
 			},
 			want: want{
 				result: reconcile.Result{RequeueAfter: shortWait},
-				err:    errors.Wrap(errBoom, localPrefix+errGetRequirement),
+				err:    resource.LocalError(errBoom, errGetRequirement),
 			},
 		},
 		"NotFound": {
@@ -80,6 +93,179 @@ func TestReconcile(t *testing.T) {
 				},
 			},
 		},
+		"RemoteClaimConflict": {
+			reason: "The claim should not be synced if the remote claim it maps to records another local claim as its owner",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							o := obj.(metav1.Object)
+							o.SetNamespace("a")
+							o.SetName("b-c")
+							return nil
+						},
+						MockStatusUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+							want := claim.New(claim.WithGroupVersionKind(gvk))
+							want.SetNamespace("a")
+							want.SetName("b-c")
+							want.SetConditions(resource.AgentSyncNotOwned(errors.Errorf(errFmtRemoteOtherClaim, "a/b-c", "a-b", "c").Error()))
+							if diff := cmp.Diff(want.GetUnstructured(), obj, test.EquateConditions()); diff != "" {
+								reason := "The claim should not be synced if the remote claim it maps to records another local claim as its owner"
+								t.Errorf("\nReason: %s\n-want, +got:\n%s", reason, diff)
+							}
+							return nil
+						},
+					},
+				},
+				remote: &test.MockClient{
+					MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+						o := obj.(metav1.Object)
+						o.SetNamespace("a")
+						o.SetName("b-c")
+						o.SetLabels(map[string]string{resource.LabelKeyOwnerNamespace: "a-b", resource.LabelKeyOwnerName: "c"})
+						return nil
+					},
+					MockPatch: func(_ context.Context, _ runtime.Object, _ client.Patch, _ ...client.PatchOption) error {
+						t.Errorf("Patch(...): the remote claim of another claim should not be written")
+						return nil
+					},
+				},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: longWait},
+			},
+		},
+		"Transferred": {
+			reason: "The claim should be replaced by the claim its ownership is transferred to once the remote claim records the new claim as its owner",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, key client.ObjectKey, obj runtime.Object) error {
+							if key.Name == "new" {
+								return kerrors.NewNotFound(schema.GroupResource{}, key.Name)
+							}
+							c := claim.New()
+							c.SetNamespace("cool")
+							c.SetName("old")
+							c.SetAnnotations(map[string]string{resource.AnnotationKeyTransferTo: "other/new"})
+							c.GetUnstructured().DeepCopyInto(obj.(*unstructured.Unstructured))
+							return nil
+						},
+						MockCreate: func(_ context.Context, obj runtime.Object, _ ...client.CreateOption) error {
+							c := &claim.Unstructured{Unstructured: *obj.(*unstructured.Unstructured)}
+							if diff := cmp.Diff("cool/old", c.GetAnnotations()[resource.AnnotationKeyRemoteClaim]); diff != "" {
+								t.Errorf("\nReason: %s\n-want, +got:\n%s", "The new claim should be synced to the remote claim of the old one", diff)
+							}
+							return nil
+						},
+						MockDelete: test.NewMockDeleteFn(nil),
+						MockStatusUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+							c := &claim.Unstructured{Unstructured: *obj.(*unstructured.Unstructured)}
+							t.Errorf("\nReason: %s\nStatus().Update(...) should not be called: %s", "The claim should be transferred", c.GetCondition(resource.TypeAgentSync).Message)
+							return nil
+						},
+					},
+				},
+				remote: &test.MockClient{
+					MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+						obj.(metav1.Object).SetLabels(map[string]string{resource.LabelKeyOwnerNamespace: "cool", resource.LabelKeyOwnerName: "old"})
+						return nil
+					},
+					MockUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+						want := map[string]string{resource.LabelKeyOwnerNamespace: "other", resource.LabelKeyOwnerName: "new"}
+						if diff := cmp.Diff(want, obj.(metav1.Object).GetLabels()); diff != "" {
+							t.Errorf("\nReason: %s\n-want, +got:\n%s", "The remote claim should record the new claim as its owner", diff)
+						}
+						return nil
+					},
+				},
+				opts: []ReconcilerOption{WithFinalizer(runtimeresource.FinalizerFns{
+					RemoveFinalizerFn: func(_ context.Context, _ runtimeresource.Object) error { return nil },
+				})},
+			},
+			want: want{
+				result: reconcile.Result{},
+			},
+		},
+		"TransferOfAnotherClaimsRemote": {
+			reason: "The ownership of a remote claim that another claim syncs should not be transferred",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							o := obj.(metav1.Object)
+							o.SetNamespace("cool")
+							o.SetName("old")
+							o.SetAnnotations(map[string]string{
+								resource.AnnotationKeyRemoteClaim: "victim/db",
+								resource.AnnotationKeyTransferTo:  "other/new",
+							})
+							return nil
+						},
+						MockCreate: func(_ context.Context, _ runtime.Object, _ ...client.CreateOption) error {
+							t.Errorf("\nReason: %s\nCreate(...) should not be called", "The claim should not be transferred")
+							return nil
+						},
+						MockStatusUpdate: test.NewMockStatusUpdateFn(nil),
+					},
+				},
+				remote: &test.MockClient{
+					MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+						o := obj.(metav1.Object)
+						o.SetNamespace("victim")
+						o.SetName("db")
+						o.SetLabels(map[string]string{resource.LabelKeyOwnerNamespace: "victim", resource.LabelKeyOwnerName: "db"})
+						return nil
+					},
+					MockUpdate: func(_ context.Context, _ runtime.Object, _ ...client.UpdateOption) error {
+						t.Errorf("\nReason: %s\nUpdate(...) should not be called", "The remote claim of another claim should not be handed over")
+						return nil
+					},
+				},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: shortWait},
+			},
+		},
+		"RemoteClaimOfAnotherClaim": {
+			reason: "A claim that points at the remote claim of another claim should not sync it",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							o := obj.(metav1.Object)
+							o.SetNamespace("cool")
+							o.SetName("db")
+							o.SetAnnotations(map[string]string{resource.AnnotationKeyRemoteClaim: "victim/db"})
+							return nil
+						},
+						MockStatusUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+							c := &claim.Unstructured{Unstructured: *obj.(*unstructured.Unstructured)}
+							if diff := cmp.Diff(resource.ReasonConflict, c.GetCondition(resource.TypeAgentSync).Reason); diff != "" {
+								t.Errorf("\nReason: %s\n-want, +got:\n%s", "The claim should be marked as not owning the remote claim", diff)
+							}
+							return nil
+						},
+					},
+				},
+				remote: &test.MockClient{
+					MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+						o := obj.(metav1.Object)
+						o.SetNamespace("victim")
+						o.SetName("db")
+						o.SetLabels(map[string]string{resource.LabelKeyOwnerNamespace: "victim", resource.LabelKeyOwnerName: "db"})
+						return nil
+					},
+					MockPatch: func(_ context.Context, _ runtime.Object, _ client.Patch, _ ...client.PatchOption) error {
+						t.Errorf("Patch(...): the remote claim of another claim should not be written")
+						return nil
+					},
+				},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: longWait},
+			},
+		},
 		"RemoteGetFailed": {
 			reason: "An error should be returned if remote claim cannot be retrieved",
 			args: args{
@@ -88,7 +274,7 @@ func TestReconcile(t *testing.T) {
 						MockGet: test.NewMockGetFn(nil),
 						MockStatusUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
 							want := claim.New(claim.WithGroupVersionKind(gvk))
-							want.SetConditions(resource.AgentSyncError(errors.Wrap(errBoom, remotePrefix+errGetRequirement)))
+							want.SetConditions(resource.AgentSyncError(resource.RemoteError(errBoom, errGetRequirement)))
 							if diff := cmp.Diff(want.GetUnstructured(), obj, test.EquateConditions()); diff != "" {
 								reason := "An error should be returned if remote claim cannot be retrieved"
 								t.Errorf("\nReason: %s\n-want, +got:\n%s", reason, diff)
@@ -138,7 +324,7 @@ func TestReconcile(t *testing.T) {
 						MockStatusUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
 							want := claim.New(claim.WithGroupVersionKind(gvk))
 							want.SetDeletionTimestamp(&now)
-							want.SetConditions(resource.AgentSyncError(errors.Wrap(errBoom, localPrefix+errRemoveFinalizer)))
+							want.SetConditions(resource.AgentSyncError(resource.LocalError(errBoom, errRemoveFinalizer)))
 							if diff := cmp.Diff(want.GetUnstructured(), obj, test.EquateConditions()); diff != "" {
 								reason := "Error during finalizer removal should be propagated"
 								t.Errorf("\nReason: %s\n-want, +got:\n%s", reason, diff)
@@ -160,6 +346,72 @@ func TestReconcile(t *testing.T) {
 				result: reconcile.Result{RequeueAfter: shortWait},
 			},
 		},
+		"RecordDeletionFailed": {
+			reason: "The error should be returned if the deletion cannot be recorded on the local instance",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							l := claim.New(claim.WithGroupVersionKind(gvk))
+							l.SetDeletionTimestamp(&now)
+							l.DeepCopyInto(obj.(*unstructured.Unstructured))
+							return nil
+						},
+						MockUpdate: test.NewMockUpdateFn(errBoom),
+						MockStatusUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+							u, _ := obj.(*unstructured.Unstructured)
+							c := claim.Unstructured{Unstructured: *u}
+							if diff := cmp.Diff(resource.AgentSyncError(resource.LocalError(errBoom, errUpdateClaim)), c.GetCondition(resource.TypeAgentSync), test.EquateConditions()); diff != "" {
+								reason := "The error should be returned if the deletion cannot be recorded on the local instance"
+								t.Errorf("\nReason: %s\n-want, +got:\n%s", reason, diff)
+							}
+							return nil
+						}},
+				},
+				remote: &test.MockClient{
+					MockGet: test.NewMockGetFn(nil),
+				},
+				opts: []ReconcilerOption{
+					WithFinalizer(runtimeresource.FinalizerFns{}),
+				},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: shortWait},
+			},
+		},
+		"DeletionRecorded": {
+			reason: "The deletion should be recorded on the local instance before the remote instance is deleted",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							l := claim.New(claim.WithGroupVersionKind(gvk))
+							l.SetDeletionTimestamp(&now)
+							l.DeepCopyInto(obj.(*unstructured.Unstructured))
+							return nil
+						},
+						MockUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+							o, _ := obj.(metav1.Object)
+							if _, ok := o.GetAnnotations()[resource.AnnotationKeyDeletionRequested]; !ok {
+								t.Errorf("\nReason: %s\nthe %s annotation is missing", "The deletion should be recorded on the local instance", resource.AnnotationKeyDeletionRequested)
+							}
+							return nil
+						},
+						MockStatusUpdate: test.NewMockStatusUpdateFn(nil),
+					},
+				},
+				remote: &test.MockClient{
+					MockGet:    test.NewMockGetFn(nil),
+					MockDelete: test.NewMockDeleteFn(nil),
+				},
+				opts: []ReconcilerOption{
+					WithFinalizer(runtimeresource.FinalizerFns{}),
+				},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: tinyWait},
+			},
+		},
 		"RemoteFoundAndDeletionFailed": {
 			reason: "The error should be returned if deletion call fails",
 			args: args{
@@ -168,13 +420,15 @@ func TestReconcile(t *testing.T) {
 						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
 							l := claim.New(claim.WithGroupVersionKind(gvk))
 							l.SetDeletionTimestamp(&now)
+							l.SetAnnotations(deletionRequested)
 							l.DeepCopyInto(obj.(*unstructured.Unstructured))
 							return nil
 						},
 						MockStatusUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
 							want := claim.New(claim.WithGroupVersionKind(gvk))
 							want.SetDeletionTimestamp(&now)
-							want.SetConditions(resource.AgentSyncError(errors.Wrap(errBoom, remotePrefix+errDeleteClaim)))
+							want.SetAnnotations(deletionRequested)
+							want.SetConditions(resource.AgentSyncError(resource.RemoteError(errBoom, errDeleteClaim)))
 							if diff := cmp.Diff(want.GetUnstructured(), obj, test.EquateConditions()); diff != "" {
 								reason := "The error should be returned if deletion call fails"
 								t.Errorf("\nReason: %s\n-want, +got:\n%s", reason, diff)
@@ -202,12 +456,14 @@ func TestReconcile(t *testing.T) {
 						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
 							l := claim.New(claim.WithGroupVersionKind(gvk))
 							l.SetDeletionTimestamp(&now)
+							l.SetAnnotations(deletionRequested)
 							l.DeepCopyInto(obj.(*unstructured.Unstructured))
 							return nil
 						},
 						MockStatusUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
 							want := claim.New(claim.WithGroupVersionKind(gvk))
 							want.SetDeletionTimestamp(&now)
+							want.SetAnnotations(deletionRequested)
 							want.SetConditions(resource.AgentSyncSuccess().WithMessage("Deletion is successfully requested"))
 							if diff := cmp.Diff(want.GetUnstructured(), obj, test.EquateConditions()); diff != "" {
 								reason := "No error should be returned when deletion is requested"
@@ -228,101 +484,949 @@ func TestReconcile(t *testing.T) {
 				result: reconcile.Result{RequeueAfter: tinyWait},
 			},
 		},
-		"AddFinalizerFailed": {
-			reason: "An error should be returned if finalizer cannot be added",
+		"EmergencyStopDeletionHalted": {
+			reason: "The remote instance should not be deleted while the emergency stop is engaged",
 			args: args{
 				m: &fake.Manager{
 					Client: &test.MockClient{
-						MockGet: test.NewMockGetFn(nil),
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							l := claim.New(claim.WithGroupVersionKind(gvk))
+							l.SetDeletionTimestamp(&now)
+							l.DeepCopyInto(obj.(*unstructured.Unstructured))
+							return nil
+						},
 						MockStatusUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
 							want := claim.New(claim.WithGroupVersionKind(gvk))
-							want.SetConditions(resource.AgentSyncError(errors.Wrap(errBoom, localPrefix+errAddFinalizer)))
+							want.SetDeletionTimestamp(&now)
+							want.SetConditions(resource.AgentSyncHalted())
 							if diff := cmp.Diff(want.GetUnstructured(), obj, test.EquateConditions()); diff != "" {
-								reason := "An error should be returned if finalizer cannot be added"
+								reason := "The remote instance should not be deleted while the emergency stop is engaged"
 								t.Errorf("\nReason: %s\n-want, +got:\n%s", reason, diff)
 							}
 							return nil
-						},
-					},
+						}},
+				},
+				remote: &test.MockClient{
+					MockGet: test.NewMockGetFn(nil),
 				},
-				remote: &test.MockClient{MockGet: test.NewMockGetFn(nil)},
 				opts: []ReconcilerOption{
-					WithFinalizer(runtimeresource.FinalizerFns{AddFinalizerFn: func(_ context.Context, _ runtimeresource.Object) error {
-						return errBoom
-					}}),
+					WithFinalizer(runtimeresource.FinalizerFns{}),
+					WithEmergencyStop(emergency.NewSwitch(emergency.WithEngaged(true))),
 				},
 			},
 			want: want{
 				result: reconcile.Result{RequeueAfter: shortWait},
 			},
 		},
-		"PropagatorFailed": {
-			reason: "An error should be returned if propagator fails",
+		"MaintenanceDeletionReleased": {
+			reason: "The local instance should be released without deleting the remote one while the local cluster is under maintenance",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							l := claim.New(claim.WithGroupVersionKind(gvk))
+							l.SetDeletionTimestamp(&now)
+							l.DeepCopyInto(obj.(*unstructured.Unstructured))
+							return nil
+						},
+					},
+				},
+				remote: &test.MockClient{
+					MockGet:    test.NewMockGetFn(nil),
+					MockDelete: test.NewMockDeleteFn(errBoom),
+				},
+				opts: []ReconcilerOption{
+					WithFinalizer(runtimeresource.FinalizerFns{RemoveFinalizerFn: func(_ context.Context, _ runtimeresource.Object) error {
+						return nil
+					}}),
+					WithMaintenance(maintenance.NewMode(maintenance.WithEnabled(true))),
+				},
+			},
+		},
+		"MaintenanceCreateSuppressed": {
+			reason: "The remote instance should not be created while the local cluster is under maintenance",
 			args: args{
 				m: &fake.Manager{
 					Client: &test.MockClient{
 						MockGet: test.NewMockGetFn(nil),
 						MockStatusUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
 							want := claim.New(claim.WithGroupVersionKind(gvk))
-							want.SetConditions(resource.AgentSyncError(errors.Wrap(errBoom, errPush)))
+							want.SetConditions(resource.AgentSyncFrozen())
 							if diff := cmp.Diff(want.GetUnstructured(), obj, test.EquateConditions()); diff != "" {
-								reason := "An error should be returned if propagator fails"
+								reason := "The remote instance should not be created while the local cluster is under maintenance"
 								t.Errorf("\nReason: %s\n-want, +got:\n%s", reason, diff)
 							}
 							return nil
-						},
-					},
+						}},
+				},
+				remote: &test.MockClient{
+					MockGet:    test.NewMockGetFn(kerrors.NewNotFound(schema.GroupResource{}, "")),
+					MockCreate: test.NewMockCreateFn(errBoom),
+					MockPatch:  test.NewMockPatchFn(errBoom),
 				},
-				remote: &test.MockClient{MockGet: test.NewMockGetFn(nil)},
 				opts: []ReconcilerOption{
 					WithFinalizer(runtimeresource.FinalizerFns{AddFinalizerFn: func(_ context.Context, _ runtimeresource.Object) error {
 						return nil
 					}}),
-					WithPropagator(PropagateFn(func(_ context.Context, _, _ *claim.Unstructured) error {
-						return errBoom
-					})),
+					WithMaintenance(maintenance.NewMode(maintenance.WithEnabled(true))),
 				},
 			},
 			want: want{
 				result: reconcile.Result{RequeueAfter: shortWait},
 			},
 		},
-		"Successful": {
-			reason: "No error should be returned if everything goes well.",
+		"MaintenanceDeletionCancelled": {
+			reason: "The local instance should be released without deleting the remote one if the deletion is cancelled during maintenance",
 			args: args{
 				m: &fake.Manager{
 					Client: &test.MockClient{
-						MockGet: test.NewMockGetFn(nil),
-						MockStatusUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
-							want := claim.New(claim.WithGroupVersionKind(gvk))
-							want.SetConditions(resource.AgentSyncSuccess())
-							if diff := cmp.Diff(want.GetUnstructured(), obj, test.EquateConditions()); diff != "" {
-								reason := "No error should be returned if everything goes well."
-								t.Errorf("\nReason: %s\n-want, +got:\n%s", reason, diff)
-							}
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							l := claim.New(claim.WithGroupVersionKind(gvk))
+							l.SetDeletionTimestamp(&now)
+							l.SetAnnotations(map[string]string{resource.AnnotationKeyCancelDeletion: "true"})
+							l.DeepCopyInto(obj.(*unstructured.Unstructured))
 							return nil
 						},
 					},
 				},
-				remote: &test.MockClient{MockGet: test.NewMockGetFn(nil)},
+				remote: &test.MockClient{
+					MockGet:    test.NewMockGetFn(nil),
+					MockDelete: test.NewMockDeleteFn(errBoom),
+				},
 				opts: []ReconcilerOption{
-					WithFinalizer(runtimeresource.FinalizerFns{AddFinalizerFn: func(_ context.Context, _ runtimeresource.Object) error {
+					WithFinalizer(runtimeresource.FinalizerFns{RemoveFinalizerFn: func(_ context.Context, _ runtimeresource.Object) error {
 						return nil
 					}}),
-					WithPropagator(PropagateFn(func(_ context.Context, _, _ *claim.Unstructured) error {
-						return nil
-					})),
+					WithMaintenance(maintenance.NewMode(maintenance.WithEnabled(true))),
+				},
+			},
+		},
+		"DeletionGracePeriodRunning": {
+			reason: "The remote instance should not be deleted while the deletion grace period is running",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							l := claim.New(claim.WithGroupVersionKind(gvk))
+							l.SetDeletionTimestamp(&now)
+							l.DeepCopyInto(obj.(*unstructured.Unstructured))
+							return nil
+						},
+						MockStatusUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+							got := &claim.Unstructured{Unstructured: *obj.(*unstructured.Unstructured)}
+							if diff := cmp.Diff(resource.ReasonDeletionPending, got.GetCondition(resource.TypeAgentSync).Reason); diff != "" {
+								reason := "The remote instance should not be deleted while the deletion grace period is running"
+								t.Errorf("\nReason: %s\n-want, +got:\n%s", reason, diff)
+							}
+							return nil
+						}},
+				},
+				remote: &test.MockClient{
+					MockGet:    test.NewMockGetFn(nil),
+					MockDelete: test.NewMockDeleteFn(errBoom),
+				},
+				opts: []ReconcilerOption{
+					WithFinalizer(runtimeresource.FinalizerFns{}),
+					WithDeletionGracePeriod(time.Hour),
 				},
 			},
 			want: want{
-				result: reconcile.Result{RequeueAfter: longWait},
+				result: reconcile.Result{RequeueAfter: shortWait},
 			},
 		},
-	}
-	for name, tc := range cases {
-		t.Run(name, func(t *testing.T) {
-			r := NewReconciler(tc.args.m, tc.args.remote, gvk, tc.args.opts...)
-			got, err := r.Reconcile(reconcile.Request{})
+		"DeletionCancelled": {
+			reason: "The local instance should be released without deleting the remote one if the deletion is cancelled",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							l := claim.New(claim.WithGroupVersionKind(gvk))
+							l.SetDeletionTimestamp(&now)
+							l.SetAnnotations(map[string]string{resource.AnnotationKeyCancelDeletion: "true"})
+							l.DeepCopyInto(obj.(*unstructured.Unstructured))
+							return nil
+						},
+					},
+				},
+				remote: &test.MockClient{
+					MockGet:    test.NewMockGetFn(nil),
+					MockDelete: test.NewMockDeleteFn(errBoom),
+				},
+				opts: []ReconcilerOption{
+					WithFinalizer(runtimeresource.FinalizerFns{RemoveFinalizerFn: func(_ context.Context, _ runtimeresource.Object) error {
+						return nil
+					}}),
+					WithDeletionGracePeriod(time.Hour),
+				},
+			},
+		},
+		"DeletionGracePeriodPassed": {
+			reason: "The remote instance should be deleted once the deletion grace period passes",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							l := claim.New(claim.WithGroupVersionKind(gvk))
+							past := metav1.NewTime(now.Add(-2 * time.Hour))
+							l.SetDeletionTimestamp(&past)
+							l.SetAnnotations(deletionRequested)
+							l.DeepCopyInto(obj.(*unstructured.Unstructured))
+							return nil
+						},
+						MockStatusUpdate: test.NewMockStatusUpdateFn(nil),
+					},
+				},
+				remote: &test.MockClient{
+					MockGet:    test.NewMockGetFn(nil),
+					MockDelete: test.NewMockDeleteFn(nil),
+				},
+				opts: []ReconcilerOption{
+					WithFinalizer(runtimeresource.FinalizerFns{}),
+					WithDeletionGracePeriod(time.Hour),
+				},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: tinyWait},
+			},
+		},
+		"RemoteDeleting": {
+			reason: "The progress of the deletion of the remote instance should be reported in the Ready condition of the local instance",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							l := claim.New(claim.WithGroupVersionKind(gvk))
+							l.SetDeletionTimestamp(&now)
+							l.SetAnnotations(deletionRequested)
+							l.DeepCopyInto(obj.(*unstructured.Unstructured))
+							return nil
+						},
+						MockStatusUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+							want := claim.New(claim.WithGroupVersionKind(gvk))
+							want.SetDeletionTimestamp(&now)
+							want.SetAnnotations(deletionRequested)
+							want.SetConditions(
+								resource.AgentSyncSuccess().WithMessage("Deletion is successfully requested"),
+								resource.RemoteDeleting(now.Add(-time.Minute), 3, 1),
+							)
+							if diff := cmp.Diff(want.GetUnstructured(), obj, test.EquateConditions()); diff != "" {
+								reason := "The progress of the deletion of the remote instance should be reported"
+								t.Errorf("\nReason: %s\n-want, +got:\n%s", reason, diff)
+							}
+							return nil
+						},
+					},
+				},
+				remote: &test.MockClient{
+					MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+						r := claim.New(claim.WithGroupVersionKind(gvk))
+						r.SetDeletionTimestamp(&metav1.Time{Time: now.Add(-time.Minute)})
+						r.DeepCopyInto(obj.(*unstructured.Unstructured))
+						return nil
+					},
+					MockDelete: test.NewMockDeleteFn(nil),
+				},
+				opts: []ReconcilerOption{
+					WithFinalizer(runtimeresource.FinalizerFns{}),
+					WithTeardownObserver(TeardownObserverFn(func(_ context.Context, _ *claim.Unstructured) (Teardown, error) {
+						return Teardown{Total: 3, Remaining: 1}, nil
+					})),
+				},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: tinyWait},
+			},
+		},
+		"AddFinalizerFailed": {
+			reason: "An error should be returned if finalizer cannot be added",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: test.NewMockGetFn(nil),
+						MockStatusUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+							want := claim.New(claim.WithGroupVersionKind(gvk))
+							want.SetConditions(resource.AgentSyncError(resource.LocalError(errBoom, errAddFinalizer)))
+							if diff := cmp.Diff(want.GetUnstructured(), obj, test.EquateConditions()); diff != "" {
+								reason := "An error should be returned if finalizer cannot be added"
+								t.Errorf("\nReason: %s\n-want, +got:\n%s", reason, diff)
+							}
+							return nil
+						},
+					},
+				},
+				remote: &test.MockClient{MockGet: test.NewMockGetFn(nil)},
+				opts: []ReconcilerOption{
+					WithFinalizer(runtimeresource.FinalizerFns{AddFinalizerFn: func(_ context.Context, _ runtimeresource.Object) error {
+						return errBoom
+					}}),
+				},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: shortWait},
+			},
+		},
+		"ResyncRequired": {
+			reason: "Neither claim should be written if the remote claim is older than the one the local claim was last synced to",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							obj.(metav1.Object).SetAnnotations(map[string]string{
+								resource.AnnotationKeySyncedGeneration: "3",
+								resource.AnnotationKeyLastSyncedTime:   "2020-09-01T12:00:00Z",
+							})
+							return nil
+						},
+						MockStatusUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+							want := claim.New(claim.WithGroupVersionKind(gvk))
+							want.SetAnnotations(map[string]string{
+								resource.AnnotationKeySyncedGeneration: "3",
+								resource.AnnotationKeyLastSyncedTime:   "2020-09-01T12:00:00Z",
+							})
+							want.SetConditions(resource.AgentSyncResyncRequired("The remote claim has no record of the sync at 2020-09-01T12:00:00Z"))
+							if diff := cmp.Diff(want.GetUnstructured(), obj, test.EquateConditions()); diff != "" {
+								reason := "Neither claim should be written if the remote claim is older than the one the local claim was last synced to"
+								t.Errorf("\nReason: %s\n-want, +got:\n%s", reason, diff)
+							}
+							return nil
+						},
+					},
+				},
+				remote: &test.MockClient{MockGet: test.NewMockGetFn(nil)},
+				opts:   []ReconcilerOption{WithStaleRemoteDetection()},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: longWait},
+			},
+		},
+		"RemoteLost": {
+			reason: "The remote claim should not be recreated if the local claim was synced to one before",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							obj.(metav1.Object).SetAnnotations(map[string]string{
+								resource.AnnotationKeySyncedGeneration: "3",
+								resource.AnnotationKeyLastSyncedTime:   "2020-09-01T12:00:00Z",
+							})
+							return nil
+						},
+						MockStatusUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+							u, _ := obj.(*unstructured.Unstructured)
+							c := claim.Unstructured{Unstructured: *u}
+							want := resource.AgentSyncResyncRequired("The remote claim that was last synced at 2020-09-01T12:00:00Z doesn't exist")
+							if diff := cmp.Diff(want, c.GetCondition(want.Type), test.EquateConditions()); diff != "" {
+								t.Errorf("\nReason: %s\n-want, +got:\n%s", "The missing remote claim should be reported", diff)
+							}
+							return nil
+						},
+					},
+				},
+				remote: &test.MockClient{
+					MockGet: test.NewMockGetFn(kerrors.NewNotFound(schema.GroupResource{}, "")),
+					MockCreate: func(_ context.Context, _ runtime.Object, _ ...client.CreateOption) error {
+						t.Errorf("Create(...): the remote claim should not be recreated")
+						return nil
+					},
+				},
+				opts: []ReconcilerOption{WithStaleRemoteDetection()},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: longWait},
+			},
+		},
+		"PropagatorFailed": {
+			reason: "An error should be returned if propagator fails",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: test.NewMockGetFn(nil),
+						MockStatusUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+							want := claim.New(claim.WithGroupVersionKind(gvk))
+							want.SetConditions(resource.AgentSyncError(errors.Wrap(errBoom, errPull)))
+							if diff := cmp.Diff(want.GetUnstructured(), obj, test.EquateConditions()); diff != "" {
+								reason := "An error should be returned if propagator fails"
+								t.Errorf("\nReason: %s\n-want, +got:\n%s", reason, diff)
+							}
+							return nil
+						},
+					},
+				},
+				remote: &test.MockClient{
+					MockGet:   test.NewMockGetFn(nil),
+					MockPatch: test.NewMockPatchFn(nil),
+				},
+				opts: []ReconcilerOption{
+					WithFinalizer(runtimeresource.FinalizerFns{AddFinalizerFn: func(_ context.Context, _ runtimeresource.Object) error {
+						return nil
+					}}),
+					WithPropagator(PropagateFn(func(_ context.Context, _, _ *claim.Unstructured) error {
+						return errBoom
+					})),
+				},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: shortWait},
+			},
+		},
+		"EmergencyStopPropagated": {
+			reason: "The remote instance should not be applied but still be propagated while the emergency stop is engaged",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: test.NewMockGetFn(nil),
+						MockStatusUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+							want := claim.New(claim.WithGroupVersionKind(gvk))
+							want.SetConditions(resource.AgentSyncHalted())
+							if diff := cmp.Diff(want.GetUnstructured(), obj, test.EquateConditions()); diff != "" {
+								reason := "The remote instance should not be applied but still be propagated while the emergency stop is engaged"
+								t.Errorf("\nReason: %s\n-want, +got:\n%s", reason, diff)
+							}
+							return nil
+						},
+					},
+				},
+				remote: &test.MockClient{
+					MockGet: test.NewMockGetFn(nil),
+				},
+				opts: []ReconcilerOption{
+					WithFinalizer(runtimeresource.FinalizerFns{AddFinalizerFn: func(_ context.Context, _ runtimeresource.Object) error {
+						return nil
+					}}),
+					WithPropagator(PropagateFn(func(_ context.Context, _, _ *claim.Unstructured) error {
+						return nil
+					})),
+					WithEmergencyStop(emergency.NewSwitch(emergency.WithEngaged(true))),
+				},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: shortWait},
+			},
+		},
+		"RemoteUnchanged": {
+			reason: "The remote instance should not be written if it wouldn't change",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet:          test.NewMockGetFn(nil),
+						MockStatusUpdate: test.NewMockStatusUpdateFn(nil),
+					},
+				},
+				remote: &test.MockClient{
+					MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+						r := claim.New(claim.WithGroupVersionKind(gvk))
+						r.SetResourceVersion("1")
+						r.SetAnnotations(map[string]string{resource.AnnotationKeySyncID: "previous-sync"})
+						r.DeepCopyInto(obj.(*unstructured.Unstructured))
+						return nil
+					},
+					MockPatch: test.NewMockPatchFn(errBoom),
+				},
+				opts: []ReconcilerOption{
+					WithFinalizer(runtimeresource.FinalizerFns{AddFinalizerFn: func(_ context.Context, _ runtimeresource.Object) error {
+						return nil
+					}}),
+					WithConfigurator(ConfigureFn(func(_ context.Context, _, _ *claim.Unstructured) error {
+						return nil
+					})),
+					WithPropagator(PropagateFn(func(_ context.Context, _, _ *claim.Unstructured) error {
+						return nil
+					})),
+				},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: longWait},
+			},
+		},
+		"IgnoredFieldsPreserved": {
+			reason: "The ignored fields of the remote instance should not be overridden by the local instance.",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							l := claim.New(claim.WithGroupVersionKind(gvk))
+							_ = fieldpath.Pave(l.Object).SetValue("spec.size", "small")
+							_ = fieldpath.Pave(l.Object).SetValue("spec.region", "eu")
+							l.DeepCopyInto(obj.(*unstructured.Unstructured))
+							return nil
+						},
+						MockStatusUpdate: test.NewMockStatusUpdateFn(nil),
+					},
+				},
+				remote: &test.MockClient{
+					MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+						r := claim.New(claim.WithGroupVersionKind(gvk))
+						_ = fieldpath.Pave(r.Object).SetValue("spec.size", "large")
+						r.DeepCopyInto(obj.(*unstructured.Unstructured))
+						return nil
+					},
+					MockPatch: func(_ context.Context, obj runtime.Object, p client.Patch, _ ...client.PatchOption) error {
+						b, _ := p.Data(obj)
+						got := &unstructured.Unstructured{}
+						_ = got.UnmarshalJSON(b)
+						want := map[string]interface{}{"size": "large"}
+						if diff := cmp.Diff(want, got.Object["spec"]); diff != "" {
+							reason := "The ignored fields of the remote instance should not be overridden by the local instance."
+							t.Errorf("\nReason: %s\n-want, +got:\n%s", reason, diff)
+						}
+						return nil
+					},
+				},
+				opts: []ReconcilerOption{
+					WithFinalizer(runtimeresource.FinalizerFns{AddFinalizerFn: func(_ context.Context, _ runtimeresource.Object) error {
+						return nil
+					}}),
+					WithPropagator(PropagateFn(func(_ context.Context, _, _ *claim.Unstructured) error {
+						return nil
+					})),
+					WithIgnoredFields("spec.size", "spec.region"),
+				},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: longWait},
+			},
+		},
+		"FieldConflict": {
+			reason: "The fields that other managers own in the remote cluster should be reported",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: test.NewMockGetFn(nil),
+						MockStatusUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+							u, _ := obj.(*unstructured.Unstructured)
+							c := claim.Unstructured{Unstructured: *u}
+							want := resource.ConflictingFields([]resource.FieldConflict{{Manager: "policy-controller", Field: ".spec.size"}})
+							if diff := cmp.Diff(want, c.GetCondition(resource.TypeFieldConflict), test.EquateConditions()); diff != "" {
+								reason := "The fields that other managers own in the remote cluster should be reported"
+								t.Errorf("\nReason: %s\n-want, +got:\n%s", reason, diff)
+							}
+							return nil
+						},
+					},
+				},
+				remote: &test.MockClient{
+					MockGet: test.NewMockGetFn(nil),
+					MockPatch: func(_ context.Context, _ runtime.Object, p client.Patch, _ ...client.PatchOption) error {
+						if p != client.Apply {
+							return errBoom
+						}
+						return kerrors.NewApplyConflict([]metav1.StatusCause{{
+							Type:    metav1.CauseTypeFieldManagerConflict,
+							Message: `conflict with "policy-controller" using example.org/v1alpha1`,
+							Field:   ".spec.size",
+						}}, `Apply failed with 1 conflict: conflict with "policy-controller" using example.org/v1alpha1: .spec.size`)
+					},
+				},
+				opts: []ReconcilerOption{
+					WithFinalizer(runtimeresource.FinalizerFns{AddFinalizerFn: func(_ context.Context, _ runtimeresource.Object) error {
+						return nil
+					}}),
+					WithServerSideApply("crossplane-agent"),
+				},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: shortWait},
+			},
+		},
+		"RemoteAdmissionDenied": {
+			reason: "The denials of the admission webhooks of the remote cluster should be reported verbatim",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: test.NewMockGetFn(nil),
+						MockStatusUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+							u, _ := obj.(*unstructured.Unstructured)
+							c := claim.Unstructured{Unstructured: *u}
+							want := resource.RemoteAdmissionDenied(resource.AdmissionDenial{Webhook: "validate.example.org", Message: "size must be small"})
+							if diff := cmp.Diff(want, c.GetCondition(resource.TypeRemoteAdmissionDenied), test.EquateConditions()); diff != "" {
+								reason := "The denials of the admission webhooks of the remote cluster should be reported verbatim"
+								t.Errorf("\nReason: %s\n-want, +got:\n%s", reason, diff)
+							}
+							if diff := cmp.Diff(resource.ReasonAdmissionDenied+"Remote", c.GetCondition(resource.TypeAgentSync).Reason); diff != "" {
+								reason := "The sync error should be classified as an admission denial"
+								t.Errorf("\nReason: %s\n-want, +got:\n%s", reason, diff)
+							}
+							return nil
+						},
+					},
+				},
+				remote: &test.MockClient{
+					MockGet: test.NewMockGetFn(nil),
+					MockPatch: test.NewMockPatchFn(&kerrors.StatusError{ErrStatus: metav1.Status{
+						Code:    403,
+						Reason:  metav1.StatusReasonForbidden,
+						Message: `admission webhook "validate.example.org" denied the request: size must be small`,
+					}}),
+				},
+				opts: []ReconcilerOption{
+					WithFinalizer(runtimeresource.FinalizerFns{AddFinalizerFn: func(_ context.Context, _ runtimeresource.Object) error {
+						return nil
+					}}),
+				},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: shortWait},
+			},
+		},
+		"DryRunAccepted": {
+			reason: "A dry-run claim should only be validated by the remote cluster with a dry-run patch",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							obj.(metav1.Object).SetAnnotations(map[string]string{resource.AnnotationKeyDryRun: "true"})
+							return nil
+						},
+						MockStatusUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+							u, _ := obj.(*unstructured.Unstructured)
+							c := claim.Unstructured{Unstructured: *u}
+							if diff := cmp.Diff(resource.DryRunAccepted(), c.GetCondition(resource.TypeDryRun), test.EquateConditions()); diff != "" {
+								t.Errorf("\nReason: %s\n-want, +got:\n%s", "The result of the dry-run should be reported", diff)
+							}
+							return nil
+						},
+					},
+				},
+				remote: &test.MockClient{
+					MockGet: test.NewMockGetFn(nil),
+					MockPatch: func(_ context.Context, _ runtime.Object, _ client.Patch, opts ...client.PatchOption) error {
+						po := &client.PatchOptions{}
+						po.ApplyOptions(opts)
+						if diff := cmp.Diff([]string{metav1.DryRunAll}, po.DryRun); diff != "" {
+							t.Errorf("\nReason: %s\n-want, +got:\n%s", "The remote claim should only be patched with a dry-run", diff)
+						}
+						return nil
+					},
+				},
+				opts: []ReconcilerOption{
+					WithFinalizer(runtimeresource.FinalizerFns{AddFinalizerFn: func(_ context.Context, _ runtimeresource.Object) error {
+						return nil
+					}}),
+				},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: longWait},
+			},
+		},
+		"DryRunRejected": {
+			reason: "A dry-run claim whose dry-run patch the remote cluster rejects should be reported with the rejection",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							obj.(metav1.Object).SetAnnotations(map[string]string{resource.AnnotationKeyDryRun: "true"})
+							return nil
+						},
+						MockStatusUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+							u, _ := obj.(*unstructured.Unstructured)
+							c := claim.Unstructured{Unstructured: *u}
+							if diff := cmp.Diff(resource.DryRunRejected(errors.Wrap(errBoom, "cannot patch object").Error()), c.GetCondition(resource.TypeDryRun), test.EquateConditions()); diff != "" {
+								t.Errorf("\nReason: %s\n-want, +got:\n%s", "The result of the dry-run should be reported", diff)
+							}
+							return nil
+						},
+					},
+				},
+				remote: &test.MockClient{
+					MockGet: test.NewMockGetFn(nil),
+					MockPatch: func(_ context.Context, _ runtime.Object, _ client.Patch, opts ...client.PatchOption) error {
+						po := &client.PatchOptions{}
+						po.ApplyOptions(opts)
+						if diff := cmp.Diff([]string{metav1.DryRunAll}, po.DryRun); diff != "" {
+							t.Errorf("\nReason: %s\n-want, +got:\n%s", "The remote claim should only be patched with a dry-run", diff)
+						}
+						return errBoom
+					},
+				},
+				opts: []ReconcilerOption{
+					WithFinalizer(runtimeresource.FinalizerFns{AddFinalizerFn: func(_ context.Context, _ runtimeresource.Object) error {
+						return nil
+					}}),
+				},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: shortWait},
+			},
+		},
+		"PendingApproval": {
+			reason: "A claim of a kind that needs approval should not be forwarded until it's approved",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, key client.ObjectKey, obj runtime.Object) error {
+							if obj.GetObjectKind().GroupVersionKind() == approval.GroupVersionKind {
+								return kerrors.NewNotFound(schema.GroupResource{Group: approval.GroupVersionKind.Group, Resource: approval.Resource}, key.Name)
+							}
+							return nil
+						},
+						MockStatusUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+							u, _ := obj.(*unstructured.Unstructured)
+							c := claim.Unstructured{Unstructured: *u}
+							if diff := cmp.Diff(resource.PendingApproval(), c.GetCondition(resource.TypeAgentSync), test.EquateConditions()); diff != "" {
+								t.Errorf("\nReason: %s\n-want, +got:\n%s", "The claim should be marked as pending approval", diff)
+							}
+							return nil
+						},
+					},
+				},
+				remote: &test.MockClient{
+					MockGet: test.NewMockGetFn(nil),
+					MockPatch: func(_ context.Context, _ runtime.Object, _ client.Patch, _ ...client.PatchOption) error {
+						t.Errorf("Patch(...): the remote claim should not be written")
+						return nil
+					},
+				},
+				opts: []ReconcilerOption{
+					WithApprovalKinds(gvk.Kind),
+					WithFinalizer(runtimeresource.FinalizerFns{AddFinalizerFn: func(_ context.Context, _ runtimeresource.Object) error {
+						return nil
+					}}),
+				},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: longWait},
+			},
+		},
+		"ApprovalOutdated": {
+			reason: "A claim that changed after it was approved should not be forwarded until it's approved again",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							u := obj.(*unstructured.Unstructured)
+							if u.GroupVersionKind() == approval.GroupVersionKind {
+								u.Object["spec"] = map[string]interface{}{
+									"claim": map[string]interface{}{
+										"apiVersion": gvk.GroupVersion().String(),
+										"kind":       gvk.Kind,
+										"namespace":  "",
+										"name":       "",
+										"uid":        "cool-uid",
+									},
+									"generation": int64(2),
+									"approver":   "cool-approver",
+								}
+								return nil
+							}
+							u.SetGeneration(3)
+							u.SetUID("cool-uid")
+							return nil
+						},
+						MockStatusUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+							u, _ := obj.(*unstructured.Unstructured)
+							c := claim.Unstructured{Unstructured: *u}
+							if diff := cmp.Diff(resource.PendingApproval(), c.GetCondition(resource.TypeAgentSync), test.EquateConditions()); diff != "" {
+								t.Errorf("\nReason: %s\n-want, +got:\n%s", "The claim should be marked as pending approval", diff)
+							}
+							return nil
+						},
+					},
+				},
+				remote: &test.MockClient{
+					MockGet: test.NewMockGetFn(nil),
+					MockPatch: func(_ context.Context, _ runtime.Object, _ client.Patch, _ ...client.PatchOption) error {
+						t.Errorf("Patch(...): the remote claim should not be written")
+						return nil
+					},
+				},
+				opts: []ReconcilerOption{
+					WithApprovalKinds(gvk.Kind),
+					WithFinalizer(runtimeresource.FinalizerFns{AddFinalizerFn: func(_ context.Context, _ runtimeresource.Object) error {
+						return nil
+					}}),
+				},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: longWait},
+			},
+		},
+		"PreRemoteCreateHookFailed": {
+			reason: "The remote instance should not be created if a pre-create hook fails",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: test.NewMockGetFn(nil),
+						MockStatusUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+							want := claim.New(claim.WithGroupVersionKind(gvk))
+							want.SetConditions(resource.AgentSyncError(errors.Wrap(errBoom, errPreCreateHook)))
+							if diff := cmp.Diff(want.GetUnstructured(), obj, test.EquateConditions()); diff != "" {
+								reason := "The remote instance should not be created if a pre-create hook fails"
+								t.Errorf("\nReason: %s\n-want, +got:\n%s", reason, diff)
+							}
+							return nil
+						},
+					},
+				},
+				remote: &test.MockClient{
+					MockGet: test.NewMockGetFn(kerrors.NewNotFound(schema.GroupResource{}, "")),
+				},
+				opts: []ReconcilerOption{
+					WithFinalizer(runtimeresource.FinalizerFns{AddFinalizerFn: func(_ context.Context, _ runtimeresource.Object) error {
+						return nil
+					}}),
+					WithPreRemoteCreateHooks(HookFn(func(_ context.Context, _, _ *claim.Unstructured) error {
+						return errBoom
+					})),
+				},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: shortWait},
+			},
+		},
+		"SanitizeFailed": {
+			reason: "The remote instance should not be applied if a sanitizer fails",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: test.NewMockGetFn(nil),
+						MockStatusUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+							want := claim.New(claim.WithGroupVersionKind(gvk))
+							want.SetConditions(resource.AgentSyncError(errors.Wrap(errors.Wrapf(errBoom, "sanitizer %d of %s failed", 0, gvk.String()), errSanitize)))
+							if diff := cmp.Diff(want.GetUnstructured(), obj, test.EquateConditions()); diff != "" {
+								reason := "The remote instance should not be applied if a sanitizer fails"
+								t.Errorf("\nReason: %s\n-want, +got:\n%s", reason, diff)
+							}
+							return nil
+						},
+					},
+				},
+				remote: &test.MockClient{
+					MockGet: test.NewMockGetFn(kerrors.NewNotFound(schema.GroupResource{}, "")),
+				},
+				opts: []ReconcilerOption{
+					WithFinalizer(runtimeresource.FinalizerFns{AddFinalizerFn: func(_ context.Context, _ runtimeresource.Object) error {
+						return nil
+					}}),
+					WithSanitizers(func() *sanitize.Registry {
+						r := sanitize.NewRegistry()
+						r.Register(gvk, sanitize.SanitizerFn(func(_ context.Context, _ *unstructured.Unstructured) error {
+							return errBoom
+						}))
+						return r
+					}()),
+				},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: shortWait},
+			},
+		},
+		"PostStatusPropagationHookFailed": {
+			reason: "Failing post-status hooks should not fail the sync",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: test.NewMockGetFn(nil),
+						MockStatusUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+							want := claim.New(claim.WithGroupVersionKind(gvk))
+							want.SetConditions(resource.AgentSyncSuccess())
+							if diff := cmp.Diff(want.GetUnstructured(), obj, test.EquateConditions()); diff != "" {
+								reason := "The sync should succeed even though a post-status hook fails"
+								t.Errorf("\nReason: %s\n-want, +got:\n%s", reason, diff)
+							}
+							obj.(metav1.Object).SetResourceVersion("2")
+							return nil
+						},
+					},
+				},
+				remote: &test.MockClient{
+					MockGet:   test.NewMockGetFn(nil),
+					MockPatch: test.NewMockPatchFn(nil),
+				},
+				opts: []ReconcilerOption{
+					WithFinalizer(runtimeresource.FinalizerFns{AddFinalizerFn: func(_ context.Context, _ runtimeresource.Object) error {
+						return nil
+					}}),
+					WithPropagator(PropagateFn(func(_ context.Context, _, _ *claim.Unstructured) error {
+						return nil
+					})),
+					WithPostStatusPropagationHooks(HookFn(func(_ context.Context, local, _ *claim.Unstructured) error {
+						if diff := cmp.Diff("2", local.GetResourceVersion()); diff != "" {
+							t.Errorf("\nReason: %s\n-want, +got:\n%s", "Post-status hooks should run once the status is persisted", diff)
+						}
+						return errBoom
+					})),
+					WithRecorder(recorderFn(func(_ runtime.Object, e event.Event) {
+						want := event.Warning(reasonCannotRunHook, errors.Wrap(errBoom, errPostStatusHook))
+						if diff := cmp.Diff(want, e); diff != "" {
+							t.Errorf("\nReason: %s\n-want, +got:\n%s", "The failure of a post-status hook should be recorded as an event", diff)
+						}
+					})),
+				},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: longWait},
+			},
+		},
+		"NotifiedAboutCreation": {
+			reason: "The Notifier should be notified once the claim is created in the remote cluster",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet:          test.NewMockGetFn(nil),
+						MockStatusUpdate: test.NewMockStatusUpdateFn(nil),
+					},
+				},
+				remote: &test.MockClient{
+					MockGet:   test.NewMockGetFn(nil),
+					MockPatch: test.NewMockPatchFn(nil),
+				},
+				opts: []ReconcilerOption{
+					WithFinalizer(runtimeresource.FinalizerFns{AddFinalizerFn: func(_ context.Context, _ runtimeresource.Object) error {
+						return nil
+					}}),
+					WithPropagator(PropagateFn(func(_ context.Context, _, _ *claim.Unstructured) error {
+						return nil
+					})),
+					WithNotifier(notify.NotifierFn(func(n notify.Notification) {
+						if diff := cmp.Diff(notify.Created, n.Transition); diff != "" {
+							t.Errorf("\nReason: %s\nNotify(...): -want, +got:\n%s", "Only the creation should be notified about", diff)
+						}
+					})),
+				},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: longWait},
+			},
+		},
+		"Successful": {
+			reason: "No error should be returned if everything goes well.",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: test.NewMockGetFn(nil),
+						MockStatusUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+							want := claim.New(claim.WithGroupVersionKind(gvk))
+							want.SetConditions(resource.AgentSyncSuccess())
+							if diff := cmp.Diff(want.GetUnstructured(), obj, test.EquateConditions()); diff != "" {
+								reason := "No error should be returned if everything goes well."
+								t.Errorf("\nReason: %s\n-want, +got:\n%s", reason, diff)
+							}
+							return nil
+						},
+					},
+				},
+				remote: &test.MockClient{
+					MockGet:   test.NewMockGetFn(nil),
+					MockPatch: test.NewMockPatchFn(nil),
+				},
+				opts: []ReconcilerOption{
+					WithFinalizer(runtimeresource.FinalizerFns{AddFinalizerFn: func(_ context.Context, _ runtimeresource.Object) error {
+						return nil
+					}}),
+					WithPropagator(PropagateFn(func(_ context.Context, _, _ *claim.Unstructured) error {
+						return nil
+					})),
+				},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: longWait},
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			r := NewReconciler(tc.args.m, tc.args.remote, gvk, tc.args.opts...)
+			got, err := r.Reconcile(reconcile.Request{})
 
 			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
 				t.Errorf("\nReason: %s\nr.Reconcile(...): -want error, +got error:\n%s", tc.reason, diff)
@@ -334,3 +1438,276 @@ func TestReconcile(t *testing.T) {
 		})
 	}
 }
+
+func TestReconcileReadySeconds(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(metrics.ClaimReadySeconds)
+
+	cases := map[string]struct {
+		reason string
+		ready  bool
+		update error
+		want   uint64
+	}{
+		"BecameReady": {
+			reason: "The latency of a claim should be observed once it becomes ready.",
+			want:   1,
+		},
+		"StatusUpdateFailed": {
+			reason: "The latency should not be observed if the Ready condition cannot be persisted.",
+			update: errBoom,
+		},
+		"AlreadyReady": {
+			reason: "The latency of a claim that was already ready should not be observed again.",
+			ready:  true,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			metrics.ClaimReadySeconds.Reset()
+			m := &fake.Manager{
+				Client: &test.MockClient{
+					MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+						c := claim.New(claim.WithGroupVersionKind(gvk))
+						c.SetCreationTimestamp(metav1.NewTime(time.Now().Add(-45 * time.Second)))
+						if tc.ready {
+							c.SetConditions(xpv1.Available())
+						}
+						c.GetUnstructured().DeepCopyInto(obj.(*unstructured.Unstructured))
+						return nil
+					},
+					MockStatusUpdate: test.NewMockStatusUpdateFn(tc.update),
+				},
+			}
+			remote := &test.MockClient{
+				MockGet:   test.NewMockGetFn(nil),
+				MockPatch: test.NewMockPatchFn(nil),
+			}
+			r := NewReconciler(m, remote, gvk,
+				WithFinalizer(runtimeresource.FinalizerFns{AddFinalizerFn: func(_ context.Context, _ runtimeresource.Object) error {
+					return nil
+				}}),
+				WithPropagator(PropagateFn(func(_ context.Context, local, _ *claim.Unstructured) error {
+					local.SetConditions(xpv1.Available())
+					return nil
+				})))
+			if _, err := r.Reconcile(reconcile.Request{}); (err != nil) != (tc.update != nil) {
+				t.Errorf("\nReason: %s\nr.Reconcile(...): unexpected error: %v", tc.reason, err)
+			}
+
+			mfs, err := reg.Gather()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var count uint64
+			var sum float64
+			for _, mf := range mfs {
+				for _, m := range mf.GetMetric() {
+					count += m.GetHistogram().GetSampleCount()
+					sum += m.GetHistogram().GetSampleSum()
+				}
+			}
+			if diff := cmp.Diff(tc.want, count); diff != "" {
+				t.Errorf("\nReason: %s\nClaimReadySeconds: -want count, +got count:\n%s", tc.reason, diff)
+			}
+			if tc.want > 0 && (sum < 45 || sum > 60) {
+				t.Errorf("\nReason: %s\nClaimReadySeconds: the time since the creation of the claim should be observed, got %fs", tc.reason, sum)
+			}
+		})
+	}
+}
+
+type recorderFn func(obj runtime.Object, e event.Event)
+
+func (fn recorderFn) Event(obj runtime.Object, e event.Event) { fn(obj, e) }
+
+func (fn recorderFn) WithAnnotations(_ ...string) event.Recorder { return fn }
+
+func TestReconcileSLAExceeded(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		update error
+		want   bool
+	}{
+		"StatusUpdateFailed": {
+			reason: "An exceeded SLA should not be reported if its condition cannot be persisted.",
+			update: errBoom,
+		},
+		"StatusUpdated": {
+			reason: "An exceeded SLA should be reported once its condition is persisted.",
+			want:   true,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			m := &fake.Manager{
+				Client: &test.MockClient{
+					MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+						o := obj.(metav1.Object)
+						o.SetNamespace("cool")
+						o.SetName("claim")
+						o.SetCreationTimestamp(metav1.NewTime(now.Add(-time.Hour)))
+						o.SetAnnotations(map[string]string{resource.AnnotationKeyTransferTo: "invalid"})
+						return nil
+					},
+					MockStatusUpdate: test.NewMockStatusUpdateFn(tc.update),
+				},
+			}
+			got := false
+			rec := recorderFn(func(_ runtime.Object, e event.Event) {
+				if e.Reason == reasonSLAExceeded {
+					got = true
+				}
+			})
+			r := NewReconciler(m, &test.MockClient{}, gvk,
+				WithRecorder(rec),
+				WithProvisioningSLAs(ProvisioningSLAs{Default: time.Minute}))
+			if _, err := r.Reconcile(reconcile.Request{}); (err != nil) != (tc.update != nil) {
+				t.Errorf("\nReason: %s\nr.Reconcile(...): unexpected error: %v", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\nReason: %s\nr.Reconcile(...): -want reported, +got reported:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestSyncWait(t *testing.T) {
+	// Conditions are stored with a precision of seconds.
+	at := now.Truncate(time.Second)
+	withConditions := func(c ...xpv1.Condition) *claim.Unstructured {
+		cm := claim.New(claim.WithGroupVersionKind(gvk))
+		cm.SetConditions(c...)
+		return cm
+	}
+	since := func(c xpv1.Condition, d time.Duration) xpv1.Condition {
+		c.LastTransitionTime = metav1.NewTime(at.Add(-d))
+		return c
+	}
+	created := func(d time.Duration) *claim.Unstructured {
+		cm := claim.New(claim.WithGroupVersionKind(gvk))
+		cm.SetCreationTimestamp(metav1.NewTime(at.Add(-d)))
+		return cm
+	}
+	cases := map[string]struct {
+		reason string
+		remote *claim.Unstructured
+		want   time.Duration
+	}{
+		"Ready": {
+			reason: "Ready claims should be synced rarely",
+			remote: withConditions(xpv1.Available(), xpv1.ReconcileSuccess()),
+			want:   idleWait,
+		},
+		"ReadyButFailing": {
+			reason: "Ready claims that the remote cluster fails to sync should be synced at least every shortWait",
+			remote: withConditions(since(xpv1.Available(), time.Hour), since(xpv1.ReconcileError(errBoom), time.Hour)),
+			want:   shortWait,
+		},
+		"RecentlyChanged": {
+			reason: "Claims whose Ready condition just changed should be synced often",
+			remote: withConditions(since(xpv1.Creating(), 10*time.Second)),
+			want:   tinyWait,
+		},
+		"TinyWaitBoundary": {
+			reason: "Claims whose Ready condition changed four tinyWaits ago should be synced every tinyWait",
+			remote: withConditions(since(xpv1.Creating(), 4*tinyWait)),
+			want:   tinyWait,
+		},
+		"AfterTinyWaitBoundary": {
+			reason: "Claims whose Ready condition changed more than four tinyWaits ago should be synced less often than every tinyWait",
+			remote: withConditions(since(xpv1.Creating(), 4*tinyWait+4*time.Second)),
+			want:   tinyWait + time.Second,
+		},
+		"Provisioning": {
+			reason: "Claims should be synced less often the longer they are provisioned",
+			remote: withConditions(since(xpv1.Creating(), 2*time.Minute)),
+			want:   30 * time.Second,
+		},
+		"LongWaitBoundary": {
+			reason: "Claims whose Ready condition changed four longWaits ago should be synced every longWait",
+			remote: withConditions(since(xpv1.Creating(), 4*longWait)),
+			want:   longWait,
+		},
+		"SlowProvisioning": {
+			reason: "Claims that are provisioned for a long time should not be synced more rarely than longWait",
+			remote: withConditions(since(xpv1.Creating(), time.Hour)),
+			want:   longWait,
+		},
+		"RecentlySyncedAgain": {
+			reason: "Claims whose Synced condition changed after their Ready condition should be synced based on the later change",
+			remote: withConditions(since(xpv1.Creating(), time.Hour), since(xpv1.ReconcileSuccess(), 10*time.Second)),
+			want:   tinyWait,
+		},
+		"Failing": {
+			reason: "Claims that the remote cluster fails to sync should not be synced more rarely than shortWait",
+			remote: withConditions(since(xpv1.Creating(), time.Hour), since(xpv1.ReconcileError(errBoom), time.Hour)),
+			want:   shortWait,
+		},
+		"RecentlyFailing": {
+			reason: "Claims that the remote cluster just failed to sync should be synced often",
+			remote: withConditions(since(xpv1.Creating(), time.Hour), since(xpv1.ReconcileError(errBoom), 10*time.Second)),
+			want:   tinyWait,
+		},
+		"ClockSkew": {
+			reason: "Claims whose Ready condition changed in the future of the local clock should be synced every tinyWait",
+			remote: withConditions(since(xpv1.Creating(), -time.Minute)),
+			want:   tinyWait,
+		},
+		"NoConditions": {
+			reason: "Claims without conditions should be synced based on when they were created",
+			remote: created(2 * time.Minute),
+			want:   30 * time.Second,
+		},
+		"NoTimestamps": {
+			reason: "Claims without a known time of change should be synced every longWait",
+			remote: claim.New(claim.WithGroupVersionKind(gvk)),
+			want:   longWait,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := SyncWait(tc.remote, at)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\nReason: %s\nSyncWait(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRemoveCondition(t *testing.T) {
+	withConditions := func(c ...xpv1.Condition) *claim.Unstructured {
+		cm := claim.New(claim.WithGroupVersionKind(gvk))
+		cm.SetConditions(c...)
+		return cm
+	}
+	cases := map[string]struct {
+		reason string
+		c      *claim.Unstructured
+		want   *claim.Unstructured
+	}{
+		"Removed": {
+			reason: "The condition of the supplied type should be removed and the others kept",
+			c:      withConditions(xpv1.Available(), resource.DryRunAccepted()),
+			want:   withConditions(xpv1.Available()),
+		},
+		"NotFound": {
+			reason: "Claims without a condition of the supplied type should be left alone",
+			c:      withConditions(xpv1.Available()),
+			want:   withConditions(xpv1.Available()),
+		},
+		"NoStatus": {
+			reason: "Claims without a status should be left alone",
+			c:      claim.New(claim.WithGroupVersionKind(gvk)),
+			want:   claim.New(claim.WithGroupVersionKind(gvk)),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			removeCondition(tc.c, resource.TypeDryRun)
+			if diff := cmp.Diff(tc.want, tc.c, test.EquateConditions()); diff != "" {
+				t.Errorf("\nReason: %s\nremoveCondition(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package claim
+
+import (
+	"context"
+	"fmt"
+
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane-runtime/pkg/meta"
+	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
+
+	"github.com/crossplane/agent/pkg/emergency"
+	"github.com/crossplane/agent/pkg/maintenance"
+	"github.com/crossplane/agent/pkg/resource"
+)
+
+// DeletionRecovererOption is used to configure *DeletionRecoverer.
+type DeletionRecovererOption func(*DeletionRecoverer)
+
+// WithRecoveryKeyMapper specifies how the DeletionRecoverer should find the
+// remote counterpart of a local claim. It should be the same KeyMapper that
+// the claim reconcilers use, see WithRemoteKeyMapper.
+func WithRecoveryKeyMapper(m KeyMapper) DeletionRecovererOption {
+	return func(r *DeletionRecoverer) {
+		r.mapper = m
+	}
+}
+
+// WithRecoveryClusterName specifies the name of this cluster in the remote
+// cluster. It should be the same one that the claim reconcilers use, see
+// WithClusterName.
+func WithRecoveryClusterName(cluster string) DeletionRecovererOption {
+	return func(r *DeletionRecoverer) {
+		r.cluster = cluster
+	}
+}
+
+// WithRecoveryEmergencyStop specifies the Switch that the DeletionRecoverer
+// should consult before deleting remote claims.
+func WithRecoveryEmergencyStop(s *emergency.Switch) DeletionRecovererOption {
+	return func(r *DeletionRecoverer) {
+		r.emergency = s
+	}
+}
+
+// WithRecoveryMaintenance specifies the Mode that the DeletionRecoverer should
+// consult before deleting remote claims.
+func WithRecoveryMaintenance(m *maintenance.Mode) DeletionRecovererOption {
+	return func(r *DeletionRecoverer) {
+		r.frozen = m
+	}
+}
+
+// WithRecoveryLogger specifies how the DeletionRecoverer should log messages.
+func WithRecoveryLogger(l logging.Logger) DeletionRecovererOption {
+	return func(r *DeletionRecoverer) {
+		r.log = l
+	}
+}
+
+// NewDeletionRecoverer returns a new *DeletionRecoverer.
+func NewDeletionRecoverer(local, remote client.Client, opts ...DeletionRecovererOption) *DeletionRecoverer {
+	r := &DeletionRecoverer{
+		local:     local,
+		remote:    remote,
+		mapper:    NewIdentityKeyMapper(),
+		emergency: emergency.NewSwitch(),
+		frozen:    maintenance.NewMode(),
+		log:       logging.NewNopLogger(),
+	}
+	for _, f := range opts {
+		f(r)
+	}
+	return r
+}
+
+// DeletionRecoverer is a manager.Runnable that completes the deletions of the
+// remote claims that were requested before the agent was stopped. The claim
+// reconcilers would get to them eventually, but in no particular order and
+// possibly after a long queue of claims that are doing fine.
+type DeletionRecoverer struct {
+	local     client.Client
+	remote    client.Client
+	mapper    KeyMapper
+	cluster   string
+	emergency *emergency.Switch
+	frozen    *maintenance.Mode
+	log       logging.Logger
+}
+
+// Start scans the local cluster once for interrupted deletions. Failures are
+// logged since the claim reconcilers will retry them anyway.
+func (r *DeletionRecoverer) Start(stop <-chan struct{}) error {
+	ctx, stopped := resource.ContextFromStop(stop)
+	defer stopped()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if err := r.Recover(ctx); err != nil {
+		r.log.Info("Cannot complete interrupted deletions", "error", err)
+	}
+	return nil
+}
+
+// Recover completes the interrupted deletions of all local claims, i.e. the
+// deleted ones that are marked with resource.AnnotationKeyDeletionRequested.
+// The finalizers of the local claims whose remote counterparts are gone are
+// removed and the deletions of the rest are requested again.
+func (r *DeletionRecoverer) Recover(ctx context.Context) error {
+	xrds := &v1alpha1.CompositeResourceDefinitionList{}
+	if err := r.local.List(ctx, xrds); err != nil {
+		return resource.LocalError(err, errListXRDs)
+	}
+	halted, err := r.emergency.Engaged(ctx)
+	if err != nil {
+		return resource.LocalError(err, errEmergencyStop)
+	}
+	frozen, err := r.frozen.Enabled(ctx)
+	if err != nil {
+		return resource.LocalError(err, errMaintenance)
+	}
+	completed, pending := 0, 0
+	for _, xrd := range xrds.Items {
+		if !xrd.OffersClaim() {
+			continue
+		}
+		gvk := xrd.GetClaimGroupVersionKind()
+		l := &unstructured.UnstructuredList{}
+		l.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		if err := r.local.List(ctx, l); err != nil {
+			return resource.LocalError(err, fmt.Sprintf(errFmtListClaims, gvk.Kind))
+		}
+		for i := range l.Items {
+			lc := &l.Items[i]
+			if _, ok := lc.GetAnnotations()[resource.AnnotationKeyDeletionRequested]; !ok || !meta.WasDeleted(lc) {
+				continue
+			}
+			done, err := r.recover(ctx, lc, halted || frozen)
+			if err != nil {
+				r.log.Info("Cannot complete interrupted deletion", "error", err, "kind", gvk.Kind, "namespace", lc.GetNamespace(), "name", lc.GetName())
+				continue
+			}
+			if done {
+				completed++
+				continue
+			}
+			pending++
+		}
+	}
+	r.log.Debug("Scanned for interrupted deletions", "completed", completed, "pending", pending, "halted", halted, "frozen", frozen)
+	return nil
+}
+
+// recover returns true if the deletion of the local claim is completed.
+func (r *DeletionRecoverer) recover(ctx context.Context, lc *unstructured.Unstructured, halted bool) (bool, error) {
+	rc := &unstructured.Unstructured{}
+	rc.SetGroupVersionKind(lc.GroupVersionKind())
+	err := r.remote.Get(ctx, RemoteKeyOf(r.mapper, lc), rc)
+	if err != nil && !kerrors.IsNotFound(err) {
+		return false, resource.RemoteError(err, errGetRequirement)
+	}
+	// The remote claims that aren't the local claim's to sync aren't deleted
+	// with it.
+	if kerrors.IsNotFound(err) || CheckRemoteOwner(lc, rc, true, r.cluster) != nil {
+		meta.RemoveFinalizer(lc, finalizer)
+		return true, resource.LocalError(r.local.Update(ctx, lc), errRemoveFinalizer)
+	}
+	if halted || meta.WasDeleted(rc) {
+		return false, nil
+	}
+	return false, resource.RemoteError(client.IgnoreNotFound(r.remote.Delete(ctx, rc)), errDeleteClaim)
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package claim
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	crds "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/pkg/meta"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
+
+	"github.com/crossplane/agent/pkg/emergency"
+	"github.com/crossplane/agent/pkg/maintenance"
+	"github.com/crossplane/agent/pkg/resource"
+)
+
+func TestDeletionRecovererRecover(t *testing.T) {
+	xrd := v1alpha1.CompositeResourceDefinition{
+		Spec: v1alpha1.CompositeResourceDefinitionSpec{
+			ClaimNames: &crds.CustomResourceDefinitionNames{Kind: "Database"},
+			CRDSpecTemplate: v1alpha1.CRDSpecTemplate{
+				Group:   "example.org",
+				Version: "v1alpha1",
+			},
+		},
+	}
+	newClaim := func(marked bool) unstructured.Unstructured {
+		u := unstructured.Unstructured{}
+		u.SetGroupVersionKind(xrd.GetClaimGroupVersionKind())
+		u.SetNamespace("default")
+		u.SetName("db")
+		u.SetDeletionTimestamp(&now)
+		u.SetFinalizers([]string{finalizer})
+		if marked {
+			u.SetAnnotations(deletionRequested)
+		}
+		return u
+	}
+	list := func(c unstructured.Unstructured) test.MockListFn {
+		return func(_ context.Context, obj runtime.Object, _ ...client.ListOption) error {
+			switch l := obj.(type) {
+			case *v1alpha1.CompositeResourceDefinitionList:
+				l.Items = []v1alpha1.CompositeResourceDefinition{xrd}
+			case *unstructured.UnstructuredList:
+				l.Items = []unstructured.Unstructured{c}
+			}
+			return nil
+		}
+	}
+	notFound := kerrors.NewNotFound(schema.GroupResource{}, "db")
+
+	type args struct {
+		local  client.Client
+		remote client.Client
+		opts   []DeletionRecovererOption
+	}
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   error
+	}{
+		"ListXRDsFailed": {
+			reason: "The error should be returned if the composite resource definitions cannot be listed",
+			args: args{
+				local: &test.MockClient{MockList: test.NewMockListFn(errBoom)},
+			},
+			want: resource.LocalError(errBoom, errListXRDs),
+		},
+		"NotMarked": {
+			reason: "Claims whose deletion wasn't requested yet should be left to the claim reconcilers",
+			args: args{
+				local:  &test.MockClient{MockList: list(newClaim(false))},
+				remote: &test.MockClient{},
+			},
+		},
+		"RemoteGone": {
+			reason: "The finalizer of the local claim should be removed if the remote claim is gone",
+			args: args{
+				local: &test.MockClient{
+					MockList: list(newClaim(true)),
+					MockUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+						if o, _ := obj.(metav1.Object); meta.FinalizerExists(o, finalizer) {
+							t.Errorf("\nReason: %s\nthe finalizer is not removed", "The finalizer of the local claim should be removed if the remote claim is gone")
+						}
+						return nil
+					},
+				},
+				remote: &test.MockClient{MockGet: test.NewMockGetFn(notFound)},
+			},
+		},
+		"RemoteDeletionRequested": {
+			reason: "The deletion of the remote claim should be requested again if it still exists",
+			args: args{
+				local: &test.MockClient{MockList: list(newClaim(true))},
+				remote: &test.MockClient{
+					MockGet: test.NewMockGetFn(nil),
+					MockDelete: func(_ context.Context, obj runtime.Object, _ ...client.DeleteOption) error {
+						if diff := cmp.Diff(xrd.GetClaimGroupVersionKind(), obj.GetObjectKind().GroupVersionKind()); diff != "" {
+							t.Errorf("\nReason: %s\n-want, +got:\n%s", "The remote claim should be deleted", diff)
+						}
+						return nil
+					},
+				},
+			},
+		},
+		"EmergencyStopEngaged": {
+			reason: "Remote claims should not be deleted while the emergency stop is engaged",
+			args: args{
+				local:  &test.MockClient{MockList: list(newClaim(true))},
+				remote: &test.MockClient{MockGet: test.NewMockGetFn(nil)},
+				opts: []DeletionRecovererOption{
+					WithRecoveryEmergencyStop(emergency.NewSwitch(emergency.WithEngaged(true))),
+				},
+			},
+		},
+		"MaintenanceEnabled": {
+			reason: "Remote claims should not be deleted while the local cluster is under maintenance",
+			args: args{
+				local:  &test.MockClient{MockList: list(newClaim(true))},
+				remote: &test.MockClient{MockGet: test.NewMockGetFn(nil)},
+				opts: []DeletionRecovererOption{
+					WithRecoveryMaintenance(maintenance.NewMode(maintenance.WithEnabled(true))),
+				},
+			},
+		},
+		"RecoverFailed": {
+			reason: "Failing to complete a deletion should not fail the whole scan",
+			args: args{
+				local:  &test.MockClient{MockList: list(newClaim(true))},
+				remote: &test.MockClient{MockGet: test.NewMockGetFn(errBoom)},
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			r := NewDeletionRecoverer(tc.args.local, tc.args.remote, tc.args.opts...)
+			err := r.Recover(context.Background())
+			if diff := cmp.Diff(tc.want, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\nr.Recover(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
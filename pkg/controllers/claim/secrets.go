@@ -0,0 +1,259 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package claim
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane-runtime/pkg/meta"
+	"github.com/crossplane/crossplane-runtime/pkg/resource/unstructured"
+	"github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/claim"
+
+	"github.com/crossplane/agent/pkg/resource"
+)
+
+const defaultSecretWorkers = 5
+
+// SecretWorkersOption is used to configure *SecretWorkers.
+type SecretWorkersOption func(*SecretWorkers)
+
+// WithSecretWorkerCount specifies how many connection secrets the
+// SecretWorkers should propagate at the same time.
+func WithSecretWorkerCount(n int) SecretWorkersOption {
+	return func(w *SecretWorkers) {
+		w.workers = n
+	}
+}
+
+// WithSecretWorkersLogger specifies how the SecretWorkers should log messages.
+func WithSecretWorkersLogger(l logging.Logger) SecretWorkersOption {
+	return func(w *SecretWorkers) {
+		w.log = l
+	}
+}
+
+// WithSecretRetryBackoff specifies how long the SecretWorkers should wait
+// before they retry a connection secret that failed to propagate for the first
+// time, and at most. The wait doubles with every failure of the secret,
+// independently of the other secrets and of the sync of its claim.
+func WithSecretRetryBackoff(base, max time.Duration) SecretWorkersOption {
+	return func(w *SecretWorkers) {
+		w.limiter = workqueue.NewItemExponentialFailureRateLimiter(base, max)
+	}
+}
+
+// NewSecretWorkers returns a new *SecretWorkers.
+func NewSecretWorkers(local, remote client.Client, opts ...SecretWorkersOption) *SecretWorkers {
+	w := &SecretWorkers{
+		local:   unstructured.NewClient(local),
+		remote:  unstructured.NewClient(remote),
+		targets: map[schema.GroupVersionKind]secretTarget{},
+		workers: defaultSecretWorkers,
+		limiter: workqueue.DefaultControllerRateLimiter(),
+		log:     logging.NewNopLogger(),
+	}
+	for _, f := range opts {
+		f(w)
+	}
+	w.queue = workqueue.NewNamedRateLimitingQueue(w.limiter, "connection-secrets")
+	return w
+}
+
+// SecretWorkers is a manager.Runnable that propagates the connection secrets
+// of claims in the background, so that the claim reconcilers aren't held up
+// by slow or failing secret reads and keep the status of the claims fresh.
+// The claims are queued by their reconcilers, see WithSecretWorkers, and each
+// claim is worked on by one worker at a time. The outcome is reported in the
+// ConnectionSecretSynced condition of the claims.
+type SecretWorkers struct {
+	local  client.Client
+	remote client.Client
+
+	targets   map[schema.GroupVersionKind]secretTarget
+	targetsMu sync.RWMutex
+
+	workers int
+	limiter workqueue.RateLimiter
+	queue   workqueue.RateLimitingInterface
+	log     logging.Logger
+}
+
+type secretTarget struct {
+	propagator Propagator
+	mapper     KeyMapper
+	cluster    string
+}
+
+type secretKey struct {
+	gvk schema.GroupVersionKind
+	nn  types.NamespacedName
+}
+
+// Register specifies how the connection secrets of the claims of the supplied
+// type should be propagated, how their remote counterparts are found and the
+// name of this cluster in the remote cluster, see CheckRemoteOwner.
+func (w *SecretWorkers) Register(gvk schema.GroupVersionKind, p Propagator, m KeyMapper, cluster string) {
+	w.targetsMu.Lock()
+	defer w.targetsMu.Unlock()
+	w.targets[gvk] = secretTarget{propagator: p, mapper: m, cluster: cluster}
+}
+
+// Enqueuer returns a Propagator that queues the connection secrets of the
+// claims of the supplied type to be propagated by the SecretWorkers. The
+// secrets that are waiting to be retried are queued right away as well, since
+// the sync of their claim may be for a change of the secret.
+func (w *SecretWorkers) Enqueuer(gvk schema.GroupVersionKind) PropagateFn {
+	return func(_ context.Context, local, _ *claim.Unstructured) error {
+		key := secretKey{gvk: gvk, nn: types.NamespacedName{Namespace: local.GetNamespace(), Name: local.GetName()}}
+		w.queue.Add(key)
+		return nil
+	}
+}
+
+// Retrier returns a Propagator that propagates the connection secrets of the
+// claims of the supplied type inline, with the Propagator they're registered
+// with, and hands the ones that fail to the SecretWorkers to be retried with
+// their own backoff instead of failing the sync of their claims. The outcome
+// is reported in the ConnectionSecretSynced condition of the claims. The
+// secrets that are waiting to be retried are left to the SecretWorkers.
+func (w *SecretWorkers) Retrier(gvk schema.GroupVersionKind) PropagateFn {
+	return func(ctx context.Context, local, remote *claim.Unstructured) error {
+		key := secretKey{gvk: gvk, nn: types.NamespacedName{Namespace: local.GetNamespace(), Name: local.GetName()}}
+		if w.queue.NumRequeues(key) > 0 {
+			return nil
+		}
+		w.targetsMu.RLock()
+		t, ok := w.targets[gvk]
+		w.targetsMu.RUnlock()
+		if !ok {
+			return nil
+		}
+		if err := t.propagator.Propagate(ctx, local, remote); err != nil {
+			w.log.Debug("Cannot propagate connection secret, retrying separately", "kind", gvk.Kind, "namespace", key.nn.Namespace, "name", key.nn.Name, "error", err)
+			local.SetConditions(resource.ConnectionSecretSyncError(err))
+			w.queue.AddRateLimited(key)
+			return nil
+		}
+		local.SetConditions(resource.ConnectionSecretSyncSuccess())
+		return nil
+	}
+}
+
+// Start runs the workers until the supplied channel is closed.
+func (w *SecretWorkers) Start(stop <-chan struct{}) error {
+	ctx, cancel := resource.ContextFromStop(stop)
+	defer cancel()
+	wg := &sync.WaitGroup{}
+	for i := 0; i < w.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for w.next(ctx) {
+			}
+		}()
+	}
+	<-stop
+	w.queue.ShutDown()
+	wg.Wait()
+	return nil
+}
+
+// next propagates the connection secret of the next claim in the queue. It
+// returns false once the queue is shut down.
+func (w *SecretWorkers) next(ctx context.Context) bool {
+	item, shutdown := w.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer w.queue.Done(item)
+	key, _ := item.(secretKey)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if err := w.Propagate(ctx, key.gvk, key.nn); err != nil {
+		w.log.Debug("Cannot propagate connection secret", "kind", key.gvk.Kind, "namespace", key.nn.Namespace, "name", key.nn.Name, "error", err)
+		w.queue.AddRateLimited(item)
+		return true
+	}
+	w.queue.Forget(item)
+	return true
+}
+
+// Propagate propagates the connection secret of the local claim of the
+// supplied type with the supplied key and records the outcome in its
+// ConnectionSecretSynced condition. An error is returned if the claim should
+// be retried.
+func (w *SecretWorkers) Propagate(ctx context.Context, gvk schema.GroupVersionKind, nn types.NamespacedName) error {
+	w.targetsMu.RLock()
+	t, ok := w.targets[gvk]
+	w.targetsMu.RUnlock()
+	if !ok {
+		return nil
+	}
+	local := claim.New(claim.WithGroupVersionKind(gvk))
+	if err := w.local.Get(ctx, nn, local); err != nil {
+		return resource.LocalError(client.IgnoreNotFound(err), errGetRequirement)
+	}
+	if meta.WasDeleted(local) {
+		return nil
+	}
+	remote := claim.New(claim.WithGroupVersionKind(gvk))
+	err := w.remote.Get(ctx, RemoteKeyOf(t.mapper, local), remote)
+	if kerrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return resource.RemoteError(err, errGetRequirement)
+	}
+	// The connection secret of a remote claim that isn't the claim's to sync
+	// isn't its to read either. The claim reconciler reports why.
+	if CheckRemoteOwner(local, remote, true, t.cluster) != nil {
+		return nil
+	}
+	perr := t.propagator.Propagate(ctx, local, remote)
+	c := resource.ConnectionSecretSyncSuccess()
+	if perr != nil {
+		c = resource.ConnectionSecretSyncError(perr)
+	}
+	// The claim reconciler may have written the status of the claim while its
+	// secret was propagated, so the condition is set on the latest claim if
+	// the write conflicts rather than overwriting the newer conditions.
+	first := true
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if !first {
+			if err := w.local.Get(ctx, nn, local); err != nil {
+				return err
+			}
+		}
+		first = false
+		local.SetConditions(c)
+		return w.local.Status().Update(ctx, local)
+	})
+	if err != nil {
+		return resource.LocalError(client.IgnoreNotFound(err), errStatusUpdateClaim)
+	}
+	return perr
+}
@@ -0,0 +1,227 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package claim
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	kunstructured "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/claim"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/crossplane/agent/pkg/resource"
+)
+
+func TestSecretWorkersPropagate(t *testing.T) {
+	statusUpdate := func(t *testing.T, reason string, c func(*claim.Unstructured)) test.MockStatusUpdateFn {
+		return func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+			want := claim.New(claim.WithGroupVersionKind(gvk))
+			c(want)
+			if diff := cmp.Diff(want.GetUnstructured(), obj, test.EquateConditions()); diff != "" {
+				t.Errorf("\nReason: %s\n-want, +got:\n%s", reason, diff)
+			}
+			return nil
+		}
+	}
+	type args struct {
+		local      client.Client
+		remote     client.Client
+		propagator Propagator
+	}
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   error
+	}{
+		"LocalNotFound": {
+			reason: "No error should be returned if the local claim is gone",
+			args: args{
+				local: &test.MockClient{MockGet: test.NewMockGetFn(kerrors.NewNotFound(schema.GroupResource{}, ""))},
+			},
+		},
+		"LocalGetFailed": {
+			reason: "An error should be returned if the local claim cannot be retrieved",
+			args: args{
+				local: &test.MockClient{MockGet: test.NewMockGetFn(errBoom)},
+			},
+			want: resource.LocalError(errBoom, errGetRequirement),
+		},
+		"RemoteNotFound": {
+			reason: "No error should be returned if the remote claim is not there yet",
+			args: args{
+				local:  &test.MockClient{MockGet: test.NewMockGetFn(nil)},
+				remote: &test.MockClient{MockGet: test.NewMockGetFn(kerrors.NewNotFound(schema.GroupResource{}, ""))},
+			},
+		},
+		"PropagateFailed": {
+			reason: "The propagation error should be reported in the condition and returned so that the claim is retried",
+			args: args{
+				local: &test.MockClient{
+					MockGet: test.NewMockGetFn(nil),
+					MockStatusUpdate: statusUpdate(t, "The propagation error should be reported in the condition", func(c *claim.Unstructured) {
+						c.SetConditions(resource.ConnectionSecretSyncError(errBoom))
+					}),
+				},
+				remote: &test.MockClient{MockGet: test.NewMockGetFn(nil)},
+				propagator: PropagateFn(func(_ context.Context, _, _ *claim.Unstructured) error {
+					return errBoom
+				}),
+			},
+			want: errBoom,
+		},
+		"StatusConflict": {
+			reason: "The condition should be set on the latest claim if the status write conflicts",
+			args: args{
+				local: func() client.Client {
+					reads, writes := 0, 0
+					return &test.MockClient{
+						// The claim reconciler reports a successful sync
+						// after the claim is first read.
+						MockGet: test.NewMockGetFn(nil, func(obj runtime.Object) error {
+							reads++
+							if reads > 1 {
+								cm := claim.New(claim.WithGroupVersionKind(gvk))
+								cm.SetConditions(resource.AgentSyncSuccess())
+								obj.(*kunstructured.Unstructured).Object = cm.Object
+							}
+							return nil
+						}),
+						MockStatusUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+							writes++
+							if writes == 1 {
+								return kerrors.NewConflict(schema.GroupResource{}, "cool", errBoom)
+							}
+							want := claim.New(claim.WithGroupVersionKind(gvk))
+							want.SetConditions(resource.AgentSyncSuccess(), resource.ConnectionSecretSyncSuccess())
+							if diff := cmp.Diff(want.GetUnstructured(), obj, test.EquateConditions()); diff != "" {
+								t.Errorf("\nReason: %s\n-want, +got:\n%s", "The condition should be set on the latest claim", diff)
+							}
+							return nil
+						},
+					}
+				}(),
+				remote: &test.MockClient{MockGet: test.NewMockGetFn(nil)},
+				propagator: PropagateFn(func(_ context.Context, _, _ *claim.Unstructured) error {
+					return nil
+				}),
+			},
+		},
+		"Success": {
+			reason: "A successful propagation should be reported in the condition",
+			args: args{
+				local: &test.MockClient{
+					MockGet: test.NewMockGetFn(nil),
+					MockStatusUpdate: statusUpdate(t, "A successful propagation should be reported in the condition", func(c *claim.Unstructured) {
+						c.SetConditions(resource.ConnectionSecretSyncSuccess())
+					}),
+				},
+				remote: &test.MockClient{MockGet: test.NewMockGetFn(nil)},
+				propagator: PropagateFn(func(_ context.Context, _, _ *claim.Unstructured) error {
+					return nil
+				}),
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			w := NewSecretWorkers(tc.args.local, tc.args.remote)
+			w.Register(gvk, tc.args.propagator, NewIdentityKeyMapper(), "")
+			err := w.Propagate(context.Background(), gvk, types.NamespacedName{Name: "cool"})
+			if diff := cmp.Diff(tc.want, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\nPropagate(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestSecretWorkersRetrier(t *testing.T) {
+	cases := map[string]struct {
+		reason    string
+		errs      []error
+		want      v1alpha1.Condition
+		wantCalls int
+	}{
+		"Success": {
+			reason:    "A successful propagation should be reported in the condition",
+			errs:      []error{nil},
+			want:      resource.ConnectionSecretSyncSuccess(),
+			wantCalls: 1,
+		},
+		"PropagateFailed": {
+			reason:    "A failed propagation should be reported in the condition without failing the sync of the claim",
+			errs:      []error{errBoom},
+			want:      resource.ConnectionSecretSyncError(errBoom),
+			wantCalls: 1,
+		},
+		"RetryPending": {
+			reason:    "A secret that's waiting to be retried should be left to the workers",
+			errs:      []error{errBoom, nil},
+			want:      resource.ConnectionSecretSyncError(errBoom),
+			wantCalls: 1,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			calls := 0
+			w := NewSecretWorkers(&test.MockClient{}, &test.MockClient{}, WithSecretRetryBackoff(time.Hour, time.Hour))
+			w.Register(gvk, PropagateFn(func(_ context.Context, _, _ *claim.Unstructured) error {
+				calls++
+				return tc.errs[calls-1]
+			}), NewIdentityKeyMapper(), "")
+			local := claim.New(claim.WithGroupVersionKind(gvk))
+			local.SetName("cool")
+			for range tc.errs {
+				if err := w.Retrier(gvk)(context.Background(), local, claim.New()); err != nil {
+					t.Errorf("\nReason: %s\nPropagate(...): unexpected error: %s", tc.reason, err)
+				}
+			}
+			if diff := cmp.Diff(tc.wantCalls, calls); diff != "" {
+				t.Errorf("\nReason: %s\nPropagate(...): -want calls, +got calls:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want, local.GetCondition(tc.want.Type), test.EquateConditions()); diff != "" {
+				t.Errorf("\nReason: %s\nPropagate(...): -want condition, +got condition:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestSecretWorkersEnqueuer(t *testing.T) {
+	w := NewSecretWorkers(&test.MockClient{}, &test.MockClient{}, WithSecretRetryBackoff(time.Hour, time.Hour))
+	local := claim.New(claim.WithGroupVersionKind(gvk))
+	local.SetName("cool")
+	key := secretKey{gvk: gvk, nn: types.NamespacedName{Name: "cool"}}
+
+	// The secret failed before and is waiting to be retried.
+	w.queue.AddRateLimited(key)
+	if err := w.Enqueuer(gvk)(context.Background(), local, claim.New()); err != nil {
+		t.Errorf("\nEnqueuer(...): unexpected error: %s", err)
+	}
+	if diff := cmp.Diff(1, w.queue.Len()); diff != "" {
+		t.Errorf("\nEnqueuer(...): a secret that's waiting to be retried should be queued right away: -want, +got:\n%s", diff)
+	}
+	w.queue.ShutDown()
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package claim
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/crossplane/crossplane-runtime/pkg/meta"
+	"github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/claim"
+
+	"github.com/crossplane/agent/pkg/resource"
+)
+
+const errFmtParseSLA = "cannot parse provisioning SLA %q, it has to be in [Kind,...=]duration format, e.g. Database=15m"
+
+// ProvisioningSLAs are how long the claims may take to become ready after
+// they're created, by kind.
+type ProvisioningSLAs struct {
+	// Default is the SLA of the kinds that aren't listed. The claims of those
+	// kinds have no SLA if it's zero.
+	Default time.Duration
+
+	// Kinds are the SLAs of the listed kinds.
+	Kinds map[string]time.Duration
+}
+
+// For returns the SLA of the supplied kind, or zero if it has none.
+func (s ProvisioningSLAs) For(kind string) time.Duration {
+	if d, ok := s.Kinds[kind]; ok {
+		return d
+	}
+	return s.Default
+}
+
+// ParseProvisioningSLAs parses the supplied SLAs in [Kind,...=]duration
+// format, e.g. Database,Bucket=15m. The SLA without kinds is the default one.
+func ParseProvisioningSLAs(in ...string) (ProvisioningSLAs, error) {
+	s := ProvisioningSLAs{Kinds: map[string]time.Duration{}}
+	for _, v := range in {
+		kinds, raw := "", v
+		if i := strings.Index(v, "="); i >= 0 {
+			kinds, raw = v[:i], v[i+1:]
+		}
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 || (kinds == "" && strings.Contains(v, "=")) {
+			return ProvisioningSLAs{}, errors.Errorf(errFmtParseSLA, v)
+		}
+		if kinds == "" {
+			s.Default = d
+			continue
+		}
+		for _, k := range strings.Split(kinds, ",") {
+			s.Kinds[strings.TrimSpace(k)] = d
+		}
+	}
+	return s, nil
+}
+
+// CheckSLA marks the supplied local claim with an SLAExceeded condition that
+// is true if it isn't ready the supplied SLA after its creation, and false once
+// it becomes ready. Only the first time the claim becomes ready counts, so the
+// condition isn't changed once it's false. It returns true if the claim has
+// just exceeded its SLA, and otherwise how long is left until it does, or zero
+// if it won't.
+func CheckSLA(local *claim.Unstructured, sla time.Duration, now time.Time) (bool, time.Duration) {
+	created := local.GetCreationTimestamp()
+	if sla <= 0 || meta.WasDeleted(local) || created.IsZero() {
+		return false, 0
+	}
+	elapsed := now.Sub(created.Time)
+	status := local.GetCondition(resource.TypeSLAExceeded).Status
+	switch {
+	case status == corev1.ConditionFalse:
+	case isReady(local) && status == corev1.ConditionTrue:
+		local.SetConditions(resource.SLARecovered(elapsed))
+	case isReady(local):
+		local.SetConditions(resource.SLAMet(elapsed))
+	case status == corev1.ConditionTrue:
+	case elapsed >= sla:
+		local.SetConditions(resource.SLAExceeded(sla, elapsed))
+		return true, 0
+	default:
+		return false, sla - elapsed
+	}
+	return false, 0
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package claim
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/claim"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/crossplane/agent/pkg/resource"
+)
+
+func TestParseProvisioningSLAs(t *testing.T) {
+	type want struct {
+		slas ProvisioningSLAs
+		err  error
+	}
+	cases := map[string]struct {
+		reason string
+		in     []string
+		want   want
+	}{
+		"DefaultAndKinds": {
+			reason: "The SLA without kinds should be the default and the others should apply to their kinds",
+			in:     []string{"30m", "Database, Bucket=15m"},
+			want: want{slas: ProvisioningSLAs{
+				Default: 30 * time.Minute,
+				Kinds:   map[string]time.Duration{"Database": 15 * time.Minute, "Bucket": 15 * time.Minute},
+			}},
+		},
+		"InvalidDuration": {
+			reason: "An SLA that isn't a positive duration should be an error",
+			in:     []string{"Database=soon"},
+			want:   want{err: errors.Errorf(errFmtParseSLA, "Database=soon")},
+		},
+		"NoKinds": {
+			reason: "An SLA with an empty list of kinds should be an error",
+			in:     []string{"=15m"},
+			want:   want{err: errors.Errorf(errFmtParseSLA, "=15m")},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseProvisioningSLAs(tc.in...)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\nParseProvisioningSLAs(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.slas, got, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("\nReason: %s\nParseProvisioningSLAs(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestCheckSLA(t *testing.T) {
+	now := time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+	sla := 15 * time.Minute
+	local := func(age time.Duration, cs ...v1alpha1.Condition) *claim.Unstructured {
+		c := claim.New()
+		c.SetCreationTimestamp(metav1.NewTime(now.Add(-age)))
+		c.SetConditions(cs...)
+		return c
+	}
+
+	type want struct {
+		exceeded  bool
+		remaining time.Duration
+		condition v1alpha1.Condition
+	}
+	cases := map[string]struct {
+		reason string
+		local  *claim.Unstructured
+		sla    time.Duration
+		want   want
+	}{
+		"NoSLA": {
+			reason: "The claims of the kinds without an SLA shouldn't be marked",
+			local:  local(time.Hour),
+			want:   want{condition: v1alpha1.Condition{Type: resource.TypeSLAExceeded, Status: corev1.ConditionUnknown}},
+		},
+		"Pending": {
+			reason: "A claim that isn't ready within its SLA yet should be checked again when it runs out",
+			local:  local(5 * time.Minute),
+			sla:    sla,
+			want: want{
+				remaining: 10 * time.Minute,
+				condition: v1alpha1.Condition{Type: resource.TypeSLAExceeded, Status: corev1.ConditionUnknown},
+			},
+		},
+		"Exceeded": {
+			reason: "A claim that isn't ready when its SLA runs out should be marked",
+			local:  local(20 * time.Minute),
+			sla:    sla,
+			want: want{
+				exceeded:  true,
+				condition: resource.SLAExceeded(sla, 20*time.Minute),
+			},
+		},
+		"StillExceeded": {
+			reason: "A claim that was already marked shouldn't be reported again",
+			local:  local(30*time.Minute, resource.SLAExceeded(sla, 20*time.Minute)),
+			sla:    sla,
+			want:   want{condition: resource.SLAExceeded(sla, 20*time.Minute)},
+		},
+		"ReadyInTime": {
+			reason: "A claim that became ready within its SLA should be marked as such",
+			local:  local(5*time.Minute, v1alpha1.Available()),
+			sla:    sla,
+			want:   want{condition: resource.SLAMet(5 * time.Minute)},
+		},
+		"ReadyLate": {
+			reason: "A claim that exceeded its SLA should be cleared once it becomes ready",
+			local:  local(30*time.Minute, resource.SLAExceeded(sla, 20*time.Minute), v1alpha1.Available()),
+			sla:    sla,
+			want:   want{condition: resource.SLARecovered(30 * time.Minute)},
+		},
+		"NotReadyAgain": {
+			reason: "A claim that became ready once shouldn't be marked when it isn't ready anymore",
+			local:  local(time.Hour, resource.SLAMet(5*time.Minute), v1alpha1.Unavailable()),
+			sla:    sla,
+			want:   want{condition: resource.SLAMet(5 * time.Minute)},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			exceeded, remaining := CheckSLA(tc.local, tc.sla, now)
+			if diff := cmp.Diff(tc.want.exceeded, exceeded); diff != "" {
+				t.Errorf("\nReason: %s\nCheckSLA(...): -want exceeded, +got exceeded:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.remaining, remaining); diff != "" {
+				t.Errorf("\nReason: %s\nCheckSLA(...): -want remaining, +got remaining:\n%s", tc.reason, diff)
+			}
+			got := tc.local.GetCondition(resource.TypeSLAExceeded)
+			if diff := cmp.Diff(tc.want.condition, got, cmpopts.IgnoreFields(v1alpha1.Condition{}, "LastTransitionTime")); diff != "" {
+				t.Errorf("\nReason: %s\nCheckSLA(...): -want condition, +got condition:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
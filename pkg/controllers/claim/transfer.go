@@ -0,0 +1,208 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package claim
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
+	"github.com/crossplane/crossplane-runtime/pkg/meta"
+	runtimeresource "github.com/crossplane/crossplane-runtime/pkg/resource"
+	"github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/claim"
+
+	"github.com/crossplane/agent/pkg/resource"
+)
+
+const (
+	errCreateTransferTarget = "cannot create the claim the ownership is transferred to"
+	errGetTransferTarget    = "cannot get the claim the ownership is transferred to"
+	errFmtTransferTarget    = "%s is not in namespace/name format"
+	errFmtTransferTaken     = "claim %s already exists and isn't synced to remote claim %s"
+	errTransferSelf         = "the ownership cannot be transferred to the claim itself"
+	errCopyTransferredSpec  = "cannot copy spec to the claim the ownership is transferred to"
+
+	errFmtRemoteOtherCluster = "remote claim %s belongs to cluster %s"
+	errFmtRemoteOtherClaim   = "remote claim %s is synced by claim %s/%s"
+	errFmtRemoteUnrecorded   = "remote claim %s doesn't record the claim it's synced by, so only the claim that maps to it can sync it"
+	errFmtRemoteNotFound     = "remote claim %s in the %s annotation doesn't exist"
+	errHandOver              = "cannot hand the remote claim over to the claim the ownership is transferred to"
+	errAccessRemoteMetadata  = "cannot access the metadata of the remote claim"
+)
+
+// SetRemoteOwner records the supplied local claim of the supplied cluster as
+// the one the supplied remote claim is synced by, see CheckRemoteOwner.
+func SetRemoteOwner(remote metav1.Object, local types.NamespacedName, cluster string) {
+	l := map[string]string{
+		resource.LabelKeyOwnerNamespace: resource.LabelValue(local.Namespace),
+		resource.LabelKeyOwnerName:      resource.LabelValue(local.Name),
+	}
+	if cluster != "" {
+		l[resource.LabelKeyCluster] = resource.LabelValue(cluster)
+	}
+	meta.AddLabels(remote, l)
+}
+
+// CheckRemoteOwner returns an error if the supplied local claim of the
+// supplied cluster may not sync the supplied remote claim. Remote claims record
+// the local claim they're synced by and its cluster in their labels, see
+// SetRemoteOwner, so that a claim cannot take over the remote claim of another
+// claim, e.g. of another tenant, by pointing its AnnotationKeyRemoteClaim
+// annotation at it. The remote claims that don't record one, e.g. because they
+// were created before the agent recorded them, are synced only by the claims
+// that map to them, and the ones that don't exist cannot be pointed at. The
+// cluster is only checked if the names of both are known.
+func CheckRemoteOwner(local, remote metav1.Object, exists bool, cluster string) error {
+	key := types.NamespacedName{Namespace: remote.GetNamespace(), Name: remote.GetName()}
+	_, annotated := local.GetAnnotations()[resource.AnnotationKeyRemoteClaim]
+	if !exists {
+		if annotated {
+			return errors.Errorf(errFmtRemoteNotFound, local.GetAnnotations()[resource.AnnotationKeyRemoteClaim], resource.AnnotationKeyRemoteClaim)
+		}
+		return nil
+	}
+	l := remote.GetLabels()
+	if c := l[resource.LabelKeyCluster]; c != "" && cluster != "" && c != resource.LabelValue(cluster) {
+		return errors.Errorf(errFmtRemoteOtherCluster, key, c)
+	}
+	ns, name := l[resource.LabelKeyOwnerNamespace], l[resource.LabelKeyOwnerName]
+	if ns == "" && name == "" {
+		if annotated {
+			return errors.Errorf(errFmtRemoteUnrecorded, key)
+		}
+		return nil
+	}
+	if ns != resource.LabelValue(local.GetNamespace()) || name != resource.LabelValue(local.GetName()) {
+		return errors.Errorf(errFmtRemoteOtherClaim, key, ns, name)
+	}
+	return nil
+}
+
+// RemoteOwnedBy returns an ApplyOption that fails if the supplied local claim
+// of the supplied cluster may not sync the remote claim that is applied, see
+// CheckRemoteOwner.
+func RemoteOwnedBy(local metav1.Object, cluster string) runtimeresource.ApplyOption {
+	return func(_ context.Context, current, _ runtime.Object) error {
+		c, ok := current.(metav1.Object)
+		if !ok {
+			return errors.New(errAccessRemoteMetadata)
+		}
+		return CheckRemoteOwner(local, c, true, cluster)
+	}
+}
+
+// RemoteKeyOf returns the key of the remote counterpart of the supplied local
+// claim. It's the key in its AnnotationKeyRemoteClaim annotation if it has
+// one, e.g. because its ownership was transferred from another claim, and the
+// key the supplied KeyMapper maps it to otherwise.
+func RemoteKeyOf(m KeyMapper, local metav1.Object) types.NamespacedName {
+	if nn, ok := parseKey(local.GetAnnotations()[resource.AnnotationKeyRemoteClaim]); ok {
+		return nn
+	}
+	return m.RemoteKey(types.NamespacedName{Namespace: local.GetNamespace(), Name: local.GetName()})
+}
+
+// TransferTarget returns the namespace and name of the local claim that the
+// ownership of the supplied claim is transferred to, if any.
+func TransferTarget(local metav1.Object) (types.NamespacedName, bool, error) {
+	v, ok := local.GetAnnotations()[resource.AnnotationKeyTransferTo]
+	if !ok {
+		return types.NamespacedName{}, false, nil
+	}
+	nn, ok := parseKey(v)
+	if !ok {
+		return types.NamespacedName{}, false, errors.Errorf(errFmtTransferTarget, v)
+	}
+	if nn.Namespace == local.GetNamespace() && nn.Name == local.GetName() {
+		return types.NamespacedName{}, false, errors.New(errTransferSelf)
+	}
+	return nn, true, nil
+}
+
+func parseKey(s string) (types.NamespacedName, bool) {
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return types.NamespacedName{}, false
+	}
+	return types.NamespacedName{Namespace: parts[0], Name: parts[1]}, true
+}
+
+// HandOver records the local claim with the supplied key as the one the
+// supplied remote claim is synced by in place of the supplied local claim, so
+// that it can take the remote claim over once it's created. It's not an error
+// if the remote claim already records it, e.g. because a previous attempt got
+// that far.
+func HandOver(ctx context.Context, kube client.Client, local metav1.Object, remote *claim.Unstructured, to types.NamespacedName, cluster string) error {
+	if err := CheckRemoteOwner(local, remote, true, cluster); err != nil {
+		target := &metav1.ObjectMeta{Namespace: to.Namespace, Name: to.Name}
+		if CheckRemoteOwner(target, remote, true, cluster) == nil && remote.GetLabels()[resource.LabelKeyOwnerName] != "" {
+			return nil
+		}
+		return err
+	}
+	SetRemoteOwner(remote, to, cluster)
+	return resource.RemoteError(kube.Update(ctx, remote), errHandOver)
+}
+
+// Transfer creates the local claim with the supplied namespace and name that
+// the ownership of the supplied local claim is transferred to. The new claim is
+// a copy of the local claim that is synced to the remote claim with the
+// supplied key, so its connection secret is propagated to its own namespace.
+// It's not an error if the new claim already exists and is synced to the
+// remote claim, e.g. because a previous attempt created it.
+func Transfer(ctx context.Context, kube client.Client, local *claim.Unstructured, to, remote types.NamespacedName) error {
+	target := claim.New(claim.WithGroupVersionKind(local.GetObjectKind().GroupVersionKind()))
+	err := kube.Get(ctx, to, target)
+	if err == nil {
+		if target.GetAnnotations()[resource.AnnotationKeyRemoteClaim] != remote.String() {
+			return errors.Errorf(errFmtTransferTaken, to, remote)
+		}
+		return nil
+	}
+	if !kerrors.IsNotFound(err) {
+		return resource.LocalError(err, errGetTransferTarget)
+	}
+	target.SetNamespace(to.Namespace)
+	target.SetName(to.Name)
+	target.SetLabels(local.GetLabels())
+	a := map[string]string{}
+	for k, v := range local.GetAnnotations() {
+		if k == resource.AnnotationKeyTransferTo || k == resource.AnnotationKeyDeletionRequested {
+			continue
+		}
+		a[k] = v
+	}
+	a[resource.AnnotationKeyRemoteClaim] = remote.String()
+	target.SetAnnotations(a)
+	spec, err := fieldpath.Pave(local.GetUnstructured().UnstructuredContent()).GetValue("spec")
+	if runtimeresource.Ignore(fieldpath.IsNotFound, err) != nil {
+		return errors.Wrap(err, errCopyTransferredSpec)
+	}
+	if err == nil {
+		if err := fieldpath.Pave(target.GetUnstructured().UnstructuredContent()).SetValue("spec", spec); err != nil {
+			return errors.Wrap(err, errCopyTransferredSpec)
+		}
+	}
+	return resource.LocalError(kube.Create(ctx, target), errCreateTransferTarget)
+}
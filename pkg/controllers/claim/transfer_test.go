@@ -0,0 +1,291 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package claim
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/claim"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/crossplane/agent/pkg/resource"
+)
+
+func TestRemoteKeyOf(t *testing.T) {
+	cases := map[string]struct {
+		reason      string
+		annotations map[string]string
+		want        types.NamespacedName
+	}{
+		"Mapped": {
+			reason: "The key should be mapped if the claim has no remote claim annotation",
+			want:   types.NamespacedName{Namespace: "remote", Name: "cool.old"},
+		},
+		"Annotated": {
+			reason:      "The key in the remote claim annotation should be used if the claim has one",
+			annotations: map[string]string{resource.AnnotationKeyRemoteClaim: "remote/cool-older"},
+			want:        types.NamespacedName{Namespace: "remote", Name: "cool-older"},
+		},
+		"InvalidAnnotation": {
+			reason:      "The key should be mapped if the remote claim annotation isn't in namespace/name format",
+			annotations: map[string]string{resource.AnnotationKeyRemoteClaim: "cool-older"},
+			want:        types.NamespacedName{Namespace: "remote", Name: "cool.old"},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := claim.New()
+			c.SetNamespace("cool")
+			c.SetName("old")
+			c.SetAnnotations(tc.annotations)
+			got := RemoteKeyOf(NewNamespaceKeyMapper("remote"), c)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\nReason: %s\nRemoteKeyOf(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestTransferTarget(t *testing.T) {
+	type want struct {
+		to  types.NamespacedName
+		ok  bool
+		err error
+	}
+	cases := map[string]struct {
+		reason string
+		to     *string
+		want   want
+	}{
+		"NotTransferred": {
+			reason: "A claim without the transfer annotation isn't transferred",
+		},
+		"Invalid": {
+			reason: "An error should be returned if the target isn't in namespace/name format",
+			to:     func() *string { s := "new"; return &s }(),
+			want:   want{err: errors.Errorf(errFmtTransferTarget, "new")},
+		},
+		"Self": {
+			reason: "An error should be returned if the claim is transferred to itself",
+			to:     func() *string { s := "cool/old"; return &s }(),
+			want:   want{err: errors.New(errTransferSelf)},
+		},
+		"Transferred": {
+			reason: "The target should be returned if it's valid",
+			to:     func() *string { s := "other/new"; return &s }(),
+			want:   want{to: types.NamespacedName{Namespace: "other", Name: "new"}, ok: true},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := claim.New()
+			c.SetNamespace("cool")
+			c.SetName("old")
+			if tc.to != nil {
+				c.SetAnnotations(map[string]string{resource.AnnotationKeyTransferTo: *tc.to})
+			}
+			to, ok, err := TransferTarget(c)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\nTransferTarget(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.ok, ok); diff != "" {
+				t.Errorf("\nReason: %s\nTransferTarget(...): -want ok, +got ok:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.to, to); diff != "" {
+				t.Errorf("\nReason: %s\nTransferTarget(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestCheckRemoteOwner(t *testing.T) {
+	owned := func(labels map[string]string) *metav1.ObjectMeta {
+		return &metav1.ObjectMeta{Namespace: "remote", Name: "db", Labels: labels}
+	}
+	cases := map[string]struct {
+		reason    string
+		annotated bool
+		remote    *metav1.ObjectMeta
+		exists    bool
+		want      error
+	}{
+		"Owned": {
+			reason: "A remote claim that records the claim as its owner should be synced by it",
+			remote: owned(map[string]string{resource.LabelKeyOwnerNamespace: "cool", resource.LabelKeyOwnerName: "db", resource.LabelKeyCluster: "dev"}),
+			exists: true,
+		},
+		"OtherClaim": {
+			reason:    "A remote claim that records another claim as its owner should not be synced by the claim",
+			annotated: true,
+			remote:    owned(map[string]string{resource.LabelKeyOwnerNamespace: "victim", resource.LabelKeyOwnerName: "db"}),
+			exists:    true,
+			want:      errors.Errorf(errFmtRemoteOtherClaim, "remote/db", "victim", "db"),
+		},
+		"OtherCluster": {
+			reason: "A remote claim of another cluster should not be synced by the claim",
+			remote: owned(map[string]string{resource.LabelKeyOwnerNamespace: "cool", resource.LabelKeyOwnerName: "db", resource.LabelKeyCluster: "prod"}),
+			exists: true,
+			want:   errors.Errorf(errFmtRemoteOtherCluster, "remote/db", "prod"),
+		},
+		"UnrecordedMapped": {
+			reason: "A remote claim that doesn't record its owner should be synced by the claim that maps to it",
+			remote: owned(nil),
+			exists: true,
+		},
+		"UnrecordedAnnotated": {
+			reason:    "A remote claim that doesn't record its owner should not be synced by a claim that points at it",
+			annotated: true,
+			remote:    owned(nil),
+			exists:    true,
+			want:      errors.Errorf(errFmtRemoteUnrecorded, "remote/db"),
+		},
+		"MissingMapped": {
+			reason: "A remote claim that doesn't exist should be created for the claim that maps to it",
+			remote: &metav1.ObjectMeta{},
+		},
+		"MissingAnnotated": {
+			reason:    "A remote claim that doesn't exist should not be created for a claim that points at it",
+			annotated: true,
+			remote:    &metav1.ObjectMeta{},
+			want:      errors.Errorf(errFmtRemoteNotFound, "remote/db", resource.AnnotationKeyRemoteClaim),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			local := &metav1.ObjectMeta{Namespace: "cool", Name: "db"}
+			if tc.annotated {
+				local.Annotations = map[string]string{resource.AnnotationKeyRemoteClaim: "remote/db"}
+			}
+			err := CheckRemoteOwner(local, tc.remote, tc.exists, "dev")
+			if diff := cmp.Diff(tc.want, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\nCheckRemoteOwner(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRemoteOwnedBy(t *testing.T) {
+	local := &metav1.ObjectMeta{Namespace: "a", Name: "b-c"}
+	remote := func(labels map[string]string) *claim.Unstructured {
+		c := claim.New()
+		c.SetNamespace("a")
+		c.SetName("b-c")
+		c.SetLabels(labels)
+		return c
+	}
+	cases := map[string]struct {
+		reason  string
+		current runtime.Object
+		want    error
+	}{
+		"Owned": {
+			reason:  "A remote claim that records the claim as its owner should be applied",
+			current: remote(map[string]string{resource.LabelKeyOwnerNamespace: "a", resource.LabelKeyOwnerName: "b-c"}),
+		},
+		"CreatedByOtherClaim": {
+			reason:  "A remote claim that another claim created since it was read should not be applied",
+			current: remote(map[string]string{resource.LabelKeyOwnerNamespace: "a-b", resource.LabelKeyOwnerName: "c"}),
+			want:    errors.Errorf(errFmtRemoteOtherClaim, "a/b-c", "a-b", "c"),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := RemoteOwnedBy(local, "")(context.Background(), tc.current, remote(nil))
+			if diff := cmp.Diff(tc.want, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\nRemoteOwnedBy(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestTransfer(t *testing.T) {
+	to := types.NamespacedName{Namespace: "other", Name: "new"}
+	remote := types.NamespacedName{Namespace: "cool", Name: "old"}
+	local := func() *claim.Unstructured {
+		c := claim.New(claim.WithGroupVersionKind(gvk))
+		c.SetNamespace("cool")
+		c.SetName("old")
+		c.SetLabels(map[string]string{"team": "cool"})
+		c.SetAnnotations(map[string]string{resource.AnnotationKeyTransferTo: to.String(), "note": "hi"})
+		_ = unstructured.SetNestedField(c.Object, "large", "spec", "size")
+		return c
+	}
+	existing := func(annotations map[string]string) test.MockGetFn {
+		return func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+			obj.(metav1.Object).SetAnnotations(annotations)
+			return nil
+		}
+	}
+
+	cases := map[string]struct {
+		reason string
+		kube   client.Client
+		want   error
+	}{
+		"GetFailed": {
+			reason: "An error should be returned if the target cannot be retrieved",
+			kube:   &test.MockClient{MockGet: test.NewMockGetFn(errBoom)},
+			want:   resource.LocalError(errBoom, errGetTransferTarget),
+		},
+		"AlreadyTransferred": {
+			reason: "It should not be an error if the target already syncs the remote claim",
+			kube:   &test.MockClient{MockGet: existing(map[string]string{resource.AnnotationKeyRemoteClaim: remote.String()})},
+		},
+		"Taken": {
+			reason: "An error should be returned if the target exists and doesn't sync the remote claim",
+			kube:   &test.MockClient{MockGet: existing(nil)},
+			want:   errors.Errorf(errFmtTransferTaken, to, remote),
+		},
+		"Created": {
+			reason: "The target should be created as a copy of the claim that syncs the remote claim",
+			kube: &test.MockClient{
+				MockGet: test.NewMockGetFn(kerrors.NewNotFound(schema.GroupResource{}, to.Name)),
+				MockCreate: func(_ context.Context, obj runtime.Object, _ ...client.CreateOption) error {
+					want := claim.New(claim.WithGroupVersionKind(gvk))
+					want.SetNamespace(to.Namespace)
+					want.SetName(to.Name)
+					want.SetLabels(map[string]string{"team": "cool"})
+					want.SetAnnotations(map[string]string{resource.AnnotationKeyRemoteClaim: remote.String(), "note": "hi"})
+					_ = unstructured.SetNestedField(want.Object, "large", "spec", "size")
+					if diff := cmp.Diff(want, obj); diff != "" {
+						t.Errorf("\nReason: %s\nCreate(...): -want, +got:\n%s", "The target should be a copy of the claim", diff)
+					}
+					return nil
+				},
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := Transfer(context.Background(), tc.kube, local(), to, remote)
+			if diff := cmp.Diff(tc.want, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\nTransfer(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -20,7 +20,6 @@ import (
 	"context"
 	"time"
 
-	"github.com/pkg/errors"
 	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -33,6 +32,7 @@ import (
 	"github.com/crossplane/crossplane-runtime/pkg/logging"
 	runtimeresource "github.com/crossplane/crossplane-runtime/pkg/resource"
 
+	"github.com/crossplane/agent/pkg/metrics"
 	"github.com/crossplane/agent/pkg/resource"
 )
 
@@ -43,8 +43,6 @@ const (
 
 	maxConcurrency = 5
 
-	local       = "local cluster: "
-	remote      = "remote cluster: "
 	errGetCRD   = "cannot get custom resource definition"
 	errApplyCRD = "cannot apply custom resource definition"
 )
@@ -62,20 +60,30 @@ const (
 // Setup adds a controller that watches CustomResourceDefinitions in the remote
 // cluster and replicates them in the local cluster.
 func Setup(mgr manager.Manager, localClient client.Client, logger logging.Logger) error {
+	return SetupFor(mgr, localClient, logger)
+}
+
+// SetupFor is like Setup but replicates the CustomResourceDefinitions with
+// the given names as well.
+func SetupFor(mgr manager.Manager, localClient client.Client, logger logging.Logger, names ...string) error {
 	name := "CustomResourceDefinitions"
 	ca := runtimeresource.ClientApplicator{
 		Client:     localClient,
-		Applicator: runtimeresource.NewAPIUpdatingApplicator(localClient),
+		Applicator: resource.NewCRDApplicator(localClient),
 	}
 	r := NewReconciler(mgr, ca, logger)
+	nn := []types.NamespacedName{
+		{Name: "compositeresourcedefinitions.apiextensions.crossplane.io"},
+		{Name: "compositions.apiextensions.crossplane.io"},
+	}
+	for _, n := range names {
+		nn = append(nn, types.NamespacedName{Name: n})
+	}
 	return ctrl.NewControllerManagedBy(mgr).
 		Named(name).
 		For(&v1beta1.CustomResourceDefinition{}).
 		WithOptions(kcontroller.Options{MaxConcurrentReconciles: maxConcurrency}).
-		WithEventFilter(resource.NewNameFilter([]types.NamespacedName{
-			{Name: "compositeresourcedefinitions.apiextensions.crossplane.io"},
-			{Name: "compositions.apiextensions.crossplane.io"},
-		})).
+		WithEventFilter(resource.NewNameFilter(nn)).
 		Complete(r)
 }
 
@@ -98,6 +106,8 @@ func NewReconciler(mgr manager.Manager, localClientApplicator runtimeresource.Cl
 // the existing ones in the local cluster. It's advised to use this together with
 // an EventFilter to filter only the CRDs you'd like to be synced.
 type Reconciler struct {
+	resource.ManagerContext
+
 	mgr    ctrl.Manager
 	local  runtimeresource.ClientApplicator
 	remote client.Client
@@ -108,17 +118,35 @@ type Reconciler struct {
 
 // Reconcile fetches the CRD from remote cluster and applies it in the local cluster.
 func (r *Reconciler) Reconcile(req reconcile.Request) (reconcile.Result, error) {
-	log := r.log.WithValues("request", req)
+	return r.ReconcileContext(r.Context(), req)
+}
+
+// ReconcileContext is Reconcile with the supplied context, which the context
+// of the reconcile is derived from. The reconcile is cancelled once the
+// supplied context is.
+func (r *Reconciler) ReconcileContext(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	result, err := r.reconcile(ctx, req)
+	if err != nil {
+		metrics.SyncErrors.WithLabelValues(string(resource.ClassifyError(err))).Inc()
+	}
+	return result, err
+}
+
+func (r *Reconciler) reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	id := resource.NewSyncID()
+	log := r.log.WithValues("request", req, "sync-id", id)
 	log.Debug("Reconciling")
 
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	ctx, cancel := context.WithTimeout(resource.WithSyncID(ctx, id), timeout)
 	defer cancel()
 
 	remoteCRD := &v1beta1.CustomResourceDefinition{}
 	if err := r.remote.Get(ctx, req.NamespacedName, remoteCRD); err != nil {
-		return reconcile.Result{RequeueAfter: shortWait}, errors.Wrap(err, remote+errGetCRD)
+		return reconcile.Result{RequeueAfter: shortWait}, resource.RemoteError(err, errGetCRD)
 	}
 	// TODO(muvaf): Set condition on local CRD to tell when is the last time
 	// it's been synced.
-	return reconcile.Result{RequeueAfter: longWait}, errors.Wrap(r.local.Apply(ctx, resource.SanitizedDeepCopyObject(remoteCRD)), local+errApplyCRD)
+	localCRD := resource.SanitizedDeepCopyObject(remoteCRD)
+	resource.SetSyncID(ctx, localCRD)
+	return reconcile.Result{RequeueAfter: longWait}, resource.LocalError(r.local.Apply(ctx, localCRD, resource.KeepStoredVersions()), errApplyCRD)
 }
@@ -33,6 +33,8 @@ import (
 	"github.com/crossplane/crossplane-runtime/pkg/logging"
 	"github.com/crossplane/crossplane-runtime/pkg/resource/fake"
 	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	agentresource "github.com/crossplane/agent/pkg/resource"
 )
 
 var (
@@ -78,7 +80,7 @@ func TestReconcile(t *testing.T) {
 			},
 			want: want{
 				result: reconcile.Result{RequeueAfter: shortWait},
-				err:    errors.Wrap(errBoom, remote+errGetCRD),
+				err:    agentresource.RemoteError(errBoom, errGetCRD),
 			},
 		},
 		"ApplyFailed": {
@@ -95,7 +97,7 @@ func TestReconcile(t *testing.T) {
 			},
 			want: want{
 				result: reconcile.Result{RequeueAfter: longWait},
-				err:    errors.Wrap(errBoom, local+errApplyCRD),
+				err:    agentresource.LocalError(errBoom, errApplyCRD),
 			},
 		},
 	}
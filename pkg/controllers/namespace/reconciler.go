@@ -0,0 +1,328 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package namespace cleans up the remote claims of the local namespaces that
+// are deleted.
+package namespace
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	kunstructured "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane-runtime/pkg/meta"
+	runtimeresource "github.com/crossplane/crossplane-runtime/pkg/resource"
+	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
+
+	"github.com/crossplane/agent/pkg/controllers/claim"
+	"github.com/crossplane/agent/pkg/emergency"
+	"github.com/crossplane/agent/pkg/maintenance"
+	"github.com/crossplane/agent/pkg/metrics"
+	"github.com/crossplane/agent/pkg/resource"
+	"github.com/crossplane/agent/pkg/shard"
+)
+
+const (
+	timeout   = 2 * time.Minute
+	longWait  = 1 * time.Minute
+	shortWait = 30 * time.Second
+	tinyWait  = 5 * time.Second
+
+	maxDeletions = 10
+
+	finalizer = "agent.crossplane.io/namespace-cleanup"
+
+	errGetNamespace    = "cannot get namespace"
+	errListXRDs        = "cannot list composite resource definitions"
+	errAddFinalizer    = "cannot add finalizer to namespace"
+	errRemoveFinalizer = "cannot remove finalizer from namespace"
+	errEmergencyStop   = "cannot check emergency stop"
+	errMaintenance     = "cannot check maintenance mode"
+	errFmtListClaims   = "cannot list claims of kind %s"
+	errFmtGetRemote    = "cannot get remote claim %s"
+	errFmtDeleteRemote = "cannot delete remote claim %s"
+)
+
+// Setup adds a controller that holds the deleted namespaces of the local
+// cluster until the remote counterparts of their claims are deleted, which are
+// deleted all at once instead of one claim at a time.
+func Setup(mgr manager.Manager, remoteClient client.Client, logger logging.Logger, opts ...ReconcilerOption) error {
+	name := "NamespaceCleanup"
+	r := NewReconciler(mgr, remoteClient, append([]ReconcilerOption{WithLogger(logger)}, opts...)...)
+	return ctrl.NewControllerManagedBy(mgr).
+		Named(name).
+		For(&corev1.Namespace{}).
+		Complete(r)
+}
+
+// ReconcilerOption is used to configure *Reconciler.
+type ReconcilerOption func(*Reconciler)
+
+// WithLogger specifies how the Reconciler should log messages.
+func WithLogger(l logging.Logger) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.log = l
+	}
+}
+
+// WithFinalizer specifies how the Reconciler should add and remove finalizers.
+func WithFinalizer(f runtimeresource.Finalizer) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.finalizer = f
+	}
+}
+
+// WithRemoteKeyMapper specifies how the Reconciler should find the remote
+// counterparts of the local claims. It should be the same as the one of the
+// claim reconcilers.
+func WithRemoteKeyMapper(m claim.KeyMapper) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.mapper = m
+	}
+}
+
+// WithDeletionGracePeriod specifies the deletion grace period of the claims,
+// see claim.WithDeletionGracePeriod. The remote counterparts of the claims are
+// deleted only once their grace period passes.
+func WithDeletionGracePeriod(d time.Duration) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.deletionGrace = d
+	}
+}
+
+// WithEmergencyStop specifies the Switch that the Reconciler should consult
+// before deleting remote claims.
+func WithEmergencyStop(s *emergency.Switch) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.emergency = s
+	}
+}
+
+// WithMaintenance specifies the Mode that the Reconciler should consult before
+// deleting remote claims.
+func WithMaintenance(m *maintenance.Mode) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.frozen = m
+	}
+}
+
+// WithShard specifies the shard of the claims that the agent syncs. Only the
+// remote counterparts of the claims of the shard are deleted, and the
+// namespaces are held with a finalizer of the shard so that the agents of the
+// other shards don't let them go before their claims are cleaned up.
+func WithShard(s *shard.Shard) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.shard = s
+		r.finalizer = runtimeresource.NewAPIFinalizer(r.local, finalizer+"-"+s.Name)
+	}
+}
+
+// NewReconciler returns a new *Reconciler.
+func NewReconciler(mgr manager.Manager, remoteClient client.Client, opts ...ReconcilerOption) *Reconciler {
+	r := &Reconciler{
+		local:     mgr.GetClient(),
+		remote:    remoteClient,
+		mapper:    claim.NewIdentityKeyMapper(),
+		finalizer: runtimeresource.NewAPIFinalizer(mgr.GetClient(), finalizer),
+		emergency: emergency.NewSwitch(),
+		frozen:    maintenance.NewMode(),
+		log:       logging.NewNopLogger(),
+	}
+	for _, f := range opts {
+		f(r)
+	}
+	return r
+}
+
+// Reconciler adds a finalizer to the local namespaces that have claims. Once a
+// namespace is deleted, it deletes the remote counterparts of all its claims
+// in a batch and removes the finalizer only when they're all gone, so that the
+// namespace isn't finalized before its remote claims are cleaned up.
+type Reconciler struct {
+	resource.ManagerContext
+
+	local  client.Client
+	remote client.Client
+
+	mapper        claim.KeyMapper
+	finalizer     runtimeresource.Finalizer
+	emergency     *emergency.Switch
+	frozen        *maintenance.Mode
+	deletionGrace time.Duration
+	shard         *shard.Shard
+
+	log logging.Logger
+}
+
+// Reconcile cleans up the remote claims of the given namespace if it's deleted.
+func (r *Reconciler) Reconcile(req reconcile.Request) (reconcile.Result, error) {
+	return r.ReconcileContext(r.Context(), req)
+}
+
+// ReconcileContext is Reconcile with the supplied context, which the context
+// of the reconcile is derived from. The reconcile is cancelled once the
+// supplied context is.
+func (r *Reconciler) ReconcileContext(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	result, err := r.reconcile(ctx, req)
+	if err != nil {
+		metrics.SyncErrors.WithLabelValues(string(resource.ClassifyError(err))).Inc()
+	}
+	return result, err
+}
+
+func (r *Reconciler) reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) { // nolint:gocyclo
+	id := resource.NewSyncID()
+	log := r.log.WithValues("request", req, "sync-id", id)
+	log.Debug("Reconciling")
+
+	ctx, cancel := context.WithTimeout(resource.WithSyncID(ctx, id), timeout)
+	defer cancel()
+
+	ns := &corev1.Namespace{}
+	if err := r.local.Get(ctx, req.NamespacedName, ns); err != nil {
+		if kerrors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(err, errGetNamespace)
+	}
+	claims, err := r.listClaims(ctx, ns.GetName())
+	if err != nil {
+		return reconcile.Result{RequeueAfter: shortWait}, err
+	}
+
+	if !meta.WasDeleted(ns) {
+		// Only the namespaces with claims are held, so that the namespaces
+		// aren't stuck if the agent is removed from the cluster.
+		if len(claims) == 0 {
+			return reconcile.Result{RequeueAfter: longWait}, resource.LocalError(r.finalizer.RemoveFinalizer(ctx, ns), errRemoveFinalizer)
+		}
+		return reconcile.Result{RequeueAfter: longWait}, resource.LocalError(r.finalizer.AddFinalizer(ctx, ns), errAddFinalizer)
+	}
+
+	halted, err := r.emergency.Engaged(ctx)
+	if err != nil {
+		return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(err, errEmergencyStop)
+	}
+	frozen, err := r.frozen.Enabled(ctx)
+	if err != nil {
+		return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(err, errMaintenance)
+	}
+
+	// The local claims are deleted by the namespace controller. Their remote
+	// counterparts are deleted here once they're due, and the claims are let
+	// go by the claim reconcilers once their remote counterparts are gone.
+	var pending int
+	var due []*kunstructured.Unstructured
+	for _, lc := range claims {
+		rc := &kunstructured.Unstructured{}
+		rc.SetGroupVersionKind(lc.GroupVersionKind())
+		nn := claim.RemoteKeyOf(r.mapper, lc)
+		rc.SetNamespace(nn.Namespace)
+		rc.SetName(nn.Name)
+		if err := r.remote.Get(ctx, nn, rc); err != nil {
+			if kerrors.IsNotFound(err) {
+				continue
+			}
+			return reconcile.Result{RequeueAfter: shortWait}, resource.RemoteError(err, fmt.Sprintf(errFmtGetRemote, nn))
+		}
+		pending++
+		if halted || frozen || meta.WasDeleted(rc) || !meta.WasDeleted(lc) || claim.DeletionCancelled(lc) || claim.DeletionRemaining(lc, r.deletionGrace) > 0 {
+			continue
+		}
+		due = append(due, rc)
+	}
+	if err := r.deleteAll(ctx, due); err != nil {
+		return reconcile.Result{RequeueAfter: shortWait}, err
+	}
+	if pending > 0 {
+		log.Debug("Waiting for remote claims to be deleted", "pending", pending, "deleted", len(due))
+		return reconcile.Result{RequeueAfter: tinyWait}, nil
+	}
+	return reconcile.Result{}, resource.LocalError(r.finalizer.RemoveFinalizer(ctx, ns), errRemoveFinalizer)
+}
+
+// listClaims returns the local claims of all kinds in the given namespace, or
+// only the ones of the shard of the agent if it has one.
+func (r *Reconciler) listClaims(ctx context.Context, namespace string) ([]*kunstructured.Unstructured, error) {
+	xrds := &v1alpha1.CompositeResourceDefinitionList{}
+	if err := r.local.List(ctx, xrds); err != nil {
+		return nil, resource.LocalError(err, errListXRDs)
+	}
+	var claims []*kunstructured.Unstructured
+	for _, xrd := range xrds.Items {
+		if !xrd.OffersClaim() {
+			continue
+		}
+		gvk := xrd.GetClaimGroupVersionKind()
+		if r.shard != nil && !r.shard.OwnsKind(gvk.GroupKind()) {
+			continue
+		}
+		l := &kunstructured.UnstructuredList{}
+		l.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		if err := r.local.List(ctx, l, client.InNamespace(namespace)); err != nil {
+			return nil, resource.LocalError(err, fmt.Sprintf(errFmtListClaims, gvk.Kind))
+		}
+		for i := range l.Items {
+			if r.shard != nil && !r.shard.Owns(&l.Items[i], gvk.GroupKind()) {
+				continue
+			}
+			l.Items[i].SetGroupVersionKind(gvk)
+			claims = append(claims, &l.Items[i])
+		}
+	}
+	return claims, nil
+}
+
+// deleteAll deletes the supplied remote claims concurrently and returns the
+// first error it encounters.
+func (r *Reconciler) deleteAll(ctx context.Context, objs []*kunstructured.Unstructured) error {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	sem := make(chan struct{}, maxDeletions)
+	for _, o := range objs {
+		o := o
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			err := r.remote.Delete(ctx, o)
+			if runtimeresource.IgnoreNotFound(err) == nil {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if firstErr == nil {
+				firstErr = resource.RemoteError(err, fmt.Sprintf(errFmtDeleteRemote, types.NamespacedName{Namespace: o.GetNamespace(), Name: o.GetName()}))
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
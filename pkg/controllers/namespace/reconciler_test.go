@@ -0,0 +1,276 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespace
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	crds "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kunstructured "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	runtimeresource "github.com/crossplane/crossplane-runtime/pkg/resource"
+	"github.com/crossplane/crossplane-runtime/pkg/resource/fake"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
+
+	"github.com/crossplane/agent/pkg/emergency"
+	"github.com/crossplane/agent/pkg/maintenance"
+	"github.com/crossplane/agent/pkg/resource"
+	"github.com/crossplane/agent/pkg/shard"
+)
+
+var (
+	errBoom = errors.New("boom")
+	now     = metav1.Now()
+)
+
+func namespace(deleted bool) test.MockGetFn {
+	return func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "cool-ns"}}
+		if deleted {
+			ns.SetDeletionTimestamp(&now)
+		}
+		ns.DeepCopyInto(obj.(*corev1.Namespace))
+		return nil
+	}
+}
+
+// claims returns a MockListFn that lists a single XRD that offers a claim and
+// the supplied claims of its kind.
+func claims(c ...kunstructured.Unstructured) test.MockListFn {
+	return func(_ context.Context, obj runtime.Object, _ ...client.ListOption) error {
+		switch l := obj.(type) {
+		case *v1alpha1.CompositeResourceDefinitionList:
+			l.Items = []v1alpha1.CompositeResourceDefinition{{Spec: v1alpha1.CompositeResourceDefinitionSpec{
+				CRDSpecTemplate: v1alpha1.CRDSpecTemplate{Group: "example.org", Version: "v1alpha1"},
+				ClaimNames:      &crds.CustomResourceDefinitionNames{Kind: "Database"},
+			}}}
+		case *kunstructured.UnstructuredList:
+			l.Items = c
+		}
+		return nil
+	}
+}
+
+func deletedClaim(deletedAt metav1.Time) kunstructured.Unstructured {
+	c := kunstructured.Unstructured{}
+	c.SetNamespace("cool-ns")
+	c.SetName("cool-db")
+	c.SetDeletionTimestamp(&deletedAt)
+	return c
+}
+
+func TestReconcile(t *testing.T) {
+	var (
+		added, removed bool
+		deleted        int
+	)
+	finalizer := runtimeresource.FinalizerFns{
+		AddFinalizerFn:    func(_ context.Context, _ runtimeresource.Object) error { added = true; return nil },
+		RemoveFinalizerFn: func(_ context.Context, _ runtimeresource.Object) error { removed = true; return nil },
+	}
+	remoteDelete := func(err error) test.MockDeleteFn {
+		return func(_ context.Context, _ runtime.Object, _ ...client.DeleteOption) error {
+			deleted++
+			return err
+		}
+	}
+
+	type args struct {
+		local  client.Client
+		remote client.Client
+		opts   []ReconcilerOption
+	}
+	type want struct {
+		result  reconcile.Result
+		err     error
+		added   bool
+		removed bool
+		deleted int
+	}
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"GetNamespaceFailed": {
+			reason: "An error should be returned if the namespace cannot be retrieved",
+			args: args{
+				local: &test.MockClient{MockGet: test.NewMockGetFn(errBoom)},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: shortWait},
+				err:    resource.LocalError(errBoom, errGetNamespace),
+			},
+		},
+		"NamespaceGone": {
+			reason: "No error should be returned if the namespace is gone",
+			args: args{
+				local: &test.MockClient{MockGet: test.NewMockGetFn(kerrors.NewNotFound(schema.GroupResource{}, ""))},
+			},
+		},
+		"ListClaimsFailed": {
+			reason: "An error should be returned if the claims cannot be listed",
+			args: args{
+				local: &test.MockClient{MockGet: namespace(false), MockList: func(_ context.Context, obj runtime.Object, _ ...client.ListOption) error {
+					if _, ok := obj.(*kunstructured.UnstructuredList); ok {
+						return errBoom
+					}
+					return claims()(context.Background(), obj)
+				}},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: shortWait},
+				err:    resource.LocalError(errBoom, fmt.Sprintf(errFmtListClaims, "Database")),
+			},
+		},
+		"HoldNamespaceWithClaims": {
+			reason: "The finalizer should be added to a namespace with claims",
+			args: args{
+				local: &test.MockClient{MockGet: namespace(false), MockList: claims(kunstructured.Unstructured{})},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: longWait},
+				added:  true,
+			},
+		},
+		"ReleaseNamespaceWithoutClaims": {
+			reason: "The finalizer should be removed from a namespace without claims",
+			args: args{
+				local: &test.MockClient{MockGet: namespace(false), MockList: claims()},
+			},
+			want: want{
+				result:  reconcile.Result{RequeueAfter: longWait},
+				removed: true,
+			},
+		},
+		"DeleteRemoteClaims": {
+			reason: "The remote counterparts of the deleted claims should be deleted and the namespace held until they're gone",
+			args: args{
+				local:  &test.MockClient{MockGet: namespace(true), MockList: claims(deletedClaim(now))},
+				remote: &test.MockClient{MockGet: test.NewMockGetFn(nil), MockDelete: remoteDelete(nil)},
+			},
+			want: want{
+				result:  reconcile.Result{RequeueAfter: tinyWait},
+				deleted: 1,
+			},
+		},
+		"DeleteRemoteClaimFailed": {
+			reason: "An error should be returned if a remote claim cannot be deleted",
+			args: args{
+				local:  &test.MockClient{MockGet: namespace(true), MockList: claims(deletedClaim(now))},
+				remote: &test.MockClient{MockGet: test.NewMockGetFn(nil), MockDelete: remoteDelete(errBoom)},
+			},
+			want: want{
+				result:  reconcile.Result{RequeueAfter: shortWait},
+				err:     resource.RemoteError(errBoom, fmt.Sprintf(errFmtDeleteRemote, "cool-ns/cool-db")),
+				deleted: 1,
+			},
+		},
+		"DeletionGracePeriodRunning": {
+			reason: "The remote claims should not be deleted while their deletion grace period is running",
+			args: args{
+				local:  &test.MockClient{MockGet: namespace(true), MockList: claims(deletedClaim(now))},
+				remote: &test.MockClient{MockGet: test.NewMockGetFn(nil), MockDelete: remoteDelete(nil)},
+				opts:   []ReconcilerOption{WithDeletionGracePeriod(time.Hour)},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: tinyWait},
+			},
+		},
+		"EmergencyStopEngaged": {
+			reason: "The remote claims should not be deleted while the emergency stop is engaged",
+			args: args{
+				local:  &test.MockClient{MockGet: namespace(true), MockList: claims(deletedClaim(now))},
+				remote: &test.MockClient{MockGet: test.NewMockGetFn(nil), MockDelete: remoteDelete(nil)},
+				opts:   []ReconcilerOption{WithEmergencyStop(emergency.NewSwitch(emergency.WithEngaged(true)))},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: tinyWait},
+			},
+		},
+		"MaintenanceEnabled": {
+			reason: "The remote claims should not be deleted while the local cluster is under maintenance",
+			args: args{
+				local:  &test.MockClient{MockGet: namespace(true), MockList: claims(deletedClaim(now))},
+				remote: &test.MockClient{MockGet: test.NewMockGetFn(nil), MockDelete: remoteDelete(nil)},
+				opts:   []ReconcilerOption{WithMaintenance(maintenance.NewMode(maintenance.WithEnabled(true)))},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: tinyWait},
+			},
+		},
+		"ClaimsOfOtherShard": {
+			reason: "The remote claims of the claims of other shards should be left to their agents",
+			args: args{
+				local:  &test.MockClient{MockGet: namespace(true), MockList: claims(deletedClaim(now))},
+				remote: &test.MockClient{MockGet: test.NewMockGetFn(nil), MockDelete: remoteDelete(nil)},
+				opts:   []ReconcilerOption{WithShard(&shard.Shard{Name: "buckets", Kinds: []schema.GroupKind{{Group: "example.org", Kind: "Bucket"}}})},
+			},
+			want: want{
+				result:  reconcile.Result{},
+				removed: true,
+			},
+		},
+		"RemoteClaimsGone": {
+			reason: "The finalizer should be removed once all remote claims are gone",
+			args: args{
+				local:  &test.MockClient{MockGet: namespace(true), MockList: claims(deletedClaim(now))},
+				remote: &test.MockClient{MockGet: test.NewMockGetFn(kerrors.NewNotFound(schema.GroupResource{}, ""))},
+			},
+			want: want{
+				result:  reconcile.Result{},
+				removed: true,
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			added, removed, deleted = false, false, 0
+			r := NewReconciler(&fake.Manager{Client: tc.args.local}, tc.args.remote, append(tc.args.opts, WithFinalizer(finalizer))...)
+			got, err := r.Reconcile(reconcile.Request{})
+
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\nr.Reconcile(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.result, got); diff != "" {
+				t.Errorf("\nReason: %s\nr.Reconcile(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.added, added); diff != "" {
+				t.Errorf("\nReason: %s\nr.Reconcile(...): -want finalizer added, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.removed, removed); diff != "" {
+				t.Errorf("\nReason: %s\nr.Reconcile(...): -want finalizer removed, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.deleted, deleted); diff != "" {
+				t.Errorf("\nReason: %s\nr.Reconcile(...): -want remote deletions, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -20,12 +20,14 @@ import (
 	"context"
 
 	"github.com/pkg/errors"
-
 	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
 
+	"github.com/crossplane/agent/pkg/override"
 	"github.com/crossplane/agent/pkg/resource"
 )
 
@@ -68,9 +70,129 @@ type APIRemoteCRDFetcher struct {
 // Fetch returns the sanitized form of the claim CRD of given CompositeResourceDefinition
 // by fetching it from remote cluster and stripping out cluster-specific metadata.
 func (r *APIRemoteCRDFetcher) Fetch(ctx context.Context, xrd v1alpha1.CompositeResourceDefinition) (*v1beta1.CustomResourceDefinition, error) {
+	// An XRD that doesn't offer claims has no claim CRD.
+	if !xrd.OffersClaim() {
+		return nil, errors.Wrap(kerrors.NewNotFound(v1beta1.Resource("customresourcedefinitions"), xrd.GetName()), errGetCRD)
+	}
 	remote := &v1beta1.CustomResourceDefinition{}
 	if err := r.client.Get(ctx, GetClaimCRDName(xrd), remote); err != nil {
 		return nil, errors.Wrap(err, errGetCRD)
 	}
 	return resource.SanitizedDeepCopyObject(remote).(*v1beta1.CustomResourceDefinition), nil
 }
+
+// NewNopOverrider returns a NopOverrider.
+func NewNopOverrider() NopOverrider {
+	return NopOverrider{}
+}
+
+// NopOverrider does nothing.
+type NopOverrider struct{}
+
+// Override does nothing.
+func (n NopOverrider) Override(_ context.Context, _ *v1beta1.CustomResourceDefinition) error {
+	return nil
+}
+
+// OverrideFn is used to provide a single function instead of a full object to
+// satisfy CRDOverrider interface.
+type OverrideFn func(ctx context.Context, crd *v1beta1.CustomResourceDefinition) error
+
+// Override calls OverrideFn it belongs to.
+func (fn OverrideFn) Override(ctx context.Context, crd *v1beta1.CustomResourceDefinition) error {
+	return fn(ctx, crd)
+}
+
+// NewAPICRDOverrider returns a new *APICRDOverrider that reads the overrides
+// from the CRDOverrides in the local cluster.
+func NewAPICRDOverrider(kube client.Reader) *APICRDOverrider {
+	return &APICRDOverrider{client: kube}
+}
+
+// APICRDOverrider merges the local overrides of claim CRDs over the ones
+// fetched from the remote cluster. The overrides are kept in the CRDOverrides
+// named after the CRDs in the local cluster, e.g. to add short names,
+// categories or annotations for UI tooling.
+type APICRDOverrider struct {
+	client client.Reader
+}
+
+// Override merges the override of the supplied CRD, if there is any, over it.
+func (o *APICRDOverrider) Override(ctx context.Context, crd *v1beta1.CustomResourceDefinition) error {
+	patch, err := override.Get(ctx, o.client, crd.GetName())
+	if err != nil || patch == nil {
+		return errors.Wrap(err, errGetOverrides)
+	}
+	return errors.Wrapf(MergeCRD(crd, patch), errFmtMergeOverride, crd.GetName())
+}
+
+// MergeCRD deep-merges the supplied partial CRD over the given CRD. Objects are
+// merged key by key, lists of strings, like short names and categories, are
+// merged by adding the values that are missing and all other values are
+// replaced. A null value removes the key. The override cannot change the
+// identity of the CRD, i.e. its name, group and kind.
+func MergeCRD(crd *v1beta1.CustomResourceDefinition, patch map[string]interface{}) error {
+	base, err := runtime.DefaultUnstructuredConverter.ToUnstructured(crd)
+	if err != nil {
+		return errors.Wrap(err, errMergeOverride)
+	}
+	merged := &v1beta1.CustomResourceDefinition{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(mergeValues(base, patch).(map[string]interface{}), merged); err != nil {
+		return errors.Wrap(err, errMergeOverride)
+	}
+	if merged.GetName() != crd.GetName() || merged.Spec.Group != crd.Spec.Group ||
+		merged.Spec.Names.Kind != crd.Spec.Names.Kind || merged.Spec.Names.Plural != crd.Spec.Names.Plural {
+		return errors.New(errOverrideIdentity)
+	}
+	*crd = *merged
+	return nil
+}
+
+func mergeValues(base, patch interface{}) interface{} {
+	switch p := patch.(type) {
+	case map[string]interface{}:
+		b, ok := base.(map[string]interface{})
+		if !ok {
+			b = map[string]interface{}{}
+		}
+		for k, v := range p {
+			if v == nil {
+				delete(b, k)
+				continue
+			}
+			b[k] = mergeValues(b[k], v)
+		}
+		return b
+	case []interface{}:
+		b, ok := base.([]interface{})
+		if !ok || !allStrings(b) || !allStrings(p) {
+			return p
+		}
+		for _, v := range p {
+			if !contains(b, v) {
+				b = append(b, v)
+			}
+		}
+		return b
+	default:
+		return p
+	}
+}
+
+func allStrings(l []interface{}) bool {
+	for _, v := range l {
+		if _, ok := v.(string); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(l []interface{}, v interface{}) bool {
+	for _, e := range l {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
@@ -23,12 +23,17 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/pkg/errors"
 	apiextensions "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/crossplane/crossplane-runtime/pkg/test"
 	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
+
+	"github.com/crossplane/agent/pkg/resource"
 )
 
 func TestFetch(t *testing.T) {
@@ -40,17 +45,27 @@ func TestFetch(t *testing.T) {
 		crd *apiextensions.CustomResourceDefinition
 		err error
 	}
+	offering := v1alpha1.CompositeResourceDefinition{
+		Spec: v1alpha1.CompositeResourceDefinitionSpec{ClaimNames: &apiextensions.CustomResourceDefinitionNames{Plural: "databases"}},
+	}
 	cases := map[string]struct {
 		reason string
 		args   args
 		want   want
 	}{
+		"NoClaimOffered": {
+			reason: "A not found error should be returned if the XRD doesn't offer claims",
+			want: want{
+				err: errors.Wrap(kerrors.NewNotFound(apiextensions.Resource("customresourcedefinitions"), ""), errGetCRD),
+			},
+		},
 		"GetCRDFailed": {
 			reason: "We should return error if CRD cannot be found",
 			args: args{
 				kube: &test.MockClient{
 					MockGet: test.NewMockGetFn(errBoom),
 				},
+				xrd: offering,
 			},
 			want: want{
 				err: errors.Wrap(errBoom, errGetCRD),
@@ -73,6 +88,7 @@ func TestFetch(t *testing.T) {
 						return nil
 					},
 				},
+				xrd: offering,
 			},
 			want: want{
 				crd: &apiextensions.CustomResourceDefinition{
@@ -98,3 +114,111 @@ func TestFetch(t *testing.T) {
 		})
 	}
 }
+
+func TestAPICRDOverrider(t *testing.T) {
+	base := func() *apiextensions.CustomResourceDefinition {
+		return &apiextensions.CustomResourceDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: "databases.example.org"},
+			Spec: apiextensions.CustomResourceDefinitionSpec{
+				Group: "example.org",
+				Names: apiextensions.CustomResourceDefinitionNames{
+					Kind:       "Database",
+					Plural:     "databases",
+					ShortNames: []string{"db"},
+				},
+			},
+		}
+	}
+	crdOverride := func(name string, o map[string]interface{}) test.MockGetFn {
+		return func(_ context.Context, key client.ObjectKey, obj runtime.Object) error {
+			if key.Name != name {
+				return kerrors.NewNotFound(schema.GroupResource{}, key.Name)
+			}
+			obj.(*unstructured.Unstructured).Object["spec"] = map[string]interface{}{"override": o}
+			return nil
+		}
+	}
+	type want struct {
+		crd *apiextensions.CustomResourceDefinition
+		err error
+	}
+	cases := map[string]struct {
+		reason string
+		get    test.MockGetFn
+		want   want
+	}{
+		"GetOverrideFailed": {
+			reason: "An error should be returned if the CRDOverride cannot be retrieved",
+			get:    test.NewMockGetFn(errBoom),
+			want: want{
+				crd: base(),
+				err: errors.Wrap(resource.LocalError(errBoom, "cannot get CRDOverride"), errGetOverrides),
+			},
+		},
+		"NoOverride": {
+			reason: "The CRD should be left as is if it has no CRDOverride",
+			get:    crdOverride("other.example.org", map[string]interface{}{"spec": map[string]interface{}{}}),
+			want: want{
+				crd: base(),
+			},
+		},
+		"Merged": {
+			reason: "The override should be deep-merged over the CRD",
+			get: crdOverride("databases.example.org", map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": map[string]interface{}{"ui.example.org/icon": "database"},
+				},
+				"spec": map[string]interface{}{
+					"names": map[string]interface{}{
+						"shortNames": []interface{}{"database", "db"},
+						"categories": []interface{}{"example"},
+					},
+				},
+			}),
+			want: want{
+				crd: func() *apiextensions.CustomResourceDefinition {
+					c := base()
+					c.SetAnnotations(map[string]string{"ui.example.org/icon": "database"})
+					c.Spec.Names.ShortNames = []string{"db", "database"}
+					c.Spec.Names.Categories = []string{"example"}
+					return c
+				}(),
+			},
+		},
+		"IdentityChanged": {
+			reason: "An error should be returned if the override changes the identity of the CRD",
+			get: crdOverride("databases.example.org", map[string]interface{}{
+				"spec": map[string]interface{}{"names": map[string]interface{}{"kind": "Other"}},
+			}),
+			want: want{
+				crd: base(),
+				err: errors.Wrapf(errors.New(errOverrideIdentity), errFmtMergeOverride, "databases.example.org"),
+			},
+		},
+		"OverrideMissing": {
+			reason: "An error should be returned if the CRDOverride has no override",
+			get: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+				obj.(*unstructured.Unstructured).Object["spec"] = map[string]interface{}{}
+				return nil
+			},
+			want: want{
+				crd: base(),
+				err: errors.Wrap(errors.New("CRDOverride has no override"), errGetOverrides),
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			crd := base()
+			o := NewAPICRDOverrider(&test.MockClient{MockGet: tc.get})
+			err := o.Override(context.Background(), crd)
+
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\nOverride(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.crd, crd); diff != "" {
+				t.Errorf("\nReason: %s\nOverride(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package xrd
+
+import (
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// A CRDDeletionPolicy determines what happens to the claims of a claim CRD
+// when its CompositeResourceDefinition is deleted, e.g. because the remote
+// cluster withdrew it.
+type CRDDeletionPolicy string
+
+// CRD deletion policies.
+const (
+	// CRDDeletionPolicyCascade deletes the claims once the grace period of the
+	// deletion passes, and then the CRD.
+	CRDDeletionPolicyCascade CRDDeletionPolicy = "Cascade"
+
+	// CRDDeletionPolicyBlock keeps the CompositeResourceDefinition and the CRD
+	// until all the claims are deleted by their owners.
+	CRDDeletionPolicyBlock CRDDeletionPolicy = "Block"
+
+	// CRDDeletionPolicyOrphan releases the CRD and leaves it and the claims
+	// in place, unsynced.
+	CRDDeletionPolicyOrphan CRDDeletionPolicy = "Orphan"
+)
+
+// cascadeAt returns when the claims of the supplied deleted object are deleted
+// with the supplied grace period.
+func cascadeAt(deleted metav1.Object, grace time.Duration) time.Time {
+	if ts := deleted.GetDeletionTimestamp(); ts != nil {
+		return ts.Add(grace)
+	}
+	return time.Now()
+}
+
+// releaseOwner removes the owner reference to the supplied owner from the
+// supplied object.
+func releaseOwner(o, owner metav1.Object) {
+	refs := o.GetOwnerReferences()
+	kept := make([]metav1.OwnerReference, 0, len(refs))
+	for _, ref := range refs {
+		if ref.UID != owner.GetUID() {
+			kept = append(kept, ref)
+		}
+	}
+	o.SetOwnerReferences(kept)
+}
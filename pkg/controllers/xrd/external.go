@@ -0,0 +1,77 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package xrd
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	kunstructured "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	kcontroller "sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"github.com/crossplane/crossplane-runtime/pkg/event"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	coreclaim "github.com/crossplane/crossplane/pkg/controller/apiextensions/claim"
+
+	"github.com/crossplane/agent/pkg/controllers/claim"
+)
+
+const errFmtSetupClaim = "cannot setup the controller of claim kind %s"
+
+// SetupClaims adds a controller for each of the supplied claim kinds, whose
+// CRDs are managed outside of the agent, e.g. by a GitOps tool, instead of the
+// controller that syncs the CompositeResourceDefinitions and the claim CRDs.
+// The claim controllers are configured as if they were started for a
+// CompositeResourceDefinition with the supplied options, except for what only
+// the definition can tell, i.e. the expected connection secret keys, the
+// ignored fields and the resolution of composition selectors.
+func SetupClaims(mgr manager.Manager, remoteClient client.Client, logger logging.Logger, gvks []schema.GroupVersionKind, opts ...ReconcilerOption) error {
+	r := NewReconciler(mgr, remoteClient, opts...)
+	for _, gvk := range gvks {
+		if r.shard != nil && !r.shard.OwnsKind(gvk.GroupKind()) {
+			continue
+		}
+		name := coreclaim.ControllerName(strings.ToLower(gvk.GroupKind().String()))
+		co := []claim.ReconcilerOption{
+			claim.WithLogger(logger.WithValues("controller", name)),
+			claim.WithRecorder(event.NewAPIRecorder(mgr.GetEventRecorderFor(name))),
+		}
+		if r.templateNamespace != "" {
+			co = append(co, claim.WithDefaulters(claim.NewClaimTemplateExpander(r.local.Client, r.templateNamespace)))
+		}
+		rq := &kunstructured.Unstructured{}
+		rq.SetGroupVersionKind(gvk)
+		var h handler.EventHandler = &handler.EnqueueRequestForObject{}
+		if r.resyncs != nil {
+			co = append(co, claim.WithResyncQueue(r.resyncs))
+			h = r.resyncs.Handler(gvk)
+		}
+		c, err := kcontroller.New(name, mgr, kcontroller.Options{Reconciler: claim.NewReconciler(mgr, remoteClient, gvk, append(co, r.claimOpts...)...)})
+		if err != nil {
+			return errors.Wrapf(err, errFmtSetupClaim, gvk.Kind)
+		}
+		if err := c.Watch(&source.Kind{Type: rq}, h, r.claimPredicates...); err != nil {
+			return errors.Wrapf(err, errFmtSetupClaim, gvk.Kind)
+		}
+	}
+	return nil
+}
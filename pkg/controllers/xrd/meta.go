@@ -23,9 +23,21 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 
+	"github.com/crossplane/crossplane-runtime/pkg/meta"
 	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
 )
 
+// The finalizer that Crossplane adds to the CompositeResourceDefinitions whose
+// claims it offers.
+const crossplaneOfferedFinalizer = "offered.apiextensions.crossplane.io"
+
+// OfferedByLocalCrossplane returns true if the claim of the supplied
+// CompositeResourceDefinition is offered by a Crossplane that runs in the same
+// cluster as the agent, which would reconcile the same claims.
+func OfferedByLocalCrossplane(xrd *v1alpha1.CompositeResourceDefinition) bool {
+	return meta.FinalizerExists(xrd, crossplaneOfferedFinalizer)
+}
+
 // GetClaimCRDName returns the name of the claim CRD that's created as result of
 // given CompositeResourceDefinition.
 func GetClaimCRDName(xrd v1alpha1.CompositeResourceDefinition) types.NamespacedName {
@@ -35,7 +47,9 @@ func GetClaimCRDName(xrd v1alpha1.CompositeResourceDefinition) types.NamespacedN
 	return types.NamespacedName{Name: fmt.Sprintf("%s.%s", xrd.Spec.ClaimNames.Plural, xrd.Spec.CRDSpecTemplate.Group)}
 }
 
-// GroupVersionKindOf returns the served GroupVersionKind of given CRD.
+// GroupVersionKindOf returns the served GroupVersionKind of given CRD. The
+// storage version is preferred if it's served, since it's the one the
+// platform is moving the claims to, and the first served version otherwise.
 func GroupVersionKindOf(crd v1beta1.CustomResourceDefinition) schema.GroupVersionKind {
 	servedVersion := crd.Spec.Version
 	for _, v := range crd.Spec.Versions {
@@ -44,6 +58,12 @@ func GroupVersionKindOf(crd v1beta1.CustomResourceDefinition) schema.GroupVersio
 			break
 		}
 	}
+	for _, v := range crd.Spec.Versions {
+		if v.Served && v.Storage {
+			servedVersion = v.Name
+			break
+		}
+	}
 	return schema.GroupVersionKind{
 		Group:   crd.Spec.Group,
 		Kind:    crd.Spec.Names.Kind,
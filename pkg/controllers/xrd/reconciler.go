@@ -18,20 +18,24 @@ package xrd
 
 import (
 	"context"
+	"sync"
 	"time"
 
-	"github.com/crossplane/agent/pkg/resource"
-
 	"github.com/pkg/errors"
 	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	kmeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kunstructured "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	kcontroller "sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	runtimev1alpha1 "github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
@@ -41,10 +45,15 @@ import (
 	"github.com/crossplane/crossplane-runtime/pkg/meta"
 	runtimeresource "github.com/crossplane/crossplane-runtime/pkg/resource"
 	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
-	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1/ccrd"
 	coreclaim "github.com/crossplane/crossplane/pkg/controller/apiextensions/claim"
 
 	"github.com/crossplane/agent/pkg/controllers/claim"
+	"github.com/crossplane/agent/pkg/metrics"
+	"github.com/crossplane/agent/pkg/openapi"
+	"github.com/crossplane/agent/pkg/resource"
+	"github.com/crossplane/agent/pkg/schedule"
+	"github.com/crossplane/agent/pkg/shard"
+	"github.com/crossplane/agent/pkg/startup"
 )
 
 const (
@@ -53,37 +62,74 @@ const (
 	shortWait = 30 * time.Second
 	tinyWait  = 3 * time.Second
 
+	defaultWithdrawalDelay = 5 * time.Minute
+
 	finalizer = "agent.crossplane.io/claim-crd-controller"
 
-	localPrefix        = "local cluster: "
-	remotePrefix       = "remote cluster: "
+	// xrdKind is the kind of the initial sync that the claim types are
+	// tracked as.
+	xrdKind = "compositeresourcedefinitions.apiextensions.crossplane.io"
+
 	errUpdateStatus    = "cannot update status of xrd"
 	errStartController = "cannot start controller"
 	errRemoveFinalizer = "cannot remove finalizer"
 	errGetXRD          = "cannot get xrd"
+	errUpdateXRD       = "cannot update xrd"
 	errFetchCRD        = "cannot fetch the crd of xrd from remote"
 	errGetCRD          = "cannot get custom resource definition"
 	errApplyCRD        = "cannot apply custom resource definition"
 	errListCR          = "cannot list custom resources of claim type"
 	errDeleteCR        = "cannot delete custom resources of claim type"
 	errDeleteCRD       = "cannot delete crd of claim type"
+	errOrphanCRD       = "cannot orphan crd of claim type"
+	errOrphanClaim     = "cannot remove finalizer of orphaned claim"
 	errAddFinalizerXRD = "cannot add finalizer to xrd"
+	errOverrideCRD     = "cannot override custom resource definition"
+	errStructuralCRD   = "cannot render custom resource definition with structural schemas"
+	errMigrateClaims   = "cannot migrate claims stored at old versions"
+
+	errGetOverrides     = "cannot get custom resource definition overrides"
+	errMergeOverride    = "cannot merge custom resource definition override"
+	errOverrideIdentity = "custom resource definition override cannot change its name, group or kind"
+	errFmtMergeOverride = "cannot apply override of custom resource definition %s"
+
+	reasonCannotMigrate event.Reason = "CannotMigrateClaims"
 )
 
 // Setup adds a controller that will reconcile CompositeResourceDefinitions that
 // offer resource claim in the local cluster and create CRDs & controllers that
 // will reconcile those new types.
-func Setup(mgr manager.Manager, remoteClient client.Client, logger logging.Logger) error {
+func Setup(mgr manager.Manager, remoteClient client.Client, logger logging.Logger, opts ...ReconcilerOption) error {
 	name := "ClaimCustomResourceDefinitions"
-	r := NewReconciler(mgr, remoteClient,
+	r := NewReconciler(mgr, remoteClient, append([]ReconcilerOption{
 		WithCRDFetcher(NewAPIRemoteCRDFetcher(remoteClient)),
 		WithLogger(logger),
-		WithRecorder(event.NewAPIRecorder(mgr.GetEventRecorderFor(name))))
+		WithRecorder(event.NewAPIRecorder(mgr.GetEventRecorderFor(name))),
+	}, opts...)...)
+	if r.gate != nil {
+		r.gate.Expect(xrdKind, func(ctx context.Context) ([]string, error) {
+			l := &v1alpha1.CompositeResourceDefinitionList{}
+			if err := mgr.GetClient().List(ctx, l); err != nil {
+				return nil, err
+			}
+			var names []string
+			for i := range l.Items {
+				if l.Items[i].OffersClaim() && !meta.WasDeleted(&l.Items[i]) && r.owns(&l.Items[i]) {
+					names = append(names, l.Items[i].GetName())
+				}
+			}
+			return names, nil
+		})
+	}
 	return ctrl.NewControllerManagedBy(mgr).
 		Named(name).
 		For(&v1alpha1.CompositeResourceDefinition{}).
 		WithEventFilter(resource.NewXRDWithClaim()).
-		Owns(&v1beta1.CustomResourceDefinition{}).
+		WithEventFilter(predicate.NewPredicateFuncs(func(_ metav1.Object, o runtime.Object) bool {
+			xrd, ok := o.(*v1alpha1.CompositeResourceDefinition)
+			return !ok || r.owns(xrd)
+		})).
+		Owns(r.crdVersion.Object()).
 		Complete(r)
 }
 
@@ -108,6 +154,43 @@ func WithCRDFetcher(re CRDFetcher) ReconcilerOption {
 	}
 }
 
+// WithCRDOverrider specifies how the Reconciler should override the claim CRDs
+// fetched from the remote cluster before they're applied in the local cluster.
+func WithCRDOverrider(o CRDOverrider) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.overrider = o
+	}
+}
+
+// WithCRDConversion specifies how the Reconciler should render the conversion
+// webhooks of the claim CRDs fetched from the remote cluster, which point at
+// services that don't exist in the local cluster. The claim CRDs are rendered
+// without conversion and with only their storage version by default.
+func WithCRDConversion(c resource.CRDConversion) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.conversion = c
+	}
+}
+
+// WithStructuralSchemas specifies that the Reconciler should render the claim
+// CRDs with structural schemas whose unknown fields are pruned, for local
+// clusters that admit only such CRDs. See resource.RequireStructuralSchemas.
+func WithStructuralSchemas() ReconcilerOption {
+	return func(r *Reconciler) {
+		r.structural = true
+	}
+}
+
+// WithClaimMigrator specifies how the Reconciler should migrate the local
+// claims that are stored at old versions of their CRD, e.g. once the claim
+// type is bumped in the remote cluster. The old versions that claims are
+// stored at are served until they're migrated.
+func WithClaimMigrator(m ClaimMigrator) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.migrator = m
+	}
+}
+
 // WithLocalApplicator specifies what Applicator in local cluster Reconciler
 // should use.
 func WithLocalApplicator(a runtimeresource.Applicator) ReconcilerOption {
@@ -116,6 +199,56 @@ func WithLocalApplicator(a runtimeresource.Applicator) ReconcilerOption {
 	}
 }
 
+// WithCRDVersion specifies the version of CustomResourceDefinitions that the
+// local cluster serves. The claim CRDs are converted to it on their way to the
+// local cluster, and applied with a resource.CRDApplicator unless another
+// Applicator is given with WithLocalApplicator.
+func WithCRDVersion(v resource.CRDVersion) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.crdVersion = v
+	}
+}
+
+// WithSyncGate specifies the Gate that the Reconciler should record the
+// definitions whose claim CRDs and controllers are ready to, so that it can
+// tell when the initial sync is complete.
+func WithSyncGate(g *startup.Gate) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.gate = g
+	}
+}
+
+// WithScheduler specifies the Scheduler that decides when the Reconciler
+// syncs the definitions next. The claim reconcilers are configured with
+// WithClaimOptions.
+func WithScheduler(s schedule.Scheduler) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.scheduler = s
+	}
+}
+
+// WithCRDDeletionPolicy specifies what the Reconciler should do with the
+// claims of the claim CRD of a deleted CompositeResourceDefinition. The claims
+// are deleted with CRDDeletionPolicyCascade once the supplied grace period
+// passes after the deletion, which they are right away by default.
+func WithCRDDeletionPolicy(p CRDDeletionPolicy, grace time.Duration) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.deletionPolicy = p
+		r.deletionGrace = grace
+	}
+}
+
+// WithWithdrawalDelay specifies how long the claim CRD of a
+// CompositeResourceDefinition that still offers claims has to be gone from the
+// remote cluster before the Reconciler stops syncing its claims, so that a CRD
+// that is gone only for a moment, e.g. while it's recreated, doesn't withdraw
+// them.
+func WithWithdrawalDelay(d time.Duration) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.withdrawalDelay = d
+	}
+}
+
 // WithLogger specifies how the Reconciler should log messages.
 func WithLogger(log logging.Logger) ReconcilerOption {
 	return func(r *Reconciler) {
@@ -130,27 +263,116 @@ func WithRecorder(er event.Recorder) ReconcilerOption {
 	}
 }
 
+// WithClaimOptions specifies the options that the Reconciler should pass to
+// the reconcilers of the claim types it starts controllers for.
+func WithClaimOptions(opts ...claim.ReconcilerOption) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.claimOpts = append(r.claimOpts, opts...)
+	}
+}
+
+// WithResyncQueue specifies the ResyncQueue that the controllers of claim
+// types should watch the claims with and that their reconcilers should hand
+// the routine resyncs to, so that new and changed claims are synced first.
+func WithResyncQueue(q *claim.ResyncQueue) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.resyncs = q
+	}
+}
+
+// WithClaimPredicates specifies the predicates that the controllers of claim
+// types should use to filter the events of claim instances.
+func WithClaimPredicates(p ...predicate.Predicate) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.claimPredicates = append(r.claimPredicates, p...)
+	}
+}
+
+// WithShard specifies the shard of the claims that the agent syncs. Only the
+// definitions of the claim kinds of the shard are reconciled, so the CRDs of
+// the other kinds are left to the agents of their shards, and only the claims
+// of the shard are synced.
+func WithShard(s *shard.Shard) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.shard = s
+		r.claimPredicates = append(r.claimPredicates, s.Predicate())
+		r.claimOpts = append(r.claimOpts, claim.WithShard(s))
+	}
+}
+
+// WithCompositionSelectorResolution specifies that the composition selectors
+// of the claims should be resolved using the Compositions in the local cluster
+// before they are forwarded to the remote cluster.
+func WithCompositionSelectorResolution() ReconcilerOption {
+	return func(r *Reconciler) {
+		r.resolveSelectors = true
+	}
+}
+
+// WithDefaultCompositions specifies that the claims that neither reference
+// nor select a Composition should be defaulted to the default Composition of
+// their CompositeResourceDefinition before they're forwarded, see
+// claim.DefaultCompositionSetter.
+func WithDefaultCompositions() ReconcilerOption {
+	return func(r *Reconciler) {
+		r.defaultCompositions = true
+	}
+}
+
+// WithClaimTemplates specifies the namespace of the claim templates that the
+// claims should be expanded from before they're forwarded, see
+// claim.ClaimTemplateExpander.
+func WithClaimTemplates(namespace string) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.templateNamespace = namespace
+	}
+}
+
+// WithSchemaIndex specifies the Index that the Reconciler should keep up to
+// date with the schemas of the claim CRDs it syncs.
+func WithSchemaIndex(i *openapi.Index) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.schemas = i
+	}
+}
+
 // ReconcilerOption is used to configure *Reconciler.
 type ReconcilerOption func(*Reconciler)
 
 // NewReconciler returns a new *Reconciler.
 func NewReconciler(mgr manager.Manager, remoteClient client.Client, opts ...ReconcilerOption) *Reconciler {
 	r := &Reconciler{
-		mgr: mgr,
-		local: runtimeresource.ClientApplicator{
-			Client:     mgr.GetClient(),
-			Applicator: runtimeresource.NewAPIUpdatingApplicator(mgr.GetClient()),
-		},
+		mgr:       mgr,
+		local:     runtimeresource.ClientApplicator{Client: mgr.GetClient()},
 		remote:    remoteClient,
 		engine:    controller.NewEngine(mgr),
 		crd:       NewNopFetcher(),
+		overrider: NewNopOverrider(),
+		schemas:   openapi.NewIndex(),
+		versions:  map[string]schema.GroupVersionKind{},
 		finalizer: runtimeresource.NewAPIFinalizer(mgr.GetClient(), finalizer),
 		log:       logging.NewNopLogger(),
 		record:    event.NewNopRecorder(),
+		scheduler: schedule.NewNopScheduler(),
+
+		deletionPolicy:  CRDDeletionPolicyCascade,
+		withdrawalDelay: defaultWithdrawalDelay,
 	}
 	for _, f := range opts {
 		f(r)
 	}
+	// The local client is wrapped for the CRD version once all options are
+	// applied, so that an Applicator given with WithLocalApplicator is kept
+	// whatever the order of the options.
+	if r.crdVersion != "" {
+		r.local.Client = r.crdVersion.Client(r.local.Client)
+	}
+	if r.local.Applicator == nil {
+		r.local.Applicator = runtimeresource.NewAPIUpdatingApplicator(r.local.Client)
+		if r.crdVersion != "" {
+			r.local.Applicator = resource.NewCRDApplicator(r.local.Client)
+		}
+	}
 	return r
 }
 
@@ -166,45 +388,275 @@ type CRDFetcher interface {
 	Fetch(ctx context.Context, ip v1alpha1.CompositeResourceDefinition) (*v1beta1.CustomResourceDefinition, error)
 }
 
+// CRDOverrider can be satisfied with objects that modify a claim CRD fetched
+// from the remote cluster before it's applied in the local cluster.
+type CRDOverrider interface {
+	Override(ctx context.Context, crd *v1beta1.CustomResourceDefinition) error
+}
+
+// A ClaimMigrator migrates the local claims that are stored at versions of
+// their CRD other than its storage version.
+type ClaimMigrator interface {
+	Migrate(ctx context.Context, crd *v1beta1.CustomResourceDefinition) error
+}
+
 // Reconciler watches the CompositeResourceDefinition with resource claim offerings
 // in the cluster and creates a CRD for each of them with spec that is fetched
 // via supplied CRDFetcher. Then it creates a controller for each new type that
 // will sync the instances of that type from local cluster to remote cluster.
 type Reconciler struct {
+	resource.ManagerContext
+
 	mgr    ctrl.Manager
 	local  runtimeresource.ClientApplicator
 	remote client.Client
 
-	crd       CRDFetcher
-	engine    ControllerEngine
-	finalizer runtimeresource.Finalizer
+	crd        CRDFetcher
+	crdVersion resource.CRDVersion
+	overrider  CRDOverrider
+	conversion resource.CRDConversion
+	structural bool
+	migrator   ClaimMigrator
+	schemas    *openapi.Index
+	engine     ControllerEngine
+	finalizer  runtimeresource.Finalizer
+
+	deletionPolicy  CRDDeletionPolicy
+	deletionGrace   time.Duration
+	withdrawalDelay time.Duration
+
+	claimOpts           []claim.ReconcilerOption
+	claimPredicates     []predicate.Predicate
+	resyncs             *claim.ResyncQueue
+	resolveSelectors    bool
+	defaultCompositions bool
+	templateNamespace   string
+	gate                *startup.Gate
+	scheduler           schedule.Scheduler
+	shard               *shard.Shard
+
+	// versions are the versions of the claim types that the running claim
+	// controllers watch, by controller name.
+	versions   map[string]schema.GroupVersionKind
+	versionsMu sync.Mutex
 
 	log    logging.Logger
 	record event.Recorder
 }
 
+// restartOnVersionChange stops the named controller if it was started for
+// another version of the claim type than the supplied one.
+func (r *Reconciler) restartOnVersionChange(name string, gvk schema.GroupVersionKind) {
+	r.versionsMu.Lock()
+	defer r.versionsMu.Unlock()
+	if prev, ok := r.versions[name]; ok && prev != gvk {
+		r.log.Debug("Restarting claim controller for new version", "controller", name, "old-version", prev.Version, "new-version", gvk.Version)
+		r.engine.Stop(name)
+		if r.resyncs != nil {
+			r.resyncs.Remove(prev)
+		}
+	}
+	r.versions[name] = gvk
+}
+
+// stop stops the named claim controller and removes the claim type it watched
+// from the schema Index, and from the ResyncQueue, if any, so that its resyncs
+// aren't fed to a controller that isn't running.
+func (r *Reconciler) stop(name string) {
+	r.engine.Stop(name)
+	r.versionsMu.Lock()
+	gvk, ok := r.versions[name]
+	delete(r.versions, name)
+	r.versionsMu.Unlock()
+	if !ok {
+		return
+	}
+	r.schemas.Delete(gvk.GroupKind())
+	if r.resyncs != nil {
+		r.resyncs.Remove(gvk)
+	}
+}
+
+// owns returns whether the supplied definition offers claims of a kind of the
+// shard of the agent, if any.
+func (r *Reconciler) owns(xrd *v1alpha1.CompositeResourceDefinition) bool {
+	return r.shard == nil || xrd.Spec.ClaimNames == nil || r.shard.OwnsKind(xrd.GetClaimGroupVersionKind().GroupKind())
+}
+
+// synced records that the claims of the supplied definition are served in the
+// local cluster, or deliberately not synced.
+func (r *Reconciler) synced(xrd *v1alpha1.CompositeResourceDefinition) {
+	if r.gate != nil {
+		r.gate.Synced(xrdKind, xrd.GetName())
+	}
+}
+
+// withdraw stops the claim controller of the supplied XRD, whose claims are
+// not offered by the remote cluster.
+func (r *Reconciler) withdraw(ctx context.Context, log logging.Logger, xrd *v1alpha1.CompositeResourceDefinition, observed *v1alpha1.CompositeResourceDefinitionStatus) (reconcile.Result, error) {
+	log.Info("Claims are not offered by the remote cluster, stopping their sync")
+	r.stop(coreclaim.ControllerName(xrd.GetName()))
+	r.synced(xrd)
+	if meta.WasDeleted(xrd) {
+		return reconcile.Result{}, resource.LocalError(r.finalizer.RemoveFinalizer(ctx, xrd), errRemoveFinalizer)
+	}
+	xrd.Status.SetConditions(resource.ClaimsWithdrawn())
+	return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(r.updateStatus(ctx, xrd, observed), errUpdateStatus)
+}
+
+// missing records when the claim CRD of the supplied XRD was found to be gone
+// from the remote cluster, and withdraws its claims once it's been gone for
+// the withdrawal delay.
+func (r *Reconciler) missing(ctx context.Context, log logging.Logger, xrd *v1alpha1.CompositeResourceDefinition, observed *v1alpha1.CompositeResourceDefinitionStatus) (reconcile.Result, error) {
+	since, err := time.Parse(time.RFC3339, xrd.GetAnnotations()[resource.AnnotationKeyClaimCRDMissing])
+	if err != nil {
+		log.Info("Claim custom resource definition is gone from the remote cluster", "withdraw-after", time.Now().Add(r.withdrawalDelay))
+		meta.AddAnnotations(xrd, map[string]string{resource.AnnotationKeyClaimCRDMissing: time.Now().UTC().Format(time.RFC3339)})
+		return reconcile.Result{RequeueAfter: r.withdrawalDelay}, resource.LocalError(r.local.Update(ctx, xrd), errUpdateXRD)
+	}
+	if remaining := r.withdrawalDelay - time.Since(since); remaining > 0 {
+		return reconcile.Result{RequeueAfter: remaining}, nil
+	}
+	return r.withdraw(ctx, log, xrd, observed)
+}
+
+// updateStatus updates the status of the supplied XRD unless it's the same as
+// the supplied status it was observed with, so that the XRDs aren't written on
+// every sync. The conditions keep their transition times while they don't
+// change, so they're compared as they are.
+func (r *Reconciler) updateStatus(ctx context.Context, xrd *v1alpha1.CompositeResourceDefinition, observed *v1alpha1.CompositeResourceDefinitionStatus) error {
+	if equality.Semantic.DeepEqual(observed, &xrd.Status) {
+		return nil
+	}
+	return r.local.Status().Update(ctx, xrd)
+}
+
+// orphan releases the claim CRD of the supplied deleted XRD, so that neither it
+// nor the supplied claims of its kind are deleted along with the XRD, and stops
+// syncing the claims.
+func (r *Reconciler) orphan(ctx context.Context, log logging.Logger, xrd *v1alpha1.CompositeResourceDefinition, crd *v1beta1.CustomResourceDefinition, claims []kunstructured.Unstructured) (reconcile.Result, error) {
+	log.Info("Orphaning the custom resource definition and the claims of deleted definition", "claims", len(claims))
+
+	// The controller is stopped before the finalizers of the claims are
+	// removed so that it doesn't add them back, and the finalizers are removed
+	// before the CRD is released so that this is retried until none of the
+	// claims is left with a finalizer that nothing would remove.
+	r.stop(coreclaim.ControllerName(xrd.GetName()))
+	for i := range claims {
+		if !meta.FinalizerExists(&claims[i], claim.Finalizer) {
+			continue
+		}
+		meta.RemoveFinalizer(&claims[i], claim.Finalizer)
+		if err := r.local.Update(ctx, &claims[i]); runtimeresource.IgnoreNotFound(err) != nil {
+			return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(err, errOrphanClaim)
+		}
+	}
+	releaseOwner(crd, xrd)
+	if err := r.local.Update(ctx, crd); err != nil {
+		return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(err, errOrphanCRD)
+	}
+	return reconcile.Result{}, resource.LocalError(r.finalizer.RemoveFinalizer(ctx, xrd), errRemoveFinalizer)
+}
+
+// reportSchemaDrift records the supplied differences between the schemas of
+// the local and the remote claim CRDs of the supplied XRD in its status, if
+// there are any.
+func (r *Reconciler) reportSchemaDrift(ctx context.Context, log logging.Logger, xrd *v1alpha1.CompositeResourceDefinition, diff []string) {
+	if len(diff) == 0 {
+		return
+	}
+	log.Debug("Schema of local custom resource definition differs from remote", "differences", len(diff))
+	metrics.SchemaDrift.WithLabelValues(GetClaimCRDName(*xrd).Name).Set(1)
+	xrd.Status.SetConditions(resource.SchemaDrift(diff))
+	if err := r.local.Status().Update(ctx, xrd); err != nil {
+		log.Debug(errUpdateStatus, "error", err)
+	}
+}
+
 // TODO(muvaf): Set error conditions on the CompositeResourceDefinition.
 
 // Reconcile reconciles CompositeResourceDefinition and does the necessary operations
 // to bootstrap reconciliation of that new type defined by CompositeResourceDefinition.
-func (r *Reconciler) Reconcile(req reconcile.Request) (reconcile.Result, error) { // nolint:gocyclo
-	log := r.log.WithValues("request", req)
+func (r *Reconciler) Reconcile(req reconcile.Request) (reconcile.Result, error) {
+	return r.ReconcileContext(r.Context(), req)
+}
+
+// ReconcileContext is Reconcile with the supplied context, which the context
+// of the reconcile is derived from. The reconcile is cancelled once the
+// supplied context is.
+func (r *Reconciler) ReconcileContext(ctx context.Context, req reconcile.Request) (result reconcile.Result, err error) {
+	defer func() {
+		result = r.scheduler.Schedule(schedule.Key{Controller: xrdKind, Name: req.Name}, result, err)
+	}()
+	result, err = r.reconcile(ctx, req)
+	if err != nil {
+		metrics.SyncErrors.WithLabelValues(string(resource.ClassifyError(err))).Inc()
+	}
+	return result, err
+}
+
+func (r *Reconciler) reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) { // nolint:gocyclo
+	id := resource.NewSyncID()
+	log := r.log.WithValues("request", req, "sync-id", id)
 	log.Debug("Reconciling")
 
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	ctx, cancel := context.WithTimeout(resource.WithSyncID(ctx, id), timeout)
 	defer cancel()
 
 	xrd := &v1alpha1.CompositeResourceDefinition{}
 	if err := r.local.Get(ctx, req.NamespacedName, xrd); runtimeresource.IgnoreNotFound(err) != nil {
-		return reconcile.Result{RequeueAfter: shortWait}, errors.Wrap(err, localPrefix+errGetXRD)
+		return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(err, errGetXRD)
 	}
+	// The claim kinds of other shards are left to their agents, which may
+	// write the CRDs and the status of their definitions differently.
+	if !r.owns(xrd) {
+		log.Debug("Claims are of a kind of another shard, not syncing them")
+		return reconcile.Result{}, nil
+	}
+	// The status is only written if it changes, see updateStatus.
+	observed := xrd.Status.DeepCopy()
 
 	// We will fetch the CRD of the claim that CompositeResourceDefinition offers
 	// and apply it in the local cluster so that we can start the sync controller
 	// targeting that type.
 	localCRD, err := r.crd.Fetch(ctx, *xrd)
-	if runtimeresource.IgnoreNotFound(err) != nil {
-		return reconcile.Result{RequeueAfter: shortWait}, errors.Wrap(err, remotePrefix+errFetchCRD)
+	switch {
+	// The claims are not offered by the remote cluster, e.g. because the
+	// claim names were removed from the XRD there, so their controller is
+	// stopped. The CRD and the claims are left alone and the claims are synced
+	// again once they're offered again.
+	case kerrors.IsNotFound(errors.Cause(err)) && !xrd.OffersClaim():
+		return r.withdraw(ctx, log, xrd, observed)
+	// A claim CRD that's gone while the XRD still offers claims may be gone
+	// only for a moment, so the claims are withdrawn only if it stays gone. A
+	// deleted XRD that still offers claims is cleaned up as usual.
+	case kerrors.IsNotFound(errors.Cause(err)) && !meta.WasDeleted(xrd):
+		return r.missing(ctx, log, xrd, observed)
+	case kerrors.IsNotFound(errors.Cause(err)):
+		localCRD = &v1beta1.CustomResourceDefinition{}
+	case err != nil:
+		return reconcile.Result{RequeueAfter: shortWait}, resource.RemoteError(err, errFetchCRD)
+	}
+	if _, ok := xrd.GetAnnotations()[resource.AnnotationKeyClaimCRDMissing]; ok && err == nil {
+		meta.RemoveAnnotations(xrd, resource.AnnotationKeyClaimCRDMissing)
+		if err := r.local.Update(ctx, xrd); err != nil {
+			return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(err, errUpdateXRD)
+		}
+	}
+
+	// A Crossplane in the local cluster reconciles the claims itself, so we
+	// stay out of its way rather than both of them fighting over the claims.
+	// The CRD and the claims belong to that Crossplane, so they're left alone
+	// even if the XRD is deleted.
+	if OfferedByLocalCrossplane(xrd) {
+		log.Info("Claims are offered by a local Crossplane, not syncing them")
+		r.stop(coreclaim.ControllerName(xrd.GetName()))
+		r.synced(xrd)
+		if meta.WasDeleted(xrd) {
+			return reconcile.Result{}, resource.LocalError(r.finalizer.RemoveFinalizer(ctx, xrd), errRemoveFinalizer)
+		}
+		xrd.Status.SetConditions(resource.OfferedByLocalCrossplane())
+		return reconcile.Result{RequeueAfter: longWait}, resource.LocalError(r.updateStatus(ctx, xrd, observed), errUpdateStatus)
 	}
 
 	// In case XRD is deleted, we need to clean up the CRD and stop its controller.
@@ -212,7 +664,7 @@ func (r *Reconciler) Reconcile(req reconcile.Request) (reconcile.Result, error)
 		xrd.Status.SetConditions(v1alpha1.Deleting())
 		err := r.local.Get(ctx, GetClaimCRDName(*xrd), localCRD)
 		if runtimeresource.IgnoreNotFound(err) != nil {
-			return reconcile.Result{RequeueAfter: shortWait}, errors.Wrap(err, localPrefix+errGetCRD)
+			return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(err, errGetCRD)
 		}
 
 		// The CRD has no creation timestamp, or we don't control it. Most
@@ -225,10 +677,10 @@ func (r *Reconciler) Reconcile(req reconcile.Request) (reconcile.Result, error)
 			// It's likely that we've already stopped this controller on a
 			// previous reconcile, but we try again just in case. This is a
 			// no-op if the controller was already stopped.
-			r.engine.Stop(coreclaim.ControllerName(xrd.GetName()))
+			r.stop(coreclaim.ControllerName(xrd.GetName()))
 
 			if err := r.finalizer.RemoveFinalizer(ctx, xrd); err != nil {
-				return reconcile.Result{RequeueAfter: shortWait}, errors.Wrap(err, localPrefix+errRemoveFinalizer)
+				return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(err, errRemoveFinalizer)
 			}
 
 			// We're all done deleting and have removed our finalizer. There's
@@ -239,7 +691,25 @@ func (r *Reconciler) Reconcile(req reconcile.Request) (reconcile.Result, error)
 		l := &kunstructured.UnstructuredList{}
 		l.SetGroupVersionKind(GroupVersionKindOf(*localCRD))
 		if err := r.local.List(ctx, l); runtimeresource.Ignore(kmeta.IsNoMatchError, err) != nil {
-			return reconcile.Result{RequeueAfter: shortWait}, errors.Wrap(err, localPrefix+errListCR)
+			return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(err, errListCR)
+		}
+
+		// The claims may have been created by their owners long before the
+		// definition was withdrawn, so what happens to them is up to the
+		// deletion policy rather than the deletion of the definition alone.
+		if len(l.Items) > 0 {
+			switch at := cascadeAt(xrd, r.deletionGrace); {
+			case r.deletionPolicy == CRDDeletionPolicyBlock:
+				log.Info("Claims of deleted definition still exist, not deleting its custom resource definition", "claims", len(l.Items))
+				xrd.Status.SetConditions(resource.BlockedByInstances(len(l.Items)))
+				return reconcile.Result{RequeueAfter: longWait}, resource.LocalError(r.updateStatus(ctx, xrd, observed), errUpdateStatus)
+			case r.deletionPolicy == CRDDeletionPolicyOrphan:
+				return r.orphan(ctx, log, xrd, localCRD, l.Items)
+			case time.Now().Before(at):
+				log.Debug("Claims of deleted definition are deleted once the grace period passes", "claims", len(l.Items), "delete-at", at)
+				xrd.Status.SetConditions(resource.CascadeScheduled(len(l.Items), at))
+				return reconcile.Result{RequeueAfter: time.Until(at)}, resource.LocalError(r.updateStatus(ctx, xrd, observed), errUpdateStatus)
+			}
 		}
 
 		// Ensure all the custom resources we defined are gone before stopping
@@ -248,29 +718,29 @@ func (r *Reconciler) Reconcile(req reconcile.Request) (reconcile.Result, error)
 		if len(l.Items) > 0 {
 			for i := range l.Items {
 				if err := r.local.Delete(ctx, &l.Items[i]); runtimeresource.IgnoreNotFound(err) != nil {
-					return reconcile.Result{RequeueAfter: shortWait}, errors.Wrap(err, localPrefix+errDeleteCR)
+					return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(err, errDeleteCR)
 				}
 			}
 
 			// We requeue to confirm that all the custom resources we just
 			// deleted are actually gone. We need to requeue after a tiny wait
 			// because we won't be requeued implicitly when the CRs are deleted.
-			return reconcile.Result{RequeueAfter: tinyWait}, errors.Wrap(r.local.Status().Update(ctx, xrd), localPrefix+errUpdateStatus)
+			return reconcile.Result{RequeueAfter: tinyWait}, resource.LocalError(r.updateStatus(ctx, xrd, observed), errUpdateStatus)
 		}
 
 		// The controller should be stopped before the deletion of CRD so that
 		// it doesn't crash.
-		r.engine.Stop(coreclaim.ControllerName(xrd.GetName()))
+		r.stop(coreclaim.ControllerName(xrd.GetName()))
 
 		if err := r.local.Delete(ctx, localCRD); runtimeresource.IgnoreNotFound(err) != nil {
-			return reconcile.Result{RequeueAfter: shortWait}, errors.Wrap(err, localPrefix+errDeleteCRD)
+			return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(err, errDeleteCRD)
 		}
 
 		// We should be requeued implicitly because we're watching the
 		// CustomResourceDefinition that we just deleted, but we requeue after
 		// a tiny wait just in case the CRD isn't gone after the first requeue.
 		xrd.Status.SetConditions(runtimev1alpha1.ReconcileSuccess())
-		return reconcile.Result{RequeueAfter: tinyWait}, errors.Wrap(r.local.Status().Update(ctx, xrd), localPrefix+errUpdateStatus)
+		return reconcile.Result{RequeueAfter: tinyWait}, resource.LocalError(r.updateStatus(ctx, xrd, observed), errUpdateStatus)
 	}
 
 	// After this point, we'll start operations that will need some cleanup
@@ -278,30 +748,107 @@ func (r *Reconciler) Reconcile(req reconcile.Request) (reconcile.Result, error)
 	// we add a finalizer to make sure this Reconciler gets the chance to do
 	// the cleanup before the XRD disappears from the api-server.
 	if err := r.finalizer.AddFinalizer(ctx, xrd); err != nil {
-		return reconcile.Result{RequeueAfter: shortWait}, errors.Wrap(err, localPrefix+errAddFinalizerXRD)
+		return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(err, errAddFinalizerXRD)
+	}
+
+	r.conversion.Render(localCRD)
+	if r.structural {
+		if err := resource.RequireStructuralSchemas(localCRD); err != nil {
+			return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(err, errStructuralCRD)
+		}
+	}
+
+	// The local overrides are merged over the CRD on every sync so that they
+	// aren't lost when the CRD changes in the remote cluster.
+	if err := r.overrider.Override(ctx, localCRD); err != nil {
+		return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(err, errOverrideCRD)
+	}
+
+	// The default Composition is recorded on the CRD on every sync so that
+	// the claims pick up the changes of the default in the remote cluster.
+	// It's removed explicitly once the remote cluster has no default, so that
+	// the claims don't keep being defaulted to the old one.
+	meta.RemoveAnnotations(localCRD, resource.AnnotationKeyDefaultComposition)
+	if ref := xrd.Spec.DefaultCompositionRef; r.defaultCompositions && ref != nil {
+		meta.AddAnnotations(localCRD, map[string]string{resource.AnnotationKeyDefaultComposition: ref.Name})
 	}
 
 	// We'll create or update the CRD of the claim type in local cluster to make
 	// it available to users.
 	meta.AddOwnerReference(localCRD, meta.AsController(meta.ReferenceTo(xrd, v1alpha1.CompositeResourceDefinitionGroupVersionKind)))
-	if err := r.local.Apply(ctx, localCRD, runtimeresource.MustBeControllableBy(xrd.GetUID())); err != nil {
-		return reconcile.Result{RequeueAfter: shortWait}, errors.Wrap(err, localPrefix+errApplyCRD)
+	resource.SetSyncID(ctx, localCRD)
+	// The CRD in the local cluster is kept so that how its schema differs from
+	// the remote one can be reported if the remote one cannot be applied, e.g.
+	// because the local CRD isn't controlled by the XRD.
+	current := &v1beta1.CustomResourceDefinition{}
+	if err := r.local.Get(ctx, GetClaimCRDName(*xrd), current); runtimeresource.IgnoreNotFound(err) != nil {
+		return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(err, errGetCRD)
 	}
+	desired := localCRD.DeepCopy()
+	keep := resource.KeepStoredVersions()
+	if r.migrator != nil {
+		keep = resource.ServeStoredVersions()
+	}
+	if err := r.local.Apply(ctx, localCRD, runtimeresource.MustBeControllableBy(xrd.GetUID()), keep); err != nil {
+		if meta.WasCreated(current) {
+			r.reportSchemaDrift(ctx, log, xrd, openapi.Diff(current, desired))
+		}
+		return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(err, errApplyCRD)
+	}
+	xrd.Status.SetConditions(resource.NoSchemaDrift())
+	metrics.SchemaDrift.WithLabelValues(localCRD.GetName()).Set(0)
 
 	// It takes a little while for Kubernetes API Server to establish the new API
 	// endpoints for the CRD. We'd like to make sure it's ready before starting
 	// its controller.
-	if !ccrd.IsEstablished(localCRD.Status) {
-		return reconcile.Result{RequeueAfter: tinyWait}, errors.Wrap(r.local.Status().Update(ctx, xrd), localPrefix+errUpdateStatus)
+	if err := resource.Established(localCRD); errors.Is(err, resource.ErrCRDNotEstablished) {
+		log.Debug("CRD is not established yet", "crd", localCRD.GetName(), "requeue-after", time.Now().Add(tinyWait))
+		xrd.Status.SetConditions(resource.CRDNotEstablished(localCRD.GetName()))
+		return reconcile.Result{RequeueAfter: tinyWait}, resource.LocalError(r.updateStatus(ctx, xrd, observed), errUpdateStatus)
+	}
+
+	// The claims are synced while they're migrated, so a migration that
+	// fails is retried with the next sync instead of blocking them.
+	if r.migrator != nil {
+		if err := r.migrator.Migrate(ctx, localCRD); err != nil {
+			log.Debug(errMigrateClaims, "error", err)
+			r.record.Event(xrd, event.Warning(reasonCannotMigrate, errors.Wrap(err, errMigrateClaims)))
+		}
 	}
 
+	// The schema is indexed as applied, i.e. with the local overrides and the
+	// default Composition, since that's what the local claims are defaulted
+	// and validated against.
+	r.schemas.Set(localCRD)
+
 	// The new controller for the type is configured with a reconciler and other
 	// parameters that the reconciler requires.
+	co := []claim.ReconcilerOption{
+		claim.WithLogger(r.log.WithValues("controller", coreclaim.ControllerName(xrd.GetName()))),
+		claim.WithRecorder(r.record.WithAnnotations("controller", coreclaim.ControllerName(xrd.GetName()))),
+		claim.WithConnectionSecretOptions(claim.WithExpectedKeys(xrd.GetConnectionSecretKeys()...)),
+	}
+	// The templates are expanded first so that the composition selectors
+	// they set are resolved as well.
+	if r.templateNamespace != "" {
+		co = append(co, claim.WithDefaulters(claim.NewClaimTemplateExpander(r.local.Client, r.templateNamespace)))
+	}
+	if r.resolveSelectors {
+		co = append(co, claim.WithDefaulters(claim.NewCompositionSelectorResolver(r.local.Client, xrd.GetCompositeGroupVersionKind())))
+	}
+	if r.defaultCompositions {
+		co = append(co, claim.WithDefaulters(claim.NewDefaultCompositionSetter(r.schemas, GroupVersionKindOf(*localCRD).GroupKind())))
+	}
+	co = append(co, claim.WithIgnoredFieldsFn(claim.NewXRDIgnoredFields(r.local.Client, xrd.GetName())))
+	var h handler.EventHandler = &handler.EnqueueRequestForObject{}
+	if r.resyncs != nil {
+		co = append(co, claim.WithResyncQueue(r.resyncs))
+		h = r.resyncs.Handler(GroupVersionKindOf(*localCRD))
+	}
 	o := kcontroller.Options{Reconciler: claim.NewReconciler(r.mgr,
 		r.remote,
 		GroupVersionKindOf(*localCRD),
-		claim.WithLogger(log.WithValues("controller", coreclaim.ControllerName(xrd.GetName()))),
-		claim.WithRecorder(r.record.WithAnnotations("controller", coreclaim.ControllerName(xrd.GetName()))),
+		append(co, r.claimOpts...)...,
 	)}
 
 	// Since we don't have strongly typed structs for the claims, we set the GVK
@@ -310,16 +857,21 @@ func (r *Reconciler) Reconcile(req reconcile.Request) (reconcile.Result, error)
 	rq := &kunstructured.Unstructured{}
 	rq.SetGroupVersionKind(GroupVersionKindOf(*localCRD))
 
+	// The controller of a claim type watches a single version of it, so it's
+	// restarted when the platform moves the claims to another version.
+	r.restartOnVersionChange(coreclaim.ControllerName(xrd.GetName()), GroupVersionKindOf(*localCRD))
+
 	// We're all set for starting the controller. This assumes that ControllerEngine
 	// Start call is idempotent, hence we don't check whether it was already started
 	// or not.
 	if err := r.engine.Start(coreclaim.ControllerName(xrd.GetName()), o,
-		controller.For(rq, &handler.EnqueueRequestForObject{}),
+		controller.For(rq, h, r.claimPredicates...),
 	); err != nil {
-		return reconcile.Result{RequeueAfter: shortWait}, errors.Wrap(err, localPrefix+errStartController)
+		return reconcile.Result{RequeueAfter: shortWait}, resource.LocalError(err, errStartController)
 	}
+	r.synced(xrd)
 
 	// The reconciliation is completed successfully.
 	xrd.Status.SetConditions(runtimev1alpha1.ReconcileSuccess())
-	return reconcile.Result{RequeueAfter: longWait}, errors.Wrap(r.local.Status().Update(ctx, xrd), localPrefix+errUpdateStatus)
+	return reconcile.Result{RequeueAfter: longWait}, resource.LocalError(r.updateStatus(ctx, xrd, observed), errUpdateStatus)
 }
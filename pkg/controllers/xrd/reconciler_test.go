@@ -19,23 +19,31 @@ package xrd
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/pkg/errors"
 	apiextensions "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kunstructured "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	kcontroller "sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
+	runtimev1alpha1 "github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
 	"github.com/crossplane/crossplane-runtime/pkg/controller"
 	"github.com/crossplane/crossplane-runtime/pkg/resource"
 	"github.com/crossplane/crossplane-runtime/pkg/resource/fake"
 	"github.com/crossplane/crossplane-runtime/pkg/test"
 	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
+
+	"github.com/crossplane/agent/pkg/controllers/claim"
+	agentresource "github.com/crossplane/agent/pkg/resource"
+	"github.com/crossplane/agent/pkg/shard"
 )
 
 var (
@@ -81,7 +89,7 @@ func TestReconcile(t *testing.T) {
 				},
 			},
 			want: want{
-				err:    errors.Wrap(errBoom, localPrefix+errGetXRD),
+				err:    agentresource.LocalError(errBoom, errGetXRD),
 				result: reconcile.Result{RequeueAfter: shortWait},
 			},
 		},
@@ -100,7 +108,7 @@ func TestReconcile(t *testing.T) {
 				},
 			},
 			want: want{
-				err:    errors.Wrap(errBoom, remotePrefix+errFetchCRD),
+				err:    agentresource.RemoteError(errBoom, errFetchCRD),
 				result: reconcile.Result{RequeueAfter: shortWait},
 			},
 		},
@@ -127,7 +135,7 @@ func TestReconcile(t *testing.T) {
 				},
 			},
 			want: want{
-				err:    errors.Wrap(errBoom, localPrefix+errGetCRD),
+				err:    agentresource.LocalError(errBoom, errGetCRD),
 				result: reconcile.Result{RequeueAfter: shortWait},
 			},
 		},
@@ -161,7 +169,7 @@ func TestReconcile(t *testing.T) {
 				},
 			},
 			want: want{
-				err:    errors.Wrap(errBoom, localPrefix+errRemoveFinalizer),
+				err:    agentresource.LocalError(errBoom, errRemoveFinalizer),
 				result: reconcile.Result{RequeueAfter: shortWait},
 			},
 		},
@@ -235,7 +243,7 @@ func TestReconcile(t *testing.T) {
 				},
 			},
 			want: want{
-				err:    errors.Wrap(errBoom, localPrefix+errListCR),
+				err:    agentresource.LocalError(errBoom, errListCR),
 				result: reconcile.Result{RequeueAfter: shortWait},
 			},
 		},
@@ -281,7 +289,7 @@ func TestReconcile(t *testing.T) {
 				},
 			},
 			want: want{
-				err:    errors.Wrap(errBoom, localPrefix+errDeleteCR),
+				err:    agentresource.LocalError(errBoom, errDeleteCR),
 				result: reconcile.Result{RequeueAfter: shortWait},
 			},
 		},
@@ -331,6 +339,125 @@ func TestReconcile(t *testing.T) {
 				result: reconcile.Result{RequeueAfter: tinyWait},
 			},
 		},
+		"DeletionBlockedByClaims": {
+			reason: "The CRD and its claims should be kept if the claims block the deletion",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							if o, ok := obj.(*v1alpha1.CompositeResourceDefinition); ok {
+								ip := &v1alpha1.CompositeResourceDefinition{
+									ObjectMeta: metav1.ObjectMeta{
+										DeletionTimestamp: &now,
+										UID:               "ola",
+									},
+								}
+								ip.DeepCopyInto(o)
+							}
+							return nil
+						},
+						MockList: func(_ context.Context, list runtime.Object, _ ...client.ListOption) error {
+							l := &kunstructured.UnstructuredList{Items: []kunstructured.Unstructured{{}}}
+							l.DeepCopyInto(list.(*kunstructured.UnstructuredList))
+							return nil
+						},
+						MockDelete: func(_ context.Context, _ runtime.Object, _ ...client.DeleteOption) error {
+							t.Errorf("Delete(...): the claims should not be deleted")
+							return nil
+						},
+						MockStatusUpdate: test.NewMockStatusUpdateFn(nil),
+					},
+				},
+				opts: []ReconcilerOption{
+					WithCRDDeletionPolicy(CRDDeletionPolicyBlock, 0),
+					WithCRDFetcher(FetchFn(func(_ context.Context, _ v1alpha1.CompositeResourceDefinition) (*apiextensions.CustomResourceDefinition, error) {
+						return &apiextensions.CustomResourceDefinition{
+							ObjectMeta: metav1.ObjectMeta{
+								CreationTimestamp: now,
+								OwnerReferences: []metav1.OwnerReference{
+									{
+										UID:        "ola",
+										Controller: &trueVal,
+									},
+								},
+							},
+						}, nil
+					})),
+				},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: longWait},
+			},
+		},
+		"ClaimsOrphaned": {
+			reason: "The CRD should be released and its claims kept without the finalizer of the agent if they're orphaned",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							if o, ok := obj.(*v1alpha1.CompositeResourceDefinition); ok {
+								ip := &v1alpha1.CompositeResourceDefinition{
+									ObjectMeta: metav1.ObjectMeta{
+										DeletionTimestamp: &now,
+										UID:               "ola",
+									},
+								}
+								ip.DeepCopyInto(o)
+							}
+							return nil
+						},
+						MockList: func(_ context.Context, list runtime.Object, _ ...client.ListOption) error {
+							c := kunstructured.Unstructured{}
+							c.SetFinalizers([]string{claim.Finalizer})
+							l := &kunstructured.UnstructuredList{Items: []kunstructured.Unstructured{c}}
+							l.DeepCopyInto(list.(*kunstructured.UnstructuredList))
+							return nil
+						},
+						MockDelete: func(_ context.Context, _ runtime.Object, _ ...client.DeleteOption) error {
+							t.Errorf("Delete(...): the claims should not be deleted")
+							return nil
+						},
+						MockUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+							if c, ok := obj.(*kunstructured.Unstructured); ok {
+								if len(c.GetFinalizers()) != 0 {
+									t.Errorf("Update(...): the finalizer of the claim should be removed, got %v", c.GetFinalizers())
+								}
+								return nil
+							}
+							if refs := obj.(metav1.Object).GetOwnerReferences(); len(refs) != 0 {
+								t.Errorf("Update(...): the CRD should be released, got owners %v", refs)
+							}
+							return nil
+						},
+					},
+				},
+				opts: []ReconcilerOption{
+					WithCRDDeletionPolicy(CRDDeletionPolicyOrphan, 0),
+					WithControllerEngine(&MockEngine{MockStop: func(_ string) {}}),
+					WithFinalizer(resource.FinalizerFns{
+						RemoveFinalizerFn: func(_ context.Context, _ resource.Object) error {
+							return nil
+						},
+					}),
+					WithCRDFetcher(FetchFn(func(_ context.Context, _ v1alpha1.CompositeResourceDefinition) (*apiextensions.CustomResourceDefinition, error) {
+						return &apiextensions.CustomResourceDefinition{
+							ObjectMeta: metav1.ObjectMeta{
+								CreationTimestamp: now,
+								OwnerReferences: []metav1.OwnerReference{
+									{
+										UID:        "ola",
+										Controller: &trueVal,
+									},
+								},
+							},
+						}, nil
+					})),
+				},
+			},
+			want: want{
+				result: reconcile.Result{},
+			},
+		},
 		"CRDDeleteFailed": {
 			reason: "We should return the error if CRD cannot be deleted",
 			args: args{
@@ -369,7 +496,7 @@ func TestReconcile(t *testing.T) {
 				},
 			},
 			want: want{
-				err:    errors.Wrap(errBoom, localPrefix+errDeleteCRD),
+				err:    agentresource.LocalError(errBoom, errDeleteCRD),
 				result: reconcile.Result{RequeueAfter: shortWait},
 			},
 		},
@@ -415,6 +542,213 @@ func TestReconcile(t *testing.T) {
 				result: reconcile.Result{RequeueAfter: tinyWait},
 			},
 		},
+		"KindOfOtherShard": {
+			reason: "The XRDs whose claims are of a kind of another shard should be left to its agent",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							x := &v1alpha1.CompositeResourceDefinition{Spec: v1alpha1.CompositeResourceDefinitionSpec{
+								CRDSpecTemplate: v1alpha1.CRDSpecTemplate{Group: "example.org", Version: "v1alpha1"},
+								ClaimNames:      &apiextensions.CustomResourceDefinitionNames{Kind: "Database"},
+							}}
+							x.DeepCopyInto(obj.(*v1alpha1.CompositeResourceDefinition))
+							return nil
+						},
+					},
+				},
+				opts: []ReconcilerOption{
+					WithShard(&shard.Shard{Name: "buckets", Kinds: []schema.GroupKind{{Group: "example.org", Kind: "Bucket"}}}),
+					WithCRDFetcher(FetchFn(func(_ context.Context, _ v1alpha1.CompositeResourceDefinition) (*apiextensions.CustomResourceDefinition, error) {
+						t.Errorf("\nReason: %s\nFetch(...) should not be called", "The XRDs whose claims are of a kind of another shard should be left to its agent")
+						return nil, errBoom
+					})),
+				},
+			},
+			want: want{
+				result: reconcile.Result{},
+			},
+		},
+		"OfferedByLocalCrossplane": {
+			reason: "The claims of XRDs that a local Crossplane offers should not be synced",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							x := &v1alpha1.CompositeResourceDefinition{}
+							x.SetFinalizers([]string{crossplaneOfferedFinalizer})
+							x.DeepCopyInto(obj.(*v1alpha1.CompositeResourceDefinition))
+							return nil
+						},
+						MockStatusUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+							x := obj.(*v1alpha1.CompositeResourceDefinition)
+							if diff := cmp.Diff(agentresource.OfferedByLocalCrossplane(), x.Status.GetCondition(agentresource.TypeAgentSync), test.EquateConditions()); diff != "" {
+								t.Errorf("\nReason: %s\n-want, +got:\n%s", "The conflict should be reported on the XRD", diff)
+							}
+							return nil
+						},
+					},
+				},
+				opts: []ReconcilerOption{
+					WithFinalizer(resource.FinalizerFns{AddFinalizerFn: func(_ context.Context, _ resource.Object) error {
+						t.Errorf("\nReason: %s\nAddFinalizer(...) should not be called", "The claims of XRDs that a local Crossplane offers should not be synced")
+						return nil
+					}}),
+					WithControllerEngine(&MockEngine{MockStop: func(_ string) {}}),
+				},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: longWait},
+			},
+		},
+		"StatusUnchanged": {
+			reason: "The status of an XRD should not be written if it is already up to date",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							x := &v1alpha1.CompositeResourceDefinition{}
+							x.SetFinalizers([]string{crossplaneOfferedFinalizer})
+							x.Status.SetConditions(agentresource.OfferedByLocalCrossplane())
+							x.DeepCopyInto(obj.(*v1alpha1.CompositeResourceDefinition))
+							return nil
+						},
+						MockStatusUpdate: func(_ context.Context, _ runtime.Object, _ ...client.UpdateOption) error {
+							t.Errorf("\nReason: %s\nStatus().Update(...) should not be called", "The status of an XRD should not be written if it is already up to date")
+							return nil
+						},
+					},
+				},
+				opts: []ReconcilerOption{
+					WithControllerEngine(&MockEngine{MockStop: func(_ string) {}}),
+				},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: longWait},
+			},
+		},
+		"ClaimsWithdrawn": {
+			reason: "The claim controller should be stopped if the remote cluster doesn't offer the claims anymore",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: test.NewMockGetFn(nil),
+						MockStatusUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+							x := obj.(*v1alpha1.CompositeResourceDefinition)
+							if diff := cmp.Diff(agentresource.ClaimsWithdrawn(), x.Status.GetCondition(agentresource.TypeAgentSync), test.EquateConditions()); diff != "" {
+								t.Errorf("\nReason: %s\n-want, +got:\n%s", "The withdrawal should be reported on the XRD", diff)
+							}
+							return nil
+						},
+					},
+				},
+				opts: []ReconcilerOption{
+					WithCRDFetcher(FetchFn(func(_ context.Context, _ v1alpha1.CompositeResourceDefinition) (*apiextensions.CustomResourceDefinition, error) {
+						return nil, errors.Wrap(kerrors.NewNotFound(schema.GroupResource{}, ""), errGetCRD)
+					})),
+					WithFinalizer(resource.FinalizerFns{AddFinalizerFn: func(_ context.Context, _ resource.Object) error {
+						t.Errorf("\nReason: %s\nAddFinalizer(...) should not be called", "The claims that aren't offered should not be synced")
+						return nil
+					}}),
+					WithControllerEngine(&MockEngine{MockStop: func(_ string) {}}),
+				},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: shortWait},
+			},
+		},
+		"ClaimCRDMissing": {
+			reason: "The claims of an XRD that still offers them should not be withdrawn as soon as their CRD is gone",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							x := &v1alpha1.CompositeResourceDefinition{Spec: v1alpha1.CompositeResourceDefinitionSpec{
+								ClaimNames: &apiextensions.CustomResourceDefinitionNames{Kind: "Database"},
+							}}
+							x.DeepCopyInto(obj.(*v1alpha1.CompositeResourceDefinition))
+							return nil
+						},
+						MockUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+							if _, ok := obj.(*v1alpha1.CompositeResourceDefinition).GetAnnotations()[agentresource.AnnotationKeyClaimCRDMissing]; !ok {
+								t.Errorf("\nReason: %s\nUpdate(...): the XRD should be annotated", "The time the CRD was found to be gone should be recorded")
+							}
+							return nil
+						},
+					},
+				},
+				opts: []ReconcilerOption{
+					WithCRDFetcher(FetchFn(func(_ context.Context, _ v1alpha1.CompositeResourceDefinition) (*apiextensions.CustomResourceDefinition, error) {
+						return nil, errors.Wrap(kerrors.NewNotFound(schema.GroupResource{}, ""), errGetCRD)
+					})),
+					WithControllerEngine(&MockEngine{MockStop: func(_ string) {
+						t.Errorf("\nReason: %s\nStop(...) should not be called", "The claims should be synced until the CRD is gone for the withdrawal delay")
+					}}),
+				},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: defaultWithdrawalDelay},
+			},
+		},
+		"ClaimCRDStillMissing": {
+			reason: "The claims of an XRD that still offers them should be withdrawn once their CRD is gone for the withdrawal delay",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							x := &v1alpha1.CompositeResourceDefinition{Spec: v1alpha1.CompositeResourceDefinitionSpec{
+								ClaimNames: &apiextensions.CustomResourceDefinitionNames{Kind: "Database"},
+							}}
+							x.SetAnnotations(map[string]string{agentresource.AnnotationKeyClaimCRDMissing: now.Add(-2 * defaultWithdrawalDelay).UTC().Format(time.RFC3339)})
+							x.DeepCopyInto(obj.(*v1alpha1.CompositeResourceDefinition))
+							return nil
+						},
+						MockStatusUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+							x := obj.(*v1alpha1.CompositeResourceDefinition)
+							if diff := cmp.Diff(agentresource.ClaimsWithdrawn(), x.Status.GetCondition(agentresource.TypeAgentSync), test.EquateConditions()); diff != "" {
+								t.Errorf("\nReason: %s\n-want, +got:\n%s", "The withdrawal should be reported on the XRD", diff)
+							}
+							return nil
+						},
+					},
+				},
+				opts: []ReconcilerOption{
+					WithCRDFetcher(FetchFn(func(_ context.Context, _ v1alpha1.CompositeResourceDefinition) (*apiextensions.CustomResourceDefinition, error) {
+						return nil, errors.Wrap(kerrors.NewNotFound(schema.GroupResource{}, ""), errGetCRD)
+					})),
+					WithControllerEngine(&MockEngine{MockStop: func(_ string) {}}),
+				},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: shortWait},
+			},
+		},
+		"ClaimsWithdrawnDeleted": {
+			reason: "The finalizer of a deleted XRD that doesn't offer claims anymore should be removed",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							x := &v1alpha1.CompositeResourceDefinition{ObjectMeta: metav1.ObjectMeta{DeletionTimestamp: &now}}
+							x.DeepCopyInto(obj.(*v1alpha1.CompositeResourceDefinition))
+							return nil
+						},
+					},
+				},
+				opts: []ReconcilerOption{
+					WithCRDFetcher(FetchFn(func(_ context.Context, _ v1alpha1.CompositeResourceDefinition) (*apiextensions.CustomResourceDefinition, error) {
+						return nil, errors.Wrap(kerrors.NewNotFound(schema.GroupResource{}, ""), errGetCRD)
+					})),
+					WithFinalizer(resource.FinalizerFns{RemoveFinalizerFn: func(_ context.Context, _ resource.Object) error {
+						return nil
+					}}),
+					WithControllerEngine(&MockEngine{MockStop: func(_ string) {}}),
+				},
+			},
+			want: want{
+				result: reconcile.Result{},
+			},
+		},
 		"AddFinalizerFailed": {
 			reason: "An error should be returned if we cannot add finalizer to IP",
 			args: args{
@@ -430,7 +764,32 @@ func TestReconcile(t *testing.T) {
 				},
 			},
 			want: want{
-				err:    errors.Wrap(errBoom, localPrefix+errAddFinalizerXRD),
+				err:    agentresource.LocalError(errBoom, errAddFinalizerXRD),
+				result: reconcile.Result{RequeueAfter: shortWait},
+			},
+		},
+		"OverrideCRDFailed": {
+			reason: "An error should be returned if the local overrides cannot be merged over the CRD",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: test.NewMockGetFn(nil),
+					},
+				},
+				opts: []ReconcilerOption{
+					WithFinalizer(resource.FinalizerFns{AddFinalizerFn: func(_ context.Context, _ resource.Object) error {
+						return nil
+					}}),
+					WithCRDFetcher(FetchFn(func(_ context.Context, _ v1alpha1.CompositeResourceDefinition) (*apiextensions.CustomResourceDefinition, error) {
+						return &apiextensions.CustomResourceDefinition{}, nil
+					})),
+					WithCRDOverrider(OverrideFn(func(_ context.Context, _ *apiextensions.CustomResourceDefinition) error {
+						return errBoom
+					})),
+				},
+			},
+			want: want{
+				err:    agentresource.LocalError(errBoom, errOverrideCRD),
 				result: reconcile.Result{RequeueAfter: shortWait},
 			},
 		},
@@ -455,7 +814,49 @@ func TestReconcile(t *testing.T) {
 				},
 			},
 			want: want{
-				err:    errors.Wrap(errBoom, localPrefix+errApplyCRD),
+				err:    agentresource.LocalError(errBoom, errApplyCRD),
+				result: reconcile.Result{RequeueAfter: shortWait},
+			},
+		},
+		"ApplyCRDFailedSchemaDrift": {
+			reason: "The schema drift of the local CRD should be reported if the remote CRD cannot be applied",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							if crd, ok := obj.(*apiextensions.CustomResourceDefinition); ok {
+								crd.SetCreationTimestamp(now)
+								crd.Spec.Validation = &apiextensions.CustomResourceValidation{OpenAPIV3Schema: &apiextensions.JSONSchemaProps{Type: "object"}}
+								crd.Spec.Version = "v1alpha1"
+							}
+							return nil
+						},
+						MockStatusUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+							c := obj.(*v1alpha1.CompositeResourceDefinition).Status.GetCondition(agentresource.TypeSchemaDrift)
+							if c.Reason != agentresource.ReasonSchemaDiverged {
+								t.Errorf("Status().Update(...): the schema drift should be reported, got %v", c)
+							}
+							return nil
+						},
+					},
+				},
+				opts: []ReconcilerOption{
+					WithLocalApplicator(resource.ApplyFn(func(_ context.Context, _ runtime.Object, _ ...resource.ApplyOption) error {
+						return errBoom
+					})),
+					WithFinalizer(resource.FinalizerFns{AddFinalizerFn: func(_ context.Context, _ resource.Object) error {
+						return nil
+					}}),
+					WithCRDFetcher(FetchFn(func(_ context.Context, _ v1alpha1.CompositeResourceDefinition) (*apiextensions.CustomResourceDefinition, error) {
+						return &apiextensions.CustomResourceDefinition{Spec: apiextensions.CustomResourceDefinitionSpec{
+							Version:    "v1alpha1",
+							Validation: &apiextensions.CustomResourceValidation{OpenAPIV3Schema: &apiextensions.JSONSchemaProps{Type: "string"}},
+						}}, nil
+					})),
+				},
+			},
+			want: want{
+				err:    agentresource.LocalError(errBoom, errApplyCRD),
 				result: reconcile.Result{RequeueAfter: shortWait},
 			},
 		},
@@ -464,8 +865,14 @@ func TestReconcile(t *testing.T) {
 			args: args{
 				m: &fake.Manager{
 					Client: &test.MockClient{
-						MockGet:          test.NewMockGetFn(nil),
-						MockStatusUpdate: test.NewMockStatusUpdateFn(nil),
+						MockGet: test.NewMockGetFn(nil),
+						MockStatusUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+							x := obj.(*v1alpha1.CompositeResourceDefinition)
+							if diff := cmp.Diff(agentresource.CRDNotEstablished(""), x.Status.GetCondition(runtimev1alpha1.TypeSynced), test.EquateConditions()); diff != "" {
+								t.Errorf("\nReason: %s\n-want, +got:\n%s", "The XRD should report that its CRD isn't established", diff)
+							}
+							return nil
+						},
 					},
 				},
 				opts: []ReconcilerOption{
@@ -484,6 +891,104 @@ func TestReconcile(t *testing.T) {
 				result: reconcile.Result{RequeueAfter: tinyWait},
 			},
 		},
+		"DefaultCompositionRecorded": {
+			reason: "The default Composition of the XRD should be recorded on the CRD",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+							if xrd, ok := obj.(*v1alpha1.CompositeResourceDefinition); ok {
+								xrd.Spec.DefaultCompositionRef = &runtimev1alpha1.Reference{Name: "small-db"}
+							}
+							return nil
+						},
+						MockStatusUpdate: test.NewMockStatusUpdateFn(nil),
+					},
+				},
+				opts: []ReconcilerOption{
+					WithDefaultCompositions(),
+					WithLocalApplicator(resource.ApplyFn(func(_ context.Context, obj runtime.Object, _ ...resource.ApplyOption) error {
+						got := obj.(*apiextensions.CustomResourceDefinition).GetAnnotations()[agentresource.AnnotationKeyDefaultComposition]
+						if diff := cmp.Diff("small-db", got); diff != "" {
+							t.Errorf("\n-want default composition, +got default composition:\n%s", diff)
+						}
+						return nil
+					})),
+					WithFinalizer(resource.FinalizerFns{AddFinalizerFn: func(_ context.Context, _ resource.Object) error {
+						return nil
+					}}),
+					WithCRDFetcher(FetchFn(func(_ context.Context, _ v1alpha1.CompositeResourceDefinition) (*apiextensions.CustomResourceDefinition, error) {
+						return &apiextensions.CustomResourceDefinition{}, nil
+					})),
+				},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: tinyWait},
+			},
+		},
+		"DefaultCompositionRemoved": {
+			reason: "The default Composition should be removed from the CRD once the XRD has none",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet:          test.NewMockGetFn(nil),
+						MockStatusUpdate: test.NewMockStatusUpdateFn(nil),
+					},
+				},
+				opts: []ReconcilerOption{
+					WithDefaultCompositions(),
+					WithLocalApplicator(resource.ApplyFn(func(_ context.Context, obj runtime.Object, _ ...resource.ApplyOption) error {
+						if _, ok := obj.(*apiextensions.CustomResourceDefinition).GetAnnotations()[agentresource.AnnotationKeyDefaultComposition]; ok {
+							t.Errorf("\nReason: %s\nApply(...): the CRD should not have a default composition", "The default Composition should be removed from the CRD once the XRD has none")
+						}
+						return nil
+					})),
+					WithFinalizer(resource.FinalizerFns{AddFinalizerFn: func(_ context.Context, _ resource.Object) error {
+						return nil
+					}}),
+					WithCRDFetcher(FetchFn(func(_ context.Context, _ v1alpha1.CompositeResourceDefinition) (*apiextensions.CustomResourceDefinition, error) {
+						crd := &apiextensions.CustomResourceDefinition{}
+						crd.SetAnnotations(map[string]string{agentresource.AnnotationKeyDefaultComposition: "small-db"})
+						return crd, nil
+					})),
+				},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: tinyWait},
+			},
+		},
+		"ConversionRendered": {
+			reason: "The conversion webhook of the remote CRD should be rendered before the CRD is applied",
+			args: args{
+				m: &fake.Manager{
+					Client: &test.MockClient{
+						MockGet:          test.NewMockGetFn(nil),
+						MockStatusUpdate: test.NewMockStatusUpdateFn(nil),
+					},
+				},
+				opts: []ReconcilerOption{
+					WithCRDConversion(agentresource.CRDConversion{Strategy: agentresource.ConversionStrategyNone}),
+					WithLocalApplicator(resource.ApplyFn(func(_ context.Context, obj runtime.Object, _ ...resource.ApplyOption) error {
+						want := &apiextensions.CustomResourceConversion{Strategy: apiextensions.NoneConverter}
+						if diff := cmp.Diff(want, obj.(*apiextensions.CustomResourceDefinition).Spec.Conversion); diff != "" {
+							t.Errorf("\n-want conversion, +got conversion:\n%s", diff)
+						}
+						return nil
+					})),
+					WithFinalizer(resource.FinalizerFns{AddFinalizerFn: func(_ context.Context, _ resource.Object) error {
+						return nil
+					}}),
+					WithCRDFetcher(FetchFn(func(_ context.Context, _ v1alpha1.CompositeResourceDefinition) (*apiextensions.CustomResourceDefinition, error) {
+						return &apiextensions.CustomResourceDefinition{Spec: apiextensions.CustomResourceDefinitionSpec{
+							Conversion: &apiextensions.CustomResourceConversion{Strategy: apiextensions.WebhookConverter},
+						}}, nil
+					})),
+				},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: tinyWait},
+			},
+		},
 		"StartControllerFailed": {
 			reason: "The error should be returned if engine cannot start the controller",
 			args: args{
@@ -517,7 +1022,7 @@ func TestReconcile(t *testing.T) {
 				},
 			},
 			want: want{
-				err:    errors.Wrap(errBoom, localPrefix+errStartController),
+				err:    agentresource.LocalError(errBoom, errStartController),
 				result: reconcile.Result{RequeueAfter: shortWait},
 			},
 		},
@@ -574,3 +1079,39 @@ func TestReconcile(t *testing.T) {
 		})
 	}
 }
+
+func TestNewReconcilerLocalApplicator(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		opts   func(a resource.Applicator) []ReconcilerOption
+	}{
+		"ApplicatorFirst": {
+			reason: "The given Applicator should be kept if the CRD version is given after it.",
+			opts: func(a resource.Applicator) []ReconcilerOption {
+				return []ReconcilerOption{WithLocalApplicator(a), WithCRDVersion(agentresource.CRDVersionV1)}
+			},
+		},
+		"CRDVersionFirst": {
+			reason: "The given Applicator should be kept if the CRD version is given before it.",
+			opts: func(a resource.Applicator) []ReconcilerOption {
+				return []ReconcilerOption{WithCRDVersion(agentresource.CRDVersionV1), WithLocalApplicator(a)}
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			applied := false
+			a := resource.ApplyFn(func(_ context.Context, _ runtime.Object, _ ...resource.ApplyOption) error {
+				applied = true
+				return nil
+			})
+			r := NewReconciler(&fake.Manager{Client: &test.MockClient{}}, &test.MockClient{}, tc.opts(a)...)
+			if err := r.local.Apply(context.Background(), &apiextensions.CustomResourceDefinition{}); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(true, applied); diff != "" {
+				t.Errorf("\n%s\nApply(...): -want applied, +got applied:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
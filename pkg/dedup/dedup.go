@@ -0,0 +1,238 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package dedup suppresses the identical error logs that a broken object
+// produces on every sync, so that a single object cannot flood the log
+// storage.
+package dedup
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	defaultWindow = 5 * time.Minute
+
+	// sweepSize is how many log lines the Filter remembers before it forgets
+	// the ones whose window passed.
+	sweepSize = 1024
+
+	keyError    = "error"
+	keyRepeated = "repeated"
+)
+
+// Option is used to configure *Filter.
+type Option func(*Filter)
+
+// WithWindow specifies how long the identical error logs are suppressed for
+// after one of them is logged.
+func WithWindow(d time.Duration) Option {
+	return func(f *Filter) {
+		f.window = d
+	}
+}
+
+// WithIgnoredKeys specifies the keys whose values don't make two log lines
+// different, e.g. the ID of the sync that logged them.
+func WithIgnoredKeys(keys ...string) Option {
+	return func(f *Filter) {
+		for _, k := range keys {
+			f.ignored[k] = true
+		}
+	}
+}
+
+// NewFilter returns a new *Filter.
+func NewFilter(opts ...Option) *Filter {
+	f := &Filter{
+		window:  defaultWindow,
+		ignored: map[string]bool{},
+		now:     time.Now,
+		seen:    map[string]*occurrence{},
+	}
+	for _, fn := range opts {
+		fn(f)
+	}
+	return f
+}
+
+// A Filter decides which of the identical error logs are logged. The first
+// one is, and the rest are suppressed until the window passes. The next one
+// after that is logged with the number of the suppressed ones.
+type Filter struct {
+	window  time.Duration
+	ignored map[string]bool
+	now     func() time.Time
+
+	mu   sync.Mutex
+	seen map[string]*occurrence
+}
+
+type occurrence struct {
+	logged     time.Time
+	suppressed int
+}
+
+// allow returns whether the log line with the supplied key should be logged,
+// and how many identical ones were suppressed since it was last logged.
+func (f *Filter) allow(key string) (bool, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := f.now()
+	o, ok := f.seen[key]
+	if ok && now.Sub(o.logged) < f.window {
+		o.suppressed++
+		return false, 0
+	}
+	if !ok && len(f.seen) >= sweepSize {
+		f.sweep(now)
+	}
+	suppressed := 0
+	if ok {
+		suppressed = o.suppressed
+	}
+	f.seen[key] = &occurrence{logged: now}
+	return true, suppressed
+}
+
+// sweep forgets the log lines whose window passed. It has to be called with
+// the lock held.
+func (f *Filter) sweep(now time.Time) {
+	for k, o := range f.seen {
+		if now.Sub(o.logged) >= f.window {
+			delete(f.seen, k)
+		}
+	}
+}
+
+// render returns the supplied key-value pairs without the ignored keys and
+// the times, e.g. the requeue-after of the reconcilers, which differ between
+// otherwise identical log lines.
+func (f *Filter) render(kv []interface{}) string {
+	b := &strings.Builder{}
+	for i := 0; i+1 < len(kv); i += 2 {
+		if k, ok := kv[i].(string); ok && f.ignored[k] {
+			continue
+		}
+		switch kv[i+1].(type) {
+		case time.Time, *time.Time:
+			continue
+		}
+		fmt.Fprintf(b, "%v=%v ", kv[i], kv[i+1])
+	}
+	return b.String()
+}
+
+// New returns a logr.Logger that logs to the supplied one, except for the
+// error logs that the supplied Filter suppresses. The error logs are the ones
+// logged with Error, and the ones with an error value at any level.
+func New(l logr.Logger, f *Filter) logr.Logger {
+	return &logger{Logger: l, filter: f}
+}
+
+type logger struct {
+	logr.Logger
+	filter *Filter
+
+	// name and values identify the logger, since the values it was created
+	// with aren't passed to its log calls.
+	name   string
+	values string
+}
+
+func (l *logger) Info(msg string, kv ...interface{}) {
+	if kv, ok := l.dedup(0, msg, "", kv); ok {
+		l.Logger.Info(msg, kv...)
+	}
+}
+
+func (l *logger) Error(err error, msg string, kv ...interface{}) {
+	e := "<nil>"
+	if err != nil {
+		e = err.Error()
+	}
+	if kv, ok := l.dedup(-1, msg, e, kv); ok {
+		l.Logger.Error(err, msg, kv...)
+	}
+}
+
+func (l *logger) V(level int) logr.InfoLogger {
+	return &infoLogger{InfoLogger: l.Logger.V(level), parent: l, level: level}
+}
+
+func (l *logger) WithValues(kv ...interface{}) logr.Logger {
+	return &logger{
+		Logger: l.Logger.WithValues(kv...),
+		filter: l.filter,
+		name:   l.name,
+		values: l.values + l.filter.render(kv),
+	}
+}
+
+func (l *logger) WithName(name string) logr.Logger {
+	return &logger{
+		Logger: l.Logger.WithName(name),
+		filter: l.filter,
+		name:   l.name + "/" + name,
+		values: l.values,
+	}
+}
+
+// dedup returns the key-value pairs that the supplied log line should be
+// logged with, and whether it should be logged at all. The info logs without
+// an error value are always logged.
+func (l *logger) dedup(level int, msg, err string, kv []interface{}) ([]interface{}, bool) {
+	if err == "" && !hasError(kv) {
+		return kv, true
+	}
+	ok, n := l.filter.allow(fmt.Sprintf("%d|%s|%s|%s|%s|%s", level, l.name, l.values, msg, err, l.filter.render(kv)))
+	if !ok {
+		return nil, false
+	}
+	if n > 0 {
+		kv = append(kv[:len(kv):len(kv)], keyRepeated, n)
+	}
+	return kv, true
+}
+
+func hasError(kv []interface{}) bool {
+	for i := 0; i+1 < len(kv); i += 2 {
+		if kv[i] == keyError {
+			return true
+		}
+	}
+	return false
+}
+
+type infoLogger struct {
+	logr.InfoLogger
+	parent *logger
+	level  int
+}
+
+func (l *infoLogger) Info(msg string, kv ...interface{}) {
+	if !l.Enabled() {
+		return
+	}
+	if kv, ok := l.parent.dedup(l.level, msg, "", kv); ok {
+		l.InfoLogger.Info(msg, kv...)
+	}
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dedup
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+)
+
+// recorder is a logr.Logger that records the lines it logs.
+type recorder struct {
+	lines *[]string
+}
+
+func (r recorder) Info(msg string, kv ...interface{}) {
+	*r.lines = append(*r.lines, strings.TrimSpace(fmt.Sprintln(append([]interface{}{msg}, kv...)...)))
+}
+func (r recorder) Enabled() bool { return true }
+func (r recorder) Error(err error, msg string, kv ...interface{}) {
+	*r.lines = append(*r.lines, strings.TrimSpace(fmt.Sprintln(append([]interface{}{msg, err}, kv...)...)))
+}
+func (r recorder) V(_ int) logr.InfoLogger                 { return r }
+func (r recorder) WithValues(_ ...interface{}) logr.Logger { return r }
+func (r recorder) WithName(_ string) logr.Logger           { return r }
+
+func TestLogger(t *testing.T) {
+	errBoom := errors.New("boom")
+	start := time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	cases := map[string]struct {
+		reason string
+		log    func(l logr.Logger, at func(time.Duration))
+		want   []string
+	}{
+		"Suppressed": {
+			reason: "The identical errors of the same object should be logged once per window, and then with the number of the suppressed ones",
+			log: func(l logr.Logger, at func(time.Duration)) {
+				for i := 0; i < 3; i++ {
+					at(time.Duration(i) * 30 * time.Second)
+					l.WithValues("request", "cool/db", "sync-id", i).Error(errBoom, "Reconciler error")
+				}
+				at(10 * time.Minute)
+				l.WithValues("request", "cool/db", "sync-id", 4).Error(errBoom, "Reconciler error")
+			},
+			want: []string{"Reconciler error boom", "Reconciler error boom repeated 2"},
+		},
+		"DifferentObjects": {
+			reason: "The identical errors of different objects should all be logged",
+			log: func(l logr.Logger, _ func(time.Duration)) {
+				l.WithValues("request", "cool/db").Error(errBoom, "Reconciler error")
+				l.WithValues("request", "cool/bucket").Error(errBoom, "Reconciler error")
+			},
+			want: []string{"Reconciler error boom", "Reconciler error boom"},
+		},
+		"DebugErrors": {
+			reason: "The debug logs with an error value should be deduplicated too",
+			log: func(l logr.Logger, _ func(time.Duration)) {
+				l.V(1).Info("Cannot get resource from remote", "error", errBoom)
+				l.V(1).Info("Cannot get resource from remote", "error", errBoom)
+			},
+			want: []string{"Cannot get resource from remote error boom"},
+		},
+		"ControllerLogs": {
+			reason: "The identical errors that a reconciler logs with a requeue time should be deduplicated",
+			log: func(l logr.Logger, at func(time.Duration)) {
+				log := logging.NewLogrLogger(l.WithValues("controller", "claim/databases.example.org", "request", "cool/db"))
+				for i := 0; i < 3; i++ {
+					at(time.Duration(i) * 30 * time.Second)
+					log.Debug("Cannot get remote claim", "error", errBoom, "requeue-after", start.Add(time.Duration(i+1)*30*time.Second))
+				}
+			},
+			want: []string{"Cannot get remote claim error boom requeue-after 2020-10-01 12:00:30 +0000 UTC"},
+		},
+		"InfoWithoutErrors": {
+			reason: "The logs without an error value should never be suppressed",
+			log: func(l logr.Logger, _ func(time.Duration)) {
+				l.Info("Reconciling")
+				l.Info("Reconciling")
+			},
+			want: []string{"Reconciling", "Reconciling"},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			now := start
+			f := NewFilter(WithIgnoredKeys("sync-id"))
+			f.now = func() time.Time { return now }
+			lines := []string{}
+			tc.log(New(recorder{lines: &lines}, f), func(d time.Duration) { now = start.Add(d) })
+			if diff := cmp.Diff(tc.want, lines); diff != "" {
+				t.Errorf("\nReason: %s\nlogged lines: -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
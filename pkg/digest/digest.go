@@ -0,0 +1,147 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package digest summarizes the syncs of the agent per kind and logs the
+// summaries periodically at info level, so that the steady state of an agent
+// can be followed in long-term log retention without debug logs.
+package digest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+)
+
+const defaultInterval = 10 * time.Minute
+
+// An Operation that the agent performed while syncing an object.
+type Operation string
+
+// Operations.
+const (
+	// Synced objects were synced without errors, whether or not anything
+	// changed.
+	Synced Operation = "synced"
+
+	// Created, Updated and Deleted objects were written to the remote cluster.
+	Created Operation = "created"
+	Updated Operation = "updated"
+	Deleted Operation = "deleted"
+
+	// Failed syncs ended with an error.
+	Failed Operation = "errors"
+)
+
+var operations = []Operation{Synced, Created, Updated, Deleted, Failed}
+
+// A Recorder records the operations that the agent performed per kind.
+type Recorder interface {
+	Record(kind string, op Operation)
+}
+
+// NewNopRecorder returns a Recorder that does nothing.
+func NewNopRecorder() Recorder {
+	return nopRecorder{}
+}
+
+type nopRecorder struct{}
+
+func (nopRecorder) Record(_ string, _ Operation) {}
+
+// LoggerOption is used to configure *Logger.
+type LoggerOption func(*Logger)
+
+// WithInterval specifies how often the Logger should log the digests.
+func WithInterval(d time.Duration) LoggerOption {
+	return func(l *Logger) {
+		l.interval = d
+	}
+}
+
+// NewLogger returns a new *Logger that logs its digests to the supplied
+// logger.
+func NewLogger(log logging.Logger, opts ...LoggerOption) *Logger {
+	l := &Logger{
+		log:      log,
+		interval: defaultInterval,
+		counts:   map[string]map[Operation]int{},
+	}
+	for _, f := range opts {
+		f(l)
+	}
+	return l
+}
+
+// Logger is a Recorder and a manager.Runnable that logs a digest of the
+// operations recorded for every kind once per interval. The kinds that had no
+// operations in an interval are not logged.
+type Logger struct {
+	log      logging.Logger
+	interval time.Duration
+
+	mu     sync.Mutex
+	counts map[string]map[Operation]int
+}
+
+// Record counts the operation for the supplied kind. It's safe for concurrent
+// use.
+func (l *Logger) Record(kind string, op Operation) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.counts[kind] == nil {
+		l.counts[kind] = map[Operation]int{}
+	}
+	l.counts[kind][op]++
+}
+
+// Start logs the digests until the stop channel is closed, and the digests of
+// the last interval once it is.
+func (l *Logger) Start(stop <-chan struct{}) error {
+	t := time.NewTicker(l.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			l.Flush()
+			return nil
+		case <-t.C:
+			l.Flush()
+		}
+	}
+}
+
+// Flush logs the digests recorded since the last flush and resets them.
+func (l *Logger) Flush() {
+	l.mu.Lock()
+	counts := l.counts
+	l.counts = map[string]map[Operation]int{}
+	l.mu.Unlock()
+
+	kinds := make([]string, 0, len(counts))
+	for k := range counts {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+	for _, k := range kinds {
+		kv := []interface{}{"kind", k, "interval", l.interval.String()}
+		for _, op := range operations {
+			kv = append(kv, string(op), counts[k][op])
+		}
+		l.log.Info("Sync digest", kv...)
+	}
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package digest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+)
+
+// A recordingLogger records the key/value pairs of its Info messages.
+type recordingLogger struct {
+	infos [][]interface{}
+}
+
+func (l *recordingLogger) Info(_ string, kv ...interface{}) { l.infos = append(l.infos, kv) }
+func (l *recordingLogger) Debug(_ string, _ ...interface{}) {}
+func (l *recordingLogger) WithValues(_ ...interface{}) logging.Logger {
+	return l
+}
+
+func TestLoggerFlush(t *testing.T) {
+	log := &recordingLogger{}
+	l := NewLogger(log, WithInterval(5*time.Minute))
+	l.Record("Database", Synced)
+	l.Record("Database", Synced)
+	l.Record("Database", Created)
+	l.Record("Bucket", Failed)
+	l.Flush()
+
+	want := [][]interface{}{
+		{"kind", "Bucket", "interval", "5m0s", "synced", 0, "created", 0, "updated", 0, "deleted", 0, "errors", 1},
+		{"kind", "Database", "interval", "5m0s", "synced", 2, "created", 1, "updated", 0, "deleted", 0, "errors", 0},
+	}
+	if diff := cmp.Diff(want, log.infos); diff != "" {
+		t.Errorf("\nReason: %s\nl.Flush(): -want, +got:\n%s", "A digest should be logged per kind in alphabetical order", diff)
+	}
+
+	log.infos = nil
+	l.Flush()
+	if diff := cmp.Diff([][]interface{}(nil), log.infos); diff != "" {
+		t.Errorf("\nReason: %s\nl.Flush(): -want, +got:\n%s", "The counts should be reset after every flush", diff)
+	}
+}
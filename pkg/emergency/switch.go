@@ -0,0 +1,122 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package emergency contains the break-glass switch that halts all writes to
+// the remote cluster, e.g. while the central cluster is under maintenance.
+package emergency
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane-runtime/pkg/resource"
+
+	"github.com/crossplane/agent/pkg/metrics"
+)
+
+// AnnotationKeyEmergencyStop is the key of the annotation that engages the
+// emergency stop when it's set to "true" on the watched ConfigMap.
+const AnnotationKeyEmergencyStop = "agent.crossplane.io/emergency-stop"
+
+const errGetConfigMap = "cannot get emergency stop configmap"
+
+// SwitchOption is used to configure *Switch.
+type SwitchOption func(*Switch)
+
+// WithEngaged specifies whether the Switch is engaged regardless of the
+// ConfigMap, e.g. when the agent is started with the emergency stop flag.
+func WithEngaged(engaged bool) SwitchOption {
+	return func(s *Switch) {
+		s.engaged = engaged
+	}
+}
+
+// WithConfigMap specifies the ConfigMap that the Switch should consult on
+// every check. The Switch is engaged while the ConfigMap is annotated with
+// AnnotationKeyEmergencyStop set to "true".
+func WithConfigMap(kube client.Reader, key types.NamespacedName) SwitchOption {
+	return func(s *Switch) {
+		s.kube = kube
+		s.key = key
+	}
+}
+
+// WithLogger specifies how the Switch should log messages.
+func WithLogger(l logging.Logger) SwitchOption {
+	return func(s *Switch) {
+		s.log = l
+	}
+}
+
+// NewSwitch returns a new *Switch that is not engaged unless configured
+// otherwise.
+func NewSwitch(opts ...SwitchOption) *Switch {
+	s := &Switch{log: logging.NewNopLogger()}
+	for _, f := range opts {
+		f(s)
+	}
+	return s
+}
+
+// Switch reports whether the writes to the remote cluster should be halted.
+// It's safe to share a single Switch between reconcilers.
+type Switch struct {
+	engaged bool
+	kube    client.Reader
+	key     types.NamespacedName
+	log     logging.Logger
+
+	mu   sync.Mutex
+	last bool
+}
+
+// Engaged returns whether the emergency stop is engaged. A missing ConfigMap
+// means it's not engaged.
+func (s *Switch) Engaged(ctx context.Context) (bool, error) {
+	engaged := s.engaged
+	if !engaged && s.kube != nil {
+		cm := &corev1.ConfigMap{}
+		err := s.kube.Get(ctx, s.key, cm)
+		if resource.IgnoreNotFound(err) != nil {
+			return false, errors.Wrap(err, errGetConfigMap)
+		}
+		engaged = err == nil && cm.GetAnnotations()[AnnotationKeyEmergencyStop] == "true"
+	}
+	s.record(engaged)
+	return engaged, nil
+}
+
+func (s *Switch) record(engaged bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if engaged == s.last {
+		return
+	}
+	s.last = engaged
+	if engaged {
+		metrics.EmergencyStopEngaged.Set(1)
+		s.log.Info("Emergency stop is engaged, writes to the remote cluster are halted")
+		return
+	}
+	metrics.EmergencyStopEngaged.Set(0)
+	s.log.Info("Emergency stop is disengaged, writes to the remote cluster are resumed")
+}
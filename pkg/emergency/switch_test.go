@@ -0,0 +1,95 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package emergency
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+)
+
+var errBoom = errors.New("boom")
+
+func TestSwitch(t *testing.T) {
+	key := types.NamespacedName{Namespace: "crossplane-system", Name: "stop"}
+	withAnnotation := func(val string) test.MockGetFn {
+		return func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+			cm := obj.(*corev1.ConfigMap)
+			cm.SetAnnotations(map[string]string{AnnotationKeyEmergencyStop: val})
+			return nil
+		}
+	}
+	type want struct {
+		engaged bool
+		err     error
+	}
+	cases := map[string]struct {
+		reason string
+		opts   []SwitchOption
+		want   want
+	}{
+		"Default": {
+			reason: "The switch should not be engaged by default",
+		},
+		"Flag": {
+			reason: "The switch should be engaged if it's configured to be",
+			opts:   []SwitchOption{WithEngaged(true)},
+			want:   want{engaged: true},
+		},
+		"ConfigMapMissing": {
+			reason: "The switch should not be engaged if the ConfigMap does not exist",
+			opts: []SwitchOption{WithConfigMap(&test.MockClient{
+				MockGet: test.NewMockGetFn(kerrors.NewNotFound(schema.GroupResource{}, key.Name)),
+			}, key)},
+		},
+		"ConfigMapGetFailed": {
+			reason: "An error should be returned if the ConfigMap cannot be fetched",
+			opts:   []SwitchOption{WithConfigMap(&test.MockClient{MockGet: test.NewMockGetFn(errBoom)}, key)},
+			want:   want{err: errors.Wrap(errBoom, errGetConfigMap)},
+		},
+		"ConfigMapNotAnnotated": {
+			reason: "The switch should not be engaged unless the annotation is true",
+			opts:   []SwitchOption{WithConfigMap(&test.MockClient{MockGet: withAnnotation("false")}, key)},
+		},
+		"ConfigMapAnnotated": {
+			reason: "The switch should be engaged if the annotation is true",
+			opts:   []SwitchOption{WithConfigMap(&test.MockClient{MockGet: withAnnotation("true")}, key)},
+			want:   want{engaged: true},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			engaged, err := NewSwitch(tc.opts...).Engaged(context.Background())
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\ns.Engaged(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.engaged, engaged); diff != "" {
+				t.Errorf("\nReason: %s\ns.Engaged(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
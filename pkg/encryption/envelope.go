@@ -0,0 +1,263 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package encryption encrypts the connection secrets that the agent writes to
+// the local cluster, for clusters whose etcd encryption isn't trusted.
+package encryption
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/crossplane/crossplane-runtime/pkg/meta"
+	"github.com/crossplane/crossplane-runtime/pkg/resource"
+
+	agentresource "github.com/crossplane/agent/pkg/resource"
+)
+
+// The annotations of an encrypted secret.
+const (
+	// AnnotationKeyKeyID holds the ID of the key encryption key that the data
+	// key is encrypted with.
+	AnnotationKeyKeyID = "agent.crossplane.io/encryption-key-id"
+
+	// AnnotationKeyDataKey holds the data key that the values of the secret
+	// are encrypted with, encrypted with the key encryption key and base64
+	// encoded.
+	AnnotationKeyDataKey = "agent.crossplane.io/encrypted-data-key"
+
+	// AnnotationKeyDigest holds a keyed digest of the values of the secret
+	// before they're encrypted, so that the secret isn't rewritten with new
+	// ciphertexts when its values don't change.
+	AnnotationKeyDigest = "agent.crossplane.io/encryption-digest"
+)
+
+// KeySize is the size of the key encryption keys in bytes.
+const KeySize = 32
+
+const (
+	errKeySize        = "key encryption key has to be 32 bytes"
+	errGenerateKey    = "cannot generate data key"
+	errEncrypt        = "cannot encrypt"
+	errDecrypt        = "cannot decrypt"
+	errFmtWrongKey    = "secret is encrypted with key %s, not %s"
+	errNotEncrypted   = "secret is not encrypted"
+	errDecodeDataKey  = "cannot decode data key"
+	errFmtDecryptData = "cannot decrypt the value of key %s"
+	errReadKeyFile    = "cannot read key file"
+	errDecodeKeyFile  = "cannot decode key file"
+)
+
+// ReadKeyFile reads a key encryption key from the supplied file, which holds
+// it base64 encoded, e.g. the output of head -c 32 /dev/urandom | base64.
+func ReadKeyFile(path string) ([]byte, error) {
+	raw, err := ioutil.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, errors.Wrap(err, errReadKeyFile)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(raw)))
+	return key, errors.Wrap(err, errDecodeKeyFile)
+}
+
+// An Encrypter encrypts the data of a secret before it's written.
+type Encrypter interface {
+	Encrypt(ctx context.Context, s *corev1.Secret) error
+}
+
+// NewEnvelope returns a new *Envelope that encrypts with the supplied 32
+// byte key encryption key.
+func NewEnvelope(kek []byte) (*Envelope, error) {
+	if len(kek) != KeySize {
+		return nil, errors.New(errKeySize)
+	}
+	sum := sha256.Sum256(kek)
+	return &Envelope{kek: kek, id: hex.EncodeToString(sum[:8])}, nil
+}
+
+// Envelope encrypts the values of secrets with AES-256-GCM using a data key
+// that's generated for every secret and encrypted with the key encryption
+// key. The key name is the additional authenticated data of its value, so
+// values cannot be moved between keys. Values are stored as the nonce
+// followed by the ciphertext.
+type Envelope struct {
+	kek []byte
+	id  string
+}
+
+// KeyID returns the ID of the key encryption key, which is the hex encoded
+// first eight bytes of its SHA-256 sum.
+func (e *Envelope) KeyID() string {
+	return e.id
+}
+
+// Encrypt replaces the values of the supplied secret with their ciphertexts
+// and records the encrypted data key in its annotations.
+func (e *Envelope) Encrypt(_ context.Context, s *corev1.Secret) error {
+	dek := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, dek); err != nil {
+		return errors.Wrap(err, errGenerateKey)
+	}
+	wrapped, err := seal(e.kek, dek, []byte(e.id))
+	if err != nil {
+		return err
+	}
+	digest := e.digest(s.Data)
+	for k, v := range s.Data {
+		ct, err := seal(dek, v, []byte(k))
+		if err != nil {
+			return err
+		}
+		s.Data[k] = ct
+	}
+	meta.AddAnnotations(s, map[string]string{
+		AnnotationKeyKeyID:   e.id,
+		AnnotationKeyDataKey: base64.StdEncoding.EncodeToString(wrapped),
+		AnnotationKeyDigest:  digest,
+	})
+	return nil
+}
+
+// Decrypt replaces the values of the supplied secret, which is encrypted by
+// Encrypt, with their plaintexts. It's meant for the decryptors that make the
+// secrets available to the applications.
+func (e *Envelope) Decrypt(s *corev1.Secret) error {
+	id, ok := s.GetAnnotations()[AnnotationKeyKeyID]
+	if !ok {
+		return errors.New(errNotEncrypted)
+	}
+	if id != e.id {
+		return errors.Errorf(errFmtWrongKey, id, e.id)
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(s.GetAnnotations()[AnnotationKeyDataKey])
+	if err != nil {
+		return errors.Wrap(err, errDecodeDataKey)
+	}
+	dek, err := open(e.kek, wrapped, []byte(e.id))
+	if err != nil {
+		return errors.Wrap(err, errDecodeDataKey)
+	}
+	for k, v := range s.Data {
+		pt, err := open(dek, v, []byte(k))
+		if err != nil {
+			return errors.Wrapf(err, errFmtDecryptData, k)
+		}
+		s.Data[k] = pt
+	}
+	meta.RemoveAnnotations(s, AnnotationKeyKeyID, AnnotationKeyDataKey, AnnotationKeyDigest)
+	return nil
+}
+
+// digest returns the HMAC-SHA256 of the supplied values keyed with the key
+// encryption key, so that it tells nothing about the values without the key.
+func (e *Envelope) digest(data map[string][]byte) string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	h := hmac.New(sha256.New, e.kek)
+	for _, k := range keys {
+		_, _ = h.Write([]byte(k))
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write(data[k])
+		_, _ = h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// KeepUnchanged returns an ApplyOption that keeps the ciphertexts and the
+// data key of the current secret if it's encrypted from the same resource
+// version of the source secret, with the same key encryption key and values as
+// the desired one, since every encryption produces new ciphertexts. The
+// desired secret has to record the resource version of its source in the
+// agent.crossplane.io/source-resource-version annotation to be kept.
+func KeepUnchanged() resource.ApplyOption {
+	return func(_ context.Context, current, desired runtime.Object) error {
+		c, ok := current.(*corev1.Secret)
+		if !ok {
+			return nil
+		}
+		d, ok := desired.(*corev1.Secret)
+		if !ok {
+			return nil
+		}
+		if !sameEncryption(c, d) {
+			return nil
+		}
+		d.Data = c.Data
+		meta.AddAnnotations(d, map[string]string{AnnotationKeyDataKey: c.GetAnnotations()[AnnotationKeyDataKey]})
+		return nil
+	}
+}
+
+func sameEncryption(current, desired metav1.Object) bool {
+	for _, k := range []string{agentresource.AnnotationKeySourceResourceVersion, AnnotationKeyKeyID, AnnotationKeyDigest} {
+		v, ok := desired.GetAnnotations()[k]
+		if !ok || current.GetAnnotations()[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func seal(key, plaintext, ad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.Wrap(err, errEncrypt)
+	}
+	return gcm.Seal(nonce, nonce, plaintext, ad), nil
+}
+
+func open(key, ciphertext, ad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, errors.New(errDecrypt)
+	}
+	pt, err := gcm.Open(nil, ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():], ad)
+	return pt, errors.Wrap(err, errDecrypt)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	b, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, errEncrypt)
+	}
+	gcm, err := cipher.NewGCM(b)
+	return gcm, errors.Wrap(err, errEncrypt)
+}
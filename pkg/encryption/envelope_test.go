@@ -0,0 +1,130 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+
+	agentresource "github.com/crossplane/agent/pkg/resource"
+)
+
+func secret() *corev1.Secret {
+	return &corev1.Secret{Data: map[string][]byte{"username": []byte("admin"), "password": []byte("hunter2")}}
+}
+
+func TestEnvelope(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, KeySize)
+	e, err := NewEnvelope(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := secret()
+	if err := e.Encrypt(context.Background(), s); err != nil {
+		t.Fatalf("Encrypt(...): %s", err)
+	}
+	if bytes.Equal(s.Data["password"], []byte("hunter2")) {
+		t.Errorf("Encrypt(...): the values should be encrypted")
+	}
+	if s.GetAnnotations()[AnnotationKeyKeyID] != e.KeyID() {
+		t.Errorf("Encrypt(...): the secret should be annotated with the key ID")
+	}
+
+	other, _ := NewEnvelope(bytes.Repeat([]byte{2}, KeySize))
+	if err := other.Decrypt(s.DeepCopy()); err == nil {
+		t.Errorf("Decrypt(...): the secret shouldn't be decrypted with another key")
+	}
+
+	if err := e.Decrypt(s); err != nil {
+		t.Fatalf("Decrypt(...): %s", err)
+	}
+	if diff := cmp.Diff(secret().Data, s.Data); diff != "" {
+		t.Errorf("Decrypt(...): -want, +got:\n%s", diff)
+	}
+
+	if _, err := NewEnvelope([]byte("short")); err == nil {
+		t.Errorf("NewEnvelope(...): keys that aren't 32 bytes should be rejected")
+	}
+}
+
+func TestKeepUnchanged(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, KeySize)
+	e, _ := NewEnvelope(key)
+	current := secret()
+	current.SetAnnotations(map[string]string{agentresource.AnnotationKeySourceResourceVersion: "1"})
+	_ = e.Encrypt(context.Background(), current)
+
+	cases := map[string]struct {
+		reason string
+		source string
+		key    []byte
+		data   map[string][]byte
+		keep   bool
+	}{
+		"Unchanged": {
+			reason: "The current ciphertexts should be kept if neither the source secret nor the key changed",
+			source: "1",
+			key:    key,
+			data:   secret().Data,
+			keep:   true,
+		},
+		"Changed": {
+			reason: "The new ciphertexts should be written if the values changed",
+			source: "2",
+			key:    key,
+			data:   map[string][]byte{"username": []byte("admin"), "password": []byte("hunter3")},
+		},
+		"SourceChanged": {
+			reason: "The new ciphertexts should be written if the source secret changed",
+			source: "2",
+			key:    key,
+			data:   secret().Data,
+		},
+		"NoSource": {
+			reason: "The new ciphertexts should be written if the resource version of the source secret isn't known",
+			key:    key,
+			data:   secret().Data,
+		},
+		"KeyRotated": {
+			reason: "The new ciphertexts should be written if the key encryption key changed",
+			source: "1",
+			key:    bytes.Repeat([]byte{2}, KeySize),
+			data:   secret().Data,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			e, _ := NewEnvelope(tc.key)
+			desired := &corev1.Secret{Data: tc.data}
+			if tc.source != "" {
+				desired.SetAnnotations(map[string]string{agentresource.AnnotationKeySourceResourceVersion: tc.source})
+			}
+			_ = e.Encrypt(context.Background(), desired)
+			if err := KeepUnchanged()(context.Background(), current, desired); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.keep, cmp.Equal(current, desired)); diff != "" {
+				t.Errorf("\nReason: %s\nKeepUnchanged(...): -want kept, +got kept:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
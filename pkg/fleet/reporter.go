@@ -0,0 +1,309 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fleet reports a summary of the syncs of an agent to a SyncStatus in
+// the remote cluster, so that fleet dashboards can be built from the remote
+// cluster alone.
+package fleet
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	runtimeresource "github.com/crossplane/crossplane-runtime/pkg/resource"
+	"github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/claim"
+	xv1alpha1 "github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
+
+	"github.com/crossplane/agent/pkg/kubeconfig"
+	agentmetrics "github.com/crossplane/agent/pkg/metrics"
+	"github.com/crossplane/agent/pkg/resource"
+	"github.com/crossplane/agent/pkg/version"
+)
+
+// The states that the claims are counted in per namespace. A claim that
+// became ready before its sync failed is counted as both.
+const (
+	StateTotal  = "total"
+	StateReady  = "ready"
+	StateFailed = "failed"
+)
+
+const (
+	defaultInterval = 1 * time.Minute
+
+	syncErrorsMetric = "crossplane_agent_sync_errors_total"
+
+	errListXRDs      = "cannot list composite resource definitions"
+	errFmtList       = "cannot list claims of kind %s"
+	errGather        = "cannot gather metrics"
+	errConvertReport = "cannot convert SyncStatus"
+	errApplyReport   = "cannot apply SyncStatus"
+	errEnsureCRD     = "cannot ensure SyncStatus CustomResourceDefinition"
+)
+
+// ReporterOption is used to configure *Reporter.
+type ReporterOption func(*Reporter)
+
+// WithInterval specifies how often the Reporter should report.
+func WithInterval(d time.Duration) ReporterOption {
+	return func(r *Reporter) {
+		r.interval = d
+	}
+}
+
+// WithLogger specifies how the Reporter should log messages.
+func WithLogger(l logging.Logger) ReporterOption {
+	return func(r *Reporter) {
+		r.log = l
+	}
+}
+
+// WithGatherer specifies where the Reporter should gather the metrics from.
+// Defaults to the controller-runtime registry.
+func WithGatherer(g prometheus.Gatherer) ReporterOption {
+	return func(r *Reporter) {
+		r.gatherer = g
+	}
+}
+
+// WithIdentity specifies the identity that the agent uses in the remote
+// cluster, which is reported so that the operators of the remote cluster can
+// match it in their API Priority and Fairness rules.
+func WithIdentity(id kubeconfig.Identity) ReporterOption {
+	return func(r *Reporter) {
+		r.identity = id
+	}
+}
+
+// WithNamespaceBreakdown specifies that the Reporter should report how many
+// claims of every kind each namespace has, and how many of them are ready
+// and failed to sync, for chargeback and capacity planning per tenant. The
+// counts are exposed as metrics as well.
+func WithNamespaceBreakdown() ReporterOption {
+	return func(r *Reporter) {
+		r.namespaces = true
+	}
+}
+
+// NewReporter returns a new *Reporter that summarizes the claims in the local
+// cluster and writes the summary to the referenced SyncStatus in the remote
+// cluster.
+func NewReporter(local client.Reader, remote client.Client, ref types.NamespacedName, opts ...ReporterOption) *Reporter {
+	r := &Reporter{
+		local: local,
+		kube:  remote,
+		// The SyncStatus is updated rather than patched so that the counts of
+		// the claim kinds and reasons that are gone don't linger.
+		remote:   runtimeresource.NewAPIUpdatingApplicator(remote),
+		ref:      ref,
+		interval: defaultInterval,
+		gatherer: metrics.Registry,
+		log:      logging.NewNopLogger(),
+		now:      time.Now,
+	}
+	for _, f := range opts {
+		f(r)
+	}
+	return r
+}
+
+// Reporter is a manager.Runnable that periodically reports the version of the
+// agent, the number of claims of every kind and the number of sync errors by
+// reason to a SyncStatus in the remote cluster.
+type Reporter struct {
+	local    client.Reader
+	kube     client.Client
+	remote   runtimeresource.Applicator
+	ref      types.NamespacedName
+	interval time.Duration
+	gatherer prometheus.Gatherer
+	identity kubeconfig.Identity
+	log      logging.Logger
+	now      func() time.Time
+
+	namespaces bool
+	ensured    bool
+}
+
+// Start reports until the stop channel is closed. The CustomResourceDefinition
+// of SyncStatuses is created in the remote cluster before the first report.
+// Failed reports are logged and retried in the next interval.
+func (r *Reporter) Start(stop <-chan struct{}) error {
+	ctx, stopped := resource.ContextFromStop(stop)
+	defer stopped()
+	t := time.NewTicker(r.interval)
+	defer t.Stop()
+	for {
+		rctx, cancel := context.WithTimeout(ctx, r.interval)
+		if err := r.ensure(rctx); err != nil {
+			r.log.Info("Cannot report sync summary", "error", err, "syncstatus", r.ref.String())
+		} else if err := r.Report(rctx); err != nil {
+			r.log.Info("Cannot report sync summary", "error", err, "syncstatus", r.ref.String())
+		}
+		cancel()
+		select {
+		case <-stop:
+			return nil
+		case <-t.C:
+		}
+	}
+}
+
+func (r *Reporter) ensure(ctx context.Context) error {
+	if r.ensured {
+		return nil
+	}
+	if err := resource.EnsureCRD(ctx, r.kube, CRD(), r.interval); err != nil {
+		return resource.RemoteError(err, errEnsureCRD)
+	}
+	r.ensured = true
+	return nil
+}
+
+// Report writes the current summary to the remote cluster.
+func (r *Reporter) Report(ctx context.Context) error {
+	st := SyncStatusStatus{
+		Version:    version.Version,
+		ReportTime: metav1.NewTime(r.now().UTC()),
+		Identity: Identity{
+			UserAgent: r.identity.UserAgent,
+			User:      r.identity.User,
+			Groups:    r.identity.Groups,
+		},
+	}
+	if st.Identity.UserAgent == "" {
+		st.Identity.UserAgent = version.UserAgent()
+	}
+	if err := r.countClaims(ctx, &st); err != nil {
+		return err
+	}
+	if err := r.countErrors(&st); err != nil {
+		return err
+	}
+	status, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&st)
+	if err != nil {
+		return errors.Wrap(err, errConvertReport)
+	}
+	u := &unstructured.Unstructured{Object: map[string]interface{}{"status": status}}
+	u.SetGroupVersionKind(GroupVersionKind)
+	u.SetNamespace(r.ref.Namespace)
+	u.SetName(r.ref.Name)
+	return resource.RemoteError(r.remote.Apply(ctx, u), errApplyReport)
+}
+
+func (r *Reporter) countClaims(ctx context.Context, st *SyncStatusStatus) error {
+	xrds := &xv1alpha1.CompositeResourceDefinitionList{}
+	if err := r.local.List(ctx, xrds); err != nil {
+		return resource.LocalError(err, errListXRDs)
+	}
+	if r.namespaces {
+		// The namespaces and kinds that are gone shouldn't linger.
+		agentmetrics.Claims.Reset()
+	}
+	for _, xrd := range xrds.Items {
+		if !xrd.OffersClaim() {
+			continue
+		}
+		gvk := xrd.GetClaimGroupVersionKind()
+		l := &unstructured.UnstructuredList{}
+		l.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		if err := r.local.List(ctx, l); err != nil {
+			return resource.LocalError(err, fmt.Sprintf(errFmtList, gvk.Kind))
+		}
+		cc := ClaimCount{Kind: gvk.Kind, Total: int64(len(l.Items))}
+		for i := range l.Items {
+			c := &claim.Unstructured{Unstructured: l.Items[i]}
+			if c.GetCondition(resource.TypeAgentSync).Status == corev1.ConditionTrue {
+				cc.Synced++
+			}
+		}
+		st.Claims = append(st.Claims, cc)
+		if r.namespaces {
+			st.Namespaces = append(st.Namespaces, countNamespaces(gvk.Kind, l.Items)...)
+		}
+	}
+	sort.Slice(st.Claims, func(i, j int) bool { return st.Claims[i].Kind < st.Claims[j].Kind })
+	sort.Slice(st.Namespaces, func(i, j int) bool {
+		if st.Namespaces[i].Namespace != st.Namespaces[j].Namespace {
+			return st.Namespaces[i].Namespace < st.Namespaces[j].Namespace
+		}
+		return st.Namespaces[i].Kind < st.Namespaces[j].Kind
+	})
+	return nil
+}
+
+// countNamespaces counts the supplied claims of the supplied kind per
+// namespace and state.
+func countNamespaces(kind string, items []unstructured.Unstructured) []NamespaceCount {
+	counts := map[string]*NamespaceCount{}
+	for i := range items {
+		c := &claim.Unstructured{Unstructured: items[i]}
+		ns := c.GetNamespace()
+		if counts[ns] == nil {
+			counts[ns] = &NamespaceCount{Namespace: ns, Kind: kind}
+		}
+		counts[ns].Total++
+		if c.GetCondition(v1alpha1.TypeReady).Status == corev1.ConditionTrue {
+			counts[ns].Ready++
+		}
+		if c.GetCondition(resource.TypeAgentSync).Status == corev1.ConditionFalse {
+			counts[ns].Failed++
+		}
+	}
+	out := make([]NamespaceCount, 0, len(counts))
+	for ns, nc := range counts {
+		agentmetrics.Claims.WithLabelValues(kind, ns, StateTotal).Set(float64(nc.Total))
+		agentmetrics.Claims.WithLabelValues(kind, ns, StateReady).Set(float64(nc.Ready))
+		agentmetrics.Claims.WithLabelValues(kind, ns, StateFailed).Set(float64(nc.Failed))
+		out = append(out, *nc)
+	}
+	return out
+}
+
+func (r *Reporter) countErrors(st *SyncStatusStatus) error {
+	mfs, err := r.gatherer.Gather()
+	if err != nil {
+		return errors.Wrap(err, errGather)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() != syncErrorsMetric {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "reason" {
+					st.Errors = append(st.Errors, ErrorCount{Reason: l.GetValue(), Count: int64(m.GetCounter().GetValue())})
+				}
+			}
+		}
+	}
+	sort.Slice(st.Errors, func(i, j int) bool { return st.Errors[i].Reason < st.Errors[j].Reason })
+	return nil
+}
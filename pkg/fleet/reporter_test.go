@@ -0,0 +1,195 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fleet
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	crds "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	xpv1alpha1 "github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/claim"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
+
+	"github.com/crossplane/agent/pkg/kubeconfig"
+	"github.com/crossplane/agent/pkg/resource"
+	"github.com/crossplane/agent/pkg/version"
+)
+
+var errBoom = errors.New("boom")
+
+func TestReport(t *testing.T) {
+	ref := types.NamespacedName{Namespace: "cool-ns", Name: "cool-cluster"}
+	now := time.Date(2020, 9, 1, 12, 0, 0, 0, time.UTC)
+
+	xrds := func(_ context.Context, obj runtime.Object, _ ...client.ListOption) error {
+		switch l := obj.(type) {
+		case *v1alpha1.CompositeResourceDefinitionList:
+			l.Items = []v1alpha1.CompositeResourceDefinition{
+				{Spec: v1alpha1.CompositeResourceDefinitionSpec{
+					CRDSpecTemplate: v1alpha1.CRDSpecTemplate{Group: "example.org", Version: "v1alpha1"},
+					ClaimNames:      &crds.CustomResourceDefinitionNames{Kind: "Database"},
+				}},
+				{Spec: v1alpha1.CompositeResourceDefinitionSpec{
+					CRDSpecTemplate: v1alpha1.CRDSpecTemplate{Group: "example.org", Version: "v1alpha1"},
+				}},
+			}
+		case *unstructured.UnstructuredList:
+			synced := claim.New(claim.WithConditions(resource.AgentSyncSuccess(), xpv1alpha1.Available()))
+			synced.SetNamespace("team-a")
+			failed := claim.New(claim.WithConditions(resource.AgentSyncError(errBoom)))
+			failed.SetNamespace("team-b")
+			l.Items = []unstructured.Unstructured{*synced.GetUnstructured(), *failed.GetUnstructured()}
+		}
+		return nil
+	}
+	syncErrors := prometheus.NewCounterVec(prometheus.CounterOpts{Name: syncErrorsMetric}, []string{"reason"})
+	syncErrors.WithLabelValues("RBACDeniedRemote").Add(3)
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(syncErrors)
+
+	type args struct {
+		local  client.Reader
+		remote *test.MockClient
+		opts   []ReporterOption
+	}
+	type want struct {
+		status *SyncStatusStatus
+		err    error
+	}
+	cases := map[string]struct {
+		reason string
+		args
+		want
+	}{
+		"ListFailed": {
+			reason: "Errors while listing the definitions should be returned",
+			args: args{
+				local: &test.MockClient{MockList: test.NewMockListFn(errBoom)},
+			},
+			want: want{err: resource.LocalError(errBoom, errListXRDs)},
+		},
+		"ApplyFailed": {
+			reason: "Errors while writing the report should be returned",
+			args: args{
+				local:  &test.MockClient{MockList: xrds},
+				remote: &test.MockClient{MockGet: test.NewMockGetFn(errBoom)},
+			},
+			want: want{err: resource.RemoteError(errors.Wrap(errBoom, "cannot get object"), errApplyReport)},
+		},
+		"Success": {
+			reason: "The claims of the kinds that are offered and the sync errors should be counted",
+			args: args{
+				local: &test.MockClient{MockList: xrds},
+				remote: &test.MockClient{
+					MockGet:    test.NewMockGetFn(kerrors.NewNotFound(schema.GroupResource{}, "")),
+					MockCreate: test.NewMockCreateFn(nil),
+				},
+			},
+			want: want{status: &SyncStatusStatus{
+				Version:    version.Version,
+				ReportTime: metav1.NewTime(now),
+				Identity:   Identity{UserAgent: version.UserAgent()},
+				Claims:     []ClaimCount{{Kind: "Database", Total: 2, Synced: 1}},
+				Errors:     []ErrorCount{{Reason: "RBACDeniedRemote", Count: 3}},
+			}},
+		},
+		"SuccessWithNamespaces": {
+			reason: "The claims should be counted per namespace if they're broken down by namespace",
+			args: args{
+				local: &test.MockClient{MockList: xrds},
+				remote: &test.MockClient{
+					MockGet:    test.NewMockGetFn(kerrors.NewNotFound(schema.GroupResource{}, "")),
+					MockCreate: test.NewMockCreateFn(nil),
+				},
+				opts: []ReporterOption{WithNamespaceBreakdown()},
+			},
+			want: want{status: &SyncStatusStatus{
+				Version:    version.Version,
+				ReportTime: metav1.NewTime(now),
+				Identity:   Identity{UserAgent: version.UserAgent()},
+				Claims:     []ClaimCount{{Kind: "Database", Total: 2, Synced: 1}},
+				Errors:     []ErrorCount{{Reason: "RBACDeniedRemote", Count: 3}},
+				Namespaces: []NamespaceCount{
+					{Namespace: "team-a", Kind: "Database", Total: 1, Ready: 1},
+					{Namespace: "team-b", Kind: "Database", Total: 1, Failed: 1},
+				},
+			}},
+		},
+		"SuccessWithIdentity": {
+			reason: "The identity of the agent in the remote cluster should be reported",
+			args: args{
+				local: &test.MockClient{MockList: xrds},
+				remote: &test.MockClient{
+					MockGet:    test.NewMockGetFn(kerrors.NewNotFound(schema.GroupResource{}, "")),
+					MockCreate: test.NewMockCreateFn(nil),
+				},
+				opts: []ReporterOption{WithIdentity(kubeconfig.Identity{UserAgent: "agent-eu-1", User: "agent:eu-1", Groups: []string{"agents"}})},
+			},
+			want: want{status: &SyncStatusStatus{
+				Version:    version.Version,
+				ReportTime: metav1.NewTime(now),
+				Identity:   Identity{UserAgent: "agent-eu-1", User: "agent:eu-1", Groups: []string{"agents"}},
+				Claims:     []ClaimCount{{Kind: "Database", Total: 2, Synced: 1}},
+				Errors:     []ErrorCount{{Reason: "RBACDeniedRemote", Count: 3}},
+			}},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var got *SyncStatusStatus
+			if tc.args.remote == nil {
+				tc.args.remote = &test.MockClient{}
+			}
+			if tc.args.remote.MockCreate != nil {
+				tc.args.remote.MockCreate = test.NewMockCreateFn(nil, func(obj runtime.Object) error {
+					u := obj.(*unstructured.Unstructured)
+					if diff := cmp.Diff(GroupVersionKind, u.GroupVersionKind()); diff != "" {
+						t.Errorf("\nReason: %s\nReport(...): -want kind, +got kind:\n%s", tc.reason, diff)
+					}
+					if diff := cmp.Diff(ref, types.NamespacedName{Namespace: u.GetNamespace(), Name: u.GetName()}); diff != "" {
+						t.Errorf("\nReason: %s\nReport(...): -want name, +got name:\n%s", tc.reason, diff)
+					}
+					got = &SyncStatusStatus{}
+					return runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object["status"].(map[string]interface{}), got)
+				})
+			}
+			r := NewReporter(tc.args.local, tc.args.remote, ref, append([]ReporterOption{WithGatherer(reg)}, tc.args.opts...)...)
+			r.now = func() time.Time { return now }
+			err := r.Report(context.Background())
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\nReport(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.status, got); diff != "" {
+				t.Errorf("\nReason: %s\nReport(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
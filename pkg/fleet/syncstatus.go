@@ -0,0 +1,161 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fleet
+
+import (
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// CRDName is the name of the CustomResourceDefinition of SyncStatuses.
+const CRDName = "syncstatuses.agent.crossplane.io"
+
+// GroupVersionKind of SyncStatuses.
+var GroupVersionKind = schema.GroupVersionKind{Group: "agent.crossplane.io", Version: "v1alpha1", Kind: "SyncStatus"}
+
+// Resource is the plural resource name of SyncStatuses.
+const Resource = "syncstatuses"
+
+// A ClaimCount is the number of claims of a kind, and how many of them are
+// synced.
+type ClaimCount struct {
+	Kind   string `json:"kind"`
+	Total  int64  `json:"total"`
+	Synced int64  `json:"synced"`
+}
+
+// A NamespaceCount is the number of claims of a kind in a namespace, and how
+// many of them are ready and failed to sync. A claim that became ready before
+// its sync failed is counted as both.
+type NamespaceCount struct {
+	Namespace string `json:"namespace"`
+	Kind      string `json:"kind"`
+	Total     int64  `json:"total"`
+	Ready     int64  `json:"ready"`
+	Failed    int64  `json:"failed"`
+}
+
+// An ErrorCount is the number of sync errors with a reason.
+type ErrorCount struct {
+	Reason string `json:"reason"`
+	Count  int64  `json:"count"`
+}
+
+// An Identity is how the agent identifies itself to the remote cluster, so
+// that the operators of the remote cluster can match it in their API Priority
+// and Fairness rules.
+type Identity struct {
+	UserAgent string   `json:"userAgent"`
+	User      string   `json:"user,omitempty"`
+	Groups    []string `json:"groups,omitempty"`
+}
+
+// A SyncStatusStatus is the summary of the syncs of an agent at the time of
+// its last report. The counts are sorted so that the reports only change when
+// the counts do.
+type SyncStatusStatus struct {
+	Version    string           `json:"version"`
+	ReportTime metav1.Time      `json:"reportTime"`
+	Identity   Identity         `json:"identity"`
+	Claims     []ClaimCount     `json:"claims,omitempty"`
+	Errors     []ErrorCount     `json:"errors,omitempty"`
+	Namespaces []NamespaceCount `json:"namespaces,omitempty"`
+}
+
+// CRD returns the CustomResourceDefinition of SyncStatuses. They're
+// namespaced so that the agents of a fleet can report to a namespace of the
+// remote cluster that they're granted access to.
+func CRD() *v1beta1.CustomResourceDefinition {
+	preserve := false
+	str := v1beta1.JSONSchemaProps{Type: "string"}
+	count := v1beta1.JSONSchemaProps{Type: "integer", Format: "int64"}
+	list := func(required []string, props map[string]v1beta1.JSONSchemaProps) v1beta1.JSONSchemaProps {
+		return v1beta1.JSONSchemaProps{
+			Type: "array",
+			Items: &v1beta1.JSONSchemaPropsOrArray{Schema: &v1beta1.JSONSchemaProps{
+				Type:       "object",
+				Required:   required,
+				Properties: props,
+			}},
+		}
+	}
+	return &v1beta1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: CRDName},
+		Spec: v1beta1.CustomResourceDefinitionSpec{
+			Group: GroupVersionKind.Group,
+			Names: v1beta1.CustomResourceDefinitionNames{
+				Kind:     GroupVersionKind.Kind,
+				ListKind: GroupVersionKind.Kind + "List",
+				Plural:   Resource,
+				Singular: "syncstatus",
+			},
+			Scope:                 v1beta1.NamespaceScoped,
+			PreserveUnknownFields: &preserve,
+			Versions: []v1beta1.CustomResourceDefinitionVersion{{
+				Name:    GroupVersionKind.Version,
+				Served:  true,
+				Storage: true,
+			}},
+			AdditionalPrinterColumns: []v1beta1.CustomResourceColumnDefinition{
+				{Name: "Version", Type: "string", JSONPath: ".status.version"},
+				{Name: "User", Type: "string", JSONPath: ".status.identity.user"},
+				{Name: "Reported", Type: "date", JSONPath: ".status.reportTime"},
+			},
+			Validation: &v1beta1.CustomResourceValidation{
+				OpenAPIV3Schema: &v1beta1.JSONSchemaProps{
+					Type: "object",
+					Properties: map[string]v1beta1.JSONSchemaProps{
+						"status": {
+							Type:     "object",
+							Required: []string{"version", "reportTime", "identity"},
+							Properties: map[string]v1beta1.JSONSchemaProps{
+								"version":    str,
+								"reportTime": {Type: "string", Format: "date-time"},
+								"identity": {
+									Type:     "object",
+									Required: []string{"userAgent"},
+									Properties: map[string]v1beta1.JSONSchemaProps{
+										"userAgent": str,
+										"user":      str,
+										"groups":    {Type: "array", Items: &v1beta1.JSONSchemaPropsOrArray{Schema: &str}},
+									},
+								},
+								"claims": list([]string{"kind", "total", "synced"}, map[string]v1beta1.JSONSchemaProps{
+									"kind":   str,
+									"total":  count,
+									"synced": count,
+								}),
+								"errors": list([]string{"reason", "count"}, map[string]v1beta1.JSONSchemaProps{
+									"reason": str,
+									"count":  count,
+								}),
+								"namespaces": list([]string{"namespace", "kind", "total", "ready", "failed"}, map[string]v1beta1.JSONSchemaProps{
+									"namespace": str,
+									"kind":      str,
+									"total":     count,
+									"ready":     count,
+									"failed":    count,
+								}),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
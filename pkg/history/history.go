@@ -0,0 +1,268 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package history keeps the last syncs of every object in memory so that the
+// intermittent failures users report can be debugged after the fact, without
+// having run the agent with debug logging at the time.
+package history
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSize       = 20
+	defaultMaxObjects = 10000
+)
+
+// An Action is what a sync did, or tried to do, to an object.
+type Action string
+
+// Actions.
+const (
+	ActionSync     Action = "Sync"
+	ActionCreate   Action = "Create"
+	ActionUpdate   Action = "Update"
+	ActionDelete   Action = "Delete"
+	ActionTransfer Action = "Transfer"
+)
+
+// A Key identifies an object whose syncs are recorded.
+type Key struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+}
+
+// An Entry is a single sync of an object.
+type Entry struct {
+	Time     time.Time     `json:"time"`
+	SyncID   string        `json:"syncID,omitempty"`
+	Action   Action        `json:"action"`
+	Outcome  string        `json:"outcome"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// A Recorder records the syncs of objects.
+type Recorder interface {
+	Record(k Key, e Entry)
+}
+
+// NewNopRecorder returns a Recorder that does nothing.
+func NewNopRecorder() Recorder {
+	return nopRecorder{}
+}
+
+type nopRecorder struct{}
+
+func (nopRecorder) Record(_ Key, _ Entry) {}
+
+// BufferOption is used to configure *Buffer.
+type BufferOption func(*Buffer)
+
+// WithSize specifies how many of the last syncs of every object the Buffer
+// should keep.
+func WithSize(n int) BufferOption {
+	return func(b *Buffer) {
+		b.size = n
+	}
+}
+
+// WithMaxObjects specifies how many objects the Buffer should keep the syncs
+// of. The objects that weren't synced for the longest time are forgotten
+// first.
+func WithMaxObjects(n int) BufferOption {
+	return func(b *Buffer) {
+		b.maxObjects = n
+	}
+}
+
+// WithDumpWriter specifies where the Buffer should dump the syncs it keeps
+// when the process receives SIGUSR1. Defaults to stderr.
+func WithDumpWriter(w io.Writer) BufferOption {
+	return func(b *Buffer) {
+		b.out = w
+	}
+}
+
+// NewBuffer returns a new *Buffer.
+func NewBuffer(opts ...BufferOption) *Buffer {
+	b := &Buffer{
+		size:       defaultSize,
+		maxObjects: defaultMaxObjects,
+		out:        os.Stderr,
+		rings:      map[Key]*ring{},
+	}
+	for _, f := range opts {
+		f(b)
+	}
+	return b
+}
+
+// Buffer is a Recorder that keeps the last syncs of every object in a bounded
+// ring buffer. It serves them as JSON over HTTP and, as a manager.Runnable,
+// dumps them when the process receives SIGUSR1.
+type Buffer struct {
+	size       int
+	maxObjects int
+	out        io.Writer
+
+	mu    sync.Mutex
+	rings map[Key]*ring
+}
+
+type ring struct {
+	entries []Entry
+	next    int
+	last    time.Time
+}
+
+func (r *ring) add(e Entry, size int) {
+	if len(r.entries) < size {
+		r.entries = append(r.entries, e)
+	} else {
+		r.entries[r.next] = e
+	}
+	r.next = (r.next + 1) % size
+	r.last = e.Time
+}
+
+// ordered returns the entries from the oldest to the newest.
+func (r *ring) ordered() []Entry {
+	out := make([]Entry, 0, len(r.entries))
+	// The ring wraps around only once it's full.
+	out = append(out, r.entries[r.next:]...)
+	return append(out, r.entries[:r.next]...)
+}
+
+// Record adds the supplied sync of the supplied object, replacing its oldest
+// sync if it already has as many as the Buffer keeps. It's safe for
+// concurrent use.
+func (b *Buffer) Record(k Key, e Entry) {
+	if b.size <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	r, ok := b.rings[k]
+	if !ok {
+		b.evict()
+		r = &ring{entries: make([]Entry, 0, b.size)}
+		b.rings[k] = r
+	}
+	r.add(e, b.size)
+}
+
+// evict forgets the object that wasn't synced for the longest time if the
+// Buffer is full. It has to be called with the lock held.
+func (b *Buffer) evict() {
+	if b.maxObjects <= 0 || len(b.rings) < b.maxObjects {
+		return
+	}
+	var oldest Key
+	var at time.Time
+	for k, r := range b.rings {
+		if at.IsZero() || r.last.Before(at) {
+			oldest, at = k, r.last
+		}
+	}
+	delete(b.rings, oldest)
+}
+
+// An Object is the sync history of a single object.
+type Object struct {
+	Key
+	Syncs []Entry `json:"syncs"`
+}
+
+// Get returns the sync history of the objects that match the supplied key.
+// Empty fields of the key match all objects. The objects are sorted by kind,
+// namespace and name, and their syncs from the oldest to the newest.
+func (b *Buffer) Get(filter Key) []Object {
+	b.mu.Lock()
+	out := make([]Object, 0, len(b.rings))
+	for k, r := range b.rings {
+		if !matches(filter, k) {
+			continue
+		}
+		out = append(out, Object{Key: k, Syncs: r.ordered()})
+	}
+	b.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i].Key, out[j].Key
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	return out
+}
+
+func matches(filter, k Key) bool {
+	return (filter.Kind == "" || filter.Kind == k.Kind) &&
+		(filter.Namespace == "" || filter.Namespace == k.Namespace) &&
+		(filter.Name == "" || filter.Name == k.Name)
+}
+
+// ServeHTTP writes the sync history as JSON. The kind, namespace and name
+// query parameters narrow it down to the matching objects.
+func (b *Buffer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	q := req.URL.Query()
+	w.Header().Set("Content-Type", "application/json")
+	_ = b.write(w, Key{Kind: q.Get("kind"), Namespace: q.Get("namespace"), Name: q.Get("name")})
+}
+
+// Dump writes the sync history of all objects as JSON to the supplied writer.
+func (b *Buffer) Dump(w io.Writer) error {
+	return b.write(w, Key{})
+}
+
+func (b *Buffer) write(w io.Writer, filter Key) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(b.Get(filter))
+}
+
+// Start dumps the sync history every time the process receives SIGUSR1 until
+// the stop channel is closed. It only waits for the stop channel on Windows.
+func (b *Buffer) Start(stop <-chan struct{}) error {
+	if dumpSignal == nil {
+		<-stop
+		return nil
+	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, dumpSignal)
+	defer signal.Stop(sig)
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-sig:
+			_ = b.Dump(b.out)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package history
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBuffer(t *testing.T) {
+	at := time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+	entry := func(i int) Entry {
+		return Entry{Time: at.Add(time.Duration(i) * time.Second), Action: ActionSync, Outcome: "Success"}
+	}
+	db := Key{Kind: "Database", Namespace: "cool", Name: "db"}
+	bucket := Key{Kind: "Bucket", Namespace: "cool", Name: "bucket"}
+	other := Key{Kind: "Database", Namespace: "other", Name: "db"}
+
+	type record struct {
+		key   Key
+		entry Entry
+	}
+	cases := map[string]struct {
+		reason  string
+		opts    []BufferOption
+		records []record
+		filter  Key
+		want    []Object
+	}{
+		"Ordered": {
+			reason:  "The syncs of an object should be returned from the oldest to the newest",
+			opts:    []BufferOption{WithSize(3)},
+			records: []record{{db, entry(0)}, {db, entry(1)}},
+			want:    []Object{{Key: db, Syncs: []Entry{entry(0), entry(1)}}},
+		},
+		"Wrapped": {
+			reason:  "Only the last syncs of an object should be kept once there are more than the size",
+			opts:    []BufferOption{WithSize(3)},
+			records: []record{{db, entry(0)}, {db, entry(1)}, {db, entry(2)}, {db, entry(3)}, {db, entry(4)}},
+			want:    []Object{{Key: db, Syncs: []Entry{entry(2), entry(3), entry(4)}}},
+		},
+		"Evicted": {
+			reason:  "The object that wasn't synced for the longest time should be forgotten once there are more than the maximum",
+			opts:    []BufferOption{WithMaxObjects(2)},
+			records: []record{{db, entry(0)}, {bucket, entry(1)}, {db, entry(2)}, {other, entry(3)}},
+			want: []Object{
+				{Key: db, Syncs: []Entry{entry(0), entry(2)}},
+				{Key: other, Syncs: []Entry{entry(3)}},
+			},
+		},
+		"Filtered": {
+			reason:  "Only the objects that match the filter should be returned, sorted by kind, namespace and name",
+			records: []record{{other, entry(0)}, {bucket, entry(1)}, {db, entry(2)}},
+			filter:  Key{Kind: "Database"},
+			want: []Object{
+				{Key: db, Syncs: []Entry{entry(2)}},
+				{Key: other, Syncs: []Entry{entry(0)}},
+			},
+		},
+		"Disabled": {
+			reason:  "Nothing should be kept if the size is zero",
+			opts:    []BufferOption{WithSize(0)},
+			records: []record{{db, entry(0)}},
+			want:    []Object{},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			b := NewBuffer(tc.opts...)
+			for _, r := range tc.records {
+				b.Record(r.key, r.entry)
+			}
+			if diff := cmp.Diff(tc.want, b.Get(tc.filter)); diff != "" {
+				t.Errorf("\nReason: %s\nb.Get(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	at := time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+	db := Key{Kind: "Database", Namespace: "cool", Name: "db"}
+	failed := Entry{Time: at, SyncID: "cool-id", Action: ActionCreate, Outcome: "Error", Error: "boom", Duration: time.Second}
+
+	b := NewBuffer()
+	b.Record(db, failed)
+	b.Record(Key{Kind: "Bucket", Namespace: "cool", Name: "bucket"}, Entry{Time: at, Action: ActionSync, Outcome: "Success"})
+
+	w := httptest.NewRecorder()
+	b.ServeHTTP(w, httptest.NewRequest("GET", "/debug/sync-history?kind=Database&name=db", nil))
+
+	got := []Object{}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal(...): %s", err)
+	}
+	want := []Object{{Key: db, Syncs: []Entry{failed}}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("\nReason: %s\nb.ServeHTTP(...): -want, +got:\n%s", "Only the syncs of the objects that match the query should be served", diff)
+	}
+}
@@ -0,0 +1,258 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package kubeconfig loads the kubeconfig of the remote cluster from a Secret
+// and watches it so that the credentials of the agent can be rotated by
+// updating the Secret.
+package kubeconfig
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdv1 "k8s.io/client-go/tools/clientcmd/api/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+
+	"github.com/crossplane/agent/pkg/resource"
+	"github.com/crossplane/agent/pkg/version"
+)
+
+// DefaultKey is the key of the Secret that holds the kubeconfig if it's not
+// specified in the reference.
+const DefaultKey = "kubeconfig"
+
+const (
+	defaultPollInterval = 30 * time.Second
+
+	errFmtInvalidRef = "invalid secret reference %q, must be in namespace/name[#key] format"
+	errGetSecret     = "cannot get kubeconfig secret"
+	errFmtNoKey      = "kubeconfig secret has no key %q"
+	errParse         = "cannot parse kubeconfig"
+	errWrite         = "cannot write kubeconfig"
+	errRotated       = "kubeconfig secret is rotated"
+)
+
+// SecretRef points to the key of a Secret that holds a kubeconfig.
+type SecretRef struct {
+	types.NamespacedName
+	Key string
+}
+
+// ParseSecretRef parses references in namespace/name[#key] format. The key
+// defaults to DefaultKey.
+func ParseSecretRef(s string) (SecretRef, error) {
+	ref := SecretRef{Key: DefaultKey}
+	if i := strings.LastIndex(s, "#"); i != -1 {
+		ref.Key = s[i+1:]
+		s = s[:i]
+	}
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" || ref.Key == "" {
+		return SecretRef{}, errors.Errorf(errFmtInvalidRef, s)
+	}
+	ref.Namespace, ref.Name = parts[0], parts[1]
+	return ref, nil
+}
+
+// FromSecret returns the config built from the kubeconfig in the referenced
+// Secret, using the given context or the current context of the kubeconfig
+// if it's empty. The raw kubeconfig is returned as well so that it can be
+// watched for changes.
+func FromSecret(ctx context.Context, kube client.Reader, ref SecretRef, kubeContext string) (*rest.Config, []byte, error) {
+	raw, err := get(ctx, kube, ref)
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg, err := clientcmd.Load(raw)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, errParse)
+	}
+	rc, err := clientcmd.NewNonInteractiveClientConfig(*cfg, kubeContext, &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+	return rc, raw, errors.Wrap(err, errParse)
+}
+
+// ForToken returns a kubeconfig with a single context named name that
+// authenticates to the API server at the supplied address with the given
+// bearer token, e.g. the token of a ServiceAccount.
+func ForToken(name, server string, ca, token []byte) ([]byte, error) {
+	cfg := clientcmdv1.Config{
+		APIVersion:     "v1",
+		Kind:           "Config",
+		Clusters:       []clientcmdv1.NamedCluster{{Name: name, Cluster: clientcmdv1.Cluster{Server: server, CertificateAuthorityData: ca}}},
+		AuthInfos:      []clientcmdv1.NamedAuthInfo{{Name: name, AuthInfo: clientcmdv1.AuthInfo{Token: string(token)}}},
+		Contexts:       []clientcmdv1.NamedContext{{Name: name, Context: clientcmdv1.Context{Cluster: name, AuthInfo: name}}},
+		CurrentContext: name,
+	}
+	raw, err := yaml.Marshal(cfg)
+	return raw, errors.Wrap(err, errWrite)
+}
+
+// An Identity is how the agent identifies itself to the remote cluster, so
+// that the operators of the remote cluster can tell the agents apart in their
+// audit logs and API Priority and Fairness rules. FlowSchemas match requests
+// by user and group, so the agent can impersonate a distinct user and groups
+// on top of its credentials.
+type Identity struct {
+	// UserAgent is sent with every request. Defaults to version.UserAgent().
+	UserAgent string
+
+	// User and Groups are impersonated if User is given. The credentials of
+	// the agent need to be allowed to impersonate them.
+	User   string
+	Groups []string
+
+	// Headers are sent with every request, e.g. an X-Cluster-ID that the
+	// audit logs of the remote cluster can be searched by. They don't
+	// override the headers that the client sets itself.
+	Headers map[string]string
+}
+
+// Configure returns a copy of the supplied config that identifies with the
+// identity.
+func (i Identity) Configure(cfg *rest.Config) *rest.Config {
+	out := rest.CopyConfig(cfg)
+	out.UserAgent = i.UserAgent
+	if out.UserAgent == "" {
+		out.UserAgent = version.UserAgent()
+	}
+	if i.User != "" {
+		out.Impersonate = rest.ImpersonationConfig{UserName: i.User, Groups: i.Groups}
+	}
+	if len(i.Headers) > 0 {
+		h := make(map[string]string, len(i.Headers))
+		for k, v := range i.Headers {
+			h[k] = v
+		}
+		out.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+			return &headerRoundTripper{headers: h, delegate: rt}
+		})
+	}
+	return out
+}
+
+// A headerRoundTripper adds its headers to the requests that don't have them.
+type headerRoundTripper struct {
+	headers  map[string]string
+	delegate http.RoundTripper
+}
+
+func (rt *headerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers must not modify the requests they're given.
+	req = req.Clone(req.Context())
+	for k, v := range rt.headers {
+		if req.Header.Get(k) == "" {
+			req.Header.Set(k, v)
+		}
+	}
+	return rt.delegate.RoundTrip(req)
+}
+
+func get(ctx context.Context, kube client.Reader, ref SecretRef) ([]byte, error) {
+	s := &corev1.Secret{}
+	if err := kube.Get(ctx, ref.NamespacedName, s); err != nil {
+		return nil, errors.Wrap(err, errGetSecret)
+	}
+	raw, ok := s.Data[ref.Key]
+	if !ok {
+		return nil, errors.Errorf(errFmtNoKey, ref.Key)
+	}
+	return raw, nil
+}
+
+// WatcherOption is used to configure *RotationWatcher.
+type WatcherOption func(*RotationWatcher)
+
+// WithPollInterval specifies how often the Secret should be checked.
+func WithPollInterval(d time.Duration) WatcherOption {
+	return func(w *RotationWatcher) {
+		w.interval = d
+	}
+}
+
+// WithLogger specifies how the RotationWatcher should log messages.
+func WithLogger(l logging.Logger) WatcherOption {
+	return func(w *RotationWatcher) {
+		w.log = l
+	}
+}
+
+// NewRotationWatcher returns a new *RotationWatcher that compares the
+// referenced Secret with the supplied kubeconfig.
+func NewRotationWatcher(kube client.Reader, ref SecretRef, current []byte, opts ...WatcherOption) *RotationWatcher {
+	w := &RotationWatcher{
+		kube:     kube,
+		ref:      ref,
+		current:  current,
+		interval: defaultPollInterval,
+		log:      logging.NewNopLogger(),
+	}
+	for _, f := range opts {
+		f(w)
+	}
+	return w
+}
+
+// RotationWatcher is a manager.Runnable that returns an error once the
+// kubeconfig in the Secret differs from the one the agent was started with.
+// The clients of the manager cannot be rebuilt in place, so this stops the
+// manager and the agent is expected to be restarted with the new
+// credentials, e.g. by the kubelet.
+type RotationWatcher struct {
+	kube     client.Reader
+	ref      SecretRef
+	current  []byte
+	interval time.Duration
+	log      logging.Logger
+}
+
+// Start polls the Secret until it's rotated or the stop channel is closed.
+// Errors while fetching the Secret are logged and the current credentials are
+// kept in use.
+func (w *RotationWatcher) Start(stop <-chan struct{}) error {
+	ctx, stopped := resource.ContextFromStop(stop)
+	defer stopped()
+	t := time.NewTicker(w.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-t.C:
+			gctx, cancel := context.WithTimeout(ctx, w.interval)
+			raw, err := get(gctx, w.kube, w.ref)
+			cancel()
+			if err != nil {
+				w.log.Debug("Cannot check kubeconfig secret for rotation", "error", err, "secret", w.ref.NamespacedName.String())
+				continue
+			}
+			if !bytes.Equal(raw, w.current) {
+				w.log.Info("Kubeconfig secret is rotated, stopping", "secret", w.ref.NamespacedName.String())
+				return errors.New(errRotated)
+			}
+		}
+	}
+}
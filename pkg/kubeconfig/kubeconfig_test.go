@@ -0,0 +1,289 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeconfig
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/crossplane/agent/pkg/version"
+)
+
+var errBoom = errors.New("boom")
+
+const raw = `apiVersion: v1
+kind: Config
+clusters:
+- name: central
+  cluster:
+    server: https://central.example.org
+- name: backup
+  cluster:
+    server: https://backup.example.org
+users:
+- name: agent
+  user:
+    token: secret-token
+contexts:
+- name: central
+  context:
+    cluster: central
+    user: agent
+- name: backup
+  context:
+    cluster: backup
+    user: agent
+current-context: central
+`
+
+func withData(data map[string][]byte) test.MockGetFn {
+	return func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+		obj.(*corev1.Secret).Data = data
+		return nil
+	}
+}
+
+func TestParseSecretRef(t *testing.T) {
+	type want struct {
+		ref SecretRef
+		err error
+	}
+	cases := map[string]struct {
+		reason string
+		in     string
+		want   want
+	}{
+		"DefaultKey": {
+			reason: "The key should default to DefaultKey",
+			in:     "crossplane-system/remote",
+			want:   want{ref: SecretRef{NamespacedName: types.NamespacedName{Namespace: "crossplane-system", Name: "remote"}, Key: DefaultKey}},
+		},
+		"CustomKey": {
+			reason: "The key should be parsed if given",
+			in:     "crossplane-system/remote#config",
+			want:   want{ref: SecretRef{NamespacedName: types.NamespacedName{Namespace: "crossplane-system", Name: "remote"}, Key: "config"}},
+		},
+		"NoNamespace": {
+			reason: "An error should be returned if the namespace is missing",
+			in:     "remote",
+			want:   want{err: errors.Errorf(errFmtInvalidRef, "remote")},
+		},
+		"EmptyKey": {
+			reason: "An error should be returned if the key is empty",
+			in:     "crossplane-system/remote#",
+			want:   want{err: errors.Errorf(errFmtInvalidRef, "crossplane-system/remote")},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			ref, err := ParseSecretRef(tc.in)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\nParseSecretRef(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.ref, ref); diff != "" {
+				t.Errorf("\nReason: %s\nParseSecretRef(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestFromSecret(t *testing.T) {
+	ref := SecretRef{NamespacedName: types.NamespacedName{Namespace: "ns", Name: "remote"}, Key: DefaultKey}
+	type args struct {
+		kube    client.Reader
+		context string
+	}
+	type want struct {
+		host string
+		err  error
+	}
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"GetFailed": {
+			reason: "An error should be returned if the secret cannot be fetched",
+			args:   args{kube: &test.MockClient{MockGet: test.NewMockGetFn(errBoom)}},
+			want:   want{err: errors.Wrap(errBoom, errGetSecret)},
+		},
+		"NoKey": {
+			reason: "An error should be returned if the secret doesn't have the key",
+			args:   args{kube: &test.MockClient{MockGet: withData(nil)}},
+			want:   want{err: errors.Errorf(errFmtNoKey, DefaultKey)},
+		},
+		"CurrentContext": {
+			reason: "The current context should be used if none is given",
+			args:   args{kube: &test.MockClient{MockGet: withData(map[string][]byte{DefaultKey: []byte(raw)})}},
+			want:   want{host: "https://central.example.org"},
+		},
+		"GivenContext": {
+			reason: "The given context should be used",
+			args: args{
+				kube:    &test.MockClient{MockGet: withData(map[string][]byte{DefaultKey: []byte(raw)})},
+				context: "backup",
+			},
+			want: want{host: "https://backup.example.org"},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cfg, _, err := FromSecret(context.Background(), tc.args.kube, ref, tc.args.context)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\nFromSecret(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			host := ""
+			if cfg != nil {
+				host = cfg.Host
+			}
+			if diff := cmp.Diff(tc.want.host, host); diff != "" {
+				t.Errorf("\nReason: %s\nFromSecret(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestForToken(t *testing.T) {
+	raw, err := ForToken("central", "https://central.example.org", []byte("ca"), []byte("secret-token"))
+	if err != nil {
+		t.Fatalf("ForToken(...): %v", err)
+	}
+	ref := SecretRef{NamespacedName: types.NamespacedName{Namespace: "ns", Name: "remote"}, Key: DefaultKey}
+	cfg, _, err := FromSecret(context.Background(), &test.MockClient{MockGet: withData(map[string][]byte{DefaultKey: raw})}, ref, "")
+	if err != nil {
+		t.Fatalf("FromSecret(...): %v", err)
+	}
+	type config struct {
+		Host, BearerToken string
+		CAData            []byte
+	}
+	want := config{Host: "https://central.example.org", BearerToken: "secret-token", CAData: []byte("ca")}
+	if diff := cmp.Diff(want, config{Host: cfg.Host, BearerToken: cfg.BearerToken, CAData: cfg.CAData}); diff != "" {
+		t.Errorf("\nReason: %s\nForToken(...): -want, +got:\n%s", "The kubeconfig should authenticate with the token", diff)
+	}
+}
+
+func TestIdentityConfigure(t *testing.T) {
+	type want struct {
+		userAgent   string
+		impersonate rest.ImpersonationConfig
+	}
+	cases := map[string]struct {
+		reason string
+		id     Identity
+		want   want
+	}{
+		"Default": {
+			reason: "The default User-Agent should be used without impersonation",
+			want:   want{userAgent: version.UserAgent()},
+		},
+		"Impersonated": {
+			reason: "The configured User-Agent should be sent and the user and groups impersonated",
+			id:     Identity{UserAgent: "agent-eu-1", User: "agent:eu-1", Groups: []string{"agents", "eu"}},
+			want: want{
+				userAgent:   "agent-eu-1",
+				impersonate: rest.ImpersonationConfig{UserName: "agent:eu-1", Groups: []string{"agents", "eu"}},
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			in := &rest.Config{Host: "https://central.example.org"}
+			cfg := tc.id.Configure(in)
+			if diff := cmp.Diff(tc.want.userAgent, cfg.UserAgent); diff != "" {
+				t.Errorf("\nReason: %s\nConfigure(...): -want user agent, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.impersonate, cfg.Impersonate); diff != "" {
+				t.Errorf("\nReason: %s\nConfigure(...): -want impersonation, +got:\n%s", tc.reason, diff)
+			}
+			if in.UserAgent != "" {
+				t.Errorf("\nReason: %s\nConfigure(...): the supplied config should not be modified", tc.reason)
+			}
+		})
+	}
+}
+
+type roundTripperFn func(*http.Request) (*http.Response, error)
+
+func (fn roundTripperFn) RoundTrip(req *http.Request) (*http.Response, error) {
+	return fn(req)
+}
+
+func TestIdentityHeaders(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		sent   http.Header
+		want   http.Header
+	}{
+		"Added": {
+			reason: "The headers of the identity should be added to the requests",
+			sent:   http.Header{},
+			want:   http.Header{"X-Cluster-Id": []string{"eu-1"}},
+		},
+		"NotOverridden": {
+			reason: "The headers that are already set by the client should be kept",
+			sent:   http.Header{"X-Cluster-Id": []string{"set-by-client"}},
+			want:   http.Header{"X-Cluster-Id": []string{"set-by-client"}},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			id := Identity{Headers: map[string]string{"X-Cluster-ID": "eu-1"}}
+			cfg := id.Configure(&rest.Config{Host: "https://central.example.org"})
+			var got http.Header
+			rt := cfg.WrapTransport(roundTripperFn(func(req *http.Request) (*http.Response, error) {
+				got = req.Header
+				return &http.Response{}, nil
+			}))
+			req, _ := http.NewRequest(http.MethodGet, "https://central.example.org", nil)
+			req.Header = tc.sent
+			if _, err := rt.RoundTrip(req); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\nReason: %s\nRoundTrip(...): -want headers, +got:\n%s", tc.reason, diff)
+			}
+			if len(tc.sent) == 0 && len(req.Header) != 0 {
+				t.Errorf("\nReason: %s\nRoundTrip(...): the supplied request should not be modified", tc.reason)
+			}
+		})
+	}
+}
+
+func TestRotationWatcher(t *testing.T) {
+	ref := SecretRef{NamespacedName: types.NamespacedName{Namespace: "ns", Name: "remote"}, Key: DefaultKey}
+	kube := &test.MockClient{MockGet: withData(map[string][]byte{DefaultKey: []byte("rotated")})}
+	w := NewRotationWatcher(kube, ref, []byte(raw), WithPollInterval(time.Millisecond))
+
+	stop := make(chan struct{})
+	defer close(stop)
+	if diff := cmp.Diff(errors.New(errRotated), w.Start(stop), test.EquateErrors()); diff != "" {
+		t.Errorf("\nReason: %s\nw.Start(...): -want error, +got error:\n%s", "An error should be returned once the secret is rotated", diff)
+	}
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeconfig
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/client-go/rest"
+
+	"github.com/crossplane/agent/pkg/metrics"
+)
+
+const errPoolTLS = "cannot build TLS config of shared transport"
+
+// Connection labels of the crossplane_agent_remote_requests_total metric.
+const (
+	ConnectionNew    = "new"
+	ConnectionReused = "reused"
+)
+
+// A Pool is a pool of connections to the API server of a cluster that all
+// clients made from a config share, instead of each client, informer and
+// watch of the agent making its own transport with its own connections and
+// TLS handshakes.
+type Pool struct {
+	// MaxIdleConnsPerHost is how many idle connections are kept open for
+	// reuse. The default of Go, i.e. 2, is used if it's 0.
+	MaxIdleConnsPerHost int
+
+	// MaxConnsPerHost is how many connections may be open at most,
+	// including the ones in use. There's no limit if it's 0.
+	MaxConnsPerHost int
+
+	// IdleConnTimeout is how long an idle connection is kept open. Idle
+	// connections are kept open until the API server closes them if it's 0.
+	IdleConnTimeout time.Duration
+}
+
+// Configure returns a copy of the supplied config whose clients share a single
+// transport that pools its connections as configured. The connections are
+// reported in the crossplane_agent_remote_connections_open and
+// crossplane_agent_remote_requests_total metrics. Configs that already have a
+// transport and the ones whose credentials are provided by an exec plugin,
+// which may rotate the client certificate, are returned as they are.
+func (p Pool) Configure(cfg *rest.Config) (*rest.Config, error) {
+	if cfg.Transport != nil || cfg.ExecProvider != nil {
+		return cfg, nil
+	}
+	tc, err := rest.TLSConfigFor(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, errPoolTLS)
+	}
+	dial := cfg.Dial
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+	}
+	t := utilnet.SetTransportDefaults(&http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		TLSHandshakeTimeout: 10 * time.Second,
+		TLSClientConfig:     tc,
+		MaxIdleConnsPerHost: p.MaxIdleConnsPerHost,
+		MaxConnsPerHost:     p.MaxConnsPerHost,
+		IdleConnTimeout:     p.IdleConnTimeout,
+		DialContext:         countingDialer(dial),
+		DisableCompression:  cfg.DisableCompression,
+	})
+	out := rest.CopyConfig(cfg)
+	// The TLS settings and the dial function are in the transport, which
+	// client-go doesn't allow to be given along with them.
+	out.TLSClientConfig = rest.TLSClientConfig{}
+	out.Dial = nil
+	out.Transport = &reuseRoundTripper{wrapped: t}
+	return out, nil
+}
+
+type dialFn func(ctx context.Context, network, address string) (net.Conn, error)
+
+func countingDialer(dial dialFn) dialFn {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		c, err := dial(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		metrics.RemoteConnectionsOpen.Inc()
+		return &countedConn{Conn: c}, nil
+	}
+}
+
+// countedConn decrements the open connections when it's closed for the
+// first time.
+type countedConn struct {
+	net.Conn
+	once sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.once.Do(metrics.RemoteConnectionsOpen.Dec)
+	return c.Conn.Close()
+}
+
+// reuseRoundTripper counts whether the requests reuse pooled connections.
+type reuseRoundTripper struct {
+	wrapped http.RoundTripper
+}
+
+func (rt *reuseRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	trace := &httptrace.ClientTrace{GotConn: func(i httptrace.GotConnInfo) {
+		if i.Reused {
+			metrics.RemoteRequests.WithLabelValues(ConnectionReused).Inc()
+			return
+		}
+		metrics.RemoteRequests.WithLabelValues(ConnectionNew).Inc()
+	}}
+	return rt.wrapped.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+}
+
+// WrappedRoundTripper returns the transport of the pool.
+func (rt *reuseRoundTripper) WrappedRoundTripper() http.RoundTripper {
+	return rt.wrapped
+}
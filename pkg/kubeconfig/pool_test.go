@@ -0,0 +1,88 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeconfig
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/client-go/rest"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestPoolConfigure(t *testing.T) {
+	mu := sync.Mutex{}
+	conns := 0
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("pooled"))
+	}))
+	server.Config.ConnState = func(_ net.Conn, s http.ConnState) {
+		if s == http.StateNew {
+			mu.Lock()
+			conns++
+			mu.Unlock()
+		}
+	}
+	server.StartTLS()
+	defer server.Close()
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	cfg, err := Pool{MaxIdleConnsPerHost: 5}.Configure(&rest.Config{Host: server.URL, TLSClientConfig: rest.TLSClientConfig{CAData: ca}})
+	if err != nil {
+		t.Fatalf("Configure(...): %s", err)
+	}
+
+	// Every client makes its own round tripper from the config, as
+	// controller-runtime does for its clients and informers.
+	for i := 0; i < 3; i++ {
+		rt, err := rest.TransportFor(cfg)
+		if err != nil {
+			t.Fatalf("rest.TransportFor(...): %s", err)
+		}
+		res, err := (&http.Client{Transport: rt}).Get(server.URL)
+		if err != nil {
+			t.Fatalf("Get(...): %s", err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		_ = res.Body.Close()
+		if diff := cmp.Diff("pooled", string(body)); diff != "" {
+			t.Errorf("Get(...): -want, +got:\n%s", diff)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if diff := cmp.Diff(1, conns); diff != "" {
+		t.Errorf("\nReason: %s\nConfigure(...): -want connections, +got connections:\n%s", "The clients made from the config should share the connections of the pool", diff)
+	}
+}
+
+func TestPoolConfigureExecProvider(t *testing.T) {
+	cfg := &rest.Config{Host: "https://remote.example.org", ExecProvider: &clientcmdapi.ExecConfig{Command: "credentials"}}
+	got, err := Pool{}.Configure(cfg)
+	if err != nil {
+		t.Fatalf("Configure(...): %s", err)
+	}
+	if got != cfg {
+		t.Errorf("\nReason: %s\nConfigure(...): want the supplied config", "Configs whose credentials are provided by an exec plugin should be returned as they are")
+	}
+}
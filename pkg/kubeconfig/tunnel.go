@@ -0,0 +1,177 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeconfig
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	errParseTunnel       = "cannot parse tunnel URL"
+	errFmtTunnelScheme   = "tunnel URL %q must have the http or https scheme"
+	errReadTunnelCA      = "cannot read tunnel CA bundle"
+	errParseTunnelCA     = "tunnel CA bundle has no certificates"
+	errLoadTunnelCert    = "cannot load tunnel client certificate"
+	errDialTunnel        = "cannot dial tunnel"
+	errConnectTunnel     = "cannot connect through tunnel"
+	errFmtTunnelResponse = "tunnel refused to connect to %s: %s"
+)
+
+// A Tunnel is a konnectivity-style reverse tunnel endpoint that the agent
+// dials out to in order to reach the API server of the remote cluster, for
+// topologies in which the API server isn't directly reachable from the local
+// cluster. The tunnel is an HTTP CONNECT proxy, e.g. a konnectivity server in
+// HTTP-CONNECT mode or a tunnel broker, that forwards the connections to the
+// address of the API server. The requests to the API server are still
+// encrypted and authenticated end to end with the credentials of the agent.
+type Tunnel struct {
+	// URL of the tunnel endpoint, e.g. https://tunnel.example.org:8132. The
+	// connections to it are encrypted if its scheme is https.
+	URL string
+
+	// CAFile is the path of the CA bundle of the tunnel endpoint. The system
+	// roots are used if it's empty.
+	CAFile string
+
+	// CertFile and KeyFile are the paths of the client certificate and key
+	// that the agent authenticates to the tunnel endpoint with, if it
+	// requires one.
+	CertFile string
+	KeyFile  string
+}
+
+// Configure returns a copy of the supplied config whose connections to the API
+// server are made through the tunnel.
+func (t Tunnel) Configure(cfg *rest.Config) (*rest.Config, error) {
+	u, err := url.Parse(t.URL)
+	if err != nil {
+		return nil, errors.Wrap(err, errParseTunnel)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.Errorf(errFmtTunnelScheme, t.URL)
+	}
+	d := &tunnelDialer{address: u.Host}
+	if u.Port() == "" {
+		d.address = net.JoinHostPort(u.Hostname(), map[string]string{"http": "80", "https": "443"}[u.Scheme])
+	}
+	if u.Scheme == "https" {
+		tc, err := t.tlsConfig(u.Hostname())
+		if err != nil {
+			return nil, err
+		}
+		d.tls = tc
+	}
+	out := rest.CopyConfig(cfg)
+	out.Dial = d.DialContext
+	return out, nil
+}
+
+func (t Tunnel) tlsConfig(serverName string) (*tls.Config, error) {
+	tc := &tls.Config{ServerName: serverName, MinVersion: tls.VersionTLS12}
+	if t.CAFile != "" {
+		ca, err := ioutil.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, errReadTunnelCA)
+		}
+		tc.RootCAs = x509.NewCertPool()
+		if !tc.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, errors.New(errParseTunnelCA)
+		}
+	}
+	if t.CertFile != "" || t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, errLoadTunnelCert)
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+	return tc, nil
+}
+
+// A tunnelDialer dials the addresses through an HTTP CONNECT tunnel.
+type tunnelDialer struct {
+	address string
+	tls     *tls.Config
+}
+
+// DialContext returns a connection to the supplied address that goes through
+// the tunnel.
+func (d *tunnelDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	conn, err := (&net.Dialer{}).DialContext(ctx, network, d.address)
+	if err != nil {
+		return nil, errors.Wrap(err, errDialTunnel)
+	}
+	// The connection shouldn't outlive the context while the tunnel is being
+	// established, but it's up to the caller once it's returned.
+	if dl, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(dl)
+	}
+	if d.tls != nil {
+		tc := tls.Client(conn, d.tls)
+		if err := tc.Handshake(); err != nil {
+			_ = conn.Close()
+			return nil, errors.Wrap(err, errDialTunnel)
+		}
+		conn = tc
+	}
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: http.Header{},
+	}
+	if err := req.Write(conn); err != nil {
+		_ = conn.Close()
+		return nil, errors.Wrap(err, errConnectTunnel)
+	}
+	br := bufio.NewReader(conn)
+	res, err := http.ReadResponse(br, req)
+	if err != nil {
+		_ = conn.Close()
+		return nil, errors.Wrap(err, errConnectTunnel)
+	}
+	_ = res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		_ = conn.Close()
+		return nil, errors.Errorf(errFmtTunnelResponse, address, res.Status)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// A bufferedConn reads what was buffered while the tunnel was established
+// before it reads from the connection.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) { return c.r.Read(b) }
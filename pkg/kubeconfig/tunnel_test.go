@@ -0,0 +1,120 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeconfig
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/client-go/rest"
+)
+
+// connectProxy is an HTTP CONNECT proxy that connects only to the allowed
+// address.
+func connectProxy(t *testing.T, allowed string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect || r.Host != allowed {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("Hijack(): %s", err)
+			return
+		}
+		_, _ = conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		go func() {
+			_, _ = io.Copy(upstream, conn)
+			_ = upstream.Close()
+		}()
+		_, _ = io.Copy(conn, upstream)
+		_ = conn.Close()
+	}))
+}
+
+func TestTunnelConfigure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("tunnelled"))
+	}))
+	defer server.Close()
+	serverAddress := strings.TrimPrefix(server.URL, "http://")
+
+	// The transports of the configs are cached by their dial function, so
+	// all cases go through the same tunnel.
+	proxy := connectProxy(t, serverAddress)
+	defer proxy.Close()
+
+	cases := map[string]struct {
+		reason  string
+		host    string
+		want    string
+		wantErr bool
+	}{
+		"Tunnelled": {
+			reason: "Requests should reach the API server through the tunnel",
+			host:   server.URL,
+			want:   "tunnelled",
+		},
+		"Refused": {
+			reason:  "Requests should fail if the tunnel refuses to connect to the API server",
+			host:    "http://elsewhere.example.org:8080",
+			wantErr: true,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := Tunnel{URL: proxy.URL}.Configure(&rest.Config{Host: tc.host})
+			if err != nil {
+				t.Fatalf("Configure(...): %s", err)
+			}
+			rt, err := rest.TransportFor(cfg)
+			if err != nil {
+				t.Fatalf("rest.TransportFor(...): %s", err)
+			}
+			res, err := (&http.Client{Transport: rt}).Get(tc.host)
+			if diff := cmp.Diff(tc.wantErr, err != nil); diff != "" {
+				t.Fatalf("\nReason: %s\nGet(...): -want error, +got error:\n%s\n%v", tc.reason, diff, err)
+			}
+			if err != nil {
+				return
+			}
+			defer res.Body.Close()
+			body, _ := ioutil.ReadAll(res.Body)
+			if diff := cmp.Diff(tc.want, string(body)); diff != "" {
+				t.Errorf("\nReason: %s\nGet(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestTunnelConfigureInvalid(t *testing.T) {
+	_, err := Tunnel{URL: "socks5://tunnel.example.org:1080"}.Configure(&rest.Config{})
+	if err == nil {
+		t.Errorf("\nReason: %s\nConfigure(...): want error, got nil", "Tunnels that aren't HTTP CONNECT proxies should be rejected")
+	}
+}
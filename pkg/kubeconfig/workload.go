@@ -0,0 +1,149 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/transport"
+)
+
+const (
+	grantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+	tokenTypeJWT           = "urn:ietf:params:oauth:token-type:jwt"
+	tokenTypeAccessToken   = "urn:ietf:params:oauth:token-type:access_token"
+
+	exchangeTimeout = 30 * time.Second
+
+	errReadToken         = "cannot read workload identity token"
+	errExchangeToken     = "cannot exchange workload identity token"
+	errFmtExchangeStatus = "token exchange failed with status %d: %s"
+	errParseExchange     = "cannot parse token exchange response"
+	errNoAccessToken     = "token exchange response has no access token"
+)
+
+// A WorkloadIdentity authenticates the agent to the remote cluster with a
+// token of its ServiceAccount in the local cluster, e.g. a projected one that
+// the kubelet rotates, instead of the long-lived credentials of a kubeconfig.
+type WorkloadIdentity struct {
+	// Server is the address of the API server of the remote cluster.
+	Server string
+
+	// CAFile is the path of the CA bundle of the API server of the remote
+	// cluster. The system roots are used if it's empty.
+	CAFile string
+
+	// TokenFile is the path of the token. It's read again periodically so
+	// that rotated tokens are picked up.
+	TokenFile string
+
+	// ExchangeURL is the address of an OAuth 2.0 token exchange (RFC 8693)
+	// endpoint, e.g. the security token service of a workload identity
+	// federation, that exchanges the token for one the remote cluster
+	// accepts. The token is sent to the remote cluster as is if it's empty.
+	ExchangeURL string
+
+	// Audience of the exchanged token, if the endpoint requires one.
+	Audience string
+}
+
+// Config returns the config that authenticates to the remote cluster with the
+// workload identity. Exchanged tokens are cached until they are about to
+// expire and exchanged again then.
+func (w WorkloadIdentity) Config() *rest.Config {
+	cfg := &rest.Config{
+		Host:            w.Server,
+		TLSClientConfig: rest.TLSClientConfig{CAFile: w.CAFile},
+	}
+	if w.ExchangeURL == "" {
+		cfg.BearerTokenFile = w.TokenFile
+		return cfg
+	}
+	ts := &exchangeTokenSource{
+		url:       w.ExchangeURL,
+		audience:  w.Audience,
+		tokenFile: w.TokenFile,
+		client:    &http.Client{Timeout: exchangeTimeout},
+		now:       time.Now,
+	}
+	cfg.Wrap(transport.TokenSourceWrapTransport(transport.NewCachedTokenSource(ts)))
+	return cfg
+}
+
+// An exchangeTokenSource exchanges the token in a file for an access token.
+type exchangeTokenSource struct {
+	url       string
+	audience  string
+	tokenFile string
+	client    *http.Client
+	now       func() time.Time
+}
+
+type exchangeResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+func (ts *exchangeTokenSource) Token() (*oauth2.Token, error) {
+	subject, err := ioutil.ReadFile(ts.tokenFile)
+	if err != nil {
+		return nil, errors.Wrap(err, errReadToken)
+	}
+	form := url.Values{
+		"grant_type":           {grantTypeTokenExchange},
+		"subject_token":        {strings.TrimSpace(string(subject))},
+		"subject_token_type":   {tokenTypeJWT},
+		"requested_token_type": {tokenTypeAccessToken},
+	}
+	if ts.audience != "" {
+		form.Set("audience", ts.audience)
+	}
+	resp, err := ts.client.PostForm(ts.url, form)
+	if err != nil {
+		return nil, errors.Wrap(err, errExchangeToken)
+	}
+	defer resp.Body.Close() // nolint:errcheck
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, errExchangeToken)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf(errFmtExchangeStatus, resp.StatusCode, string(bytes.TrimSpace(body)))
+	}
+	r := exchangeResponse{}
+	if err := json.Unmarshal(body, &r); err != nil {
+		return nil, errors.Wrap(err, errParseExchange)
+	}
+	if r.AccessToken == "" {
+		return nil, errors.New(errNoAccessToken)
+	}
+	t := &oauth2.Token{AccessToken: r.AccessToken, TokenType: "Bearer"}
+	if r.ExpiresIn > 0 {
+		t.Expiry = ts.now().Add(time.Duration(r.ExpiresIn) * time.Second)
+	}
+	return t, nil
+}
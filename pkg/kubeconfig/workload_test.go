@@ -0,0 +1,128 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeconfig
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+)
+
+func TestWorkloadIdentityConfig(t *testing.T) {
+	w := WorkloadIdentity{Server: "https://central.example.org", CAFile: "/ca.crt", TokenFile: "/token"}
+	cfg := w.Config()
+	type config struct {
+		Host, CAFile, BearerTokenFile string
+	}
+	want := config{Host: "https://central.example.org", CAFile: "/ca.crt", BearerTokenFile: "/token"}
+	if diff := cmp.Diff(want, config{Host: cfg.Host, CAFile: cfg.CAFile, BearerTokenFile: cfg.BearerTokenFile}); diff != "" {
+		t.Errorf("\nReason: %s\nw.Config(): -want, +got:\n%s", "Tokens that aren't exchanged should be read from the file by the client", diff)
+	}
+}
+
+func TestExchangeTokenSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "workload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // nolint:errcheck
+	tokenFile := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("projected\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "missing")
+	_, errMissing := ioutil.ReadFile(missing)
+	now := time.Now()
+
+	type want struct {
+		token *oauth2.Token
+		err   error
+	}
+	cases := map[string]struct {
+		reason    string
+		tokenFile string
+		handler   http.HandlerFunc
+		want      want
+	}{
+		"Exchanged": {
+			reason:    "The projected token should be exchanged for an access token",
+			tokenFile: tokenFile,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.FormValue("grant_type") != grantTypeTokenExchange || r.FormValue("subject_token") != "projected" || r.FormValue("audience") != "central" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				_, _ = w.Write([]byte(`{"access_token":"exchanged","token_type":"Bearer","expires_in":3600}`))
+			},
+			want: want{token: &oauth2.Token{AccessToken: "exchanged", TokenType: "Bearer", Expiry: now.Add(time.Hour)}},
+		},
+		"Rejected": {
+			reason:    "The response of the endpoint should be returned if it rejects the exchange",
+			tokenFile: tokenFile,
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusUnauthorized)
+				_, _ = w.Write([]byte("invalid subject token"))
+			},
+			want: want{err: errors.Errorf(errFmtExchangeStatus, http.StatusUnauthorized, "invalid subject token")},
+		},
+		"NoAccessToken": {
+			reason:    "An error should be returned if the response has no access token",
+			tokenFile: tokenFile,
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = w.Write([]byte(`{}`))
+			},
+			want: want{err: errors.New(errNoAccessToken)},
+		},
+		"NoTokenFile": {
+			reason:    "An error should be returned if the token cannot be read",
+			tokenFile: missing,
+			handler:   func(w http.ResponseWriter, _ *http.Request) {},
+			want:      want{err: errors.Wrap(errMissing, errReadToken)},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(tc.handler)
+			defer srv.Close()
+			ts := &exchangeTokenSource{
+				url:       srv.URL,
+				audience:  "central",
+				tokenFile: tc.tokenFile,
+				client:    srv.Client(),
+				now:       func() time.Time { return now },
+			}
+			got, err := ts.Token()
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\nts.Token(): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.token, got, cmpopts.IgnoreUnexported(oauth2.Token{})); diff != "" {
+				t.Errorf("\nReason: %s\nts.Token(): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
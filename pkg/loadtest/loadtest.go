@@ -0,0 +1,304 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package loadtest measures how long it takes for claims created in the local
+// cluster to be synced by a running agent, so that performance regressions of
+// the whole propagation path are measurable.
+package loadtest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	runtimeresource "github.com/crossplane/crossplane-runtime/pkg/resource"
+	"github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/claim"
+
+	"github.com/crossplane/agent/pkg/resource"
+)
+
+// LabelKeyRun is the label that the claims created by a load test run are
+// marked with.
+const LabelKeyRun = "loadtest.agent.crossplane.io/run"
+
+const (
+	defaultCount        = 100
+	defaultConcurrency  = 10
+	defaultNamespace    = "default"
+	defaultPollInterval = 500 * time.Millisecond
+	defaultTimeout      = 10 * time.Minute
+
+	errSetSpec       = "cannot set spec of claim"
+	errFmtCreate     = "cannot create claim %s"
+	errList          = "cannot list claims"
+	errFmtDelete     = "cannot delete claim %s"
+	errFmtNotAllSync = "%d of %d claims were not synced in %s"
+)
+
+// An Option configures a Runner.
+type Option func(*Runner)
+
+// WithCount specifies how many claims the Runner should create.
+func WithCount(n int) Option {
+	return func(r *Runner) {
+		r.count = n
+	}
+}
+
+// WithConcurrency specifies how many claims the Runner should create at the
+// same time.
+func WithConcurrency(n int) Option {
+	return func(r *Runner) {
+		r.concurrency = n
+	}
+}
+
+// WithNamespace specifies the namespace the claims are created in.
+func WithNamespace(ns string) Option {
+	return func(r *Runner) {
+		r.namespace = ns
+	}
+}
+
+// WithSpec specifies the spec of the created claims.
+func WithSpec(spec map[string]interface{}) Option {
+	return func(r *Runner) {
+		r.spec = spec
+	}
+}
+
+// WithPollInterval specifies how often the Runner should check whether the
+// claims are synced. It's the resolution of the measured latencies.
+func WithPollInterval(d time.Duration) Option {
+	return func(r *Runner) {
+		r.interval = d
+	}
+}
+
+// WithTimeout specifies how long the Runner should wait for all claims to be
+// synced.
+func WithTimeout(d time.Duration) Option {
+	return func(r *Runner) {
+		r.timeout = d
+	}
+}
+
+// WithLogger specifies how the Runner should log messages.
+func WithLogger(l logging.Logger) Option {
+	return func(r *Runner) {
+		r.log = l
+	}
+}
+
+// NewRunner returns a new *Runner that creates claims of the given kind in the
+// local cluster.
+func NewRunner(kube client.Client, gvk schema.GroupVersionKind, opts ...Option) *Runner {
+	r := &Runner{
+		kube:        kube,
+		gvk:         gvk,
+		count:       defaultCount,
+		concurrency: defaultConcurrency,
+		namespace:   defaultNamespace,
+		interval:    defaultPollInterval,
+		timeout:     defaultTimeout,
+		log:         logging.NewNopLogger(),
+		now:         time.Now,
+		id:          resource.NewSyncID,
+	}
+	for _, f := range opts {
+		f(r)
+	}
+	return r
+}
+
+// A Runner creates a number of claims in the local cluster and measures how
+// long it takes for each of them to be marked as synced by the agent.
+type Runner struct {
+	kube        client.Client
+	gvk         schema.GroupVersionKind
+	count       int
+	concurrency int
+	namespace   string
+	spec        map[string]interface{}
+	interval    time.Duration
+	timeout     time.Duration
+	log         logging.Logger
+	now         func() time.Time
+	id          func() string
+}
+
+// Result is the outcome of a load test run.
+type Result struct {
+	// Run is the value of the LabelKeyRun label of the created claims.
+	Run string
+
+	// Count is the number of claims that were created.
+	Count int
+
+	// Elapsed is the time between the creation of the first claim and the
+	// sync of the last one.
+	Elapsed time.Duration
+
+	// Latencies are the times it took for the synced claims to be synced
+	// after they were created, in ascending order.
+	Latencies []time.Duration
+}
+
+// Synced returns the number of claims that were synced.
+func (r *Result) Synced() int {
+	return len(r.Latencies)
+}
+
+// Percentile returns the latency that the given percentage of the synced
+// claims were synced in, e.g. 99 for the p99 latency.
+func (r *Result) Percentile(p float64) time.Duration {
+	if len(r.Latencies) == 0 {
+		return 0
+	}
+	i := int(float64(len(r.Latencies))*p/100+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(r.Latencies) {
+		i = len(r.Latencies) - 1
+	}
+	return r.Latencies[i]
+}
+
+// Throughput returns the number of claims synced per second.
+func (r *Result) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(len(r.Latencies)) / r.Elapsed.Seconds()
+}
+
+// Err returns an error if not all the created claims were synced.
+func (r *Result) Err() error {
+	if r.Synced() == r.Count {
+		return nil
+	}
+	return errors.Errorf(errFmtNotAllSync, r.Count-r.Synced(), r.Count, r.Elapsed)
+}
+
+// Run creates the claims, waits until they're all synced or the timeout is
+// reached and returns the measured latencies. The claims are left in place so
+// that they can be inspected; see Cleanup.
+func (r *Runner) Run(ctx context.Context) (*Result, error) {
+	res := &Result{Run: r.id(), Count: r.count}
+	start := r.now()
+	created, err := r.create(ctx, res.Run)
+	if err != nil {
+		return res, err
+	}
+
+	synced := map[string]bool{}
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	err = wait.PollImmediateUntil(r.interval, func() (bool, error) {
+		l := &unstructured.UnstructuredList{}
+		l.SetGroupVersionKind(r.gvk.GroupVersion().WithKind(r.gvk.Kind + "List"))
+		if err := r.kube.List(ctx, l, client.InNamespace(r.namespace), client.MatchingLabels{LabelKeyRun: res.Run}); err != nil {
+			return false, errors.Wrap(err, errList)
+		}
+		now := r.now()
+		for i := range l.Items {
+			c := &claim.Unstructured{Unstructured: l.Items[i]}
+			if synced[c.GetName()] || c.GetCondition(resource.TypeAgentSync).Status != corev1.ConditionTrue {
+				continue
+			}
+			synced[c.GetName()] = true
+			res.Latencies = append(res.Latencies, now.Sub(created[c.GetName()]))
+			res.Elapsed = now.Sub(start)
+		}
+		r.log.Debug("Waiting for claims to be synced", "run", res.Run, "synced", len(synced), "count", r.count)
+		return len(synced) == r.count, nil
+	}, ctx.Done())
+	sort.Slice(res.Latencies, func(i, j int) bool { return res.Latencies[i] < res.Latencies[j] })
+	if err == wait.ErrWaitTimeout {
+		res.Elapsed = r.now().Sub(start)
+		return res, nil
+	}
+	return res, err
+}
+
+// create creates the claims of the run with the configured concurrency and
+// returns the time each of them was created at.
+func (r *Runner) create(ctx context.Context, run string) (map[string]time.Time, error) {
+	created := make(map[string]time.Time, r.count)
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	sem := make(chan struct{}, r.concurrency)
+	for i := 0; i < r.count; i++ {
+		c := claim.New(claim.WithGroupVersionKind(r.gvk))
+		c.SetNamespace(r.namespace)
+		c.SetName(fmt.Sprintf("loadtest-%s-%d", run[:8], i))
+		c.SetLabels(map[string]string{LabelKeyRun: run})
+		if r.spec != nil {
+			if err := fieldpath.Pave(c.Object).SetValue("spec", runtime.DeepCopyJSON(r.spec)); err != nil {
+				return nil, errors.Wrap(err, errSetSpec)
+			}
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			t := r.now()
+			err := r.kube.Create(ctx, c)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = errors.Wrapf(err, errFmtCreate, c.GetName())
+				}
+				return
+			}
+			created[c.GetName()] = t
+		}()
+	}
+	wg.Wait()
+	return created, firstErr
+}
+
+// Cleanup deletes the claims of the given run.
+func (r *Runner) Cleanup(ctx context.Context, run string) error {
+	l := &unstructured.UnstructuredList{}
+	l.SetGroupVersionKind(r.gvk.GroupVersion().WithKind(r.gvk.Kind + "List"))
+	if err := r.kube.List(ctx, l, client.InNamespace(r.namespace), client.MatchingLabels{LabelKeyRun: run}); err != nil {
+		return errors.Wrap(err, errList)
+	}
+	for i := range l.Items {
+		if err := r.kube.Delete(ctx, &l.Items[i]); runtimeresource.IgnoreNotFound(err) != nil {
+			return errors.Wrapf(err, errFmtDelete, l.Items[i].GetName())
+		}
+	}
+	return nil
+}
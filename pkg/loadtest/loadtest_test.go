@@ -0,0 +1,173 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package loadtest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/claim"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/crossplane/agent/pkg/resource"
+)
+
+var (
+	errBoom = errors.New("boom")
+
+	gvk = schema.GroupVersionKind{Group: "example.org", Version: "v1alpha1", Kind: "Database"}
+	run = "0123456789abcdef"
+)
+
+// stepClock returns a clock that advances by a second every time it's read.
+func stepClock() func() time.Time {
+	t := time.Date(2020, 9, 1, 12, 0, 0, 0, time.UTC)
+	return func() time.Time {
+		t = t.Add(time.Second)
+		return t
+	}
+}
+
+func syncedClaims(names ...string) func(_ context.Context, obj runtime.Object, _ ...client.ListOption) error {
+	return func(_ context.Context, obj runtime.Object, _ ...client.ListOption) error {
+		l := obj.(*unstructured.UnstructuredList)
+		for _, n := range names {
+			c := claim.New(claim.WithGroupVersionKind(gvk), claim.WithConditions(resource.AgentSyncSuccess()))
+			c.SetName(n)
+			l.Items = append(l.Items, c.Unstructured)
+		}
+		return nil
+	}
+}
+
+func TestRun(t *testing.T) {
+	type args struct {
+		kube client.Client
+		now  func() time.Time
+	}
+	type want struct {
+		res *Result
+		err error
+	}
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"CreateFailed": {
+			reason: "An error should be returned if a claim cannot be created",
+			args: args{
+				kube: &test.MockClient{MockCreate: test.NewMockCreateFn(errBoom)},
+				now:  stepClock(),
+			},
+			want: want{
+				res: &Result{Run: run, Count: 2},
+				err: errors.Wrapf(errBoom, errFmtCreate, "loadtest-01234567-0"),
+			},
+		},
+		"ListFailed": {
+			reason: "An error should be returned if the claims cannot be listed",
+			args: args{
+				kube: &test.MockClient{
+					MockCreate: test.NewMockCreateFn(nil),
+					MockList:   test.NewMockListFn(errBoom),
+				},
+				now: stepClock(),
+			},
+			want: want{
+				res: &Result{Run: run, Count: 2},
+				err: errors.Wrap(errBoom, errList),
+			},
+		},
+		"AllSynced": {
+			reason: "The latency of every claim should be measured from its creation until it's observed as synced",
+			args: args{
+				kube: &test.MockClient{
+					MockCreate: test.NewMockCreateFn(nil),
+					MockList:   syncedClaims("loadtest-01234567-0", "loadtest-01234567-1"),
+				},
+				now: stepClock(),
+			},
+			want: want{
+				res: &Result{Run: run, Count: 2, Elapsed: 3 * time.Second, Latencies: []time.Duration{time.Second, 2 * time.Second}},
+			},
+		},
+		"NotAllSynced": {
+			reason: "The claims that are synced until the timeout should be reported without an error",
+			args: args{
+				kube: &test.MockClient{
+					MockCreate: test.NewMockCreateFn(nil),
+					MockList:   syncedClaims("loadtest-01234567-1"),
+				},
+				now: func() time.Time { return time.Time{} },
+			},
+			want: want{
+				res: &Result{Run: run, Count: 2, Latencies: []time.Duration{0}},
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			r := NewRunner(tc.args.kube, gvk,
+				WithCount(2),
+				WithConcurrency(1),
+				WithPollInterval(time.Millisecond),
+				WithTimeout(50*time.Millisecond))
+			r.now = tc.args.now
+			r.id = func() string { return run }
+			res, err := r.Run(context.Background())
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\nr.Run(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.res, res); diff != "" {
+				t.Errorf("\nReason: %s\nr.Run(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestResult(t *testing.T) {
+	res := &Result{Count: 5, Elapsed: 2 * time.Second}
+	for i := 1; i <= 4; i++ {
+		res.Latencies = append(res.Latencies, time.Duration(i)*time.Second)
+	}
+	cases := map[string]struct {
+		got  interface{}
+		want interface{}
+	}{
+		"P50":        {got: res.Percentile(50), want: 2 * time.Second},
+		"P99":        {got: res.Percentile(99), want: 4 * time.Second},
+		"Throughput": {got: res.Throughput(), want: 2.0},
+		"Err":        {got: fmt.Sprint(res.Err()), want: fmt.Sprintf(errFmtNotAllSync, 1, 5, 2*time.Second)},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, tc.got); diff != "" {
+				t.Errorf("-want, +got:\n%s", diff)
+			}
+		})
+	}
+}
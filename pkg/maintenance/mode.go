@@ -0,0 +1,124 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package maintenance contains the maintenance mode of the local cluster, in
+// which the claims are frozen: the remote claims aren't deleted, so that the
+// claims that are deleted and recreated during the maintenance, e.g. by node
+// pool rebuilds, don't deprovision their infrastructure. Unlike the emergency
+// stop, everything else keeps being synced.
+package maintenance
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane-runtime/pkg/resource"
+
+	"github.com/crossplane/agent/pkg/metrics"
+)
+
+// AnnotationKeyMaintenance is the key of the annotation that enables the
+// maintenance mode when it's set to "true" on the watched ConfigMap.
+const AnnotationKeyMaintenance = "agent.crossplane.io/maintenance"
+
+const errGetConfigMap = "cannot get maintenance configmap"
+
+// ModeOption is used to configure *Mode.
+type ModeOption func(*Mode)
+
+// WithEnabled specifies whether the Mode is enabled regardless of the
+// ConfigMap, e.g. when the agent is started with the maintenance flag.
+func WithEnabled(enabled bool) ModeOption {
+	return func(m *Mode) {
+		m.enabled = enabled
+	}
+}
+
+// WithConfigMap specifies the ConfigMap that the Mode should consult on every
+// check. The Mode is enabled while the ConfigMap is annotated with
+// AnnotationKeyMaintenance set to "true".
+func WithConfigMap(kube client.Reader, key types.NamespacedName) ModeOption {
+	return func(m *Mode) {
+		m.kube = kube
+		m.key = key
+	}
+}
+
+// WithLogger specifies how the Mode should log messages.
+func WithLogger(l logging.Logger) ModeOption {
+	return func(m *Mode) {
+		m.log = l
+	}
+}
+
+// NewMode returns a new *Mode that is not enabled unless configured otherwise.
+func NewMode(opts ...ModeOption) *Mode {
+	m := &Mode{log: logging.NewNopLogger()}
+	for _, f := range opts {
+		f(m)
+	}
+	return m
+}
+
+// Mode reports whether the local cluster is under maintenance. It's safe to
+// share a single Mode between reconcilers.
+type Mode struct {
+	enabled bool
+	kube    client.Reader
+	key     types.NamespacedName
+	log     logging.Logger
+
+	mu   sync.Mutex
+	last bool
+}
+
+// Enabled returns whether the maintenance mode is enabled. A missing ConfigMap
+// means it's not enabled.
+func (m *Mode) Enabled(ctx context.Context) (bool, error) {
+	enabled := m.enabled
+	if !enabled && m.kube != nil {
+		cm := &corev1.ConfigMap{}
+		err := m.kube.Get(ctx, m.key, cm)
+		if resource.IgnoreNotFound(err) != nil {
+			return false, errors.Wrap(err, errGetConfigMap)
+		}
+		enabled = err == nil && cm.GetAnnotations()[AnnotationKeyMaintenance] == "true"
+	}
+	m.record(enabled)
+	return enabled, nil
+}
+
+func (m *Mode) record(enabled bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if enabled == m.last {
+		return
+	}
+	m.last = enabled
+	if enabled {
+		metrics.MaintenanceEnabled.Set(1)
+		m.log.Info("Maintenance mode is enabled, remote claims are not deleted")
+		return
+	}
+	metrics.MaintenanceEnabled.Set(0)
+	m.log.Info("Maintenance mode is disabled, remote claims are deleted again")
+}
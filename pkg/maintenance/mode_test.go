@@ -0,0 +1,91 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package maintenance
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+)
+
+var errBoom = errors.New("boom")
+
+func TestMode(t *testing.T) {
+	key := types.NamespacedName{Namespace: "crossplane-system", Name: "maintenance"}
+	withAnnotation := func(val string) test.MockGetFn {
+		return func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+			cm := obj.(*corev1.ConfigMap)
+			cm.SetAnnotations(map[string]string{AnnotationKeyMaintenance: val})
+			return nil
+		}
+	}
+	type want struct {
+		enabled bool
+		err     error
+	}
+	cases := map[string]struct {
+		reason string
+		opts   []ModeOption
+		want   want
+	}{
+		"Default": {
+			reason: "The maintenance mode should not be enabled by default",
+		},
+		"Flag": {
+			reason: "The maintenance mode should be enabled if it's configured to be",
+			opts:   []ModeOption{WithEnabled(true)},
+			want:   want{enabled: true},
+		},
+		"ConfigMapMissing": {
+			reason: "The maintenance mode should not be enabled if the ConfigMap does not exist",
+			opts: []ModeOption{WithConfigMap(&test.MockClient{
+				MockGet: test.NewMockGetFn(kerrors.NewNotFound(schema.GroupResource{}, key.Name)),
+			}, key)},
+		},
+		"ConfigMapGetFailed": {
+			reason: "An error should be returned if the ConfigMap cannot be fetched",
+			opts:   []ModeOption{WithConfigMap(&test.MockClient{MockGet: test.NewMockGetFn(errBoom)}, key)},
+			want:   want{err: errors.Wrap(errBoom, errGetConfigMap)},
+		},
+		"ConfigMapAnnotated": {
+			reason: "The maintenance mode should be enabled if the annotation is true",
+			opts:   []ModeOption{WithConfigMap(&test.MockClient{MockGet: withAnnotation("true")}, key)},
+			want:   want{enabled: true},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			enabled, err := NewMode(tc.opts...).Enabled(context.Background())
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\nm.Enabled(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.enabled, enabled); diff != "" {
+				t.Errorf("\nReason: %s\nm.Enabled(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics contains the Prometheus metrics exposed by the agent. All
+// metrics are registered with the controller-runtime registry so that they're
+// served by the metrics endpoint of the managers.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const namespace = "crossplane_agent"
+
+var (
+	// RemoteThrottledRequests counts the requests to the remote cluster that
+	// were rejected because the remote cluster is saturated.
+	RemoteThrottledRequests = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "remote_throttled_requests_total",
+		Help:      "Total number of requests rejected by the remote cluster with 429 Too Many Requests.",
+	})
+
+	// RemoteBackoffActive is 1 while the agent is backing off from the remote
+	// cluster and 0 otherwise.
+	RemoteBackoffActive = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "remote_backoff_active",
+		Help:      "Whether the agent is backing off from the remote cluster because it's saturated.",
+	})
+
+	// SyncErrors counts the errors the agent encountered while syncing,
+	// labelled with their reason, e.g. RBACDeniedRemote or NetworkTimeoutLocal.
+	SyncErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sync_errors_total",
+		Help:      "Total number of errors encountered while syncing, by reason.",
+	}, []string{"reason"})
+
+	// MissingPermissions is 1 for every permission that the agent needs but
+	// doesn't have according to its self-check and 0 for the ones it has.
+	MissingPermissions = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "missing_permissions",
+		Help:      "Whether the agent lacks a permission it needs, by cluster, verb, group and resource.",
+	}, []string{"cluster", "verb", "group", "resource"})
+
+	// ClaimReadySeconds observes how long it takes for a claim to become ready
+	// after it's created in the local cluster, labelled with its kind. The
+	// agent logs the claim along with the latency at debug level since this
+	// version of the Prometheus client doesn't support exemplars.
+	ClaimReadySeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "claim_ready_seconds",
+		Help:      "Time from the creation of a claim in the local cluster until it becomes ready, by kind.",
+		Buckets:   []float64{5, 10, 30, 60, 120, 300, 600, 1200, 1800, 3600},
+	}, []string{"kind"})
+
+	// ClaimSLAExceeded counts the claims that weren't ready within the
+	// provisioning SLA of their kind, labelled with their kind.
+	ClaimSLAExceeded = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "claim_sla_exceeded_total",
+		Help:      "Number of claims that weren't ready within their provisioning SLA, by kind.",
+	}, []string{"kind"})
+
+	// PendingRemovals is the number of synced objects in the local cluster
+	// that are gone from the remote cluster but not deleted yet, labelled
+	// with the name of their CRD.
+	PendingRemovals = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pending_removals",
+		Help:      "Number of synced objects that are gone from the remote cluster and waiting to be deleted, by CRD.",
+	}, []string{"crd"})
+
+	// DeletionBreakerOpen is 1 while the agent refuses to delete the synced
+	// objects of a type because too many of them are gone from the remote
+	// cluster at once, labelled with the name of their CRD, and 0 otherwise.
+	DeletionBreakerOpen = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "deletion_breaker_open",
+		Help:      "Whether the deletion of the synced objects of a type is halted because too many of them are gone from the remote cluster, by CRD.",
+	}, []string{"crd"})
+
+	// EmergencyStopEngaged is 1 while the writes to the remote cluster are
+	// halted by the emergency stop and 0 otherwise.
+	EmergencyStopEngaged = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "emergency_stop_engaged",
+		Help:      "Whether the writes to the remote cluster are halted by the emergency stop.",
+	})
+
+	// RemoteSecretReads counts the reads of Secrets of the remote cluster,
+	// labelled with whether they were served from the cache or the remote
+	// cluster.
+	RemoteSecretReads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "remote_secret_reads_total",
+		Help:      "Number of reads of Secrets of the remote cluster, by whether they were served from the cache or the remote cluster.",
+	}, []string{"source"})
+
+	// RemoteConnectionsOpen is the number of connections to the API server
+	// of the remote cluster that the shared transport holds open.
+	RemoteConnectionsOpen = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "remote_connections_open",
+		Help:      "Number of open connections to the API server of the remote cluster.",
+	})
+
+	// RemoteRequests counts the requests to the remote cluster, labelled with
+	// whether they reused a pooled connection or needed a new one.
+	RemoteRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "remote_requests_total",
+		Help:      "Total number of requests to the remote cluster, by whether they reused a pooled connection.",
+	}, []string{"connection"})
+
+	// MaintenanceEnabled is 1 while the local cluster is under maintenance, in
+	// which the remote claims aren't deleted, and 0 otherwise.
+	MaintenanceEnabled = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "maintenance_enabled",
+		Help:      "Whether the local cluster is under maintenance, in which the remote claims are not deleted.",
+	})
+
+	// CRDWrites counts the writes of CustomResourceDefinitions to the local
+	// cluster, labelled with the name of the CRD. The syncs that find the CRD
+	// unchanged don't write it, so they aren't counted.
+	CRDWrites = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "crd_writes_total",
+		Help:      "Total number of writes of CustomResourceDefinitions to the local cluster, by CRD.",
+	}, []string{"crd"})
+
+	// ReconcilePhaseSeconds observes how long each phase of the reconciles of
+	// claims takes, labelled with the kind of the claim and the phase, i.e.
+	// LocalGet, RemoteGet, Apply, Status and Secret, so that it can be told
+	// how much of the reconcile timeout of two minutes each one consumes.
+	ReconcilePhaseSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "reconcile_phase_seconds",
+		Help:      "Time spent in each phase of the reconciles of claims, by kind and phase.",
+		Buckets:   []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 120},
+	}, []string{"kind", "phase"})
+
+	// Claims is the number of claims in the local cluster, labelled with their
+	// kind, namespace and state, i.e. total, ready and failed. It's updated
+	// with the fleet report if it breaks the claims down by namespace.
+	Claims = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "claims",
+		Help:      "Number of claims in the local cluster, by kind, namespace and state.",
+	}, []string{"kind", "namespace", "state"})
+
+	// SchemaDrift is 1 while the schema of a claim CRD in the local cluster
+	// differs from the one in the remote cluster because the latter cannot be
+	// applied, labelled with the name of the CRD, and 0 otherwise.
+	SchemaDrift = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "schema_drift",
+		Help:      "Whether the schema of a claim CRD in the local cluster differs from the one in the remote cluster, by CRD.",
+	}, []string{"crd"})
+
+	// QueuedUpdates is the number of synced objects in the local cluster whose
+	// updates wait for their turn in the rollout window, labelled with the
+	// name of their CRD.
+	QueuedUpdates = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queued_updates",
+		Help:      "Number of synced objects whose updates wait for their turn in the rollout window, by CRD.",
+	}, []string{"crd"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		RemoteThrottledRequests,
+		RemoteBackoffActive,
+		EmergencyStopEngaged,
+		SyncErrors,
+		MissingPermissions,
+		ClaimReadySeconds,
+		ClaimSLAExceeded,
+		PendingRemovals,
+		DeletionBreakerOpen,
+		CRDWrites,
+		ReconcilePhaseSeconds,
+		Claims,
+		SchemaDrift,
+		QueuedUpdates,
+		MaintenanceEnabled,
+		RemoteSecretReads,
+		RemoteConnectionsOpen,
+		RemoteRequests,
+	)
+}
@@ -0,0 +1,289 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package migration migrates the local claims that are stored at an old
+// version of their type to its storage version once the type is bumped in the
+// remote cluster, so that the old version can be dropped from the local CRD
+// instead of leaving the claims stranded on it.
+package migration
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	kunstructured "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane-runtime/pkg/resource"
+)
+
+const (
+	errReadRules       = "cannot read migration rules file"
+	errParseRules      = "cannot parse migration rules file"
+	errFmtInvalidRule  = "invalid migration rule %d"
+	errNoResource      = "resource is required"
+	errNoFrom          = "from is required"
+	errFmtParseField   = "field %d: cannot parse %q"
+	errFmtNotField     = "field %d: %q must end with a field name"
+	errFmtNotServed    = "stored version %s is not served"
+	errFmtListClaims   = "cannot list claims of version %s"
+	errFmtMigrateClaim = "cannot migrate claim %s/%s"
+	errFmtUpdateClaim  = "cannot update claim %s/%s"
+	errUpdateCRD       = "cannot update stored versions of custom resource definition"
+)
+
+// Rules are the migration rules of a rules file.
+type Rules struct {
+	Rules []Rule `json:"rules"`
+}
+
+// A Rule maps the fields of the claims of a type that are stored at an old
+// version to the ones of its storage version.
+type Rule struct {
+	// Resource is the claim type in resource.group format, i.e. the name of
+	// its CRD, e.g. postgresqlinstances.database.example.org.
+	Resource string `json:"resource"`
+
+	// From is the old version that the claims are migrated from.
+	From string `json:"from"`
+
+	// Fields are the fields that are moved, in the order they're given.
+	Fields []Field `json:"fields,omitempty"`
+}
+
+// A Field is moved from one path to another, e.g. from spec.size to
+// spec.parameters.storageGB.
+type Field struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Validate returns an error if the rule cannot be applied to any claim.
+func (r Rule) Validate() error {
+	if r.Resource == "" {
+		return errors.New(errNoResource)
+	}
+	if r.From == "" {
+		return errors.New(errNoFrom)
+	}
+	for i, f := range r.Fields {
+		for _, p := range []string{f.From, f.To} {
+			s, err := fieldpath.Parse(p)
+			if err != nil {
+				return errors.Wrapf(err, errFmtParseField, i, p)
+			}
+			if len(s) == 0 || s[len(s)-1].Type != fieldpath.SegmentField {
+				return errors.Errorf(errFmtNotField, i, p)
+			}
+		}
+	}
+	return nil
+}
+
+// Load returns the rules of the supplied YAML file. All rules are validated so
+// that invalid ones are caught at startup rather than when the claims are
+// migrated.
+func Load(path string) ([]Rule, error) {
+	raw, err := ioutil.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, errors.Wrap(err, errReadRules)
+	}
+	rs := &Rules{}
+	if err := yaml.UnmarshalStrict(raw, rs); err != nil {
+		return nil, errors.Wrap(err, errParseRules)
+	}
+	for i, r := range rs.Rules {
+		if err := r.Validate(); err != nil {
+			return nil, errors.Wrapf(err, errFmtInvalidRule, i)
+		}
+	}
+	return rs.Rules, nil
+}
+
+// An Option configures a Migrator.
+type Option func(*Migrator)
+
+// WithRules specifies the rules that the Migrator should map the fields of
+// the claims with. The claims whose types and versions have no rules are
+// migrated as they are.
+func WithRules(rules ...Rule) Option {
+	return func(m *Migrator) {
+		m.rules = append(m.rules, rules...)
+	}
+}
+
+// WithLogger specifies how the Migrator should log messages.
+func WithLogger(l logging.Logger) Option {
+	return func(m *Migrator) {
+		m.log = l
+	}
+}
+
+// New returns a Migrator that lists the claims with the supplied reader, e.g.
+// one that isn't backed by a cache that would watch the old versions, and
+// writes them and their CRDs with the supplied client.
+func New(kube client.Client, r client.Reader, opts ...Option) *Migrator {
+	m := &Migrator{client: kube, reader: r, log: logging.NewNopLogger()}
+	for _, f := range opts {
+		f(m)
+	}
+	return m
+}
+
+// A Migrator migrates the claims that are stored at the old versions of their
+// CRD to its storage version.
+type Migrator struct {
+	client client.Client
+	reader client.Reader
+	rules  []Rule
+	log    logging.Logger
+}
+
+// Migrate reads the claims of the supplied CRD at every version that they may
+// still be stored at according to its status, maps their fields with the
+// rules of that version, and writes them back at the storage version. The
+// stored versions of the CRD are then reduced to the storage version so that
+// the old versions can be dropped from it. The old versions have to be
+// served until then. Claims that were already migrated or that were written
+// at the storage version are left as they are by the field mappings, so a
+// migration that fails half way through can be retried.
+func (m *Migrator) Migrate(ctx context.Context, crd *v1beta1.CustomResourceDefinition) error {
+	storage := storageVersion(crd)
+	old := false
+	for _, v := range crd.Status.StoredVersions {
+		if v == storage {
+			continue
+		}
+		old = true
+		if !served(crd, v) {
+			return errors.Errorf(errFmtNotServed, v)
+		}
+		if err := m.migrate(ctx, crd, v, storage); err != nil {
+			return err
+		}
+	}
+	if !old {
+		return nil
+	}
+	crd.Status.StoredVersions = []string{storage}
+	return errors.Wrap(m.client.Status().Update(ctx, crd), errUpdateCRD)
+}
+
+func (m *Migrator) migrate(ctx context.Context, crd *v1beta1.CustomResourceDefinition, from, to string) error {
+	l := &kunstructured.UnstructuredList{}
+	l.SetGroupVersionKind(schema.GroupVersionKind{Group: crd.Spec.Group, Version: from, Kind: crd.Spec.Names.ListKind})
+	if err := m.reader.List(ctx, l); err != nil {
+		return errors.Wrapf(err, errFmtListClaims, from)
+	}
+	for i := range l.Items {
+		cm := &l.Items[i]
+		for _, r := range m.rules {
+			if r.Resource != crd.GetName() || r.From != from {
+				continue
+			}
+			if err := Apply(r, cm); err != nil {
+				return errors.Wrapf(err, errFmtMigrateClaim, cm.GetNamespace(), cm.GetName())
+			}
+		}
+		cm.SetAPIVersion(schema.GroupVersion{Group: crd.Spec.Group, Version: to}.String())
+		if err := m.client.Update(ctx, cm); resource.IgnoreNotFound(err) != nil {
+			return errors.Wrapf(err, errFmtUpdateClaim, cm.GetNamespace(), cm.GetName())
+		}
+	}
+	m.log.Debug("Migrated claims", "crd", crd.GetName(), "from", from, "to", to, "count", len(l.Items))
+	return nil
+}
+
+// Apply moves the fields of the supplied claim as the supplied rule says. A
+// field is moved only if it's set and the field it's moved to isn't, so that
+// the claims that were already migrated aren't changed.
+func Apply(r Rule, cm *kunstructured.Unstructured) error {
+	p := fieldpath.Pave(cm.Object)
+	for _, f := range r.Fields {
+		v, err := p.GetValue(f.From)
+		if fieldpath.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := p.GetValue(f.To); !fieldpath.IsNotFound(err) {
+			continue
+		}
+		if err := p.SetValue(f.To, v); err != nil {
+			return err
+		}
+		if err := deleteField(cm.Object, f.From); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteField deletes the field at the supplied path, which has to end with a
+// field name, if it exists.
+func deleteField(obj map[string]interface{}, path string) error {
+	s, err := fieldpath.Parse(path)
+	if err != nil {
+		return err
+	}
+	var cur interface{} = obj
+	for _, seg := range s[:len(s)-1] {
+		switch c := cur.(type) {
+		case map[string]interface{}:
+			cur = c[seg.Field]
+		case []interface{}:
+			if int(seg.Index) >= len(c) {
+				return nil
+			}
+			cur = c[seg.Index]
+		default:
+			return nil
+		}
+	}
+	if c, ok := cur.(map[string]interface{}); ok {
+		delete(c, s[len(s)-1].Field)
+	}
+	return nil
+}
+
+func storageVersion(crd *v1beta1.CustomResourceDefinition) string {
+	for _, v := range crd.Spec.Versions {
+		if v.Storage {
+			return v.Name
+		}
+	}
+	return crd.Spec.Version
+}
+
+func served(crd *v1beta1.CustomResourceDefinition, version string) bool {
+	if len(crd.Spec.Versions) == 0 {
+		return crd.Spec.Version == version
+	}
+	for _, v := range crd.Spec.Versions {
+		if v.Name == version {
+			return v.Served
+		}
+	}
+	return false
+}
@@ -0,0 +1,207 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package migration
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	kunstructured "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+)
+
+const databases = "databases.example.org"
+
+func claim(spec map[string]interface{}) *kunstructured.Unstructured {
+	return &kunstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "example.org/v1alpha1",
+		"kind":       "Database",
+		"metadata":   map[string]interface{}{"namespace": "default", "name": "db"},
+		"spec":       spec,
+	}}
+}
+
+func TestValidate(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		rule   Rule
+		want   error
+	}{
+		"Valid": {
+			reason: "Rules that move fields should be valid",
+			rule:   Rule{Resource: databases, From: "v1alpha1", Fields: []Field{{From: "spec.size", To: "spec.parameters.storageGB"}}},
+		},
+		"NoFrom": {
+			reason: "Rules without the version they migrate from should be invalid",
+			rule:   Rule{Resource: databases},
+			want:   errors.New(errNoFrom),
+		},
+		"NotAField": {
+			reason: "Paths that end with an index should be invalid",
+			rule:   Rule{Resource: databases, From: "v1alpha1", Fields: []Field{{From: "spec.sizes[0]", To: "spec.size"}}},
+			want:   errors.Errorf(errFmtNotField, 0, "spec.sizes[0]"),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := tc.rule.Validate()
+			if diff := cmp.Diff(tc.want, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\nValidate(): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	rule := Rule{Resource: databases, From: "v1alpha1", Fields: []Field{{From: "spec.size", To: "spec.parameters.storageGB"}}}
+	cases := map[string]struct {
+		reason string
+		claim  *kunstructured.Unstructured
+		want   *kunstructured.Unstructured
+	}{
+		"Moved": {
+			reason: "Fields that are set should be moved",
+			claim:  claim(map[string]interface{}{"size": int64(20)}),
+			// The moved values are round-tripped through JSON.
+			want: claim(map[string]interface{}{"parameters": map[string]interface{}{"storageGB": float64(20)}}),
+		},
+		"AlreadyMigrated": {
+			reason: "Fields should not be moved over fields that are already set",
+			claim:  claim(map[string]interface{}{"size": int64(20), "parameters": map[string]interface{}{"storageGB": int64(50)}}),
+			want:   claim(map[string]interface{}{"size": int64(20), "parameters": map[string]interface{}{"storageGB": int64(50)}}),
+		},
+		"NotSet": {
+			reason: "Claims without the fields should be left as is",
+			claim:  claim(map[string]interface{}{"engine": "postgres"}),
+			want:   claim(map[string]interface{}{"engine": "postgres"}),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if err := Apply(rule, tc.claim); err != nil {
+				t.Fatalf("Apply(...): %s", err)
+			}
+			if diff := cmp.Diff(tc.want, tc.claim); diff != "" {
+				t.Errorf("\nReason: %s\nApply(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	errBoom := errors.New("boom")
+	crd := func(versions []v1beta1.CustomResourceDefinitionVersion, stored ...string) *v1beta1.CustomResourceDefinition {
+		c := &v1beta1.CustomResourceDefinition{
+			Spec: v1beta1.CustomResourceDefinitionSpec{
+				Group:    "example.org",
+				Names:    v1beta1.CustomResourceDefinitionNames{Kind: "Database", ListKind: "DatabaseList"},
+				Versions: versions,
+			},
+			Status: v1beta1.CustomResourceDefinitionStatus{StoredVersions: stored},
+		}
+		c.SetName(databases)
+		return c
+	}
+	bumped := []v1beta1.CustomResourceDefinitionVersion{{Name: "v1alpha1", Served: true}, {Name: "v1beta1", Served: true, Storage: true}}
+	list := func(_ context.Context, obj runtime.Object, _ ...client.ListOption) error {
+		l := obj.(*kunstructured.UnstructuredList)
+		if diff := cmp.Diff("example.org/v1alpha1", l.GetAPIVersion()); diff != "" {
+			t.Errorf("List(...): -want version, +got version:\n%s", diff)
+		}
+		l.Items = []kunstructured.Unstructured{*claim(map[string]interface{}{"size": int64(20)})}
+		return nil
+	}
+
+	type want struct {
+		err     error
+		updated []string
+		stored  []string
+	}
+	cases := map[string]struct {
+		reason string
+		crd    *v1beta1.CustomResourceDefinition
+		update error
+		want   want
+	}{
+		"Migrated": {
+			reason: "Claims stored at old versions should be mapped and written at the storage version, which should then be the only stored version",
+			crd:    crd(bumped, "v1alpha1", "v1beta1"),
+			want: want{
+				updated: []string{`{"apiVersion":"example.org/v1beta1","kind":"Database","metadata":{"name":"db","namespace":"default"},"spec":{"parameters":{"storageGB":20}}}`},
+				stored:  []string{"v1beta1"},
+			},
+		},
+		"NothingToMigrate": {
+			reason: "Nothing should be written if the claims are stored only at the storage version",
+			crd:    crd(bumped, "v1beta1"),
+			want:   want{stored: []string{"v1beta1"}},
+		},
+		"NotServed": {
+			reason: "An error should be returned if the claims cannot be read at the version they're stored at",
+			crd:    crd([]v1beta1.CustomResourceDefinitionVersion{{Name: "v1alpha1"}, {Name: "v1beta1", Served: true, Storage: true}}, "v1alpha1", "v1beta1"),
+			want: want{
+				err:    errors.Errorf(errFmtNotServed, "v1alpha1"),
+				stored: []string{"v1alpha1", "v1beta1"},
+			},
+		},
+		"UpdateFailed": {
+			reason: "The stored versions should be kept if a claim cannot be migrated",
+			crd:    crd(bumped, "v1alpha1", "v1beta1"),
+			update: errBoom,
+			want: want{
+				err:    errors.Wrapf(errBoom, errFmtUpdateClaim, "default", "db"),
+				stored: []string{"v1alpha1", "v1beta1"},
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var updated []string
+			kube := &test.MockClient{
+				MockUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+					raw, _ := obj.(*kunstructured.Unstructured).MarshalJSON()
+					updated = append(updated, strings.TrimSpace(string(raw)))
+					return tc.update
+				},
+				MockStatusUpdate: test.NewMockStatusUpdateFn(nil),
+			}
+			err := New(kube, &test.MockClient{MockList: list}, WithRules(Rule{
+				Resource: databases,
+				From:     "v1alpha1",
+				Fields:   []Field{{From: "spec.size", To: "spec.parameters.storageGB"}},
+			})).Migrate(context.Background(), tc.crd)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\nMigrate(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if tc.update == nil {
+				if diff := cmp.Diff(tc.want.updated, updated); diff != "" {
+					t.Errorf("\nReason: %s\nMigrate(...): -want updated claims, +got updated claims:\n%s", tc.reason, diff)
+				}
+			}
+			if diff := cmp.Diff(tc.want.stored, tc.crd.Status.StoredVersions); diff != "" {
+				t.Errorf("\nReason: %s\nMigrate(...): -want stored versions, +got stored versions:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package netpol generates NetworkPolicies that allow the agent to reach only
+// the API servers it works with.
+package netpol
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DefaultName is the name of the generated NetworkPolicy.
+const DefaultName = "crossplane-agent-egress"
+
+const (
+	errFmtParseServer   = "cannot parse server address %s"
+	errFmtResolveServer = "cannot resolve server address %s"
+	errFmtPort          = "cannot parse port of server address %s"
+	errGetEndpoints     = "cannot get endpoints of the kubernetes service"
+)
+
+// An Endpoint is a set of addresses that serve on the same port.
+type Endpoint struct {
+	IPs  []net.IP
+	Port int32
+}
+
+// A Resolver returns the IP addresses of a host.
+type Resolver func(ctx context.Context, host string) ([]net.IP, error)
+
+// DefaultResolver resolves hosts with the DNS resolver of the system.
+func DefaultResolver(ctx context.Context, host string) ([]net.IP, error) {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]net.IP, len(addrs))
+	for i := range addrs {
+		ips[i] = addrs[i].IP
+	}
+	return ips, nil
+}
+
+// ServerEndpoint returns the Endpoint of the API server with the supplied
+// address, e.g. the server of a kubeconfig. Host names are resolved with the
+// supplied Resolver, so the generated policy has to be regenerated if the
+// addresses of the server change.
+func ServerEndpoint(ctx context.Context, server string, r Resolver) (Endpoint, error) {
+	u, err := url.Parse(server)
+	if err != nil || u.Hostname() == "" {
+		return Endpoint{}, errors.Errorf(errFmtParseServer, server)
+	}
+	port := 443
+	if u.Scheme == "http" {
+		port = 80
+	}
+	if p := u.Port(); p != "" {
+		if port, err = strconv.Atoi(p); err != nil {
+			return Endpoint{}, errors.Errorf(errFmtPort, server)
+		}
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil {
+		return Endpoint{IPs: []net.IP{ip}, Port: int32(port)}, nil
+	}
+	ips, err := r(ctx, u.Hostname())
+	if err != nil {
+		return Endpoint{}, errors.Wrapf(err, errFmtResolveServer, server)
+	}
+	return Endpoint{IPs: ips, Port: int32(port)}, nil
+}
+
+// KubernetesEndpoints returns the Endpoints of the API server of the cluster
+// of the supplied client, i.e. the addresses behind the kubernetes service in
+// the default namespace. They're what NetworkPolicies are evaluated against
+// once the traffic to the service is translated.
+func KubernetesEndpoints(ctx context.Context, kube client.Reader) ([]Endpoint, error) {
+	e := &corev1.Endpoints{}
+	if err := kube.Get(ctx, client.ObjectKey{Namespace: "default", Name: "kubernetes"}, e); err != nil {
+		return nil, errors.Wrap(err, errGetEndpoints)
+	}
+	var out []Endpoint
+	for _, s := range e.Subsets {
+		var ips []net.IP
+		for _, a := range s.Addresses {
+			if ip := net.ParseIP(a.IP); ip != nil {
+				ips = append(ips, ip)
+			}
+		}
+		for _, p := range s.Ports {
+			out = append(out, Endpoint{IPs: ips, Port: p.Port})
+		}
+	}
+	return out, nil
+}
+
+// GeneratorOption is used to configure *Generator.
+type GeneratorOption func(*Generator)
+
+// WithName specifies the name of the generated NetworkPolicy.
+func WithName(name string) GeneratorOption {
+	return func(g *Generator) {
+		g.name = name
+	}
+}
+
+// WithNamespace specifies the namespace of the generated NetworkPolicy, which
+// should be the namespace of the agent.
+func WithNamespace(ns string) GeneratorOption {
+	return func(g *Generator) {
+		g.namespace = ns
+	}
+}
+
+// WithPodLabels specifies the labels of the pods of the agent.
+func WithPodLabels(l map[string]string) GeneratorOption {
+	return func(g *Generator) {
+		g.podLabels = l
+	}
+}
+
+// WithDNS specifies whether the agent should be allowed to reach DNS servers,
+// which it needs when the addresses of the API servers are host names.
+func WithDNS(allow bool) GeneratorOption {
+	return func(g *Generator) {
+		g.dns = allow
+	}
+}
+
+// NewGenerator returns a new *Generator.
+func NewGenerator(opts ...GeneratorOption) *Generator {
+	g := &Generator{name: DefaultName}
+	for _, f := range opts {
+		f(g)
+	}
+	return g
+}
+
+// Generator generates a NetworkPolicy that allows the pods of the agent to
+// send traffic only to the supplied endpoints, and to DNS servers if
+// configured to. It doesn't restrict the ingress of the pods.
+type Generator struct {
+	name      string
+	namespace string
+	podLabels map[string]string
+	dns       bool
+}
+
+// Generate returns the NetworkPolicy for the supplied endpoints.
+func (g *Generator) Generate(endpoints ...Endpoint) *networkingv1.NetworkPolicy {
+	tcp := corev1.ProtocolTCP
+	udp := corev1.ProtocolUDP
+	np := &networkingv1.NetworkPolicy{
+		TypeMeta:   metav1.TypeMeta{APIVersion: networkingv1.SchemeGroupVersion.String(), Kind: "NetworkPolicy"},
+		ObjectMeta: metav1.ObjectMeta{Name: g.name, Namespace: g.namespace},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: g.podLabels},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+		},
+	}
+	// Endpoints that serve on the same port are allowed with one rule.
+	byPort := map[int32][]string{}
+	for _, e := range endpoints {
+		for _, ip := range e.IPs {
+			byPort[e.Port] = appendUnique(byPort[e.Port], cidr(ip))
+		}
+	}
+	ports := make([]int, 0, len(byPort))
+	for p := range byPort {
+		ports = append(ports, int(p))
+	}
+	sort.Ints(ports)
+	for _, p := range ports {
+		port := intstr.FromInt(p)
+		rule := networkingv1.NetworkPolicyEgressRule{Ports: []networkingv1.NetworkPolicyPort{{Protocol: &tcp, Port: &port}}}
+		for _, c := range byPort[int32(p)] {
+			rule.To = append(rule.To, networkingv1.NetworkPolicyPeer{IPBlock: &networkingv1.IPBlock{CIDR: c}})
+		}
+		np.Spec.Egress = append(np.Spec.Egress, rule)
+	}
+	if g.dns {
+		dns := intstr.FromInt(53)
+		np.Spec.Egress = append(np.Spec.Egress, networkingv1.NetworkPolicyEgressRule{
+			Ports: []networkingv1.NetworkPolicyPort{{Protocol: &udp, Port: &dns}, {Protocol: &tcp, Port: &dns}},
+		})
+	}
+	return np
+}
+
+func cidr(ip net.IP) string {
+	if ip.To4() != nil {
+		return ip.String() + "/32"
+	}
+	return ip.String() + "/128"
+}
+
+func appendUnique(l []string, v string) []string {
+	for _, e := range l {
+		if e == v {
+			return l
+		}
+	}
+	return append(l, v)
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package netpol
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+)
+
+var errBoom = errors.New("boom")
+
+func TestServerEndpoint(t *testing.T) {
+	resolver := func(_ context.Context, host string) ([]net.IP, error) {
+		if host == "remote.example.org" {
+			return []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")}, nil
+		}
+		return nil, errBoom
+	}
+	type want struct {
+		e   Endpoint
+		err error
+	}
+	cases := map[string]struct {
+		reason string
+		server string
+		want   want
+	}{
+		"IP": {
+			reason: "The addresses that are IPs shouldn't be resolved",
+			server: "https://192.168.1.10:6443",
+			want:   want{e: Endpoint{IPs: []net.IP{net.ParseIP("192.168.1.10")}, Port: 6443}},
+		},
+		"HostName": {
+			reason: "The host names should be resolved and the port should default to 443",
+			server: "https://remote.example.org",
+			want:   want{e: Endpoint{IPs: []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")}, Port: 443}},
+		},
+		"ResolveFailed": {
+			reason: "Errors that are encountered while resolving should be returned",
+			server: "https://unknown.example.org:8443",
+			want:   want{err: errors.Wrapf(errBoom, errFmtResolveServer, "https://unknown.example.org:8443")},
+		},
+		"NoHost": {
+			reason: "Addresses without a host should be rejected",
+			server: "",
+			want:   want{err: errors.Errorf(errFmtParseServer, "")},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			e, err := ServerEndpoint(context.Background(), tc.server, resolver)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\nServerEndpoint(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.e, e); diff != "" {
+				t.Errorf("\nReason: %s\nServerEndpoint(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	tcp := corev1.ProtocolTCP
+	udp := corev1.ProtocolUDP
+	https := intstr.FromInt(443)
+	api := intstr.FromInt(6443)
+	dns := intstr.FromInt(53)
+	labels := map[string]string{"app": "crossplane-agent"}
+
+	cases := map[string]struct {
+		reason    string
+		opts      []GeneratorOption
+		endpoints []Endpoint
+		want      *networkingv1.NetworkPolicy
+	}{
+		"GroupedByPort": {
+			reason: "The addresses should be allowed once per port and in the order of the ports",
+			opts:   []GeneratorOption{WithNamespace("crossplane-system"), WithPodLabels(labels)},
+			endpoints: []Endpoint{
+				{IPs: []net.IP{net.ParseIP("10.0.0.1")}, Port: 6443},
+				{IPs: []net.IP{net.ParseIP("172.16.0.1"), net.ParseIP("fd00::1")}, Port: 443},
+				{IPs: []net.IP{net.ParseIP("10.0.0.1")}, Port: 6443},
+			},
+			want: &networkingv1.NetworkPolicy{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "networking.k8s.io/v1", Kind: "NetworkPolicy"},
+				ObjectMeta: metav1.ObjectMeta{Name: DefaultName, Namespace: "crossplane-system"},
+				Spec: networkingv1.NetworkPolicySpec{
+					PodSelector: metav1.LabelSelector{MatchLabels: labels},
+					PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+					Egress: []networkingv1.NetworkPolicyEgressRule{
+						{
+							Ports: []networkingv1.NetworkPolicyPort{{Protocol: &tcp, Port: &https}},
+							To: []networkingv1.NetworkPolicyPeer{
+								{IPBlock: &networkingv1.IPBlock{CIDR: "172.16.0.1/32"}},
+								{IPBlock: &networkingv1.IPBlock{CIDR: "fd00::1/128"}},
+							},
+						},
+						{
+							Ports: []networkingv1.NetworkPolicyPort{{Protocol: &tcp, Port: &api}},
+							To:    []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: "10.0.0.1/32"}}},
+						},
+					},
+				},
+			},
+		},
+		"DNS": {
+			reason: "DNS servers should be allowed if configured",
+			opts:   []GeneratorOption{WithName("agent"), WithDNS(true)},
+			want: &networkingv1.NetworkPolicy{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "networking.k8s.io/v1", Kind: "NetworkPolicy"},
+				ObjectMeta: metav1.ObjectMeta{Name: "agent"},
+				Spec: networkingv1.NetworkPolicySpec{
+					PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+					Egress: []networkingv1.NetworkPolicyEgressRule{
+						{Ports: []networkingv1.NetworkPolicyPort{{Protocol: &udp, Port: &dns}, {Protocol: &tcp, Port: &dns}}},
+					},
+				},
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := NewGenerator(tc.opts...).Generate(tc.endpoints...)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\nReason: %s\nGenerate(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
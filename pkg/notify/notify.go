@@ -0,0 +1,304 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package notify sends notifications about the significant transitions in the
+// lifecycle of claims, e.g. when their remote counterparts become ready, to
+// HTTP(S) webhooks such as the incoming webhooks of Slack.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+)
+
+const (
+	errMarshal    = "cannot marshal notification"
+	errPost       = "cannot post notification"
+	errFmtStatus  = "webhook responded with status %d"
+	errFmtWebhook = "invalid webhook %q: the URL is empty"
+)
+
+const (
+	defaultTimeout   = 10 * time.Second
+	defaultQueueSize = 100
+)
+
+// A Transition in the lifecycle of a claim.
+type Transition string
+
+// Transitions.
+const (
+	// Created claims are created in the remote cluster for the first time.
+	Created Transition = "Created"
+
+	// Ready claims have remote counterparts that just became ready.
+	Ready Transition = "Ready"
+
+	// Failed claims just started failing to sync.
+	Failed Transition = "Failed"
+
+	// Deleted claims have remote counterparts whose deletion is requested.
+	Deleted Transition = "Deleted"
+)
+
+// A Notification about a transition of a claim.
+type Notification struct {
+	Kind       string     `json:"kind"`
+	Namespace  string     `json:"namespace"`
+	Name       string     `json:"name"`
+	Transition Transition `json:"transition"`
+	Message    string     `json:"message,omitempty"`
+	Time       time.Time  `json:"time"`
+}
+
+// A Notifier sends notifications. Notify must not block since it's called
+// while claims are synced.
+type Notifier interface {
+	Notify(n Notification)
+}
+
+// NotifierFn is used to construct a Notifier with a bare function.
+type NotifierFn func(n Notification)
+
+// Notify calls the supplied function.
+func (fn NotifierFn) Notify(n Notification) {
+	fn(n)
+}
+
+// NewNopNotifier returns a Notifier that does nothing.
+func NewNopNotifier() Notifier {
+	return nopNotifier{}
+}
+
+type nopNotifier struct{}
+
+func (nopNotifier) Notify(_ Notification) {}
+
+// Notifiers sends notifications to all of its Notifiers.
+type Notifiers []Notifier
+
+// Notify sends the notification to all Notifiers.
+func (ns Notifiers) Notify(n Notification) {
+	for _, nt := range ns {
+		nt.Notify(n)
+	}
+}
+
+// Start starts the Notifiers that have to be started, e.g. Webhooks, until the
+// stop channel is closed.
+func (ns Notifiers) Start(stop <-chan struct{}) error {
+	var wg sync.WaitGroup
+	for _, nt := range ns {
+		s, ok := nt.(interface{ Start(<-chan struct{}) error })
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = s.Start(stop)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// A Format of the payloads a Webhook posts.
+type Format string
+
+// Formats.
+const (
+	// FormatJSON posts the Notification as is.
+	FormatJSON Format = "json"
+
+	// FormatSlack posts a message that the incoming webhooks of Slack and the
+	// services compatible with them accept.
+	FormatSlack Format = "slack"
+)
+
+// WebhookOption is used to configure *Webhook.
+type WebhookOption func(*Webhook)
+
+// WithFormat specifies the format of the payloads the Webhook posts. Defaults
+// to FormatJSON.
+func WithFormat(f Format) WebhookOption {
+	return func(w *Webhook) {
+		w.format = f
+	}
+}
+
+// WithKinds specifies the claim kinds the Webhook is notified about. It's
+// notified about all kinds if none are given.
+func WithKinds(kinds ...string) WebhookOption {
+	return func(w *Webhook) {
+		for _, k := range kinds {
+			w.kinds[k] = true
+		}
+	}
+}
+
+// WithHTTPClient specifies the client the Webhook posts with.
+func WithHTTPClient(c *http.Client) WebhookOption {
+	return func(w *Webhook) {
+		w.client = c
+	}
+}
+
+// WithLogger specifies how the Webhook should log the notifications it cannot
+// post.
+func WithLogger(l logging.Logger) WebhookOption {
+	return func(w *Webhook) {
+		w.log = l
+	}
+}
+
+// NewWebhook returns a new *Webhook that posts to the supplied URL.
+func NewWebhook(url string, opts ...WebhookOption) *Webhook {
+	w := &Webhook{
+		url:    url,
+		format: FormatJSON,
+		kinds:  map[string]bool{},
+		client: &http.Client{Timeout: defaultTimeout},
+		log:    logging.NewNopLogger(),
+		queue:  make(chan Notification, defaultQueueSize),
+	}
+	for _, f := range opts {
+		f(w)
+	}
+	return w
+}
+
+// A Webhook is a Notifier that posts the notifications to an HTTP(S)
+// endpoint. The notifications are posted one at a time once it's started.
+type Webhook struct {
+	url    string
+	format Format
+	kinds  map[string]bool
+	client *http.Client
+	log    logging.Logger
+	queue  chan Notification
+}
+
+// Notify queues the notification to be posted if the Webhook is notified
+// about its kind. Notifications that don't fit in the queue or cannot be
+// posted are logged and dropped.
+func (w *Webhook) Notify(n Notification) {
+	if len(w.kinds) > 0 && !w.kinds[n.Kind] {
+		return
+	}
+	select {
+	case w.queue <- n:
+	default:
+		w.log.Info("Cannot queue notification, the queue is full", "kind", n.Kind, "namespace", n.Namespace, "name", n.Name, "transition", n.Transition)
+	}
+}
+
+// Start posts the queued notifications until the stop channel is closed.
+func (w *Webhook) Start(stop <-chan struct{}) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop
+		cancel()
+	}()
+	for {
+		select {
+		case <-stop:
+			return nil
+		case n := <-w.queue:
+			if err := w.Send(ctx, n); err != nil {
+				w.log.Info("Cannot send notification", "kind", n.Kind, "namespace", n.Namespace, "name", n.Name, "transition", n.Transition, "error", err)
+			}
+		}
+	}
+}
+
+// Send posts the notification and waits for the response.
+func (w *Webhook) Send(ctx context.Context, n Notification) error {
+	var payload interface{} = n
+	if w.format == FormatSlack {
+		payload = slackMessage{Text: Text(n)}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrap(err, errMarshal)
+	}
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, errPost)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err, errPost)
+	}
+	defer resp.Body.Close() // nolint:errcheck
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.Errorf(errFmtStatus, resp.StatusCode)
+	}
+	return nil
+}
+
+var phrases = map[Transition]string{
+	Created: "is created in the remote cluster",
+	Ready:   "is ready",
+	Failed:  "cannot be synced",
+	Deleted: "is being deleted in the remote cluster",
+}
+
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+// Text returns a human readable summary of the supplied notification.
+func Text(n Notification) string {
+	name := n.Name
+	if n.Namespace != "" {
+		name = n.Namespace + "/" + n.Name
+	}
+	s := fmt.Sprintf("%s %s %s", n.Kind, name, phrases[n.Transition])
+	if n.Message != "" {
+		s += ": " + n.Message
+	}
+	return s
+}
+
+// ParseWebhook parses a webhook in [Kind,...=]URL format, e.g.
+// Database,Bucket=https://hooks.example.org/agent, into its URL and the
+// claim kinds it's notified about, which are all kinds if none are given.
+func ParseWebhook(s string) (url string, kinds []string, err error) {
+	url = s
+	// The kinds are separated by the first equal sign, unless it's a part of
+	// the URL, e.g. of its query.
+	if i := strings.Index(s, "="); i > 0 && !strings.Contains(s[:i], "://") {
+		kinds = strings.Split(s[:i], ",")
+		url = s[i+1:]
+	}
+	if url == "" {
+		return "", nil, errors.Errorf(errFmtWebhook, s)
+	}
+	return url, kinds, nil
+}
@@ -0,0 +1,179 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+)
+
+func TestWebhookSend(t *testing.T) {
+	n := Notification{
+		Kind:       "Database",
+		Namespace:  "default",
+		Name:       "db",
+		Transition: Ready,
+		Time:       time.Date(2020, 9, 1, 0, 0, 0, 0, time.UTC),
+	}
+	type want struct {
+		body string
+		err  error
+	}
+	cases := map[string]struct {
+		reason string
+		status int
+		opts   []WebhookOption
+		want   want
+	}{
+		"JSON": {
+			reason: "The notification should be posted as is by default",
+			status: http.StatusOK,
+			want:   want{body: `{"kind":"Database","namespace":"default","name":"db","transition":"Ready","time":"2020-09-01T00:00:00Z"}`},
+		},
+		"Slack": {
+			reason: "A Slack message should be posted in Slack format",
+			status: http.StatusOK,
+			opts:   []WebhookOption{WithFormat(FormatSlack)},
+			want:   want{body: `{"text":"Database default/db is ready"}`},
+		},
+		"ErrorStatus": {
+			reason: "Non-2xx responses should be returned as errors",
+			status: http.StatusForbidden,
+			want: want{
+				body: `{"kind":"Database","namespace":"default","name":"db","transition":"Ready","time":"2020-09-01T00:00:00Z"}`,
+				err:  errors.Errorf(errFmtStatus, http.StatusForbidden),
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var body string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := ioutil.ReadAll(r.Body)
+				body = string(b)
+				w.WriteHeader(tc.status)
+			}))
+			defer srv.Close()
+
+			err := NewWebhook(srv.URL, tc.opts...).Send(context.Background(), n)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\nSend(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.body, body); diff != "" {
+				t.Errorf("\nReason: %s\nSend(...): -want body, +got body:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestWebhookNotify(t *testing.T) {
+	n := Notification{Kind: "Database", Namespace: "default", Name: "db", Transition: Ready}
+
+	w := NewWebhook("https://example.org", WithKinds("Bucket"))
+	w.Notify(n)
+	if diff := cmp.Diff(0, len(w.queue)); diff != "" {
+		t.Errorf("\nNotify(...): notifications about other kinds should not be queued: -want, +got:\n%s", diff)
+	}
+
+	w = NewWebhook("https://example.org")
+	for i := 0; i < defaultQueueSize+1; i++ {
+		w.Notify(n)
+	}
+	if diff := cmp.Diff(defaultQueueSize, len(w.queue)); diff != "" {
+		t.Errorf("\nNotify(...): notifications that don't fit in the queue should be dropped: -want, +got:\n%s", diff)
+	}
+}
+
+func TestWebhookStart(t *testing.T) {
+	posted := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		posted <- string(b)
+	}))
+	defer srv.Close()
+
+	w := NewWebhook(srv.URL, WithFormat(FormatSlack))
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		_ = w.Start(stop)
+		close(done)
+	}()
+	w.Notify(Notification{Kind: "Database", Namespace: "default", Name: "db", Transition: Ready})
+	select {
+	case body := <-posted:
+		if diff := cmp.Diff(`{"text":"Database default/db is ready"}`, body); diff != "" {
+			t.Errorf("\nStart(...): the queued notification should be posted: -want body, +got body:\n%s", diff)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("\nStart(...): the queued notification should be posted")
+	}
+	close(stop)
+	<-done
+}
+
+func TestParseWebhook(t *testing.T) {
+	type want struct {
+		url   string
+		kinds []string
+		err   error
+	}
+	cases := map[string]struct {
+		reason string
+		s      string
+		want   want
+	}{
+		"AllKinds": {
+			reason: "A bare URL should be notified about all kinds",
+			s:      "https://hooks.example.org/agent?token=abc",
+			want:   want{url: "https://hooks.example.org/agent?token=abc"},
+		},
+		"SomeKinds": {
+			reason: "The kinds before the first equal sign should be parsed",
+			s:      "Database,Bucket=https://hooks.example.org/agent?token=abc",
+			want:   want{url: "https://hooks.example.org/agent?token=abc", kinds: []string{"Database", "Bucket"}},
+		},
+		"NoURL": {
+			reason: "Webhooks without a URL should be rejected",
+			s:      "Database=",
+			want:   want{err: errors.Errorf(errFmtWebhook, "Database=")},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			url, kinds, err := ParseWebhook(tc.s)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\nParseWebhook(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.url, url); diff != "" {
+				t.Errorf("\nReason: %s\nParseWebhook(...): -want URL, +got URL:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.kinds, kinds); diff != "" {
+				t.Errorf("\nReason: %s\nParseWebhook(...): -want kinds, +got kinds:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
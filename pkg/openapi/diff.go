@@ -0,0 +1,125 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openapi
+
+import (
+	"fmt"
+	"sort"
+
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+)
+
+// Diff returns how the schemas of the served versions of the local CRD differ
+// from the ones of the remote CRD, one line per difference in a stable order.
+// Only the fields and their types are compared, since they're what decide
+// whether a claim that is valid in one cluster is valid in the other.
+func Diff(local, remote *v1beta1.CustomResourceDefinition) []string {
+	ls, rs := servedSchemas(local), servedSchemas(remote)
+	var out []string
+	for _, v := range versionKeys(ls, rs) {
+		l, lok := ls[v]
+		r, rok := rs[v]
+		switch {
+		case !rok:
+			out = append(out, fmt.Sprintf("version %s is served only locally", v))
+		case !lok:
+			out = append(out, fmt.Sprintf("version %s is served only remotely", v))
+		default:
+			out = append(out, diffProps(v+":", l, r)...)
+		}
+	}
+	return out
+}
+
+func diffProps(path string, local, remote *v1beta1.JSONSchemaProps) []string {
+	if local == nil || remote == nil {
+		if local != remote {
+			return []string{fmt.Sprintf("%s schema is defined only %s", path, where(local != nil))}
+		}
+		return nil
+	}
+	var out []string
+	if local.Type != remote.Type {
+		out = append(out, fmt.Sprintf("%s has type %q locally and %q remotely", path, local.Type, remote.Type))
+	}
+	for _, k := range propertyKeys(local.Properties, remote.Properties) {
+		l, lok := local.Properties[k]
+		r, rok := remote.Properties[k]
+		p := join(path, k)
+		if !lok || !rok {
+			out = append(out, fmt.Sprintf("%s exists only %s", p, where(lok)))
+			continue
+		}
+		out = append(out, diffProps(p, &l, &r)...)
+	}
+	if local.Items != nil || remote.Items != nil {
+		var l, r *v1beta1.JSONSchemaProps
+		if local.Items != nil {
+			l = local.Items.Schema
+		}
+		if remote.Items != nil {
+			r = remote.Items.Schema
+		}
+		out = append(out, diffProps(path+"[]", l, r)...)
+	}
+	return out
+}
+
+func join(path, field string) string {
+	if path[len(path)-1] == ':' {
+		return path + " " + field
+	}
+	return path + "." + field
+}
+
+func where(local bool) string {
+	if local {
+		return "locally"
+	}
+	return "remotely"
+}
+
+func versionKeys(a, b map[string]*v1beta1.JSONSchemaProps) []string {
+	seen := map[string]bool{}
+	for k := range a {
+		seen[k] = true
+	}
+	for k := range b {
+		seen[k] = true
+	}
+	return sorted(seen)
+}
+
+func propertyKeys(a, b map[string]v1beta1.JSONSchemaProps) []string {
+	seen := map[string]bool{}
+	for k := range a {
+		seen[k] = true
+	}
+	for k := range b {
+		seen[k] = true
+	}
+	return sorted(seen)
+}
+
+func sorted(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
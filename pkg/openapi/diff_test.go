@@ -0,0 +1,90 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openapi
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+)
+
+func crd(versions map[string]*v1beta1.JSONSchemaProps) *v1beta1.CustomResourceDefinition {
+	c := &v1beta1.CustomResourceDefinition{}
+	for v, s := range versions {
+		c.Spec.Versions = append(c.Spec.Versions, v1beta1.CustomResourceDefinitionVersion{
+			Name:   v,
+			Served: true,
+			Schema: &v1beta1.CustomResourceValidation{OpenAPIV3Schema: s},
+		})
+	}
+	return c
+}
+
+func object(props map[string]v1beta1.JSONSchemaProps) *v1beta1.JSONSchemaProps {
+	return &v1beta1.JSONSchemaProps{Type: "object", Properties: props}
+}
+
+func TestDiff(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		local  *v1beta1.CustomResourceDefinition
+		remote *v1beta1.CustomResourceDefinition
+		want   []string
+	}{
+		"Same": {
+			reason: "No differences should be returned for the same schemas",
+			local:  crd(map[string]*v1beta1.JSONSchemaProps{"v1alpha1": object(map[string]v1beta1.JSONSchemaProps{"size": {Type: "integer"}})}),
+			remote: crd(map[string]*v1beta1.JSONSchemaProps{"v1alpha1": object(map[string]v1beta1.JSONSchemaProps{"size": {Type: "integer"}})}),
+		},
+		"Versions": {
+			reason: "The versions that are served only in one cluster should be returned",
+			local:  crd(map[string]*v1beta1.JSONSchemaProps{"v1alpha1": object(nil)}),
+			remote: crd(map[string]*v1beta1.JSONSchemaProps{"v1alpha1": object(nil), "v1beta1": object(nil)}),
+			want:   []string{"version v1beta1 is served only remotely"},
+		},
+		"Fields": {
+			reason: "The fields that exist only in one cluster and the ones whose types differ should be returned",
+			local: crd(map[string]*v1beta1.JSONSchemaProps{"v1alpha1": object(map[string]v1beta1.JSONSchemaProps{
+				"spec": *object(map[string]v1beta1.JSONSchemaProps{
+					"size": {Type: "integer"},
+					"tags": {Type: "array", Items: &v1beta1.JSONSchemaPropsOrArray{Schema: &v1beta1.JSONSchemaProps{Type: "string"}}},
+				}),
+			})}),
+			remote: crd(map[string]*v1beta1.JSONSchemaProps{"v1alpha1": object(map[string]v1beta1.JSONSchemaProps{
+				"spec": *object(map[string]v1beta1.JSONSchemaProps{
+					"region": {Type: "string"},
+					"size":   {Type: "string"},
+					"tags":   {Type: "array", Items: &v1beta1.JSONSchemaPropsOrArray{Schema: object(nil)}},
+				}),
+			})}),
+			want: []string{
+				"v1alpha1: spec.region exists only remotely",
+				`v1alpha1: spec.size has type "integer" locally and "string" remotely`,
+				`v1alpha1: spec.tags[] has type "string" locally and "object" remotely`,
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := Diff(tc.local, tc.remote)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\nReason: %s\nDiff(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
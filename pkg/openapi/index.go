@@ -0,0 +1,131 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package openapi keeps the OpenAPI schemas of the claim types that are synced
+// to the local cluster in memory, so that claims can be defaulted and checked
+// against them without a round trip to the API server per claim, and compares
+// them with the schemas of the remote cluster.
+package openapi
+
+import (
+	"sync"
+
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/crossplane/agent/pkg/resource"
+)
+
+// NewIndex returns an empty *Index.
+func NewIndex() *Index {
+	return &Index{
+		schemas:      map[schema.GroupVersionKind]*v1beta1.JSONSchemaProps{},
+		compositions: map[schema.GroupKind]string{},
+	}
+}
+
+// An Index of the OpenAPI schemas of claim types by their GroupVersionKind,
+// along with the default Composition of each type. It is safe for concurrent
+// use.
+type Index struct {
+	mu           sync.RWMutex
+	schemas      map[schema.GroupVersionKind]*v1beta1.JSONSchemaProps
+	compositions map[schema.GroupKind]string
+}
+
+// Set replaces the schemas of all versions of the kind that the supplied CRD
+// defines, and its default Composition. A version without a schema of its own
+// uses the top-level schema of the CRD, if any.
+func (i *Index) Set(crd *v1beta1.CustomResourceDefinition) {
+	gk := schema.GroupKind{Group: crd.Spec.Group, Kind: crd.Spec.Names.Kind}
+	versions := servedSchemas(crd)
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.delete(gk)
+	for v, s := range versions {
+		if s == nil {
+			continue
+		}
+		i.schemas[gk.WithVersion(v)] = s.DeepCopy()
+	}
+	if name := crd.GetAnnotations()[resource.AnnotationKeyDefaultComposition]; name != "" {
+		i.compositions[gk] = name
+	}
+}
+
+// servedSchemas returns the schemas of the served versions of the supplied CRD
+// by version. A version without a schema of its own uses the top-level schema
+// of the CRD, if any.
+func servedSchemas(crd *v1beta1.CustomResourceDefinition) map[string]*v1beta1.JSONSchemaProps {
+	var common *v1beta1.JSONSchemaProps
+	if crd.Spec.Validation != nil {
+		common = crd.Spec.Validation.OpenAPIV3Schema
+	}
+	versions := map[string]*v1beta1.JSONSchemaProps{}
+	if crd.Spec.Version != "" {
+		versions[crd.Spec.Version] = common
+	}
+	for _, v := range crd.Spec.Versions {
+		if !v.Served {
+			delete(versions, v.Name)
+			continue
+		}
+		versions[v.Name] = common
+		if v.Schema != nil && v.Schema.OpenAPIV3Schema != nil {
+			versions[v.Name] = v.Schema.OpenAPIV3Schema
+		}
+	}
+	return versions
+}
+
+// Delete removes the schemas of all versions of the supplied kind, and its
+// default Composition.
+func (i *Index) Delete(gk schema.GroupKind) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.delete(gk)
+}
+
+func (i *Index) delete(gk schema.GroupKind) {
+	for gvk := range i.schemas {
+		if gvk.GroupKind() == gk {
+			delete(i.schemas, gvk)
+		}
+	}
+	delete(i.compositions, gk)
+}
+
+// Get returns a copy of the schema of the supplied GroupVersionKind, and false
+// if there is none.
+func (i *Index) Get(gvk schema.GroupVersionKind) (*v1beta1.JSONSchemaProps, bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	s, ok := i.schemas[gvk]
+	if !ok {
+		return nil, false
+	}
+	return s.DeepCopy(), true
+}
+
+// DefaultComposition returns the name of the default Composition of the
+// supplied kind, and false if there is none.
+func (i *Index) DefaultComposition(gk schema.GroupKind) (string, bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	name, ok := i.compositions[gk]
+	return name, ok
+}
@@ -0,0 +1,194 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openapi
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/crossplane/agent/pkg/resource"
+)
+
+func TestIndex(t *testing.T) {
+	common := &v1beta1.JSONSchemaProps{Type: "object", Description: "common"}
+	own := &v1beta1.JSONSchemaProps{Type: "object", Description: "own"}
+	gk := schema.GroupKind{Group: "example.org", Kind: "Database"}
+
+	type want struct {
+		schema *v1beta1.JSONSchemaProps
+		ok     bool
+	}
+	cases := map[string]struct {
+		reason string
+		crds   []*v1beta1.CustomResourceDefinition
+		gvk    schema.GroupVersionKind
+		want   want
+	}{
+		"NotIndexed": {
+			reason: "No schema should be returned for kinds that aren't indexed",
+			gvk:    gk.WithVersion("v1alpha1"),
+		},
+		"CommonSchema": {
+			reason: "Versions without their own schema should use the top-level schema",
+			crds: []*v1beta1.CustomResourceDefinition{{
+				Spec: v1beta1.CustomResourceDefinitionSpec{
+					Group:      gk.Group,
+					Names:      v1beta1.CustomResourceDefinitionNames{Kind: gk.Kind},
+					Version:    "v1alpha1",
+					Validation: &v1beta1.CustomResourceValidation{OpenAPIV3Schema: common},
+				},
+			}},
+			gvk:  gk.WithVersion("v1alpha1"),
+			want: want{schema: common, ok: true},
+		},
+		"VersionSchema": {
+			reason: "Versions with their own schema should use it",
+			crds: []*v1beta1.CustomResourceDefinition{{
+				Spec: v1beta1.CustomResourceDefinitionSpec{
+					Group: gk.Group,
+					Names: v1beta1.CustomResourceDefinitionNames{Kind: gk.Kind},
+					Versions: []v1beta1.CustomResourceDefinitionVersion{
+						{Name: "v1alpha1", Served: true, Schema: &v1beta1.CustomResourceValidation{OpenAPIV3Schema: own}},
+					},
+				},
+			}},
+			gvk:  gk.WithVersion("v1alpha1"),
+			want: want{schema: own, ok: true},
+		},
+		"NotServed": {
+			reason: "Versions that are no longer served should be dropped when the CRD is indexed again",
+			crds: []*v1beta1.CustomResourceDefinition{
+				{
+					Spec: v1beta1.CustomResourceDefinitionSpec{
+						Group: gk.Group,
+						Names: v1beta1.CustomResourceDefinitionNames{Kind: gk.Kind},
+						Versions: []v1beta1.CustomResourceDefinitionVersion{
+							{Name: "v1alpha1", Served: true, Schema: &v1beta1.CustomResourceValidation{OpenAPIV3Schema: own}},
+						},
+					},
+				},
+				{
+					Spec: v1beta1.CustomResourceDefinitionSpec{
+						Group: gk.Group,
+						Names: v1beta1.CustomResourceDefinitionNames{Kind: gk.Kind},
+						Versions: []v1beta1.CustomResourceDefinitionVersion{
+							{Name: "v1alpha1", Served: false, Schema: &v1beta1.CustomResourceValidation{OpenAPIV3Schema: own}},
+							{Name: "v1beta1", Served: true, Schema: &v1beta1.CustomResourceValidation{OpenAPIV3Schema: own}},
+						},
+					},
+				},
+			},
+			gvk: gk.WithVersion("v1alpha1"),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			i := NewIndex()
+			for _, crd := range tc.crds {
+				i.Set(crd)
+			}
+			s, ok := i.Get(tc.gvk)
+			if diff := cmp.Diff(tc.want.ok, ok); diff != "" {
+				t.Errorf("\nReason: %s\ni.Get(...): -want ok, +got ok:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.schema, s); diff != "" {
+				t.Errorf("\nReason: %s\ni.Get(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestIndexDefaultComposition(t *testing.T) {
+	gk := schema.GroupKind{Group: "example.org", Kind: "Database"}
+	crd := func(a map[string]string) *v1beta1.CustomResourceDefinition {
+		return &v1beta1.CustomResourceDefinition{
+			ObjectMeta: metav1.ObjectMeta{Annotations: a},
+			Spec: v1beta1.CustomResourceDefinitionSpec{
+				Group:   gk.Group,
+				Names:   v1beta1.CustomResourceDefinitionNames{Kind: gk.Kind},
+				Version: "v1alpha1",
+			},
+		}
+	}
+
+	type want struct {
+		name string
+		ok   bool
+	}
+	cases := map[string]struct {
+		reason string
+		crds   []*v1beta1.CustomResourceDefinition
+		want   want
+	}{
+		"NotIndexed": {
+			reason: "No default Composition should be returned for kinds that aren't indexed",
+		},
+		"NoDefault": {
+			reason: "No default Composition should be returned if the CRD isn't annotated with one",
+			crds:   []*v1beta1.CustomResourceDefinition{crd(nil)},
+		},
+		"Default": {
+			reason: "The default Composition the CRD is annotated with should be returned",
+			crds:   []*v1beta1.CustomResourceDefinition{crd(map[string]string{resource.AnnotationKeyDefaultComposition: "small-db"})},
+			want:   want{name: "small-db", ok: true},
+		},
+		"DefaultRemoved": {
+			reason: "The default Composition should be dropped when the CRD is indexed again without one",
+			crds: []*v1beta1.CustomResourceDefinition{
+				crd(map[string]string{resource.AnnotationKeyDefaultComposition: "small-db"}),
+				crd(nil),
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			i := NewIndex()
+			for _, crd := range tc.crds {
+				i.Set(crd)
+			}
+			n, ok := i.DefaultComposition(gk)
+			if diff := cmp.Diff(tc.want, want{name: n, ok: ok}, cmp.AllowUnexported(want{})); diff != "" {
+				t.Errorf("\nReason: %s\ni.DefaultComposition(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestIndexDelete(t *testing.T) {
+	gk := schema.GroupKind{Group: "example.org", Kind: "Database"}
+	i := NewIndex()
+	i.Set(&v1beta1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{resource.AnnotationKeyDefaultComposition: "small-db"}},
+		Spec: v1beta1.CustomResourceDefinitionSpec{
+			Group:      gk.Group,
+			Names:      v1beta1.CustomResourceDefinitionNames{Kind: gk.Kind},
+			Version:    "v1alpha1",
+			Validation: &v1beta1.CustomResourceValidation{OpenAPIV3Schema: &v1beta1.JSONSchemaProps{Type: "object"}},
+		},
+	})
+	i.Delete(gk)
+	if _, ok := i.Get(gk.WithVersion("v1alpha1")); ok {
+		t.Errorf("\nReason: %s\ni.Get(...): the schema should be gone", "The schemas of deleted kinds should be removed")
+	}
+	if _, ok := i.DefaultComposition(gk); ok {
+		t.Errorf("\nReason: %s\ni.DefaultComposition(...): the default should be gone", "The default Compositions of deleted kinds should be removed")
+	}
+}
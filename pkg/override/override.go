@@ -0,0 +1,121 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package override contains the CRDOverrides, which keep the local additions
+// to the claim CRDs, e.g. short names, categories or annotations for UI
+// tooling, that are merged over the claim CRDs synced from the remote cluster.
+// A CRDOverride is named after the CRD it overrides.
+package override
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/agent/pkg/resource"
+)
+
+const (
+	errEnsureCRD       = "cannot ensure CRDOverride CustomResourceDefinition"
+	errGetOverride     = "cannot get CRDOverride"
+	errNoOverride      = "CRDOverride has no override"
+	defaultEstablished = 1 * time.Minute
+)
+
+// CRDName is the name of the CustomResourceDefinition of CRDOverrides.
+const CRDName = "crdoverrides.agent.crossplane.io"
+
+// GroupVersionKind of CRDOverrides.
+var GroupVersionKind = schema.GroupVersionKind{Group: "agent.crossplane.io", Version: "v1alpha1", Kind: "CRDOverride"}
+
+// Resource is the plural resource name of CRDOverrides.
+const Resource = "crdoverrides"
+
+// CRD returns the CustomResourceDefinition of CRDOverrides. They're cluster
+// scoped like the CRDs they override. The override is a partial CRD, so its
+// fields aren't pruned.
+func CRD() *v1beta1.CustomResourceDefinition {
+	preserve := false
+	unknown := true
+	return &v1beta1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: CRDName},
+		Spec: v1beta1.CustomResourceDefinitionSpec{
+			Group: GroupVersionKind.Group,
+			Names: v1beta1.CustomResourceDefinitionNames{
+				Kind:     GroupVersionKind.Kind,
+				ListKind: GroupVersionKind.Kind + "List",
+				Plural:   Resource,
+				Singular: "crdoverride",
+			},
+			Scope:                 v1beta1.ClusterScoped,
+			PreserveUnknownFields: &preserve,
+			Versions: []v1beta1.CustomResourceDefinitionVersion{{
+				Name:    GroupVersionKind.Version,
+				Served:  true,
+				Storage: true,
+			}},
+			Validation: &v1beta1.CustomResourceValidation{
+				OpenAPIV3Schema: &v1beta1.JSONSchemaProps{
+					Type:     "object",
+					Required: []string{"spec"},
+					Properties: map[string]v1beta1.JSONSchemaProps{
+						"spec": {
+							Type:     "object",
+							Required: []string{"override"},
+							Properties: map[string]v1beta1.JSONSchemaProps{
+								"override": {Type: "object", XPreserveUnknownFields: &unknown},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// Ensure creates the CustomResourceDefinition of CRDOverrides if it doesn't
+// exist and waits for it to be established. Pass a client wrapped for the
+// local cluster with CRDVersion.Client so that v1-only clusters work too.
+func Ensure(ctx context.Context, kube client.Client) error {
+	return resource.LocalError(resource.EnsureCRD(ctx, kube, CRD(), defaultEstablished), errEnsureCRD)
+}
+
+// Get returns the override of the CRD with the supplied name, i.e. the partial
+// CRD in the spec of its CRDOverride, or nil if it has none.
+func Get(ctx context.Context, kube client.Reader, crd string) (map[string]interface{}, error) {
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(GroupVersionKind)
+	err := kube.Get(ctx, types.NamespacedName{Name: crd}, u)
+	if kerrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, resource.LocalError(err, errGetOverride)
+	}
+	o, ok, err := unstructured.NestedMap(u.Object, "spec", "override")
+	if err != nil || !ok {
+		return nil, errors.New(errNoOverride)
+	}
+	return o, nil
+}
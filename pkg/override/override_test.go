@@ -0,0 +1,93 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package override
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/crossplane/agent/pkg/resource"
+)
+
+func TestGet(t *testing.T) {
+	errBoom := errors.New("boom")
+	o := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"names": map[string]interface{}{"shortNames": []interface{}{"db"}},
+		},
+	}
+	spec := func(s map[string]interface{}) test.MockGetFn {
+		return func(_ context.Context, key client.ObjectKey, obj runtime.Object) error {
+			if diff := cmp.Diff("databases.example.org", key.Name); diff != "" {
+				t.Errorf("\nGet(...): the CRDOverride should be named after the CRD: -want, +got:\n%s", diff)
+			}
+			obj.(*unstructured.Unstructured).Object["spec"] = s
+			return nil
+		}
+	}
+
+	type want struct {
+		override map[string]interface{}
+		err      error
+	}
+	cases := map[string]struct {
+		reason string
+		kube   client.Reader
+		want   want
+	}{
+		"NotFound": {
+			reason: "A CRD without a CRDOverride should have no override",
+			kube:   &test.MockClient{MockGet: test.NewMockGetFn(kerrors.NewNotFound(schema.GroupResource{Group: GroupVersionKind.Group, Resource: Resource}, ""))},
+		},
+		"GetFailed": {
+			reason: "Errors while getting the CRDOverride should be returned",
+			kube:   &test.MockClient{MockGet: test.NewMockGetFn(errBoom)},
+			want:   want{err: resource.LocalError(errBoom, errGetOverride)},
+		},
+		"NoOverride": {
+			reason: "An error should be returned if the CRDOverride has no override",
+			kube:   &test.MockClient{MockGet: spec(map[string]interface{}{})},
+			want:   want{err: errors.New(errNoOverride)},
+		},
+		"Override": {
+			reason: "The override of the CRDOverride should be returned",
+			kube:   &test.MockClient{MockGet: spec(map[string]interface{}{"override": o})},
+			want:   want{override: o},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := Get(context.Background(), tc.kube, "databases.example.org")
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\nGet(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.override, got); diff != "" {
+				t.Errorf("\nReason: %s\nGet(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
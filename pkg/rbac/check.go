@@ -0,0 +1,135 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbac
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	authv1 "k8s.io/api/authorization/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+
+	"github.com/crossplane/agent/pkg/metrics"
+	"github.com/crossplane/agent/pkg/resource"
+)
+
+const (
+	errReview = "cannot create self subject access review"
+
+	selfCheckTimeout = 30 * time.Second
+)
+
+// A Report is the result of a self-check against a cluster.
+type Report struct {
+	Cluster resource.Cluster
+	Allowed []Requirement
+	Missing []Requirement
+}
+
+// Err returns an error that lists the missing permissions, if any.
+func (r Report) Err() error {
+	if len(r.Missing) == 0 {
+		return nil
+	}
+	missing := make([]string, len(r.Missing))
+	for i, m := range r.Missing {
+		missing[i] = m.String()
+	}
+	return errors.Errorf("missing permissions in %s cluster: %s", strings.ToLower(string(r.Cluster)), strings.Join(missing, ", "))
+}
+
+// Check runs a SelfSubjectAccessReview for every requirement against the
+// cluster that the supplied client talks to. The missing permissions are
+// exported as metrics.
+func Check(ctx context.Context, kube client.Client, cluster resource.Cluster, reqs []Requirement) (Report, error) {
+	report := Report{Cluster: cluster}
+	for _, req := range reqs {
+		review := &authv1.SelfSubjectAccessReview{
+			Spec: authv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authv1.ResourceAttributes{
+					Verb:      req.Verb,
+					Group:     req.Group,
+					Resource:  req.Resource,
+					Namespace: req.Namespace,
+				},
+			},
+		}
+		if err := kube.Create(ctx, review); err != nil {
+			return Report{}, errors.Wrap(err, errReview)
+		}
+		g := metrics.MissingPermissions.WithLabelValues(string(cluster), req.Verb, req.Group, req.Resource)
+		if !review.Status.Allowed {
+			report.Missing = append(report.Missing, req)
+			g.Set(1)
+			continue
+		}
+		report.Allowed = append(report.Allowed, req)
+		g.Set(0)
+	}
+	return report, nil
+}
+
+// SelfCheck checks the requirements against both clusters, logs the result
+// and returns a readiness check that fails while permissions are missing. The
+// self-check is only reported, not enforced, so a failure to run it doesn't
+// stop the agent. Each cluster is checked with a timeout so that an API server
+// that doesn't respond can't hang the agent.
+func SelfCheck(ctx context.Context, log logging.Logger, local, remote client.Client, reqs Requirements) healthz.Checker {
+	var reports []Report
+	for _, c := range []struct {
+		kube    client.Client
+		cluster resource.Cluster
+		reqs    []Requirement
+	}{
+		{kube: local, cluster: resource.ClusterLocal, reqs: reqs.Local},
+		{kube: remote, cluster: resource.ClusterRemote, reqs: reqs.Remote},
+	} {
+		cctx, cancel := context.WithTimeout(ctx, selfCheckTimeout)
+		r, err := Check(cctx, c.kube, c.cluster, c.reqs)
+		cancel()
+		if err != nil {
+			log.Info("Cannot run RBAC self-check", "cluster", c.cluster, "error", err)
+			continue
+		}
+		if err := r.Err(); err != nil {
+			log.Info("RBAC self-check failed", "cluster", c.cluster, "error", err)
+		} else {
+			log.Debug("RBAC self-check passed", "cluster", c.cluster, "permissions", len(r.Allowed))
+		}
+		reports = append(reports, r)
+	}
+	return NewReadyzCheck(reports...)
+}
+
+// NewReadyzCheck returns a readiness check that fails with the missing
+// permissions of the supplied reports, if any.
+func NewReadyzCheck(reports ...Report) healthz.Checker {
+	return func(_ *http.Request) error {
+		for _, r := range reports {
+			if err := r.Err(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbac
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	authv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/crossplane/agent/pkg/resource"
+)
+
+func TestCheck(t *testing.T) {
+	errBoom := errors.New("boom")
+	getSecrets := Requirement{Verb: VerbGet, Resource: "secrets"}
+	listCRDs := Requirement{Verb: VerbList, Group: "apiextensions.k8s.io", Resource: "customresourcedefinitions"}
+
+	type args struct {
+		kube    *test.MockClient
+		cluster resource.Cluster
+		reqs    []Requirement
+	}
+	type want struct {
+		report Report
+		err    error
+		msg    error
+	}
+	cases := map[string]struct {
+		reason string
+		args
+		want
+	}{
+		"ReviewFailed": {
+			reason: "Failures to create a review should be returned.",
+			args: args{
+				kube:    &test.MockClient{MockCreate: test.NewMockCreateFn(errBoom)},
+				cluster: resource.ClusterLocal,
+				reqs:    []Requirement{getSecrets},
+			},
+			want: want{
+				err: errors.Wrap(errBoom, errReview),
+			},
+		},
+		"AllAllowed": {
+			reason: "No permissions should be reported missing if all reviews are allowed.",
+			args: args{
+				kube: &test.MockClient{MockCreate: test.NewMockCreateFn(nil, func(obj runtime.Object) error {
+					obj.(*authv1.SelfSubjectAccessReview).Status.Allowed = true
+					return nil
+				})},
+				cluster: resource.ClusterRemote,
+				reqs:    []Requirement{getSecrets, listCRDs},
+			},
+			want: want{
+				report: Report{Cluster: resource.ClusterRemote, Allowed: []Requirement{getSecrets, listCRDs}},
+			},
+		},
+		"SomeMissing": {
+			reason: "Denied reviews should be reported as missing permissions.",
+			args: args{
+				kube: &test.MockClient{MockCreate: test.NewMockCreateFn(nil, func(obj runtime.Object) error {
+					r := obj.(*authv1.SelfSubjectAccessReview)
+					r.Status.Allowed = r.Spec.ResourceAttributes.Resource == "secrets"
+					return nil
+				})},
+				cluster: resource.ClusterLocal,
+				reqs:    []Requirement{getSecrets, listCRDs},
+			},
+			want: want{
+				report: Report{Cluster: resource.ClusterLocal, Allowed: []Requirement{getSecrets}, Missing: []Requirement{listCRDs}},
+				msg:    errors.New("missing permissions in local cluster: list customresourcedefinitions.apiextensions.k8s.io"),
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := Check(context.Background(), tc.args.kube, tc.args.cluster, tc.args.reqs)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nCheck(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.report, got); diff != "" {
+				t.Errorf("\n%s\nCheck(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.msg, got.Err(), test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nErr(): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestSelfCheck(t *testing.T) {
+	getSecrets := Requirement{Verb: VerbGet, Resource: "secrets"}
+	kube := &test.MockClient{MockCreate: func(ctx context.Context, obj runtime.Object, _ ...client.CreateOption) error {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Errorf("\nSelfCheck(...): every review should be created with a timeout")
+		}
+		obj.(*authv1.SelfSubjectAccessReview).Status.Allowed = true
+		return nil
+	}}
+	check := SelfCheck(context.Background(), logging.NewNopLogger(), kube, kube, Requirements{Local: []Requirement{getSecrets}, Remote: []Requirement{getSecrets}})
+	if err := check(nil); err != nil {
+		t.Errorf("\nSelfCheck(...): the readiness check should pass if no permissions are missing: %s", err)
+	}
+}
@@ -0,0 +1,490 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package rbac contains the permissions the agent needs in the local and
+// remote clusters and a self-check that verifies them.
+package rbac
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Verbs.
+const (
+	VerbGet    = "get"
+	VerbList   = "list"
+	VerbWatch  = "watch"
+	VerbCreate = "create"
+	VerbUpdate = "update"
+	VerbPatch  = "patch"
+	VerbDelete = "delete"
+)
+
+var (
+	readVerbs  = []string{VerbGet, VerbList, VerbWatch}
+	writeVerbs = []string{VerbGet, VerbList, VerbWatch, VerbCreate, VerbUpdate, VerbPatch, VerbDelete}
+)
+
+// A Requirement is a permission that the agent needs in a cluster. It's
+// needed in all namespaces if Namespace is empty.
+type Requirement struct {
+	Verb      string
+	Group     string
+	Resource  string
+	Namespace string
+}
+
+// String returns the requirement in "verb resource.group" format, followed by
+// its namespace if it has one.
+func (r Requirement) String() string {
+	s := r.Verb + " " + r.Resource
+	if r.Group != "" {
+		s += "." + r.Group
+	}
+	if r.Namespace != "" {
+		s += " in namespace " + r.Namespace
+	}
+	return s
+}
+
+// Requirements are the permissions that the agent needs in both clusters.
+type Requirements struct {
+	Local  []Requirement
+	Remote []Requirement
+}
+
+// InNamespace returns a copy of the supplied requirements that are scoped to
+// the given namespace.
+func InNamespace(reqs []Requirement, namespace string) []Requirement {
+	result := make([]Requirement, len(reqs))
+	for i, r := range reqs {
+		r.Namespace = namespace
+		result[i] = r
+	}
+	return result
+}
+
+// PolicyRules returns the RBAC rules that grant the supplied requirements.
+// The verbs of the requirements for the same resource are granted in a single
+// rule. Namespaces are ignored since they're decided by the binding of the
+// rules.
+func PolicyRules(reqs []Requirement) []rbacv1.PolicyRule {
+	var rules []rbacv1.PolicyRule
+	index := map[schema.GroupResource]int{}
+	for _, r := range reqs {
+		gr := schema.GroupResource{Group: r.Group, Resource: r.Resource}
+		i, ok := index[gr]
+		if !ok {
+			i = len(rules)
+			index[gr] = i
+			rules = append(rules, rbacv1.PolicyRule{APIGroups: []string{r.Group}, Resources: []string{r.Resource}})
+		}
+		rules[i].Verbs = append(rules[i].Verbs, r.Verb)
+	}
+	return rules
+}
+
+func requirements(group, resource string, verbs []string) []Requirement {
+	result := make([]Requirement, len(verbs))
+	for i, v := range verbs {
+		result[i] = Requirement{Verb: v, Group: group, Resource: resource}
+	}
+	return result
+}
+
+// LocalMode returns the permissions that the agent needs when it runs in
+// local mode. The claim types are not known until their definitions are
+// synced, so they're not included.
+func LocalMode() Requirements {
+	var r Requirements
+	r.Local = append(r.Local, requirements("apiextensions.k8s.io", "customresourcedefinitions", writeVerbs)...)
+	r.Local = append(r.Local, requirements("apiextensions.crossplane.io", "compositeresourcedefinitions", []string{VerbGet, VerbList, VerbWatch, VerbUpdate})...)
+	r.Local = append(r.Local, requirements("apiextensions.crossplane.io", "compositions", readVerbs)...)
+	r.Local = append(r.Local, requirements("", "secrets", writeVerbs)...)
+	r.Remote = append(r.Remote, requirements("", "secrets", []string{VerbGet})...)
+	return r
+}
+
+// RemoteMode returns the permissions that the agent needs when it runs in
+// remote mode.
+func RemoteMode() Requirements {
+	var r Requirements
+	for _, res := range []struct{ group, resource string }{
+		{"apiextensions.k8s.io", "customresourcedefinitions"},
+		{"apiextensions.crossplane.io", "compositeresourcedefinitions"},
+		{"apiextensions.crossplane.io", "compositions"},
+	} {
+		r.Remote = append(r.Remote, requirements(res.group, res.resource, readVerbs)...)
+		r.Local = append(r.Local, requirements(res.group, res.resource, writeVerbs)...)
+	}
+	return r
+}
+
+// ClusterTypes returns the permissions that the agent additionally needs in
+// remote mode to sync the objects of the supplied cluster-scoped types.
+func ClusterTypes(grs ...schema.GroupResource) Requirements {
+	var r Requirements
+	for _, gr := range grs {
+		r.Remote = append(r.Remote, requirements(gr.Group, gr.Resource, readVerbs)...)
+		r.Local = append(r.Local, requirements(gr.Group, gr.Resource, writeVerbs)...)
+	}
+	return r
+}
+
+// NamespaceCleanup returns the permissions that the agent additionally needs
+// in local mode to clean up the remote claims of deleted namespaces.
+func NamespaceCleanup() Requirements {
+	var r Requirements
+	r.Local = append(r.Local, requirements("", "namespaces", []string{VerbGet, VerbList, VerbWatch, VerbUpdate})...)
+	return r
+}
+
+// SecretCache returns the permissions that the agent additionally needs in
+// local mode to watch the remote secrets it caches.
+func SecretCache() Requirements {
+	var r Requirements
+	r.Remote = append(r.Remote, requirements("", "secrets", []string{VerbWatch})...)
+	return r
+}
+
+// ClaimMigration returns the permissions that the agent additionally needs in
+// local mode to migrate the claims stored at old versions of their CRDs.
+func ClaimMigration() Requirements {
+	var r Requirements
+	r.Local = append(r.Local, requirements("apiextensions.k8s.io", "customresourcedefinitions/status", []string{VerbUpdate})...)
+	return r
+}
+
+// SyncedBundle returns the permissions that the agent additionally needs in
+// remote mode to create the SyncedBundle that owns the synced objects.
+func SyncedBundle() Requirements {
+	var r Requirements
+	r.Local = append(r.Local, requirements("agent.crossplane.io", "syncedbundles", []string{VerbGet, VerbCreate})...)
+	return r
+}
+
+// ShardRegistry returns the permissions that the agent additionally needs in
+// local mode to register its shard in a ConfigMap in the supplied namespace.
+func ShardRegistry(namespace string) Requirements {
+	var r Requirements
+	r.Local = append(r.Local, InNamespace(requirements("", "configmaps", []string{VerbGet, VerbCreate, VerbUpdate}), namespace)...)
+	return r
+}
+
+// StatusConfigMaps returns the permissions that the agent additionally needs
+// in local mode to project the status fields of the claims into ConfigMaps.
+func StatusConfigMaps() Requirements {
+	var r Requirements
+	r.Local = append(r.Local, requirements("", "configmaps", []string{VerbGet, VerbCreate, VerbUpdate, VerbDelete})...)
+	return r
+}
+
+// ClaimApprovals returns the permissions that the agent additionally needs in
+// local mode to read and create ClaimApprovals, and to authenticate and
+// authorize the approvers that create them at /approve.
+func ClaimApprovals() Requirements {
+	var r Requirements
+	r.Local = append(r.Local, requirements("agent.crossplane.io", "claimapprovals", []string{VerbGet, VerbCreate, VerbPatch})...)
+	r.Local = append(r.Local, requirements("authentication.k8s.io", "tokenreviews", []string{VerbCreate})...)
+	r.Local = append(r.Local, requirements("authorization.k8s.io", "subjectaccessreviews", []string{VerbCreate})...)
+	return r
+}
+
+// CRDOverrides returns the permissions that the agent additionally needs in
+// local mode to read the CRDOverrides of the claim CRDs.
+func CRDOverrides() Requirements {
+	var r Requirements
+	r.Local = append(r.Local, requirements("agent.crossplane.io", "crdoverrides", []string{VerbGet})...)
+	return r
+}
+
+// FleetReport returns the permissions that the agent additionally needs in
+// local mode to create the CustomResourceDefinition of SyncStatuses in the
+// remote cluster and to write its SyncStatus in the supplied namespace.
+func FleetReport(namespace string) Requirements {
+	var r Requirements
+	r.Remote = append(r.Remote, requirements("apiextensions.k8s.io", "customresourcedefinitions", []string{VerbGet, VerbCreate, VerbPatch})...)
+	r.Remote = append(r.Remote, InNamespace(requirements("agent.crossplane.io", "syncstatuses", []string{VerbGet, VerbCreate, VerbUpdate}), namespace)...)
+	return r
+}
+
+// SecretNamespaces returns the permissions that the agent additionally needs
+// in local mode to write connection secrets to the supplied namespaces other
+// than the namespaces of their claims.
+func SecretNamespaces(namespaces ...string) Requirements {
+	var r Requirements
+	for _, ns := range namespaces {
+		r.Local = append(r.Local, InNamespace(requirements("", "secrets", writeVerbs), ns)...)
+	}
+	return r
+}
+
+// WithoutConnectionSecrets returns the supplied requirements without the ones
+// for Secrets, which the agent doesn't need if it doesn't sync connection
+// secrets.
+func WithoutConnectionSecrets(r Requirements) Requirements {
+	drop := func(reqs []Requirement) []Requirement {
+		var out []Requirement
+		for _, req := range reqs {
+			if req.Group == "" && req.Resource == "secrets" {
+				continue
+			}
+			out = append(out, req)
+		}
+		return out
+	}
+	return Requirements{Local: drop(r.Local), Remote: drop(r.Remote)}
+}
+
+// A Mode of operation of the agent.
+type Mode string
+
+// Modes of operation.
+const (
+	ModeLocal  Mode = "local"
+	ModeRemote Mode = "remote"
+)
+
+const errFmtMode = "unknown mode %q"
+
+type options struct {
+	kinds            []schema.GroupResource
+	namespaceCleanup bool
+	secretCache      bool
+	claimMigration   bool
+	secretNamespaces []string
+	withoutSecrets   bool
+	remoteNamespace  string
+	syncedBundle     bool
+	shardRegistry    string
+	statusConfigMaps bool
+	claimApprovals   bool
+	fleetReport      string
+	crdOverrides     bool
+}
+
+// An Option changes the permissions that the agent needs.
+type Option func(*options)
+
+// WithKinds specifies the types whose objects the agent syncs, i.e. the claim
+// types in local mode and the cluster-scoped types in remote mode.
+func WithKinds(grs ...schema.GroupResource) Option {
+	return func(o *options) {
+		o.kinds = append(o.kinds, grs...)
+	}
+}
+
+// WithNamespaceCleanup specifies that the agent cleans up the remote claims of
+// deleted namespaces. Only used in local mode.
+func WithNamespaceCleanup() Option {
+	return func(o *options) {
+		o.namespaceCleanup = true
+	}
+}
+
+// WithSecretCache specifies that the agent caches the remote secrets it reads
+// and watches them to invalidate the cache. Only used in local mode.
+func WithSecretCache() Option {
+	return func(o *options) {
+		o.secretCache = true
+	}
+}
+
+// WithClaimMigration specifies that the agent migrates the claims stored at
+// old versions of their CRDs. Only used in local mode.
+func WithClaimMigration() Option {
+	return func(o *options) {
+		o.claimMigration = true
+	}
+}
+
+// WithSecretNamespaces specifies the namespaces other than the ones of the
+// claims that the agent writes connection secrets to. Only used in local mode.
+func WithSecretNamespaces(namespaces ...string) Option {
+	return func(o *options) {
+		o.secretNamespaces = append(o.secretNamespaces, namespaces...)
+	}
+}
+
+// WithoutSecrets specifies that the agent doesn't sync connection secrets.
+// Only used in local mode.
+func WithoutSecrets() Option {
+	return func(o *options) {
+		o.withoutSecrets = true
+	}
+}
+
+// WithRemoteNamespace specifies the namespace in the remote cluster that all
+// claims are created in. Only used in local mode.
+func WithRemoteNamespace(namespace string) Option {
+	return func(o *options) {
+		o.remoteNamespace = namespace
+	}
+}
+
+// WithSyncedBundle specifies that the synced objects are owned by a
+// SyncedBundle. Only used in remote mode.
+func WithSyncedBundle() Option {
+	return func(o *options) {
+		o.syncedBundle = true
+	}
+}
+
+// WithShardRegistry specifies the namespace of the ConfigMap that the agent
+// registers its shard in. Only used in local mode.
+func WithShardRegistry(namespace string) Option {
+	return func(o *options) {
+		o.shardRegistry = namespace
+	}
+}
+
+// WithStatusConfigMaps specifies that the agent projects the status fields of
+// the claims into ConfigMaps. Only used in local mode.
+func WithStatusConfigMaps() Option {
+	return func(o *options) {
+		o.statusConfigMaps = true
+	}
+}
+
+// WithClaimApprovals specifies that the agent holds the claims of some kinds
+// until they're approved with ClaimApprovals. Only used in local mode.
+func WithClaimApprovals() Option {
+	return func(o *options) {
+		o.claimApprovals = true
+	}
+}
+
+// WithFleetReport specifies the namespace of the SyncStatus in the remote
+// cluster that the agent reports the summary of its syncs to. Only used in
+// local mode.
+func WithFleetReport(namespace string) Option {
+	return func(o *options) {
+		o.fleetReport = namespace
+	}
+}
+
+// WithCRDOverrides specifies that the agent merges the CRDOverrides over the
+// claim CRDs. Only used in local mode.
+func WithCRDOverrides() Option {
+	return func(o *options) {
+		o.crdOverrides = true
+	}
+}
+
+// For returns the permissions that the agent needs in both clusters when it
+// runs in the supplied mode with the supplied options. The self-check and the
+// check and rbac commands all use it so that they can't drift apart.
+func For(mode Mode, opts ...Option) (Requirements, error) {
+	o := &options{}
+	for _, f := range opts {
+		f(o)
+	}
+	switch mode {
+	case ModeLocal:
+		r := LocalMode()
+		for _, gr := range o.kinds {
+			r.Local = append(r.Local, requirements(gr.Group, gr.Resource, writeVerbs)...)
+			r.Local = append(r.Local, requirements(gr.Group, gr.Resource+"/status", []string{VerbUpdate})...)
+			r.Remote = append(r.Remote, requirements(gr.Group, gr.Resource, writeVerbs)...)
+		}
+		if o.namespaceCleanup {
+			r.Local = append(r.Local, NamespaceCleanup().Local...)
+		}
+		if o.secretCache {
+			r.Remote = append(r.Remote, SecretCache().Remote...)
+		}
+		if o.claimMigration {
+			r.Local = append(r.Local, ClaimMigration().Local...)
+		}
+		r.Local = append(r.Local, SecretNamespaces(o.secretNamespaces...).Local...)
+		if o.shardRegistry != "" {
+			r.Local = append(r.Local, ShardRegistry(o.shardRegistry).Local...)
+		}
+		if o.statusConfigMaps {
+			r.Local = append(r.Local, StatusConfigMaps().Local...)
+		}
+		if o.claimApprovals {
+			r.Local = append(r.Local, ClaimApprovals().Local...)
+		}
+		if o.crdOverrides {
+			r.Local = append(r.Local, CRDOverrides().Local...)
+		}
+		if o.withoutSecrets {
+			r = WithoutConnectionSecrets(r)
+		}
+		if o.remoteNamespace != "" {
+			r.Remote = InNamespace(r.Remote, o.remoteNamespace)
+		}
+		// The fleet report isn't in the remote namespace of the claims, and
+		// its CustomResourceDefinition is cluster scoped.
+		if o.fleetReport != "" {
+			r.Remote = append(r.Remote, FleetReport(o.fleetReport).Remote...)
+		}
+		return r, nil
+	case ModeRemote:
+		r := RemoteMode()
+		ct := ClusterTypes(o.kinds...)
+		r.Local = append(r.Local, ct.Local...)
+		r.Remote = append(r.Remote, ct.Remote...)
+		if o.syncedBundle {
+			r.Local = append(r.Local, SyncedBundle().Local...)
+		}
+		return r, nil
+	}
+	return Requirements{}, errors.Errorf(errFmtMode, mode)
+}
+
+// Roles returns the RBAC roles with the supplied name that grant the supplied
+// requirements; a ClusterRole for the ones that are needed in all namespaces
+// and a Role for each namespace that the rest are scoped to.
+func Roles(name string, reqs []Requirement) []runtime.Object {
+	var all []Requirement
+	scoped := map[string][]Requirement{}
+	for _, r := range reqs {
+		if r.Namespace == "" {
+			all = append(all, r)
+			continue
+		}
+		scoped[r.Namespace] = append(scoped[r.Namespace], r)
+	}
+	var out []runtime.Object
+	if len(all) > 0 {
+		out = append(out, &rbacv1.ClusterRole{
+			TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "ClusterRole"},
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Rules:      PolicyRules(all),
+		})
+	}
+	namespaces := make([]string, 0, len(scoped))
+	for ns := range scoped {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	for _, ns := range namespaces {
+		out = append(out, &rbacv1.Role{
+			TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "Role"},
+			ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: name},
+			Rules:      PolicyRules(scoped[ns]),
+		})
+	}
+	return out
+}
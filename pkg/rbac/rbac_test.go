@@ -0,0 +1,269 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbac
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+func TestPolicyRules(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		reqs   []Requirement
+		want   []rbacv1.PolicyRule
+	}{
+		"NoRequirements": {
+			reason: "No rules should be returned if there are no requirements.",
+		},
+		"Grouped": {
+			reason: "The verbs of the same resource should be granted in a single rule in the order of the requirements.",
+			reqs: append(
+				requirements("", "secrets", []string{VerbGet, VerbList}),
+				append(
+					requirements("apiextensions.k8s.io", "customresourcedefinitions", readVerbs),
+					InNamespace(requirements("", "secrets", []string{VerbCreate}), "cool-ns")...,
+				)...,
+			),
+			want: []rbacv1.PolicyRule{
+				{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{VerbGet, VerbList, VerbCreate}},
+				{APIGroups: []string{"apiextensions.k8s.io"}, Resources: []string{"customresourcedefinitions"}, Verbs: readVerbs},
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := PolicyRules(tc.reqs)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\nPolicyRules(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestWithoutConnectionSecrets(t *testing.T) {
+	got := WithoutConnectionSecrets(LocalMode())
+	for _, req := range append(got.Local, got.Remote...) {
+		if req.Resource == "secrets" {
+			t.Errorf("\nWithoutConnectionSecrets(...): no requirements for secrets should be left, got %s", req)
+		}
+	}
+	if diff := cmp.Diff(len(LocalMode().Local)-len(writeVerbs), len(got.Local)); diff != "" {
+		t.Errorf("\nWithoutConnectionSecrets(...): the other requirements should be kept: -want, +got:\n%s", diff)
+	}
+}
+
+func TestFor(t *testing.T) {
+	claims := schema.GroupResource{Group: "example.org", Resource: "coolclaims"}
+	envs := schema.GroupResource{Group: "apiextensions.crossplane.io", Resource: "environmentconfigs"}
+
+	type args struct {
+		mode Mode
+		opts []Option
+	}
+	type want struct {
+		reqs Requirements
+		err  bool
+	}
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"UnknownMode": {
+			reason: "An error should be returned for an unknown mode.",
+			args:   args{mode: "central"},
+			want:   want{err: true},
+		},
+		"Local": {
+			reason: "The claim types should be read, updated, created and deleted locally and written remotely, in the remote namespace if given.",
+			args: args{
+				mode: ModeLocal,
+				opts: []Option{WithKinds(claims), WithRemoteNamespace("cool-ns"), WithNamespaceCleanup()},
+			},
+			want: want{reqs: Requirements{
+				Local: append(append(append(LocalMode().Local,
+					requirements("example.org", "coolclaims", writeVerbs)...),
+					requirements("example.org", "coolclaims/status", []string{VerbUpdate})...),
+					NamespaceCleanup().Local...),
+				Remote: InNamespace(append(LocalMode().Remote, requirements("example.org", "coolclaims", writeVerbs)...), "cool-ns"),
+			}},
+		},
+		"LocalWithoutSecrets": {
+			reason: "No permissions for secrets should be needed if connection secrets aren't synced, even in the secret namespaces.",
+			args: args{
+				mode: ModeLocal,
+				opts: []Option{WithSecretNamespaces("secrets"), WithoutSecrets()},
+			},
+			want: want{reqs: WithoutConnectionSecrets(LocalMode())},
+		},
+		"LocalWithSecretCache": {
+			reason: "The remote secrets should be watched if they're cached.",
+			args: args{
+				mode: ModeLocal,
+				opts: []Option{WithSecretCache()},
+			},
+			want: want{reqs: Requirements{
+				Local:  LocalMode().Local,
+				Remote: append(LocalMode().Remote, SecretCache().Remote...),
+			}},
+		},
+		"LocalWithShardRegistry": {
+			reason: "The ConfigMap that the shards are registered in should be written in its namespace.",
+			args: args{
+				mode: ModeLocal,
+				opts: []Option{WithShardRegistry("crossplane-system")},
+			},
+			want: want{reqs: Requirements{
+				Local:  append(LocalMode().Local, ShardRegistry("crossplane-system").Local...),
+				Remote: LocalMode().Remote,
+			}},
+		},
+		"LocalWithStatusConfigMaps": {
+			reason: "The ConfigMaps that the status fields of the claims are projected into should be written.",
+			args: args{
+				mode: ModeLocal,
+				opts: []Option{WithStatusConfigMaps()},
+			},
+			want: want{reqs: Requirements{
+				Local:  append(LocalMode().Local, StatusConfigMaps().Local...),
+				Remote: LocalMode().Remote,
+			}},
+		},
+		"LocalWithClaimApprovals": {
+			reason: "The ClaimApprovals should be read and created, and the approvers authenticated and authorized.",
+			args: args{
+				mode: ModeLocal,
+				opts: []Option{WithClaimApprovals()},
+			},
+			want: want{reqs: Requirements{
+				Local:  append(LocalMode().Local, ClaimApprovals().Local...),
+				Remote: LocalMode().Remote,
+			}},
+		},
+		"LocalWithCRDOverrides": {
+			reason: "The CRDOverrides should be read.",
+			args: args{
+				mode: ModeLocal,
+				opts: []Option{WithCRDOverrides()},
+			},
+			want: want{reqs: Requirements{
+				Local:  append(LocalMode().Local, CRDOverrides().Local...),
+				Remote: LocalMode().Remote,
+			}},
+		},
+		"LocalWithFleetReport": {
+			reason: "The SyncStatus should be written in its namespace rather than the remote namespace of the claims, and its CRD created.",
+			args: args{
+				mode: ModeLocal,
+				opts: []Option{WithFleetReport("fleet"), WithRemoteNamespace("cool-ns")},
+			},
+			want: want{reqs: Requirements{
+				Local:  LocalMode().Local,
+				Remote: append(InNamespace(LocalMode().Remote, "cool-ns"), FleetReport("fleet").Remote...),
+			}},
+		},
+		"Remote": {
+			reason: "The synced cluster types should be read remotely and written locally, and the local mode options ignored.",
+			args: args{
+				mode: ModeRemote,
+				opts: []Option{WithKinds(envs), WithRemoteNamespace("cool-ns")},
+			},
+			want: want{reqs: Requirements{
+				Local:  append(RemoteMode().Local, ClusterTypes(envs).Local...),
+				Remote: append(RemoteMode().Remote, ClusterTypes(envs).Remote...),
+			}},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := For(tc.args.mode, tc.args.opts...)
+			if diff := cmp.Diff(tc.want.err, err != nil); diff != "" {
+				t.Errorf("\n%s\nFor(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.reqs, got); diff != "" {
+				t.Errorf("\n%s\nFor(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRoles(t *testing.T) {
+	reqs := append(requirements("", "secrets", []string{VerbGet}), InNamespace(requirements("", "secrets", []string{VerbCreate}), "b")...)
+	reqs = append(reqs, InNamespace(requirements("", "configmaps", []string{VerbGet}), "a")...)
+	meta := func(kind string) metav1.TypeMeta {
+		return metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: kind}
+	}
+	want := []runtime.Object{
+		&rbacv1.ClusterRole{TypeMeta: meta("ClusterRole"), ObjectMeta: metav1.ObjectMeta{Name: "agent"}, Rules: PolicyRules(reqs[:1])},
+		&rbacv1.Role{TypeMeta: meta("Role"), ObjectMeta: metav1.ObjectMeta{Namespace: "a", Name: "agent"}, Rules: PolicyRules(reqs[2:])},
+		&rbacv1.Role{TypeMeta: meta("Role"), ObjectMeta: metav1.ObjectMeta{Namespace: "b", Name: "agent"}, Rules: PolicyRules(reqs[1:2])},
+	}
+	if diff := cmp.Diff(want, Roles("agent", reqs)); diff != "" {
+		t.Errorf("\nRoles(...): a ClusterRole and a Role per namespace in order should be returned: -want, +got:\n%s", diff)
+	}
+}
+
+// TestChartClusterRole makes sure that the ClusterRole of the Helm chart, which
+// the agent runs with in both modes, grants everything the agent needs in the
+// local cluster with the options the chart supports.
+func TestChartClusterRole(t *testing.T) {
+	raw, err := ioutil.ReadFile("../../cluster/charts/agent/templates/serviceaccount.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cr := &rbacv1.ClusterRole{}
+	for _, doc := range strings.Split(string(raw), "\n---\n") {
+		if strings.Contains(doc, "\nkind: ClusterRole\n") {
+			if err := yaml.Unmarshal([]byte(doc), cr); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	local, _ := For(ModeLocal, WithNamespaceCleanup())
+	remote, _ := For(ModeRemote, WithKinds(schema.GroupResource{Group: "secrets.crossplane.io", Resource: "storeconfigs"}), WithSyncedBundle())
+	for _, req := range append(local.Local, remote.Local...) {
+		if !grants(cr.Rules, req) {
+			t.Errorf("\nThe ClusterRole of the chart should grant %s", req)
+		}
+	}
+}
+
+func grants(rules []rbacv1.PolicyRule, req Requirement) bool {
+	has := func(l []string, v string) bool {
+		for _, e := range l {
+			if e == v || e == rbacv1.ResourceAll {
+				return true
+			}
+		}
+		return false
+	}
+	for _, r := range rules {
+		if has(r.APIGroups, req.Group) && has(r.Resources, req.Resource) && has(r.Verbs, req.Verb) {
+			return true
+		}
+	}
+	return false
+}
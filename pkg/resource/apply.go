@@ -0,0 +1,105 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/pkg/resource"
+)
+
+const errApplyObject = "cannot apply object"
+
+// NewServerSideApplicator returns a new *ServerSideApplicator that applies the
+// objects as the supplied field manager.
+func NewServerSideApplicator(c client.Client, manager string) *ServerSideApplicator {
+	return &ServerSideApplicator{client: c, manager: manager}
+}
+
+// A ServerSideApplicator applies objects with server-side apply, so that the
+// API server tracks which field manager owns which of their fields. Unlike a
+// merge patch, it removes the fields that the manager no longer applies, and
+// it fails with the fields that other managers own rather than overwriting
+// them, see FieldConflicts.
+type ServerSideApplicator struct {
+	client  client.Client
+	manager string
+}
+
+// Apply creates the supplied object if it doesn't exist, or applies its
+// desired state. The ApplyOptions are run against the current object, which
+// is only read if there are any.
+func (a *ServerSideApplicator) Apply(ctx context.Context, o runtime.Object, ao ...resource.ApplyOption) error {
+	m, ok := o.(metav1.Object)
+	if !ok {
+		return errors.New(errAccessMetadata)
+	}
+	if len(ao) > 0 {
+		current := o.DeepCopyObject()
+		err := a.client.Get(ctx, types.NamespacedName{Namespace: m.GetNamespace(), Name: m.GetName()}, current)
+		switch {
+		case kerrors.IsNotFound(err):
+		case err != nil:
+			return errors.Wrap(err, errGetObject)
+		default:
+			for _, fn := range ao {
+				if err := fn(ctx, current, o); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	// The API server doesn't accept the managed fields in an apply request,
+	// and the resource version would make it fail on every concurrent write.
+	m.SetManagedFields(nil)
+	m.SetResourceVersion("")
+	return errors.Wrap(a.client.Patch(ctx, o, client.Apply, client.FieldOwner(a.manager)), errApplyObject)
+}
+
+// NewDryRunClient returns a client whose writes are dry-run with the supplied
+// client, i.e. validated and admitted by the API server without being
+// persisted. It lets the applicators dry-run exactly what they'd write.
+func NewDryRunClient(c client.Client) client.Client {
+	return &dryRunClient{Client: c}
+}
+
+type dryRunClient struct {
+	client.Client
+}
+
+func (c *dryRunClient) Create(ctx context.Context, obj runtime.Object, opts ...client.CreateOption) error {
+	return c.Client.Create(ctx, obj, append(opts, client.DryRunAll)...)
+}
+
+func (c *dryRunClient) Update(ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	return c.Client.Update(ctx, obj, append(opts, client.DryRunAll)...)
+}
+
+func (c *dryRunClient) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	return c.Client.Patch(ctx, obj, patch, append(opts, client.DryRunAll)...)
+}
+
+func (c *dryRunClient) Delete(ctx context.Context, obj runtime.Object, opts ...client.DeleteOption) error {
+	return c.Client.Delete(ctx, obj, append(opts, client.DryRunAll)...)
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/pkg/resource"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+)
+
+func TestServerSideApplicator(t *testing.T) {
+	errBoom := errors.New("boom")
+	// conflict is the error that the API server returns when an apply
+	// request conflicts with the fields of other managers.
+	conflict := kerrors.NewApplyConflict([]metav1.StatusCause{
+		{Type: metav1.CauseTypeFieldManagerConflict, Message: `conflict with "policy-controller" using database.example.org/v1alpha1`, Field: ".spec.size"},
+	}, `Apply failed with 1 conflict: conflict with "policy-controller" using database.example.org/v1alpha1: .spec.size`)
+	desired := func() *unstructured.Unstructured {
+		u := &unstructured.Unstructured{}
+		u.SetAPIVersion("database.example.org/v1alpha1")
+		u.SetKind("Database")
+		u.SetName("cool")
+		u.SetResourceVersion("3")
+		u.SetManagedFields([]metav1.ManagedFieldsEntry{{Manager: "crossplane-agent"}})
+		return u
+	}
+
+	type want struct {
+		err       error
+		conflicts []FieldConflict
+	}
+	cases := map[string]struct {
+		reason string
+		get    test.MockGetFn
+		patch  error
+		opts   []resource.ApplyOption
+		want   want
+	}{
+		"Applied": {
+			reason: "The object should be applied as the field manager without its managed fields and resource version",
+		},
+		"Conflict": {
+			reason: "The fields that other managers own should be extracted from the error of the API server",
+			patch:  conflict,
+			want: want{
+				err:       errors.Wrap(conflict, errApplyObject),
+				conflicts: []FieldConflict{{Manager: "policy-controller", Field: ".spec.size"}},
+			},
+		},
+		"OptionFailed": {
+			reason: "Errors of the apply options should be returned",
+			get:    test.NewMockGetFn(nil),
+			opts: []resource.ApplyOption{func(_ context.Context, _, _ runtime.Object) error {
+				return errBoom
+			}},
+			want: want{err: errBoom},
+		},
+		"GetError": {
+			reason: "Errors getting the current object for the apply options should be returned",
+			get:    test.NewMockGetFn(errBoom),
+			opts: []resource.ApplyOption{func(_ context.Context, _, _ runtime.Object) error {
+				return nil
+			}},
+			want: want{err: errors.Wrap(errBoom, errGetObject)},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			kube := &test.MockClient{
+				MockGet: tc.get,
+				MockPatch: func(_ context.Context, obj runtime.Object, p client.Patch, opts ...client.PatchOption) error {
+					if p != client.Apply {
+						t.Errorf("\nReason: %s\nPatch(...): want an apply patch, got %s", tc.reason, p.Type())
+					}
+					po := &client.PatchOptions{}
+					po.ApplyOptions(opts)
+					if diff := cmp.Diff("crossplane-agent", po.FieldManager); diff != "" {
+						t.Errorf("\nReason: %s\nPatch(...): -want field manager, +got field manager:\n%s", tc.reason, diff)
+					}
+					o := obj.(metav1.Object)
+					if o.GetResourceVersion() != "" || o.GetManagedFields() != nil {
+						t.Errorf("\nReason: %s\nPatch(...): the resource version and the managed fields should be cleared", tc.reason)
+					}
+					return tc.patch
+				},
+			}
+			err := NewServerSideApplicator(kube, "crossplane-agent").Apply(context.Background(), desired(), tc.opts...)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\nApply(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.conflicts, FieldConflicts(RemoteError(err, "cannot apply claim"))); diff != "" {
+				t.Errorf("\nReason: %s\nFieldConflicts(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"context"
+)
+
+// ContextFromStop returns a context that is cancelled once the supplied
+// channel is closed, e.g. the one that the controller manager passes to its
+// runnables, or once the returned function is called.
+func ContextFromStop(stop <-chan struct{}) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// A ManagerContext carries the context of the controller manager that a
+// reconciler runs in. Reconcilers embed it so that the controller manager
+// injects its stop channel into them when their controllers are created, and
+// derive the context of every reconcile from it so that the reconciles in
+// flight are cancelled when the agent stops rather than once they time out.
+type ManagerContext struct {
+	ctx context.Context
+}
+
+// InjectStopChannel is called by the controller manager with the channel that
+// it closes when it stops.
+func (m *ManagerContext) InjectStopChannel(stop <-chan struct{}) error {
+	// The context lives as long as the controller manager, so it's never
+	// cancelled otherwise.
+	m.ctx, _ = ContextFromStop(stop)
+	return nil
+}
+
+// Context returns the context of the controller manager, or the background
+// context if the reconciler isn't run by one, e.g. in tests.
+func (m *ManagerContext) Context() context.Context {
+	if m.ctx == nil {
+		return context.Background()
+	}
+	return m.ctx
+}
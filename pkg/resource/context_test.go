@@ -0,0 +1,67 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+)
+
+func TestManagerContext(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		inject bool
+		stop   bool
+		want   error
+	}{
+		"NotInjected": {
+			reason: "The background context should be used if no stop channel is injected",
+		},
+		"Running": {
+			reason: "The context should not be cancelled while the controller manager runs",
+			inject: true,
+		},
+		"Stopped": {
+			reason: "The context should be cancelled once the controller manager stops",
+			inject: true,
+			stop:   true,
+			want:   context.Canceled,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			m := &ManagerContext{}
+			stop := make(chan struct{})
+			if tc.inject {
+				if err := m.InjectStopChannel(stop); err != nil {
+					t.Fatalf("InjectStopChannel(...): %s", err)
+				}
+			}
+			if tc.stop {
+				close(stop)
+				<-m.Context().Done()
+			}
+			if diff := cmp.Diff(tc.want, m.Context().Err(), test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\nm.Context().Err(): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
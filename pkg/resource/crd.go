@@ -0,0 +1,728 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/install"
+	v1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	structuralschema "k8s.io/apiextensions-apiserver/pkg/apiserver/schema"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/discovery"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/pkg/meta"
+	"github.com/crossplane/crossplane-runtime/pkg/resource"
+	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1/ccrd"
+
+	"github.com/crossplane/agent/pkg/metrics"
+)
+
+const (
+	errDiscoverCRDVersion = "cannot discover the served versions of the CustomResourceDefinition API"
+	errNoCRDVersion       = "neither v1 nor v1beta1 of the CustomResourceDefinition API is served"
+	errConvertCRD         = "cannot convert custom resource definition"
+	errPatchCRD           = "v1beta1 custom resource definitions cannot be patched in a cluster that serves only v1"
+	errGetCRD             = "cannot get custom resource definition"
+	errHashCRD            = "cannot hash custom resource definition"
+	errCreateCRD          = "cannot create custom resource definition"
+	errUpdateCRD          = "cannot update custom resource definition"
+	errApplyCRD           = "cannot apply custom resource definition"
+	errNotStructural      = "schema is not structural"
+	errFmtNotStructural   = "schema of version %s is not structural"
+)
+
+// A CRDVersion is a version of the apiextensions.k8s.io API group that
+// CustomResourceDefinitions are served with.
+type CRDVersion string
+
+// The versions of CustomResourceDefinitions the agent can work with.
+const (
+	CRDVersionV1beta1 CRDVersion = "v1beta1"
+	CRDVersionV1      CRDVersion = "v1"
+)
+
+// The agent works with v1beta1 CustomResourceDefinitions in memory, which are
+// converted through the internal type when the cluster serves only v1.
+var crdScheme = func() *runtime.Scheme {
+	s := runtime.NewScheme()
+	install.Install(s)
+	return s
+}()
+
+// DiscoverCRDVersion returns the version of CustomResourceDefinitions that the
+// agent should use with the cluster. v1beta1 is preferred since it's what the
+// agent works with, and v1 is used for clusters that no longer serve it.
+func DiscoverCRDVersion(d discovery.ServerResourcesInterface) (CRDVersion, error) {
+	for _, v := range []CRDVersion{CRDVersionV1beta1, CRDVersionV1} {
+		_, err := d.ServerResourcesForGroupVersion(apiextensions.GroupName + "/" + string(v))
+		if kerrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return "", errors.Wrap(err, errDiscoverCRDVersion)
+		}
+		return v, nil
+	}
+	return "", errors.New(errNoCRDVersion)
+}
+
+// Object returns an empty CustomResourceDefinition of the version, e.g. to
+// watch CustomResourceDefinitions with.
+func (v CRDVersion) Object() runtime.Object {
+	if v == CRDVersionV1 {
+		return &v1.CustomResourceDefinition{}
+	}
+	return &v1beta1.CustomResourceDefinition{}
+}
+
+// Client returns a client that reads and writes v1beta1
+// CustomResourceDefinitions using the version. All other objects are passed
+// to the supplied client as is.
+func (v CRDVersion) Client(kube client.Client) client.Client {
+	if v == CRDVersionV1 {
+		return &v1CRDClient{Client: kube}
+	}
+	return kube
+}
+
+// KeepStoredVersions returns an ApplyOption that keeps the versions of the
+// current CustomResourceDefinition that objects are still stored in, which
+// the API server refuses to drop, when the desired one no longer has them.
+// They're kept as neither served nor storage versions so that the existing
+// objects stay readable until they're migrated to the new storage version.
+func KeepStoredVersions() resource.ApplyOption {
+	return func(_ context.Context, current, desired runtime.Object) error {
+		c, ok := current.(*v1beta1.CustomResourceDefinition)
+		if !ok {
+			return nil
+		}
+		d, ok := desired.(*v1beta1.CustomResourceDefinition)
+		if !ok {
+			return nil
+		}
+		keepStoredVersions(c, d, false)
+		return nil
+	}
+}
+
+// ServeStoredVersions is like KeepStoredVersions but the kept versions are
+// served with a schema that accepts whatever is stored, so that the objects
+// can still be read as they're stored at them, e.g. to migrate them to the
+// new storage version. A top-level schema of the desired
+// CustomResourceDefinition is moved to its versions for that.
+func ServeStoredVersions() resource.ApplyOption {
+	return func(_ context.Context, current, desired runtime.Object) error {
+		c, ok := current.(*v1beta1.CustomResourceDefinition)
+		if !ok {
+			return nil
+		}
+		d, ok := desired.(*v1beta1.CustomResourceDefinition)
+		if !ok {
+			return nil
+		}
+		keepStoredVersions(c, d, true)
+		return nil
+	}
+}
+
+func keepStoredVersions(current, desired *v1beta1.CustomResourceDefinition, serve bool) {
+	if len(desired.Spec.Versions) == 0 && desired.Spec.Version != "" {
+		desired.Spec.Versions = []v1beta1.CustomResourceDefinitionVersion{{Name: desired.Spec.Version, Served: true, Storage: true}}
+	}
+	perVersionSchema := false
+	has := map[string]bool{}
+	for _, v := range desired.Spec.Versions {
+		has[v.Name] = true
+		perVersionSchema = perVersionSchema || v.Schema != nil
+	}
+	if serve && !perVersionSchema && desired.Spec.Validation != nil {
+		dropped := false
+		for _, name := range current.Status.StoredVersions {
+			dropped = dropped || !has[name]
+		}
+		if dropped {
+			for i := range desired.Spec.Versions {
+				desired.Spec.Versions[i].Schema = desired.Spec.Validation.DeepCopy()
+			}
+			desired.Spec.Validation = nil
+			perVersionSchema = true
+		}
+	}
+	for _, name := range current.Status.StoredVersions {
+		if has[name] {
+			continue
+		}
+		// The top-level schema of the desired CRD applies to the kept version
+		// as well. Otherwise it gets one that accepts whatever is stored,
+		// since clusters that serve only v1 require a schema for every
+		// version.
+		v := v1beta1.CustomResourceDefinitionVersion{Name: name, Served: serve}
+		if perVersionSchema {
+			preserve := true
+			v.Schema = &v1beta1.CustomResourceValidation{OpenAPIV3Schema: &v1beta1.JSONSchemaProps{Type: "object", XPreserveUnknownFields: &preserve}}
+		}
+		desired.Spec.Versions = append(desired.Spec.Versions, v)
+		has[name] = true
+	}
+}
+
+// A ConversionStrategy decides how a CustomResourceDefinition of the remote
+// cluster whose versions are converted by a webhook is rendered in the local
+// cluster, where the webhook it points at isn't reachable.
+type ConversionStrategy string
+
+// Conversion strategies.
+const (
+	// ConversionStrategyNone renders the CustomResourceDefinition with only
+	// its storage version and without conversion.
+	ConversionStrategyNone ConversionStrategy = "None"
+
+	// ConversionStrategyWebhook rewires the conversion webhook to a
+	// conversion service in the local cluster, e.g. one that's deployed
+	// alongside the agent.
+	ConversionStrategyWebhook ConversionStrategy = "Webhook"
+)
+
+// A CRDConversion renders the conversion of CustomResourceDefinitions fetched
+// from the remote cluster.
+type CRDConversion struct {
+	Strategy ConversionStrategy
+
+	// Service is the conversion service in the local cluster. Path, Port and
+	// CABundle are how it's reached. Only used by ConversionStrategyWebhook.
+	Service  types.NamespacedName
+	Path     string
+	Port     int32
+	CABundle []byte
+}
+
+// Render changes the conversion of the supplied CustomResourceDefinition if
+// it's converted by a webhook. The ones without conversion are left as is.
+func (c CRDConversion) Render(crd *v1beta1.CustomResourceDefinition) {
+	if crd.Spec.Conversion == nil || crd.Spec.Conversion.Strategy != v1beta1.WebhookConverter {
+		return
+	}
+	if c.Strategy == ConversionStrategyWebhook {
+		svc := &v1beta1.ServiceReference{Namespace: c.Service.Namespace, Name: c.Service.Name}
+		if c.Path != "" {
+			svc.Path = &c.Path
+		}
+		if c.Port != 0 {
+			svc.Port = &c.Port
+		}
+		crd.Spec.Conversion.WebhookClientConfig = &v1beta1.WebhookClientConfig{Service: svc, CABundle: c.CABundle}
+		return
+	}
+	crd.Spec.Conversion = &v1beta1.CustomResourceConversion{Strategy: v1beta1.NoneConverter}
+	for _, v := range crd.Spec.Versions {
+		if v.Storage {
+			v.Served = true
+			crd.Spec.Versions = []v1beta1.CustomResourceDefinitionVersion{v}
+			crd.Spec.Version = v.Name
+			return
+		}
+	}
+}
+
+// NewCRDApplicator returns a new *CRDApplicator.
+func NewCRDApplicator(c client.Client) *CRDApplicator {
+	return &CRDApplicator{client: c, fallback: resource.NewAPIUpdatingApplicator(c)}
+}
+
+// CRDApplicator applies CustomResourceDefinitions only if they're different
+// from what was written last time, which is recorded as a hash in the
+// AnnotationKeySpecHash annotation. Every write makes the API server
+// re-establish the CRD, so skipping the ones that don't change anything saves
+// both the local API server and the controllers of the CRD from churn. Objects
+// of other types are applied with an APIUpdatingApplicator.
+type CRDApplicator struct {
+	client   client.Client
+	fallback resource.Applicator
+}
+
+// Apply creates or updates the supplied CustomResourceDefinition unless it's
+// the same as the one in the cluster. The supplied options are run against
+// the existing CRD either way. Unless they fail, the object is filled with
+// what's in the cluster afterwards.
+func (a *CRDApplicator) Apply(ctx context.Context, o runtime.Object, ao ...resource.ApplyOption) error {
+	desired, ok := o.(*v1beta1.CustomResourceDefinition)
+	if !ok {
+		return a.fallback.Apply(ctx, o, ao...)
+	}
+	h, err := hashCRD(desired)
+	if err != nil {
+		return errors.Wrap(err, errHashCRD)
+	}
+	meta.AddAnnotations(desired, map[string]string{AnnotationKeySpecHash: h})
+	current := &v1beta1.CustomResourceDefinition{}
+	err = a.client.Get(ctx, types.NamespacedName{Name: desired.GetName()}, current)
+	if kerrors.IsNotFound(err) {
+		if err := a.client.Create(ctx, desired); err != nil {
+			return errors.Wrap(err, errCreateCRD)
+		}
+		metrics.CRDWrites.WithLabelValues(desired.GetName()).Inc()
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, errGetCRD)
+	}
+	// The options run before the hash is compared so that e.g. a CRD that
+	// another controller took over is reported even if it didn't change.
+	for _, fn := range ao {
+		if err := fn(ctx, current, desired); err != nil {
+			return err
+		}
+	}
+	if current.GetAnnotations()[AnnotationKeySpecHash] == h {
+		current.DeepCopyInto(desired)
+		return nil
+	}
+	desired.SetResourceVersion(current.GetResourceVersion())
+	if err := a.client.Update(ctx, desired); err != nil {
+		return errors.Wrap(err, errUpdateCRD)
+	}
+	metrics.CRDWrites.WithLabelValues(desired.GetName()).Inc()
+	return nil
+}
+
+// hashCRD returns the hash of the parts of the supplied CustomResourceDefinition
+// that the agent writes. The annotations that change on every sync without
+// the CRD itself changing are left out.
+func hashCRD(crd *v1beta1.CustomResourceDefinition) (string, error) {
+	a := map[string]string{}
+	for k, v := range crd.GetAnnotations() {
+		switch k {
+		case AnnotationKeySpecHash, AnnotationKeySyncID, AnnotationKeyLastSyncedTime, AnnotationKeySourceResourceVersion:
+			continue
+		}
+		a[k] = v
+	}
+	data, err := json.Marshal(struct {
+		Labels          map[string]string                    `json:"labels"`
+		Annotations     map[string]string                    `json:"annotations"`
+		OwnerReferences []metav1.OwnerReference              `json:"ownerReferences"`
+		Spec            v1beta1.CustomResourceDefinitionSpec `json:"spec"`
+	}{
+		Labels:          crd.GetLabels(),
+		Annotations:     a,
+		OwnerReferences: crd.GetOwnerReferences(),
+		Spec:            crd.Spec,
+	})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// IsEstablished returns true if the supplied object is a CustomResourceDefinition
+// of either version that is established.
+func IsEstablished(o runtime.Object) bool {
+	switch crd := o.(type) {
+	case *v1beta1.CustomResourceDefinition:
+		return ccrd.IsEstablished(crd.Status)
+	case *v1.CustomResourceDefinition:
+		for _, c := range crd.Status.Conditions {
+			if c.Type == v1.Established {
+				return c.Status == v1.ConditionTrue
+			}
+		}
+	}
+	return false
+}
+
+// EnsureCRD applies the supplied CustomResourceDefinition of a type of the
+// agent itself, e.g. ClaimApprovals, and waits up to the supplied timeout for
+// it to be established. It returns ErrCRDNotEstablished if it isn't
+// established in time. The supplied client should be one of the CRD version
+// the cluster serves, see CRDVersion.Client.
+func EnsureCRD(ctx context.Context, kube client.Client, crd *v1beta1.CustomResourceDefinition, timeout time.Duration) error {
+	// The CRD is applied with a CRDApplicator since v1 CRDs cannot be
+	// patched with the patches calculated from v1beta1 objects.
+	if err := NewCRDApplicator(kube).Apply(ctx, crd); err != nil {
+		return errors.Wrap(err, errApplyCRD)
+	}
+	err := wait.PollImmediate(time.Second, timeout, func() (bool, error) {
+		got := &v1beta1.CustomResourceDefinition{}
+		if err := kube.Get(ctx, types.NamespacedName{Name: crd.GetName()}, got); err != nil {
+			return false, errors.Wrap(err, errGetCRD)
+		}
+		return IsEstablished(got), nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return ErrCRDNotEstablished
+	}
+	return err
+}
+
+// Established returns ErrCRDNotEstablished if the supplied object isn't an
+// established CustomResourceDefinition, see IsEstablished.
+func Established(o runtime.Object) error {
+	if !IsEstablished(o) {
+		return ErrCRDNotEstablished
+	}
+	return nil
+}
+
+// ConvertCRD converts the supplied CustomResourceDefinition to the supplied
+// one of another version. The input is defaulted first so that fields the
+// other version requires, like the list of versions, are filled.
+func ConvertCRD(in, out runtime.Object) error {
+	in = in.DeepCopyObject()
+	crdScheme.Default(in)
+	internal := &apiextensions.CustomResourceDefinition{}
+	if err := crdScheme.Convert(in, internal, nil); err != nil {
+		return errors.Wrap(err, errConvertCRD)
+	}
+	if err := crdScheme.Convert(internal, out, nil); err != nil {
+		return errors.Wrap(err, errConvertCRD)
+	}
+	if crd, ok := out.(*v1.CustomResourceDefinition); ok {
+		preserveUnknownFieldsV1(crd)
+	}
+	return nil
+}
+
+// preserveUnknownFieldsV1 moves the spec.preserveUnknownFields of the supplied
+// CustomResourceDefinition, which the v1 API doesn't accept for new CRDs and
+// v1beta1 defaults to true, into its schemas. The x-kubernetes-preserve-unknown-fields
+// extension isn't inherited by the specified properties, so it's set on every
+// object of the schemas to keep the unknown fields that the v1beta1 CRD kept.
+func preserveUnknownFieldsV1(crd *v1.CustomResourceDefinition) {
+	if !crd.Spec.PreserveUnknownFields {
+		return
+	}
+	crd.Spec.PreserveUnknownFields = false
+	for i := range crd.Spec.Versions {
+		v := &crd.Spec.Versions[i]
+		if v.Schema == nil || v.Schema.OpenAPIV3Schema == nil {
+			v.Schema = &v1.CustomResourceValidation{OpenAPIV3Schema: &v1.JSONSchemaProps{Type: "object"}}
+		}
+		preserveObjects(v.Schema.OpenAPIV3Schema)
+	}
+}
+
+func preserveObjects(s *v1.JSONSchemaProps) {
+	if s.Type == "object" || len(s.Properties) > 0 {
+		preserve := true
+		s.XPreserveUnknownFields = &preserve
+	}
+	for k, p := range s.Properties {
+		preserveObjects(&p)
+		s.Properties[k] = p
+	}
+	if s.Items != nil && s.Items.Schema != nil {
+		preserveObjects(s.Items.Schema)
+	}
+	if s.AdditionalProperties != nil && s.AdditionalProperties.Schema != nil {
+		preserveObjects(s.AdditionalProperties.Schema)
+	}
+}
+
+// RequireStructuralSchemas renders the supplied CustomResourceDefinition with
+// structural schemas whose unknown fields are pruned, which some clusters
+// require of all CRDs regardless of their version. The fields that the schemas
+// explicitly preserve with x-kubernetes-preserve-unknown-fields are kept, and
+// the versions without a schema get one that preserves all of their fields
+// since there's nothing to prune them with. An error is returned if a rendered
+// schema still isn't structural.
+func RequireStructuralSchemas(crd *v1beta1.CustomResourceDefinition) error {
+	prune := false
+	crd.Spec.PreserveUnknownFields = &prune
+	if crd.Spec.Validation != nil && crd.Spec.Validation.OpenAPIV3Schema != nil {
+		structural(crd.Spec.Validation.OpenAPIV3Schema, true)
+		return validateStructural(crd.Spec.Validation.OpenAPIV3Schema)
+	}
+	preserve := true
+	if len(crd.Spec.Versions) == 0 {
+		crd.Spec.Validation = &v1beta1.CustomResourceValidation{OpenAPIV3Schema: &v1beta1.JSONSchemaProps{Type: "object", XPreserveUnknownFields: &preserve}}
+		return nil
+	}
+	for i := range crd.Spec.Versions {
+		v := &crd.Spec.Versions[i]
+		if v.Schema == nil || v.Schema.OpenAPIV3Schema == nil {
+			v.Schema = &v1beta1.CustomResourceValidation{OpenAPIV3Schema: &v1beta1.JSONSchemaProps{Type: "object", XPreserveUnknownFields: &preserve}}
+			continue
+		}
+		structural(v.Schema.OpenAPIV3Schema, true)
+		if err := validateStructural(v.Schema.OpenAPIV3Schema); err != nil {
+			return errors.Wrapf(err, errFmtNotStructural, v.Name)
+		}
+	}
+	return nil
+}
+
+// validateStructural validates the supplied schema with the checks that the
+// API server runs on the structural schemas of CRDs.
+func validateStructural(s *v1beta1.JSONSchemaProps) error {
+	in := &apiextensions.JSONSchemaProps{}
+	if err := v1beta1.Convert_v1beta1_JSONSchemaProps_To_apiextensions_JSONSchemaProps(s, in, nil); err != nil {
+		return errors.Wrap(err, errConvertCRD)
+	}
+	ss, err := structuralschema.NewStructural(in)
+	if err != nil {
+		return errors.Wrap(err, errNotStructural)
+	}
+	return errors.Wrap(structuralschema.ValidateStructural(field.NewPath("openAPIV3Schema"), ss).ToAggregate(), errNotStructural)
+}
+
+// structural makes the supplied schema structural. Every object, array and
+// field gets a type, the fields of which any type is allowed preserve their
+// unknown fields instead, and the fields that the logical junctors, i.e.
+// allOf, anyOf, oneOf and not, specify are specified outside of them as well
+// while the junctors are left with their value validations only.
+// additionalProperties are dropped where a structural schema doesn't allow
+// them, i.e. at the root and next to properties, since the unknown fields are
+// pruned there anyway.
+func structural(s *v1beta1.JSONSchemaProps, root bool) {
+	// The junctors of int-or-strings are part of their pattern.
+	if !s.XIntOrString {
+		typed := s.Type != ""
+		types := map[string]bool{}
+		for _, j := range junctors(s) {
+			if j.Type != "" {
+				types[j.Type] = true
+			}
+			junctor(s, j)
+		}
+		// A value that the junctors allow to be of different types may be of
+		// any type as far as the structure is concerned.
+		if !typed && len(types) > 1 {
+			s.Type = ""
+		}
+	}
+	if s.AdditionalProperties != nil && (root || len(s.Properties) > 0) {
+		s.AdditionalProperties = nil
+	}
+	for k, p := range s.Properties {
+		structural(&p, false)
+		s.Properties[k] = p
+	}
+	if s.Items != nil && s.Items.Schema != nil {
+		structural(s.Items.Schema, false)
+	}
+	if s.AdditionalProperties != nil && s.AdditionalProperties.Schema != nil {
+		structural(s.AdditionalProperties.Schema, false)
+	}
+	if s.Type != "" {
+		return
+	}
+	switch {
+	case root || len(s.Properties) > 0 || s.AdditionalProperties != nil:
+		s.Type = "object"
+	case s.Items != nil:
+		s.Type = "array"
+	case !s.XIntOrString:
+		preserve := true
+		s.XPreserveUnknownFields = &preserve
+	}
+}
+
+// junctors returns the logical junctors of the supplied schema.
+func junctors(s *v1beta1.JSONSchemaProps) []*v1beta1.JSONSchemaProps {
+	js := make([]*v1beta1.JSONSchemaProps, 0, len(s.AllOf)+len(s.AnyOf)+len(s.OneOf)+1)
+	for i := range s.AllOf {
+		js = append(js, &s.AllOf[i])
+	}
+	for i := range s.AnyOf {
+		js = append(js, &s.AnyOf[i])
+	}
+	for i := range s.OneOf {
+		js = append(js, &s.OneOf[i])
+	}
+	if s.Not != nil {
+		js = append(js, s.Not)
+	}
+	return js
+}
+
+// junctor specifies the fields that the supplied junctor specifies in the
+// supplied schema that it's a junctor of, and leaves the junctor with its
+// value validations only.
+func junctor(s, j *v1beta1.JSONSchemaProps) {
+	specify(s, j)
+	validationsOnly(j)
+}
+
+// specify adds the structure of the supplied junctor, including that of its
+// own junctors, to the supplied schema. The value validations are left in the
+// junctor, where they apply.
+func specify(s, j *v1beta1.JSONSchemaProps) {
+	if s.Type == "" {
+		s.Type = j.Type
+	}
+	if s.Properties == nil && len(j.Properties) > 0 {
+		s.Properties = map[string]v1beta1.JSONSchemaProps{}
+	}
+	for k, jp := range j.Properties {
+		p := s.Properties[k]
+		specify(&p, &jp)
+		s.Properties[k] = p
+	}
+	if j.Items != nil && j.Items.Schema != nil {
+		if s.Items == nil || s.Items.Schema == nil {
+			s.Items = &v1beta1.JSONSchemaPropsOrArray{Schema: &v1beta1.JSONSchemaProps{}}
+		}
+		specify(s.Items.Schema, j.Items.Schema)
+	}
+	if s.AdditionalProperties == nil && j.AdditionalProperties != nil {
+		s.AdditionalProperties = j.AdditionalProperties.DeepCopy()
+	}
+	if s.XPreserveUnknownFields == nil {
+		s.XPreserveUnknownFields = j.XPreserveUnknownFields
+	}
+	s.XIntOrString = s.XIntOrString || j.XIntOrString
+	s.XEmbeddedResource = s.XEmbeddedResource || j.XEmbeddedResource
+	for _, jj := range junctors(j) {
+		specify(s, jj)
+	}
+}
+
+// validationsOnly removes everything but the value validations from the
+// supplied junctor.
+func validationsOnly(j *v1beta1.JSONSchemaProps) {
+	j.Type = ""
+	j.Title = ""
+	j.Description = ""
+	j.Default = nil
+	j.Nullable = false
+	j.AdditionalProperties = nil
+	j.XPreserveUnknownFields = nil
+	j.XEmbeddedResource = false
+	j.XIntOrString = false
+	j.XListMapKeys = nil
+	j.XListType = nil
+	for k, p := range j.Properties {
+		validationsOnly(&p)
+		j.Properties[k] = p
+	}
+	if j.Items != nil && j.Items.Schema != nil {
+		validationsOnly(j.Items.Schema)
+	}
+	for _, jj := range junctors(j) {
+		validationsOnly(jj)
+	}
+}
+
+// v1CRDClient converts v1beta1 CustomResourceDefinitions to v1 on their way to
+// the API server and back.
+type v1CRDClient struct {
+	client.Client
+}
+
+func (c *v1CRDClient) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	crd, ok := obj.(*v1beta1.CustomResourceDefinition)
+	if !ok {
+		return c.Client.Get(ctx, key, obj)
+	}
+	out := &v1.CustomResourceDefinition{}
+	if err := c.Client.Get(ctx, key, out); err != nil {
+		return err
+	}
+	return ConvertCRD(out, crd)
+}
+
+func (c *v1CRDClient) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	l, ok := list.(*v1beta1.CustomResourceDefinitionList)
+	if !ok {
+		return c.Client.List(ctx, list, opts...)
+	}
+	out := &v1.CustomResourceDefinitionList{}
+	if err := c.Client.List(ctx, out, opts...); err != nil {
+		return err
+	}
+	l.ListMeta = out.ListMeta
+	l.Items = make([]v1beta1.CustomResourceDefinition, len(out.Items))
+	for i := range out.Items {
+		if err := ConvertCRD(&out.Items[i], &l.Items[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *v1CRDClient) Create(ctx context.Context, obj runtime.Object, opts ...client.CreateOption) error {
+	return convertThrough(obj, func(o runtime.Object) error { return c.Client.Create(ctx, o, opts...) })
+}
+
+func (c *v1CRDClient) Update(ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	return convertThrough(obj, func(o runtime.Object) error { return c.Client.Update(ctx, o, opts...) })
+}
+
+func (c *v1CRDClient) Delete(ctx context.Context, obj runtime.Object, opts ...client.DeleteOption) error {
+	return convertThrough(obj, func(o runtime.Object) error { return c.Client.Delete(ctx, o, opts...) })
+}
+
+func (c *v1CRDClient) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	// The patches are calculated from v1beta1 objects, so they'd silently
+	// drop the fields that moved in v1.
+	if _, ok := obj.(*v1beta1.CustomResourceDefinition); ok {
+		return errors.New(errPatchCRD)
+	}
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func (c *v1CRDClient) Status() client.StatusWriter {
+	return &v1CRDStatusWriter{StatusWriter: c.Client.Status()}
+}
+
+type v1CRDStatusWriter struct {
+	client.StatusWriter
+}
+
+func (w *v1CRDStatusWriter) Update(ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	return convertThrough(obj, func(o runtime.Object) error { return w.StatusWriter.Update(ctx, o, opts...) })
+}
+
+func (w *v1CRDStatusWriter) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if _, ok := obj.(*v1beta1.CustomResourceDefinition); ok {
+		return errors.New(errPatchCRD)
+	}
+	return w.StatusWriter.Patch(ctx, obj, patch, opts...)
+}
+
+// convertThrough calls fn with the v1 counterpart of obj if it's a v1beta1
+// CustomResourceDefinition, and converts what the API server returned back
+// into obj.
+func convertThrough(obj runtime.Object, fn func(o runtime.Object) error) error {
+	crd, ok := obj.(*v1beta1.CustomResourceDefinition)
+	if !ok {
+		return fn(obj)
+	}
+	out := &v1.CustomResourceDefinition{}
+	if err := ConvertCRD(crd, out); err != nil {
+		return err
+	}
+	if err := fn(out); err != nil {
+		return err
+	}
+	return ConvertCRD(out, crd)
+}
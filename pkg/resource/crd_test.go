@@ -0,0 +1,734 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	v1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/pkg/resource"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+)
+
+type mockDiscovery struct {
+	discovery.ServerResourcesInterface
+	served map[string]bool
+	err    error
+}
+
+func (d *mockDiscovery) ServerResourcesForGroupVersion(gv string) (*metav1.APIResourceList, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	if !d.served[gv] {
+		return nil, kerrors.NewNotFound(schema.GroupResource{}, gv)
+	}
+	return &metav1.APIResourceList{GroupVersion: gv}, nil
+}
+
+func TestDiscoverCRDVersion(t *testing.T) {
+	errBoom := errors.New("boom")
+	type want struct {
+		v   CRDVersion
+		err error
+	}
+	cases := map[string]struct {
+		reason string
+		d      *mockDiscovery
+		want   want
+	}{
+		"Both": {
+			reason: "v1beta1 should be preferred if both versions are served",
+			d:      &mockDiscovery{served: map[string]bool{"apiextensions.k8s.io/v1": true, "apiextensions.k8s.io/v1beta1": true}},
+			want:   want{v: CRDVersionV1beta1},
+		},
+		"OnlyV1": {
+			reason: "v1 should be used if v1beta1 isn't served",
+			d:      &mockDiscovery{served: map[string]bool{"apiextensions.k8s.io/v1": true}},
+			want:   want{v: CRDVersionV1},
+		},
+		"Neither": {
+			reason: "An error should be returned if neither version is served",
+			d:      &mockDiscovery{},
+			want:   want{err: errors.New(errNoCRDVersion)},
+		},
+		"DiscoveryFailed": {
+			reason: "Errors other than not found should be returned",
+			d:      &mockDiscovery{err: errBoom},
+			want:   want{err: errors.Wrap(errBoom, errDiscoverCRDVersion)},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			v, err := DiscoverCRDVersion(tc.d)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\nDiscoverCRDVersion(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.v, v); diff != "" {
+				t.Errorf("\nReason: %s\nDiscoverCRDVersion(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestV1CRDClient(t *testing.T) {
+	validation := &v1beta1.CustomResourceValidation{OpenAPIV3Schema: &v1beta1.JSONSchemaProps{Type: "object"}}
+	crd := func() *v1beta1.CustomResourceDefinition {
+		return &v1beta1.CustomResourceDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: "databases.example.org", ResourceVersion: "1"},
+			Spec: v1beta1.CustomResourceDefinitionSpec{
+				Group:      "example.org",
+				Version:    "v1alpha1",
+				Names:      v1beta1.CustomResourceDefinitionNames{Kind: "Database", Plural: "databases"},
+				Scope:      v1beta1.NamespaceScoped,
+				Validation: validation,
+			},
+		}
+	}
+	v1crd := &v1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "databases.example.org", ResourceVersion: "2"},
+		Spec: v1.CustomResourceDefinitionSpec{
+			Group: "example.org",
+			Names: v1.CustomResourceDefinitionNames{Kind: "Database", Plural: "databases"},
+			Scope: v1.NamespaceScoped,
+			Versions: []v1.CustomResourceDefinitionVersion{{
+				Name:    "v1alpha1",
+				Served:  true,
+				Storage: true,
+				Schema:  &v1.CustomResourceValidation{OpenAPIV3Schema: &v1.JSONSchemaProps{Type: "object"}},
+			}},
+		},
+		Status: v1.CustomResourceDefinitionStatus{Conditions: []v1.CustomResourceDefinitionCondition{{Type: v1.Established, Status: v1.ConditionTrue}}},
+	}
+
+	t.Run("Get", func(t *testing.T) {
+		kube := &test.MockClient{MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+			o, ok := obj.(*v1.CustomResourceDefinition)
+			if !ok {
+				t.Fatalf("Get(...): want *v1.CustomResourceDefinition, got %T", obj)
+			}
+			v1crd.DeepCopyInto(o)
+			return nil
+		}}
+		got := &v1beta1.CustomResourceDefinition{}
+		if err := CRDVersionV1.Client(kube).Get(context.Background(), client.ObjectKey{Name: "databases.example.org"}, got); err != nil {
+			t.Fatalf("Get(...): %v", err)
+		}
+		if diff := cmp.Diff("v1alpha1", got.Spec.Version); diff != "" {
+			t.Errorf("\nReason: %s\nGet(...): -want version, +got version:\n%s", "The version should be converted from the list of versions", diff)
+		}
+		if diff := cmp.Diff(validation, got.Spec.Validation); diff != "" {
+			t.Errorf("\nReason: %s\nGet(...): -want validation, +got validation:\n%s", "The schema should be converted from the list of versions", diff)
+		}
+		if !IsEstablished(got) {
+			t.Errorf("\nReason: %s\nIsEstablished(...): got false", "The status should be converted")
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		var sent *v1.CustomResourceDefinition
+		kube := &test.MockClient{MockUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+			o, ok := obj.(*v1.CustomResourceDefinition)
+			if !ok {
+				t.Fatalf("Update(...): want *v1.CustomResourceDefinition, got %T", obj)
+			}
+			sent = o.DeepCopy()
+			o.SetResourceVersion("2")
+			return nil
+		}}
+		in := crd()
+		if err := CRDVersionV1.Client(kube).Update(context.Background(), in); err != nil {
+			t.Fatalf("Update(...): %v", err)
+		}
+		// The v1beta1 CRD preserves unknown fields by default, which v1
+		// expresses in the schema.
+		preserve := true
+		want := []v1.CustomResourceDefinitionVersion{{
+			Name:    "v1alpha1",
+			Served:  true,
+			Storage: true,
+			Schema:  &v1.CustomResourceValidation{OpenAPIV3Schema: &v1.JSONSchemaProps{Type: "object", XPreserveUnknownFields: &preserve}},
+		}}
+		if diff := cmp.Diff(want, sent.Spec.Versions); diff != "" {
+			t.Errorf("\nReason: %s\nUpdate(...): -want versions, +got versions:\n%s", "The version and schema should be moved to the list of versions", diff)
+		}
+		if diff := cmp.Diff("2", in.GetResourceVersion()); diff != "" {
+			t.Errorf("\nReason: %s\nUpdate(...): -want, +got:\n%s", "What the API server returned should be converted back", diff)
+		}
+	})
+
+	t.Run("Patch", func(t *testing.T) {
+		err := CRDVersionV1.Client(&test.MockClient{}).Patch(context.Background(), crd(), client.MergeFrom(crd()))
+		if diff := cmp.Diff(errors.New(errPatchCRD), err, test.EquateErrors()); diff != "" {
+			t.Errorf("\nReason: %s\nPatch(...): -want error, +got error:\n%s", "v1beta1 patches cannot be applied to v1 objects", diff)
+		}
+	})
+
+	t.Run("Passthrough", func(t *testing.T) {
+		kube := &test.MockClient{}
+		if got := CRDVersionV1beta1.Client(kube); got != client.Client(kube) {
+			t.Errorf("\nReason: %s\nClient(...): got %T", "The client should be used as is if v1beta1 is served", got)
+		}
+	})
+}
+
+func TestKeepStoredVersions(t *testing.T) {
+	preserve := true
+	validation := &v1beta1.CustomResourceValidation{OpenAPIV3Schema: &v1beta1.JSONSchemaProps{Type: "object"}}
+	stored := func(versions ...string) *v1beta1.CustomResourceDefinition {
+		return &v1beta1.CustomResourceDefinition{Status: v1beta1.CustomResourceDefinitionStatus{StoredVersions: versions}}
+	}
+	cases := map[string]struct {
+		reason  string
+		current runtime.Object
+		desired *v1beta1.CustomResourceDefinition
+		want    []v1beta1.CustomResourceDefinitionVersion
+	}{
+		"AllVersionsKept": {
+			reason:  "Nothing should be added if the desired CRD has all stored versions",
+			current: stored("v1alpha1"),
+			desired: &v1beta1.CustomResourceDefinition{Spec: v1beta1.CustomResourceDefinitionSpec{
+				Versions: []v1beta1.CustomResourceDefinitionVersion{{Name: "v1alpha1", Served: true, Storage: true}},
+			}},
+			want: []v1beta1.CustomResourceDefinitionVersion{{Name: "v1alpha1", Served: true, Storage: true}},
+		},
+		"TopLevelSchema": {
+			reason:  "Dropped stored versions should be kept as neither served nor storage versions",
+			current: stored("v1alpha1", "v1beta1"),
+			desired: &v1beta1.CustomResourceDefinition{Spec: v1beta1.CustomResourceDefinitionSpec{
+				Version:    "v1beta1",
+				Validation: validation,
+			}},
+			want: []v1beta1.CustomResourceDefinitionVersion{
+				{Name: "v1beta1", Served: true, Storage: true},
+				{Name: "v1alpha1"},
+			},
+		},
+		"PerVersionSchema": {
+			reason:  "Dropped stored versions should accept whatever is stored if the desired CRD has per-version schemas",
+			current: stored("v1alpha1"),
+			desired: &v1beta1.CustomResourceDefinition{Spec: v1beta1.CustomResourceDefinitionSpec{
+				Versions: []v1beta1.CustomResourceDefinitionVersion{{Name: "v1beta1", Served: true, Storage: true, Schema: validation}},
+			}},
+			want: []v1beta1.CustomResourceDefinitionVersion{
+				{Name: "v1beta1", Served: true, Storage: true, Schema: validation},
+				{Name: "v1alpha1", Schema: &v1beta1.CustomResourceValidation{OpenAPIV3Schema: &v1beta1.JSONSchemaProps{Type: "object", XPreserveUnknownFields: &preserve}}},
+			},
+		},
+		"NotACRD": {
+			reason:  "Objects other than v1beta1 CRDs should be left as is",
+			current: &v1.CustomResourceDefinition{Status: v1.CustomResourceDefinitionStatus{StoredVersions: []string{"v1alpha1"}}},
+			desired: &v1beta1.CustomResourceDefinition{},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := KeepStoredVersions()(context.Background(), tc.current, tc.desired)
+			if diff := cmp.Diff(nil, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\nKeepStoredVersions(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want, tc.desired.Spec.Versions); diff != "" {
+				t.Errorf("\nReason: %s\nKeepStoredVersions(...): -want versions, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestServeStoredVersions(t *testing.T) {
+	preserve := true
+	validation := &v1beta1.CustomResourceValidation{OpenAPIV3Schema: &v1beta1.JSONSchemaProps{Type: "object"}}
+	current := &v1beta1.CustomResourceDefinition{Status: v1beta1.CustomResourceDefinitionStatus{StoredVersions: []string{"v1alpha1", "v1beta1"}}}
+	desired := &v1beta1.CustomResourceDefinition{Spec: v1beta1.CustomResourceDefinitionSpec{
+		Version:    "v1beta1",
+		Validation: validation,
+	}}
+	want := v1beta1.CustomResourceDefinitionSpec{
+		Version: "v1beta1",
+		Versions: []v1beta1.CustomResourceDefinitionVersion{
+			{Name: "v1beta1", Served: true, Storage: true, Schema: validation},
+			{Name: "v1alpha1", Served: true, Schema: &v1beta1.CustomResourceValidation{OpenAPIV3Schema: &v1beta1.JSONSchemaProps{Type: "object", XPreserveUnknownFields: &preserve}}},
+		},
+	}
+	err := ServeStoredVersions()(context.Background(), current, desired)
+	if diff := cmp.Diff(nil, err, test.EquateErrors()); diff != "" {
+		t.Errorf("\nServeStoredVersions(...): -want error, +got error:\n%s", diff)
+	}
+	if diff := cmp.Diff(want, desired.Spec); diff != "" {
+		t.Errorf("\nReason: %s\nServeStoredVersions(...): -want, +got:\n%s", "Dropped stored versions should be served with a schema that accepts whatever is stored, with the top-level schema moved to the versions", diff)
+	}
+}
+
+func TestCRDConversionRender(t *testing.T) {
+	path := "/convert"
+	port := int32(9443)
+	remote := func() *v1beta1.CustomResourceDefinition {
+		return &v1beta1.CustomResourceDefinition{Spec: v1beta1.CustomResourceDefinitionSpec{
+			Version: "v1alpha1",
+			Versions: []v1beta1.CustomResourceDefinitionVersion{
+				{Name: "v1alpha1", Served: true},
+				{Name: "v1beta1", Served: true, Storage: true},
+			},
+			Conversion: &v1beta1.CustomResourceConversion{
+				Strategy: v1beta1.WebhookConverter,
+				WebhookClientConfig: &v1beta1.WebhookClientConfig{
+					Service: &v1beta1.ServiceReference{Namespace: "platform-system", Name: "converter"},
+				},
+				ConversionReviewVersions: []string{"v1", "v1beta1"},
+			},
+		}}
+	}
+	cases := map[string]struct {
+		reason     string
+		conversion CRDConversion
+		crd        *v1beta1.CustomResourceDefinition
+		want       v1beta1.CustomResourceDefinitionSpec
+	}{
+		"None": {
+			reason:     "CRDs converted by a webhook should be left with only their storage version and no conversion",
+			conversion: CRDConversion{Strategy: ConversionStrategyNone},
+			crd:        remote(),
+			want: v1beta1.CustomResourceDefinitionSpec{
+				Version:    "v1beta1",
+				Versions:   []v1beta1.CustomResourceDefinitionVersion{{Name: "v1beta1", Served: true, Storage: true}},
+				Conversion: &v1beta1.CustomResourceConversion{Strategy: v1beta1.NoneConverter},
+			},
+		},
+		"Webhook": {
+			reason: "CRDs converted by a webhook should be converted by the local conversion service",
+			conversion: CRDConversion{
+				Strategy: ConversionStrategyWebhook,
+				Service:  types.NamespacedName{Namespace: "crossplane-system", Name: "agent-converter"},
+				Path:     path,
+				Port:     port,
+				CABundle: []byte("ca"),
+			},
+			crd: remote(),
+			want: func() v1beta1.CustomResourceDefinitionSpec {
+				s := remote().Spec
+				s.Conversion.WebhookClientConfig = &v1beta1.WebhookClientConfig{
+					Service:  &v1beta1.ServiceReference{Namespace: "crossplane-system", Name: "agent-converter", Path: &path, Port: &port},
+					CABundle: []byte("ca"),
+				}
+				return s
+			}(),
+		},
+		"NoConversion": {
+			reason:     "CRDs without conversion should be left as is",
+			conversion: CRDConversion{Strategy: ConversionStrategyNone},
+			crd: &v1beta1.CustomResourceDefinition{Spec: v1beta1.CustomResourceDefinitionSpec{
+				Versions: []v1beta1.CustomResourceDefinitionVersion{{Name: "v1alpha1", Served: true}, {Name: "v1beta1", Served: true, Storage: true}},
+			}},
+			want: v1beta1.CustomResourceDefinitionSpec{
+				Versions: []v1beta1.CustomResourceDefinitionVersion{{Name: "v1alpha1", Served: true}, {Name: "v1beta1", Served: true, Storage: true}},
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			tc.conversion.Render(tc.crd)
+			if diff := cmp.Diff(tc.want, tc.crd.Spec); diff != "" {
+				t.Errorf("\nReason: %s\nRender(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestConvertCRDPreserveUnknownFields(t *testing.T) {
+	preserve := true
+	cases := map[string]struct {
+		reason string
+		in     *v1beta1.CustomResourceDefinition
+		want   []v1.CustomResourceDefinitionVersion
+	}{
+		"Preserved": {
+			reason: "The unknown fields that a v1beta1 CRD preserves should be preserved by every object of its v1 schemas",
+			in: &v1beta1.CustomResourceDefinition{Spec: v1beta1.CustomResourceDefinitionSpec{
+				Versions: []v1beta1.CustomResourceDefinitionVersion{{Name: "v1alpha1", Served: true, Storage: true}},
+				Validation: &v1beta1.CustomResourceValidation{OpenAPIV3Schema: &v1beta1.JSONSchemaProps{
+					Type: "object",
+					Properties: map[string]v1beta1.JSONSchemaProps{
+						"spec": {Type: "object", Properties: map[string]v1beta1.JSONSchemaProps{"size": {Type: "string"}}},
+					},
+				}},
+			}},
+			want: []v1.CustomResourceDefinitionVersion{{Name: "v1alpha1", Served: true, Storage: true, Schema: &v1.CustomResourceValidation{OpenAPIV3Schema: &v1.JSONSchemaProps{
+				Type:                   "object",
+				XPreserveUnknownFields: &preserve,
+				Properties: map[string]v1.JSONSchemaProps{
+					"spec": {Type: "object", XPreserveUnknownFields: &preserve, Properties: map[string]v1.JSONSchemaProps{"size": {Type: "string"}}},
+				},
+			}}}},
+		},
+		"Pruned": {
+			reason: "The schemas of a v1beta1 CRD that prunes unknown fields should be left as they are",
+			in: &v1beta1.CustomResourceDefinition{Spec: v1beta1.CustomResourceDefinitionSpec{
+				PreserveUnknownFields: func() *bool { p := false; return &p }(),
+				Versions:              []v1beta1.CustomResourceDefinitionVersion{{Name: "v1alpha1", Served: true, Storage: true}},
+				Validation:            &v1beta1.CustomResourceValidation{OpenAPIV3Schema: &v1beta1.JSONSchemaProps{Type: "object"}},
+			}},
+			want: []v1.CustomResourceDefinitionVersion{{Name: "v1alpha1", Served: true, Storage: true, Schema: &v1.CustomResourceValidation{OpenAPIV3Schema: &v1.JSONSchemaProps{Type: "object"}}}},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			out := &v1.CustomResourceDefinition{}
+			if err := ConvertCRD(tc.in, out); err != nil {
+				t.Fatalf("ConvertCRD(...): %s", err)
+			}
+			if out.Spec.PreserveUnknownFields {
+				t.Errorf("\nReason: %s\nConvertCRD(...): want spec.preserveUnknownFields false", tc.reason)
+			}
+			if diff := cmp.Diff(tc.want, out.Spec.Versions); diff != "" {
+				t.Errorf("\nReason: %s\nConvertCRD(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRequireStructuralSchemas(t *testing.T) {
+	preserve := true
+	prune := false
+	str := v1beta1.JSONSchemaProps{Type: "string"}
+	one := int64(1)
+	cases := map[string]struct {
+		reason  string
+		crd     *v1beta1.CustomResourceDefinition
+		want    v1beta1.CustomResourceDefinitionSpec
+		wantErr bool
+	}{
+		"Untyped": {
+			reason: "The root and the objects of the schemas should be typed and the unknown fields pruned",
+			crd: &v1beta1.CustomResourceDefinition{Spec: v1beta1.CustomResourceDefinitionSpec{
+				Validation: &v1beta1.CustomResourceValidation{OpenAPIV3Schema: &v1beta1.JSONSchemaProps{
+					Properties: map[string]v1beta1.JSONSchemaProps{
+						"spec":   {Properties: map[string]v1beta1.JSONSchemaProps{"size": {Type: "string"}}},
+						"status": {Type: "object", XPreserveUnknownFields: &preserve},
+					},
+				}},
+			}},
+			want: v1beta1.CustomResourceDefinitionSpec{
+				PreserveUnknownFields: &prune,
+				Validation: &v1beta1.CustomResourceValidation{OpenAPIV3Schema: &v1beta1.JSONSchemaProps{
+					Type: "object",
+					Properties: map[string]v1beta1.JSONSchemaProps{
+						"spec":   {Type: "object", Properties: map[string]v1beta1.JSONSchemaProps{"size": {Type: "string"}}},
+						"status": {Type: "object", XPreserveUnknownFields: &preserve},
+					},
+				}},
+			},
+		},
+		"TypelessLeaf": {
+			reason: "The fields without a type should preserve their unknown fields since they may be of any type",
+			crd: &v1beta1.CustomResourceDefinition{Spec: v1beta1.CustomResourceDefinitionSpec{
+				Validation: &v1beta1.CustomResourceValidation{OpenAPIV3Schema: &v1beta1.JSONSchemaProps{
+					Properties: map[string]v1beta1.JSONSchemaProps{
+						"spec": {Properties: map[string]v1beta1.JSONSchemaProps{"values": {Description: "Anything."}}},
+					},
+				}},
+			}},
+			want: v1beta1.CustomResourceDefinitionSpec{
+				PreserveUnknownFields: &prune,
+				Validation: &v1beta1.CustomResourceValidation{OpenAPIV3Schema: &v1beta1.JSONSchemaProps{
+					Type: "object",
+					Properties: map[string]v1beta1.JSONSchemaProps{
+						"spec": {Type: "object", Properties: map[string]v1beta1.JSONSchemaProps{
+							"values": {Description: "Anything.", XPreserveUnknownFields: &preserve},
+						}},
+					},
+				}},
+			},
+		},
+		"Junctors": {
+			reason: "The fields that junctors specify should be specified outside of them too and the junctors left with their value validations",
+			crd: &v1beta1.CustomResourceDefinition{Spec: v1beta1.CustomResourceDefinitionSpec{
+				Validation: &v1beta1.CustomResourceValidation{OpenAPIV3Schema: &v1beta1.JSONSchemaProps{
+					Properties: map[string]v1beta1.JSONSchemaProps{
+						"spec": {
+							Properties: map[string]v1beta1.JSONSchemaProps{"size": str},
+							AllOf: []v1beta1.JSONSchemaProps{{
+								Type:       "object",
+								Required:   []string{"region"},
+								Properties: map[string]v1beta1.JSONSchemaProps{"region": {Type: "string", Description: "The region.", MinLength: &one}},
+							}},
+						},
+					},
+				}},
+			}},
+			want: v1beta1.CustomResourceDefinitionSpec{
+				PreserveUnknownFields: &prune,
+				Validation: &v1beta1.CustomResourceValidation{OpenAPIV3Schema: &v1beta1.JSONSchemaProps{
+					Type: "object",
+					Properties: map[string]v1beta1.JSONSchemaProps{
+						"spec": {
+							Type:       "object",
+							Properties: map[string]v1beta1.JSONSchemaProps{"size": str, "region": str},
+							AllOf: []v1beta1.JSONSchemaProps{{
+								Required:   []string{"region"},
+								Properties: map[string]v1beta1.JSONSchemaProps{"region": {MinLength: &one}},
+							}},
+						},
+					},
+				}},
+			},
+		},
+		"AdditionalProperties": {
+			reason: "Maps should be typed and additionalProperties dropped where a structural schema doesn't allow them",
+			crd: &v1beta1.CustomResourceDefinition{Spec: v1beta1.CustomResourceDefinitionSpec{
+				Validation: &v1beta1.CustomResourceValidation{OpenAPIV3Schema: &v1beta1.JSONSchemaProps{
+					AdditionalProperties: &v1beta1.JSONSchemaPropsOrBool{Allows: true},
+					Properties: map[string]v1beta1.JSONSchemaProps{
+						"spec": {
+							Properties:           map[string]v1beta1.JSONSchemaProps{"size": str},
+							AdditionalProperties: &v1beta1.JSONSchemaPropsOrBool{Allows: false},
+						},
+						"labels": {AdditionalProperties: &v1beta1.JSONSchemaPropsOrBool{Allows: true, Schema: &v1beta1.JSONSchemaProps{}}},
+					},
+				}},
+			}},
+			want: v1beta1.CustomResourceDefinitionSpec{
+				PreserveUnknownFields: &prune,
+				Validation: &v1beta1.CustomResourceValidation{OpenAPIV3Schema: &v1beta1.JSONSchemaProps{
+					Type: "object",
+					Properties: map[string]v1beta1.JSONSchemaProps{
+						"spec": {Type: "object", Properties: map[string]v1beta1.JSONSchemaProps{"size": str}},
+						"labels": {Type: "object", AdditionalProperties: &v1beta1.JSONSchemaPropsOrBool{Allows: true, Schema: &v1beta1.JSONSchemaProps{
+							XPreserveUnknownFields: &preserve,
+						}}},
+					},
+				}},
+			},
+		},
+		"NotStructural": {
+			reason: "An error should be returned if the rendered schema isn't structural",
+			crd: &v1beta1.CustomResourceDefinition{Spec: v1beta1.CustomResourceDefinitionSpec{
+				Validation: &v1beta1.CustomResourceValidation{OpenAPIV3Schema: &v1beta1.JSONSchemaProps{
+					Properties: map[string]v1beta1.JSONSchemaProps{
+						"metadata": {Properties: map[string]v1beta1.JSONSchemaProps{"labels": {Type: "object"}}},
+					},
+				}},
+			}},
+			want: v1beta1.CustomResourceDefinitionSpec{
+				PreserveUnknownFields: &prune,
+				Validation: &v1beta1.CustomResourceValidation{OpenAPIV3Schema: &v1beta1.JSONSchemaProps{
+					Type: "object",
+					Properties: map[string]v1beta1.JSONSchemaProps{
+						"metadata": {Type: "object", Properties: map[string]v1beta1.JSONSchemaProps{"labels": {Type: "object"}}},
+					},
+				}},
+			},
+			wantErr: true,
+		},
+		"NoSchema": {
+			reason: "The versions without a schema should preserve all of their fields",
+			crd: &v1beta1.CustomResourceDefinition{Spec: v1beta1.CustomResourceDefinitionSpec{
+				Versions: []v1beta1.CustomResourceDefinitionVersion{{Name: "v1alpha1", Served: true, Storage: true}},
+			}},
+			want: v1beta1.CustomResourceDefinitionSpec{
+				PreserveUnknownFields: &prune,
+				Versions: []v1beta1.CustomResourceDefinitionVersion{{Name: "v1alpha1", Served: true, Storage: true,
+					Schema: &v1beta1.CustomResourceValidation{OpenAPIV3Schema: &v1beta1.JSONSchemaProps{Type: "object", XPreserveUnknownFields: &preserve}},
+				}},
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := RequireStructuralSchemas(tc.crd)
+			if diff := cmp.Diff(tc.wantErr, err != nil); diff != "" {
+				t.Errorf("\nReason: %s\nRequireStructuralSchemas(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want, tc.crd.Spec); diff != "" {
+				t.Errorf("\nReason: %s\nRequireStructuralSchemas(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestCRDApplicator(t *testing.T) {
+	errBoom := errors.New("boom")
+	desired := func(group string) *v1beta1.CustomResourceDefinition {
+		return &v1beta1.CustomResourceDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: "cool", Annotations: map[string]string{AnnotationKeySyncID: "some-id"}},
+			Spec:       v1beta1.CustomResourceDefinitionSpec{Group: group},
+		}
+	}
+	hashOf := func(crd *v1beta1.CustomResourceDefinition) string {
+		h, _ := hashCRD(crd)
+		return h
+	}
+	existing := func(hash string) test.MockGetFn {
+		return test.NewMockGetFn(nil, func(obj runtime.Object) error {
+			crd := obj.(*v1beta1.CustomResourceDefinition)
+			crd.SetName("cool")
+			crd.SetResourceVersion("42")
+			crd.SetAnnotations(map[string]string{AnnotationKeySpecHash: hash, AnnotationKeySyncID: "old-id"})
+			crd.Spec.Group = "old.example.org"
+			return nil
+		})
+	}
+	type want struct {
+		err     error
+		written bool
+		group   string
+	}
+	cases := map[string]struct {
+		reason string
+		get    test.MockGetFn
+		opts   []resource.ApplyOption
+		want   want
+	}{
+		"Create": {
+			reason: "The CRD should be created if it doesn't exist",
+			get:    test.NewMockGetFn(kerrors.NewNotFound(schema.GroupResource{}, "cool")),
+			want:   want{written: true, group: "example.org"},
+		},
+		"GetError": {
+			reason: "Errors getting the CRD should be returned",
+			get:    test.NewMockGetFn(errBoom),
+			want:   want{err: errors.Wrap(errBoom, errGetCRD), group: "example.org"},
+		},
+		"Unchanged": {
+			reason: "The CRD shouldn't be written if its hash didn't change and the object should be filled with the current one",
+			get:    existing(hashOf(desired("example.org"))),
+			want:   want{group: "old.example.org"},
+		},
+		"UnchangedNotControllable": {
+			reason: "The apply options should be run even if the hash of the CRD didn't change",
+			get: test.NewMockGetFn(nil, func(obj runtime.Object) error {
+				if err := existing(hashOf(desired("example.org")))(context.Background(), client.ObjectKey{}, obj); err != nil {
+					return err
+				}
+				controller := true
+				obj.(metav1.Object).SetOwnerReferences([]metav1.OwnerReference{{UID: "someone-else", Controller: &controller}})
+				return nil
+			}),
+			opts: []resource.ApplyOption{resource.MustBeControllableBy("cool-uid")},
+			want: want{err: errors.Errorf("existing object is not controlled by UID %q", "cool-uid"), group: "example.org"},
+		},
+		"Changed": {
+			reason: "The CRD should be updated if its hash changed",
+			get:    existing("stale"),
+			want:   want{written: true, group: "example.org"},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			written := false
+			write := func(_ context.Context, obj runtime.Object) error {
+				written = true
+				crd := obj.(*v1beta1.CustomResourceDefinition)
+				if crd.GetAnnotations()[AnnotationKeySpecHash] != hashOf(desired("example.org")) {
+					t.Errorf("\nReason: %s\nApply(...): the written CRD should have the hash of the desired one", tc.reason)
+				}
+				return nil
+			}
+			c := &test.MockClient{
+				MockGet: tc.get,
+				MockCreate: func(ctx context.Context, obj runtime.Object, _ ...client.CreateOption) error {
+					return write(ctx, obj)
+				},
+				MockUpdate: func(ctx context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+					return write(ctx, obj)
+				},
+			}
+			crd := desired("example.org")
+			err := NewCRDApplicator(c).Apply(context.Background(), crd, tc.opts...)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\nApply(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.written, written); diff != "" {
+				t.Errorf("\nReason: %s\nApply(...): -want written, +got written:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.group, crd.Spec.Group); diff != "" {
+				t.Errorf("\nReason: %s\nApply(...): -want group, +got group:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestEnsureCRD(t *testing.T) {
+	errBoom := errors.New("boom")
+	desired := &v1beta1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "claimapprovals.agent.crossplane.io"},
+		Spec: v1beta1.CustomResourceDefinitionSpec{
+			Group:   "agent.crossplane.io",
+			Version: "v1alpha1",
+			Names:   v1beta1.CustomResourceDefinitionNames{Kind: "ClaimApproval", Plural: "claimapprovals"},
+			Scope:   v1beta1.NamespaceScoped,
+		},
+	}
+	existing := func(established v1.ConditionStatus) test.MockGetFn {
+		return func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+			crd, ok := obj.(*v1.CustomResourceDefinition)
+			if !ok {
+				return errors.Errorf("want *v1.CustomResourceDefinition, got %T", obj)
+			}
+			crd.SetName("claimapprovals.agent.crossplane.io")
+			crd.SetResourceVersion("42")
+			crd.Spec.Group = "old.agent.crossplane.io"
+			crd.Status.Conditions = []v1.CustomResourceDefinitionCondition{{Type: v1.Established, Status: established}}
+			return nil
+		}
+	}
+	update := func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+		if _, ok := obj.(*v1.CustomResourceDefinition); !ok {
+			return errors.Errorf("want *v1.CustomResourceDefinition, got %T", obj)
+		}
+		return nil
+	}
+	cases := map[string]struct {
+		reason string
+		kube   client.Client
+		want   error
+	}{
+		"ApplyFailed": {
+			reason: "An error should be returned if the CRD cannot be applied",
+			kube:   &test.MockClient{MockGet: test.NewMockGetFn(errBoom)},
+			want:   errors.Wrap(errors.Wrap(errBoom, errGetCRD), errApplyCRD),
+		},
+		"NotEstablished": {
+			reason: "ErrCRDNotEstablished should be returned if the CRD isn't established in time",
+			kube:   &test.MockClient{MockGet: existing(v1.ConditionFalse), MockUpdate: update},
+			want:   ErrCRDNotEstablished,
+		},
+		"V1": {
+			reason: "The CRD should be applied and polled as a v1 CRD through the client of the v1 API",
+			kube:   &test.MockClient{MockGet: existing(v1.ConditionTrue), MockUpdate: update},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := EnsureCRD(context.Background(), CRDVersionV1.Client(tc.kube), desired.DeepCopy(), time.Millisecond)
+			if diff := cmp.Diff(tc.want, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\nEnsureCRD(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
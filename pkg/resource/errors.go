@@ -0,0 +1,253 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+)
+
+// Cluster is one of the clusters that the agent talks to.
+type Cluster string
+
+// Clusters.
+const (
+	ClusterLocal  Cluster = "Local"
+	ClusterRemote Cluster = "Remote"
+)
+
+// Error reasons. The reasons of the errors that can be attributed to a
+// cluster are suffixed with that cluster, e.g. RBACDeniedRemote.
+const (
+	ReasonNotFound        v1alpha1.ConditionReason = "NotFound"
+	ReasonConflict        v1alpha1.ConditionReason = "Conflict"
+	ReasonRBACDenied      v1alpha1.ConditionReason = "RBACDenied"
+	ReasonSchemaMismatch  v1alpha1.ConditionReason = "SchemaMismatch"
+	ReasonNetworkTimeout  v1alpha1.ConditionReason = "NetworkTimeout"
+	ReasonThrottled       v1alpha1.ConditionReason = "Throttled"
+	ReasonUnavailable     v1alpha1.ConditionReason = "Unavailable"
+	ReasonNotOwned        v1alpha1.ConditionReason = "NotOwned"
+	ReasonAdmissionDenied v1alpha1.ConditionReason = "AdmissionDenied"
+
+	ReasonCRDNotEstablished v1alpha1.ConditionReason = "CRDNotEstablished"
+)
+
+// ErrNotOwned is returned when an object that the agent would write to exists
+// but isn't owned by the object it'd be written for.
+var ErrNotOwned = errors.New("existing object is not owned by the agent")
+
+// The errors that the errors returned by the reconcilers and the other parts
+// of the agent can be compared to with errors.Is, so that the programs that
+// embed them can tell the kinds of errors apart without parsing their
+// messages. ClassifyError returns the finer grained reason of an error.
+var (
+	// ErrRemoteUnreachable matches the errors of requests to the remote
+	// cluster that timed out or couldn't be served, as opposed to the ones
+	// the remote cluster rejected.
+	ErrRemoteUnreachable = errors.New("remote cluster is unreachable")
+
+	// ErrCRDNotEstablished is returned when a CustomResourceDefinition
+	// that the agent waits for isn't established in time.
+	ErrCRDNotEstablished = errors.New("CustomResourceDefinition is not established")
+
+	// ErrConflict matches the errors of writes that conflicted with the
+	// object as it's stored in either cluster, e.g. because it was modified
+	// concurrently or already exists.
+	ErrConflict = errors.New("object conflicts with its stored version")
+)
+
+// A ClusterError is an error that is returned by a cluster the agent talks
+// to. Its message is prefixed with the name of the cluster.
+type ClusterError struct {
+	Cluster Cluster
+	err     error
+}
+
+// Error returns the message of the error prefixed with the cluster.
+func (e *ClusterError) Error() string {
+	if e.Cluster == ClusterRemote {
+		return "remote cluster: " + e.err.Error()
+	}
+	return "local cluster: " + e.err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *ClusterError) Unwrap() error { return e.err }
+
+// Cause returns the underlying error so that errors.Cause can find the API
+// error that it wraps.
+func (e *ClusterError) Cause() error { return e.err }
+
+// Is returns true if the supplied target is ErrRemoteUnreachable or
+// ErrConflict and the error is of that kind.
+func (e *ClusterError) Is(target error) bool {
+	switch target {
+	case ErrRemoteUnreachable:
+		r := classify(errors.Cause(e.err))
+		return e.Cluster == ClusterRemote && (r == ReasonNetworkTimeout || r == ReasonUnavailable)
+	case ErrConflict:
+		return classify(errors.Cause(e.err)) == ReasonConflict
+	}
+	return false
+}
+
+// LocalError wraps the supplied error with the given message and marks it as
+// returned by the local cluster. It returns nil if the error is nil.
+func LocalError(err error, message string) error {
+	if err == nil {
+		return nil
+	}
+	return &ClusterError{Cluster: ClusterLocal, err: errors.Wrap(err, message)}
+}
+
+// RemoteError wraps the supplied error with the given message and marks it as
+// returned by the remote cluster. It returns nil if the error is nil.
+func RemoteError(err error, message string) error {
+	if err == nil {
+		return nil
+	}
+	return &ClusterError{Cluster: ClusterRemote, err: errors.Wrap(err, message)}
+}
+
+// ClassifyError returns the reason that describes the supplied error, so that
+// permission issues can be told apart from connectivity issues in conditions
+// and metrics. ReasonAgentSyncError is returned if the error cannot be
+// classified.
+func ClassifyError(err error) v1alpha1.ConditionReason {
+	reason := classify(errors.Cause(err))
+	if reason == ReasonAgentSyncError {
+		return reason
+	}
+	ce := &ClusterError{}
+	if errors.As(err, &ce) {
+		return reason + v1alpha1.ConditionReason(ce.Cluster)
+	}
+	return reason
+}
+
+func classify(err error) v1alpha1.ConditionReason { // nolint:gocyclo
+	var nerr net.Error
+	switch {
+	case err == nil:
+		return ReasonAgentSyncError
+	case err == ErrNotOwned:
+		return ReasonNotOwned
+	case err == ErrCRDNotEstablished:
+		return ReasonCRDNotEstablished
+	case kerrors.IsNotFound(err):
+		return ReasonNotFound
+	case kerrors.IsConflict(err), kerrors.IsAlreadyExists(err):
+		return ReasonConflict
+	case AdmissionDenied(err) != nil:
+		return ReasonAdmissionDenied
+	case kerrors.IsForbidden(err), kerrors.IsUnauthorized(err):
+		return ReasonRBACDenied
+	case kerrors.IsInvalid(err), kerrors.IsBadRequest(err), meta.IsNoMatchError(err):
+		return ReasonSchemaMismatch
+	case kerrors.IsTooManyRequests(err):
+		return ReasonThrottled
+	case kerrors.IsTimeout(err), kerrors.IsServerTimeout(err), errors.Is(err, context.DeadlineExceeded):
+		return ReasonNetworkTimeout
+	case errors.As(err, &nerr) && nerr.Timeout():
+		return ReasonNetworkTimeout
+	case kerrors.IsServiceUnavailable(err), kerrors.IsInternalError(err), errors.As(err, &nerr):
+		return ReasonUnavailable
+	}
+	return ReasonAgentSyncError
+}
+
+// A FieldConflict is a field of an object that's owned by another field
+// manager, as reported by server-side apply.
+type FieldConflict struct {
+	Manager string
+	Field   string
+}
+
+// FieldConflicts returns the field conflicts that the supplied error reports,
+// or nil if it's not a server-side apply conflict.
+func FieldConflicts(err error) []FieldConflict {
+	s, ok := errors.Cause(err).(kerrors.APIStatus)
+	if !ok || !kerrors.IsConflict(errors.Cause(err)) || s.Status().Details == nil {
+		return nil
+	}
+	var out []FieldConflict
+	for _, c := range s.Status().Details.Causes {
+		if c.Type != metav1.CauseTypeFieldManagerConflict {
+			continue
+		}
+		out = append(out, FieldConflict{Manager: conflictingManager(c.Message), Field: c.Field})
+	}
+	return out
+}
+
+// An AdmissionDenial is the rejection of a request by an admission webhook.
+type AdmissionDenial struct {
+	// Webhook is the name of the webhook that denied the request.
+	Webhook string
+
+	// Message is the reason of the denial as the webhook returned it. It's
+	// empty if the webhook didn't give one.
+	Message string
+}
+
+const (
+	admissionWebhookPrefix = `admission webhook "`
+	admissionDeniedInfix   = `" denied the request`
+)
+
+// AdmissionDenied returns the denial of an admission webhook that the supplied
+// error reports, or nil if the request wasn't denied by a webhook. The API
+// server reports the denials in messages of the form admission webhook
+// "name" denied the request: message.
+func AdmissionDenied(err error) *AdmissionDenial {
+	s, ok := errors.Cause(err).(kerrors.APIStatus)
+	if !ok {
+		return nil
+	}
+	msg := s.Status().Message
+	i := strings.Index(msg, admissionWebhookPrefix)
+	if i < 0 {
+		return nil
+	}
+	parts := strings.SplitN(msg[i+len(admissionWebhookPrefix):], admissionDeniedInfix, 2)
+	if len(parts) != 2 {
+		return nil
+	}
+	d := &AdmissionDenial{Webhook: parts[0]}
+	if strings.HasPrefix(parts[1], ": ") {
+		d.Message = parts[1][2:]
+	}
+	return d
+}
+
+// conflictingManager extracts the manager from conflict messages of the form
+// conflict with "manager" [using apiVersion].
+func conflictingManager(msg string) string {
+	parts := strings.SplitN(msg, `"`, 3)
+	if len(parts) < 3 {
+		return msg
+	}
+	return parts[1]
+}
@@ -0,0 +1,234 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+)
+
+func TestClassifyError(t *testing.T) {
+	gr := schema.GroupResource{Group: "example.org", Resource: "databases"}
+	cases := map[string]struct {
+		reason string
+		err    error
+		want   v1alpha1.ConditionReason
+	}{
+		"Unknown": {
+			reason: "Errors that cannot be classified should have the generic reason",
+			err:    RemoteError(errors.New("boom"), "cannot get claim"),
+			want:   ReasonAgentSyncError,
+		},
+		"NotFoundRemote": {
+			reason: "The reason should be suffixed with the cluster the error is returned by",
+			err:    RemoteError(kerrors.NewNotFound(gr, "db"), "cannot get claim"),
+			want:   ReasonNotFound + "Remote",
+		},
+		"ConflictLocal": {
+			reason: "Wrapped errors should be classified by their cause",
+			err:    errors.Wrap(LocalError(kerrors.NewConflict(gr, "db", errors.New("boom")), "cannot update claim"), "cannot run pull propagator"),
+			want:   ReasonConflict + "Local",
+		},
+		"NotOwnedLocal": {
+			reason: "Objects that aren't owned by the agent should be reported as such",
+			err:    LocalError(ErrNotOwned, "cannot apply secret"),
+			want:   ReasonNotOwned + "Local",
+		},
+		"CRDNotEstablished": {
+			reason: "CRDs that aren't established should be reported as such",
+			err:    ErrCRDNotEstablished,
+			want:   ReasonCRDNotEstablished,
+		},
+		"RBACDenied": {
+			reason: "Errors that are not attributed to a cluster should not have a suffix",
+			err:    kerrors.NewForbidden(gr, "db", errors.New("boom")),
+			want:   ReasonRBACDenied,
+		},
+		"SchemaMismatch": {
+			reason: "Invalid objects should be reported as schema mismatches",
+			err:    RemoteError(kerrors.NewInvalid(schema.GroupKind{Group: "example.org", Kind: "Database"}, "db", nil), "cannot apply claim"),
+			want:   ReasonSchemaMismatch + "Remote",
+		},
+		"AdmissionDeniedRemote": {
+			reason: "Denials of admission webhooks should not be reported as RBAC denials",
+			err:    RemoteError(admissionDenial(`admission webhook "validate.example.org" denied the request: size must be small`), "cannot apply claim"),
+			want:   ReasonAdmissionDenied + "Remote",
+		},
+		"NetworkTimeout": {
+			reason: "Deadlines should be reported as network timeouts",
+			err:    RemoteError(context.DeadlineExceeded, "cannot get claim"),
+			want:   ReasonNetworkTimeout + "Remote",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, ClassifyError(tc.err)); diff != "" {
+				t.Errorf("\nReason: %s\nClassifyError(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestErrorsIs(t *testing.T) {
+	gr := schema.GroupResource{Group: "example.org", Resource: "databases"}
+	cases := map[string]struct {
+		reason string
+		err    error
+		target error
+		want   bool
+	}{
+		"RemoteUnreachable": {
+			reason: "Timeouts of requests to the remote cluster should match ErrRemoteUnreachable",
+			err:    errors.Wrap(RemoteError(context.DeadlineExceeded, "cannot get claim"), "cannot sync claim"),
+			target: ErrRemoteUnreachable,
+			want:   true,
+		},
+		"RemoteServiceUnavailable": {
+			reason: "Requests that the remote cluster couldn't serve should match ErrRemoteUnreachable",
+			err:    RemoteError(kerrors.NewServiceUnavailable("boom"), "cannot apply claim"),
+			target: ErrRemoteUnreachable,
+			want:   true,
+		},
+		"LocalUnreachable": {
+			reason: "Timeouts of requests to the local cluster should not match ErrRemoteUnreachable",
+			err:    LocalError(context.DeadlineExceeded, "cannot get claim"),
+			target: ErrRemoteUnreachable,
+		},
+		"RemoteRejected": {
+			reason: "Requests that the remote cluster rejected should not match ErrRemoteUnreachable",
+			err:    RemoteError(kerrors.NewForbidden(gr, "db", errors.New("boom")), "cannot apply claim"),
+			target: ErrRemoteUnreachable,
+		},
+		"Conflict": {
+			reason: "Conflicts in either cluster should match ErrConflict",
+			err:    LocalError(kerrors.NewConflict(gr, "db", errors.New("boom")), "cannot update claim"),
+			target: ErrConflict,
+			want:   true,
+		},
+		"AlreadyExists": {
+			reason: "Objects that already exist should match ErrConflict",
+			err:    RemoteError(kerrors.NewAlreadyExists(gr, "db"), "cannot create claim"),
+			target: ErrConflict,
+			want:   true,
+		},
+		"CRDNotEstablished": {
+			reason: "Wrapped sentinels should match themselves",
+			err:    LocalError(ErrCRDNotEstablished, "cannot wait for CRD"),
+			target: ErrCRDNotEstablished,
+			want:   true,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, errors.Is(tc.err, tc.target)); diff != "" {
+				t.Errorf("\nReason: %s\nerrors.Is(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func admissionDenial(msg string) error {
+	return &kerrors.StatusError{ErrStatus: metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    403,
+		Reason:  metav1.StatusReasonForbidden,
+		Message: msg,
+	}}
+}
+
+func TestAdmissionDenied(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		err    error
+		want   *AdmissionDenial
+	}{
+		"NotAPIError": {
+			reason: "Errors that aren't returned by an API server should not be denials",
+			err:    RemoteError(errors.New(`admission webhook "validate.example.org" denied the request: boom`), "cannot apply claim"),
+		},
+		"Forbidden": {
+			reason: "RBAC denials should not be admission denials",
+			err:    kerrors.NewForbidden(schema.GroupResource{}, "db", errors.New("boom")),
+		},
+		"Denied": {
+			reason: "The webhook and its message should be returned verbatim",
+			err:    RemoteError(errors.Wrap(admissionDenial(`admission webhook "validate.example.org" denied the request: spec.size: "large" is not allowed: use one of small, medium`), "cannot patch object"), "cannot apply claim"),
+			want:   &AdmissionDenial{Webhook: "validate.example.org", Message: `spec.size: "large" is not allowed: use one of small, medium`},
+		},
+		"WithoutExplanation": {
+			reason: "The message should be empty if the webhook didn't give one",
+			err:    admissionDenial(`admission webhook "validate.example.org" denied the request without explanation`),
+			want:   &AdmissionDenial{Webhook: "validate.example.org"},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, AdmissionDenied(tc.err)); diff != "" {
+				t.Errorf("\nReason: %s\nAdmissionDenied(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestFieldConflicts(t *testing.T) {
+	conflict := func(causes ...metav1.StatusCause) error {
+		return &kerrors.StatusError{ErrStatus: metav1.Status{
+			Reason:  metav1.StatusReasonConflict,
+			Details: &metav1.StatusDetails{Causes: causes},
+		}}
+	}
+	cases := map[string]struct {
+		reason string
+		err    error
+		want   []FieldConflict
+	}{
+		"NotConflict": {
+			reason: "Errors other than conflicts should have no field conflicts",
+			err:    RemoteError(errors.New("boom"), "cannot apply claim"),
+		},
+		"ResourceVersionConflict": {
+			reason: "Conflicts that aren't about field managers should have no field conflicts",
+			err:    RemoteError(kerrors.NewConflict(schema.GroupResource{}, "db", errors.New("boom")), "cannot apply claim"),
+		},
+		"FieldManagerConflicts": {
+			reason: "The conflicting managers and fields should be returned",
+			err: RemoteError(errors.Wrap(conflict(
+				metav1.StatusCause{Type: metav1.CauseTypeFieldManagerConflict, Message: `conflict with "policy-controller" using example.org/v1alpha1`, Field: ".spec.size"},
+				metav1.StatusCause{Type: metav1.CauseTypeFieldManagerConflict, Message: `conflict with "kubectl"`, Field: ".spec.region"},
+			), "cannot patch object"), "cannot apply claim"),
+			want: []FieldConflict{
+				{Manager: "policy-controller", Field: ".spec.size"},
+				{Manager: "kubectl", Field: ".spec.region"},
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, FieldConflicts(tc.err)); diff != "" {
+				t.Errorf("\nReason: %s\nFieldConflicts(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
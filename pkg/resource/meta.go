@@ -17,25 +17,314 @@ limitations under the License.
 package resource
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/uuid"
 
 	"github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/meta"
 	"github.com/crossplane/crossplane-runtime/pkg/resource"
 )
 
+// AnnotationKeySyncID is the key of the annotation that holds the ID of the
+// last sync operation that wrote the object.
+const AnnotationKeySyncID = "agent.crossplane.io/sync-id"
+
+// AnnotationKeyIgnoreFields is the key of the annotation of a
+// CompositeResourceDefinition that holds the comma-separated field paths of
+// its claims that the agent leaves untouched on the remote claims once they
+// exist, e.g. spec.parameters.size when it's overridden by a central policy.
+const AnnotationKeyIgnoreFields = "agent.crossplane.io/ignore-fields"
+
+// LabelKeyOwnerUID is the key of the label that holds the UID of the object
+// that owns an object written by the agent.
+const LabelKeyOwnerUID = "agent.crossplane.io/owner-uid"
+
+// LabelKeyCluster is the key of the label that holds the name of the cluster
+// that an object in the remote cluster is created for, e.g. the claims of the
+// cluster and the objects created during its registration.
+const LabelKeyCluster = "agent.crossplane.io/cluster"
+
+// LabelKeyOwnerNamespace and LabelKeyOwnerName are the keys of the labels
+// that hold the namespace and the name of the claim that owns a connection
+// secret in a different namespace, which cannot have an owner reference to it.
+// Their values are made with LabelValue, since names can be longer than label
+// values.
+const (
+	LabelKeyOwnerNamespace = "agent.crossplane.io/owner-namespace"
+	LabelKeyOwnerName      = "agent.crossplane.io/owner-name"
+)
+
+// AnnotationKeyConnectionSecretNamespace is the key of the annotation of a
+// local claim that holds the namespace its connection secret is written to,
+// e.g. a shared secrets namespace, instead of the namespace of the claim.
+const AnnotationKeyConnectionSecretNamespace = "agent.crossplane.io/connection-secret-namespace"
+
+// AnnotationKeyPrefixConnectionKey is the prefix of the annotations of a claim
+// that add keys to its local connection secret. The rest of the annotation key
+// is the key in the secret and its value is a Go template that is rendered
+// with the connection details in the remote secret, e.g.
+// connection.agent.crossplane.io/dsn: "postgres://{{ .username }}@{{ .host }}"
+const AnnotationKeyPrefixConnectionKey = "connection.agent.crossplane.io/"
+
+// AnnotationKeyStatusConfigMap is the key of the annotation of a local claim
+// that holds the comma-separated status fields of its remote counterpart that
+// are projected into a ConfigMap next to its connection secret, e.g.
+// "endpoint,port,version", for the applications that cannot read claims.
+const AnnotationKeyStatusConfigMap = "agent.crossplane.io/status-configmap"
+
+// AnnotationKeyDryRun is the key of the annotation of a local claim that makes
+// the agent validate its remote counterpart against the remote cluster with a
+// server-side dry-run rather than create or update it, when it's "true".
+const AnnotationKeyDryRun = "agent.crossplane.io/dry-run"
+
+// AnnotationKeyCancelDeletion is the key of the annotation that cancels the
+// deletion of the remote counterpart of a deleted claim while its deletion
+// grace period is running. The remote claim is kept and can be taken over by
+// recreating the local claim.
+const AnnotationKeyCancelDeletion = "agent.crossplane.io/cancel-deletion"
+
+// AnnotationKeyDeletionRequested is the key of the annotation of a local claim
+// that records when the deletion of its remote counterpart was requested, so
+// that the deletion can be completed after a restart.
+const AnnotationKeyDeletionRequested = "agent.crossplane.io/deletion-requested"
+
+// AnnotationKeyClaimTemplate is the key of the annotation of a local claim
+// that names the claim template its spec is filled in from.
+const AnnotationKeyClaimTemplate = "agent.crossplane.io/claim-template"
+
+// AnnotationKeyTransferTo is the key of the annotation of a local claim that
+// transfers the ownership of its remote counterpart to a new local claim with
+// the namespace/name in its value. The local claim is replaced by the new one
+// without deleting the remote claim.
+const AnnotationKeyTransferTo = "agent.crossplane.io/transfer-to"
+
+// AnnotationKeyRemoteClaim is the key of the annotation of a local claim that
+// records the namespace/name of its remote counterpart when it's not the one
+// the local claim maps to, e.g. because its ownership was transferred from
+// another local claim.
+const AnnotationKeyRemoteClaim = "agent.crossplane.io/remote-claim"
+
+// AnnotationKeySyncedGeneration is the key of the annotation that records the
+// generation of a local claim that was last written to its remote counterpart.
+// It's stamped on the remote claim with every write and recorded on the local
+// claim along with AnnotationKeyRemoteUID and AnnotationKeyLastSyncedTime, so
+// that a remote claim restored from a backup, whose stamp is older than the
+// record, is noticed. Removing it from the local claim makes the agent
+// overwrite the remote claim with the local one.
+const AnnotationKeySyncedGeneration = "agent.crossplane.io/synced-generation"
+
+// AnnotationKeyRemoteUID is the key of the annotation of a local claim that
+// records the UID of the remote claim it was last written to.
+const AnnotationKeyRemoteUID = "agent.crossplane.io/remote-uid"
+
+// AnnotationKeyRequestedBy is the key of the annotation that records who
+// requested a claim. It's stamped on the remote claim by the agent so that the
+// requests can be attributed in the remote cluster, and never copied from the
+// local claim.
+const AnnotationKeyRequestedBy = "agent.crossplane.io/requested-by"
+
+// AnnotationKeyPendingRemoval is the key of the annotation of a synced object
+// in the local cluster that records when the object was found to be gone from
+// the remote cluster. The object is deleted only if it's still gone once the
+// removal delay passes.
+const AnnotationKeyPendingRemoval = "agent.crossplane.io/pending-removal"
+
+// AnnotationKeyClaimCRDMissing is the key of the annotation of a
+// CompositeResourceDefinition in the local cluster that records when its claim
+// CRD was found to be gone from the remote cluster while it still offers
+// claims. The claims are withdrawn only if the CRD is still gone once the
+// withdrawal delay passes.
+const AnnotationKeyClaimCRDMissing = "agent.crossplane.io/claim-crd-missing"
+
+// AnnotationKeyAllowMassRemoval is the key of the annotation of a synced CRD
+// in the local cluster that lets the agent delete more of its objects at once
+// than the deletion circuit breaker allows when it's "true".
+const AnnotationKeyAllowMassRemoval = "agent.crossplane.io/allow-mass-removal"
+
+// The keys of the annotations of the synced objects in the local cluster that
+// tell where they're synced from and how fresh they are.
+const (
+	AnnotationKeySyncedFromCluster     = "agent.crossplane.io/synced-from-cluster"
+	AnnotationKeySourceResourceVersion = "agent.crossplane.io/source-resource-version"
+	AnnotationKeyLastSyncedTime        = "agent.crossplane.io/last-synced-time"
+)
+
+// AnnotationKeySyncedLocalHash is the key of the annotation of a synced object
+// in the local cluster that records the hash of its content right after the
+// agent last wrote it, so that the changes made to it in the local cluster
+// since then are noticed. Removing it makes the agent overwrite the local
+// object with the remote one.
+const AnnotationKeySyncedLocalHash = "agent.crossplane.io/synced-local-hash"
+
+// AnnotationKeySyncConflict is the key of the annotation of a synced object in
+// the local cluster that tells why it isn't synced when both it and its remote
+// counterpart changed since it was last synced.
+const AnnotationKeySyncConflict = "agent.crossplane.io/sync-conflict"
+
+// AnnotationKeyCompositionUpdatePolicy and AnnotationKeyCompositionRevision
+// are the keys of the annotations of a local claim that set the
+// compositionUpdatePolicy and the compositionRevisionRef of its remote
+// counterpart, so that the revision of the composition the remote claim uses
+// can be pinned from the local cluster.
+const (
+	AnnotationKeyCompositionUpdatePolicy = "agent.crossplane.io/composition-update-policy"
+	AnnotationKeyCompositionRevision     = "agent.crossplane.io/composition-revision"
+)
+
+// The composition update policies a remote claim can have.
+const (
+	CompositionUpdatePolicyAutomatic = "Automatic"
+	CompositionUpdatePolicyManual    = "Manual"
+)
+
+// AnnotationKeyDefaultComposition is the key of the annotation of a claim CRD
+// in the local cluster that records the name of the default Composition of
+// its CompositeResourceDefinition, so that the claims that neither reference
+// nor select a Composition can be defaulted to it.
+const AnnotationKeyDefaultComposition = "agent.crossplane.io/default-composition"
+
+// AnnotationKeySpecHash is the key of the annotation of a CustomResourceDefinition
+// or a synced object in the local cluster that holds the hash of what the
+// agent wrote last time, so that it's written again only when it changes.
+// Removing the annotation makes the agent write it in the next sync.
+const AnnotationKeySpecHash = "agent.crossplane.io/spec-hash"
+
+// ClaimTemplateKey is the key of the ConfigMap of a claim template that holds
+// the partial claim spec in YAML.
+const ClaimTemplateKey = "spec"
+
+type syncIDKey struct{}
+
 // Condition constants.
 const (
-	TypeAgentSync v1alpha1.ConditionType = "AgentSynced"
+	TypeAgentSync                v1alpha1.ConditionType = "AgentSynced"
+	TypePartialConnectionDetails v1alpha1.ConditionType = "PartialConnectionDetails"
+	TypeConnectionSecretSynced   v1alpha1.ConditionType = "ConnectionSecretSynced"
+	TypeFieldConflict            v1alpha1.ConditionType = "FieldConflict"
+	TypeSchemaDrift              v1alpha1.ConditionType = "SchemaDrift"
+	TypeRemoteAdmissionDenied    v1alpha1.ConditionType = "RemoteAdmissionDenied"
+	TypeSLAExceeded              v1alpha1.ConditionType = "SLAExceeded"
+	TypeDryRun                   v1alpha1.ConditionType = "DryRun"
+	TypeInitialSync              v1alpha1.ConditionType = "InitialSynced"
 
-	ReasonAgentSyncSuccess v1alpha1.ConditionReason = "Success"
-	ReasonAgentSyncError   v1alpha1.ConditionReason = "Error"
+	ReasonAgentSyncSuccess   v1alpha1.ConditionReason = "Success"
+	ReasonAgentSyncError     v1alpha1.ConditionReason = "Error"
+	ReasonEmergencyStop      v1alpha1.ConditionReason = "EmergencyStop"
+	ReasonMaintenance        v1alpha1.ConditionReason = "Maintenance"
+	ReasonDeletionPending    v1alpha1.ConditionReason = "DeletionPending"
+	ReasonMissingKeys        v1alpha1.ConditionReason = "MissingKeys"
+	ReasonAllKeysPresent     v1alpha1.ConditionReason = "AllKeysPresent"
+	ReasonSecretsDisabled    v1alpha1.ConditionReason = "Disabled"
+	ReasonConflictingOwner   v1alpha1.ConditionReason = "ConflictingManagers"
+	ReasonNoConflicts        v1alpha1.ConditionReason = "NoConflicts"
+	ReasonLocalCrossplane    v1alpha1.ConditionReason = "LocalCrossplane"
+	ReasonSchemaDiverged     v1alpha1.ConditionReason = "Diverged"
+	ReasonSchemaInSync       v1alpha1.ConditionReason = "InSync"
+	ReasonClaimsWithdrawn    v1alpha1.ConditionReason = "Withdrawn"
+	ReasonResyncRequired     v1alpha1.ConditionReason = "ResyncRequired"
+	ReasonDeniedByWebhook    v1alpha1.ConditionReason = "DeniedByWebhook"
+	ReasonAdmitted           v1alpha1.ConditionReason = "Admitted"
+	ReasonNotReadyInTime     v1alpha1.ConditionReason = "NotReadyInTime"
+	ReasonReadyLate          v1alpha1.ConditionReason = "ReadyLate"
+	ReasonReadyInTime        v1alpha1.ConditionReason = "ReadyInTime"
+	ReasonBlockedByInstances v1alpha1.ConditionReason = "BlockedByInstances"
+	ReasonCascadeScheduled   v1alpha1.ConditionReason = "CascadeScheduled"
+	ReasonDryRunAccepted     v1alpha1.ConditionReason = "Accepted"
+	ReasonDryRunRejected     v1alpha1.ConditionReason = "Rejected"
+	ReasonPendingApproval    v1alpha1.ConditionReason = "PendingApproval"
+	ReasonSyncTimedOut       v1alpha1.ConditionReason = "TimedOut"
 )
 
+// maxLabelValueLength is the length limit of label values.
+const maxLabelValueLength = 63
+
+// LabelValue returns the supplied string as a label value. The strings that
+// are longer than label values may be, e.g. the names of objects, are
+// truncated and suffixed with a hash of the whole string so that they stay
+// unique.
+func LabelValue(s string) string {
+	if len(s) <= maxLabelValueLength {
+		return s
+	}
+	sum := sha256.Sum256([]byte(s))
+	h := hex.EncodeToString(sum[:])[:8]
+	return strings.TrimRight(s[:maxLabelValueLength-len(h)-1], "-_.") + "-" + h
+}
+
+// GetIgnoredFields returns the field paths in the AnnotationKeyIgnoreFields
+// annotation of the supplied object.
+func GetIgnoredFields(o metav1.Object) []string {
+	var paths []string
+	for _, p := range strings.Split(o.GetAnnotations()[AnnotationKeyIgnoreFields], ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// DefaultPreservedAnnotations are the annotations that GitOps tools like Argo CD
+// and Flux manage on the objects they apply, and that mean nothing, or worse,
+// make those tools think they own the object, in the other cluster.
+var DefaultPreservedAnnotations = PreservedAnnotations{
+	"kubectl.kubernetes.io/last-applied-configuration",
+	"argocd.argoproj.io/",
+	"fluxcd.io/",
+	"kustomize.toolkit.fluxcd.io/",
+	"helm.toolkit.fluxcd.io/",
+	"meta.helm.sh/",
+}
+
+// PreservedAnnotations are the annotations that belong to the cluster they're
+// set in and are neither propagated to nor overridden by the other cluster.
+// Entries that end with a slash match all the keys with that prefix.
+type PreservedAnnotations []string
+
+// Matches returns true if the supplied annotation key is preserved.
+func (p PreservedAnnotations) Matches(key string) bool {
+	for _, k := range p {
+		if k == key || (strings.HasSuffix(k, "/") && strings.HasPrefix(key, k)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Strip removes the preserved annotations from the supplied object so that
+// they're left untouched when it's patched in the other cluster.
+func (p PreservedAnnotations) Strip(o metav1.Object) {
+	if len(p) == 0 {
+		return
+	}
+	var keys []string
+	for k := range o.GetAnnotations() {
+		if p.Matches(k) {
+			keys = append(keys, k)
+		}
+	}
+	meta.RemoveAnnotations(o, keys...)
+}
+
 // SanitizedDeepCopyObject removes the metadata that can be specific to a cluster.
 // For example, owner references are references to resources in that cluster and
-// would be meaningless in another one.
+// would be meaningless in another one. The owners of the remote objects, e.g.
+// the Configuration packages of Compositions, are never carried over, so the
+// local objects are only owned by what the agent adds, see
+// KeepOwnerReferences.
 func SanitizedDeepCopyObject(in runtime.Object) resource.Object {
 	out, _ := in.DeepCopyObject().(resource.Object)
 	out.SetResourceVersion("")
@@ -48,6 +337,42 @@ func SanitizedDeepCopyObject(in runtime.Object) resource.Object {
 	return out
 }
 
+// KeepOwnerReferences returns an ApplyOption that keeps the owner references
+// that the current object has in addition to the ones of the desired object.
+// Patches replace the owner references as a whole, so the owners added in the
+// local cluster would otherwise be dropped once the desired object has one.
+// The references to an owner of the desired object that has a different UID,
+// i.e. to an owner that was recreated since, are dropped.
+func KeepOwnerReferences() resource.ApplyOption {
+	return func(_ context.Context, current, desired runtime.Object) error {
+		c, ok := current.(metav1.Object)
+		if !ok {
+			return nil
+		}
+		d, ok := desired.(metav1.Object)
+		if !ok || len(d.GetOwnerReferences()) == 0 {
+			return nil
+		}
+		for _, ref := range c.GetOwnerReferences() {
+			if !recreatedOwner(d.GetOwnerReferences(), ref) {
+				meta.AddOwnerReference(d, ref)
+			}
+		}
+		return nil
+	}
+}
+
+// recreatedOwner returns whether the supplied reference is to one of the
+// supplied owners but with a different UID.
+func recreatedOwner(owners []metav1.OwnerReference, ref metav1.OwnerReference) bool {
+	for _, o := range owners {
+		if o.APIVersion == ref.APIVersion && o.Kind == ref.Kind && o.Name == ref.Name && o.UID != ref.UID {
+			return true
+		}
+	}
+	return false
+}
+
 // AgentSyncSuccess returns a condition indicating that Agent successfully
 // synced with the remote cluster.
 func AgentSyncSuccess() v1alpha1.Condition {
@@ -60,13 +385,481 @@ func AgentSyncSuccess() v1alpha1.Condition {
 }
 
 // AgentSyncError returns a condition indicating that Agent encountered an
-// error while syncing the resource.
+// error while syncing the resource. Its reason classifies the error, see
+// ClassifyError.
 func AgentSyncError(err error) v1alpha1.Condition {
 	return v1alpha1.Condition{
 		Type:               TypeAgentSync,
 		Status:             corev1.ConditionFalse,
 		LastTransitionTime: metav1.Now(),
-		Reason:             ReasonAgentSyncError,
+		Reason:             ClassifyError(err),
 		Message:            err.Error(),
 	}
 }
+
+// CRDNotEstablished returns a condition indicating that the objects of the
+// supplied CustomResourceDefinition aren't synced until the API server
+// establishes it.
+func CRDNotEstablished(crd string) v1alpha1.Condition {
+	return v1alpha1.Condition{
+		Type:               v1alpha1.TypeSynced,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonCRDNotEstablished,
+		Message:            fmt.Sprintf("Waiting for the CustomResourceDefinition %s to be established", crd),
+	}
+}
+
+// AgentSyncHalted returns a condition indicating that Agent doesn't write to
+// the remote cluster because the emergency stop is engaged.
+func AgentSyncHalted() v1alpha1.Condition {
+	return v1alpha1.Condition{
+		Type:               TypeAgentSync,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonEmergencyStop,
+		Message:            "Writes to the remote cluster are halted by the emergency stop",
+	}
+}
+
+// AgentSyncFrozen returns a condition indicating that Agent doesn't create or
+// update the remote counterpart of the claim because the local cluster is
+// under maintenance.
+func AgentSyncFrozen() v1alpha1.Condition {
+	return v1alpha1.Condition{
+		Type:               TypeAgentSync,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonMaintenance,
+		Message:            "The remote claim is not created or updated while the local cluster is under maintenance",
+	}
+}
+
+// AgentSyncResyncRequired returns a condition indicating that Agent doesn't
+// sync the claim because its remote counterpart is older than the one it was
+// last synced to, for the supplied reason, e.g. because the remote cluster was
+// restored from a backup.
+func AgentSyncResyncRequired(reason string) v1alpha1.Condition {
+	return v1alpha1.Condition{
+		Type:               TypeAgentSync,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonResyncRequired,
+		Message:            fmt.Sprintf("%s, remove the %s annotation of the claim to overwrite the remote claim with it", reason, AnnotationKeySyncedGeneration),
+	}
+}
+
+// OfferedByLocalCrossplane returns a condition indicating that Agent doesn't
+// sync the claims of a CompositeResourceDefinition because a Crossplane in the
+// same cluster offers them.
+func OfferedByLocalCrossplane() v1alpha1.Condition {
+	return v1alpha1.Condition{
+		Type:               TypeAgentSync,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonLocalCrossplane,
+		Message:            "The claims are offered by a Crossplane that runs in this cluster, so they are not synced to the remote cluster to avoid reconciling them twice",
+	}
+}
+
+// ClaimsWithdrawn returns a condition indicating that Agent doesn't sync the
+// claims of a CompositeResourceDefinition because the remote cluster doesn't
+// offer them.
+func ClaimsWithdrawn() v1alpha1.Condition {
+	return v1alpha1.Condition{
+		Type:               TypeAgentSync,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonClaimsWithdrawn,
+		Message:            "The claims are not offered by the remote cluster, so they are not synced until they are offered again",
+	}
+}
+
+// BlockedByInstances returns a condition indicating that the claim CRD of a
+// deleted CompositeResourceDefinition isn't deleted because the supplied number
+// of claims of its kind still exist.
+func BlockedByInstances(claims int) v1alpha1.Condition {
+	return v1alpha1.Condition{
+		Type:               TypeAgentSync,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonBlockedByInstances,
+		Message:            fmt.Sprintf("The custom resource definition is not deleted until the %d claims of its kind are deleted", claims),
+	}
+}
+
+// CascadeScheduled returns a condition indicating that the supplied number of
+// claims of a deleted CompositeResourceDefinition are deleted along with its
+// claim CRD at the supplied time.
+func CascadeScheduled(claims int, at time.Time) v1alpha1.Condition {
+	return v1alpha1.Condition{
+		Type:               TypeAgentSync,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonCascadeScheduled,
+		Message:            fmt.Sprintf("The %d claims of the custom resource definition are deleted along with it at %s", claims, at.UTC().Format(time.RFC3339)),
+	}
+}
+
+// AgentSyncNotOwned returns a condition indicating that Agent doesn't sync
+// the claim because its remote counterpart isn't the claim's to sync, for the
+// supplied reason, e.g. because another claim syncs it.
+func AgentSyncNotOwned(reason string) v1alpha1.Condition {
+	return v1alpha1.Condition{
+		Type:               TypeAgentSync,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonConflict,
+		Message:            fmt.Sprintf("The remote claim is not synced: %s", reason),
+	}
+}
+
+// AgentSyncDeletionPending returns a condition indicating that Agent waits
+// for the deletion grace period to pass before it deletes the remote claim.
+func AgentSyncDeletionPending(deadline time.Time, remaining time.Duration) v1alpha1.Condition {
+	return v1alpha1.Condition{
+		Type:               TypeAgentSync,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonDeletionPending,
+		Message: fmt.Sprintf("The remote claim will be deleted in %s, at %s. Annotate the claim with %s: \"true\" to keep the remote claim instead",
+			remaining.Round(time.Second), deadline.UTC().Format(time.RFC3339), AnnotationKeyCancelDeletion),
+	}
+}
+
+// ConnectionSecretNotSynced returns a condition indicating that connection
+// secrets are not synced to this cluster, and where the connection secret of
+// the claim is in the remote cluster instead.
+func ConnectionSecretNotSynced(remote types.NamespacedName) v1alpha1.Condition {
+	return v1alpha1.Condition{
+		Type:               TypeConnectionSecretSynced,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonSecretsDisabled,
+		Message:            fmt.Sprintf("Connection secrets are not synced to this cluster. The connection secret of this claim is %s in namespace %s of the remote cluster", remote.Name, remote.Namespace),
+	}
+}
+
+// ConnectionSecretSyncSuccess returns a condition indicating that the
+// connection secret of the claim is synced to this cluster.
+func ConnectionSecretSyncSuccess() v1alpha1.Condition {
+	return v1alpha1.Condition{
+		Type:               TypeConnectionSecretSynced,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonAgentSyncSuccess,
+	}
+}
+
+// ConnectionSecretSyncError returns a condition indicating that the connection
+// secret of the claim cannot be synced to this cluster. Its reason classifies
+// the error, see ClassifyError.
+func ConnectionSecretSyncError(err error) v1alpha1.Condition {
+	return v1alpha1.Condition{
+		Type:               TypeConnectionSecretSynced,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ClassifyError(err),
+		Message:            err.Error(),
+	}
+}
+
+// RemoteDeleting returns a condition indicating that the remote claim is being
+// deleted since the supplied time. The number of composed resources that are
+// left is included if the total is known.
+func RemoteDeleting(since time.Time, total, remaining int) v1alpha1.Condition {
+	msg := fmt.Sprintf("The remote claim is being deleted since %s", since.UTC().Format(time.RFC3339))
+	if total > 0 {
+		msg += fmt.Sprintf(", %d of %d composed resources are left", remaining, total)
+	}
+	return v1alpha1.Deleting().WithMessage(msg)
+}
+
+// ConflictingFields returns a condition indicating that the remote claim cannot
+// be applied because some of its fields are owned by other field managers in
+// the remote cluster.
+func ConflictingFields(c []FieldConflict) v1alpha1.Condition {
+	fields := make([]string, len(c))
+	for i, fc := range c {
+		fields[i] = fmt.Sprintf("%s (%s)", fc.Field, fc.Manager)
+	}
+	return v1alpha1.Condition{
+		Type:               TypeFieldConflict,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonConflictingOwner,
+		Message:            "Fields of the remote claim are managed by others: " + strings.Join(fields, ", "),
+	}
+}
+
+// NoFieldConflicts returns a condition indicating that the remote claim was
+// applied without any field conflicts.
+func NoFieldConflicts() v1alpha1.Condition {
+	return v1alpha1.Condition{
+		Type:               TypeFieldConflict,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonNoConflicts,
+	}
+}
+
+// RemoteAdmissionDenied returns a condition indicating that the remote claim
+// cannot be applied because an admission webhook of the remote cluster denied
+// it, with the reason that the webhook gave.
+func RemoteAdmissionDenied(d AdmissionDenial) v1alpha1.Condition {
+	msg := fmt.Sprintf("The remote claim was denied by admission webhook %q", d.Webhook)
+	if d.Message != "" {
+		msg += ": " + d.Message
+	}
+	return v1alpha1.Condition{
+		Type:               TypeRemoteAdmissionDenied,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonDeniedByWebhook,
+		Message:            msg,
+	}
+}
+
+// RemoteAdmitted returns a condition indicating that the remote claim was
+// admitted by the admission webhooks of the remote cluster.
+func RemoteAdmitted() v1alpha1.Condition {
+	return v1alpha1.Condition{
+		Type:               TypeRemoteAdmissionDenied,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonAdmitted,
+	}
+}
+
+// DryRunAccepted returns a condition indicating that the remote cluster would
+// accept the remote counterpart of the claim, as the last dry-run showed.
+func DryRunAccepted() v1alpha1.Condition {
+	return v1alpha1.Condition{
+		Type:               TypeDryRun,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonDryRunAccepted,
+		Message:            "The remote cluster accepts the claim",
+	}
+}
+
+// DryRunRejected returns a condition indicating that the remote cluster
+// rejected the remote counterpart of the claim in the last dry-run, with the
+// supplied message.
+func DryRunRejected(msg string) v1alpha1.Condition {
+	return v1alpha1.Condition{
+		Type:               TypeDryRun,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonDryRunRejected,
+		Message:            msg,
+	}
+}
+
+// PendingApproval returns a condition indicating that Agent doesn't forward
+// the claim to the remote cluster until it's approved.
+func PendingApproval() v1alpha1.Condition {
+	return v1alpha1.Condition{
+		Type:               TypeAgentSync,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonPendingApproval,
+		Message:            "The claim is not forwarded to the remote cluster until its current generation is approved with a ClaimApproval",
+	}
+}
+
+// InitialSyncTimedOut returns a condition indicating that the agent stopped
+// waiting for the initial sync after the supplied timeout while the objects of
+// the supplied kinds weren't synced yet.
+func InitialSyncTimedOut(timeout time.Duration, pending []string) v1alpha1.Condition {
+	return v1alpha1.Condition{
+		Type:               TypeInitialSync,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonSyncTimedOut,
+		Message:            fmt.Sprintf("The initial sync was not complete after %s, waiting for %v", timeout, pending),
+	}
+}
+
+// SLAExceeded returns a condition indicating that the claim isn't ready the
+// supplied time after its creation, which is more than its provisioning SLA.
+func SLAExceeded(sla, elapsed time.Duration) v1alpha1.Condition {
+	return v1alpha1.Condition{
+		Type:               TypeSLAExceeded,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonNotReadyInTime,
+		Message:            fmt.Sprintf("The claim is not ready %s after its creation, its provisioning SLA is %s", elapsed.Round(time.Second), sla),
+	}
+}
+
+// SLARecovered returns a condition indicating that the claim that exceeded
+// its provisioning SLA became ready the supplied time after its creation.
+func SLARecovered(elapsed time.Duration) v1alpha1.Condition {
+	return v1alpha1.Condition{
+		Type:               TypeSLAExceeded,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonReadyLate,
+		Message:            fmt.Sprintf("The claim became ready %s after its creation", elapsed.Round(time.Second)),
+	}
+}
+
+// SLAMet returns a condition indicating that the claim became ready the
+// supplied time after its creation, which is within its provisioning SLA.
+func SLAMet(elapsed time.Duration) v1alpha1.Condition {
+	return v1alpha1.Condition{
+		Type:               TypeSLAExceeded,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonReadyInTime,
+		Message:            fmt.Sprintf("The claim became ready %s after its creation", elapsed.Round(time.Second)),
+	}
+}
+
+// maxDriftLines is how many differences a SchemaDrift condition lists.
+const maxDriftLines = 10
+
+// SchemaDrift returns a condition indicating that the schema of the claim CRD
+// in the local cluster differs from the one in the remote cluster in the
+// supplied ways, see openapi.Diff.
+func SchemaDrift(diff []string) v1alpha1.Condition {
+	lines := diff
+	if len(lines) > maxDriftLines {
+		lines = append(lines[:maxDriftLines:maxDriftLines], fmt.Sprintf("and %d more", len(diff)-maxDriftLines))
+	}
+	return v1alpha1.Condition{
+		Type:               TypeSchemaDrift,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonSchemaDiverged,
+		Message:            "The schema of the local CRD differs from the remote one: " + strings.Join(lines, "; "),
+	}
+}
+
+// NoSchemaDrift returns a condition indicating that the schema of the claim
+// CRD in the local cluster is the one in the remote cluster.
+func NoSchemaDrift() v1alpha1.Condition {
+	return v1alpha1.Condition{
+		Type:               TypeSchemaDrift,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonSchemaInSync,
+	}
+}
+
+// PartialConnectionDetails returns a condition indicating that the connection
+// secret is missing some of the keys it's expected to have.
+func PartialConnectionDetails(missing []string) v1alpha1.Condition {
+	return v1alpha1.Condition{
+		Type:               TypePartialConnectionDetails,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonMissingKeys,
+		Message:            "Connection secret is missing keys: " + strings.Join(missing, ", "),
+	}
+}
+
+// CompleteConnectionDetails returns a condition indicating that the connection
+// secret has all the keys it's expected to have.
+func CompleteConnectionDetails() v1alpha1.Condition {
+	return v1alpha1.Condition{
+		Type:               TypePartialConnectionDetails,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonAllKeysPresent,
+	}
+}
+
+// NewSyncID returns a new ID that can be used to correlate the log lines of a
+// single sync operation with the objects it writes in both clusters.
+func NewSyncID() string {
+	return string(uuid.NewUUID())
+}
+
+// WithSyncID returns a copy of the supplied context that carries the given
+// sync ID.
+func WithSyncID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, syncIDKey{}, id)
+}
+
+// SyncIDFrom returns the sync ID carried by the supplied context, if any.
+func SyncIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(syncIDKey{}).(string)
+	return id
+}
+
+// SetProvenance annotates the supplied local copy of a remote object with the
+// cluster it's synced from, if known, the resource version of the remote
+// object and the time of the sync.
+func SetProvenance(local metav1.Object, cluster, resourceVersion string, t time.Time) {
+	a := map[string]string{
+		AnnotationKeySourceResourceVersion: resourceVersion,
+		AnnotationKeyLastSyncedTime:        t.UTC().Format(time.RFC3339),
+	}
+	if cluster != "" {
+		a[AnnotationKeySyncedFromCluster] = cluster
+	}
+	meta.AddAnnotations(local, a)
+}
+
+// SetSyncID annotates the supplied object with the sync ID carried by the
+// supplied context. It's a no-op if the context doesn't carry a sync ID.
+func SetSyncID(ctx context.Context, o metav1.Object) {
+	id := SyncIDFrom(ctx)
+	if id == "" {
+		return
+	}
+	meta.AddAnnotations(o, map[string]string{AnnotationKeySyncID: id})
+}
+
+// Hash returns the hash of what the agent writes of the supplied object, i.e.
+// its labels, annotations, owner references and everything but its metadata
+// and status. The annotations that change on every sync without the object
+// changing are left out.
+func Hash(o runtime.Object) (string, error) {
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(o)
+	if err != nil {
+		return "", err
+	}
+	m, ok := o.(metav1.Object)
+	if !ok {
+		return "", errors.New(errAccessMetadata)
+	}
+	a := map[string]string{}
+	for k, v := range m.GetAnnotations() {
+		switch k {
+		case AnnotationKeySpecHash, AnnotationKeySyncID, AnnotationKeyLastSyncedTime, AnnotationKeySourceResourceVersion:
+			continue
+		}
+		a[k] = v
+	}
+	content := map[string]interface{}{
+		"labels":          m.GetLabels(),
+		"annotations":     a,
+		"ownerReferences": m.GetOwnerReferences(),
+	}
+	for k, v := range u {
+		switch k {
+		case "apiVersion", "kind", "metadata", "status":
+			continue
+		}
+		content[k] = v
+	}
+	b, err := json.Marshal(content)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Unchanged returns whether the supplied desired object is the same as the
+// supplied current one apart from their sync IDs, i.e. whether writing it
+// would change nothing but the sync ID.
+func Unchanged(current, desired *unstructured.Unstructured) bool {
+	c, d := current.DeepCopy(), desired.DeepCopy()
+	meta.RemoveAnnotations(c, AnnotationKeySyncID)
+	meta.RemoveAnnotations(d, AnnotationKeySyncID)
+	return equality.Semantic.DeepEqual(c.Object, d.Object)
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/crossplane/crossplane-runtime/pkg/resource/fake"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+)
+
+func TestKeepOwnerReferences(t *testing.T) {
+	bundle := metav1.OwnerReference{Kind: "SyncedBundle", Name: "platform", UID: "bundle-uid"}
+	local := metav1.OwnerReference{Kind: "Application", Name: "platform", UID: "app-uid"}
+	owned := func(refs ...metav1.OwnerReference) *fake.Managed {
+		m := &fake.Managed{}
+		m.SetOwnerReferences(refs)
+		return m
+	}
+	cases := map[string]struct {
+		reason  string
+		current *fake.Managed
+		desired *fake.Managed
+		want    []metav1.OwnerReference
+	}{
+		"NoDesiredOwners": {
+			reason:  "Nothing should be added if the desired object has no owners, since the patch leaves the owners as they are",
+			current: owned(local),
+			desired: &fake.Managed{},
+		},
+		"Kept": {
+			reason:  "The owners of the current object should be kept alongside the desired ones",
+			current: owned(bundle, local),
+			desired: owned(bundle),
+			want:    []metav1.OwnerReference{bundle, local},
+		},
+		"OwnerRecreated": {
+			reason:  "The references to an owner that was recreated since should be dropped",
+			current: owned(metav1.OwnerReference{Kind: "SyncedBundle", Name: "platform", UID: "old-uid"}, local),
+			desired: owned(bundle),
+			want:    []metav1.OwnerReference{bundle, local},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := KeepOwnerReferences()(context.Background(), tc.current, tc.desired)
+			if diff := cmp.Diff(nil, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\nKeepOwnerReferences(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want, tc.desired.GetOwnerReferences()); diff != "" {
+				t.Errorf("\nReason: %s\nKeepOwnerReferences(...): -want owners, +got owners:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestUnchanged(t *testing.T) {
+	object := func(syncID, size string) *unstructured.Unstructured {
+		u := &unstructured.Unstructured{Object: map[string]interface{}{"spec": map[string]interface{}{"size": size}}}
+		u.SetName("cool")
+		u.SetAnnotations(map[string]string{AnnotationKeySyncID: syncID})
+		return u
+	}
+	cases := map[string]struct {
+		reason  string
+		current *unstructured.Unstructured
+		desired *unstructured.Unstructured
+		want    bool
+	}{
+		"OnlySyncIDChanged": {
+			reason:  "An object that differs only in its sync ID should be unchanged",
+			current: object("previous-sync", "small"),
+			desired: object("this-sync", "small"),
+			want:    true,
+		},
+		"Changed": {
+			reason:  "An object whose other fields differ should be changed",
+			current: object("previous-sync", "small"),
+			desired: object("previous-sync", "large"),
+			want:    false,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, Unchanged(tc.current, tc.desired)); diff != "" {
+				t.Errorf("\nReason: %s\nUnchanged(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if tc.desired.GetAnnotations()[AnnotationKeySyncID] == "" {
+				t.Errorf("\nReason: %s\nUnchanged(...): the supplied objects should not be changed", tc.reason)
+			}
+		})
+	}
+}
+
+func TestLabelValue(t *testing.T) {
+	long := strings.Repeat("a", 60) + "-database"
+	cases := map[string]struct {
+		reason string
+		s      string
+		want   string
+	}{
+		"Short": {
+			reason: "A string that fits in a label value should be used as it is",
+			s:      "cool-db",
+			want:   "cool-db",
+		},
+		"Limit": {
+			reason: "A string that is exactly as long as a label value may be should be used as it is",
+			s:      strings.Repeat("a", 63),
+			want:   strings.Repeat("a", 63),
+		},
+		"Long": {
+			reason: "A longer string should be truncated and suffixed with its hash",
+			s:      long,
+			want:   strings.Repeat("a", 54) + "-311309b1",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := LabelValue(tc.s)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\nReason: %s\nLabelValue(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if len(got) > 63 {
+				t.Errorf("\nReason: %s\nLabelValue(...): %d characters is longer than a label value may be", tc.reason, len(got))
+			}
+		})
+	}
+}
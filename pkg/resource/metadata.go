@@ -0,0 +1,218 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/pkg/meta"
+	"github.com/crossplane/crossplane-runtime/pkg/resource"
+)
+
+const (
+	errFmtUnknownMetadataStrategy = "unknown metadata strategy %q"
+	errAccessMetadata             = "cannot access object metadata"
+	errCreateObject               = "cannot create object"
+	errGetObject                  = "cannot get object"
+	errPatchObject                = "cannot patch object"
+	errMarshalPatch               = "cannot marshal patch"
+)
+
+// A MetadataStrategy determines which labels and annotations an object that
+// is written to a cluster ends up with when it already exists there.
+type MetadataStrategy string
+
+// Metadata strategies.
+const (
+	// MetadataStrategyStrictMirror makes the labels and annotations of the
+	// object exactly the ones of its counterpart in the other cluster. The ones
+	// that only the object in the cluster it's written to has are removed.
+	MetadataStrategyStrictMirror MetadataStrategy = "StrictMirror"
+
+	// MetadataStrategyPreserveLocal keeps the labels and annotations that the
+	// object has in the cluster it's written to, with their values, and adds
+	// the ones of its counterpart that it doesn't have.
+	MetadataStrategyPreserveLocal MetadataStrategy = "PreserveLocal"
+
+	// MetadataStrategyMerge adds the labels and annotations of the counterpart
+	// of the object and overrides the ones with the same keys. The rest are
+	// kept. It's what a plain patch of the object does.
+	MetadataStrategyMerge MetadataStrategy = "Merge"
+)
+
+// NewMetadataEqualizer returns the MetadataEqualizer of the supplied strategy.
+func NewMetadataEqualizer(s MetadataStrategy) (MetadataEqualizer, error) {
+	switch s {
+	case MetadataStrategyStrictMirror:
+		return StrictMirror(), nil
+	case MetadataStrategyPreserveLocal:
+		return PreserveLocal(), nil
+	case MetadataStrategyMerge:
+		return Merge(), nil
+	}
+	return nil, errors.Errorf(errFmtUnknownMetadataStrategy, s)
+}
+
+// A MetadataEqualizer equalizes the labels and annotations of the desired
+// state of an object, which are the ones of its counterpart in the other
+// cluster, with the ones of its current state in the cluster it's written to.
+type MetadataEqualizer interface {
+	EqualizeMetadata(current, desired metav1.Object)
+}
+
+// MetadataEqualizerFn is used to construct a MetadataEqualizer with a bare
+// function.
+type MetadataEqualizerFn func(current, desired metav1.Object)
+
+// EqualizeMetadata calls the supplied function.
+func (fn MetadataEqualizerFn) EqualizeMetadata(current, desired metav1.Object) {
+	fn(current, desired)
+}
+
+// StrictMirror returns a MetadataEqualizer that leaves the desired labels and
+// annotations as they are, so that the ones only the current object has are
+// removed.
+func StrictMirror() MetadataEqualizerFn {
+	return func(_, _ metav1.Object) {}
+}
+
+// PreserveLocal returns a MetadataEqualizer that keeps the current labels and
+// annotations over the desired ones with the same keys.
+func PreserveLocal() MetadataEqualizerFn {
+	return func(current, desired metav1.Object) {
+		desired.SetLabels(union(desired.GetLabels(), current.GetLabels()))
+		desired.SetAnnotations(union(desired.GetAnnotations(), current.GetAnnotations()))
+	}
+}
+
+// Merge returns a MetadataEqualizer that keeps the current labels and
+// annotations that the desired object doesn't have.
+func Merge() MetadataEqualizerFn {
+	return func(current, desired metav1.Object) {
+		desired.SetLabels(union(current.GetLabels(), desired.GetLabels()))
+		desired.SetAnnotations(union(current.GetAnnotations(), desired.GetAnnotations()))
+	}
+}
+
+// union returns the keys of both maps. The values of the second one win.
+func union(a, b map[string]string) map[string]string {
+	if len(a)+len(b) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(a)+len(b))
+	for k, v := range a {
+		out[k] = v
+	}
+	for k, v := range b {
+		out[k] = v
+	}
+	return out
+}
+
+// Keep returns a MetadataEqualizer that equalizes with the supplied one and
+// then restores the preserved annotations of the current object, whatever
+// the strategy.
+func (p PreservedAnnotations) Keep(e MetadataEqualizer) MetadataEqualizerFn {
+	return func(current, desired metav1.Object) {
+		e.EqualizeMetadata(current, desired)
+		p.Strip(desired)
+		keep := map[string]string{}
+		for k, v := range current.GetAnnotations() {
+			if p.Matches(k) {
+				keep[k] = v
+			}
+		}
+		meta.AddAnnotations(desired, keep)
+	}
+}
+
+// NewEqualizingApplicator returns a new *EqualizingApplicator.
+func NewEqualizingApplicator(c client.Client, e MetadataEqualizer) *EqualizingApplicator {
+	return &EqualizingApplicator{client: c, equalizer: e}
+}
+
+// An EqualizingApplicator patches objects like the APIPatchingApplicator of
+// crossplane-runtime, but equalizes their labels and annotations with the
+// ones they have in the cluster first. Unlike a merge patch of the desired
+// object, its patch removes the labels and annotations that the desired
+// object no longer has after the equalization.
+type EqualizingApplicator struct {
+	client    client.Client
+	equalizer MetadataEqualizer
+}
+
+// Apply creates the supplied object if it doesn't exist, or patches it with
+// its equalized desired state.
+func (a *EqualizingApplicator) Apply(ctx context.Context, o runtime.Object, ao ...resource.ApplyOption) error {
+	m, ok := o.(metav1.Object)
+	if !ok {
+		return errors.New(errAccessMetadata)
+	}
+	desired := o.DeepCopyObject()
+	err := a.client.Get(ctx, types.NamespacedName{Namespace: m.GetNamespace(), Name: m.GetName()}, o)
+	if kerrors.IsNotFound(err) {
+		return errors.Wrap(a.client.Create(ctx, o), errCreateObject)
+	}
+	if err != nil {
+		return errors.Wrap(err, errGetObject)
+	}
+	for _, fn := range ao {
+		if err := fn(ctx, o, desired); err != nil {
+			return err
+		}
+	}
+	d, _ := desired.(metav1.Object)
+	a.equalizer.EqualizeMetadata(m, d)
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(desired)
+	if err != nil {
+		return errors.Wrap(err, errMarshalPatch)
+	}
+	md, _ := content["metadata"].(map[string]interface{})
+	if md == nil {
+		md = map[string]interface{}{}
+		content["metadata"] = md
+	}
+	// A merge patch removes the keys whose values are null.
+	md["labels"] = withRemovals(m.GetLabels(), d.GetLabels())
+	md["annotations"] = withRemovals(m.GetAnnotations(), d.GetAnnotations())
+	data, err := json.Marshal(content)
+	if err != nil {
+		return errors.Wrap(err, errMarshalPatch)
+	}
+	return errors.Wrap(a.client.Patch(ctx, o, client.RawPatch(types.MergePatchType, data)), errPatchObject)
+}
+
+// withRemovals returns the desired map with null values for the keys that
+// only the current one has.
+func withRemovals(current, desired map[string]string) map[string]interface{} {
+	out := make(map[string]interface{}, len(current)+len(desired))
+	for k := range current {
+		out[k] = nil
+	}
+	for k, v := range desired {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+)
+
+func TestMetadataEqualizers(t *testing.T) {
+	current := func() metav1.Object {
+		return &metav1.ObjectMeta{
+			Labels:      map[string]string{"team": "local", "local-only": "yes"},
+			Annotations: map[string]string{"argocd.argoproj.io/sync-wave": "1", "note": "local"},
+		}
+	}
+	desired := func() metav1.Object {
+		return &metav1.ObjectMeta{
+			Labels:      map[string]string{"team": "remote", "remote-only": "yes"},
+			Annotations: map[string]string{"note": "remote"},
+		}
+	}
+	cases := map[string]struct {
+		reason    string
+		equalizer MetadataEqualizer
+		want      metav1.Object
+	}{
+		"StrictMirror": {
+			reason:    "The desired labels and annotations should be left as they are",
+			equalizer: StrictMirror(),
+			want:      desired(),
+		},
+		"PreserveLocal": {
+			reason:    "The current values should win and the desired keys that are missing should be added",
+			equalizer: PreserveLocal(),
+			want: &metav1.ObjectMeta{
+				Labels:      map[string]string{"team": "local", "local-only": "yes", "remote-only": "yes"},
+				Annotations: map[string]string{"argocd.argoproj.io/sync-wave": "1", "note": "local"},
+			},
+		},
+		"Merge": {
+			reason:    "The desired values should win and the current keys that are missing should be kept",
+			equalizer: Merge(),
+			want: &metav1.ObjectMeta{
+				Labels:      map[string]string{"team": "remote", "local-only": "yes", "remote-only": "yes"},
+				Annotations: map[string]string{"argocd.argoproj.io/sync-wave": "1", "note": "remote"},
+			},
+		},
+		"StrictMirrorKeepsPreserved": {
+			reason:    "The preserved annotations of the current object should be kept whatever the strategy",
+			equalizer: DefaultPreservedAnnotations.Keep(StrictMirror()),
+			want: &metav1.ObjectMeta{
+				Labels:      map[string]string{"team": "remote", "remote-only": "yes"},
+				Annotations: map[string]string{"argocd.argoproj.io/sync-wave": "1", "note": "remote"},
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := desired()
+			tc.equalizer.EqualizeMetadata(current(), got)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\nReason: %s\nEqualizeMetadata(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestNewMetadataEqualizer(t *testing.T) {
+	if _, err := NewMetadataEqualizer("Mirror"); err == nil {
+		t.Errorf("NewMetadataEqualizer(...): want error for unknown strategy, got nil")
+	}
+	for _, s := range []MetadataStrategy{MetadataStrategyStrictMirror, MetadataStrategyPreserveLocal, MetadataStrategyMerge} {
+		if _, err := NewMetadataEqualizer(s); err != nil {
+			t.Errorf("NewMetadataEqualizer(%s): %s", s, err)
+		}
+	}
+}
+
+func TestEqualizingApplicator(t *testing.T) {
+	errBoom := errors.New("boom")
+	desired := func() *corev1.ConfigMap {
+		return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Name:        "cool",
+			Labels:      map[string]string{"team": "remote"},
+			Annotations: map[string]string{"note": "remote"},
+		}}
+	}
+	current := test.NewMockGetFn(nil, func(obj runtime.Object) error {
+		cm := obj.(*corev1.ConfigMap)
+		cm.SetName("cool")
+		cm.SetLabels(map[string]string{"team": "local", "stale": "yes"})
+		cm.SetAnnotations(map[string]string{"note": "local"})
+		return nil
+	})
+	type want struct {
+		err   error
+		patch map[string]interface{}
+	}
+	cases := map[string]struct {
+		reason    string
+		equalizer MetadataEqualizer
+		get       test.MockGetFn
+		create    test.MockCreateFn
+		want      want
+	}{
+		"CreateIfNotFound": {
+			reason:    "The object should be created as is if it doesn't exist",
+			equalizer: StrictMirror(),
+			get:       test.NewMockGetFn(kerrors.NewNotFound(schema.GroupResource{}, "cool")),
+			create:    test.NewMockCreateFn(nil),
+		},
+		"GetError": {
+			reason:    "Errors getting the object should be returned",
+			equalizer: StrictMirror(),
+			get:       test.NewMockGetFn(errBoom),
+			want:      want{err: errors.Wrap(errBoom, errGetObject)},
+		},
+		"StrictMirrorRemoves": {
+			reason:    "The patch should remove the labels that only the current object has",
+			equalizer: StrictMirror(),
+			get:       current,
+			want: want{patch: map[string]interface{}{
+				"labels":      map[string]interface{}{"team": "remote", "stale": nil},
+				"annotations": map[string]interface{}{"note": "remote"},
+			}},
+		},
+		"PreserveLocalKeeps": {
+			reason:    "The patch should keep the current values",
+			equalizer: PreserveLocal(),
+			get:       current,
+			want: want{patch: map[string]interface{}{
+				"labels":      map[string]interface{}{"team": "local", "stale": "yes"},
+				"annotations": map[string]interface{}{"note": "local"},
+			}},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var patch map[string]interface{}
+			c := &test.MockClient{
+				MockGet:    tc.get,
+				MockCreate: tc.create,
+				MockPatch: func(_ context.Context, _ runtime.Object, p client.Patch, _ ...client.PatchOption) error {
+					data, _ := p.Data(nil)
+					content := map[string]interface{}{}
+					if err := json.Unmarshal(data, &content); err != nil {
+						return err
+					}
+					md, _ := content["metadata"].(map[string]interface{})
+					patch = map[string]interface{}{"labels": md["labels"], "annotations": md["annotations"]}
+					return nil
+				},
+			}
+			err := NewEqualizingApplicator(c, tc.equalizer).Apply(context.Background(), desired())
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\nApply(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.patch, patch); diff != "" {
+				t.Errorf("\nReason: %s\nApply(...): -want patch, +got patch:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
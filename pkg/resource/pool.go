@@ -0,0 +1,76 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"reflect"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// An ObjectPool reuses the objects of a type across reconciles so that bulk
+// syncs don't allocate a new object for every item. It's safe for concurrent
+// use.
+type ObjectPool struct {
+	pool sync.Pool
+}
+
+// NewObjectPool returns an ObjectPool that creates objects with the supplied
+// function when there's none to reuse.
+func NewObjectPool(fn func() runtime.Object) *ObjectPool {
+	return &ObjectPool{pool: sync.Pool{New: func() interface{} { return fn() }}}
+}
+
+// Get returns an object from the pool. It's in the same state as the ones
+// returned by the function of the pool.
+func (p *ObjectPool) Get() runtime.Object {
+	return p.pool.Get().(runtime.Object)
+}
+
+// Put resets the supplied object and returns it to the pool. The object must
+// not be used once it's returned.
+func (p *ObjectPool) Put(o runtime.Object) {
+	if o == nil {
+		return
+	}
+	reset(o)
+	p.pool.Put(o)
+}
+
+// reset clears all of the supplied object but its type. The content map of
+// unstructured objects is cleared in place so that it doesn't need to be
+// reallocated.
+func reset(o runtime.Object) {
+	gvk := o.GetObjectKind().GroupVersionKind()
+	switch u := o.(type) {
+	case *unstructured.Unstructured:
+		for k := range u.Object {
+			delete(u.Object, k)
+		}
+	case *unstructured.UnstructuredList:
+		for k := range u.Object {
+			delete(u.Object, k)
+		}
+		u.Items = nil
+	default:
+		v := reflect.ValueOf(o).Elem()
+		v.Set(reflect.Zero(v.Type()))
+	}
+	o.GetObjectKind().SetGroupVersionKind(gvk)
+}
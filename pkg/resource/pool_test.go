@@ -0,0 +1,128 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/claim"
+)
+
+func TestObjectPoolPut(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		obj    runtime.Object
+		want   runtime.Object
+	}{
+		"Unstructured": {
+			reason: "Everything but the type of unstructured objects should be cleared",
+			obj: &unstructured.Unstructured{Object: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "ConfigMap",
+				"metadata":   map[string]interface{}{"name": "cool"},
+				"data":       map[string]interface{}{"key": "value"},
+			}},
+			want: &unstructured.Unstructured{Object: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "ConfigMap",
+			}},
+		},
+		"UnstructuredList": {
+			reason: "The items of unstructured lists should be cleared along with everything but their type",
+			obj: &unstructured.UnstructuredList{
+				Object: map[string]interface{}{
+					"apiVersion": "v1",
+					"kind":       "ConfigMapList",
+					"metadata":   map[string]interface{}{"resourceVersion": "42"},
+				},
+				Items: []unstructured.Unstructured{{Object: map[string]interface{}{"metadata": map[string]interface{}{"name": "cool"}}}},
+			},
+			want: &unstructured.UnstructuredList{Object: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "ConfigMapList",
+			}},
+		},
+		"Claim": {
+			reason: "Everything but the type of the objects that embed unstructured objects should be cleared",
+			obj: func() runtime.Object {
+				cm := claim.New(claim.WithGroupVersionKind(schema.GroupVersionKind{Group: "example.org", Version: "v1", Kind: "Database"}))
+				cm.SetName("cool")
+				cm.SetResourceReference(&corev1.ObjectReference{Name: "cool-xr"})
+				return cm
+			}(),
+			want: claim.New(claim.WithGroupVersionKind(schema.GroupVersionKind{Group: "example.org", Version: "v1", Kind: "Database"})),
+		},
+		"Typed": {
+			reason: "Everything but the type meta of typed objects should be cleared",
+			obj: &corev1.ConfigMap{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+				ObjectMeta: metav1.ObjectMeta{Name: "cool"},
+				Data:       map[string]string{"key": "value"},
+			},
+			want: &corev1.ConfigMap{
+				TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			p := NewObjectPool(func() runtime.Object { return tc.obj.DeepCopyObject() })
+			p.Put(tc.obj)
+			if diff := cmp.Diff(tc.want, tc.obj); diff != "" {
+				t.Errorf("\nReason: %s\np.Put(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func BenchmarkObjectPool(b *testing.B) {
+	fill := func(u *unstructured.Unstructured) {
+		u.SetNamespace("default")
+		u.SetName("cool")
+		u.SetLabels(map[string]string{"cool": "true"})
+	}
+	newObject := func() runtime.Object {
+		u := &unstructured.Unstructured{}
+		u.SetAPIVersion("v1")
+		u.SetKind("ConfigMap")
+		return u
+	}
+
+	b.Run("New", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			u, _ := newObject().(*unstructured.Unstructured)
+			fill(u)
+		}
+	})
+	b.Run("Pooled", func(b *testing.B) {
+		p := NewObjectPool(newObject)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			u, _ := p.Get().(*unstructured.Unstructured)
+			fill(u)
+			p.Put(u)
+		}
+	})
+}
@@ -20,6 +20,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
@@ -37,13 +38,55 @@ func NewNameFilter(list []types.NamespacedName) predicate.Funcs {
 	})
 }
 
-// NewXRDWithClaim returns a new XRDWithClaim object.
+// NewNamespaceExclusionFilter returns a new predicate that filters out the
+// objects in the given namespaces.
+func NewNamespaceExclusionFilter(namespaces ...string) predicate.Funcs {
+	return predicate.NewPredicateFuncs(func(meta metav1.Object, _ runtime.Object) bool {
+		for _, ns := range namespaces {
+			if meta.GetNamespace() == ns {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// NewEstablishedFilter returns a new predicate that lets only the events of
+// CustomResourceDefinitions of either version that have just become
+// established pass.
+func NewEstablishedFilter() predicate.Funcs {
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return IsEstablished(e.Object)
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return !IsEstablished(e.ObjectOld) && IsEstablished(e.ObjectNew)
+		},
+		DeleteFunc: func(event.DeleteEvent) bool {
+			return false
+		},
+		GenericFunc: func(event.GenericEvent) bool {
+			return false
+		},
+	}
+}
+
+// NewXRDWithClaim returns a new XRDWithClaim object. The updates of XRDs that
+// stop offering claims are accepted as well so that the claims stop being
+// synced.
 func NewXRDWithClaim() predicate.Funcs {
-	return predicate.NewPredicateFuncs(func(_ metav1.Object, object runtime.Object) bool {
+	offersClaim := func(object runtime.Object) bool {
 		xrd, ok := object.(*v1alpha1.CompositeResourceDefinition)
 		if !ok {
 			return true
 		}
 		return xrd.Spec.ClaimNames != nil
+	}
+	p := predicate.NewPredicateFuncs(func(_ metav1.Object, object runtime.Object) bool {
+		return offersClaim(object)
 	})
+	p.UpdateFunc = func(e event.UpdateEvent) bool {
+		return offersClaim(e.ObjectOld) || offersClaim(e.ObjectNew)
+	}
+	return p
 }
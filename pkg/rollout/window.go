@@ -0,0 +1,113 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package rollout paces the updates that the agent makes to the local cluster
+// so that a batch of changes in the remote cluster, e.g. dozens of Compositions
+// updated at once, is rolled out gradually instead of all at once.
+package rollout
+
+import (
+	"sync"
+	"time"
+)
+
+const defaultInterval = 1 * time.Minute
+
+// WindowOption is used to configure *Window.
+type WindowOption func(*Window)
+
+// WithInterval specifies the interval in which at most the limit of updates
+// are admitted.
+func WithInterval(d time.Duration) WindowOption {
+	return func(w *Window) {
+		w.interval = d
+	}
+}
+
+// WithClock specifies the function that the Window should use to get the
+// current time.
+func WithClock(now func() time.Time) WindowOption {
+	return func(w *Window) {
+		w.now = now
+	}
+}
+
+// NewWindow returns a new *Window that admits the supplied number of updates
+// per minute.
+func NewWindow(limit int, opts ...WindowOption) *Window {
+	w := &Window{
+		limit:    limit,
+		interval: defaultInterval,
+		now:      time.Now,
+		queued:   map[string]bool{},
+	}
+	for _, f := range opts {
+		f(w)
+	}
+	return w
+}
+
+// Window admits a limited number of updates in a sliding interval and keeps
+// track of the updates that wait for their turn. It's safe for concurrent use.
+type Window struct {
+	limit    int
+	interval time.Duration
+	now      func() time.Time
+
+	mu       sync.Mutex
+	admitted []time.Time
+	queued   map[string]bool
+}
+
+// Admit returns zero if the update of the object with the supplied name may
+// be made now. Otherwise, the update is queued and how long it takes until the
+// next update may be made is returned, which is when it should be tried again.
+func (w *Window) Admit(name string) time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := w.now()
+	cutoff := now.Add(-w.interval)
+	i := 0
+	for i < len(w.admitted) && !w.admitted[i].After(cutoff) {
+		i++
+	}
+	w.admitted = w.admitted[i:]
+	if len(w.admitted) < w.limit {
+		w.admitted = append(w.admitted, now)
+		delete(w.queued, name)
+		return 0
+	}
+	w.queued[name] = true
+	if len(w.admitted) == 0 {
+		return w.interval
+	}
+	return w.admitted[0].Add(w.interval).Sub(now)
+}
+
+// Forget removes the update of the object with the supplied name from the
+// queue, e.g. because the object no longer needs to be updated.
+func (w *Window) Forget(name string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.queued, name)
+}
+
+// Queued returns the number of updates that wait for their turn.
+func (w *Window) Queued() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.queued)
+}
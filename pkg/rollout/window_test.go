@@ -0,0 +1,90 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rollout
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWindow(t *testing.T) {
+	start := time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	type admit struct {
+		name  string
+		after time.Duration
+	}
+	type want struct {
+		waits  []time.Duration
+		queued int
+	}
+	cases := map[string]struct {
+		reason string
+		limit  int
+		admits []admit
+		forget []string
+		want   want
+	}{
+		"WithinLimit": {
+			reason: "The updates within the limit should be admitted right away",
+			limit:  2,
+			admits: []admit{{name: "a"}, {name: "b", after: time.Second}},
+			want:   want{waits: []time.Duration{0, 0}},
+		},
+		"Queued": {
+			reason: "The updates over the limit should wait until the oldest update is out of the interval",
+			limit:  2,
+			admits: []admit{{name: "a"}, {name: "b", after: 10 * time.Second}, {name: "c", after: 20 * time.Second}, {name: "d", after: 20 * time.Second}},
+			want:   want{waits: []time.Duration{0, 0, 40 * time.Second, 40 * time.Second}, queued: 2},
+		},
+		"Admitted": {
+			reason: "A queued update should be admitted once there's room in the interval",
+			limit:  1,
+			admits: []admit{{name: "a"}, {name: "b", after: 30 * time.Second}, {name: "b", after: 60 * time.Second}},
+			want:   want{waits: []time.Duration{0, 30 * time.Second, 0}},
+		},
+		"Forgotten": {
+			reason: "Forgotten updates should no longer be queued",
+			limit:  1,
+			admits: []admit{{name: "a"}, {name: "b"}},
+			forget: []string{"b"},
+			want:   want{waits: []time.Duration{0, time.Minute}},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			now := start
+			w := NewWindow(tc.limit, WithClock(func() time.Time { return now }))
+			waits := make([]time.Duration, 0, len(tc.admits))
+			for _, a := range tc.admits {
+				now = start.Add(a.after)
+				waits = append(waits, w.Admit(a.name))
+			}
+			for _, n := range tc.forget {
+				w.Forget(n)
+			}
+			if diff := cmp.Diff(tc.want.waits, waits); diff != "" {
+				t.Errorf("\nReason: %s\nw.Admit(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.queued, w.Queued()); diff != "" {
+				t.Errorf("\nReason: %s\nw.Queued(): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package sanitize lets downstream builds of the agent plug sanitizers into
+// it. A sanitizer is compiled into the binary and registered for a type, and
+// it's called with every object of that type right before the agent applies
+// it; the objects synced from the remote cluster in remote mode and the
+// remote claims in local mode.
+package sanitize
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	errToUnstructured   = "cannot convert object to unstructured"
+	errFromUnstructured = "cannot convert object from unstructured"
+	errFmtSanitizer     = "sanitizer %d of %s failed"
+)
+
+// A Sanitizer sanitizes an object before it's applied. It may change the
+// object in place, and an error blocks the apply.
+type Sanitizer interface {
+	Sanitize(ctx context.Context, obj *unstructured.Unstructured) error
+}
+
+// SanitizerFn is used to construct a Sanitizer with a bare function.
+type SanitizerFn func(ctx context.Context, obj *unstructured.Unstructured) error
+
+// Sanitize calls the supplied function.
+func (fn SanitizerFn) Sanitize(ctx context.Context, obj *unstructured.Unstructured) error {
+	return fn(ctx, obj)
+}
+
+// Default is the Registry that the reconcilers of the agent use unless
+// configured otherwise.
+var Default = NewRegistry()
+
+// Register registers the supplied Sanitizer for the objects of the supplied
+// type with the Default registry. Downstream builds call it from an init
+// function of a package that their main package imports.
+func Register(gvk schema.GroupVersionKind, s Sanitizer) {
+	Default.Register(gvk, s)
+}
+
+// NewRegistry returns an empty *Registry.
+func NewRegistry() *Registry {
+	return &Registry{sanitizers: map[schema.GroupVersionKind][]Sanitizer{}}
+}
+
+// A Registry holds the Sanitizers of every type. It's safe for concurrent
+// use.
+type Registry struct {
+	mu         sync.RWMutex
+	sanitizers map[schema.GroupVersionKind][]Sanitizer
+}
+
+// Register registers the supplied Sanitizer for the objects of the supplied
+// type. The Sanitizers of a type are called in the order they're registered.
+func (r *Registry) Register(gvk schema.GroupVersionKind, s Sanitizer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sanitizers[gvk] = append(r.sanitizers[gvk], s)
+}
+
+// Types returns the types that have Sanitizers registered.
+func (r *Registry) Types() []schema.GroupVersionKind {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	types := make([]schema.GroupVersionKind, 0, len(r.sanitizers))
+	for gvk := range r.sanitizers {
+		types = append(types, gvk)
+	}
+	return types
+}
+
+// Sanitize calls the Sanitizers registered for the supplied type with the
+// supplied object, which is changed in place. Typed objects are converted to
+// unstructured and back for the Sanitizers.
+func (r *Registry) Sanitize(ctx context.Context, gvk schema.GroupVersionKind, obj runtime.Object) error {
+	r.mu.RLock()
+	ss := r.sanitizers[gvk]
+	r.mu.RUnlock()
+	if len(ss) == 0 {
+		return nil
+	}
+	if u, ok := obj.(runtime.Unstructured); ok {
+		in := &unstructured.Unstructured{Object: u.UnstructuredContent()}
+		if err := run(ctx, gvk, ss, in); err != nil {
+			return err
+		}
+		u.SetUnstructuredContent(in.Object)
+		return nil
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return errors.Wrap(err, errToUnstructured)
+	}
+	in := &unstructured.Unstructured{Object: content}
+	if err := run(ctx, gvk, ss, in); err != nil {
+		return err
+	}
+	return errors.Wrap(runtime.DefaultUnstructuredConverter.FromUnstructured(in.Object, obj), errFromUnstructured)
+}
+
+func run(ctx context.Context, gvk schema.GroupVersionKind, ss []Sanitizer, obj *unstructured.Unstructured) error {
+	for i, s := range ss {
+		if err := s.Sanitize(ctx, obj); err != nil {
+			return errors.Wrapf(err, errFmtSanitizer, i, gvk.String())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sanitize
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+)
+
+func TestRegistrySanitize(t *testing.T) {
+	errBoom := errors.New("boom")
+	claim := schema.GroupVersionKind{Group: "database.example.org", Version: "v1alpha1", Kind: "PostgreSQLInstance"}
+	configMap := corev1.SchemeGroupVersion.WithKind("ConfigMap")
+
+	label := SanitizerFn(func(_ context.Context, obj *unstructured.Unstructured) error {
+		obj.SetLabels(map[string]string{"sanitized": "true"})
+		return nil
+	})
+	dropData := SanitizerFn(func(_ context.Context, obj *unstructured.Unstructured) error {
+		unstructured.RemoveNestedField(obj.Object, "data", "password")
+		return nil
+	})
+	failing := SanitizerFn(func(_ context.Context, _ *unstructured.Unstructured) error {
+		return errBoom
+	})
+
+	type want struct {
+		obj runtime.Object
+		err error
+	}
+	cases := map[string]struct {
+		reason     string
+		sanitizers map[schema.GroupVersionKind][]Sanitizer
+		gvk        schema.GroupVersionKind
+		obj        runtime.Object
+		want       want
+	}{
+		"NotRegistered": {
+			reason: "Objects of types without sanitizers should be left as they are",
+			sanitizers: map[schema.GroupVersionKind][]Sanitizer{
+				configMap: {label},
+			},
+			gvk: claim,
+			obj: &unstructured.Unstructured{Object: map[string]interface{}{"kind": "PostgreSQLInstance"}},
+			want: want{
+				obj: &unstructured.Unstructured{Object: map[string]interface{}{"kind": "PostgreSQLInstance"}},
+			},
+		},
+		"Unstructured": {
+			reason: "Unstructured objects should be sanitized in place by all sanitizers of their type",
+			sanitizers: map[schema.GroupVersionKind][]Sanitizer{
+				claim: {label},
+			},
+			gvk: claim,
+			obj: &unstructured.Unstructured{Object: map[string]interface{}{"kind": "PostgreSQLInstance"}},
+			want: want{
+				obj: &unstructured.Unstructured{Object: map[string]interface{}{
+					"kind":     "PostgreSQLInstance",
+					"metadata": map[string]interface{}{"labels": map[string]interface{}{"sanitized": "true"}},
+				}},
+			},
+		},
+		"Typed": {
+			reason: "Typed objects should be sanitized through their unstructured form",
+			sanitizers: map[schema.GroupVersionKind][]Sanitizer{
+				configMap: {label, dropData},
+			},
+			gvk: configMap,
+			obj: &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cool"}, Data: map[string]string{"password": "secret", "user": "admin"}},
+			want: want{
+				obj: &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cool", Labels: map[string]string{"sanitized": "true"}}, Data: map[string]string{"user": "admin"}},
+			},
+		},
+		"Failed": {
+			reason: "The error of a sanitizer should be returned",
+			sanitizers: map[schema.GroupVersionKind][]Sanitizer{
+				claim: {label, failing},
+			},
+			gvk: claim,
+			obj: &unstructured.Unstructured{Object: map[string]interface{}{"kind": "PostgreSQLInstance"}},
+			want: want{
+				obj: &unstructured.Unstructured{Object: map[string]interface{}{
+					"kind":     "PostgreSQLInstance",
+					"metadata": map[string]interface{}{"labels": map[string]interface{}{"sanitized": "true"}},
+				}},
+				err: errors.Wrapf(errBoom, errFmtSanitizer, 1, claim.String()),
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			r := NewRegistry()
+			for gvk, ss := range tc.sanitizers {
+				for _, s := range ss {
+					r.Register(gvk, s)
+				}
+			}
+			err := r.Sanitize(context.Background(), tc.gvk, tc.obj)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\nSanitize(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.obj, tc.obj); diff != "" {
+				t.Errorf("\nReason: %s\nSanitize(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
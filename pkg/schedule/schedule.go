@@ -0,0 +1,195 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package schedule decides when the synced objects are synced next, in one
+// place for all controllers, so that the objects that are synced together
+// don't keep getting requeued together and the upcoming syncs can be
+// inspected.
+package schedule
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const defaultJitter = 0.1
+
+// A Key identifies an object whose next sync is scheduled.
+type Key struct {
+	Controller string `json:"controller"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+}
+
+// An Entry is the next sync of an object.
+type Entry struct {
+	Key
+
+	// Next is when the object is synced next.
+	Next time.Time `json:"next"`
+
+	// In is how long it is until the object is synced next, as of when the
+	// schedule is read.
+	In time.Duration `json:"in"`
+
+	// Interval is how long after its last sync the object is synced next,
+	// including the jitter.
+	Interval time.Duration `json:"interval"`
+}
+
+// A Scheduler decides when the objects are synced next.
+type Scheduler interface {
+	// Schedule returns the result that the reconcile of the object with the
+	// supplied key should return instead of the supplied result and error.
+	Schedule(k Key, r reconcile.Result, err error) reconcile.Result
+}
+
+// NewNopScheduler returns a Scheduler that returns the results as they are.
+func NewNopScheduler() Scheduler {
+	return nopScheduler{}
+}
+
+type nopScheduler struct{}
+
+func (nopScheduler) Schedule(_ Key, r reconcile.Result, _ error) reconcile.Result { return r }
+
+// CalendarOption is used to configure *Calendar.
+type CalendarOption func(*Calendar)
+
+// WithJitter specifies the share of the requeue intervals that the Calendar
+// should randomly add to or subtract from them, e.g. 0.1 for up to 10%.
+func WithJitter(f float64) CalendarOption {
+	return func(c *Calendar) {
+		c.jitter = f
+	}
+}
+
+// WithClock specifies the function that the Calendar should use to get the
+// current time.
+func WithClock(now func() time.Time) CalendarOption {
+	return func(c *Calendar) {
+		c.now = now
+	}
+}
+
+// WithRandom specifies the function that the Calendar should use to get a
+// random number in [0, 1) for the jitter.
+func WithRandom(fn func() float64) CalendarOption {
+	return func(c *Calendar) {
+		c.random = fn
+	}
+}
+
+// NewCalendar returns a new *Calendar.
+func NewCalendar(opts ...CalendarOption) *Calendar {
+	c := &Calendar{
+		jitter:  defaultJitter,
+		now:     time.Now,
+		random:  rand.Float64,
+		entries: map[Key]Entry{},
+	}
+	for _, f := range opts {
+		f(c)
+	}
+	return c
+}
+
+// Calendar is a Scheduler that spreads the requeues of the objects with
+// jitter and keeps track of when every object is synced next. The objects
+// that are synced together, e.g. all claims at startup, would otherwise be
+// requeued together with the same interval forever. It only deals with the
+// intervals the reconcilers ask for, so a change of the wall clock doesn't
+// change when the objects are synced.
+type Calendar struct {
+	jitter float64
+	now    func() time.Time
+
+	mu      sync.Mutex
+	random  func() float64
+	entries map[Key]Entry
+}
+
+// Schedule adds the jitter to the requeue interval of the supplied result and
+// records when the object is synced next. The object is forgotten if it isn't
+// requeued after an interval, e.g. because it's gone or waits for a watch
+// event, or if its reconcile returned an error, in which case it's retried
+// with the backoff of its controller rather than after the interval. It's
+// safe for concurrent use.
+func (c *Calendar) Schedule(k Key, r reconcile.Result, err error) reconcile.Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil || r.RequeueAfter <= 0 {
+		delete(c.entries, k)
+		return r
+	}
+	// The random number is within [-jitter, +jitter) of the interval.
+	d := r.RequeueAfter + time.Duration(float64(r.RequeueAfter)*c.jitter*(2*c.random()-1))
+	c.entries[k] = Entry{Key: k, Next: c.now().Add(d), Interval: d}
+	r.RequeueAfter = d
+	return r
+}
+
+// Upcoming returns the next syncs of the objects that match the supplied key,
+// from the soonest to the latest. Empty fields of the key match all objects.
+// At most limit syncs are returned unless it isn't positive.
+func (c *Calendar) Upcoming(filter Key, limit int) []Entry {
+	now := c.now()
+	c.mu.Lock()
+	out := make([]Entry, 0, len(c.entries))
+	for k, e := range c.entries {
+		if !matches(filter, k) {
+			continue
+		}
+		e.In = e.Next.Sub(now)
+		out = append(out, e)
+	}
+	c.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].Next.Equal(out[j].Next) {
+			return out[i].Next.Before(out[j].Next)
+		}
+		return out[i].Name < out[j].Name
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+func matches(filter, k Key) bool {
+	return (filter.Controller == "" || filter.Controller == k.Controller) &&
+		(filter.Namespace == "" || filter.Namespace == k.Namespace) &&
+		(filter.Name == "" || filter.Name == k.Name)
+}
+
+// ServeHTTP writes the upcoming syncs as JSON. The controller, namespace and
+// name query parameters narrow them down to the matching objects, and the
+// limit query parameter caps how many are written.
+func (c *Calendar) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	q := req.URL.Query()
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(c.Upcoming(Key{Controller: q.Get("controller"), Namespace: q.Get("namespace"), Name: q.Get("name")}, limit))
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schedule
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestCalendar(t *testing.T) {
+	at := time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+	db := Key{Controller: "Database", Namespace: "cool", Name: "db"}
+	bucket := Key{Controller: "Bucket", Namespace: "cool", Name: "bucket"}
+
+	type schedule struct {
+		key    Key
+		result reconcile.Result
+		err    error
+		random float64
+	}
+	type want struct {
+		results  []reconcile.Result
+		upcoming []Entry
+	}
+	cases := map[string]struct {
+		reason    string
+		schedules []schedule
+		filter    Key
+		want      want
+	}{
+		"Jittered": {
+			reason: "The requeue intervals should be spread by up to the jitter in both directions",
+			schedules: []schedule{
+				{key: db, result: reconcile.Result{RequeueAfter: time.Minute}, random: 0},
+				{key: bucket, result: reconcile.Result{RequeueAfter: time.Minute}, random: 0.75},
+			},
+			want: want{
+				results: []reconcile.Result{{RequeueAfter: 54 * time.Second}, {RequeueAfter: 63 * time.Second}},
+				upcoming: []Entry{
+					{Key: db, Next: at.Add(54 * time.Second), In: 54 * time.Second, Interval: 54 * time.Second},
+					{Key: bucket, Next: at.Add(63 * time.Second), In: 63 * time.Second, Interval: 63 * time.Second},
+				},
+			},
+		},
+		"Forgotten": {
+			reason: "The objects that aren't requeued after an interval should be forgotten",
+			schedules: []schedule{
+				{key: db, result: reconcile.Result{RequeueAfter: time.Minute}, random: 0.5},
+				{key: db, result: reconcile.Result{}},
+			},
+			want: want{
+				results:  []reconcile.Result{{RequeueAfter: time.Minute}, {}},
+				upcoming: []Entry{},
+			},
+		},
+		"Failed": {
+			reason: "The objects whose reconcile failed should be forgotten since they're retried with backoff",
+			schedules: []schedule{
+				{key: db, result: reconcile.Result{RequeueAfter: time.Minute}, random: 0.5},
+				{key: db, result: reconcile.Result{RequeueAfter: time.Minute}, err: errors.New("boom"), random: 0.5},
+			},
+			want: want{
+				results:  []reconcile.Result{{RequeueAfter: time.Minute}, {RequeueAfter: time.Minute}},
+				upcoming: []Entry{},
+			},
+		},
+		"Filtered": {
+			reason: "Only the objects that match the filter should be returned",
+			schedules: []schedule{
+				{key: db, result: reconcile.Result{RequeueAfter: time.Minute}, random: 0.5},
+				{key: bucket, result: reconcile.Result{RequeueAfter: time.Second}, random: 0.5},
+			},
+			filter: Key{Controller: "Database"},
+			want: want{
+				results:  []reconcile.Result{{RequeueAfter: time.Minute}, {RequeueAfter: time.Second}},
+				upcoming: []Entry{{Key: db, Next: at.Add(time.Minute), In: time.Minute, Interval: time.Minute}},
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			random := 0.0
+			c := NewCalendar(WithClock(func() time.Time { return at }), WithRandom(func() float64 { return random }))
+			results := make([]reconcile.Result, 0, len(tc.schedules))
+			for _, s := range tc.schedules {
+				random = s.random
+				results = append(results, c.Schedule(s.key, s.result, s.err))
+			}
+			if diff := cmp.Diff(tc.want.results, results); diff != "" {
+				t.Errorf("\nReason: %s\nc.Schedule(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.upcoming, c.Upcoming(tc.filter, 0)); diff != "" {
+				t.Errorf("\nReason: %s\nc.Upcoming(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	at := time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+	c := NewCalendar(WithClock(func() time.Time { return at }), WithJitter(0))
+	c.Schedule(Key{Controller: "Database", Namespace: "cool", Name: "db"}, reconcile.Result{RequeueAfter: time.Minute}, nil)
+	c.Schedule(Key{Controller: "Database", Namespace: "cool", Name: "other"}, reconcile.Result{RequeueAfter: time.Second}, nil)
+
+	w := httptest.NewRecorder()
+	c.ServeHTTP(w, httptest.NewRequest("GET", "/debug/sync-schedule?controller=Database&limit=1", nil))
+
+	got := []Entry{}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal(...): %s", err)
+	}
+	want := []Entry{{Key: Key{Controller: "Database", Namespace: "cool", Name: "other"}, Next: at.Add(time.Second), In: time.Second, Interval: time.Second}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("\nReason: %s\nc.ServeHTTP(...): -want, +got:\n%s", "Only the soonest syncs up to the limit should be served", diff)
+	}
+}
@@ -0,0 +1,306 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package secretcache caches the Secrets that the agent reads from the remote
+// cluster, so that the connection secrets that many claims share aren't read
+// again with every sync of every one of them.
+package secretcache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+
+	"github.com/crossplane/agent/pkg/metrics"
+)
+
+// rewatchWait is how long the Cache waits before it watches a namespace again
+// once its watch is closed, e.g. by the API server.
+const rewatchWait = time.Second
+
+// Sources of the Secrets that are read, as reported in the
+// crossplane_agent_remote_secret_reads_total metric.
+const (
+	SourceCache  = "cache"
+	SourceRemote = "remote"
+)
+
+// A Watcher watches the Secrets in a namespace from the supplied resource
+// version, or from the current state of the namespace if it's empty.
+type Watcher interface {
+	Watch(ctx context.Context, namespace, resourceVersion string) (watch.Interface, error)
+}
+
+// NewAPIWatcher returns a Watcher that watches the Secrets with the API server
+// of the supplied config.
+func NewAPIWatcher(cfg *rest.Config) (Watcher, error) {
+	cs, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return apiWatcher{kube: cs}, nil
+}
+
+type apiWatcher struct {
+	kube kubernetes.Interface
+}
+
+func (w apiWatcher) Watch(ctx context.Context, namespace, resourceVersion string) (watch.Interface, error) {
+	return w.kube.CoreV1().Secrets(namespace).Watch(ctx, metav1.ListOptions{ResourceVersion: resourceVersion})
+}
+
+// Option is used to configure *Cache.
+type Option func(*Cache)
+
+// WithWatcher specifies how the Cache should watch the namespaces of the
+// Secrets it caches, so that the Secrets that change are read again right
+// away rather than once their TTL passes.
+func WithWatcher(w Watcher) Option {
+	return func(c *Cache) {
+		c.watcher = w
+	}
+}
+
+// WithClock specifies the function that the Cache should use to get the
+// current time.
+func WithClock(now func() time.Time) Option {
+	return func(c *Cache) {
+		c.now = now
+	}
+}
+
+// WithLogger specifies how the Cache should log messages.
+func WithLogger(l logging.Logger) Option {
+	return func(c *Cache) {
+		c.log = l
+	}
+}
+
+// New returns a new *Cache that caches the Secrets read with the supplied
+// client for the supplied TTL.
+func New(kube client.Client, ttl time.Duration, opts ...Option) *Cache {
+	c := &Cache{
+		Client:  kube,
+		ttl:     ttl,
+		now:     time.Now,
+		log:     logging.NewNopLogger(),
+		entries: map[types.NamespacedName]entry{},
+		watched: map[string]string{},
+	}
+	for _, f := range opts {
+		f(c)
+	}
+	return c
+}
+
+type entry struct {
+	secret *corev1.Secret
+	read   time.Time
+}
+
+// A Cache is a client.Client that serves the Secrets it read in the last TTL
+// from memory instead of reading them again. Only the Secrets that exist are
+// cached, so that a Secret that's yet to be written is noticed as soon as
+// it's there. The Secrets written through the Cache are invalidated, and so
+// are the ones that the Watcher reports events of once the Cache is started.
+// Everything else is passed to the underlying client.
+type Cache struct {
+	client.Client
+
+	ttl     time.Duration
+	now     func() time.Time
+	watcher Watcher
+	log     logging.Logger
+
+	mu      sync.Mutex
+	ctx     context.Context
+	entries map[types.NamespacedName]entry
+	watched map[string]string
+
+	// invalidations counts the invalidations so that a Secret that is
+	// invalidated while it's read isn't cached.
+	invalidations uint64
+}
+
+// Get serves the supplied Secret from the cache if it was read in the last
+// TTL and reads it with the underlying client otherwise.
+func (c *Cache) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	s, ok := obj.(*corev1.Secret)
+	if !ok {
+		return c.Client.Get(ctx, key, obj)
+	}
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && c.now().Sub(e.read) < c.ttl {
+		metrics.RemoteSecretReads.WithLabelValues(SourceCache).Inc()
+		e.secret.DeepCopyInto(s)
+		return nil
+	}
+	metrics.RemoteSecretReads.WithLabelValues(SourceRemote).Inc()
+	c.mu.Lock()
+	invalidations := c.invalidations
+	c.mu.Unlock()
+	if err := c.Client.Get(ctx, key, s); err != nil {
+		c.Invalidate(key)
+		return err
+	}
+	c.mu.Lock()
+	if c.invalidations == invalidations {
+		c.entries[key] = entry{secret: s.DeepCopy(), read: c.now()}
+	}
+	c.mu.Unlock()
+	c.watch(key.Namespace, s.GetResourceVersion())
+	return nil
+}
+
+// Create creates the supplied object and invalidates it if it's a Secret.
+func (c *Cache) Create(ctx context.Context, obj runtime.Object, opts ...client.CreateOption) error {
+	defer c.invalidateObject(obj)
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+// Update updates the supplied object and invalidates it if it's a Secret.
+func (c *Cache) Update(ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	defer c.invalidateObject(obj)
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+// Patch patches the supplied object and invalidates it if it's a Secret.
+func (c *Cache) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	defer c.invalidateObject(obj)
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+// Delete deletes the supplied object and invalidates it if it's a Secret.
+func (c *Cache) Delete(ctx context.Context, obj runtime.Object, opts ...client.DeleteOption) error {
+	defer c.invalidateObject(obj)
+	return c.Client.Delete(ctx, obj, opts...)
+}
+
+// Invalidate removes the Secret with the supplied key from the cache, so that
+// it's read again the next time.
+func (c *Cache) Invalidate(key types.NamespacedName) {
+	c.mu.Lock()
+	delete(c.entries, key)
+	c.invalidations++
+	c.mu.Unlock()
+}
+
+func (c *Cache) invalidateObject(obj runtime.Object) {
+	if s, ok := obj.(*corev1.Secret); ok {
+		c.Invalidate(types.NamespacedName{Namespace: s.GetNamespace(), Name: s.GetName()})
+	}
+}
+
+func (c *Cache) invalidateNamespace(namespace string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.invalidations++
+	for k := range c.entries {
+		if k.Namespace == namespace {
+			delete(c.entries, k)
+		}
+	}
+}
+
+// Start lets the Cache watch the namespaces of the Secrets it caches until the
+// supplied channel is closed.
+func (c *Cache) Start(stop <-chan struct{}) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.mu.Lock()
+	c.ctx = ctx
+	watched := c.watched
+	c.watched = map[string]string{}
+	c.mu.Unlock()
+	for ns, rv := range watched {
+		c.watch(ns, rv)
+	}
+	<-stop
+	cancel()
+	return nil
+}
+
+// watch starts watching the Secrets in the supplied namespace from the
+// supplied resource version, i.e. that of the first Secret read in it, unless
+// they're already watched, so that the changes made since the read aren't
+// missed. A namespace whose Secrets cannot be watched, e.g. because the agent
+// isn't allowed to, is tried again after the TTL, and its Secrets are only
+// invalidated once their TTL passes in the meantime.
+func (c *Cache) watch(namespace, resourceVersion string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.watcher == nil {
+		return
+	}
+	if _, ok := c.watched[namespace]; ok {
+		return
+	}
+	c.watched[namespace] = resourceVersion
+	// The namespaces are recorded until the Cache is started so that they're
+	// watched once it is.
+	if c.ctx == nil {
+		return
+	}
+	go c.run(c.ctx, namespace, resourceVersion)
+}
+
+func (c *Cache) run(ctx context.Context, namespace, resourceVersion string) {
+	log := c.log.WithValues("namespace", namespace)
+	for {
+		w, err := c.watcher.Watch(ctx, namespace, resourceVersion)
+		if err == nil {
+			c.consume(w)
+		}
+		// The events may have been missed until the watch is established
+		// again, e.g. because the resource version is too old to watch from.
+		// The namespace is watched from its current state from then on, which
+		// reports every Secret in it as added.
+		c.invalidateNamespace(namespace)
+		resourceVersion = ""
+		wait := rewatchWait
+		if err != nil {
+			log.Debug("Cannot watch remote secrets, relying on their TTL", "error", err)
+			wait = c.ttl
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (c *Cache) consume(w watch.Interface) {
+	defer w.Stop()
+	for ev := range w.ResultChan() {
+		if ev.Type == watch.Error {
+			return
+		}
+		c.invalidateObject(ev.Object)
+	}
+}
@@ -0,0 +1,181 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretcache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+)
+
+type watcherFn func(ctx context.Context, namespace, resourceVersion string) (watch.Interface, error)
+
+func (fn watcherFn) Watch(ctx context.Context, namespace, resourceVersion string) (watch.Interface, error) {
+	return fn(ctx, namespace, resourceVersion)
+}
+
+func TestCacheGet(t *testing.T) {
+	key := types.NamespacedName{Namespace: "remote-ns", Name: "db-conn"}
+	type step struct {
+		// after is how long after the first read the step is taken.
+		after      time.Duration
+		invalidate bool
+		// race invalidates the Secret while it's read.
+		race   bool
+		exists bool
+	}
+	cases := map[string]struct {
+		reason string
+		steps  []step
+		want   int
+	}{
+		"Cached": {
+			reason: "A Secret read within its TTL should be served from the cache",
+			steps:  []step{{exists: true}, {after: 30 * time.Second, exists: true}},
+			want:   1,
+		},
+		"Expired": {
+			reason: "A Secret should be read again once its TTL passes",
+			steps:  []step{{exists: true}, {after: time.Minute, exists: true}},
+			want:   2,
+		},
+		"NotFoundNotCached": {
+			reason: "A Secret that doesn't exist yet should be read again right away",
+			steps:  []step{{}, {exists: true}},
+			want:   2,
+		},
+		"Invalidated": {
+			reason: "An invalidated Secret should be read again right away",
+			steps:  []step{{exists: true}, {invalidate: true, exists: true}},
+			want:   2,
+		},
+		"InvalidatedWhileRead": {
+			reason: "A Secret that is invalidated while it's read shouldn't be cached",
+			steps:  []step{{race: true, exists: true}, {exists: true}},
+			want:   2,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			start := time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+			now := start
+			reads := 0
+			exists := false
+			race := false
+			var c *Cache
+			kube := &test.MockClient{MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+				reads++
+				if race {
+					c.Invalidate(key)
+				}
+				if !exists {
+					return kerrors.NewNotFound(schema.GroupResource{Resource: "secrets"}, key.Name)
+				}
+				obj.(*corev1.Secret).Data = map[string][]byte{"password": []byte("pass")}
+				return nil
+			}}
+			c = New(kube, time.Minute, WithClock(func() time.Time { return now }))
+			for _, s := range tc.steps {
+				now = start.Add(s.after)
+				exists = s.exists
+				race = s.race
+				if s.invalidate {
+					c.Invalidate(key)
+				}
+				_ = c.Get(context.Background(), key, &corev1.Secret{})
+			}
+			if diff := cmp.Diff(tc.want, reads); diff != "" {
+				t.Errorf("\nReason: %s\nc.Get(...): -want remote reads, +got remote reads:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestCacheWrite(t *testing.T) {
+	key := types.NamespacedName{Namespace: "remote-ns", Name: "db-conn"}
+	reads := 0
+	kube := &test.MockClient{
+		MockGet:    func(_ context.Context, _ client.ObjectKey, _ runtime.Object) error { reads++; return nil },
+		MockUpdate: test.NewMockUpdateFn(nil),
+	}
+	c := New(kube, time.Minute)
+	_ = c.Get(context.Background(), key, &corev1.Secret{})
+	s := &corev1.Secret{}
+	s.SetNamespace(key.Namespace)
+	s.SetName(key.Name)
+	_ = c.Update(context.Background(), s)
+	_ = c.Get(context.Background(), key, &corev1.Secret{})
+	if diff := cmp.Diff(2, reads); diff != "" {
+		t.Errorf("\nReason: %s\nc.Get(...): -want remote reads, +got remote reads:\n%s", "A Secret written through the cache should be read again", diff)
+	}
+}
+
+func TestCacheWatch(t *testing.T) {
+	key := types.NamespacedName{Namespace: "remote-ns", Name: "db-conn"}
+	reads := 0
+	kube := &test.MockClient{MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+		reads++
+		obj.(*corev1.Secret).SetResourceVersion("42")
+		return nil
+	}}
+	fw := watch.NewFake()
+	watching := make(chan struct{})
+	c := New(kube, time.Hour, WithWatcher(watcherFn(func(_ context.Context, namespace, resourceVersion string) (watch.Interface, error) {
+		if namespace != key.Namespace {
+			t.Errorf("Watch(...): want namespace %s, got %s", key.Namespace, namespace)
+		}
+		// The changes made since the Secret was read would be missed if the
+		// namespace were watched from its current state.
+		if resourceVersion != "42" {
+			t.Errorf("Watch(...): want resource version 42, got %s", resourceVersion)
+		}
+		close(watching)
+		return fw, nil
+	})))
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() { _ = c.Start(stop) }()
+
+	// The namespace is watched once a Secret of it is cached, whether the
+	// Cache is started before or after.
+	_ = c.Get(context.Background(), key, &corev1.Secret{})
+	<-watching
+	_ = c.Get(context.Background(), key, &corev1.Secret{})
+
+	s := &corev1.Secret{}
+	s.SetNamespace(key.Namespace)
+	s.SetName(key.Name)
+	// The fake watcher blocks until an event is received, so the first one
+	// is handled once the second one is sent.
+	fw.Modify(s)
+	fw.Modify(s)
+	_ = c.Get(context.Background(), key, &corev1.Secret{})
+	if diff := cmp.Diff(2, reads); diff != "" {
+		t.Errorf("\nReason: %s\nc.Get(...): -want remote reads, +got remote reads:\n%s", "A Secret that the watch reports an event of should be read again", diff)
+	}
+}
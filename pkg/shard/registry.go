@@ -0,0 +1,229 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shard
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+
+	"github.com/crossplane/agent/pkg/resource"
+)
+
+const (
+	defaultInterval = 30 * time.Second
+
+	// leaseIntervals is how many intervals a shard is considered live after
+	// its last renewal.
+	leaseIntervals = 3
+
+	errGetRegistry    = "cannot get shard registry configmap"
+	errCreateRegistry = "cannot create shard registry configmap"
+	errUpdateRegistry = "cannot update shard registry configmap"
+	errFmtParseEntry  = "cannot parse the entry of shard %s"
+	errFmtOverlap     = "shard %s overlaps shard %s, which was registered first"
+)
+
+// RegistryOption is used to configure *Registry.
+type RegistryOption func(*Registry)
+
+// WithInterval specifies how often the Registry should renew the registration
+// of its shard. A shard that isn't renewed for three intervals is considered
+// gone.
+func WithInterval(d time.Duration) RegistryOption {
+	return func(r *Registry) {
+		r.interval = d
+	}
+}
+
+// WithLogger specifies how the Registry should log messages.
+func WithLogger(l logging.Logger) RegistryOption {
+	return func(r *Registry) {
+		r.log = l
+	}
+}
+
+// NewRegistry returns a new *Registry that registers the supplied shard in the
+// referenced ConfigMap.
+func NewRegistry(kube client.Client, ref types.NamespacedName, s *Shard, opts ...RegistryOption) *Registry {
+	r := &Registry{
+		kube:     kube,
+		ref:      ref,
+		shard:    s,
+		interval: defaultInterval,
+		log:      logging.NewNopLogger(),
+		now:      time.Now,
+	}
+	for _, f := range opts {
+		f(r)
+	}
+	return r
+}
+
+// A Registry is a manager.Runnable that keeps the shard of an agent registered
+// in a ConfigMap that all agent deployments of the local cluster share, so
+// that no claim is synced by two of them. The shards that overlap the ones
+// that were registered before them are refused.
+type Registry struct {
+	kube     client.Client
+	ref      types.NamespacedName
+	shard    *Shard
+	interval time.Duration
+	log      logging.Logger
+	now      func() time.Time
+
+	since metav1.Time
+}
+
+// entry is how a shard is recorded in the registry, keyed by its name.
+type entry struct {
+	Index    int      `json:"index,omitempty"`
+	Count    int      `json:"count,omitempty"`
+	Selector string   `json:"selector,omitempty"`
+	Kinds    []string `json:"kinds,omitempty"`
+
+	Since   metav1.Time `json:"since"`
+	Renewed metav1.Time `json:"renewed"`
+}
+
+// Start renews the registration of the shard until the stop channel is
+// closed. It returns an error, which stops the agent, if the shard turns out
+// to overlap one that was registered before it.
+func (r *Registry) Start(stop <-chan struct{}) error {
+	ctx, stopped := resource.ContextFromStop(stop)
+	defer stopped()
+	t := time.NewTicker(r.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-t.C:
+		}
+		rctx, cancel := context.WithTimeout(ctx, r.interval)
+		err := r.Register(rctx)
+		cancel()
+		if isOverlap(err) {
+			return err
+		}
+		if err != nil {
+			r.log.Info("Cannot renew shard registration", "error", err, "configmap", r.ref.String())
+		}
+	}
+}
+
+// Register records the shard in the registry, or returns an error if it
+// overlaps a live shard that was registered before it. The shards that
+// weren't renewed in time are dropped from the registry. The registration is
+// retried if another shard wrote the registry since it was read, e.g. because
+// the agent deployments started together.
+func (r *Registry) Register(ctx context.Context) error {
+	return retry.OnError(retry.DefaultRetry, func(err error) bool {
+		err = errors.Cause(err)
+		return kerrors.IsConflict(err) || kerrors.IsAlreadyExists(err)
+	}, func() error {
+		return r.register(ctx)
+	})
+}
+
+func (r *Registry) register(ctx context.Context) error {
+	cm := &corev1.ConfigMap{}
+	err := r.kube.Get(ctx, r.ref, cm)
+	if kerrors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: r.ref.Namespace, Name: r.ref.Name}}
+	} else if err != nil {
+		return errors.Wrap(err, errGetRegistry)
+	}
+	// The times are recorded with second precision, so the shards that
+	// registered in the same second are ordered by their names.
+	now := metav1.NewTime(r.now().Truncate(time.Second))
+	if r.since.IsZero() {
+		r.since = now
+	}
+	data := map[string]string{}
+	for name, raw := range cm.Data {
+		if name == r.shard.Name {
+			continue
+		}
+		e := entry{}
+		if err := json.Unmarshal([]byte(raw), &e); err != nil {
+			return errors.Wrapf(err, errFmtParseEntry, name)
+		}
+		if now.Sub(e.Renewed.Time) > leaseIntervals*r.interval {
+			r.log.Debug("Dropping expired shard", "shard", name, "renewed", e.Renewed)
+			continue
+		}
+		data[name] = raw
+		other, err := e.shard(name)
+		if err != nil {
+			return errors.Wrapf(err, errFmtParseEntry, name)
+		}
+		first := e.Since.Before(&r.since) || (e.Since.Equal(&r.since) && name < r.shard.Name)
+		if first && r.shard.Overlaps(other) {
+			return overlap{error: errors.Errorf(errFmtOverlap, r.shard.Name, name)}
+		}
+	}
+	raw, err := json.Marshal(r.entry(now))
+	if err != nil {
+		return err
+	}
+	data[r.shard.Name] = string(raw)
+	cm.Data = data
+	if cm.GetResourceVersion() == "" {
+		return errors.Wrap(r.kube.Create(ctx, cm), errCreateRegistry)
+	}
+	// The ConfigMap is updated with the version it was read at so that the
+	// shards registering at the same time don't overwrite each other.
+	return errors.Wrap(r.kube.Update(ctx, cm), errUpdateRegistry)
+}
+
+func (r *Registry) entry(now metav1.Time) entry {
+	e := entry{Index: r.shard.Index, Count: r.shard.Count, Selector: r.shard.Selector, Since: r.since, Renewed: now}
+	for _, gk := range r.shard.Kinds {
+		e.Kinds = append(e.Kinds, gk.String())
+	}
+	return e
+}
+
+func (e entry) shard(name string) (*Shard, error) {
+	s := Shard{Name: name, Index: e.Index, Count: e.Count, Selector: e.Selector}
+	for _, k := range e.Kinds {
+		s.Kinds = append(s.Kinds, schema.ParseGroupKind(k))
+	}
+	return New(s)
+}
+
+// overlap is the error of a shard that overlaps another one.
+type overlap struct {
+	error
+}
+
+func isOverlap(err error) bool {
+	_, ok := err.(overlap)
+	return ok
+}
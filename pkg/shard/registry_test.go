@@ -0,0 +1,146 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shard
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+)
+
+func TestRegister(t *testing.T) {
+	errBoom := errors.New("boom")
+	now := time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+	ref := types.NamespacedName{Namespace: "crossplane-system", Name: "agent-shards"}
+	raw := func(e entry) string {
+		b, _ := json.Marshal(e)
+		return string(b)
+	}
+	at := func(d time.Duration) metav1.Time { return metav1.NewTime(now.Add(d)) }
+
+	type want struct {
+		err    error
+		shards []string
+	}
+	cases := map[string]struct {
+		reason string
+		data   map[string]string
+		get    error
+
+		// conflicts is how many updates of the registry conflict.
+		conflicts int
+
+		want want
+	}{
+		"NoRegistry": {
+			reason: "The registry should be created with the shard if it doesn't exist",
+			get:    kerrors.NewNotFound(schema.GroupResource{}, ref.Name),
+			want:   want{shards: []string{"gold"}},
+		},
+		"GetError": {
+			reason: "Errors getting the registry should be returned",
+			get:    errBoom,
+			want:   want{err: errors.Wrap(errBoom, errGetRegistry)},
+		},
+		"Disjoint": {
+			reason: "The shard should be registered along with the live shards it doesn't overlap",
+			data:   map[string]string{"silver": raw(entry{Selector: "tier=silver", Since: at(-time.Hour), Renewed: at(-time.Second)})},
+			want:   want{shards: []string{"gold", "silver"}},
+		},
+		"Overlap": {
+			reason: "The shard should be refused if it overlaps a live shard that was registered before it",
+			data:   map[string]string{"all": raw(entry{Since: at(-time.Hour), Renewed: at(-time.Second)})},
+			want:   want{err: overlap{error: errors.Errorf(errFmtOverlap, "gold", "all")}},
+		},
+		"Expired": {
+			reason: "The shards that weren't renewed in time should be dropped rather than refuse the shard",
+			data:   map[string]string{"all": raw(entry{Since: at(-time.Hour), Renewed: at(-time.Hour)})},
+			want:   want{shards: []string{"gold"}},
+		},
+		"RegisteredLater": {
+			reason: "The shards that were registered after the shard should be left to refuse themselves",
+			data:   map[string]string{"all": raw(entry{Since: at(time.Second), Renewed: at(time.Second)})},
+			want:   want{shards: []string{"all", "gold"}},
+		},
+		"Conflict": {
+			reason:    "The registration should be retried if another shard wrote the registry since it was read",
+			data:      map[string]string{"silver": raw(entry{Selector: "tier=silver", Since: at(-time.Hour), Renewed: at(-time.Second)})},
+			conflicts: 2,
+			want:      want{shards: []string{"gold", "silver"}},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var written *corev1.ConfigMap
+			conflicts := tc.conflicts
+			kube := &test.MockClient{
+				MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+					if tc.get != nil {
+						return tc.get
+					}
+					cm := obj.(*corev1.ConfigMap)
+					cm.SetResourceVersion("1")
+					cm.Data = tc.data
+					return nil
+				},
+				MockCreate: func(_ context.Context, obj runtime.Object, _ ...client.CreateOption) error {
+					written = obj.(*corev1.ConfigMap)
+					return nil
+				},
+				MockUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+					if conflicts > 0 {
+						conflicts--
+						return kerrors.NewConflict(schema.GroupResource{Resource: "configmaps"}, ref.Name, errBoom)
+					}
+					written = obj.(*corev1.ConfigMap)
+					return nil
+				},
+			}
+			s := mustNew(t, Shard{Name: "gold", Selector: "tier=gold"})
+			r := NewRegistry(kube, ref, s)
+			r.now = func() time.Time { return now }
+			err := r.Register(context.Background())
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\nRegister(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			var got []string
+			if written != nil {
+				for name := range written.Data {
+					got = append(got, name)
+				}
+				sort.Strings(got)
+			}
+			if diff := cmp.Diff(tc.want.shards, got); diff != "" {
+				t.Errorf("\nReason: %s\nRegister(...): -want shards, +got shards:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package shard splits the claims of a local cluster between several agent
+// deployments, each of which syncs only the claims of its shard.
+package shard
+
+import (
+	"hash/fnv"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+const (
+	errFmtIndex    = "shard index %d is not less than the shard count %d"
+	errParseSelect = "cannot parse shard selector"
+)
+
+// A Shard is the part of the claims of the local cluster that an agent syncs.
+// The claims are split by the hash of their namespace and name, by their
+// labels, by their kinds or by any combination of them; a claim belongs to the
+// shard only if it matches all of them.
+type Shard struct {
+	// Name identifies the shard in the registry, e.g. the name of the agent
+	// deployment.
+	Name string
+
+	// Index is the index of the shard among Count shards that the claims are
+	// split into by the hash of their namespace and name. The claims aren't
+	// split by hash if Count is 0.
+	Index int
+	Count int
+
+	// Selector selects the claims of the shard by their labels. The claims
+	// aren't split by label if it's empty.
+	Selector string
+
+	// Kinds are the claim kinds of the shard. The claims aren't split by kind
+	// if there are none.
+	Kinds []schema.GroupKind
+
+	selector labels.Selector
+}
+
+// New returns the supplied shard if it's valid.
+func New(s Shard) (*Shard, error) {
+	if s.Count > 0 && (s.Index < 0 || s.Index >= s.Count) {
+		return nil, errors.Errorf(errFmtIndex, s.Index, s.Count)
+	}
+	sel, err := labels.Parse(s.Selector)
+	if err != nil {
+		return nil, errors.Wrap(err, errParseSelect)
+	}
+	s.selector = sel
+	return &s, nil
+}
+
+// Owns returns whether the supplied claim of the supplied kind belongs to the
+// shard.
+func (s *Shard) Owns(o metav1.Object, gk schema.GroupKind) bool {
+	if !s.OwnsKind(gk) {
+		return false
+	}
+	if s.Count > 0 && int(Hash(o.GetNamespace(), o.GetName())%uint32(s.Count)) != s.Index {
+		return false
+	}
+	return s.selector == nil || s.selector.Matches(labels.Set(o.GetLabels()))
+}
+
+// OwnsKind returns whether the claims of the supplied kind may belong to the
+// shard, i.e. whether the agent of the shard syncs their CRD.
+func (s *Shard) OwnsKind(gk schema.GroupKind) bool {
+	return len(s.Kinds) == 0 || containsKind(s.Kinds, gk)
+}
+
+// Predicate returns a predicate that lets only the events of the claims of
+// the shard pass.
+func (s *Shard) Predicate() predicate.Funcs {
+	return predicate.NewPredicateFuncs(func(meta metav1.Object, object runtime.Object) bool {
+		return s.Owns(meta, object.GetObjectKind().GroupVersionKind().GroupKind())
+	})
+}
+
+// Overlaps returns whether a claim may belong to both the shard and the
+// supplied one. Label selectors are only known to be disjoint if they require
+// different values or the presence and the absence of the same label, so the
+// shards that cannot be proven disjoint are considered overlapping.
+func (s *Shard) Overlaps(o *Shard) bool {
+	if len(s.Kinds) > 0 && len(o.Kinds) > 0 && !kindsIntersect(s.Kinds, o.Kinds) {
+		return false
+	}
+	// Shards with different counts split the claims differently, so they
+	// may have any claim in common.
+	if s.Count > 0 && o.Count > 0 && s.Count == o.Count && s.Index != o.Index {
+		return false
+	}
+	return !disjoint(s.selector, o.selector)
+}
+
+// Hash returns the hash that the claim with the supplied namespace and name is
+// assigned to its shard with.
+func Hash(namespace, name string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(namespace + "/" + name))
+	return h.Sum32()
+}
+
+func containsKind(kinds []schema.GroupKind, gk schema.GroupKind) bool {
+	for _, k := range kinds {
+		if k == gk {
+			return true
+		}
+	}
+	return false
+}
+
+func kindsIntersect(a, b []schema.GroupKind) bool {
+	for _, k := range a {
+		if containsKind(b, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// disjoint returns whether no set of labels can be matched by both selectors.
+func disjoint(a, b labels.Selector) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	ra, _ := a.Requirements()
+	rb, _ := b.Requirements()
+	for i := range ra {
+		for j := range rb {
+			if ra[i].Key() == rb[j].Key() && exclusive(ra[i], rb[j]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// exclusive returns whether no value of a label can meet both requirements.
+func exclusive(a, b labels.Requirement) bool {
+	if a.Operator() == selection.DoesNotExist || b.Operator() == selection.DoesNotExist {
+		return requiresLabel(a) || requiresLabel(b)
+	}
+	va, oka := values(a)
+	vb, okb := values(b)
+	switch {
+	case oka && okb:
+		return va.Intersection(vb).Len() == 0
+	case oka && b.Operator() == selection.NotIn, oka && b.Operator() == selection.NotEquals:
+		return b.Values().IsSuperset(va)
+	case okb && a.Operator() == selection.NotIn, okb && a.Operator() == selection.NotEquals:
+		return a.Values().IsSuperset(vb)
+	}
+	return false
+}
+
+// values returns the values that the requirement allows, if it allows only
+// some values.
+func values(r labels.Requirement) (sets.String, bool) {
+	switch r.Operator() {
+	case selection.In, selection.Equals, selection.DoubleEquals:
+		return r.Values(), true
+	}
+	return nil, false
+}
+
+func requiresLabel(r labels.Requirement) bool {
+	switch r.Operator() {
+	case selection.NotIn, selection.NotEquals, selection.DoesNotExist:
+		return false
+	}
+	return true
+}
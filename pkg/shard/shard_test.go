@@ -0,0 +1,197 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shard
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var (
+	database = schema.GroupKind{Group: "database.example.org", Kind: "PostgreSQLInstance"}
+	bucket   = schema.GroupKind{Group: "storage.example.org", Kind: "Bucket"}
+)
+
+func mustNew(t *testing.T, s Shard) *Shard {
+	t.Helper()
+	sh, err := New(s)
+	if err != nil {
+		t.Fatalf("New(...): %s", err)
+	}
+	return sh
+}
+
+func TestNew(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		shard  Shard
+		valid  bool
+	}{
+		"Valid": {
+			reason: "A shard with an index less than its count and a valid selector should be valid",
+			shard:  Shard{Index: 1, Count: 2, Selector: "tier in (gold, silver)"},
+			valid:  true,
+		},
+		"IndexOutOfRange": {
+			reason: "A shard whose index isn't less than its count should be invalid",
+			shard:  Shard{Index: 2, Count: 2},
+		},
+		"InvalidSelector": {
+			reason: "A shard with an invalid selector should be invalid",
+			shard:  Shard{Selector: "tier in gold"},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(tc.shard)
+			if diff := cmp.Diff(tc.valid, err == nil); diff != "" {
+				t.Errorf("\nReason: %s\nNew(...): -want valid, +got valid:\n%s\nerror: %v", tc.reason, diff, err)
+			}
+		})
+	}
+}
+
+func TestOwns(t *testing.T) {
+	claim := &metav1.ObjectMeta{Namespace: "default", Name: "db", Labels: map[string]string{"tier": "gold"}}
+	index := int(Hash("default", "db") % 3)
+	cases := map[string]struct {
+		reason string
+		shard  Shard
+		kind   schema.GroupKind
+		want   bool
+	}{
+		"All": {
+			reason: "A shard that doesn't split the claims should own all of them",
+			kind:   database,
+			want:   true,
+		},
+		"Hash": {
+			reason: "A claim should belong to the shard that its hash is assigned to",
+			shard:  Shard{Index: index, Count: 3},
+			kind:   database,
+			want:   true,
+		},
+		"OtherHash": {
+			reason: "A claim shouldn't belong to the shards that its hash isn't assigned to",
+			shard:  Shard{Index: (index + 1) % 3, Count: 3},
+			kind:   database,
+		},
+		"Selector": {
+			reason: "A claim should belong to the shard whose selector matches its labels",
+			shard:  Shard{Selector: "tier=gold"},
+			kind:   database,
+			want:   true,
+		},
+		"OtherSelector": {
+			reason: "A claim shouldn't belong to the shards whose selectors don't match its labels",
+			shard:  Shard{Selector: "tier=silver"},
+			kind:   database,
+		},
+		"OtherKind": {
+			reason: "A claim shouldn't belong to the shards of other kinds",
+			shard:  Shard{Kinds: []schema.GroupKind{bucket}, Selector: "tier=gold"},
+			kind:   database,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := mustNew(t, tc.shard).Owns(claim, tc.kind)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\nReason: %s\nOwns(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestOverlaps(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		a      Shard
+		b      Shard
+		want   bool
+	}{
+		"DifferentIndexes": {
+			reason: "Shards with different indexes of the same count should be disjoint",
+			a:      Shard{Index: 0, Count: 2},
+			b:      Shard{Index: 1, Count: 2},
+		},
+		"SameIndex": {
+			reason: "Shards with the same index of the same count should overlap",
+			a:      Shard{Index: 1, Count: 2},
+			b:      Shard{Index: 1, Count: 2},
+			want:   true,
+		},
+		"DifferentCounts": {
+			reason: "Shards that split the claims into different counts should overlap",
+			a:      Shard{Index: 0, Count: 2},
+			b:      Shard{Index: 1, Count: 3},
+			want:   true,
+		},
+		"DifferentValues": {
+			reason: "Shards whose selectors require different values of a label should be disjoint",
+			a:      Shard{Selector: "tier=gold"},
+			b:      Shard{Selector: "tier in (silver, bronze)"},
+		},
+		"ExcludedValues": {
+			reason: "Shards whose selectors require and exclude the same values of a label should be disjoint",
+			a:      Shard{Selector: "tier=gold"},
+			b:      Shard{Selector: "tier!=gold"},
+		},
+		"Absence": {
+			reason: "Shards whose selectors require the presence and the absence of a label should be disjoint",
+			a:      Shard{Selector: "tier"},
+			b:      Shard{Selector: "!tier"},
+		},
+		"DifferentLabels": {
+			reason: "Shards whose selectors require different labels should overlap",
+			a:      Shard{Selector: "tier=gold"},
+			b:      Shard{Selector: "team=payments"},
+			want:   true,
+		},
+		"HashAndSelector": {
+			reason: "A shard split by hash and one split by label should overlap",
+			a:      Shard{Index: 0, Count: 2},
+			b:      Shard{Selector: "tier=gold"},
+			want:   true,
+		},
+		"DifferentKinds": {
+			reason: "Shards of different kinds should be disjoint",
+			a:      Shard{Kinds: []schema.GroupKind{database}},
+			b:      Shard{Kinds: []schema.GroupKind{bucket}},
+		},
+		"AllKinds": {
+			reason: "A shard of all kinds should overlap a shard of some kinds",
+			a:      Shard{},
+			b:      Shard{Kinds: []schema.GroupKind{bucket}},
+			want:   true,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			a, b := mustNew(t, tc.a), mustNew(t, tc.b)
+			if diff := cmp.Diff(tc.want, a.Overlaps(b)); diff != "" {
+				t.Errorf("\nReason: %s\na.Overlaps(b): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want, b.Overlaps(a)); diff != "" {
+				t.Errorf("\nReason: %s\nb.Overlaps(a): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package snapshot keeps a summary of the last state of the remote claims
+// that the agent observed in memory, so that the mismatches between the local
+// and the remote claims can be narrowed down without access to the remote
+// cluster.
+package snapshot
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	defaultMaxObjects = 10000
+
+	errMarshal = "cannot marshal remote object"
+)
+
+// A Key identifies the local object whose remote counterpart is observed.
+type Key struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+}
+
+// A Recorder records the last observed state of remote objects.
+type Recorder interface {
+	// Observe records the supplied state of the remote counterpart of the
+	// supplied local object.
+	Observe(k Key, remote *unstructured.Unstructured)
+
+	// Forget forgets the remote counterpart of the supplied local object,
+	// e.g. because the local object is gone.
+	Forget(k Key)
+}
+
+// NewNopRecorder returns a Recorder that does nothing.
+func NewNopRecorder() Recorder {
+	return nopRecorder{}
+}
+
+type nopRecorder struct{}
+
+func (nopRecorder) Observe(_ Key, _ *unstructured.Unstructured) {}
+
+func (nopRecorder) Forget(_ Key) {}
+
+// StoreOption is used to configure *Store.
+type StoreOption func(*Store)
+
+// WithMaxObjects specifies how many objects the Store should keep the
+// snapshots of. The objects that weren't observed for the longest time are
+// forgotten first.
+func WithMaxObjects(n int) StoreOption {
+	return func(s *Store) {
+		s.maxObjects = n
+	}
+}
+
+// NewStore returns a new *Store.
+func NewStore(opts ...StoreOption) *Store {
+	s := &Store{
+		maxObjects: defaultMaxObjects,
+		snapshots:  map[Key]*list.Element{},
+		observed:   list.New(),
+	}
+	for _, f := range opts {
+		f(s)
+	}
+	return s
+}
+
+// Store is a Recorder that keeps the summary of the last observed state of
+// every remote object and serves them over HTTP. The state itself isn't kept
+// since the summaries are served on the metrics endpoint, which is often open
+// to everyone in the cluster.
+type Store struct {
+	maxObjects int
+
+	mu        sync.Mutex
+	snapshots map[Key]*list.Element
+	// observed holds the *Summary of every object, the most recently
+	// observed one first.
+	observed *list.List
+}
+
+// A Summary describes the snapshot of a remote object.
+type Summary struct {
+	Key
+	ResourceVersion string    `json:"resourceVersion"`
+	Observed        time.Time `json:"observed"`
+	SHA256          string    `json:"sha256"`
+}
+
+// Observe records the supplied state of the remote counterpart of the supplied
+// local object, whose sum is taken without its managed fields. The sum is
+// taken only if its resource version changed since it was last observed. It's
+// safe for concurrent use.
+func (s *Store) Observe(k Key, remote *unstructured.Unstructured) {
+	now := time.Now()
+	s.mu.Lock()
+	if e, ok := s.snapshots[k]; ok && e.Value.(*Summary).ResourceVersion == remote.GetResourceVersion() {
+		e.Value.(*Summary).Observed = now
+		s.observed.MoveToFront(e)
+		s.mu.Unlock()
+		return
+	}
+	s.mu.Unlock()
+
+	obj := remote.DeepCopy()
+	unstructured.RemoveNestedField(obj.Object, "metadata", "managedFields")
+	sum, err := sha256Of(obj)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ss := &Summary{Key: k, ResourceVersion: remote.GetResourceVersion(), Observed: now, SHA256: sum}
+	if e, ok := s.snapshots[k]; ok {
+		e.Value = ss
+		s.observed.MoveToFront(e)
+		return
+	}
+	s.evict()
+	s.snapshots[k] = s.observed.PushFront(ss)
+}
+
+// Forget forgets the snapshot of the remote counterpart of the supplied local
+// object. It's safe for concurrent use.
+func (s *Store) Forget(k Key) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.snapshots[k]; ok {
+		s.observed.Remove(e)
+		delete(s.snapshots, k)
+	}
+}
+
+// sha256Of returns the SHA-256 sum of the YAML of the supplied object.
+func sha256Of(obj *unstructured.Unstructured) (string, error) {
+	y, err := yaml.Marshal(obj.Object)
+	if err != nil {
+		return "", errors.Wrap(err, errMarshal)
+	}
+	sum := sha256.Sum256(y)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// evict forgets the object that wasn't observed for the longest time if the
+// Store is full. It has to be called with the lock held.
+func (s *Store) evict() {
+	if s.maxObjects <= 0 || s.observed.Len() < s.maxObjects {
+		return
+	}
+	e := s.observed.Back()
+	s.observed.Remove(e)
+	delete(s.snapshots, e.Value.(*Summary).Key)
+}
+
+// List returns the summaries of the snapshots of the objects that match the
+// supplied key. Empty fields of the key match all objects. The summaries are
+// sorted by kind, namespace and name.
+func (s *Store) List(filter Key) []Summary {
+	s.mu.Lock()
+	out := make([]Summary, 0, len(s.snapshots))
+	for k, e := range s.snapshots {
+		if matches(filter, k) {
+			out = append(out, *e.Value.(*Summary))
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i].Key, out[j].Key
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	return out
+}
+
+func matches(filter, k Key) bool {
+	return (filter.Kind == "" || filter.Kind == k.Kind) &&
+		(filter.Namespace == "" || filter.Namespace == k.Namespace) &&
+		(filter.Name == "" || filter.Name == k.Name)
+}
+
+// ServeHTTP writes the summaries of the snapshots as JSON. The kind, namespace
+// and name query parameters narrow them down to the matching objects.
+func (s *Store) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	q := req.URL.Query()
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(s.List(Key{Kind: q.Get("kind"), Namespace: q.Get("namespace"), Name: q.Get("name")}))
+}
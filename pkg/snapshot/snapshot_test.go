@@ -0,0 +1,142 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snapshot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func remote(rv, size string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "database.example.org/v1alpha1",
+		"kind":       "Database",
+		"metadata": map[string]interface{}{
+			"name":            "db",
+			"resourceVersion": rv,
+			"managedFields":   []interface{}{map[string]interface{}{"manager": "agent"}},
+		},
+		"spec": map[string]interface{}{"size": size},
+	}}
+	return u
+}
+
+func TestStore(t *testing.T) {
+	db := Key{Kind: "Database", Namespace: "cool", Name: "db"}
+	bucket := Key{Kind: "Bucket", Namespace: "cool", Name: "bucket"}
+	other := Key{Kind: "Database", Namespace: "other", Name: "db"}
+
+	type observation struct {
+		key    Key
+		remote *unstructured.Unstructured
+	}
+	cases := map[string]struct {
+		reason       string
+		opts         []StoreOption
+		observations []observation
+		forget       []Key
+		filter       Key
+		want         []Key
+	}{
+		"Filtered": {
+			reason:       "Only the objects that match the filter should be listed, sorted by kind, namespace and name",
+			observations: []observation{{other, remote("1", "small")}, {bucket, remote("1", "small")}, {db, remote("1", "small")}},
+			filter:       Key{Kind: "Database"},
+			want:         []Key{db, other},
+		},
+		"Evicted": {
+			reason:       "The object that wasn't observed for the longest time should be forgotten once there are more than the maximum",
+			opts:         []StoreOption{WithMaxObjects(2)},
+			observations: []observation{{db, remote("1", "small")}, {bucket, remote("1", "small")}, {db, remote("2", "large")}, {other, remote("1", "small")}},
+			want:         []Key{db, other},
+		},
+		"Forgotten": {
+			reason:       "The objects that are forgotten should no longer be listed",
+			observations: []observation{{db, remote("1", "small")}, {bucket, remote("1", "small")}},
+			forget:       []Key{bucket, other},
+			want:         []Key{db},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			s := NewStore(tc.opts...)
+			for _, o := range tc.observations {
+				s.Observe(o.key, o.remote)
+			}
+			for _, k := range tc.forget {
+				s.Forget(k)
+			}
+			got := []Key{}
+			for _, sum := range s.List(tc.filter) {
+				got = append(got, sum.Key)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\nReason: %s\ns.List(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestStoreSum(t *testing.T) {
+	db := Key{Kind: "Database", Namespace: "cool", Name: "db"}
+	s := NewStore()
+	s.Observe(db, remote("1", "small"))
+	small := s.List(db)[0].SHA256
+	s.Observe(db, remote("2", "large"))
+	large := s.List(db)[0].SHA256
+
+	// The sum of the YAML of the remote object without its managed fields.
+	want := sha256.Sum256([]byte(`apiVersion: database.example.org/v1alpha1
+kind: Database
+metadata:
+  name: db
+  resourceVersion: "2"
+spec:
+  size: large
+`))
+	if diff := cmp.Diff(hex.EncodeToString(want[:]), large); diff != "" {
+		t.Errorf("\nReason: %s\ns.List(...): -want, +got:\n%s", "The sum of the last observed state should be listed without its managed fields", diff)
+	}
+	if small == large {
+		t.Errorf("\nReason: %s\ns.List(...): the sum didn't change", "The sum should change with the observed state")
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	db := Key{Kind: "Database", Namespace: "cool", Name: "db"}
+	s := NewStore()
+	s.Observe(db, remote("1", "small"))
+	s.Observe(Key{Kind: "Bucket", Namespace: "cool", Name: "bucket"}, remote("1", "small"))
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/debug/remote-claims?kind=Database", nil))
+	got := []Summary{}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal(...): %s", err)
+	}
+	want := []Summary{{Key: db, ResourceVersion: "1"}}
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreFields(Summary{}, "Observed", "SHA256")); diff != "" {
+		t.Errorf("\nReason: %s\ns.ServeHTTP(...): -want, +got:\n%s", "Only the summaries of the objects that match the query should be served", diff)
+	}
+}
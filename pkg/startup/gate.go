@@ -0,0 +1,387 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package startup tells when the initial sync of the agent is complete, so
+// that bootstrap pipelines can wait for the platform APIs to be available in
+// the local cluster before deploying applications.
+package startup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+
+	"github.com/crossplane/agent/pkg/resource"
+)
+
+const (
+	errFmtNotSynced   = "initial sync is %d%% complete, waiting for %v"
+	errWriteSignal    = "cannot write signal file"
+	errFmtListPending = "cannot list the objects of %s to sync"
+
+	defaultPollInterval = 2 * time.Second
+	defaultTimeout      = 10 * time.Minute
+
+	// progressLogInterval is how often the progress of the initial sync is
+	// logged at most.
+	progressLogInterval = 10 * time.Second
+)
+
+// SyncStatus is the progress of the initial sync.
+type SyncStatus struct {
+	// Complete is whether the initial sync is complete.
+	Complete bool `json:"complete"`
+
+	// Percent is the share of the objects to sync that are synced. The
+	// kinds whose objects aren't listed yet aren't included, but it's less
+	// than 100 until the initial sync is complete.
+	Percent int `json:"percent"`
+
+	// Kinds is the progress of every kind, sorted by kind.
+	Kinds []KindProgress `json:"kinds"`
+
+	// Conditions report why the initial sync isn't complete, e.g. that the
+	// Gate stopped waiting for it.
+	Conditions []v1alpha1.Condition `json:"conditions,omitempty"`
+}
+
+// KindProgress is the progress of the initial sync of the objects of a kind.
+type KindProgress struct {
+	Kind string `json:"kind"`
+
+	// Listed is whether the objects of the kind to sync are listed yet.
+	// Total is unknown until they are.
+	Listed  bool `json:"listed"`
+	Synced  int  `json:"synced"`
+	Total   int  `json:"total"`
+	Percent int  `json:"percent"`
+}
+
+// A ListFn returns the names of the objects of a kind that have to be synced
+// for the initial sync to be complete.
+type ListFn func(ctx context.Context) ([]string, error)
+
+// GateOption is used to configure *Gate.
+type GateOption func(*Gate)
+
+// WithSignalFile specifies a file that the Gate should write once the initial
+// sync is complete, e.g. for a pipeline to wait for.
+func WithSignalFile(path string) GateOption {
+	return func(g *Gate) {
+		g.file = path
+	}
+}
+
+// WithLogger specifies how the Gate should log messages.
+func WithLogger(l logging.Logger) GateOption {
+	return func(g *Gate) {
+		g.log = l
+	}
+}
+
+// WithPollInterval specifies how often the Gate should check whether the
+// initial sync is complete.
+func WithPollInterval(d time.Duration) GateOption {
+	return func(g *Gate) {
+		g.interval = d
+	}
+}
+
+// WithTimeout specifies how long the Gate should wait for the initial sync to
+// be complete. It stops waiting after that, so that objects that never sync
+// don't keep the agent from being ready forever.
+func WithTimeout(d time.Duration) GateOption {
+	return func(g *Gate) {
+		g.timeout = d
+	}
+}
+
+// NewGate returns a new *Gate.
+func NewGate(opts ...GateOption) *Gate {
+	g := &Gate{
+		interval: defaultPollInterval,
+		timeout:  defaultTimeout,
+		log:      logging.NewNopLogger(),
+		lists:    map[string]ListFn{},
+		synced:   map[string]map[string]bool{},
+	}
+	for _, f := range opts {
+		f(g)
+	}
+	return g
+}
+
+// A Gate is a manager.Runnable that tracks the initial sync of the agent. The
+// objects that exist when it starts, i.e. once the caches of the manager are
+// warmed up, have to be synced at least once for the initial sync to be
+// complete. It's a healthz.Checker that fails until then, or until it times
+// out.
+type Gate struct {
+	file     string
+	interval time.Duration
+	timeout  time.Duration
+	log      logging.Logger
+
+	mu       sync.Mutex
+	lists    map[string]ListFn
+	synced   map[string]map[string]bool
+	expected map[string][]string
+	done     bool
+	timedOut bool
+
+	loggedPercent int
+	loggedAt      time.Time
+}
+
+// Expect adds a kind whose objects, as listed by the supplied function, have
+// to be synced for the initial sync to be complete. It has to be called
+// before the Gate is started.
+func (g *Gate) Expect(kind string, fn ListFn) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.lists[kind] = fn
+}
+
+// Synced records that the named object of the kind is synced. It's safe for
+// concurrent use.
+func (g *Gate) Synced(kind, name string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.done || g.timedOut {
+		return
+	}
+	if g.synced[kind] == nil {
+		g.synced[kind] = map[string]bool{}
+	}
+	g.synced[kind][name] = true
+}
+
+// Done returns whether the initial sync is complete.
+func (g *Gate) Done() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.done
+}
+
+// Check returns an error until the initial sync is complete or the Gate timed
+// out waiting for it.
+func (g *Gate) Check(_ *http.Request) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.done || g.timedOut {
+		return nil
+	}
+	return errors.Errorf(errFmtNotSynced, g.status().Percent, g.pending())
+}
+
+// Status returns the progress of the initial sync.
+func (g *Gate) Status() SyncStatus {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.status()
+}
+
+// ServeHTTP writes the progress of the initial sync as JSON.
+func (g *Gate) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(g.Status())
+}
+
+// status returns the progress of the initial sync. It must be called with the
+// lock held.
+func (g *Gate) status() SyncStatus {
+	s := SyncStatus{Complete: g.done, Kinds: make([]KindProgress, 0, len(g.lists))}
+	synced, total, unlisted := 0, 0, false
+	for k := range g.lists {
+		p := KindProgress{Kind: k}
+		names, listed := g.expected[k]
+		unlisted = unlisted || !listed
+		if listed {
+			p.Listed = true
+			p.Total = len(names)
+			for _, n := range names {
+				// The synced objects are forgotten once the initial
+				// sync is complete.
+				if g.done || g.synced[k][n] {
+					p.Synced++
+				}
+			}
+			p.Percent = percent(p.Synced, p.Total)
+			synced += p.Synced
+			total += p.Total
+		}
+		s.Kinds = append(s.Kinds, p)
+	}
+	sort.Slice(s.Kinds, func(i, j int) bool { return s.Kinds[i].Kind < s.Kinds[j].Kind })
+	if g.timedOut {
+		s.Conditions = []v1alpha1.Condition{resource.InitialSyncTimedOut(g.timeout, g.pending())}
+	}
+	switch {
+	case g.done:
+		s.Percent = 100
+	case unlisted && total == 0:
+		s.Percent = 0
+	default:
+		// The sync isn't complete until it's done, e.g. while the
+		// objects of some kinds aren't listed yet.
+		s.Percent = percent(synced, total)
+		if s.Percent == 100 {
+			s.Percent = 99
+		}
+	}
+	return s
+}
+
+// percent returns the share of the total that is synced, rounded down so that
+// an incomplete sync is never reported as 100 percent. Nothing to sync is
+// all synced.
+func percent(synced, total int) int {
+	if total == 0 {
+		return 100
+	}
+	return synced * 100 / total
+}
+
+// Start lists the objects to sync and waits until they're synced, the timeout
+// passes or the stop channel is closed. The signal file isn't written if the
+// timeout passes.
+func (g *Gate) Start(stop <-chan struct{}) error {
+	sctx, scancel := resource.ContextFromStop(stop)
+	defer scancel()
+	ctx, cancel := context.WithTimeout(sctx, g.timeout)
+	defer cancel()
+	t := time.NewTicker(g.interval)
+	defer t.Stop()
+	for {
+		if g.poll(ctx) {
+			break
+		}
+		select {
+		case <-stop:
+			return nil
+		case <-ctx.Done():
+			g.mu.Lock()
+			g.timedOut = true
+			pending := g.pending()
+			g.mu.Unlock()
+			g.log.Info("Stopped waiting for the initial sync to be complete", "timeout", g.timeout, "pending", pending)
+			return nil
+		case <-t.C:
+		}
+	}
+	g.log.Info("Initial sync is complete")
+	if g.file == "" {
+		return nil
+	}
+	return errors.Wrap(ioutil.WriteFile(g.file, []byte(time.Now().UTC().Format(time.RFC3339)+"\n"), 0644), errWriteSignal)
+}
+
+// poll lists the objects to sync if they're not listed yet and returns
+// whether all of them are synced.
+func (g *Gate) poll(ctx context.Context) bool {
+	if g.expected == nil {
+		expected, err := g.list(ctx)
+		if err != nil {
+			g.log.Debug("Cannot list the objects of the initial sync", "error", err)
+			return false
+		}
+		g.mu.Lock()
+		g.expected = expected
+		g.mu.Unlock()
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.pending()) > 0 {
+		g.logProgress()
+		return false
+	}
+	g.done = true
+	g.synced = nil
+	return true
+}
+
+func (g *Gate) list(ctx context.Context) (map[string][]string, error) {
+	g.mu.Lock()
+	lists := make(map[string]ListFn, len(g.lists))
+	for k, fn := range g.lists {
+		lists[k] = fn
+	}
+	g.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	expected := make(map[string][]string, len(lists))
+	for k, fn := range lists {
+		names, err := fn(ctx)
+		if err != nil {
+			return nil, errors.Wrapf(err, errFmtListPending, k)
+		}
+		expected[k] = names
+	}
+	return expected, nil
+}
+
+// logProgress logs the progress of the initial sync if it changed since it was
+// last logged, but not more often than every progressLogInterval. It must be
+// called with the lock held.
+func (g *Gate) logProgress() {
+	s := g.status()
+	if s.Percent == g.loggedPercent || time.Since(g.loggedAt) < progressLogInterval {
+		return
+	}
+	g.loggedPercent, g.loggedAt = s.Percent, time.Now()
+	kv := []interface{}{"percent", s.Percent}
+	for _, k := range s.Kinds {
+		if k.Listed {
+			kv = append(kv, k.Kind, fmt.Sprintf("%d/%d", k.Synced, k.Total))
+		}
+	}
+	g.log.Info("Initial sync is in progress", kv...)
+}
+
+// pending returns the kinds that have objects that aren't synced yet, all of
+// them if the objects aren't listed yet. It must be called with the lock
+// held.
+func (g *Gate) pending() []string {
+	var kinds []string
+	for k := range g.lists {
+		names, listed := g.expected[k]
+		if !listed {
+			kinds = append(kinds, k)
+			continue
+		}
+		for _, n := range names {
+			if !g.synced[k][n] {
+				kinds = append(kinds, k)
+				break
+			}
+		}
+	}
+	sort.Strings(kinds)
+	return kinds
+}
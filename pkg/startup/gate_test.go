@@ -0,0 +1,194 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package startup
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+
+	"github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/crossplane/agent/pkg/resource"
+)
+
+var errBoom = errors.New("boom")
+
+func names(n ...string) ListFn {
+	return func(_ context.Context) ([]string, error) { return n, nil }
+}
+
+func TestGateCheck(t *testing.T) {
+	type want struct {
+		done bool
+		err  error
+	}
+	cases := map[string]struct {
+		reason string
+		lists  map[string]ListFn
+		synced map[string][]string
+		want   want
+	}{
+		"NothingToSync": {
+			reason: "The initial sync should be complete right away if there is nothing to sync",
+			lists:  map[string]ListFn{"compositions": names()},
+			want:   want{done: true},
+		},
+		"Pending": {
+			reason: "The initial sync should not be complete until all listed objects are synced",
+			lists:  map[string]ListFn{"compositions": names("a", "b"), "xrds": names("c")},
+			synced: map[string][]string{"compositions": {"a"}, "xrds": {"c"}},
+			want:   want{err: errors.Errorf(errFmtNotSynced, 66, []string{"compositions"})},
+		},
+		"ListFailed": {
+			reason: "The initial sync should not be complete until the objects can be listed",
+			lists: map[string]ListFn{"compositions": func(_ context.Context) ([]string, error) {
+				return nil, errBoom
+			}},
+			want: want{err: errors.Errorf(errFmtNotSynced, 0, []string{"compositions"})},
+		},
+		"Complete": {
+			reason: "The initial sync should be complete once all listed objects are synced",
+			lists:  map[string]ListFn{"compositions": names("a", "b")},
+			synced: map[string][]string{"compositions": {"a", "b", "c"}},
+			want:   want{done: true},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			g := NewGate()
+			for k, fn := range tc.lists {
+				g.Expect(k, fn)
+			}
+			for k, ns := range tc.synced {
+				for _, n := range ns {
+					g.Synced(k, n)
+				}
+			}
+			done := g.poll(context.Background())
+			if diff := cmp.Diff(tc.want.done, done); diff != "" {
+				t.Errorf("\nReason: %s\ng.poll(): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.err, g.Check(nil), test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\ng.Check(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestGateStart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // nolint:errcheck
+	file := filepath.Join(dir, "synced")
+
+	g := NewGate(WithSignalFile(file))
+	g.Expect("compositions", names("a"))
+	g.Synced("compositions", "a")
+	if err := g.Start(make(chan struct{})); err != nil {
+		t.Errorf("\nReason: %s\ng.Start(...): %s", "The signal file should be written", err)
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Errorf("\nReason: %s\nos.Stat(...): %s", "The signal file should exist once the initial sync is complete", err)
+	}
+}
+
+func TestGateStartTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // nolint:errcheck
+	file := filepath.Join(dir, "synced")
+
+	g := NewGate(WithSignalFile(file), WithTimeout(10*time.Millisecond), WithPollInterval(time.Millisecond))
+	g.Expect("compositions", names("a", "b"))
+	g.Synced("compositions", "a")
+	if err := g.Start(make(chan struct{})); err != nil {
+		t.Errorf("\nReason: %s\ng.Start(...): %s", "The Gate should stop waiting once the timeout passes", err)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("\nReason: %s\nos.Stat(...): %v", "The signal file should not be written when the initial sync times out", err)
+	}
+	if err := g.Check(nil); err != nil {
+		t.Errorf("\nReason: %s\ng.Check(...): %s", "The Gate should not fail the readiness check once it timed out", err)
+	}
+	want := []v1alpha1.Condition{resource.InitialSyncTimedOut(10*time.Millisecond, []string{"compositions"})}
+	if diff := cmp.Diff(want, g.Status().Conditions, test.EquateConditions()); diff != "" {
+		t.Errorf("\nReason: %s\ng.Status(): -want, +got:\n%s", "The Gate should report that it timed out", diff)
+	}
+}
+
+func TestGateStatus(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		lists  map[string]ListFn
+		synced map[string][]string
+		want   SyncStatus
+	}{
+		"Pending": {
+			reason: "The progress of every kind and of all of them should be reported",
+			lists:  map[string]ListFn{"xrds": names("c"), "compositions": names("a", "b", "c", "d")},
+			synced: map[string][]string{"compositions": {"a", "e"}, "xrds": {"c"}},
+			want: SyncStatus{Percent: 40, Kinds: []KindProgress{
+				{Kind: "compositions", Listed: true, Synced: 1, Total: 4, Percent: 25},
+				{Kind: "xrds", Listed: true, Synced: 1, Total: 1, Percent: 100},
+			}},
+		},
+		"NotListed": {
+			reason: "The kinds whose objects aren't listed yet should be reported without a total",
+			lists: map[string]ListFn{"compositions": func(_ context.Context) ([]string, error) {
+				return nil, errBoom
+			}},
+			want: SyncStatus{Kinds: []KindProgress{{Kind: "compositions"}}},
+		},
+		"Complete": {
+			reason: "A complete initial sync should be reported as such",
+			lists:  map[string]ListFn{"compositions": names("a", "b")},
+			synced: map[string][]string{"compositions": {"a", "b"}},
+			want: SyncStatus{Complete: true, Percent: 100, Kinds: []KindProgress{
+				{Kind: "compositions", Listed: true, Synced: 2, Total: 2, Percent: 100},
+			}},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			g := NewGate()
+			for k, fn := range tc.lists {
+				g.Expect(k, fn)
+			}
+			for k, ns := range tc.synced {
+				for _, n := range ns {
+					g.Synced(k, n)
+				}
+			}
+			g.poll(context.Background())
+			if diff := cmp.Diff(tc.want, g.Status()); diff != "" {
+				t.Errorf("\nReason: %s\ng.Status(): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package transform transforms the objects that are synced from the remote
+// cluster with operator-defined JSON patches before they're applied to the
+// local cluster, e.g. to replace the region defaults of Compositions or to
+// strip features the local cluster doesn't support.
+package transform
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+
+	"github.com/crossplane/crossplane-runtime/pkg/resource"
+)
+
+const (
+	errReadRules      = "cannot read transformation rules file"
+	errParseRules     = "cannot parse transformation rules file"
+	errFmtInvalidRule = "invalid transformation rule %d"
+	errNoResource     = "resource is required"
+	errNoPatch        = "patch is required"
+	errFmtOp          = "operation %d: unsupported op %q"
+	errFmtPath        = "operation %d: path %q must start with /"
+	errFmtFrom        = "operation %d: op %q requires from"
+	errFmtProtected   = "operation %d: path %q cannot be changed"
+	errDecodePatch    = "cannot decode patch"
+	errMarshal        = "cannot marshal object"
+	errUnmarshal      = "cannot unmarshal transformed object"
+	errFmtApply       = "cannot apply transformation rule %d"
+)
+
+// The paths that rules cannot change since the synced object would no longer
+// be the counterpart of the remote object, or its owners would be decided by
+// the rules instead of the agent.
+var protected = []string{"/apiVersion", "/kind", "/metadata/name", "/metadata/namespace", "/metadata/ownerReferences"}
+
+var ops = map[string]bool{"add": true, "remove": true, "replace": true, "move": true, "copy": true, "test": true}
+
+// Rules are the transformation rules of a rules file.
+type Rules struct {
+	Rules []Rule `json:"rules"`
+}
+
+// A Rule transforms the synced objects of a type with a JSON patch.
+type Rule struct {
+	// Resource is the type of the objects that are transformed in
+	// resource.group format, e.g. compositions.apiextensions.crossplane.io.
+	Resource string `json:"resource"`
+
+	// Names are the names of the objects that are transformed. All objects of
+	// the type are transformed if none are given.
+	Names []string `json:"names,omitempty"`
+
+	// Patch is the RFC 6902 JSON patch that is applied to the objects. The
+	// rule is skipped for an object if a test operation of it fails, so test
+	// operations can be used as conditions.
+	Patch []Operation `json:"patch"`
+}
+
+// An Operation of a JSON patch.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Validate returns an error if the rule cannot be applied to any object.
+func (r Rule) Validate() error {
+	if r.Resource == "" {
+		return errors.New(errNoResource)
+	}
+	if len(r.Patch) == 0 {
+		return errors.New(errNoPatch)
+	}
+	for i, o := range r.Patch {
+		if !ops[o.Op] {
+			return errors.Errorf(errFmtOp, i, o.Op)
+		}
+		if !strings.HasPrefix(o.Path, "/") {
+			return errors.Errorf(errFmtPath, i, o.Path)
+		}
+		if (o.Op == "move" || o.Op == "copy") && o.From == "" {
+			return errors.Errorf(errFmtFrom, i, o.Op)
+		}
+		if o.Op == "test" {
+			continue
+		}
+		for _, p := range protected {
+			if o.Path == p || strings.HasPrefix(o.Path, p+"/") || strings.HasPrefix(p, o.Path+"/") {
+				return errors.Errorf(errFmtProtected, i, o.Path)
+			}
+		}
+	}
+	_, err := r.decode()
+	return err
+}
+
+func (r Rule) decode() (jsonpatch.Patch, error) {
+	raw, err := json.Marshal(r.Patch)
+	if err != nil {
+		return nil, errors.Wrap(err, errDecodePatch)
+	}
+	p, err := jsonpatch.DecodePatch(raw)
+	return p, errors.Wrap(err, errDecodePatch)
+}
+
+func (r Rule) matches(typ, name string) bool {
+	if r.Resource != typ {
+		return false
+	}
+	if len(r.Names) == 0 {
+		return true
+	}
+	for _, n := range r.Names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+type rule struct {
+	Rule
+	patch jsonpatch.Patch
+}
+
+// Load returns a Transformer with the rules of the supplied YAML file. All
+// rules are validated so that invalid ones are caught at startup rather than
+// when the objects are synced.
+func Load(path string) (*Transformer, error) {
+	raw, err := ioutil.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, errors.Wrap(err, errReadRules)
+	}
+	rs := &Rules{}
+	if err := yaml.UnmarshalStrict(raw, rs); err != nil {
+		return nil, errors.Wrap(err, errParseRules)
+	}
+	return New(rs.Rules...)
+}
+
+// New returns a Transformer with the supplied rules, or an error if any of
+// them is invalid.
+func New(rules ...Rule) (*Transformer, error) {
+	t := &Transformer{rules: make([]rule, len(rules))}
+	for i, r := range rules {
+		if err := r.Validate(); err != nil {
+			return nil, errors.Wrapf(err, errFmtInvalidRule, i)
+		}
+		p, _ := r.decode()
+		t.rules[i] = rule{Rule: r, patch: p}
+	}
+	return t, nil
+}
+
+// A Transformer applies the transformation rules to the synced objects in the
+// order they're given.
+type Transformer struct {
+	rules []rule
+}
+
+// Resources returns the types that the rules transform in resource.group
+// format.
+func (t *Transformer) Resources() []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, r := range t.rules {
+		if !seen[r.Resource] {
+			seen[r.Resource] = true
+			out = append(out, r.Resource)
+		}
+	}
+	return out
+}
+
+// Transform applies the rules of the supplied type, in resource.group format,
+// that match the name of the supplied object and writes the result to out,
+// which has to be an empty object of the same type. It returns false without
+// touching out if no rule matched.
+func (t *Transformer) Transform(typ string, in resource.Object, out runtime.Object) (bool, error) {
+	var doc []byte
+	for i, r := range t.rules {
+		if !r.matches(typ, in.GetName()) {
+			continue
+		}
+		if doc == nil {
+			raw, err := json.Marshal(in)
+			if err != nil {
+				return false, errors.Wrap(err, errMarshal)
+			}
+			doc = raw
+		}
+		patched, err := r.patch.Apply(doc)
+		if errors.Cause(err) == jsonpatch.ErrTestFailed {
+			continue
+		}
+		if err != nil {
+			return false, errors.Wrapf(err, errFmtApply, i)
+		}
+		doc = patched
+	}
+	if doc == nil {
+		return false, nil
+	}
+	return true, errors.Wrap(json.Unmarshal(doc, out), errUnmarshal)
+}
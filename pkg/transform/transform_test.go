@@ -0,0 +1,174 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+)
+
+const compositions = "compositions.apiextensions.crossplane.io"
+
+func composition(name, region string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apiextensions.crossplane.io/v1alpha1",
+		"kind":       "Composition",
+		"metadata":   map[string]interface{}{"name": name},
+		"spec":       map[string]interface{}{"region": region},
+	}}
+	return u
+}
+
+func value(v interface{}) json.RawMessage {
+	raw, _ := json.Marshal(v)
+	return raw
+}
+
+func TestValidate(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		rule   Rule
+		want   error
+	}{
+		"Valid": {
+			reason: "Rules with supported operations should be valid",
+			rule: Rule{Resource: compositions, Patch: []Operation{
+				{Op: "test", Path: "/metadata/name", Value: value("aws")},
+				{Op: "replace", Path: "/spec/region", Value: value("eu-west-1")},
+			}},
+		},
+		"NoResource": {
+			reason: "Rules without a resource should be rejected",
+			rule:   Rule{Patch: []Operation{{Op: "remove", Path: "/spec/region"}}},
+			want:   errors.New(errNoResource),
+		},
+		"UnsupportedOp": {
+			reason: "Rules with unsupported operations should be rejected",
+			rule:   Rule{Resource: compositions, Patch: []Operation{{Op: "merge", Path: "/spec"}}},
+			want:   errors.Errorf(errFmtOp, 0, "merge"),
+		},
+		"NoFrom": {
+			reason: "Move operations without from should be rejected",
+			rule:   Rule{Resource: compositions, Patch: []Operation{{Op: "move", Path: "/spec/zone"}}},
+			want:   errors.Errorf(errFmtFrom, 0, "move"),
+		},
+		"Protected": {
+			reason: "Rules that change the name of the objects should be rejected",
+			rule:   Rule{Resource: compositions, Patch: []Operation{{Op: "replace", Path: "/metadata", Value: value(map[string]string{})}}},
+			want:   errors.Errorf(errFmtProtected, 0, "/metadata"),
+		},
+		"ProtectedOwners": {
+			reason: "Rules that change the owners of the objects should be rejected",
+			rule:   Rule{Resource: compositions, Patch: []Operation{{Op: "add", Path: "/metadata/ownerReferences/-", Value: value(map[string]string{})}}},
+			want:   errors.Errorf(errFmtProtected, 0, "/metadata/ownerReferences/-"),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := tc.rule.Validate()
+			if diff := cmp.Diff(tc.want, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\nReason: %s\nValidate(): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestTransform(t *testing.T) {
+	replaceRegion := Rule{Resource: compositions, Patch: []Operation{
+		{Op: "test", Path: "/spec/region", Value: value("us-east-1")},
+		{Op: "replace", Path: "/spec/region", Value: value("eu-west-1")},
+	}}
+	type want struct {
+		ok  bool
+		out *unstructured.Unstructured
+		err error
+	}
+	cases := map[string]struct {
+		reason string
+		rules  []Rule
+		typ    string
+		in     *unstructured.Unstructured
+		want   want
+	}{
+		"Transformed": {
+			reason: "The objects of the type of a rule should be transformed",
+			rules:  []Rule{replaceRegion},
+			typ:    compositions,
+			in:     composition("aws", "us-east-1"),
+			want:   want{ok: true, out: composition("aws", "eu-west-1")},
+		},
+		"OtherType": {
+			reason: "The objects of other types should not be transformed",
+			rules:  []Rule{replaceRegion},
+			typ:    "storeconfigs.secrets.crossplane.io",
+			in:     composition("aws", "us-east-1"),
+			want:   want{out: &unstructured.Unstructured{}},
+		},
+		"OtherName": {
+			reason: "The objects whose names aren't given in a rule should not be transformed",
+			rules:  []Rule{{Resource: compositions, Names: []string{"gcp"}, Patch: replaceRegion.Patch}},
+			typ:    compositions,
+			in:     composition("aws", "us-east-1"),
+			want:   want{out: &unstructured.Unstructured{}},
+		},
+		"TestFailed": {
+			reason: "A rule should be skipped if its test operation fails",
+			rules: []Rule{replaceRegion, {Resource: compositions, Patch: []Operation{
+				{Op: "add", Path: "/spec/zone", Value: value("a")},
+			}}},
+			typ: compositions,
+			in:  composition("aws", "us-west-2"),
+			want: want{ok: true, out: func() *unstructured.Unstructured {
+				u := composition("aws", "us-west-2")
+				_ = unstructured.SetNestedField(u.Object, "a", "spec", "zone")
+				return u
+			}()},
+		},
+		"ApplyFailed": {
+			reason: "An error should be returned if a rule cannot be applied",
+			rules:  []Rule{{Resource: compositions, Patch: []Operation{{Op: "remove", Path: "/spec/zone"}}}},
+			typ:    compositions,
+			in:     composition("aws", "us-east-1"),
+			want:   want{out: &unstructured.Unstructured{}, err: errors.Errorf(errFmtApply, 0)},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			tr, err := New(tc.rules...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out := &unstructured.Unstructured{}
+			ok, err := tr.Transform(tc.typ, tc.in, out)
+			if (tc.want.err == nil) != (err == nil) {
+				t.Errorf("\nReason: %s\nTransform(...): want error %v, got %v", tc.reason, tc.want.err, err)
+			}
+			if diff := cmp.Diff(tc.want.ok, ok); diff != "" {
+				t.Errorf("\nReason: %s\nTransform(...): -want ok, +got ok:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.out, out); diff != "" {
+				t.Errorf("\nReason: %s\nTransform(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
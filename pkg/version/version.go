@@ -0,0 +1,32 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package version contains the version of the agent.
+package version
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Version of the agent. It's set at build time.
+var Version = "unknown"
+
+// UserAgent returns the User-Agent that the agent sends with its requests,
+// e.g. crossplane-agent/v0.1.0 (linux/amd64).
+func UserAgent() string {
+	return fmt.Sprintf("crossplane-agent/%s (%s/%s)", Version, runtime.GOOS, runtime.GOARCH)
+}
@@ -0,0 +1,193 @@
+//go:build e2e
+// +build e2e
+
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	crds "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane/apis/apiextensions"
+	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1/ccrd"
+
+	agentapiextensions "github.com/crossplane/agent/pkg/controllers/apiextensions"
+	"github.com/crossplane/agent/pkg/controllers/crd"
+	"github.com/crossplane/agent/pkg/controllers/xrd"
+)
+
+const (
+	pollInterval = 250 * time.Millisecond
+	pollTimeout  = 30 * time.Second
+
+	xrdCRDName = "compositeresourcedefinitions.apiextensions.crossplane.io"
+)
+
+// The suite runs two API servers. The remote one plays the role of the central
+// Crossplane cluster and the local one plays the role of the application
+// cluster that the agent runs in. Both clients bypass the manager caches so
+// that assertions observe what's actually stored in the API servers.
+var (
+	ctx    = context.Background()
+	scheme = runtime.NewScheme()
+
+	localClient  client.Client
+	remoteClient client.Client
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(run(m))
+}
+
+func run(m *testing.M) int {
+	for _, add := range []func(*runtime.Scheme) error{
+		clientgoscheme.AddToScheme,
+		crds.AddToScheme,
+		apiextensions.AddToScheme,
+	} {
+		if err := add(scheme); err != nil {
+			fmt.Fprintln(os.Stderr, errors.Wrap(err, "cannot build scheme"))
+			return 1
+		}
+	}
+
+	// Crossplane is not running in the remote cluster, so only its CRDs are
+	// installed there. The local cluster starts out empty; the agent is
+	// expected to bring everything it needs from the remote cluster.
+	remoteEnv := &envtest.Environment{
+		CRDDirectoryPaths:     []string{filepath.Join("testdata", "crds")},
+		ErrorIfCRDPathMissing: true,
+	}
+	localEnv := &envtest.Environment{}
+
+	remoteCfg, err := remoteEnv.Start()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, errors.Wrap(err, "cannot start remote test environment"))
+		return 1
+	}
+	defer remoteEnv.Stop() // nolint:errcheck
+
+	localCfg, err := localEnv.Start()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, errors.Wrap(err, "cannot start local test environment"))
+		return 1
+	}
+	defer localEnv.Stop() // nolint:errcheck
+
+	stop := make(chan struct{})
+	defer close(stop)
+	if err := startAgent(localCfg, remoteCfg, stop); err != nil {
+		fmt.Fprintln(os.Stderr, errors.Wrap(err, "cannot start agent"))
+		return 1
+	}
+
+	return m.Run()
+}
+
+// startAgent wires the controllers the same way the local and remote modes
+// of the agent do, except that both managers are given explicit configs and
+// a shared stop channel.
+func startAgent(localCfg, remoteCfg *rest.Config, stop <-chan struct{}) error {
+	var err error
+	if localClient, err = client.New(localCfg, client.Options{Scheme: scheme}); err != nil {
+		return errors.Wrap(err, "cannot create local client")
+	}
+	if remoteClient, err = client.New(remoteCfg, client.Options{Scheme: scheme}); err != nil {
+		return errors.Wrap(err, "cannot create remote client")
+	}
+	log := logging.NewLogrLogger(zap.New(zap.UseDevMode(true)).WithName("e2e"))
+
+	remoteMgr, err := ctrl.NewManager(remoteCfg, ctrl.Options{Scheme: scheme, MetricsBindAddress: "0"})
+	if err != nil {
+		return errors.Wrap(err, "cannot create remote cluster manager")
+	}
+	if err := crd.Setup(remoteMgr, localClient, log); err != nil {
+		return errors.Wrap(err, "cannot setup remote cluster controller")
+	}
+	localCache, err := cache.New(localCfg, cache.Options{Scheme: scheme})
+	if err != nil {
+		return errors.Wrap(err, "cannot create local cluster cache")
+	}
+	if err := remoteMgr.Add(localCache); err != nil {
+		return errors.Wrap(err, "cannot add local cluster cache")
+	}
+	crdInformer, err := localCache.GetInformer(ctx, &crds.CustomResourceDefinition{})
+	if err != nil {
+		return errors.Wrap(err, "cannot get local CustomResourceDefinition informer")
+	}
+	for _, setup := range []func(mgr manager.Manager, localClient client.Client, logger logging.Logger, opts ...agentapiextensions.SetupOption) error{
+		agentapiextensions.SetupXRDSync,
+		agentapiextensions.SetupCompositionSync,
+	} {
+		if err := setup(remoteMgr, localClient, log, agentapiextensions.WithLocalCRDSource(&source.Informer{Informer: crdInformer})); err != nil {
+			return errors.Wrap(err, "cannot setup remote cluster controller")
+		}
+	}
+	go func() {
+		_ = remoteMgr.Start(stop)
+	}()
+
+	// The local manager watches CompositeResourceDefinitions, so its informers
+	// cannot start until the remote controllers have synced that CRD.
+	if err := waitForEstablished(localClient, xrdCRDName); err != nil {
+		return err
+	}
+
+	localMgr, err := ctrl.NewManager(localCfg, ctrl.Options{Scheme: scheme, MetricsBindAddress: "0"})
+	if err != nil {
+		return errors.Wrap(err, "cannot create local cluster manager")
+	}
+	if err := xrd.Setup(localMgr, remoteClient, log); err != nil {
+		return errors.Wrap(err, "cannot setup local cluster controller")
+	}
+	go func() {
+		_ = localMgr.Start(stop)
+	}()
+	return nil
+}
+
+func waitForEstablished(kube client.Client, name string) error {
+	err := wait.PollImmediate(pollInterval, pollTimeout, func() (bool, error) {
+		c := &crds.CustomResourceDefinition{}
+		if err := kube.Get(ctx, types.NamespacedName{Name: name}, c); err != nil {
+			return false, client.IgnoreNotFound(err)
+		}
+		return ccrd.IsEstablished(c.Status), nil
+	})
+	return errors.Wrapf(err, "custom resource definition %s is not established", name)
+}
@@ -0,0 +1,257 @@
+//go:build e2e
+// +build e2e
+
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	crds "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	runtimev1alpha1 "github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/meta"
+	"github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/claim"
+	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
+	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1/ccrd"
+
+	"github.com/crossplane/agent/pkg/controllers/xrd"
+	"github.com/crossplane/agent/pkg/resource"
+)
+
+const (
+	namespace  = "default"
+	secretName = "db-conn"
+)
+
+var claimGVK = schema.GroupVersionKind{Group: "e2e.agent.crossplane.io", Version: "v1alpha1", Kind: "Database"}
+
+// eventually polls the supplied condition function until it returns true or
+// the poll timeout is reached.
+func eventually(t *testing.T, reason string, fn func() (bool, error)) {
+	t.Helper()
+	if err := wait.PollImmediate(pollInterval, pollTimeout, fn); err != nil {
+		t.Fatalf("\nReason: %s\n%v", reason, err)
+	}
+}
+
+// poke triggers a reconcile of the supplied object by adding an annotation
+// with a new value. The agent doesn't watch the other side of the sync, so
+// tests use this instead of waiting for the periodic resync.
+func poke(t *testing.T, kube client.Client, obj runtime.Object, key types.NamespacedName) {
+	t.Helper()
+	eventually(t, "the object should be annotated", func() (bool, error) {
+		if err := kube.Get(ctx, key, obj); err != nil {
+			return false, err
+		}
+		o, _ := obj.(metav1.Object)
+		meta.AddAnnotations(o, map[string]string{"e2e.agent.crossplane.io/poke": metav1.Now().String()})
+		err := kube.Update(ctx, obj)
+		return err == nil, client.IgnoreNotFound(ignoreConflict(err))
+	})
+}
+
+func ignoreConflict(err error) error {
+	if kerrors.IsConflict(err) {
+		return nil
+	}
+	return err
+}
+
+// publish emulates what Crossplane does in the remote cluster when a
+// CompositeResourceDefinition that offers a claim is created.
+func publish(t *testing.T) *v1alpha1.CompositeResourceDefinition {
+	t.Helper()
+	x := &v1alpha1.CompositeResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "compositedatabases." + claimGVK.Group},
+		Spec: v1alpha1.CompositeResourceDefinitionSpec{
+			ClaimNames: &crds.CustomResourceDefinitionNames{
+				Kind:     claimGVK.Kind,
+				ListKind: claimGVK.Kind + "List",
+				Plural:   "databases",
+				Singular: "database",
+			},
+			CRDSpecTemplate: v1alpha1.CRDSpecTemplate{
+				Group:   claimGVK.Group,
+				Version: claimGVK.Version,
+				Names: crds.CustomResourceDefinitionNames{
+					Kind:     "CompositeDatabase",
+					ListKind: "CompositeDatabaseList",
+					Plural:   "compositedatabases",
+					Singular: "compositedatabase",
+				},
+			},
+		},
+	}
+	if err := remoteClient.Create(ctx, x); err != nil {
+		t.Fatalf("cannot create remote xrd: %v", err)
+	}
+	c, err := ccrd.New(ccrd.ForCompositeResourceClaim(x))
+	if err != nil {
+		t.Fatalf("cannot render claim crd: %v", err)
+	}
+	if err := remoteClient.Create(ctx, c); err != nil {
+		t.Fatalf("cannot create remote claim crd: %v", err)
+	}
+	return x
+}
+
+func TestCompositionSync(t *testing.T) {
+	newComposition := func(name string) *v1alpha1.Composition {
+		return &v1alpha1.Composition{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: v1alpha1.CompositionSpec{
+				From: v1alpha1.TypeReference{APIVersion: "e2e.agent.crossplane.io/v1alpha1", Kind: "CompositeDatabase"},
+				To: []v1alpha1.ComposedTemplate{{
+					Base: runtime.RawExtension{Raw: []byte(`{"apiVersion":"v1","kind":"ConfigMap"}`)},
+				}},
+				WriteConnectionSecretsToNamespace: "crossplane-system",
+			},
+		}
+	}
+	keep, drop := newComposition("e2e-keep"), newComposition("e2e-drop")
+	for _, c := range []*v1alpha1.Composition{keep, drop} {
+		if err := remoteClient.Create(ctx, c); err != nil {
+			t.Fatalf("cannot create remote composition: %v", err)
+		}
+	}
+	eventually(t, "remote compositions should be synced to the local cluster", func() (bool, error) {
+		for _, name := range []string{keep.GetName(), drop.GetName()} {
+			err := localClient.Get(ctx, types.NamespacedName{Name: name}, &v1alpha1.Composition{})
+			if kerrors.IsNotFound(err) {
+				return false, nil
+			}
+			if err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	})
+
+	if err := remoteClient.Delete(ctx, drop); err != nil {
+		t.Fatalf("cannot delete remote composition: %v", err)
+	}
+	poke(t, remoteClient, &v1alpha1.Composition{}, types.NamespacedName{Name: keep.GetName()})
+	eventually(t, "compositions deleted in the remote cluster should be deleted in the local cluster", func() (bool, error) {
+		err := localClient.Get(ctx, types.NamespacedName{Name: drop.GetName()}, &v1alpha1.Composition{})
+		return kerrors.IsNotFound(err), client.IgnoreNotFound(err)
+	})
+}
+
+func TestClaimLifecycle(t *testing.T) {
+	x := publish(t)
+	crdName := xrd.GetClaimCRDName(*x).Name
+	key := types.NamespacedName{Namespace: namespace, Name: "e2e-db"}
+
+	t.Run("DefinitionSynced", func(t *testing.T) {
+		eventually(t, "the xrd should be synced to the local cluster", func() (bool, error) {
+			err := localClient.Get(ctx, types.NamespacedName{Name: x.GetName()}, &v1alpha1.CompositeResourceDefinition{})
+			return err == nil, client.IgnoreNotFound(err)
+		})
+		if err := waitForEstablished(localClient, crdName); err != nil {
+			t.Fatalf("\nReason: %s\n%v", "the claim crd should be established in the local cluster", err)
+		}
+	})
+
+	t.Run("ClaimForwarded", func(t *testing.T) {
+		rs := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "remote-" + secretName},
+			Data:       map[string][]byte{"endpoint": []byte("db.example.org")},
+		}
+		if err := remoteClient.Create(ctx, rs); err != nil {
+			t.Fatalf("cannot create remote secret: %v", err)
+		}
+
+		cm := claim.New(claim.WithGroupVersionKind(claimGVK))
+		cm.SetNamespace(key.Namespace)
+		cm.SetName(key.Name)
+		cm.SetWriteConnectionSecretToReference(&runtimev1alpha1.LocalSecretReference{Name: rs.GetName()})
+		eventually(t, "the local claim should be created", func() (bool, error) {
+			// The API endpoints of a freshly established CRD may take a moment
+			// to become available to clients.
+			err := localClient.Create(ctx, cm)
+			return err == nil, nil
+		})
+
+		eventually(t, "the claim should be created in the remote cluster", func() (bool, error) {
+			err := remoteClient.Get(ctx, key, claim.New(claim.WithGroupVersionKind(claimGVK)))
+			return err == nil, client.IgnoreNotFound(err)
+		})
+	})
+
+	t.Run("StatusPropagated", func(t *testing.T) {
+		eventually(t, "the remote claim should be marked as available", func() (bool, error) {
+			rc := claim.New(claim.WithGroupVersionKind(claimGVK))
+			if err := remoteClient.Get(ctx, key, rc); err != nil {
+				return false, err
+			}
+			rc.SetConditions(runtimev1alpha1.Available())
+			err := remoteClient.Status().Update(ctx, rc)
+			return err == nil, ignoreConflict(err)
+		})
+		poke(t, localClient, claim.New(claim.WithGroupVersionKind(claimGVK)).GetUnstructured(), key)
+		eventually(t, "the status of the remote claim should be propagated to the local claim", func() (bool, error) {
+			lc := claim.New(claim.WithGroupVersionKind(claimGVK))
+			if err := localClient.Get(ctx, key, lc); err != nil {
+				return false, err
+			}
+			ready := lc.GetCondition(runtimev1alpha1.TypeReady).Status == corev1.ConditionTrue
+			synced := lc.GetCondition(resource.TypeAgentSync).Status == corev1.ConditionTrue
+			return ready && synced, nil
+		})
+	})
+
+	t.Run("ConnectionSecretPropagated", func(t *testing.T) {
+		eventually(t, "the connection secret should be propagated to the local cluster", func() (bool, error) {
+			s := &corev1.Secret{}
+			err := localClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: "remote-" + secretName}, s)
+			if kerrors.IsNotFound(err) {
+				return false, nil
+			}
+			if err != nil {
+				return false, err
+			}
+			return string(s.Data["endpoint"]) == "db.example.org", nil
+		})
+	})
+
+	t.Run("ClaimDeleted", func(t *testing.T) {
+		if err := localClient.Delete(ctx, claim.New(claim.WithGroupVersionKind(claimGVK), func(c *claim.Unstructured) {
+			c.SetNamespace(key.Namespace)
+			c.SetName(key.Name)
+		})); err != nil {
+			t.Fatalf("cannot delete local claim: %v", err)
+		}
+		eventually(t, "the remote claim should be deleted", func() (bool, error) {
+			err := remoteClient.Get(ctx, key, claim.New(claim.WithGroupVersionKind(claimGVK)))
+			return kerrors.IsNotFound(err), client.IgnoreNotFound(err)
+		})
+		eventually(t, "the local claim should be gone once the remote claim is deleted", func() (bool, error) {
+			err := localClient.Get(ctx, key, claim.New(claim.WithGroupVersionKind(claimGVK)))
+			return kerrors.IsNotFound(err), client.IgnoreNotFound(err)
+		})
+	})
+}